@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+var (
+	serverURL   string
+	instances   int
+	concurrency int
+	duration    time.Duration
+	productList []string
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "heartbeat-bench",
+	Short: "Measure update-server heartbeat throughput",
+	Long: `heartbeat-bench sends heartbeats from simulated instances to an update
+server as fast as it accepts them, and reports throughput, latency and how
+often the server asked updaters to back off.
+
+Run it against a test server with instances bench-0, bench-1 and so on
+registered first. Instance bench-N authenticates with the API key bench-key-N,
+so register it with api_key_hash set to the SHA-256 hex digest of that key.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         run,
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&serverURL, "url", "http://localhost:8080", "Update server URL")
+	rootCmd.Flags().IntVar(&instances, "instances", 5000, "Simulated instances")
+	rootCmd.Flags().IntVar(&concurrency, "concurrency", 64, "Heartbeats in flight at once")
+	rootCmd.Flags().DurationVar(&duration, "duration", 30*time.Second, "How long to send heartbeats")
+	rootCmd.Flags().StringSliceVar(&productList, "products", []string{"siemcore", "mysoc-agent"}, "Products each instance reports")
+}
+
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// result is the outcome of one heartbeat
+type result struct {
+	status  int // 0 when the request failed
+	latency time.Duration
+}
+
+func run(c *cobra.Command, args []string) error {
+	if instances <= 0 || concurrency <= 0 {
+		return fmt.Errorf("--instances and --concurrency must be positive")
+	}
+	url := strings.TrimRight(serverURL, "/") + "/api/v1/heartbeat"
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			MaxIdleConns:        concurrency,
+			MaxIdleConnsPerHost: concurrency,
+		},
+	}
+
+	fmt.Printf("Sending heartbeats from %d instances to %s for %s (%d in flight)\n", instances, url, duration, concurrency)
+
+	var next atomic.Int64
+	results := make([][]result, concurrency)
+	deadline := time.Now().Add(duration)
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				n := int(next.Add(1) - 1)
+				results[w] = append(results[w], send(client, url, n%instances))
+			}
+		}(w)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	report(results, elapsed)
+	return nil
+}
+
+// heartbeat builds the heartbeat of simulated instance n
+func heartbeat(n int) *types.Heartbeat {
+	hb := &types.Heartbeat{
+		InstanceID:     fmt.Sprintf("bench-%d", n),
+		InstanceType:   "bench",
+		Hostname:       fmt.Sprintf("bench-host-%d", n),
+		UpdaterVersion: "bench",
+		Timestamp:      time.Now(),
+	}
+	for _, product := range productList {
+		hb.Products = append(hb.Products, types.ProductStatus{
+			Name:    product,
+			Version: "1.0.0",
+			Channel: "stable",
+			Status:  "running",
+		})
+	}
+	return hb
+}
+
+// send sends the heartbeat of simulated instance n
+func send(client *http.Client, url string, n int) result {
+	body, _ := json.Marshal(heartbeat(n))
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return result{}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", fmt.Sprintf("bench-key-%d", n))
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return result{latency: time.Since(start)}
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	return result{status: resp.StatusCode, latency: time.Since(start)}
+}
+
+func report(results [][]result, elapsed time.Duration) {
+	var latencies []time.Duration
+	statuses := make(map[int]int)
+	for _, worker := range results {
+		for _, r := range worker {
+			statuses[r.status]++
+			latencies = append(latencies, r.latency)
+		}
+	}
+	if len(latencies) == 0 {
+		fmt.Println("No heartbeats sent")
+		return
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(p float64) time.Duration {
+		return latencies[int(p*float64(len(latencies)-1))]
+	}
+
+	fmt.Println()
+	fmt.Printf("Heartbeats:    %d in %s\n", len(latencies), elapsed.Round(time.Millisecond))
+	fmt.Printf("Throughput:    %.0f/s accepted (%.0f instances on 60s intervals)\n",
+		float64(statuses[http.StatusOK])/elapsed.Seconds(), 60*float64(statuses[http.StatusOK])/elapsed.Seconds())
+	fmt.Printf("Latency:       p50 %s  p95 %s  p99 %s  max %s\n",
+		percentile(0.50).Round(time.Microsecond), percentile(0.95).Round(time.Microsecond),
+		percentile(0.99).Round(time.Microsecond), latencies[len(latencies)-1].Round(time.Microsecond))
+	fmt.Printf("Accepted:      %d\n", statuses[http.StatusOK])
+	fmt.Printf("Backed off:    %d (503)\n", statuses[http.StatusServiceUnavailable])
+	fmt.Printf("Rate limited:  %d (429)\n", statuses[http.StatusTooManyRequests])
+	fmt.Printf("Failed:        %d\n", statuses[0])
+	for status, count := range statuses {
+		switch status {
+		case 0, http.StatusOK, http.StatusServiceUnavailable, http.StatusTooManyRequests:
+		default:
+			fmt.Printf("HTTP %d:      %d\n", status, count)
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/updater/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/updater/control"
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/updater/heartbeat"
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/updater/service"
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/updater/update"
@@ -25,7 +26,7 @@ var DaemonCmd = &cobra.Command{
 
 The daemon will:
   - Send regular heartbeats to the update server
-  - Check for updates and apply them
+  - Apply the updates, settings and commands the server answers them with
   - Monitor service health and restart crashed services
   - Apply security hardening and report status`,
 	RunE: runDaemon,
@@ -65,6 +66,11 @@ func runDaemon(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
+	// Settings the update server sent earlier override the config file
+	if err := cfg.LoadRemote(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
 	fmt.Printf("Loaded config from %s\n", configPath)
 	fmt.Printf("Instance: %s (%s)\n", cfg.Instance.ID, cfg.Instance.Type)
 	fmt.Printf("Server: %s\n", cfg.Server.URL)
@@ -77,21 +83,29 @@ func runDaemon(cmd *cobra.Command, args []string) error {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	// Start heartbeat reporter
 	heartbeatReporter := heartbeat.NewReporter(cfg)
-	go heartbeatReporter.Start(ctx)
-	fmt.Println("Heartbeat reporter started")
+	updateChecker := update.NewChecker(cfg)
+	serviceMonitor := service.NewMonitor(cfg)
+	serviceMonitor.EnableAlerts(heartbeatReporter.ReportAlert)
+
+	// Heartbeat responses drive the update checker and service monitor, and
+	// the results of the commands in them are reported back
+	dispatcher := control.NewDispatcher(cfg, updateChecker, serviceMonitor)
+	dispatcher.EnableResults(heartbeatReporter.ReportResult)
+	heartbeatReporter.EnableControl(dispatcher.Dispatch)
 
 	// Start update checker
-	updateChecker := update.NewChecker(cfg)
 	go updateChecker.Start(ctx)
 	fmt.Println("Update checker started")
 
 	// Start service monitor
-	serviceMonitor := service.NewMonitor(cfg)
 	go serviceMonitor.Start(ctx)
 	fmt.Println("Service monitor started")
 
+	// Start heartbeat reporter
+	go heartbeatReporter.Start(ctx)
+	fmt.Println("Heartbeat reporter started")
+
 	fmt.Println("Daemon running. Press Ctrl+C to stop.")
 
 	// Wait for shutdown signal
@@ -130,7 +130,7 @@ func runInit(cmd *cobra.Command, args []string) error {
 
 	// Step 5: Save updater configuration
 	fmt.Println("Step 5: Creating configuration...")
-	cfg := createUpdaterConfig(activation, initServerURL, initChannel)
+	cfg := createUpdaterConfig(activation, initServerURL, initChannel, cmd.Flags().Changed("channel"))
 	configPath := filepath.Join(baseDir, "updater", "config.yaml")
 	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
 		return fmt.Errorf("failed to create config directory: %w", err)
@@ -314,9 +314,12 @@ func downloadProduct(serverURL, apiKey, baseDir string, product types.ProductIns
 		return fmt.Errorf("download failed with status %d", resp.StatusCode)
 	}
 
-	// Save to bin directory
-	binaryPath := filepath.Join(baseDir, "bin", product.Name)
-	file, err := os.Create(binaryPath)
+	// Save to the install path from the product registry
+	installPath := productInstallPath(baseDir, product)
+	if err := os.MkdirAll(filepath.Dir(installPath), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(installPath)
 	if err != nil {
 		return err
 	}
@@ -326,9 +329,11 @@ func downloadProduct(serverURL, apiKey, baseDir string, product types.ProductIns
 		return err
 	}
 
-	// Make executable
-	if err := os.Chmod(binaryPath, 0755); err != nil {
-		return err
+	// Make binaries executable
+	if isBinaryProduct(product) {
+		if err := os.Chmod(installPath, 0755); err != nil {
+			return err
+		}
 	}
 
 	// Save version info
@@ -340,7 +345,7 @@ func downloadProduct(serverURL, apiKey, baseDir string, product types.ProductIns
 	return nil
 }
 
-func createUpdaterConfig(activation *types.LicenseActivationResponse, serverURL, channel string) *config.Config {
+func createUpdaterConfig(activation *types.LicenseActivationResponse, serverURL, channel string, channelOverride bool) *config.Config {
 	cfg := config.DefaultConfig()
 	cfg.Server.URL = serverURL
 	cfg.Server.APIKey = activation.Instance.APIKey
@@ -349,19 +354,25 @@ func createUpdaterConfig(activation *types.LicenseActivationResponse, serverURL,
 	cfg.Instance.LicenseKey = activation.License.LicenseKey
 	cfg.Update.Channel = channel
 
-	// Add product configurations
+	// Add product configurations from the install manifest
 	baseDir := config.BaseDir(activation.License.Type)
 	for _, p := range activation.Install.Products {
 		productCfg := config.ProductConfig{
-			Name:    p.Name,
-			Service: p.Name + ".service",
-			Binary:  filepath.Join(baseDir, "bin", p.Name),
-			Config:  filepath.Join(baseDir, "etc", p.Name+".yaml"),
-			Type:    "binary",
+			Name:           p.Name,
+			Binary:         productInstallPath(baseDir, p),
+			Config:         filepath.Join(baseDir, "etc", p.Name+".yaml"),
+			Type:           p.Type,
+			HealthEndpoint: p.HealthEndpoint,
+		}
+		if productCfg.Type == "" {
+			productCfg.Type = "binary"
 		}
-		// Add health endpoint for API products
-		if p.Name == "siemcore-api" || p.Name == "mysoc-api" {
-			productCfg.HealthEndpoint = "http://localhost:8080/health"
+		if isBinaryProduct(p) {
+			productCfg.Service = p.Name + ".service"
+		}
+		// An explicit --channel applies to every product
+		if !channelOverride {
+			productCfg.Channel = p.Channel
 		}
 		cfg.Products = append(cfg.Products, productCfg)
 	}
@@ -369,12 +380,29 @@ func createUpdaterConfig(activation *types.LicenseActivationResponse, serverURL,
 	return cfg
 }
 
+// productInstallPath resolves where a product is installed on this instance
+func productInstallPath(baseDir string, product types.ProductInstall) string {
+	if product.InstallPath == "" {
+		return filepath.Join(baseDir, "bin", product.Name)
+	}
+	return filepath.Join(baseDir, filepath.FromSlash(product.InstallPath))
+}
+
+// isBinaryProduct reports whether a product runs as a service
+func isBinaryProduct(product types.ProductInstall) bool {
+	return product.Type == "" || product.Type == "binary"
+}
+
 func createSystemdServices(baseDir, userName string, products []types.ProductInstall) error {
 	for _, product := range products {
+		if !isBinaryProduct(product) {
+			continue
+		}
+
 		serviceName := product.Name + ".service"
 		servicePath := filepath.Join("/etc/systemd/system", serviceName)
 
-		binaryPath := filepath.Join(baseDir, "bin", product.Name)
+		binaryPath := productInstallPath(baseDir, product)
 		configPath := filepath.Join(baseDir, "etc", product.Name+".yaml")
 
 		serviceContent := fmt.Sprintf(`[Unit]
@@ -450,6 +478,9 @@ func startServices(products []types.ProductInstall) error {
 
 	// Enable and start product services
 	for _, product := range products {
+		if !isBinaryProduct(product) {
+			continue
+		}
 		serviceName := product.Name + ".service"
 		exec.Command("systemctl", "enable", serviceName).Run()
 		if err := exec.Command("systemctl", "start", serviceName).Run(); err != nil {
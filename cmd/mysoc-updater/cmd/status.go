@@ -14,6 +14,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/updater/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
 )
 
 var statusConfigPath string
@@ -81,15 +82,36 @@ func runStatus(cmd *cobra.Command, args []string) error {
 	fmt.Println("╠═══════════════════════════════════════════════════════════════╣")
 
 	// Product status
+	var warnings []types.ReleaseWarning
 	fmt.Println("║  Products:                                                     ║")
 	for _, product := range cfg.Products {
 		status := getServiceStatus(product.Service)
 		version := getProductVersion(cfg, product.Name)
 		line := fmt.Sprintf("%s v%s %s", product.Name, version, status)
 		fmt.Printf("║    %-58s ║\n", line)
+		if warning := getReleaseWarning(cfg, product.Name, version); warning != nil {
+			warnings = append(warnings, *warning)
+		}
 	}
 	fmt.Println("╠═══════════════════════════════════════════════════════════════╣")
 
+	// Deprecated or end-of-life versions
+	if len(warnings) > 0 {
+		fmt.Println("║  Warnings:                                                     ║")
+		for _, warning := range warnings {
+			icon := "⚠️ "
+			if warning.Status == types.ReleaseStatusEOL {
+				icon = "❌"
+			}
+			line := fmt.Sprintf("%s %s v%s is %s", icon, warning.Product, warning.Version, warning.Status)
+			fmt.Printf("║    %-58s ║\n", line)
+			if warning.Message != "" {
+				fmt.Printf("║      %-56s ║\n", truncate(warning.Message, 56))
+			}
+		}
+		fmt.Println("╠═══════════════════════════════════════════════════════════════╣")
+	}
+
 	// Security status
 	securityScore := getSecurityScore(cfg)
 	fmt.Printf("║  Security Score: %-44s ║\n", securityScore)
@@ -138,6 +160,40 @@ func checkLicenseStatus(cfg *config.Config) string {
 	return fmt.Sprintf("✅ Valid (expires %s)", result.ExpiresAt.Format("2006-01-02"))
 }
 
+// getReleaseWarning asks the server whether an installed version is deprecated or end-of-life
+func getReleaseWarning(cfg *config.Config, productName, version string) *types.ReleaseWarning {
+	if cfg.Server.URL == "" || version == "" || version == "?.?.?" {
+		return nil
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("%s/api/v1/releases/%s/%s", cfg.Server.URL, productName, version))
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	var release types.Release
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil
+	}
+
+	if release.Status != types.ReleaseStatusDeprecated && release.Status != types.ReleaseStatusEOL {
+		return nil
+	}
+
+	return &types.ReleaseWarning{
+		Product: release.ProductName,
+		Version: release.Version,
+		Status:  release.Status,
+		Message: release.StatusMessage,
+	}
+}
+
 func getServiceStatus(serviceName string) string {
 	cmd := exec.Command("systemctl", "is-active", serviceName)
 	output, err := cmd.Output()
@@ -61,6 +61,9 @@ func runUpdate(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
+	if err := cfg.LoadRemote(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
 
 	// Create updater
 	updater := update.NewUpdater(cfg)
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Configuration commands",
+}
+
+var configCheckCmd = &cobra.Command{
+	Use:   "check [file]",
+	Short: "Validate a configuration file",
+	Long: `Validate a YAML or TOML configuration file the way the server does at
+startup, including environment variables that override it.
+
+Without a file, checks the file named by --config or CONFIG_FILE, or the
+environment alone.`,
+	Args:          cobra.MaximumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true, // main prints the error
+	RunE:          runConfigCheck,
+}
+
+func init() {
+	configCmd.AddCommand(configCheckCmd)
+}
+
+func runConfigCheck(cmd *cobra.Command, args []string) error {
+	path := configFile
+	if len(args) == 1 {
+		path = args[0]
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	source := "environment"
+	if path != "" {
+		source = path
+	}
+	scheme := "http"
+	if cfg.Server.TLSEnabled() {
+		scheme = "https"
+	}
+	fmt.Printf("Configuration OK (%s)\n", source)
+	fmt.Printf("  listen:        %s://%s:%d\n", scheme, cfg.Server.Host, cfg.Server.Port)
+	fmt.Printf("  database:      %s\n", cfg.Database.Driver)
+	fmt.Printf("  cors origins:  %d\n", len(cfg.Server.CORSOrigins))
+	fmt.Printf("  max body size: %s (uploads %s)\n", cfg.Server.MaxBodySize, cfg.Uploads.MaxSize)
+	return nil
+}
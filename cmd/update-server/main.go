@@ -4,16 +4,32 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
+	"github.com/spf13/cobra"
+
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/api"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/auth"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/certs"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/commands"
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/heartbeats"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/licensing"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/mail"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/metrics"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/ratelimit"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/retention"
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/storage"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/tracing"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/uploads"
+	"github.com/cyfox-labs/updates-mysoc-ai/migrations"
 )
 
 var (
@@ -22,16 +38,55 @@ var (
 	BuildTime = "unknown"
 )
 
+var (
+	autoMigrate bool
+	configFile  string
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "update-server",
+	Short: "MySoc Update Server",
+	Long: `MySoc Update Server - Serves releases, licenses and the admin API to
+MySoc/SIEMCore updaters and the dashboard.
+
+Run without a command to start the server.`,
+	Run: runServer,
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", os.Getenv("CONFIG_FILE"), "YAML or TOML configuration file, overridden by environment variables (also CONFIG_FILE)")
+	rootCmd.Flags().BoolVar(&autoMigrate, "auto-migrate", false, "Apply pending database migrations before starting (also DB_AUTO_MIGRATE)")
+
+	rootCmd.AddCommand(migrateCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
 func main() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func runServer(c *cobra.Command, args []string) {
 	// Load configuration
-	cfg, err := config.Load()
+	cfg, err := config.Load(configFile)
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
 
 	// Print banner
 	printBanner()
 
+	// Export traces when an OTLP collector is configured
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Telemetry, Version)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
 	// Initialize database
 	db, err := database.New(cfg.Database)
 	if err != nil {
@@ -39,31 +94,179 @@ func main() {
 	}
 	defer db.Close()
 
+	// Bring the schema up to date. Replicas starting together take turns.
+	migrator, err := database.NewMigrator(db, migrations.ForDriver(db.Driver))
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+	if autoMigrate || cfg.Database.AutoMigrate {
+		applied, err := migrator.Up(context.Background())
+		if err != nil {
+			log.Fatalf("Failed to apply migrations: %v", err)
+		}
+		for _, m := range applied {
+			log.Printf("Applied migration %03d_%s", m.Version, m.Name)
+		}
+	} else if pending, err := migrator.Pending(context.Background()); err != nil {
+		log.Printf("Failed to check migrations: %v", err)
+	} else if pending > 0 {
+		log.Printf("%d database migrations are pending; run \"update-server migrate up\" or start with --auto-migrate", pending)
+	}
+
 	// Initialize storage
 	store, err := storage.New(cfg.Storage)
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
 
+	// Initialize outgoing email
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Failed to initialize mail: %v", err)
+	}
+	if mailer == nil {
+		log.Printf("Mail is not configured; password reset and email verification are disabled until MAIL_DRIVER=smtp is set")
+	}
+
+	// Load the keys that sign access tokens, creating the first one if needed
+	keys, err := auth.NewKeyManager(auth.NewRepository(db), cfg.Auth)
+	if err != nil {
+		log.Fatalf("Invalid signing key configuration: %v", err)
+	}
+	if err := keys.Load(context.Background()); err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+
+	// Initialize rate limiting of public endpoints
+	limiter, err := ratelimit.New(cfg.RateLimit, db)
+	if err != nil {
+		log.Fatalf("Failed to initialize rate limiting: %v", err)
+	}
+
+	// Initialize Prometheus metrics
+	var serverMetrics *metrics.Metrics
+	if cfg.Telemetry.MetricsEnabled {
+		serverMetrics = metrics.New(db)
+	}
+
+	// Record heartbeats in batches. The pipeline outlives the other jobs so
+	// heartbeats accepted during shutdown are still written.
+	heartbeatPipeline := heartbeats.NewPipeline(db, cfg.Heartbeats, serverMetrics)
+	heartbeatsCtx, stopHeartbeats := context.WithCancel(context.Background())
+	heartbeatsDone := make(chan struct{})
+	go func() {
+		heartbeatPipeline.Run(heartbeatsCtx)
+		close(heartbeatsDone)
+	}()
+
+	// Load the key that signs commands sent to instances
+	commandService, err := commands.NewService(db, cfg.Commands, cfg.Heartbeats.ReleaseCacheTTL)
+	if err != nil {
+		log.Fatalf("Failed to initialize commands: %v", err)
+	}
+
 	// Create API server
-	server := api.NewServer(cfg, db, store)
+	server := api.NewServer(cfg, db, store, mailer, keys, limiter, serverMetrics, heartbeatPipeline, commandService)
+
+	// Start background jobs: scheduled artifact garbage collection, removal
+	// of abandoned upload sessions and of refilled rate limit buckets,
+	// signing key rotation, marking silent instances offline, pruning
+	// heartbeat history and expiring unanswered commands
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	if cfg.Retention.GCInterval > 0 {
+		log.Printf("Retention GC scheduled every %s (dry run: %t)", cfg.Retention.GCInterval, cfg.Retention.DryRun)
+		go retention.NewService(db, server.ReleaseService(), store).RunScheduled(jobsCtx, cfg.Retention.GCInterval, cfg.Retention.DryRun)
+	}
+	go uploads.NewService(db, store, cfg.Uploads).RunCleanup(jobsCtx, time.Hour)
+	if limiter != nil {
+		go limiter.RunCleanup(jobsCtx, time.Minute)
+	}
+	go keys.Run(jobsCtx, time.Minute)
+	go licensing.NewService(db).RunOfflineCheck(jobsCtx, time.Minute, cfg.Telemetry.InstanceOfflineAfter)
+	if cfg.Heartbeats.HistoryRetention > 0 {
+		go licensing.NewService(db).RunHistoryPrune(jobsCtx, time.Hour, cfg.Heartbeats.HistoryRetention)
+	}
+	go commandService.RunExpiry(jobsCtx, time.Minute)
 
 	// Create HTTP server
 	httpServer := &http.Server{
-		Addr:         fmt.Sprintf(":%d", cfg.Server.Port),
-		Handler:      server.Router(),
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		Addr:              net.JoinHostPort(cfg.Server.Host, strconv.Itoa(cfg.Server.Port)),
+		Handler:           server.Router(),
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+
+	// Serve HTTPS with certificates from files, reloaded when they change,
+	// or from an ACME certificate authority. An optional plain HTTP listener
+	// redirects to HTTPS and answers ACME HTTP-01 challenges.
+	var redirectServer *http.Server
+	if cfg.Server.TLSEnabled() {
+		certManager, err := certs.New(cfg.Server)
+		if err != nil {
+			log.Fatalf("Failed to set up TLS: %v", err)
+		}
+		httpServer.TLSConfig = certManager.TLSConfig()
+		go certManager.Run(jobsCtx, 10*time.Second)
+
+		if cfg.Server.HTTPRedirectPort != 0 {
+			redirectServer = &http.Server{
+				Addr:              net.JoinHostPort(cfg.Server.Host, strconv.Itoa(cfg.Server.HTTPRedirectPort)),
+				Handler:           certManager.HTTPHandler(cfg.Server.Port),
+				ReadTimeout:       cfg.Server.ReadTimeout,
+				ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+				WriteTimeout:      cfg.Server.WriteTimeout,
+				IdleTimeout:       cfg.Server.IdleTimeout,
+			}
+		}
+	}
+
+	// Serve /metrics without authentication on a separate, typically
+	// internal, address
+	var metricsServer *http.Server
+	if serverMetrics != nil && cfg.Telemetry.MetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", serverMetrics.Handler())
+		metricsServer = &http.Server{
+			Addr:              cfg.Telemetry.MetricsAddr,
+			Handler:           mux,
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		}
 	}
 
 	// Start server in goroutine
 	go func() {
-		log.Printf("Starting update server on port %d", cfg.Server.Port)
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if httpServer.TLSConfig != nil {
+			log.Printf("Starting update server on https://%s", httpServer.Addr)
+			err = httpServer.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("Starting update server on http://%s", httpServer.Addr)
+			err = httpServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server error: %v", err)
 		}
 	}()
+	if redirectServer != nil {
+		go func() {
+			log.Printf("Redirecting http://%s to HTTPS", redirectServer.Addr)
+			if err := redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Redirect server error: %v", err)
+			}
+		}()
+	}
+
+	if metricsServer != nil {
+		go func() {
+			log.Printf("Serving metrics on http://%s/metrics", metricsServer.Addr)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Metrics server error: %v", err)
+			}
+		}()
+	}
 
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
@@ -71,14 +274,26 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down server...")
+	stopJobs()
 
 	// Graceful shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
+	if redirectServer != nil {
+		redirectServer.Shutdown(ctx)
+	}
 	if err := httpServer.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
+	stopHeartbeats()
+	<-heartbeatsDone
+	if metricsServer != nil {
+		metricsServer.Shutdown(ctx)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
 
 	log.Println("Server exited gracefully")
 }
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/migrations"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Database migration commands",
+	Long: `Apply and revert the database migrations built into update-server.
+
+Applied migrations are recorded in the schema_migrations table with a checksum,
+and an advisory lock keeps two servers from migrating at the same time.`,
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply all pending migrations",
+	Args:  cobra.NoArgs,
+	RunE:  runMigrateUp,
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down [steps]",
+	Short: "Revert the most recent migrations (default 1)",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runMigrateDown,
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show which migrations have been applied",
+	Args:  cobra.NoArgs,
+	RunE:  runMigrateStatus,
+}
+
+var migrateBaselineCmd = &cobra.Command{
+	Use:   "baseline <version>",
+	Short: "Mark migrations up to version as applied without running them",
+	Long: `Mark migrations up to version as applied without running them.
+
+Use this once on a database whose migrations were applied by hand with psql,
+before migrations were tracked.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runMigrateBaseline,
+}
+
+func init() {
+	migrateCmd.AddCommand(migrateUpCmd)
+	migrateCmd.AddCommand(migrateDownCmd)
+	migrateCmd.AddCommand(migrateStatusCmd)
+	migrateCmd.AddCommand(migrateBaselineCmd)
+}
+
+// openMigrator connects to the configured database
+func openMigrator() (*database.Migrator, func(), error) {
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	db, err := database.New(cfg.Database)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	migrator, err := database.NewMigrator(db, migrations.ForDriver(db.Driver))
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return migrator, db.Close, nil
+}
+
+func runMigrateUp(cmd *cobra.Command, args []string) error {
+	migrator, closeDB, err := openMigrator()
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	applied, err := migrator.Up(context.Background())
+	for _, m := range applied {
+		fmt.Printf("Applied %03d_%s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		fmt.Println("Database is up to date")
+	}
+	return nil
+}
+
+func runMigrateDown(cmd *cobra.Command, args []string) error {
+	steps := 1
+	if len(args) == 1 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return fmt.Errorf("steps must be a positive number")
+		}
+		steps = n
+	}
+
+	migrator, closeDB, err := openMigrator()
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	reverted, err := migrator.Down(context.Background(), steps)
+	for _, m := range reverted {
+		fmt.Printf("Reverted %03d_%s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if len(reverted) == 0 {
+		fmt.Println("No migrations to revert")
+	}
+	return nil
+}
+
+func runMigrateStatus(cmd *cobra.Command, args []string) error {
+	migrator, closeDB, err := openMigrator()
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	statuses, err := migrator.Status(context.Background())
+	if err != nil {
+		return err
+	}
+
+	pending := 0
+	fmt.Printf("%-40s %-25s %s\n", "MIGRATION", "APPLIED", "NOTE")
+	for _, s := range statuses {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		} else {
+			pending++
+		}
+
+		note := ""
+		switch {
+		case s.Missing:
+			note = "not in this build"
+		case s.Modified:
+			note = "file changed since applied"
+		}
+
+		fmt.Printf("%-40s %-25s %s\n", fmt.Sprintf("%03d_%s", s.Version, s.Name), applied, note)
+	}
+	fmt.Printf("\n%d pending\n", pending)
+	return nil
+}
+
+func runMigrateBaseline(cmd *cobra.Command, args []string) error {
+	version, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid version: %s", args[0])
+	}
+
+	migrator, closeDB, err := openMigrator()
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	recorded, err := migrator.Baseline(context.Background(), version)
+	for _, m := range recorded {
+		fmt.Printf("Marked %03d_%s as applied\n", m.Version, m.Name)
+	}
+	return err
+}
@@ -0,0 +1,394 @@
+"use client";
+
+import { Fragment, useState } from "react";
+import { useQuery, useMutation } from "@tanstack/react-query";
+import {
+  ScrollText,
+  Shield,
+  ShieldCheck,
+  ShieldAlert,
+  Search,
+  Download,
+  ChevronLeft,
+  ChevronRight,
+  ChevronDown,
+  Loader2,
+} from "lucide-react";
+import { api, AdminAuditEntry, AdminAuditFilter } from "@/lib/api";
+import { RequireAuth, RequirePermission } from "@/lib/auth-context";
+
+const PER_PAGE = 50;
+
+const inputClass =
+  "w-full px-4 py-2 rounded-lg bg-slate-800 border border-slate-700 text-white focus:outline-none focus:ring-2 focus:ring-cyan-500/50 focus:border-cyan-500";
+
+const emptyFilter = {
+  actor: "",
+  action: "",
+  target_type: "",
+  q: "",
+  from: "",
+  to: "",
+};
+
+// datetime-local inputs have no zone; send them as RFC 3339 in UTC
+function toFilter(form: typeof emptyFilter): AdminAuditFilter {
+  return {
+    actor: form.actor,
+    action: form.action,
+    target_type: form.target_type,
+    q: form.q,
+    from: form.from ? new Date(form.from).toISOString() : "",
+    to: form.to ? new Date(form.to).toISOString() : "",
+  };
+}
+
+function statusBadge(status: number) {
+  if (status < 300) return "bg-green-500/20 text-green-400";
+  if (status < 500) return "bg-amber-500/20 text-amber-400";
+  return "bg-red-500/20 text-red-400";
+}
+
+function actorLabel(entry: AdminAuditEntry) {
+  if (entry.actor_type === "anonymous") return "Anonymous";
+  const who = entry.actor_email || entry.actor_id || "Unknown";
+  return entry.actor_type === "api_token" ? `${who} (API token)` : who;
+}
+
+function formatValue(value: unknown) {
+  if (value === undefined || value === null) return "—";
+  return typeof value === "string" ? value : JSON.stringify(value);
+}
+
+function AuditContent() {
+  const [form, setForm] = useState(emptyFilter);
+  const [filter, setFilter] = useState<AdminAuditFilter>({});
+  const [page, setPage] = useState(1);
+  const [expanded, setExpanded] = useState<number | null>(null);
+  const [exportError, setExportError] = useState("");
+
+  const { data, isLoading, error } = useQuery({
+    queryKey: ["admin-audit", filter, page],
+    queryFn: () => api.getAdminAudit(filter, page, PER_PAGE),
+  });
+
+  const verifyMutation = useMutation({
+    mutationFn: () => api.verifyAdminAudit(),
+  });
+
+  const exportMutation = useMutation({
+    mutationFn: (format: "csv" | "json") => api.exportAdminAudit(filter, format),
+    onSuccess: (blob, format) => {
+      const url = URL.createObjectURL(blob);
+      const link = document.createElement("a");
+      link.href = url;
+      link.download = `audit-${new Date().toISOString().slice(0, 19).replace(/[:T]/g, "-")}.${format}`;
+      link.click();
+      URL.revokeObjectURL(url);
+      setExportError("");
+    },
+    onError: (err: Error) => setExportError(err.message),
+  });
+
+  const handleSearch = (e: React.FormEvent) => {
+    e.preventDefault();
+    setFilter(toFilter(form));
+    setPage(1);
+  };
+
+  const totalPages = data ? Math.max(1, Math.ceil(data.total / data.per_page)) : 1;
+  const verification = verifyMutation.data;
+
+  return (
+    <div className="space-y-6">
+      <div className="flex items-center justify-between">
+        <div>
+          <h1 className="text-3xl font-bold text-white">Audit Log</h1>
+          <p className="text-slate-400 mt-1">Every administrative change, hash-chained against tampering</p>
+        </div>
+        <div className="flex items-center gap-2">
+          <button
+            onClick={() => verifyMutation.mutate()}
+            disabled={verifyMutation.isPending}
+            className="btn btn-secondary flex items-center gap-2"
+          >
+            {verifyMutation.isPending ? (
+              <Loader2 className="w-4 h-4 animate-spin" />
+            ) : (
+              <ShieldCheck className="w-4 h-4" />
+            )}
+            Verify Chain
+          </button>
+          <button
+            onClick={() => exportMutation.mutate("csv")}
+            disabled={exportMutation.isPending}
+            className="btn btn-secondary flex items-center gap-2"
+          >
+            <Download className="w-4 h-4" />
+            CSV
+          </button>
+          <button
+            onClick={() => exportMutation.mutate("json")}
+            disabled={exportMutation.isPending}
+            className="btn btn-secondary flex items-center gap-2"
+          >
+            <Download className="w-4 h-4" />
+            JSON
+          </button>
+        </div>
+      </div>
+
+      {verification && (
+        <div
+          className={`card p-4 flex items-start gap-3 ${
+            verification.valid ? "border-green-500/30" : "border-red-500/30"
+          }`}
+        >
+          {verification.valid ? (
+            <ShieldCheck className="w-5 h-5 text-green-400 mt-0.5" />
+          ) : (
+            <ShieldAlert className="w-5 h-5 text-red-400 mt-0.5" />
+          )}
+          <div className="text-sm">
+            {verification.valid ? (
+              <p className="text-green-400 font-medium">
+                Chain intact across {verification.entries} entries
+              </p>
+            ) : (
+              <p className="text-red-400 font-medium">
+                Chain broken at entry {verification.broken_at}: {verification.reason}
+              </p>
+            )}
+            {verification.head_hash && (
+              <p className="text-slate-400 mt-1">
+                Head hash: <span className="font-mono text-slate-300 break-all">{verification.head_hash}</span>
+              </p>
+            )}
+          </div>
+        </div>
+      )}
+      {verifyMutation.error && <p className="text-red-400 text-sm">{verifyMutation.error.message}</p>}
+      {exportError && <p className="text-red-400 text-sm">{exportError}</p>}
+
+      {/* Filters */}
+      <form onSubmit={handleSearch} className="card p-4 grid grid-cols-1 md:grid-cols-3 lg:grid-cols-6 gap-3">
+        <input
+          type="text"
+          placeholder="Search"
+          value={form.q}
+          onChange={(e) => setForm({ ...form, q: e.target.value })}
+          className={inputClass}
+        />
+        <input
+          type="text"
+          placeholder="Actor email or ID"
+          value={form.actor}
+          onChange={(e) => setForm({ ...form, actor: e.target.value })}
+          className={inputClass}
+        />
+        <input
+          type="text"
+          placeholder="Action, e.g. DELETE"
+          value={form.action}
+          onChange={(e) => setForm({ ...form, action: e.target.value })}
+          className={inputClass}
+        />
+        <input
+          type="text"
+          placeholder="Target type, e.g. licenses"
+          value={form.target_type}
+          onChange={(e) => setForm({ ...form, target_type: e.target.value })}
+          className={inputClass}
+        />
+        <input
+          type="datetime-local"
+          value={form.from}
+          onChange={(e) => setForm({ ...form, from: e.target.value })}
+          className={inputClass}
+          title="From"
+        />
+        <div className="flex gap-2">
+          <input
+            type="datetime-local"
+            value={form.to}
+            onChange={(e) => setForm({ ...form, to: e.target.value })}
+            className={inputClass}
+            title="To"
+          />
+          <button type="submit" className="btn btn-primary flex items-center">
+            <Search className="w-4 h-4" />
+          </button>
+        </div>
+      </form>
+
+      {/* Entries */}
+      <div className="card overflow-hidden">
+        {isLoading ? (
+          <div className="flex items-center justify-center h-64">
+            <Loader2 className="w-8 h-8 animate-spin text-cyan-500" />
+          </div>
+        ) : error ? (
+          <p className="p-6 text-red-400">{(error as Error).message}</p>
+        ) : !data || data.entries.length === 0 ? (
+          <div className="flex flex-col items-center justify-center h-64 text-center">
+            <ScrollText className="w-12 h-12 text-slate-600 mb-4" />
+            <p className="text-slate-400">No audit entries match these filters.</p>
+          </div>
+        ) : (
+          <table className="w-full">
+            <thead>
+              <tr className="border-b border-slate-800">
+                <th className="w-8" />
+                <th className="text-left text-xs font-semibold text-slate-400 uppercase tracking-wider px-4 py-4">
+                  Time
+                </th>
+                <th className="text-left text-xs font-semibold text-slate-400 uppercase tracking-wider px-4 py-4">
+                  Actor
+                </th>
+                <th className="text-left text-xs font-semibold text-slate-400 uppercase tracking-wider px-4 py-4">
+                  Action
+                </th>
+                <th className="text-left text-xs font-semibold text-slate-400 uppercase tracking-wider px-4 py-4">
+                  Target
+                </th>
+                <th className="text-left text-xs font-semibold text-slate-400 uppercase tracking-wider px-4 py-4">
+                  Status
+                </th>
+              </tr>
+            </thead>
+            <tbody>
+              {data.entries.map((entry) => (
+                <Fragment key={entry.id}>
+                  <tr
+                    onClick={() => setExpanded(expanded === entry.id ? null : entry.id)}
+                    className="border-b border-slate-800/50 hover:bg-slate-800/30 transition-colors cursor-pointer"
+                  >
+                    <td className="pl-4">
+                      {expanded === entry.id ? (
+                        <ChevronDown className="w-4 h-4 text-slate-500" />
+                      ) : (
+                        <ChevronRight className="w-4 h-4 text-slate-500" />
+                      )}
+                    </td>
+                    <td className="px-4 py-3 text-sm text-slate-400 whitespace-nowrap">
+                      {new Date(entry.created_at).toLocaleString()}
+                    </td>
+                    <td className="px-4 py-3 text-sm text-white">{actorLabel(entry)}</td>
+                    <td className="px-4 py-3 text-sm font-mono text-slate-300">{entry.action}</td>
+                    <td className="px-4 py-3 text-sm text-slate-300">
+                      {entry.target_type}
+                      {entry.target_id && <span className="text-slate-500"> / {entry.target_id}</span>}
+                    </td>
+                    <td className="px-4 py-3">
+                      <span
+                        className={`inline-block px-2.5 py-1 rounded-full text-xs font-medium ${statusBadge(
+                          entry.status
+                        )}`}
+                      >
+                        {entry.status}
+                      </span>
+                    </td>
+                  </tr>
+                  {expanded === entry.id && (
+                    <tr className="border-b border-slate-800/50 bg-slate-900/50">
+                      <td />
+                      <td colSpan={5} className="px-4 py-4 space-y-3 text-sm">
+                        <div className="grid grid-cols-2 gap-2 text-slate-400">
+                          <p>
+                            Path: <span className="font-mono text-slate-300">{entry.path}</span>
+                          </p>
+                          <p>
+                            IP: <span className="text-slate-300">{entry.ip_address || "—"}</span>
+                          </p>
+                          <p>
+                            Request ID: <span className="font-mono text-slate-300">{entry.request_id || "—"}</span>
+                          </p>
+                          <p className="truncate" title={entry.user_agent}>
+                            User agent: <span className="text-slate-300">{entry.user_agent || "—"}</span>
+                          </p>
+                        </div>
+                        {entry.changes && (
+                          <table className="w-full text-left">
+                            <thead>
+                              <tr className="text-xs text-slate-500 uppercase">
+                                <th className="py-1 pr-4">Field</th>
+                                <th className="py-1 pr-4">Before</th>
+                                <th className="py-1">After</th>
+                              </tr>
+                            </thead>
+                            <tbody>
+                              {Object.entries(entry.changes).map(([field, change]) => (
+                                <tr key={field} className="align-top">
+                                  <td className="py-1 pr-4 font-mono text-slate-300">{field}</td>
+                                  <td className="py-1 pr-4 font-mono text-red-300 break-all">
+                                    {formatValue(change.before)}
+                                  </td>
+                                  <td className="py-1 font-mono text-green-300 break-all">
+                                    {formatValue(change.after)}
+                                  </td>
+                                </tr>
+                              ))}
+                            </tbody>
+                          </table>
+                        )}
+                        {!entry.changes && (entry.before || entry.after) && (
+                          <pre className="bg-slate-950 rounded-lg p-3 text-xs text-slate-300 overflow-x-auto">
+                            {JSON.stringify(entry.after ?? entry.before, null, 2)}
+                          </pre>
+                        )}
+                        <p className="text-xs text-slate-500 font-mono break-all">hash {entry.hash}</p>
+                      </td>
+                    </tr>
+                  )}
+                </Fragment>
+              ))}
+            </tbody>
+          </table>
+        )}
+      </div>
+
+      {/* Pagination */}
+      {data && data.total > 0 && (
+        <div className="flex items-center justify-between text-sm text-slate-400">
+          <p>
+            {data.total} entries · page {data.page} of {totalPages}
+          </p>
+          <div className="flex gap-2">
+            <button
+              onClick={() => setPage(page - 1)}
+              disabled={page <= 1}
+              className="btn btn-secondary flex items-center gap-1"
+            >
+              <ChevronLeft className="w-4 h-4" />
+              Previous
+            </button>
+            <button
+              onClick={() => setPage(page + 1)}
+              disabled={page >= totalPages}
+              className="btn btn-secondary flex items-center gap-1"
+            >
+              Next
+              <ChevronRight className="w-4 h-4" />
+            </button>
+          </div>
+        </div>
+      )}
+    </div>
+  );
+}
+
+export default function AuditPage() {
+  return (
+    <RequireAuth>
+      <RequirePermission permission="audit:read" fallback={
+        <div className="flex flex-col items-center justify-center h-64 text-center">
+          <Shield className="w-12 h-12 text-slate-600 mb-4" />
+          <h2 className="text-xl font-bold text-white mb-2">Access Denied</h2>
+          <p className="text-slate-400">You don't have permission to view this page.</p>
+        </div>
+      }>
+        <AuditContent />
+      </RequirePermission>
+    </RequireAuth>
+  );
+}
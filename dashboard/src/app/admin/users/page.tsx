@@ -13,15 +13,18 @@ import {
   AlertCircle,
   Loader2,
   X,
+  Monitor,
 } from "lucide-react";
-import { api, User } from "@/lib/api";
-import { RequireAuth, RequireRole } from "@/lib/auth-context";
+import { api, User, Session } from "@/lib/api";
+import { RequireAuth, RequirePermission } from "@/lib/auth-context";
+import { SessionItem } from "@/components/SessionItem";
 
 function UsersContent() {
   const queryClient = useQueryClient();
   const [showCreateModal, setShowCreateModal] = useState(false);
   const [editUser, setEditUser] = useState<User | null>(null);
   const [deleteUser, setDeleteUser] = useState<User | null>(null);
+  const [sessionsUser, setSessionsUser] = useState<User | null>(null);
 
   // Form state
   const [formData, setFormData] = useState({
@@ -36,6 +39,11 @@ function UsersContent() {
     queryFn: () => api.getUsers(),
   });
 
+  const { data: roles } = useQuery({
+    queryKey: ["roles"],
+    queryFn: () => api.getRoles(),
+  });
+
   const createMutation = useMutation({
     mutationFn: (data: typeof formData) => api.createUser(data),
     onSuccess: () => {
@@ -62,6 +70,27 @@ function UsersContent() {
     },
   });
 
+  const { data: userSessions, isLoading: sessionsLoading } = useQuery({
+    queryKey: ["user-sessions", sessionsUser?.id],
+    queryFn: () => api.getUserSessions(sessionsUser!.id),
+    enabled: !!sessionsUser,
+  });
+
+  const revokeSessionMutation = useMutation({
+    mutationFn: (data: { userId: string; sessionId: string }) =>
+      api.revokeUserSession(data.userId, data.sessionId),
+    onSuccess: () => {
+      queryClient.invalidateQueries({ queryKey: ["user-sessions"] });
+    },
+  });
+
+  const revokeAllSessionsMutation = useMutation({
+    mutationFn: (userId: string) => api.revokeAllUserSessions(userId),
+    onSuccess: () => {
+      queryClient.invalidateQueries({ queryKey: ["user-sessions"] });
+    },
+  });
+
   const resetForm = () => {
     setFormData({ email: "", password: "", name: "", role: "viewer" });
   };
@@ -207,6 +236,13 @@ function UsersContent() {
                 </td>
                 <td className="px-6 py-4">
                   <div className="flex items-center justify-end gap-2">
+                    <button
+                      onClick={() => setSessionsUser(user)}
+                      className="p-2 text-slate-400 hover:text-white hover:bg-slate-800 rounded-lg transition-colors"
+                      title="Sessions"
+                    >
+                      <Monitor className="w-4 h-4" />
+                    </button>
                     <button
                       onClick={() => {
                         setEditUser(user);
@@ -298,9 +334,11 @@ function UsersContent() {
                   value={formData.role}
                   onChange={(e) => setFormData({ ...formData, role: e.target.value })}
                 >
-                  <option value="viewer">Viewer</option>
-                  <option value="operator">Operator</option>
-                  <option value="admin">Admin</option>
+                  {(roles || []).map((role) => (
+                    <option key={role.name} value={role.name}>
+                      {role.name}
+                    </option>
+                  ))}
                 </select>
               </div>
 
@@ -387,9 +425,11 @@ function UsersContent() {
                   value={formData.role}
                   onChange={(e) => setFormData({ ...formData, role: e.target.value })}
                 >
-                  <option value="viewer">Viewer</option>
-                  <option value="operator">Operator</option>
-                  <option value="admin">Admin</option>
+                  {(roles || []).map((role) => (
+                    <option key={role.name} value={role.name}>
+                      {role.name}
+                    </option>
+                  ))}
                 </select>
               </div>
 
@@ -427,6 +467,76 @@ function UsersContent() {
         </div>
       )}
 
+      {/* Sessions */}
+      {sessionsUser && (
+        <div className="fixed inset-0 bg-black/50 backdrop-blur-sm flex items-center justify-center z-50">
+          <div className="bg-slate-900 border border-slate-800 rounded-2xl p-6 w-full max-w-2xl">
+            <div className="flex items-center justify-between mb-6">
+              <div>
+                <h2 className="text-xl font-bold text-white flex items-center gap-2">
+                  <Monitor className="w-5 h-5 text-cyan-400" />
+                  Active Sessions
+                </h2>
+                <p className="text-slate-400 text-sm">
+                  {sessionsUser.name} ({sessionsUser.email})
+                </p>
+              </div>
+              <button
+                onClick={() => setSessionsUser(null)}
+                className="p-2 text-slate-400 hover:text-white rounded-lg"
+              >
+                <X className="w-5 h-5" />
+              </button>
+            </div>
+
+            <div className="space-y-3 max-h-96 overflow-y-auto mb-6">
+              {sessionsLoading ? (
+                <div className="flex justify-center py-6">
+                  <Loader2 className="w-6 h-6 text-slate-400 animate-spin" />
+                </div>
+              ) : userSessions && userSessions.length > 0 ? (
+                userSessions.map((session: Session) => (
+                  <SessionItem
+                    key={session.id}
+                    session={session}
+                    onRevoke={() =>
+                      revokeSessionMutation.mutate({ userId: sessionsUser.id, sessionId: session.id })
+                    }
+                    revoking={revokeSessionMutation.isPending}
+                  />
+                ))
+              ) : (
+                <p className="text-slate-400 text-sm">No active sessions</p>
+              )}
+            </div>
+
+            {(revokeSessionMutation.error || revokeAllSessionsMutation.error) && (
+              <div className="flex items-center gap-2 p-3 mb-4 bg-red-500/10 border border-red-500/30 rounded-lg text-red-400 text-sm">
+                <AlertCircle className="w-4 h-4" />
+                {(revokeSessionMutation.error || revokeAllSessionsMutation.error)?.message}
+              </div>
+            )}
+
+            <div className="flex gap-3">
+              <button
+                onClick={() => revokeAllSessionsMutation.mutate(sessionsUser.id)}
+                disabled={revokeAllSessionsMutation.isPending || !userSessions?.length}
+                className="btn bg-red-600 hover:bg-red-700 text-white flex-1 flex items-center justify-center gap-2"
+              >
+                {revokeAllSessionsMutation.isPending && <Loader2 className="w-4 h-4 animate-spin" />}
+                Sign Out Everywhere
+              </button>
+              <button
+                onClick={() => setSessionsUser(null)}
+                className="btn btn-secondary"
+              >
+                Close
+              </button>
+            </div>
+          </div>
+        </div>
+      )}
+
       {/* Delete Confirmation */}
       {deleteUser && (
         <div className="fixed inset-0 bg-black/50 backdrop-blur-sm flex items-center justify-center z-50">
@@ -471,7 +581,7 @@ function UsersContent() {
 export default function UsersPage() {
   return (
     <RequireAuth>
-      <RequireRole roles={["admin"]} fallback={
+      <RequirePermission permission="users:read" fallback={
         <div className="flex flex-col items-center justify-center h-64 text-center">
           <Shield className="w-12 h-12 text-slate-600 mb-4" />
           <h2 className="text-xl font-bold text-white mb-2">Access Denied</h2>
@@ -479,7 +589,7 @@ export default function UsersPage() {
         </div>
       }>
         <UsersContent />
-      </RequireRole>
+      </RequirePermission>
     </RequireAuth>
   );
 }
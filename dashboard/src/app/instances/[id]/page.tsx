@@ -0,0 +1,320 @@
+"use client";
+
+import { Fragment, useState } from "react";
+import { useParams } from "next/navigation";
+import Link from "next/link";
+import { useQuery, useMutation, useQueryClient } from "@tanstack/react-query";
+import {
+  ArrowLeft,
+  ChevronDown,
+  ChevronRight,
+  Loader2,
+  Send,
+  Server,
+  Terminal,
+  XCircle,
+} from "lucide-react";
+import { formatDistanceToNow } from "date-fns";
+import { api, CommandStatus, CommandType, InstanceCommand } from "@/lib/api";
+import { RequireAuth, RequirePermission } from "@/lib/auth-context";
+
+const inputClass =
+  "w-full px-4 py-2 rounded-lg bg-slate-800 border border-slate-700 text-white focus:outline-none focus:ring-2 focus:ring-cyan-500/50 focus:border-cyan-500";
+
+const commandTypes: { value: CommandType; label: string; product?: boolean }[] = [
+  { value: "check_update", label: "Check for updates" },
+  { value: "restart_service", label: "Restart service", product: true },
+  { value: "security_scan", label: "Security scan" },
+  { value: "collect_diagnostics", label: "Collect diagnostics" },
+  { value: "rollback", label: "Roll back", product: true },
+];
+
+const statusStyles: Record<CommandStatus, string> = {
+  pending: "bg-slate-500/20 text-slate-300",
+  delivered: "bg-cyan-500/20 text-cyan-400",
+  succeeded: "bg-green-500/20 text-green-400",
+  failed: "bg-red-500/20 text-red-400",
+  rejected: "bg-red-500/20 text-red-400",
+  expired: "bg-amber-500/20 text-amber-400",
+  cancelled: "bg-slate-500/20 text-slate-400",
+};
+
+// Commands in these states may still change, so the list is polled
+const openStatuses: CommandStatus[] = ["pending", "delivered"];
+
+function describe(command: InstanceCommand) {
+  const label = commandTypes.find((t) => t.value === command.type)?.label || command.type;
+  const args = Object.entries(command.args || {}).map(([k, v]) => `${k}=${v}`);
+  return [label, command.product, ...args].filter(Boolean).join(" · ");
+}
+
+function SendCommand({ id, products }: { id: string; products: string[] }) {
+  const queryClient = useQueryClient();
+  const [type, setType] = useState<CommandType>("check_update");
+  const [product, setProduct] = useState(products[0] || "");
+  const [arg, setArg] = useState("");
+
+  const needsProduct = commandTypes.find((t) => t.value === type)?.product;
+
+  const sendMutation = useMutation({
+    mutationFn: () => {
+      const args: Record<string, string> = {};
+      if (arg && type === "rollback") args.version = arg;
+      if (arg && type === "collect_diagnostics") args.lines = arg;
+      return api.createInstanceCommand(id, {
+        type,
+        product: needsProduct ? product : undefined,
+        args,
+      });
+    },
+    onSuccess: () => {
+      setArg("");
+      queryClient.invalidateQueries({ queryKey: ["instance-commands", id] });
+    },
+  });
+
+  return (
+    <form
+      onSubmit={(e) => {
+        e.preventDefault();
+        sendMutation.mutate();
+      }}
+      className="card p-4 space-y-3"
+    >
+      <div className="grid grid-cols-1 md:grid-cols-4 gap-3">
+        <select value={type} onChange={(e) => setType(e.target.value as CommandType)} className={inputClass}>
+          {commandTypes.map((t) => (
+            <option key={t.value} value={t.value}>
+              {t.label}
+            </option>
+          ))}
+        </select>
+        {needsProduct ? (
+          <select value={product} onChange={(e) => setProduct(e.target.value)} className={inputClass}>
+            {products.map((p) => (
+              <option key={p} value={p}>
+                {p}
+              </option>
+            ))}
+          </select>
+        ) : (
+          <div />
+        )}
+        {type === "rollback" || type === "collect_diagnostics" ? (
+          <input
+            type={type === "collect_diagnostics" ? "number" : "text"}
+            placeholder={type === "rollback" ? "Version (default: last backup)" : "Log lines (default: 200)"}
+            value={arg}
+            onChange={(e) => setArg(e.target.value)}
+            className={inputClass}
+          />
+        ) : (
+          <div />
+        )}
+        <button
+          type="submit"
+          disabled={sendMutation.isPending || (needsProduct && !product)}
+          className="btn btn-primary flex items-center justify-center gap-2"
+        >
+          {sendMutation.isPending ? <Loader2 className="w-4 h-4 animate-spin" /> : <Send className="w-4 h-4" />}
+          Send
+        </button>
+      </div>
+      {sendMutation.error && <p className="text-red-400 text-sm">{sendMutation.error.message}</p>}
+      <p className="text-xs text-slate-500">
+        Commands reach the instance with its next heartbeat. The updater runs them only if they are in its
+        commands.allow list.
+      </p>
+    </form>
+  );
+}
+
+function InstanceContent() {
+  const { id } = useParams<{ id: string }>();
+  const queryClient = useQueryClient();
+  const [expanded, setExpanded] = useState<string | null>(null);
+
+  const { data: instance, isLoading } = useQuery({
+    queryKey: ["instance", id],
+    queryFn: () => api.getInstance(id),
+  });
+
+  const { data: commands, error } = useQuery({
+    queryKey: ["instance-commands", id],
+    queryFn: () => api.getInstanceCommands(id),
+    refetchInterval: (query) =>
+      query.state.data?.some((c) => openStatuses.includes(c.status)) ? 5000 : false,
+  });
+
+  const cancelMutation = useMutation({
+    mutationFn: (commandId: string) => api.cancelInstanceCommand(id, commandId),
+    onSuccess: () => queryClient.invalidateQueries({ queryKey: ["instance-commands", id] }),
+  });
+
+  if (isLoading) {
+    return (
+      <div className="flex items-center justify-center h-64">
+        <Loader2 className="w-8 h-8 animate-spin text-cyan-500" />
+      </div>
+    );
+  }
+  if (!instance) {
+    return <p className="text-slate-400">Instance not found.</p>;
+  }
+
+  const products = instance.last_heartbeat_data?.products?.map((p) => p.name) || [];
+
+  return (
+    <div className="space-y-6">
+      <Link href="/instances" className="text-sm text-slate-400 hover:text-white flex items-center gap-1">
+        <ArrowLeft className="w-4 h-4" />
+        Instances
+      </Link>
+
+      <div className="flex items-center gap-3">
+        <div className="p-2 rounded-lg bg-slate-800">
+          <Server className="w-6 h-6 text-cyan-400" />
+        </div>
+        <div>
+          <h1 className="text-3xl font-bold text-white">{instance.instance_id}</h1>
+          <p className="text-slate-400">
+            {instance.hostname} · <span className="capitalize">{instance.instance_type}</span> · {instance.status}
+            {instance.last_heartbeat &&
+              ` · last heartbeat ${formatDistanceToNow(new Date(instance.last_heartbeat), { addSuffix: true })}`}
+          </p>
+        </div>
+      </div>
+
+      <h2 className="text-xl font-semibold text-white flex items-center gap-2">
+        <Terminal className="w-5 h-5 text-cyan-400" />
+        Commands
+      </h2>
+
+      <RequirePermission permission="instances:command">
+        <SendCommand id={id} products={products} />
+      </RequirePermission>
+
+      <div className="card overflow-hidden">
+        {error ? (
+          <p className="p-6 text-red-400">{(error as Error).message}</p>
+        ) : !commands || commands.length === 0 ? (
+          <div className="flex flex-col items-center justify-center h-40 text-center">
+            <Terminal className="w-10 h-10 text-slate-600 mb-3" />
+            <p className="text-slate-400">No commands have been sent to this instance.</p>
+          </div>
+        ) : (
+          <table className="w-full">
+            <thead>
+              <tr className="border-b border-slate-800">
+                <th className="w-8" />
+                <th className="text-left text-xs font-semibold text-slate-400 uppercase tracking-wider px-4 py-4">
+                  Sent
+                </th>
+                <th className="text-left text-xs font-semibold text-slate-400 uppercase tracking-wider px-4 py-4">
+                  Command
+                </th>
+                <th className="text-left text-xs font-semibold text-slate-400 uppercase tracking-wider px-4 py-4">
+                  By
+                </th>
+                <th className="text-left text-xs font-semibold text-slate-400 uppercase tracking-wider px-4 py-4">
+                  Status
+                </th>
+                <th className="w-12" />
+              </tr>
+            </thead>
+            <tbody>
+              {commands.map((command) => (
+                <Fragment key={command.id}>
+                  <tr
+                    onClick={() => setExpanded(expanded === command.id ? null : command.id)}
+                    className="border-b border-slate-800/50 hover:bg-slate-800/30 transition-colors cursor-pointer"
+                  >
+                    <td className="pl-4">
+                      {expanded === command.id ? (
+                        <ChevronDown className="w-4 h-4 text-slate-500" />
+                      ) : (
+                        <ChevronRight className="w-4 h-4 text-slate-500" />
+                      )}
+                    </td>
+                    <td className="px-4 py-3 text-sm text-slate-400 whitespace-nowrap">
+                      {new Date(command.created_at).toLocaleString()}
+                    </td>
+                    <td className="px-4 py-3 text-sm text-white">{describe(command)}</td>
+                    <td className="px-4 py-3 text-sm text-slate-300">{command.created_by || "—"}</td>
+                    <td className="px-4 py-3">
+                      <span
+                        className={`inline-block px-2.5 py-1 rounded-full text-xs font-medium ${
+                          statusStyles[command.status]
+                        }`}
+                      >
+                        {command.status}
+                      </span>
+                    </td>
+                    <td className="px-4 py-3">
+                      {command.status === "pending" && (
+                        <RequirePermission permission="instances:command">
+                          <button
+                            onClick={(e) => {
+                              e.stopPropagation();
+                              cancelMutation.mutate(command.id);
+                            }}
+                            disabled={cancelMutation.isPending}
+                            className="text-slate-500 hover:text-red-400"
+                            title="Cancel"
+                          >
+                            <XCircle className="w-4 h-4" />
+                          </button>
+                        </RequirePermission>
+                      )}
+                    </td>
+                  </tr>
+                  {expanded === command.id && (
+                    <tr className="border-b border-slate-800/50 bg-slate-900/50">
+                      <td />
+                      <td colSpan={5} className="px-4 py-4 space-y-3 text-sm">
+                        <div className="grid grid-cols-3 gap-2 text-slate-400">
+                          <p>
+                            Delivered:{" "}
+                            <span className="text-slate-300">
+                              {command.delivered_at ? new Date(command.delivered_at).toLocaleString() : "—"}
+                            </span>
+                          </p>
+                          <p>
+                            Completed:{" "}
+                            <span className="text-slate-300">
+                              {command.completed_at ? new Date(command.completed_at).toLocaleString() : "—"}
+                            </span>
+                          </p>
+                          <p>
+                            Expires:{" "}
+                            <span className="text-slate-300">{new Date(command.expires_at).toLocaleString()}</span>
+                          </p>
+                        </div>
+                        {command.error && <p className="text-red-400">{command.error}</p>}
+                        {command.output && (
+                          <pre className="bg-slate-950 rounded-lg p-3 text-xs text-slate-300 overflow-x-auto max-h-96">
+                            {command.output}
+                          </pre>
+                        )}
+                        <p className="text-xs text-slate-500 font-mono">id {command.id}</p>
+                      </td>
+                    </tr>
+                  )}
+                </Fragment>
+              ))}
+            </tbody>
+          </table>
+        )}
+      </div>
+      {cancelMutation.error && <p className="text-red-400 text-sm">{cancelMutation.error.message}</p>}
+    </div>
+  );
+}
+
+export default function InstancePage() {
+  return (
+    <RequireAuth>
+      <InstanceContent />
+    </RequireAuth>
+  );
+}
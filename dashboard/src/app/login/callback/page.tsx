@@ -0,0 +1,54 @@
+"use client";
+
+import { useEffect } from "react";
+import { useRouter } from "next/navigation";
+import { api } from "@/lib/api";
+import { useAuth } from "@/lib/auth-context";
+
+// The server sends the browser here after single sign-on with a one-time code,
+// which is exchanged for tokens so they never appear in a URL
+export default function LoginCallbackPage() {
+  const router = useRouter();
+  const { refreshUser } = useAuth();
+
+  useEffect(() => {
+    const params = new URLSearchParams(window.location.search);
+    const code = params.get("code");
+    const redirectTo = params.get("redirect_to") || "/";
+
+    // Drop the code from the address bar and history
+    window.history.replaceState(null, "", window.location.pathname);
+
+    if (!code) {
+      router.replace("/login?error=" + encodeURIComponent("Single sign-on failed"));
+      return;
+    }
+
+    api
+      .redeemOIDCLogin(code)
+      .then(async (response) => {
+        // Roles that must use a security key still have to complete that step
+        if (response.requires_mfa && response.mfa_token) {
+          sessionStorage.setItem(
+            "sso_mfa",
+            JSON.stringify({ mfa_token: response.mfa_token, mfa_methods: response.mfa_methods ?? [] })
+          );
+          router.replace("/login");
+          return;
+        }
+
+        await refreshUser();
+        router.replace(redirectTo.startsWith("/") && !redirectTo.startsWith("//") ? redirectTo : "/");
+      })
+      .catch((error) => {
+        const message = error instanceof Error ? error.message : "Single sign-on failed";
+        router.replace("/login?error=" + encodeURIComponent(message));
+      });
+  }, [router, refreshUser]);
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-slate-950">
+      <div className="animate-spin rounded-full h-12 w-12 border-t-2 border-b-2 border-cyan-500"></div>
+    </div>
+  );
+}
@@ -2,20 +2,47 @@
 
 import { useState, useEffect } from "react";
 import { useRouter } from "next/navigation";
-import { Shield, Lock, Mail, KeyRound, AlertCircle, Loader2 } from "lucide-react";
+import Link from "next/link";
+import { Shield, Lock, Mail, KeyRound, AlertCircle, Loader2, Fingerprint } from "lucide-react";
 import { useAuth } from "@/lib/auth-context";
+import { api } from "@/lib/api";
 
 export default function LoginPage() {
   const router = useRouter();
-  const { login, verifyMFA, isAuthenticated, isLoading: authLoading } = useAuth();
+  const { login, verifyMFA, verifyWebAuthn, isAuthenticated, isLoading: authLoading } = useAuth();
 
   const [step, setStep] = useState<"login" | "mfa">("login");
   const [email, setEmail] = useState("");
   const [password, setPassword] = useState("");
   const [totpCode, setTotpCode] = useState("");
   const [mfaToken, setMfaToken] = useState("");
+  const [mfaMethods, setMfaMethods] = useState<string[]>(["totp"]);
   const [error, setError] = useState("");
   const [isLoading, setIsLoading] = useState(false);
+  const [ssoEnabled, setSsoEnabled] = useState(false);
+
+  useEffect(() => {
+    api
+      .getOIDCStatus()
+      .then((status) => setSsoEnabled(status.enabled))
+      .catch(() => setSsoEnabled(false));
+
+    // Errors from a failed single sign-on are passed back in the query string
+    const ssoError = new URLSearchParams(window.location.search).get("error");
+    if (ssoError) {
+      setError(ssoError);
+    }
+
+    // A single sign-on that needs a security key leaves its MFA token in session storage
+    const ssoMfa = sessionStorage.getItem("sso_mfa");
+    if (ssoMfa) {
+      sessionStorage.removeItem("sso_mfa");
+      const { mfa_token, mfa_methods } = JSON.parse(ssoMfa) as { mfa_token: string; mfa_methods: string[] };
+      setMfaToken(mfa_token);
+      setMfaMethods(mfa_methods.length ? mfa_methods : ["webauthn"]);
+      setStep("mfa");
+    }
+  }, []);
 
   useEffect(() => {
     if (!authLoading && isAuthenticated) {
@@ -32,6 +59,7 @@ export default function LoginPage() {
       const response = await login(email, password);
       if (response.requires_mfa && response.mfa_token) {
         setMfaToken(response.mfa_token);
+        setMfaMethods(response.mfa_methods?.length ? response.mfa_methods : ["totp"]);
         setStep("mfa");
       } else {
         router.push("/");
@@ -58,6 +86,20 @@ export default function LoginPage() {
     }
   };
 
+  const handleWebAuthnVerify = async () => {
+    setError("");
+    setIsLoading(true);
+
+    try {
+      await verifyWebAuthn(mfaToken);
+      router.push("/");
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Security key verification failed");
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
   if (authLoading) {
     return (
       <div className="min-h-screen flex items-center justify-center bg-slate-950">
@@ -112,9 +154,17 @@ export default function LoginPage() {
                 </div>
 
                 <div>
-                  <label className="block text-sm font-medium text-slate-400 mb-2">
-                    Password
-                  </label>
+                  <div className="flex items-center justify-between mb-2">
+                    <label className="block text-sm font-medium text-slate-400">
+                      Password
+                    </label>
+                    <Link
+                      href="/forgot-password"
+                      className="text-sm text-cyan-400 hover:text-cyan-300 transition-colors"
+                    >
+                      Forgot password?
+                    </Link>
+                  </div>
                   <div className="relative">
                     <Lock className="absolute left-3 top-1/2 -translate-y-1/2 w-5 h-5 text-slate-500" />
                     <input
@@ -150,6 +200,24 @@ export default function LoginPage() {
                   )}
                 </button>
               </form>
+
+              {ssoEnabled && (
+                <>
+                  <div className="flex items-center gap-3 my-6">
+                    <div className="flex-1 h-px bg-slate-800"></div>
+                    <span className="text-slate-500 text-sm">or</span>
+                    <div className="flex-1 h-px bg-slate-800"></div>
+                  </div>
+
+                  <a
+                    href={api.oidcLoginURL("/")}
+                    className="w-full py-3 bg-slate-800/50 border border-slate-700 text-white font-medium rounded-xl hover:bg-slate-800 focus:outline-none focus:ring-2 focus:ring-cyan-500/50 transition-all flex items-center justify-center gap-2"
+                  >
+                    <Shield className="w-5 h-5" />
+                    Sign in with SSO
+                  </a>
+                </>
+              )}
             </>
           ) : (
             <>
@@ -161,11 +229,26 @@ export default function LoginPage() {
                   Two-Factor Authentication
                 </h2>
                 <p className="text-slate-400 text-sm mt-2">
-                  Enter the 6-digit code from your authenticator app
+                  {mfaMethods.includes("totp")
+                    ? "Enter the 6-digit code from your authenticator app"
+                    : "Use your security key to continue"}
                 </p>
               </div>
 
               <form onSubmit={handleMFAVerify} className="space-y-5">
+                {mfaMethods.includes("webauthn") && (
+                  <button
+                    type="button"
+                    onClick={handleWebAuthnVerify}
+                    disabled={isLoading}
+                    className="w-full py-3 bg-slate-800/50 border border-slate-700 text-white font-medium rounded-xl hover:bg-slate-800 focus:outline-none focus:ring-2 focus:ring-cyan-500/50 disabled:opacity-50 disabled:cursor-not-allowed transition-all flex items-center justify-center gap-2"
+                  >
+                    <Fingerprint className="w-5 h-5" />
+                    Use security key
+                  </button>
+                )}
+
+                {mfaMethods.includes("totp") && (
                 <div>
                   <label className="block text-sm font-medium text-slate-400 mb-2">
                     Verification Code
@@ -178,9 +261,10 @@ export default function LoginPage() {
                     placeholder="000000"
                     maxLength={6}
                     required
-                    autoFocus
+                    autoFocus={!mfaMethods.includes("webauthn")}
                   />
                 </div>
+                )}
 
                 {error && (
                   <div className="flex items-center gap-2 p-3 bg-red-500/10 border border-red-500/30 rounded-lg text-red-400 text-sm">
@@ -189,6 +273,7 @@ export default function LoginPage() {
                   </div>
                 )}
 
+                {mfaMethods.includes("totp") && (
                 <button
                   type="submit"
                   disabled={isLoading || totpCode.length !== 6}
@@ -203,6 +288,7 @@ export default function LoginPage() {
                     "Verify"
                   )}
                 </button>
+                )}
 
                 <button
                   type="button"
@@ -16,9 +16,14 @@ import {
   Eye,
   EyeOff,
   QrCode,
+  Fingerprint,
+  Trash2,
+  Link2,
 } from "lucide-react";
-import { api, Session, AuditEvent, MFASetupResponse } from "@/lib/api";
+import { api, Session, AuditEvent, MFASetupResponse, WebAuthnCredential } from "@/lib/api";
+import { createCredential, isWebAuthnSupported } from "@/lib/webauthn";
 import { useAuth, RequireAuth } from "@/lib/auth-context";
+import { SessionItem } from "@/components/SessionItem";
 
 function ProfileContent() {
   const { user, refreshUser } = useAuth();
@@ -36,6 +41,7 @@ function ProfileContent() {
   const [disableMfaPassword, setDisableMfaPassword] = useState("");
   const [disableMfaCode, setDisableMfaCode] = useState("");
   const [showDisableMfa, setShowDisableMfa] = useState(false);
+  const [keyName, setKeyName] = useState("");
   const [message, setMessage] = useState<{ type: "success" | "error"; text: string } | null>(null);
 
   // Queries
@@ -44,6 +50,11 @@ function ProfileContent() {
     queryFn: () => api.getSessions(),
   });
 
+  const { data: securityKeys } = useQuery({
+    queryKey: ["webauthn-credentials"],
+    queryFn: () => api.getWebAuthnCredentials(),
+  });
+
   const { data: auditLog } = useQuery({
     queryKey: ["audit"],
     queryFn: () => api.getAuditLog(),
@@ -114,6 +125,70 @@ function ProfileContent() {
     },
   });
 
+  const sendVerificationMutation = useMutation({
+    mutationFn: () => api.sendEmailVerification(),
+    onSuccess: () => {
+      setMessage({ type: "success", text: `Verification email sent to ${user?.email}` });
+    },
+    onError: (error) => {
+      setMessage({ type: "error", text: error instanceof Error ? error.message : "Failed to send verification email" });
+    },
+  });
+
+  const registerKeyMutation = useMutation({
+    mutationFn: async (name: string) => {
+      const options = await api.beginWebAuthnRegistration();
+      const credential = await createCredential(options.public_key);
+      return api.finishWebAuthnRegistration(options.challenge_id, name, credential);
+    },
+    onSuccess: () => {
+      setKeyName("");
+      queryClient.invalidateQueries({ queryKey: ["webauthn-credentials"] });
+      setMessage({ type: "success", text: "Security key registered" });
+    },
+    onError: (error) => {
+      setMessage({ type: "error", text: error instanceof Error ? error.message : "Failed to register security key" });
+    },
+  });
+
+  const deleteKeyMutation = useMutation({
+    mutationFn: (id: string) => api.deleteWebAuthnCredential(id),
+    onSuccess: () => {
+      queryClient.invalidateQueries({ queryKey: ["webauthn-credentials"] });
+      setMessage({ type: "success", text: "Security key removed" });
+    },
+    onError: (error) => {
+      setMessage({ type: "error", text: error instanceof Error ? error.message : "Failed to remove security key" });
+    },
+  });
+
+  const { data: oidcStatus } = useQuery({
+    queryKey: ["oidc-status"],
+    queryFn: () => api.getOIDCStatus(),
+  });
+
+  // Linking goes through a login at the provider, which returns here
+  const linkSSOMutation = useMutation({
+    mutationFn: () => api.startOIDCLink(),
+    onSuccess: ({ token }) => {
+      window.location.href = api.oidcLoginURL("/profile", token);
+    },
+    onError: (error) => {
+      setMessage({ type: "error", text: error instanceof Error ? error.message : "Failed to link single sign-on" });
+    },
+  });
+
+  const revokeSessionMutation = useMutation({
+    mutationFn: (id: string) => api.revokeSession(id),
+    onSuccess: () => {
+      queryClient.invalidateQueries({ queryKey: ["sessions"] });
+      setMessage({ type: "success", text: "Session signed out" });
+    },
+    onError: (error) => {
+      setMessage({ type: "error", text: error instanceof Error ? error.message : "Failed to sign out session" });
+    },
+  });
+
   const handleUpdateProfile = (e: React.FormEvent) => {
     e.preventDefault();
     updateProfileMutation.mutate({ name });
@@ -159,6 +234,7 @@ function ProfileContent() {
         return <Clock className="w-4 h-4 text-slate-400" />;
       case "failed_login":
       case "failed_mfa":
+      case "refresh_token_reuse":
         return <AlertCircle className="w-4 h-4 text-red-400" />;
       case "mfa_enable":
       case "mfa_disable":
@@ -219,6 +295,20 @@ function ProfileContent() {
                 className="w-full px-4 py-2 rounded-lg bg-slate-800 border border-slate-700 text-slate-400"
                 value={user?.email || ""}
               />
+              {user && !user.email_verified && !user.is_service_account && (
+                <div className="flex items-center gap-2 mt-2 text-sm">
+                  <AlertCircle className="w-4 h-4 text-amber-400" />
+                  <span className="text-amber-400">Not verified</span>
+                  <button
+                    type="button"
+                    onClick={() => sendVerificationMutation.mutate()}
+                    disabled={sendVerificationMutation.isPending}
+                    className="ml-auto text-cyan-400 hover:text-cyan-300 disabled:opacity-50 transition-colors"
+                  >
+                    Send verification email
+                  </button>
+                </div>
+              )}
             </div>
 
             <div>
@@ -519,6 +609,110 @@ function ProfileContent() {
           )}
         </div>
 
+        {/* Security Keys */}
+        <div className="card lg:col-span-2">
+          <div className="flex items-center gap-3 mb-6">
+            <div className="p-2 rounded-lg bg-cyan-500/20">
+              <Fingerprint className="w-5 h-5 text-cyan-400" />
+            </div>
+            <h2 className="text-lg font-semibold text-white">Security Keys</h2>
+            {securityKeys && securityKeys.length > 0 && (
+              <span className="ml-auto px-2 py-1 rounded-full bg-green-500/20 text-green-400 text-xs font-medium">
+                {securityKeys.length} registered
+              </span>
+            )}
+          </div>
+
+          <div className="space-y-4">
+            <p className="text-slate-400 text-sm">
+              Security keys and passkeys can be used instead of an authenticator app code
+              when you sign in. Register more than one so you are not locked out if a key is lost.
+            </p>
+
+            {securityKeys && securityKeys.length > 0 && (
+              <div className="space-y-3">
+                {securityKeys.map((key: WebAuthnCredential) => (
+                  <div key={key.id} className="p-3 bg-slate-800/50 rounded-lg flex items-center gap-3">
+                    <Key className="w-5 h-5 text-slate-400" />
+                    <div className="flex-1 min-w-0">
+                      <p className="text-white text-sm truncate">{key.name}</p>
+                      <p className="text-slate-500 text-xs">
+                        Added {formatDate(key.created_at)}
+                        {key.last_used_at && <> • Last used {formatDate(key.last_used_at)}</>}
+                      </p>
+                    </div>
+                    <button
+                      onClick={() => deleteKeyMutation.mutate(key.id)}
+                      disabled={deleteKeyMutation.isPending}
+                      className="p-2 text-slate-400 hover:text-red-400 transition-colors"
+                      title="Remove security key"
+                    >
+                      <Trash2 className="w-4 h-4" />
+                    </button>
+                  </div>
+                ))}
+              </div>
+            )}
+
+            {isWebAuthnSupported() ? (
+              <form
+                onSubmit={(e) => {
+                  e.preventDefault();
+                  registerKeyMutation.mutate(keyName);
+                }}
+                className="flex gap-3"
+              >
+                <input
+                  type="text"
+                  value={keyName}
+                  onChange={(e) => setKeyName(e.target.value)}
+                  className="flex-1 px-4 py-2 rounded-lg bg-slate-800 border border-slate-700 text-white focus:outline-none focus:ring-2 focus:ring-cyan-500/50 focus:border-cyan-500"
+                  placeholder="Key name, e.g. YubiKey 5C"
+                  maxLength={100}
+                  required
+                />
+                <button
+                  type="submit"
+                  disabled={registerKeyMutation.isPending || !keyName.trim()}
+                  className="btn btn-primary flex items-center gap-2"
+                >
+                  {registerKeyMutation.isPending && <Loader2 className="w-4 h-4 animate-spin" />}
+                  Add Security Key
+                </button>
+              </form>
+            ) : (
+              <p className="text-slate-500 text-sm">This browser does not support security keys.</p>
+            )}
+          </div>
+        </div>
+
+        {/* Single Sign-On */}
+        {oidcStatus?.enabled && (
+          <div className="card lg:col-span-2">
+            <div className="flex items-center gap-3 mb-6">
+              <div className="p-2 rounded-lg bg-indigo-500/20">
+                <Link2 className="w-5 h-5 text-indigo-400" />
+              </div>
+              <h2 className="text-lg font-semibold text-white">Single Sign-On</h2>
+            </div>
+
+            <div className="flex items-center gap-4">
+              <p className="flex-1 text-slate-400 text-sm">
+                Link this account to your identity provider to sign in with single sign-on.
+                You will be asked to sign in at the provider.
+              </p>
+              <button
+                onClick={() => linkSSOMutation.mutate()}
+                disabled={linkSSOMutation.isPending}
+                className="btn btn-secondary flex items-center gap-2"
+              >
+                {linkSSOMutation.isPending && <Loader2 className="w-4 h-4 animate-spin" />}
+                Link Single Sign-On
+              </button>
+            </div>
+          </div>
+        )}
+
         {/* Active Sessions */}
         <div className="card">
           <div className="flex items-center gap-3 mb-6">
@@ -531,20 +725,12 @@ function ProfileContent() {
           <div className="space-y-3">
             {sessions && sessions.length > 0 ? (
               sessions.map((session: Session) => (
-                <div
+                <SessionItem
                   key={session.id}
-                  className="p-3 bg-slate-800/50 rounded-lg flex items-center gap-3"
-                >
-                  <Monitor className="w-5 h-5 text-slate-400" />
-                  <div className="flex-1 min-w-0">
-                    <p className="text-white text-sm truncate">
-                      {session.user_agent || "Unknown device"}
-                    </p>
-                    <p className="text-slate-500 text-xs">
-                      {session.ip_address || "Unknown IP"} • {formatDate(session.created_at)}
-                    </p>
-                  </div>
-                </div>
+                  session={session}
+                  onRevoke={() => revokeSessionMutation.mutate(session.id)}
+                  revoking={revokeSessionMutation.isPending}
+                />
               ))
             ) : (
               <p className="text-slate-400 text-sm">No active sessions</p>
@@ -0,0 +1,89 @@
+"use client";
+
+import { useEffect, useRef, useState } from "react";
+import Link from "next/link";
+import { Shield, AlertCircle, CheckCircle } from "lucide-react";
+import { api } from "@/lib/api";
+import { useAuth } from "@/lib/auth-context";
+
+export default function VerifyEmailPage() {
+  const { isAuthenticated, refreshUser } = useAuth();
+  const [status, setStatus] = useState<"verifying" | "verified" | "failed">("verifying");
+  const [error, setError] = useState("");
+  const started = useRef(false);
+
+  useEffect(() => {
+    // Tokens work once, so guard against the effect running twice
+    if (started.current) {
+      return;
+    }
+    started.current = true;
+
+    const token = new URLSearchParams(window.location.search).get("token");
+    if (!token) {
+      setError("This verification link is incomplete. Open the link from the email again.");
+      setStatus("failed");
+      return;
+    }
+
+    api
+      .verifyEmail(token)
+      .then(() => {
+        setStatus("verified");
+        if (isAuthenticated) {
+          refreshUser();
+        }
+      })
+      .catch((err) => {
+        setError(err instanceof Error ? err.message : "Email verification failed");
+        setStatus("failed");
+      });
+  }, [isAuthenticated, refreshUser]);
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-slate-950 via-slate-900 to-slate-950 p-4">
+      <div className="relative w-full max-w-md">
+        {/* Logo */}
+        <div className="text-center mb-8">
+          <div className="inline-flex items-center justify-center w-16 h-16 rounded-2xl bg-gradient-to-br from-cyan-500 to-violet-600 mb-4 shadow-lg shadow-cyan-500/25">
+            <Shield className="w-8 h-8 text-white" />
+          </div>
+          <h1 className="text-2xl font-bold text-white">MySoc Updates</h1>
+          <p className="text-slate-400 mt-1">Fleet Management Dashboard</p>
+        </div>
+
+        {/* Card */}
+        <div className="bg-slate-900/80 backdrop-blur-xl border border-slate-800 rounded-2xl p-8 shadow-2xl">
+          <h2 className="text-xl font-semibold text-white mb-6 text-center">Email verification</h2>
+
+          {status === "verifying" && (
+            <div className="flex justify-center py-4">
+              <div className="animate-spin rounded-full h-10 w-10 border-t-2 border-b-2 border-cyan-500"></div>
+            </div>
+          )}
+
+          {status === "verified" && (
+            <div className="flex items-start gap-2 p-3 bg-green-500/10 border border-green-500/30 rounded-lg text-green-400 text-sm">
+              <CheckCircle className="w-4 h-4 flex-shrink-0 mt-0.5" />
+              Your email address has been verified.
+            </div>
+          )}
+
+          {status === "failed" && (
+            <div className="flex items-start gap-2 p-3 bg-red-500/10 border border-red-500/30 rounded-lg text-red-400 text-sm">
+              <AlertCircle className="w-4 h-4 flex-shrink-0 mt-0.5" />
+              {error}
+            </div>
+          )}
+
+          <Link
+            href={isAuthenticated ? "/profile" : "/login"}
+            className="block w-full py-2 mt-4 text-center text-slate-400 hover:text-white text-sm transition-colors"
+          >
+            {isAuthenticated ? "Go to your profile →" : "← Back to login"}
+          </Link>
+        </div>
+      </div>
+    </div>
+  );
+}
@@ -6,7 +6,11 @@ import { Sidebar } from "./Sidebar";
 import { useAuth } from "@/lib/auth-context";
 
 // Pages that don't require authentication
-const publicPaths = ["/login"];
+const publicPaths = ["/login", "/login/callback", "/forgot-password", "/reset-password"];
+
+// Pages opened from email links, shown without the sidebar whether or not the
+// user is signed in
+const emailLinkPaths = ["/verify-email"];
 
 export function LayoutWrapper({ children }: { children: React.ReactNode }) {
   const pathname = usePathname();
@@ -14,13 +18,14 @@ export function LayoutWrapper({ children }: { children: React.ReactNode }) {
   const { isAuthenticated, isLoading } = useAuth();
 
   const isPublicPage = publicPaths.includes(pathname);
+  const isEmailLinkPage = emailLinkPaths.includes(pathname);
 
   // Redirect to login if not authenticated and trying to access protected page
   useEffect(() => {
-    if (!isLoading && !isAuthenticated && !isPublicPage) {
+    if (!isLoading && !isAuthenticated && !isPublicPage && !isEmailLinkPage) {
       router.replace("/login");
     }
-  }, [isLoading, isAuthenticated, isPublicPage, router]);
+  }, [isLoading, isAuthenticated, isPublicPage, isEmailLinkPage, router]);
 
   // Redirect to dashboard if authenticated and trying to access login
   useEffect(() => {
@@ -38,6 +43,10 @@ export function LayoutWrapper({ children }: { children: React.ReactNode }) {
     );
   }
 
+  if (isEmailLinkPage) {
+    return <>{children}</>;
+  }
+
   // If not authenticated and not on public page, show loading (redirect is happening)
   if (!isAuthenticated && !isPublicPage) {
     return (
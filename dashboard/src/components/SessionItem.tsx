@@ -0,0 +1,60 @@
+"use client";
+
+import { Monitor, Smartphone, Tablet, Terminal, Trash2 } from "lucide-react";
+import { Session } from "@/lib/api";
+
+const deviceIcons = {
+  desktop: Monitor,
+  mobile: Smartphone,
+  tablet: Tablet,
+  cli: Terminal,
+  unknown: Monitor,
+};
+
+function sessionLabel(session: Session) {
+  if (session.browser && session.os) return `${session.browser} on ${session.os}`;
+  return session.browser || session.os || session.user_agent || "Unknown device";
+}
+
+export function SessionItem({
+  session,
+  onRevoke,
+  revoking,
+}: {
+  session: Session;
+  onRevoke?: () => void;
+  revoking?: boolean;
+}) {
+  const Icon = deviceIcons[session.device_type || "unknown"] || Monitor;
+
+  return (
+    <div className="p-3 bg-slate-800/50 rounded-lg flex items-center gap-3">
+      <Icon className="w-5 h-5 text-slate-400" />
+      <div className="flex-1 min-w-0">
+        <p className="text-white text-sm truncate" title={session.user_agent}>
+          {sessionLabel(session)}
+          {session.current && (
+            <span className="ml-2 px-2 py-0.5 rounded text-xs bg-emerald-500/20 text-emerald-400">
+              This device
+            </span>
+          )}
+        </p>
+        <p className="text-slate-500 text-xs">
+          {session.ip_address || "Unknown IP"} • Last used{" "}
+          {new Date(session.last_used_at).toLocaleString()} • Signed in{" "}
+          {new Date(session.created_at).toLocaleString()}
+        </p>
+      </div>
+      {onRevoke && !session.current && (
+        <button
+          onClick={onRevoke}
+          disabled={revoking}
+          className="p-2 text-slate-400 hover:text-red-400 transition-colors"
+          title="Sign out this session"
+        >
+          <Trash2 className="w-4 h-4" />
+        </button>
+      )}
+    </div>
+  );
+}
@@ -16,8 +16,9 @@ import {
   Users,
   LogOut,
   ChevronDown,
+  ScrollText,
 } from "lucide-react";
-import { useAuth, RequireRole } from "@/lib/auth-context";
+import { useAuth } from "@/lib/auth-context";
 
 const navigation = [
   { name: "Dashboard", href: "/", icon: LayoutDashboard },
@@ -28,7 +29,8 @@ const navigation = [
 ];
 
 const adminNavigation = [
-  { name: "Users", href: "/admin/users", icon: Users },
+  { name: "Users", href: "/admin/users", icon: Users, permission: "users:read" },
+  { name: "Audit Log", href: "/admin/audit", icon: ScrollText, permission: "audit:read" },
 ];
 
 export function Sidebar() {
@@ -37,6 +39,10 @@ export function Sidebar() {
   const { user, logout, isAuthenticated } = useAuth();
   const [showUserMenu, setShowUserMenu] = useState(false);
 
+  const visibleAdminNavigation = adminNavigation.filter((item) =>
+    (user?.permissions || []).includes(item.permission)
+  );
+
   const handleLogout = async () => {
     await logout();
     router.push("/login");
@@ -83,12 +89,12 @@ export function Sidebar() {
         })}
 
         {/* Admin Section */}
-        <RequireRole roles={["admin"]}>
+        {visibleAdminNavigation.length > 0 && (
           <div className="pt-4 mt-4 border-t border-slate-800">
             <p className="px-4 text-xs font-semibold text-slate-500 uppercase tracking-wider mb-2">
               Admin
             </p>
-            {adminNavigation.map((item) => {
+            {visibleAdminNavigation.map((item) => {
               const isActive = pathname === item.href;
               return (
                 <Link
@@ -107,7 +113,7 @@ export function Sidebar() {
               );
             })}
           </div>
-        </RequireRole>
+        )}
       </nav>
 
       {/* Footer with User Menu */}
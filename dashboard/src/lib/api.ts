@@ -7,6 +7,7 @@ export interface Instance {
   instance_type: string;
   hostname: string;
   license_id?: string;
+  organization_id?: string;
   status: string;
   last_heartbeat?: string;
   last_heartbeat_data?: HeartbeatData;
@@ -49,9 +50,48 @@ export interface SecurityStatus {
   reboot_required: boolean;
 }
 
+export type CommandType =
+  | "check_update"
+  | "restart_service"
+  | "security_scan"
+  | "rollback"
+  | "collect_diagnostics";
+
+export type CommandStatus =
+  | "pending"
+  | "delivered"
+  | "succeeded"
+  | "failed"
+  | "rejected"
+  | "expired"
+  | "cancelled";
+
+export interface InstanceCommand {
+  id: string;
+  instance_id: string;
+  type: CommandType;
+  product?: string;
+  args?: Record<string, string>;
+  expires_at: string;
+  status: CommandStatus;
+  output?: string;
+  error?: string;
+  created_by?: string;
+  created_at: string;
+  delivered_at?: string;
+  completed_at?: string;
+}
+
+export interface CreateCommandRequest {
+  type: CommandType;
+  product?: string;
+  args?: Record<string, string>;
+}
+
 export interface License {
   id: string;
   license_key: string;
+  organization_id: string;
   customer_id: string;
   customer_name: string;
   type: string;
@@ -66,9 +106,13 @@ export interface Release {
   product_name: string;
   version: string;
   channel: string;
+  status: "draft" | "published" | "deprecated" | "eol";
+  status_message?: string;
   artifact_size: number;
   checksum: string;
   release_notes?: string;
+  yanked_at?: string;
+  yank_reason?: string;
   released_at: string;
 }
 
@@ -78,9 +122,11 @@ export interface User {
   email: string;
   name: string;
   role: string;
+  permissions?: string[];
   avatar_url?: string;
   mfa_enabled: boolean;
   is_active: boolean;
+  is_service_account?: boolean;
   email_verified: boolean;
   last_login_at?: string;
   password_changed_at: string;
@@ -88,6 +134,13 @@ export interface User {
   updated_at: string;
 }
 
+export interface Role {
+  name: string;
+  description?: string;
+  permissions: string[];
+  built_in: boolean;
+}
+
 export interface LoginRequest {
   email: string;
   password: string;
@@ -96,12 +149,34 @@ export interface LoginRequest {
 export interface LoginResponse {
   requires_mfa: boolean;
   mfa_token?: string;
+  mfa_methods?: string[];
   access_token?: string;
   refresh_token?: string;
   user?: User;
   expires_in?: number;
 }
 
+export interface WebAuthnCredential {
+  id: string;
+  name: string;
+  credential_id: string;
+  sign_count: number;
+  transports: string[];
+  aaguid?: string;
+  last_used_at?: string;
+  created_at: string;
+}
+
+export interface WebAuthnOptions {
+  challenge_id: string;
+  public_key: Record<string, any>;
+}
+
+export interface OIDCStatus {
+  enabled: boolean;
+  disable_local_passwords: boolean;
+}
+
 export interface MFAVerifyRequest {
   mfa_token: string;
   totp_code: string;
@@ -122,7 +197,15 @@ export interface Session {
   user_id: string;
   user_agent?: string;
   ip_address?: string;
+  browser?: string;
+  os?: string;
+  device_type?: "desktop" | "mobile" | "tablet" | "cli" | "unknown";
+  current?: boolean;
+  last_used_at: string;
+  idle_expires_at: string;
   expires_at: string;
+  revoked_at?: string;
+  revoked_reason?: string;
   created_at: string;
 }
 
@@ -136,10 +219,59 @@ export interface AuditEvent {
   created_at: string;
 }
 
+export interface AdminAuditEntry {
+  id: number;
+  actor_type: "user" | "api_token" | "anonymous";
+  actor_id?: string;
+  actor_email?: string;
+  token_id?: string;
+  action: string;
+  target_type?: string;
+  target_id?: string;
+  method: string;
+  path: string;
+  status: number;
+  before?: Record<string, unknown>;
+  after?: Record<string, unknown>;
+  changes?: Record<string, { before: unknown; after: unknown }>;
+  ip_address?: string;
+  user_agent?: string;
+  request_id?: string;
+  created_at: string;
+  prev_hash: string;
+  hash: string;
+}
+
+export interface AdminAuditFilter {
+  actor?: string;
+  action?: string;
+  target_type?: string;
+  target_id?: string;
+  q?: string;
+  from?: string;
+  to?: string;
+}
+
+export interface AdminAuditPage {
+  entries: AdminAuditEntry[];
+  total: number;
+  page: number;
+  per_page: number;
+}
+
+export interface AdminAuditVerification {
+  valid: boolean;
+  entries: number;
+  head_hash?: string;
+  broken_at?: number;
+  reason?: string;
+}
+
 class ApiClient {
   private baseUrl: string;
   private accessToken: string | null = null;
   private refreshToken: string | null = null;
+  private refreshing: Promise<boolean> | null = null;
 
   constructor() {
     this.baseUrl = API_URL;
@@ -242,7 +374,54 @@ class ApiClient {
     return response;
   }
 
+  async getWebAuthnLoginOptions(mfaToken: string): Promise<WebAuthnOptions> {
+    return this.fetch<WebAuthnOptions>("/api/v1/auth/mfa/webauthn/options", {
+      method: "POST",
+      body: JSON.stringify({ mfa_token: mfaToken }),
+    });
+  }
+
+  async verifyMFAWebAuthn(
+    mfaToken: string,
+    challengeId: string,
+    credential: Record<string, any>
+  ): Promise<LoginResponse> {
+    const response = await this.fetch<LoginResponse>("/api/v1/auth/mfa/verify", {
+      method: "POST",
+      body: JSON.stringify({
+        mfa_token: mfaToken,
+        webauthn: { challenge_id: challengeId, credential },
+      }),
+    });
+
+    if (response.access_token && response.refresh_token) {
+      this.setTokens(response.access_token, response.refresh_token);
+    }
+
+    return response;
+  }
+
+  // Refresh tokens are single use, so concurrent requests share one refresh
   async refreshTokens(): Promise<boolean> {
+    if (!this.refreshing) {
+      this.refreshing = this.doRefreshTokens().finally(() => {
+        this.refreshing = null;
+      });
+    }
+    return this.refreshing;
+  }
+
+  private async doRefreshTokens(): Promise<boolean> {
+    // Another tab may have refreshed already and stored the new tokens
+    if (typeof window !== "undefined") {
+      const storedRefreshToken = localStorage.getItem("refresh_token");
+      const storedAccessToken = localStorage.getItem("access_token");
+      if (storedRefreshToken && storedAccessToken && storedRefreshToken !== this.refreshToken) {
+        this.accessToken = storedAccessToken;
+        this.refreshToken = storedRefreshToken;
+        return true;
+      }
+    }
     if (!this.refreshToken) return false;
 
     try {
@@ -289,6 +468,38 @@ class ApiClient {
     }
   }
 
+  async getOIDCStatus(): Promise<OIDCStatus> {
+    return this.fetch<OIDCStatus>("/api/v1/auth/oidc");
+  }
+
+  // oidcLoginURL starts single sign-on; the browser is sent back to /login/callback
+  // with a one-time code for redeemOIDCLogin. linkToken, from startOIDCLink, links
+  // the signed-in account to the identity instead.
+  oidcLoginURL(redirectTo = "/", linkToken = ""): string {
+    let url = `${this.baseUrl}/api/v1/auth/oidc/login?redirect_to=${encodeURIComponent(redirectTo)}`;
+    if (linkToken) {
+      url += `&link=${encodeURIComponent(linkToken)}`;
+    }
+    return url;
+  }
+
+  async redeemOIDCLogin(code: string): Promise<LoginResponse> {
+    const response = await this.fetch<LoginResponse>("/api/v1/auth/oidc/token", {
+      method: "POST",
+      body: JSON.stringify({ code }),
+    });
+
+    if (!response.requires_mfa && response.access_token && response.refresh_token) {
+      this.setTokens(response.access_token, response.refresh_token);
+    }
+
+    return response;
+  }
+
+  async startOIDCLink(): Promise<{ token: string }> {
+    return this.fetch<{ token: string }>("/api/v1/auth/oidc/link", { method: "POST" }, true);
+  }
+
   async getProfile(): Promise<User> {
     return this.fetch<User>("/api/v1/auth/profile", {}, true);
   }
@@ -321,6 +532,31 @@ class ApiClient {
     );
   }
 
+  async forgotPassword(email: string): Promise<void> {
+    await this.fetch("/api/v1/auth/password/forgot", {
+      method: "POST",
+      body: JSON.stringify({ email }),
+    });
+  }
+
+  async resetPassword(token: string, newPassword: string): Promise<void> {
+    await this.fetch("/api/v1/auth/password/reset", {
+      method: "POST",
+      body: JSON.stringify({ token, new_password: newPassword }),
+    });
+  }
+
+  async verifyEmail(token: string): Promise<void> {
+    await this.fetch("/api/v1/auth/email/verify", {
+      method: "POST",
+      body: JSON.stringify({ token }),
+    });
+  }
+
+  async sendEmailVerification(): Promise<void> {
+    await this.fetch("/api/v1/auth/email/verification", { method: "POST" }, true);
+  }
+
   async setupMFA(): Promise<MFASetupResponse> {
     return this.fetch<MFASetupResponse>("/api/v1/auth/mfa/setup", {}, true);
   }
@@ -347,10 +583,49 @@ class ApiClient {
     );
   }
 
+  async beginWebAuthnRegistration(): Promise<WebAuthnOptions> {
+    return this.fetch<WebAuthnOptions>(
+      "/api/v1/auth/webauthn/register/begin",
+      { method: "POST" },
+      true
+    );
+  }
+
+  async finishWebAuthnRegistration(
+    challengeId: string,
+    name: string,
+    credential: Record<string, any>
+  ): Promise<WebAuthnCredential> {
+    return this.fetch<WebAuthnCredential>(
+      "/api/v1/auth/webauthn/register/finish",
+      {
+        method: "POST",
+        body: JSON.stringify({ challenge_id: challengeId, name, credential }),
+      },
+      true
+    );
+  }
+
+  async getWebAuthnCredentials(): Promise<WebAuthnCredential[]> {
+    return this.fetch<WebAuthnCredential[]>("/api/v1/auth/webauthn/credentials", {}, true);
+  }
+
+  async deleteWebAuthnCredential(id: string): Promise<void> {
+    await this.fetch(
+      `/api/v1/auth/webauthn/credentials/${id}`,
+      { method: "DELETE" },
+      true
+    );
+  }
+
   async getSessions(): Promise<Session[]> {
     return this.fetch<Session[]>("/api/v1/auth/sessions", {}, true);
   }
 
+  async revokeSession(id: string): Promise<void> {
+    await this.fetch(`/api/v1/auth/sessions/${id}`, { method: "DELETE" }, true);
+  }
+
   async getAuditLog(): Promise<AuditEvent[]> {
     return this.fetch<AuditEvent[]>("/api/v1/auth/audit", {}, true);
   }
@@ -361,13 +636,32 @@ class ApiClient {
   }
 
   async getInstance(id: string): Promise<Instance> {
-    return this.fetch<Instance>(`/api/v1/instances/${id}`);
+    return this.fetch<Instance>(`/api/v1/instances/${id}`, {}, true);
   }
 
   async deleteInstance(id: string): Promise<void> {
     await this.fetch(`/api/v1/instances/${id}`, { method: "DELETE" }, true);
   }
 
+  async getInstanceCommands(id: string, limit = 50): Promise<InstanceCommand[]> {
+    return this.fetch<InstanceCommand[]>(`/api/v1/instances/${id}/commands?limit=${limit}`, {}, true);
+  }
+
+  async createInstanceCommand(id: string, data: CreateCommandRequest): Promise<InstanceCommand> {
+    return this.fetch<InstanceCommand>(
+      `/api/v1/instances/${id}/commands`,
+      {
+        method: "POST",
+        body: JSON.stringify(data),
+      },
+      true
+    );
+  }
+
+  async cancelInstanceCommand(id: string, commandId: string): Promise<void> {
+    await this.fetch(`/api/v1/instances/${id}/commands/${commandId}`, { method: "DELETE" }, true);
+  }
+
   // Licenses
   async getLicenses(): Promise<License[]> {
     return this.fetch<License[]>("/api/v1/admin/licenses");
@@ -405,11 +699,12 @@ class ApiClient {
 
   // Releases
   async getReleases(): Promise<Release[]> {
-    return this.fetch<Release[]>("/api/v1/releases");
+    // Signed in with releases:upload, drafts and scheduled releases are listed too
+    return this.fetch<Release[]>("/api/v1/releases", {}, true);
   }
 
   async getProductReleases(product: string): Promise<Release[]> {
-    return this.fetch<Release[]>(`/api/v1/releases/${product}`);
+    return this.fetch<Release[]>(`/api/v1/releases/${product}`, {}, true);
   }
 
   async uploadRelease(data: {
@@ -490,10 +785,79 @@ class ApiClient {
     await this.fetch(`/api/v1/admin/users/${id}`, { method: "DELETE" }, true);
   }
 
+  async getUserSessions(userId: string): Promise<Session[]> {
+    return this.fetch<Session[]>(`/api/v1/admin/users/${userId}/sessions`, {}, true);
+  }
+
+  async revokeUserSession(userId: string, sessionId: string): Promise<void> {
+    await this.fetch(
+      `/api/v1/admin/users/${userId}/sessions/${sessionId}`,
+      { method: "DELETE" },
+      true
+    );
+  }
+
+  async revokeAllUserSessions(userId: string): Promise<{ revoked: number }> {
+    return this.fetch<{ revoked: number }>(
+      `/api/v1/admin/users/${userId}/sessions`,
+      { method: "DELETE" },
+      true
+    );
+  }
+
+  // Admin - Roles
+  async getRoles(): Promise<Role[]> {
+    return this.fetch<Role[]>("/api/v1/admin/roles", {}, true);
+  }
+
+  // Admin - Audit log
+  async getAdminAudit(
+    filter: AdminAuditFilter,
+    page: number,
+    perPage = 50
+  ): Promise<AdminAuditPage> {
+    const params = auditParams(filter);
+    params.set("page", String(page));
+    params.set("per_page", String(perPage));
+    return this.fetch<AdminAuditPage>(`/api/v1/admin/audit?${params}`, {}, true);
+  }
+
+  async exportAdminAudit(filter: AdminAuditFilter, format: "csv" | "json"): Promise<Blob> {
+    const params = auditParams(filter);
+    params.set("format", format);
+
+    const headers: HeadersInit = {};
+    if (this.accessToken) {
+      headers["Authorization"] = `Bearer ${this.accessToken}`;
+    }
+
+    const response = await fetch(`${this.baseUrl}/api/v1/admin/audit/export?${params}`, { headers });
+    if (!response.ok) {
+      const error = await response.json().catch(() => ({ error: "Export failed" }));
+      throw new Error(error.error || `Export failed: ${response.status}`);
+    }
+
+    return response.blob();
+  }
+
+  async verifyAdminAudit(): Promise<AdminAuditVerification> {
+    return this.fetch<AdminAuditVerification>("/api/v1/admin/audit/verify", {}, true);
+  }
+
   // Health
   async getHealth(): Promise<{ status: string; version: string }> {
     return this.fetch("/health");
   }
 }
 
+function auditParams(filter: AdminAuditFilter): URLSearchParams {
+  const params = new URLSearchParams();
+  for (const [key, value] of Object.entries(filter)) {
+    if (value) {
+      params.set(key, value);
+    }
+  }
+  return params;
+}
+
 export const api = new ApiClient();
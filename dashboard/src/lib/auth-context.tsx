@@ -8,6 +8,7 @@ import React, {
   useCallback,
 } from "react";
 import { api, User, LoginResponse } from "./api";
+import { getAssertion } from "./webauthn";
 
 interface AuthContextType {
   user: User | null;
@@ -15,6 +16,7 @@ interface AuthContextType {
   isAuthenticated: boolean;
   login: (email: string, password: string) => Promise<LoginResponse>;
   verifyMFA: (mfaToken: string, totpCode: string) => Promise<LoginResponse>;
+  verifyWebAuthn: (mfaToken: string) => Promise<LoginResponse>;
   logout: () => Promise<void>;
   refreshUser: () => Promise<void>;
 }
@@ -70,6 +72,16 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
     return response;
   };
 
+  const verifyWebAuthn = async (mfaToken: string): Promise<LoginResponse> => {
+    const options = await api.getWebAuthnLoginOptions(mfaToken);
+    const credential = await getAssertion(options.public_key);
+    const response = await api.verifyMFAWebAuthn(mfaToken, options.challenge_id, credential);
+    if (response.user) {
+      setUser(response.user);
+    }
+    return response;
+  };
+
   const logout = async () => {
     await api.logout();
     setUser(null);
@@ -83,6 +95,7 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
         isAuthenticated: !!user,
         login,
         verifyMFA,
+        verifyWebAuthn,
         logout,
         refreshUser,
       }}
@@ -145,3 +158,26 @@ export function RequireRole({
 
   return <>{children}</>;
 }
+
+// Permission-based access control
+export function RequirePermission({
+  children,
+  permission,
+  fallback,
+}: {
+  children: React.ReactNode;
+  permission: string;
+  fallback?: React.ReactNode;
+}) {
+  const { user, isLoading } = useAuth();
+
+  if (isLoading) {
+    return null;
+  }
+
+  if (!user || !(user.permissions || []).includes(permission)) {
+    return fallback ? <>{fallback}</> : null;
+  }
+
+  return <>{children}</>;
+}
@@ -0,0 +1,90 @@
+// Helpers for the browser WebAuthn API. The server sends and expects binary
+// fields as base64url strings.
+
+function fromBase64URL(value: string): ArrayBuffer {
+  const base64 = value.replace(/-/g, "+").replace(/_/g, "/");
+  const padded = base64 + "===".slice((base64.length + 3) % 4);
+  const binary = atob(padded);
+  const bytes = new Uint8Array(binary.length);
+  for (let i = 0; i < binary.length; i++) {
+    bytes[i] = binary.charCodeAt(i);
+  }
+  return bytes.buffer;
+}
+
+function toBase64URL(buffer: ArrayBuffer): string {
+  const bytes = new Uint8Array(buffer);
+  let binary = "";
+  for (let i = 0; i < bytes.length; i++) {
+    binary += String.fromCharCode(bytes[i]);
+  }
+  return btoa(binary).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
+
+type Descriptor = { type: string; id: string; transports?: string[] };
+
+function decodeDescriptors(descriptors?: Descriptor[]): PublicKeyCredentialDescriptor[] {
+  return (descriptors || []).map((d) => ({
+    type: "public-key",
+    id: fromBase64URL(d.id),
+    transports: (d.transports || []) as AuthenticatorTransport[],
+  }));
+}
+
+export function isWebAuthnSupported(): boolean {
+  return typeof window !== "undefined" && !!window.PublicKeyCredential;
+}
+
+// createCredential runs the registration ceremony
+export async function createCredential(publicKey: Record<string, any>) {
+  const credential = (await navigator.credentials.create({
+    publicKey: {
+      ...publicKey,
+      challenge: fromBase64URL(publicKey.challenge),
+      user: { ...publicKey.user, id: fromBase64URL(publicKey.user.id) },
+      excludeCredentials: decodeDescriptors(publicKey.excludeCredentials),
+    } as PublicKeyCredentialCreationOptions,
+  })) as PublicKeyCredential | null;
+  if (!credential) {
+    throw new Error("Security key registration was cancelled");
+  }
+
+  const response = credential.response as AuthenticatorAttestationResponse;
+  return {
+    id: credential.id,
+    rawId: toBase64URL(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: toBase64URL(response.clientDataJSON),
+      attestationObject: toBase64URL(response.attestationObject),
+      transports: response.getTransports ? response.getTransports() : [],
+    },
+  };
+}
+
+// getAssertion runs the login ceremony
+export async function getAssertion(publicKey: Record<string, any>) {
+  const credential = (await navigator.credentials.get({
+    publicKey: {
+      ...publicKey,
+      challenge: fromBase64URL(publicKey.challenge),
+      allowCredentials: decodeDescriptors(publicKey.allowCredentials),
+    } as PublicKeyCredentialRequestOptions,
+  })) as PublicKeyCredential | null;
+  if (!credential) {
+    throw new Error("Security key verification was cancelled");
+  }
+
+  const response = credential.response as AuthenticatorAssertionResponse;
+  return {
+    id: credential.id,
+    rawId: toBase64URL(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: toBase64URL(response.clientDataJSON),
+      authenticatorData: toBase64URL(response.authenticatorData),
+      signature: toBase64URL(response.signature),
+      userHandle: response.userHandle ? toBase64URL(response.userHandle) : undefined,
+    },
+  };
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/audit"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/commands"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// Instance command handlers. Commands reach the instance in its next
+// heartbeat response and updaters report their results in heartbeat batches.
+
+const (
+	// defaultCommandLimit and maxCommandLimit bound the commands listed at once
+	defaultCommandLimit = 50
+	maxCommandLimit     = 500
+)
+
+// handleListInstanceCommands handles GET /api/v1/instances/{id}/commands?limit=N
+func (s *Server) handleListInstanceCommands(w http.ResponseWriter, r *http.Request) {
+	instance, ok := s.scopedInstance(w, r)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = defaultCommandLimit
+	}
+	limit = min(limit, maxCommandLimit)
+
+	list, err := s.commands.List(r.Context(), instance.ID, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// handleCreateInstanceCommand handles POST /api/v1/instances/{id}/commands
+func (s *Server) handleCreateInstanceCommand(w http.ResponseWriter, r *http.Request) {
+	instance, ok := s.scopedInstance(w, r)
+	if !ok {
+		return
+	}
+
+	var req types.CreateCommandRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	command, err := s.commands.Create(r.Context(), instance, req, requestActor(r))
+	if errors.Is(err, commands.ErrInvalidCommand) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, commands.ErrCommandsDisabled) {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, command)
+}
+
+// handleCancelInstanceCommand handles DELETE /api/v1/instances/{id}/commands/{command}
+func (s *Server) handleCancelInstanceCommand(w http.ResponseWriter, r *http.Request) {
+	instance, ok := s.scopedInstance(w, r)
+	if !ok {
+		return
+	}
+
+	command, err := s.commands.Get(r.Context(), chi.URLParam(r, "command"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if command == nil || command.InstanceID != instance.InstanceID {
+		writeError(w, http.StatusNotFound, "command not found")
+		return
+	}
+	audit.SetBefore(r.Context(), command)
+
+	err = s.commands.Cancel(r.Context(), instance.ID, command.ID)
+	if errors.Is(err, commands.ErrCommandNotPending) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": types.CommandCancelled})
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/audit"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/licensing"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/products"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// Instance control handlers. The control of an instance reaches it in its
+// next heartbeat response.
+
+// handleGetInstanceControl handles GET /api/v1/instances/{id}/control
+func (s *Server) handleGetInstanceControl(w http.ResponseWriter, r *http.Request) {
+	instance, ok := s.scopedInstance(w, r)
+	if !ok {
+		return
+	}
+
+	control, err := licensing.NewInstanceRepository(s.db).GetControl(r.Context(), instance.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, control)
+}
+
+// handleSetInstanceControl handles PUT /api/v1/instances/{id}/control,
+// replacing the desired versions and updater settings of the instance
+func (s *Server) handleSetInstanceControl(w http.ResponseWriter, r *http.Request) {
+	instance, ok := s.scopedInstance(w, r)
+	if !ok {
+		return
+	}
+
+	var control types.InstanceControl
+	if err := decodeJSON(r, &control); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if control.DesiredVersions == nil {
+		control.DesiredVersions = map[string]string{}
+	}
+	if err := validateControl(&control); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	repo := licensing.NewInstanceRepository(s.db)
+	before, err := repo.GetControl(r.Context(), instance.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	audit.SetBefore(r.Context(), before)
+
+	if err := repo.SetControl(r.Context(), instance.ID, &control); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.controls.Invalidate()
+
+	writeJSON(w, http.StatusOK, control)
+}
+
+// validateControl checks a control before it is stored
+func validateControl(control *types.InstanceControl) error {
+	for product, version := range control.DesiredVersions {
+		if product == "" || version == "" {
+			return fmt.Errorf("desired_versions needs a product and version")
+		}
+	}
+
+	config := control.Config
+	if config == nil {
+		return nil
+	}
+	if config.Channel != "" && !products.IsValidChannel(config.Channel) {
+		return fmt.Errorf("invalid channel %q", config.Channel)
+	}
+	for product, channel := range config.ProductChannels {
+		if !products.IsValidChannel(channel) {
+			return fmt.Errorf("invalid channel %q for product %s", channel, product)
+		}
+	}
+	if window := config.MaintenanceWindow; window != nil {
+		if _, err := time.Parse("15:04", window.Start); err != nil {
+			return fmt.Errorf("maintenance_window.start must be HH:MM")
+		}
+		if _, err := time.Parse("15:04", window.End); err != nil {
+			return fmt.Errorf("maintenance_window.end must be HH:MM")
+		}
+		if _, err := time.LoadLocation(window.Timezone); err != nil {
+			return fmt.Errorf("invalid maintenance_window.timezone %q", window.Timezone)
+		}
+	}
+	return nil
+}
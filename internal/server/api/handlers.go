@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"path/filepath"
@@ -9,8 +10,13 @@ import (
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/audit"
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/licensing"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/metrics"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/organizations"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/products"
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/releases"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/storage"
 	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
 )
 
@@ -92,8 +98,8 @@ func (s *Server) handleLicenseValidate(w http.ResponseWriter, r *http.Request) {
 // Release handlers
 
 func (s *Server) handleListReleases(w http.ResponseWriter, r *http.Request) {
-	svc := releases.NewService(s.db, s.storage)
-	releaseList, err := svc.ListReleases(r.Context())
+	svc := s.ReleaseService()
+	releaseList, err := svc.ListReleases(r.Context(), s.canSeeDrafts(r))
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -113,16 +119,16 @@ func (s *Server) handleUploadRelease(w http.ResponseWriter, r *http.Request) {
 
 	productName := r.FormValue("product")
 	version := r.FormValue("version")
-	channel := r.FormValue("channel")
-	if channel == "" {
-		channel = "stable"
-	}
+	channel := r.FormValue("channel") // defaults to the product's registered channel
 	releaseNotes := r.FormValue("release_notes")
 
 	if productName == "" || version == "" {
 		writeError(w, http.StatusBadRequest, "product and version are required")
 		return
 	}
+	if !requireProductAccess(w, r, productName) {
+		return
+	}
 
 	// Get uploaded file
 	file, header, err := r.FormFile("artifact")
@@ -132,7 +138,7 @@ func (s *Server) handleUploadRelease(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	svc := releases.NewService(s.db, s.storage)
+	svc := s.ReleaseService()
 	release, err := svc.CreateRelease(r.Context(), releases.CreateReleaseRequest{
 		ProductName:  productName,
 		Version:      version,
@@ -143,7 +149,16 @@ func (s *Server) handleUploadRelease(w http.ResponseWriter, r *http.Request) {
 		File:         file,
 	})
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
+		switch {
+		case errors.Is(err, products.ErrProductNotFound):
+			writeError(w, http.StatusBadRequest, "unknown product: register it under /api/v1/products first")
+		case errors.Is(err, releases.ErrInvalidChannel):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, releases.ErrReleaseExists), errors.Is(err, storage.ErrArtifactExists):
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
 		return
 	}
 
@@ -153,8 +168,8 @@ func (s *Server) handleUploadRelease(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleListProductReleases(w http.ResponseWriter, r *http.Request) {
 	product := chi.URLParam(r, "product")
 
-	svc := releases.NewService(s.db, s.storage)
-	releaseList, err := svc.ListProductReleases(r.Context(), product)
+	svc := s.ReleaseService()
+	releaseList, err := svc.ListProductReleases(r.Context(), product, s.canSeeDrafts(r))
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -171,7 +186,7 @@ func (s *Server) handleGetLatestRelease(w http.ResponseWriter, r *http.Request)
 	}
 	currentVersion := r.URL.Query().Get("current_version")
 
-	svc := releases.NewService(s.db, s.storage)
+	svc := s.ReleaseService()
 	releaseInfo, err := svc.GetLatestRelease(r.Context(), product, channel, currentVersion)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
@@ -189,13 +204,13 @@ func (s *Server) handleGetRelease(w http.ResponseWriter, r *http.Request) {
 	product := chi.URLParam(r, "product")
 	version := chi.URLParam(r, "version")
 
-	svc := releases.NewService(s.db, s.storage)
+	svc := s.ReleaseService()
 	release, err := svc.GetRelease(r.Context(), product, version)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	if release == nil {
+	if release == nil || !s.canSee(r, release) {
 		writeError(w, http.StatusNotFound, "release not found")
 		return
 	}
@@ -207,13 +222,13 @@ func (s *Server) handleDownloadRelease(w http.ResponseWriter, r *http.Request) {
 	product := chi.URLParam(r, "product")
 	version := chi.URLParam(r, "version")
 
-	svc := releases.NewService(s.db, s.storage)
+	svc := s.ReleaseService()
 	release, err := svc.GetRelease(r.Context(), product, version)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	if release == nil {
+	if release == nil || !s.canSee(r, release) {
 		writeError(w, http.StatusNotFound, "release not found")
 		return
 	}
@@ -233,7 +248,8 @@ func (s *Server) handleDownloadRelease(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Length", strconv.FormatInt(release.ArtifactSize, 10))
 	w.Header().Set("X-Checksum-SHA256", release.Checksum)
 
-	io.Copy(w, reader)
+	n, _ := io.Copy(w, reader)
+	s.metrics.AddDownloadBytes(product, n)
 }
 
 // handleUploadBinary handles uploading a specific binary file
@@ -247,19 +263,33 @@ func (s *Server) handleUploadBinary(w http.ResponseWriter, r *http.Request) {
 	// Read the binary from request body
 	defer r.Body.Close()
 
-	// Save to storage
-	path, err := s.storage.Save(product, version, filename, r.Body)
+	svc := s.ReleaseService()
+	if _, err := svc.RequireProduct(r.Context(), product); err != nil {
+		if errors.Is(err, products.ErrProductNotFound) {
+			writeError(w, http.StatusBadRequest, "unknown product: register it under /api/v1/products first")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Save to storage; published releases and stored binaries are never changed
+	path, err := svc.SaveArtifact(r.Context(), product, version, filename, r.Body)
 	if err != nil {
+		if errors.Is(err, releases.ErrReleaseNotDraft) || errors.Is(err, storage.ErrArtifactExists) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "failed to save binary: "+err.Error())
 		return
 	}
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"status":   "uploaded",
-		"product":  product,
-		"version":  version,
-		"filename": filename,
-		"path":     path,
+		"status":       "uploaded",
+		"product":      product,
+		"version":      version,
+		"filename":     filename,
+		"path":         path,
 		"download_url": "/" + product + "/" + version + "/" + filename,
 	})
 }
@@ -285,6 +315,15 @@ func (s *Server) handleDirectDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Try to get release info for checksum. Binaries of a release that is
+	// not published yet are hidden like the release itself.
+	svc := s.ReleaseService()
+	release, _ := svc.GetRelease(r.Context(), product, version)
+	if release != nil && !s.canSee(r, release) {
+		writeError(w, http.StatusNotFound, "artifact not found")
+		return
+	}
+
 	// Get the artifact file
 	reader, err := s.storage.Get(product, version, filename)
 	if err != nil {
@@ -293,20 +332,17 @@ func (s *Server) handleDirectDownload(w http.ResponseWriter, r *http.Request) {
 	}
 	defer reader.Close()
 
-	// Try to get release info for checksum
-	svc := releases.NewService(s.db, s.storage)
-	release, _ := svc.GetRelease(r.Context(), product, version)
-
 	// Set headers for download
 	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
 	w.Header().Set("Content-Type", "application/octet-stream")
-	
+
 	// Add checksum if available from release record
 	if release != nil && release.Checksum != "" {
 		w.Header().Set("X-Checksum-SHA256", release.Checksum)
 	}
 
-	io.Copy(w, reader)
+	n, _ := io.Copy(w, reader)
+	s.metrics.AddDownloadBytes(product, n)
 }
 
 // Heartbeat handler
@@ -314,44 +350,82 @@ func (s *Server) handleDirectDownload(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
 	var heartbeat types.Heartbeat
 	if err := decodeJSON(r, &heartbeat); err != nil {
+		s.metrics.ObserveHeartbeats(metrics.HeartbeatInvalid, 1)
 		writeError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
 	if heartbeat.InstanceID == "" {
+		s.metrics.ObserveHeartbeats(metrics.HeartbeatInvalid, 1)
 		writeError(w, http.StatusBadRequest, "instance_id is required")
 		return
 	}
+	// Desired versions, settings and commands are only for the instance itself
+	instance := requestInstance(r)
+	if heartbeat.InstanceID != instance.InstanceID {
+		s.metrics.ObserveHeartbeats(metrics.HeartbeatInvalid, 1)
+		writeError(w, http.StatusForbidden, "API key does not belong to instance "+heartbeat.InstanceID)
+		return
+	}
 
-	// Update instance heartbeat
-	instanceRepo := licensing.NewInstanceRepository(s.db)
-	if err := instanceRepo.UpdateHeartbeat(r.Context(), heartbeat.InstanceID, &heartbeat); err != nil {
-		// Instance might not exist yet, that's ok
-		// Just log and continue
+	// Queue the heartbeat to be recorded with others. When the queue is full
+	// the updater is asked to come back later rather than waiting on the database.
+	if err := s.heartbeats.Enqueue(&heartbeat); err != nil {
+		w.Header().Set("Retry-After", strconv.Itoa(int(s.config.Heartbeats.RetryAfter.Seconds())))
+		writeError(w, http.StatusServiceUnavailable, "server is busy, retry later")
+		return
 	}
 
-	// Check for available updates
+	control := s.controls.Get(r.Context(), instance.InstanceID)
+
+	// Check for available updates, answered from the release cache. Products
+	// pinned to a desired version are offered that version instead.
 	var updates []types.ReleaseInfo
-	releaseSvc := releases.NewService(s.db, s.storage)
+	releaseSvc := s.ReleaseService()
 
 	for _, product := range heartbeat.Products {
-		info, err := releaseSvc.GetLatestRelease(r.Context(), product.Name, product.Channel, product.Version)
+		var info *types.ReleaseInfo
+		var err error
+		if version, ok := control.DesiredVersions[product.Name]; ok {
+			info, err = releaseSvc.GetReleaseInfo(r.Context(), product.Name, version, product.Version)
+		} else {
+			info, err = releaseSvc.GetLatestRelease(r.Context(), product.Name, product.Channel, product.Version)
+		}
 		if err == nil && info != nil && info.UpdateAvailable {
 			updates = append(updates, *info)
 		}
 	}
 
-	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"status":  "ok",
-		"updates": updates,
-	})
+	resp := types.HeartbeatResponse{
+		Status:          "ok",
+		Updates:         updates,
+		Warnings:        releaseSvc.GetReleaseWarnings(r.Context(), heartbeat.Products),
+		NextHeartbeatIn: int(s.heartbeats.NextHeartbeatIn().Seconds()),
+		DesiredVersions: control.DesiredVersions,
+		Commands:        s.commands.Claim(r.Context(), instance.InstanceID),
+	}
+
+	// Send the updater settings only when it does not have them yet
+	if control.Config.Hash() != heartbeat.ConfigHash {
+		resp.Config = control.Config
+		if resp.Config == nil {
+			resp.Config = &types.UpdaterConfig{}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
 }
 
 // Instance handlers (admin)
 
 func (s *Server) handleListInstances(w http.ResponseWriter, r *http.Request) {
+	scope, ok := s.requestScope(w, r)
+	if !ok {
+		return
+	}
+
 	repo := licensing.NewInstanceRepository(s.db)
-	instances, err := repo.List(r.Context())
+	instances, err := repo.List(r.Context(), scope)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -361,16 +435,8 @@ func (s *Server) handleListInstances(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleGetInstance(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-
-	repo := licensing.NewInstanceRepository(s.db)
-	instance, err := repo.GetByID(r.Context(), id)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
-		return
-	}
-	if instance == nil {
-		writeError(w, http.StatusNotFound, "instance not found")
+	instance, ok := s.scopedInstance(w, r)
+	if !ok {
 		return
 	}
 
@@ -378,22 +444,55 @@ func (s *Server) handleGetInstance(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleDeleteInstance(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
+	instance, ok := s.scopedInstance(w, r)
+	if !ok {
+		return
+	}
+
+	audit.SetBefore(r.Context(), instance)
+	audit.SetAfter(r.Context(), nil)
 
 	repo := licensing.NewInstanceRepository(s.db)
-	if err := repo.Delete(r.Context(), id); err != nil {
+	if err := repo.Delete(r.Context(), instance.ID); err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	s.keys.Forget(instance.ID)
 
 	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
+// scopedInstance loads the {id} instance, answering 404 when it is outside the caller's organizations
+func (s *Server) scopedInstance(w http.ResponseWriter, r *http.Request) (*types.Instance, bool) {
+	scope, ok := s.requestScope(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	repo := licensing.NewInstanceRepository(s.db)
+	instance, err := repo.GetByID(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if instance == nil || !organizations.InScope(scope, instance.OrganizationID) {
+		writeError(w, http.StatusNotFound, "instance not found")
+		return nil, false
+	}
+
+	return instance, true
+}
+
 // Admin license handlers
 
 func (s *Server) handleListLicenses(w http.ResponseWriter, r *http.Request) {
+	scope, ok := s.requestScope(w, r)
+	if !ok {
+		return
+	}
+
 	svc := licensing.NewService(s.db)
-	licenses, err := svc.ListLicenses(r.Context())
+	licenses, err := svc.ListLicenses(r.Context(), scope)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -409,8 +508,22 @@ func (s *Server) handleCreateLicense(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.CustomerID == "" || req.CustomerName == "" || req.Type == "" {
-		writeError(w, http.StatusBadRequest, "customer_id, customer_name, and type are required")
+	if req.Type == "" {
+		writeError(w, http.StatusBadRequest, "type is required")
+		return
+	}
+	if req.OrganizationID == "" && (req.CustomerID == "" || req.CustomerName == "") {
+		writeError(w, http.StatusBadRequest, "organization_id, or customer_id and customer_name, are required")
+		return
+	}
+
+	scope, ok := s.requestScope(w, r)
+	if !ok {
+		return
+	}
+	// Users limited to their own organizations can only license those
+	if scope != nil && !organizations.InScope(scope, req.OrganizationID) {
+		writeError(w, http.StatusForbidden, "organization_id must be one of your organizations")
 		return
 	}
 
@@ -426,7 +539,7 @@ func (s *Server) handleCreateLicense(w http.ResponseWriter, r *http.Request) {
 	svc := licensing.NewService(s.db)
 	license, err := svc.CreateLicense(r.Context(), req)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
+		writeOrganizationError(w, err)
 		return
 	}
 
@@ -434,16 +547,8 @@ func (s *Server) handleCreateLicense(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleGetLicense(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-
-	svc := licensing.NewService(s.db)
-	license, err := svc.GetLicense(r.Context(), id)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
-		return
-	}
-	if license == nil {
-		writeError(w, http.StatusNotFound, "license not found")
+	license, ok := s.scopedLicense(w, r)
+	if !ok {
 		return
 	}
 
@@ -451,19 +556,13 @@ func (s *Server) handleGetLicense(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleUpdateLicense(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-
-	svc := licensing.NewService(s.db)
-	license, err := svc.GetLicense(r.Context(), id)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
-		return
-	}
-	if license == nil {
-		writeError(w, http.StatusNotFound, "license not found")
+	license, ok := s.scopedLicense(w, r)
+	if !ok {
 		return
 	}
 
+	audit.SetBefore(r.Context(), *license)
+
 	// Decode updates
 	var updates map[string]interface{}
 	if err := decodeJSON(r, &updates); err != nil {
@@ -479,6 +578,7 @@ func (s *Server) handleUpdateLicense(w http.ResponseWriter, r *http.Request) {
 		license.IsActive = active
 	}
 
+	svc := licensing.NewService(s.db)
 	if err := svc.UpdateLicense(r.Context(), license); err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -488,10 +588,16 @@ func (s *Server) handleUpdateLicense(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleDeleteLicense(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
+	license, ok := s.scopedLicense(w, r)
+	if !ok {
+		return
+	}
+
+	audit.SetBefore(r.Context(), license)
+	audit.SetAfter(r.Context(), nil)
 
 	svc := licensing.NewService(s.db)
-	if err := svc.DeleteLicense(r.Context(), id); err != nil {
+	if err := svc.DeleteLicense(r.Context(), license.ID); err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -499,6 +605,27 @@ func (s *Server) handleDeleteLicense(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
+// scopedLicense loads the {id} license, answering 404 when it is outside the caller's organizations
+func (s *Server) scopedLicense(w http.ResponseWriter, r *http.Request) (*types.License, bool) {
+	scope, ok := s.requestScope(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	svc := licensing.NewService(s.db)
+	license, err := svc.GetLicense(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if license == nil || !organizations.InScope(scope, license.OrganizationID) {
+		writeError(w, http.StatusNotFound, "license not found")
+		return nil, false
+	}
+
+	return license, true
+}
+
 // Helper functions
 
 func writeJSON(w http.ResponseWriter, status int, data interface{}) {
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/heartbeats"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/licensing"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/metrics"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// Replayed heartbeat, alert and command result handlers
+
+const (
+	// maxBatchEntries limits the heartbeats, alerts and results in one batch
+	maxBatchEntries = 1000
+	// maxBatchSize limits a batch, both as sent and once decompressed
+	maxBatchSize = 16 << 20
+	// defaultAlertLimit and maxAlertLimit bound the alerts listed at once
+	defaultAlertLimit = 100
+	maxAlertLimit     = 1000
+)
+
+// handleHeartbeatBatch handles POST /api/v1/heartbeat/batch. Updaters send
+// the heartbeats and alerts they could not deliver while the server was
+// unreachable, optionally gzip-compressed, and they are recorded at the times
+// they were raised. Command results are reported here too.
+func (s *Server) handleHeartbeatBatch(w http.ResponseWriter, r *http.Request) {
+	// Replays can wait, so they make room for live heartbeats
+	if s.heartbeats.Busy() {
+		w.Header().Set("Retry-After", strconv.Itoa(int(s.config.Heartbeats.RetryAfter.Seconds())))
+		writeError(w, http.StatusServiceUnavailable, "server is busy, retry later")
+		return
+	}
+
+	instanceID := requestInstance(r).InstanceID
+	body := io.Reader(http.MaxBytesReader(w, r.Body, maxBatchSize))
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid gzip body")
+			return
+		}
+		defer gz.Close()
+		body = io.LimitReader(gz, maxBatchSize)
+	}
+
+	var batch types.HeartbeatBatch
+	if err := json.NewDecoder(body).Decode(&batch); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if len(batch.Heartbeats)+len(batch.Alerts)+len(batch.Results) > maxBatchEntries {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("a batch holds at most %d heartbeats, alerts and results", maxBatchEntries))
+		return
+	}
+	// Updaters only replay what they raised themselves
+	for _, heartbeat := range batch.Heartbeats {
+		if heartbeat.InstanceID == "" {
+			s.metrics.ObserveHeartbeats(metrics.HeartbeatInvalid, len(batch.Heartbeats))
+			writeError(w, http.StatusBadRequest, "instance_id is required")
+			return
+		}
+		if heartbeat.InstanceID != instanceID {
+			s.metrics.ObserveHeartbeats(metrics.HeartbeatInvalid, len(batch.Heartbeats))
+			writeError(w, http.StatusForbidden, "API key does not belong to instance "+heartbeat.InstanceID)
+			return
+		}
+	}
+	now := time.Now()
+	for i, alert := range batch.Alerts {
+		if alert.InstanceID == "" || alert.Type == "" || alert.Message == "" {
+			writeError(w, http.StatusBadRequest, "alerts need an instance_id, type and message")
+			return
+		}
+		if alert.InstanceID != instanceID {
+			writeError(w, http.StatusForbidden, "API key does not belong to instance "+alert.InstanceID)
+			return
+		}
+		batch.Alerts[i].Time = heartbeats.ReplayTime(alert.Time, now)
+	}
+	for i, result := range batch.Results {
+		if result.CommandID == "" || result.InstanceID == "" {
+			writeError(w, http.StatusBadRequest, "results need a command_id and instance_id")
+			return
+		}
+		if result.InstanceID != instanceID {
+			writeError(w, http.StatusForbidden, "API key does not belong to instance "+result.InstanceID)
+			return
+		}
+		switch result.Status {
+		case types.CommandSucceeded, types.CommandFailed, types.CommandRejected:
+		default:
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid result status %q", result.Status))
+			return
+		}
+		batch.Results[i].Time = heartbeats.ReplayTime(result.Time, now)
+	}
+
+	recorded, err := s.heartbeats.Replay(r.Context(), batch.Heartbeats)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var alerts int
+	if len(batch.Alerts) > 0 {
+		alerts, err = licensing.NewInstanceRepository(s.db).CreateAlerts(r.Context(), batch.Alerts)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	var results int
+	if len(batch.Results) > 0 {
+		results, err = s.commands.Complete(r.Context(), instanceID, batch.Results)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, types.HeartbeatBatchResponse{Heartbeats: recorded, Alerts: alerts, Results: results})
+}
+
+// handleListInstanceAlerts handles GET /api/v1/instances/{id}/alerts?limit=N
+func (s *Server) handleListInstanceAlerts(w http.ResponseWriter, r *http.Request) {
+	instance, ok := s.scopedInstance(w, r)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = defaultAlertLimit
+	}
+	limit = min(limit, maxAlertLimit)
+
+	alerts, err := licensing.NewInstanceRepository(s.db).ListAlerts(r.Context(), instance.ID, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, alerts)
+}
@@ -1,45 +1,214 @@
 package api
 
 import (
+	"context"
+	"log"
+	"net"
 	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/auth"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/organizations"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
 )
 
-// adminAuth middleware checks for admin API key
-func (s *Server) adminAuth(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Skip auth if no admin key is configured
-		if s.config.Server.APIKey == "" {
-			next.ServeHTTP(w, r)
-			return
-		}
+// requirePermission protects a route with a user or API token granting permission
+func (s *Server) requirePermission(permission string) func(http.Handler) http.Handler {
+	return auth.RequirePermission(s.authService, permission)
+}
+
+// organizationScope returns the organizations whose licenses and instances the caller
+// may see, or nil when the caller's role grants access to every organization
+func (s *Server) organizationScope(r *http.Request) ([]string, error) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		return []string{}, nil
+	}
+
+	all, err := s.authService.HasPermission(r.Context(), user, auth.PermOrganizationsAll)
+	if err != nil {
+		return nil, err
+	}
+	if all {
+		return nil, nil
+	}
+
+	return organizations.NewService(s.db).UserScope(r.Context(), user.ID)
+}
+
+// requestScope is organizationScope narrowed by an optional ?organization_id= filter.
+// It writes an error response and returns ok=false when the scope cannot be resolved.
+func (s *Server) requestScope(w http.ResponseWriter, r *http.Request) (scope []string, ok bool) {
+	scope, err := s.organizationScope(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to resolve organization access")
+		return nil, false
+	}
+	return organizations.Narrow(scope, r.URL.Query().Get("organization_id")), true
+}
+
+// instanceContextKey holds the instance authenticated by instanceAuth
+type instanceContextKey struct{}
 
+// instanceAuth authenticates updaters by the X-API-Key their instance was
+// activated with, and adds the instance to the request context
+func (s *Server) instanceAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		apiKey := r.Header.Get("X-API-Key")
 		if apiKey == "" {
-			apiKey = r.URL.Query().Get("api_key")
+			writeError(w, http.StatusUnauthorized, "missing API key")
+			return
 		}
 
-		if apiKey != s.config.Server.APIKey {
-			writeError(w, http.StatusUnauthorized, "invalid or missing API key")
+		instance, err := s.keys.Instance(r.Context(), apiKey)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to validate API key")
+			return
+		}
+		if instance == nil {
+			writeError(w, http.StatusUnauthorized, "invalid API key")
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), instanceContextKey{}, instance)))
 	})
 }
 
-// instanceAuth middleware checks for valid instance API key
-func (s *Server) instanceAuth(next http.Handler) http.Handler {
+// requestInstance returns the instance authenticated by instanceAuth
+func requestInstance(r *http.Request) *types.Instance {
+	instance, _ := r.Context().Value(instanceContextKey{}).(*types.Instance)
+	return instance
+}
+
+// requestActor identifies who made a request for history and audit records
+func requestActor(r *http.Request) string {
+	if user := auth.GetUserFromContext(r.Context()); user != nil {
+		return user.Email
+	}
+	return "unknown"
+}
+
+// requireProductAccess rejects the request when its API token is restricted to other products
+func requireProductAccess(w http.ResponseWriter, r *http.Request, product string) bool {
+	if !auth.AllowsProduct(r.Context(), product) {
+		writeError(w, http.StatusForbidden, "API token is not allowed to act on "+product)
+		return false
+	}
+	return true
+}
+
+// limitBody rejects request bodies larger than Server.MaxBodySize. Artifact
+// uploads are allowed up to Uploads.MaxSize, plus room for the form fields
+// that accompany a release.
+func (s *Server) limitBody(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		apiKey := r.Header.Get("X-API-Key")
-		if apiKey == "" {
-			writeError(w, http.StatusUnauthorized, "missing API key")
-			return
+		limit := int64(s.config.Server.MaxBodySize)
+		if isArtifactUpload(r) {
+			limit += int64(s.config.Uploads.MaxSize)
 		}
 
-		// TODO: Validate instance API key against database
-		// For now, just check it's not empty
+		if r.ContentLength > limit {
+			writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
 
+// uploadDeadlines gives artifact uploads Uploads.Timeout to transfer instead
+// of the server's read and write timeouts, which suit ordinary requests. It
+// must wrap the server's own ResponseWriter to be able to move the deadlines.
+func (s *Server) uploadDeadlines(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isArtifactUpload(r) {
+			var deadline time.Time // zero means none
+			if timeout := s.config.Uploads.Timeout; timeout > 0 {
+				deadline = time.Now().Add(timeout)
+			}
+			rc := http.NewResponseController(w)
+			if err := rc.SetReadDeadline(deadline); err != nil {
+				log.Printf("Failed to extend upload read deadline: %v", err)
+			}
+			if err := rc.SetWriteDeadline(deadline); err != nil {
+				log.Printf("Failed to extend upload write deadline: %v", err)
+			}
+		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// isArtifactUpload reports whether the request carries an artifact: a
+// release form, a binary uploaded to a release, or a resumable upload chunk
+func isArtifactUpload(r *http.Request) bool {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodPost:
+		return path == "/api/v1/releases"
+	case http.MethodPut:
+		return strings.HasPrefix(path, "/api/v1/releases/") || strings.HasPrefix(path, "/api/v1/uploads/")
+	}
+	return false
+}
+
+// realIP replaces the remote address of requests from trusted proxies with
+// the client they forwarded, like chi's RealIP but without believing headers
+// sent by anyone else
+func realIP(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.RemoteAddr = clientAddr(r, trusted)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientAddr returns the IP address of the client behind a request. Proxies
+// append the address they received a request from to X-Forwarded-For, so it
+// is read from the end, and the first hop that is not a trusted proxy is the
+// client; the hops before it could have been written by the client.
+func clientAddr(r *http.Request, trusted []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err != nil || !isTrusted(peer, trusted) {
+		return host
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				// Nothing before a malformed hop can be relied on
+				break
+			}
+			peer = hop
+			if !isTrusted(hop, trusted) {
+				break
+			}
+		}
+		return peer.Unmap().String()
+	}
+
+	if client, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return client.Unmap().String()
+	}
+	return peer.Unmap().String()
+}
+
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
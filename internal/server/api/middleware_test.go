@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/auth"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database/dbtest"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/organizations"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+func TestClientAddr(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		want       string
+	}{
+		{"direct", "203.0.113.7:4000", nil, "", "203.0.113.7"},
+		// Anyone but a trusted proxy is its own client
+		{"forged forwarded for", "203.0.113.7:4000", []string{"198.51.100.1"}, "", "203.0.113.7"},
+		{"forged real IP", "203.0.113.7:4000", nil, "198.51.100.1", "203.0.113.7"},
+		{"proxied", "10.0.0.2:4000", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"proxied real IP", "10.0.0.2:4000", nil, "198.51.100.1", "198.51.100.1"},
+		// The client can prepend hops; only those added by trusted proxies count
+		{"spoofed hops", "10.0.0.2:4000", []string{"1.1.1.1, 198.51.100.1"}, "", "198.51.100.1"},
+		{"proxy chain", "10.0.0.2:4000", []string{"198.51.100.1, 192.0.2.1", "10.0.0.3"}, "", "198.51.100.1"},
+		{"only proxies", "10.0.0.2:4000", []string{"10.0.0.4, 10.0.0.3"}, "", "10.0.0.4"},
+		{"malformed hop", "10.0.0.2:4000", []string{"198.51.100.1, junk, 10.0.0.3"}, "", "10.0.0.3"},
+		{"mapped IPv4", "[::ffff:10.0.0.2]:4000", []string{"::ffff:198.51.100.1"}, "", "198.51.100.1"},
+		{"no port", "203.0.113.7", nil, "", "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := clientAddr(r, trusted); got != tt.want {
+				t.Errorf("clientAddr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadDeadlines(t *testing.T) {
+	s := &Server{config: &config.Config{Uploads: config.UploadConfig{Timeout: time.Minute}}}
+	handler := s.uploadDeadlines(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.Copy(io.Discard, r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.ReadTimeout = 50 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	// A body trickling in for longer than ReadTimeout only gets through on upload routes
+	tests := []struct {
+		method, path string
+		ok           bool
+	}{
+		{http.MethodPut, "/api/v1/uploads/abc", true},
+		{http.MethodPut, "/api/v1/releases/agent/1.0.0/agent-linux-amd64", true},
+		{http.MethodPost, "/api/v1/products", false},
+	}
+	for _, tt := range tests {
+		body, writer := io.Pipe()
+		go func() {
+			for i := 0; i < 4; i++ {
+				time.Sleep(40 * time.Millisecond)
+				writer.Write([]byte("chunk"))
+			}
+			writer.Close()
+		}()
+
+		req, _ := http.NewRequest(tt.method, server.URL+tt.path, body)
+		resp, err := server.Client().Do(req)
+		ok := err == nil && resp.StatusCode == http.StatusOK
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if ok != tt.ok {
+			t.Errorf("%s %s succeeded = %v, want %v (%v)", tt.method, tt.path, ok, tt.ok, err)
+		}
+	}
+}
+
+func TestOrganizationScope(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		ctx := context.Background()
+		authRepo := auth.NewRepository(db)
+		orgRepo := organizations.NewRepository(db)
+		s := &Server{db: db, authService: auth.NewService(authRepo, nil, "test")}
+
+		acme := &types.Organization{Slug: "acme", Name: "Acme"}
+		if err := orgRepo.Create(ctx, acme); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		// Only admins see every organization; operators and viewers are limited
+		// to the organizations they belong to, like custom roles
+		tests := []struct {
+			role   string
+			member bool
+			want   []string
+		}{
+			{auth.RoleAdmin, false, nil},
+			{auth.RoleOperator, true, []string{acme.ID}},
+			{auth.RoleOperator, false, []string{}},
+			{auth.RoleViewer, true, []string{acme.ID}},
+			{auth.RoleViewer, false, []string{}},
+		}
+		for i, tt := range tests {
+			user, err := authRepo.CreateUser(ctx, fmt.Sprintf("user%d@example.com", i), "hash", tt.role, tt.role)
+			if err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+			if tt.member {
+				if err := orgRepo.AddMember(ctx, acme.ID, user.ID); err != nil {
+					t.Fatalf("AddMember: %v", err)
+				}
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/licenses", nil)
+			r = r.WithContext(auth.SetUserInContext(r.Context(), user))
+			scope, err := s.organizationScope(r)
+			if err != nil {
+				t.Fatalf("organizationScope(%s): %v", tt.role, err)
+			}
+			if (scope == nil) != (tt.want == nil) || !slices.Equal(scope, tt.want) {
+				t.Errorf("organizationScope(%s, member %v) = %#v, want %#v", tt.role, tt.member, scope, tt.want)
+			}
+		}
+	})
+}
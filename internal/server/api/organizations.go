@@ -0,0 +1,186 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/audit"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/organizations"
+)
+
+// Organization handlers. Users whose role lacks organizations:all only see and
+// manage the organizations they are members of.
+
+func (s *Server) handleListOrganizations(w http.ResponseWriter, r *http.Request) {
+	scope, ok := s.requestScope(w, r)
+	if !ok {
+		return
+	}
+
+	svc := organizations.NewService(s.db)
+	orgs, err := svc.ListOrganizations(r.Context(), scope)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, orgs)
+}
+
+func (s *Server) handleCreateOrganization(w http.ResponseWriter, r *http.Request) {
+	var req organizations.CreateOrganizationRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if !s.requireAllOrganizations(w, r) {
+		return
+	}
+
+	svc := organizations.NewService(s.db)
+	org, err := svc.CreateOrganization(r.Context(), req)
+	if err != nil {
+		writeOrganizationError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, org)
+}
+
+func (s *Server) handleGetOrganization(w http.ResponseWriter, r *http.Request) {
+	scope, ok := s.requestScope(w, r)
+	if !ok {
+		return
+	}
+
+	svc := organizations.NewService(s.db)
+	org, err := svc.GetOrganization(r.Context(), scope, chi.URLParam(r, "id"))
+	if err != nil {
+		writeOrganizationError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, org)
+}
+
+func (s *Server) handleUpdateOrganization(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	scope, ok := s.requestScope(w, r)
+	if !ok {
+		return
+	}
+
+	svc := organizations.NewService(s.db)
+	before, _ := svc.GetOrganization(r.Context(), scope, chi.URLParam(r, "id"))
+	audit.SetBefore(r.Context(), before)
+
+	org, err := svc.RenameOrganization(r.Context(), scope, chi.URLParam(r, "id"), req.Name)
+	if err != nil {
+		writeOrganizationError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, org)
+}
+
+func (s *Server) handleDeleteOrganization(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAllOrganizations(w, r) {
+		return
+	}
+
+	svc := organizations.NewService(s.db)
+	before, _ := svc.GetOrganization(r.Context(), nil, chi.URLParam(r, "id"))
+	audit.SetBefore(r.Context(), before)
+	audit.SetAfter(r.Context(), nil)
+
+	if err := svc.DeleteOrganization(r.Context(), nil, chi.URLParam(r, "id")); err != nil {
+		writeOrganizationError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func (s *Server) handleListOrganizationMembers(w http.ResponseWriter, r *http.Request) {
+	scope, ok := s.requestScope(w, r)
+	if !ok {
+		return
+	}
+
+	svc := organizations.NewService(s.db)
+	members, err := svc.ListMembers(r.Context(), scope, chi.URLParam(r, "id"))
+	if err != nil {
+		writeOrganizationError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, members)
+}
+
+func (s *Server) handleAddOrganizationMember(w http.ResponseWriter, r *http.Request) {
+	scope, ok := s.requestScope(w, r)
+	if !ok {
+		return
+	}
+
+	svc := organizations.NewService(s.db)
+	if err := svc.AddMember(r.Context(), scope, chi.URLParam(r, "id"), chi.URLParam(r, "user")); err != nil {
+		writeOrganizationError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "added"})
+}
+
+func (s *Server) handleRemoveOrganizationMember(w http.ResponseWriter, r *http.Request) {
+	scope, ok := s.requestScope(w, r)
+	if !ok {
+		return
+	}
+
+	svc := organizations.NewService(s.db)
+	if err := svc.RemoveMember(r.Context(), scope, chi.URLParam(r, "id"), chi.URLParam(r, "user")); err != nil {
+		writeOrganizationError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "removed"})
+}
+
+// requireAllOrganizations rejects callers limited to their own organizations
+func (s *Server) requireAllOrganizations(w http.ResponseWriter, r *http.Request) bool {
+	scope, err := s.organizationScope(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to resolve organization access")
+		return false
+	}
+	if scope != nil {
+		writeError(w, http.StatusForbidden, "missing permission organizations:all")
+		return false
+	}
+	return true
+}
+
+func writeOrganizationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, organizations.ErrOrganizationNotFound), errors.Is(err, organizations.ErrMemberNotFound),
+		errors.Is(err, organizations.ErrUserNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, organizations.ErrOrganizationExists), errors.Is(err, organizations.ErrOrganizationInUse):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, organizations.ErrInvalidOrganization):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
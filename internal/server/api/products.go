@@ -0,0 +1,115 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/audit"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/products"
+)
+
+// Product registry handlers
+
+func (s *Server) handleListProducts(w http.ResponseWriter, r *http.Request) {
+	svc := products.NewService(s.db)
+	productList, err := svc.ListProducts(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, productList)
+}
+
+func (s *Server) handleGetProduct(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	svc := products.NewService(s.db)
+	product, err := svc.GetProduct(r.Context(), name)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if product == nil {
+		writeError(w, http.StatusNotFound, "product not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, product)
+}
+
+func (s *Server) handleCreateProduct(w http.ResponseWriter, r *http.Request) {
+	var req products.CreateProductRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	svc := products.NewService(s.db)
+	product, err := svc.CreateProduct(r.Context(), req)
+	if err != nil {
+		writeProductError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, product)
+}
+
+func (s *Server) handleUpdateProduct(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	var req products.UpdateProductRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	svc := products.NewService(s.db)
+	before, _ := svc.GetProduct(r.Context(), name)
+	audit.SetBefore(r.Context(), before)
+
+	product, err := svc.UpdateProduct(r.Context(), name, req)
+	if err != nil {
+		writeProductError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, product)
+}
+
+func (s *Server) handleDeleteProduct(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	svc := products.NewService(s.db)
+	before, _ := svc.GetProduct(r.Context(), name)
+	audit.SetBefore(r.Context(), before)
+	audit.SetAfter(r.Context(), nil)
+
+	if err := svc.DeleteProduct(r.Context(), name); err != nil {
+		writeProductError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// writeProductError maps product registry errors to HTTP responses
+func writeProductError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, products.ErrProductNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, products.ErrProductExists), errors.Is(err, products.ErrProductHasReleases):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, products.ErrInvalidProduct):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/audit"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/auth"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/releases"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// Release workflow handlers
+
+// handlePromoteRelease handles POST /api/v1/releases/{product}/{version}/promote
+func (s *Server) handlePromoteRelease(w http.ResponseWriter, r *http.Request) {
+	product := chi.URLParam(r, "product")
+	version := chi.URLParam(r, "version")
+
+	var req struct {
+		Channel string `json:"channel"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Channel == "" {
+		writeError(w, http.StatusBadRequest, "channel is required")
+		return
+	}
+
+	svc := s.ReleaseService()
+	before, _ := svc.GetRelease(r.Context(), product, version)
+	audit.SetBefore(r.Context(), before)
+
+	release, err := svc.PromoteRelease(r.Context(), product, version, req.Channel, requestActor(r))
+	if err != nil {
+		writeReleaseError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, release)
+}
+
+// handleYankRelease handles POST /api/v1/releases/{product}/{version}/yank
+func (s *Server) handleYankRelease(w http.ResponseWriter, r *http.Request) {
+	product := chi.URLParam(r, "product")
+	version := chi.URLParam(r, "version")
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	svc := s.ReleaseService()
+	before, _ := svc.GetRelease(r.Context(), product, version)
+	audit.SetBefore(r.Context(), before)
+
+	release, err := svc.YankRelease(r.Context(), product, version, req.Reason, requestActor(r))
+	if err != nil {
+		writeReleaseError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, release)
+}
+
+// handleUnyankRelease handles DELETE /api/v1/releases/{product}/{version}/yank
+func (s *Server) handleUnyankRelease(w http.ResponseWriter, r *http.Request) {
+	product := chi.URLParam(r, "product")
+	version := chi.URLParam(r, "version")
+
+	svc := s.ReleaseService()
+	before, _ := svc.GetRelease(r.Context(), product, version)
+	audit.SetBefore(r.Context(), before)
+
+	release, err := svc.UnyankRelease(r.Context(), product, version, requestActor(r))
+	if err != nil {
+		writeReleaseError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, release)
+}
+
+// handlePublishRelease handles POST /api/v1/releases/{product}/{version}/publish
+func (s *Server) handlePublishRelease(w http.ResponseWriter, r *http.Request) {
+	product := chi.URLParam(r, "product")
+	version := chi.URLParam(r, "version")
+
+	var req struct {
+		PublishAt *time.Time `json:"publish_at,omitempty"` // schedule for a future time
+	}
+	if err := decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	svc := s.ReleaseService()
+	before, _ := svc.GetRelease(r.Context(), product, version)
+	audit.SetBefore(r.Context(), before)
+
+	release, err := svc.PublishRelease(r.Context(), product, version, req.PublishAt, requestActor(r))
+	if err != nil {
+		writeReleaseError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, release)
+}
+
+// handleDeprecateRelease handles POST /api/v1/releases/{product}/{version}/deprecate
+func (s *Server) handleDeprecateRelease(w http.ResponseWriter, r *http.Request) {
+	s.handleReleaseStatusChange(w, r, (*releases.Service).DeprecateRelease)
+}
+
+// handleEndOfLifeRelease handles POST /api/v1/releases/{product}/{version}/eol
+func (s *Server) handleEndOfLifeRelease(w http.ResponseWriter, r *http.Request) {
+	s.handleReleaseStatusChange(w, r, (*releases.Service).EndOfLifeRelease)
+}
+
+type releaseStatusChangeFunc func(svc *releases.Service, ctx context.Context, product, version, message, actor string) (*types.Release, error)
+
+func (s *Server) handleReleaseStatusChange(w http.ResponseWriter, r *http.Request, change releaseStatusChangeFunc) {
+	product := chi.URLParam(r, "product")
+	version := chi.URLParam(r, "version")
+
+	var req struct {
+		Message string `json:"message"`
+	}
+	if err := decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	svc := s.ReleaseService()
+	before, _ := svc.GetRelease(r.Context(), product, version)
+	audit.SetBefore(r.Context(), before)
+
+	release, err := change(svc, r.Context(), product, version, req.Message, requestActor(r))
+	if err != nil {
+		writeReleaseError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, release)
+}
+
+// handleGetReleaseHistory handles GET /api/v1/releases/{product}/{version}/history
+func (s *Server) handleGetReleaseHistory(w http.ResponseWriter, r *http.Request) {
+	product := chi.URLParam(r, "product")
+	version := chi.URLParam(r, "version")
+
+	svc := s.ReleaseService()
+	release, err := svc.GetRelease(r.Context(), product, version)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if release != nil && !s.canSee(r, release) {
+		writeError(w, http.StatusNotFound, "release not found")
+		return
+	}
+
+	history, err := svc.GetReleaseHistory(r.Context(), product, version)
+	if err != nil {
+		writeReleaseError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, history)
+}
+
+// canSeeDrafts reports whether the caller may see releases that are not
+// published yet: drafts and releases scheduled for later
+func (s *Server) canSeeDrafts(r *http.Request) bool {
+	return auth.CallerHasPermission(s.authService, r, auth.PermReleasesUpload)
+}
+
+// canSee reports whether the caller may see a release
+func (s *Server) canSee(r *http.Request, release *types.Release) bool {
+	return releases.Published(release, time.Now()) || s.canSeeDrafts(r)
+}
+
+// writeReleaseError maps release workflow errors to HTTP responses
+func writeReleaseError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, releases.ErrReleaseNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, releases.ErrInvalidChannel):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, releases.ErrReleaseYanked), errors.Is(err, releases.ErrAlreadyInChannel),
+		errors.Is(err, releases.ErrInvalidTransition):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
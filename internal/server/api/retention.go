@@ -0,0 +1,146 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/products"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/releases"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/retention"
+)
+
+// Retention policy, release pin and garbage collection handlers
+
+func (s *Server) handleListRetentionPolicies(w http.ResponseWriter, r *http.Request) {
+	svc := retention.NewService(s.db, s.ReleaseService(), s.storage)
+	policies, err := svc.ListPolicies(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, policies)
+}
+
+func (s *Server) handleSetRetentionPolicy(w http.ResponseWriter, r *http.Request) {
+	product := chi.URLParam(r, "product")
+	channel := chi.URLParam(r, "channel")
+
+	var req retention.SetPolicyRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	svc := retention.NewService(s.db, s.ReleaseService(), s.storage)
+	policy, err := svc.SetPolicy(r.Context(), product, channel, req)
+	if err != nil {
+		writeRetentionError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, policy)
+}
+
+func (s *Server) handleDeleteRetentionPolicy(w http.ResponseWriter, r *http.Request) {
+	product := chi.URLParam(r, "product")
+	channel := chi.URLParam(r, "channel")
+
+	svc := retention.NewService(s.db, s.ReleaseService(), s.storage)
+	if err := svc.DeletePolicy(r.Context(), product, channel); err != nil {
+		writeRetentionError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handleRunRetentionGC applies all retention policies; pass ?dry_run=true to only report
+func (s *Server) handleRunRetentionGC(w http.ResponseWriter, r *http.Request) {
+	dryRun := false
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "dry_run must be true or false")
+			return
+		}
+		dryRun = parsed
+	}
+
+	svc := retention.NewService(s.db, s.ReleaseService(), s.storage)
+	report, err := svc.RunGC(r.Context(), dryRun)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+func (s *Server) handleListReleasePins(w http.ResponseWriter, r *http.Request) {
+	product := chi.URLParam(r, "product")
+	version := chi.URLParam(r, "version")
+
+	svc := retention.NewService(s.db, s.ReleaseService(), s.storage)
+	pins, err := svc.ListPins(r.Context(), product, version)
+	if err != nil {
+		writeRetentionError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, pins)
+}
+
+func (s *Server) handlePinRelease(w http.ResponseWriter, r *http.Request) {
+	product := chi.URLParam(r, "product")
+	version := chi.URLParam(r, "version")
+
+	var req retention.PinReleaseRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.CustomerID == "" {
+		writeError(w, http.StatusBadRequest, "customer_id is required")
+		return
+	}
+
+	svc := retention.NewService(s.db, s.ReleaseService(), s.storage)
+	pin, err := svc.PinRelease(r.Context(), product, version, req, requestActor(r))
+	if err != nil {
+		writeRetentionError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, pin)
+}
+
+func (s *Server) handleUnpinRelease(w http.ResponseWriter, r *http.Request) {
+	product := chi.URLParam(r, "product")
+	version := chi.URLParam(r, "version")
+	customerID := chi.URLParam(r, "customer")
+
+	svc := retention.NewService(s.db, s.ReleaseService(), s.storage)
+	if err := svc.UnpinRelease(r.Context(), product, version, customerID); err != nil {
+		writeRetentionError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "unpinned"})
+}
+
+func writeRetentionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, retention.ErrPolicyNotFound), errors.Is(err, retention.ErrPinNotFound),
+		errors.Is(err, releases.ErrReleaseNotFound), errors.Is(err, products.ErrProductNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, retention.ErrInvalidPolicy):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -2,15 +2,24 @@ package api
 
 import (
 	"net/http"
+	"net/netip"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/audit"
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/auth"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/commands"
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/heartbeats"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/mail"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/metrics"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/ratelimit"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/releases"
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/storage"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/tracing"
 )
 
 // Server represents the API server
@@ -21,27 +30,88 @@ type Server struct {
 	router      *chi.Mux
 	authService *auth.Service
 	authHandler *auth.Handlers
+	limiter     *ratelimit.Limiter
+	metrics     *metrics.Metrics
+	heartbeats  *heartbeats.Pipeline
+	controls    *heartbeats.Controls
+	keys        *heartbeats.Keys
+	commands    *commands.Service
+	// trustedProxies may name the client in forwarded headers
+	trustedProxies []netip.Prefix
+	// releaseCache is shared by the per-request release services
+	releaseCache *releases.Cache
 }
 
-// NewServer creates a new API server
-func NewServer(cfg *config.Config, db *database.DB, store storage.Storage) *Server {
+// NewServer creates a new API server. Access tokens are signed with keys, a
+// nil limiter disables rate limiting and nil metrics disable /metrics.
+// Heartbeats are recorded through pipeline and deliver the commands queued in
+// commandService.
+func NewServer(cfg *config.Config, db *database.DB, store storage.Storage, mailer mail.Sender, keys *auth.KeyManager, limiter *ratelimit.Limiter, m *metrics.Metrics, pipeline *heartbeats.Pipeline, commandService *commands.Service) *Server {
 	// Initialize auth
 	authRepo := auth.NewRepository(db)
-	authService := auth.NewService(authRepo, cfg.Auth.JWTSecret, cfg.Auth.Issuer)
+	authService := auth.NewService(authRepo, keys, cfg.Auth.Issuer)
+	authService.SetSessionTimeouts(cfg.Auth.SessionIdleTimeout, cfg.Auth.SessionAbsoluteTimeout)
+	if cfg.Auth.OIDC.Enabled() {
+		authService.EnableOIDC(auth.NewOIDCProvider(cfg.Auth.OIDC))
+	}
+	if cfg.Auth.WebAuthn.Enabled() {
+		authService.EnableWebAuthn(auth.NewWebAuthn(cfg.Auth.WebAuthn))
+	}
+	if mailer != nil {
+		authService.EnableMail(mailer, cfg.Mail.DashboardURL)
+	}
 	authHandlers := auth.NewHandlers(authService)
 
 	s := &Server{
-		config:      cfg,
-		db:          db,
-		storage:     store,
-		authService: authService,
-		authHandler: authHandlers,
+		config:       cfg,
+		db:           db,
+		storage:      store,
+		authService:  authService,
+		authHandler:  authHandlers,
+		limiter:      limiter,
+		metrics:      m,
+		heartbeats:   pipeline,
+		controls:     heartbeats.NewControls(db, cfg.Heartbeats.ReleaseCacheTTL),
+		keys:         heartbeats.NewKeys(db, cfg.Heartbeats.ReleaseCacheTTL),
+		commands:     commandService,
+		releaseCache: releases.NewCache(cfg.Heartbeats.ReleaseCacheTTL),
 	}
 
+	// Validated with the rest of the configuration at startup
+	s.trustedProxies, _ = cfg.Server.TrustedProxyPrefixes()
+
 	s.setupRoutes()
 	return s
 }
 
+// ReleaseService creates a release service using the server's release cache.
+// Background jobs that change releases use it so their changes apply at once.
+func (s *Server) ReleaseService() *releases.Service {
+	svc := releases.NewService(s.db, s.storage)
+	svc.EnableCache(s.releaseCache)
+	return svc
+}
+
+// auditSkip lists mutating routes left out of the audit log: sign-in flows,
+// which carry credentials and are recorded in the auth audit log, and
+// high-volume traffic from updaters and upload chunks
+var auditSkip = map[string]bool{
+	"POST /api/v1/auth/login":                true,
+	"POST /api/v1/auth/mfa/verify":           true,
+	"POST /api/v1/auth/mfa/webauthn/options": true,
+	"POST /api/v1/auth/refresh":              true,
+	"POST /api/v1/auth/logout":               true,
+	"POST /api/v1/auth/logout-all":           true,
+	"POST /api/v1/auth/password/forgot":      true,
+	"POST /api/v1/auth/password/reset":       true,
+	"POST /api/v1/auth/email/verify":         true,
+	"POST /api/v1/auth/oidc/token":           true,
+	"POST /api/v1/heartbeat":                 true,
+	"POST /api/v1/heartbeat/batch":           true,
+	"POST /api/v1/license/validate":          true,
+	"PUT /api/v1/uploads/{id}":               true,
+}
+
 // Router returns the HTTP router
 func (s *Server) Router() http.Handler {
 	return s.router
@@ -51,26 +121,42 @@ func (s *Server) Router() http.Handler {
 func (s *Server) setupRoutes() {
 	r := chi.NewRouter()
 
-	// Middleware
+	// Middleware. Upload deadlines come first, before anything wraps the ResponseWriter.
+	r.Use(s.uploadDeadlines)
+	r.Use(tracing.Middleware)
+	r.Use(s.metrics.Middleware)
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(realIP(s.trustedProxies))
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Compress(5))
 
-	// CORS
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   s.config.Server.CORSOrigins,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-API-Key"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: true,
-		MaxAge:           300,
-	}))
+	r.Use(s.limitBody)
+
+	// CORS, for dashboards served from another origin. The cors package
+	// treats an empty list as every origin, so none skips it entirely.
+	if len(s.config.Server.CORSOrigins) > 0 {
+		r.Use(cors.Handler(cors.Options{
+			AllowedOrigins:   s.config.Server.CORSOrigins,
+			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-API-Key", "Upload-Offset"},
+			ExposedHeaders:   []string{"Link", "Location", "Upload-Offset", "Retry-After"},
+			AllowCredentials: s.config.Server.CORSAllowCredentials,
+			MaxAge:           300,
+		}))
+	}
 
 	// Health check (no auth)
 	r.Get("/health", s.handleHealth)
 
+	// Prometheus metrics, unless they are served on a separate address
+	if s.metrics != nil && s.config.Telemetry.MetricsAddr == "" {
+		r.With(s.requirePermission(auth.PermMetricsRead)).Get("/metrics", s.metrics.Handler().ServeHTTP)
+	}
+
+	// Public keys that verify access tokens
+	r.Get("/.well-known/jwks.json", s.authHandler.HandleJWKS)
+
 	// Direct binary download routes (Siemcore installer format)
 	// Supports: /{product}/{version}/{filename}
 	// Example: /siemcore/v1.5.0/siemcore-linux-amd64
@@ -78,15 +164,30 @@ func (s *Server) setupRoutes() {
 
 	// API v1 routes
 	r.Route("/api/v1", func(r chi.Router) {
+		// Record mutating calls in the administrative audit log
+		r.Use(audit.Middleware(audit.NewService(s.db), auditSkip))
+
 		// =====================
 		// Authentication routes (public)
 		// =====================
 		r.Route("/auth", func(r chi.Router) {
-			r.Post("/login", s.authHandler.HandleLogin)
-			r.Post("/mfa/verify", s.authHandler.HandleMFAVerify)
+			// Credential checks share one per-IP limit against guessing and stuffing
+			r.Group(func(r chi.Router) {
+				r.Use(s.limiter.Middleware(ratelimit.Rule{Name: "login", Scope: ratelimit.ScopeIP, Limit: s.config.RateLimit.Login}))
+				r.Post("/login", s.authHandler.HandleLogin)
+				r.Post("/mfa/verify", s.authHandler.HandleMFAVerify)
+				r.Post("/mfa/webauthn/options", s.authHandler.HandleWebAuthnLoginOptions)
+				r.Post("/password/forgot", s.authHandler.HandleForgotPassword)
+				r.Post("/password/reset", s.authHandler.HandleResetPassword)
+				r.Post("/email/verify", s.authHandler.HandleVerifyEmail)
+				r.Post("/oidc/token", s.authHandler.HandleOIDCToken)
+			})
 			r.Post("/refresh", s.authHandler.HandleRefresh)
+			r.Get("/oidc", s.authHandler.HandleOIDCStatus)
+			r.Get("/oidc/login", s.authHandler.HandleOIDCLogin)
+			r.Get("/oidc/callback", s.authHandler.HandleOIDCCallback)
 
-			// Protected auth routes
+			// Self-service routes - any signed-in user
 			r.Group(func(r chi.Router) {
 				r.Use(auth.JWTMiddleware(s.authService))
 				r.Post("/logout", s.authHandler.HandleLogout)
@@ -94,11 +195,22 @@ func (s *Server) setupRoutes() {
 				r.Get("/profile", s.authHandler.HandleGetProfile)
 				r.Put("/profile", s.authHandler.HandleUpdateProfile)
 				r.Post("/password", s.authHandler.HandleChangePassword)
+				r.Post("/email/verification", s.authHandler.HandleSendEmailVerification)
+				r.Post("/oidc/link", s.authHandler.HandleOIDCLink)
 				r.Get("/mfa/setup", s.authHandler.HandleMFASetup)
 				r.Post("/mfa/enable", s.authHandler.HandleMFAEnable)
 				r.Post("/mfa/disable", s.authHandler.HandleMFADisable)
+				r.Post("/webauthn/register/begin", s.authHandler.HandleWebAuthnRegisterBegin)
+				r.Post("/webauthn/register/finish", s.authHandler.HandleWebAuthnRegisterFinish)
+				r.Get("/webauthn/credentials", s.authHandler.HandleListWebAuthnCredentials)
+				r.Put("/webauthn/credentials/{id}", s.authHandler.HandleRenameWebAuthnCredential)
+				r.Delete("/webauthn/credentials/{id}", s.authHandler.HandleDeleteWebAuthnCredential)
 				r.Get("/sessions", s.authHandler.HandleGetSessions)
+				r.Delete("/sessions/{id}", s.authHandler.HandleRevokeSession)
 				r.Get("/audit", s.authHandler.HandleGetAuditLog)
+				r.Get("/tokens", s.authHandler.HandleListAPITokens)
+				r.Post("/tokens", s.authHandler.HandleCreateAPIToken)
+				r.Delete("/tokens/{id}", s.authHandler.HandleRevokeAPIToken)
 			})
 		})
 
@@ -106,6 +218,10 @@ func (s *Server) setupRoutes() {
 		// License endpoints (public for activation)
 		// =====================
 		r.Route("/license", func(r chi.Router) {
+			r.Use(s.limiter.Middleware(
+				ratelimit.Rule{Name: "license", Scope: ratelimit.ScopeIP, Limit: s.config.RateLimit.License},
+				ratelimit.Rule{Name: "license", Scope: ratelimit.ScopeLicenseKey, Limit: s.config.RateLimit.LicenseKey},
+			))
 			r.Post("/activate", s.handleLicenseActivate)
 			r.Post("/validate", s.handleLicenseValidate)
 		})
@@ -119,47 +235,141 @@ func (s *Server) setupRoutes() {
 			r.Get("/{product}/latest", s.handleGetLatestRelease)
 			r.Get("/{product}/{version}", s.handleGetRelease)
 			r.Get("/{product}/{version}/download", s.handleDownloadRelease)
+			r.Get("/{product}/{version}/history", s.handleGetReleaseHistory)
 			// Protected: upload releases
-			r.With(s.adminAuth).Post("/", s.handleUploadRelease)
-			r.With(s.adminAuth).Put("/{product}/{version}/{filename}", s.handleUploadBinary)
+			r.With(s.requirePermission(auth.PermReleasesUpload)).Post("/", s.handleUploadRelease)
+			r.With(s.requirePermission(auth.PermReleasesUpload)).Put("/{product}/{version}/{filename}", s.handleUploadBinary)
+			// Protected: lifecycle, channel promotion and yanking
+			r.With(s.requirePermission(auth.PermReleasesPublish)).Post("/{product}/{version}/publish", s.handlePublishRelease)
+			r.With(s.requirePermission(auth.PermReleasesPublish)).Post("/{product}/{version}/deprecate", s.handleDeprecateRelease)
+			r.With(s.requirePermission(auth.PermReleasesPublish)).Post("/{product}/{version}/eol", s.handleEndOfLifeRelease)
+			r.With(s.requirePermission(auth.PermReleasesPublish)).Post("/{product}/{version}/promote", s.handlePromoteRelease)
+			r.With(s.requirePermission(auth.PermReleasesPublish)).Post("/{product}/{version}/yank", s.handleYankRelease)
+			r.With(s.requirePermission(auth.PermReleasesPublish)).Delete("/{product}/{version}/yank", s.handleUnyankRelease)
+			// Protected: customer pins that exempt a release from garbage collection
+			r.With(s.requirePermission(auth.PermReleasesPublish)).Get("/{product}/{version}/pins", s.handleListReleasePins)
+			r.With(s.requirePermission(auth.PermReleasesPublish)).Post("/{product}/{version}/pins", s.handlePinRelease)
+			r.With(s.requirePermission(auth.PermReleasesPublish)).Delete("/{product}/{version}/pins/{customer}", s.handleUnpinRelease)
 		})
 
 		// =====================
-		// Heartbeat endpoint (from updaters)
+		// Resumable uploads
 		// =====================
-		r.Post("/heartbeat", s.handleHeartbeat)
+		r.Route("/uploads", func(r chi.Router) {
+			r.Use(s.requirePermission(auth.PermReleasesUpload))
+			r.Post("/", s.handleCreateUpload)
+			r.Get("/{id}", s.handleGetUpload)
+			r.Put("/{id}", s.handleUploadChunk)
+			r.Post("/{id}/complete", s.handleCompleteUpload)
+			r.Delete("/{id}", s.handleAbortUpload)
+		})
+
+		// =====================
+		// Product registry
+		// =====================
+		r.Route("/products", func(r chi.Router) {
+			r.Get("/", s.handleListProducts)
+			r.Get("/{name}", s.handleGetProduct)
+			r.With(s.requirePermission(auth.PermProductsWrite)).Post("/", s.handleCreateProduct)
+			r.With(s.requirePermission(auth.PermProductsWrite)).Put("/{name}", s.handleUpdateProduct)
+			r.With(s.requirePermission(auth.PermProductsWrite)).Delete("/{name}", s.handleDeleteProduct)
+		})
+
+		// =====================
+		// Heartbeat endpoint (from updaters, authenticated by instance API key)
+		// =====================
+		r.With(s.limiter.Middleware(ratelimit.Rule{Name: "heartbeat", Scope: ratelimit.ScopeIP, Limit: s.config.RateLimit.Heartbeat}), s.instanceAuth).
+			Post("/heartbeat", s.handleHeartbeat)
+		r.With(s.limiter.Middleware(ratelimit.Rule{Name: "heartbeat", Scope: ratelimit.ScopeIP, Limit: s.config.RateLimit.Heartbeat}), s.instanceAuth).
+			Post("/heartbeat/batch", s.handleHeartbeatBatch)
 
 		// =====================
 		// Instance endpoints
 		// =====================
 		r.Route("/instances", func(r chi.Router) {
-			// Read endpoints - require JWT auth for dashboard
-			r.With(auth.OptionalJWTMiddleware(s.authService)).Get("/", s.handleListInstances)
-			r.With(auth.OptionalJWTMiddleware(s.authService)).Get("/{id}", s.handleGetInstance)
-			// Delete requires admin
-			r.With(auth.JWTMiddleware(s.authService), auth.RequireRole("admin")).Delete("/{id}", s.handleDeleteInstance)
+			r.With(s.requirePermission(auth.PermInstancesRead)).Get("/", s.handleListInstances)
+			r.With(s.requirePermission(auth.PermInstancesRead)).Get("/{id}", s.handleGetInstance)
+			r.With(s.requirePermission(auth.PermInstancesRead)).Get("/{id}/alerts", s.handleListInstanceAlerts)
+			r.With(s.requirePermission(auth.PermInstancesRead)).Get("/{id}/control", s.handleGetInstanceControl)
+			r.With(s.requirePermission(auth.PermInstancesManage)).Put("/{id}/control", s.handleSetInstanceControl)
+			r.With(s.requirePermission(auth.PermInstancesRead)).Get("/{id}/commands", s.handleListInstanceCommands)
+			r.With(s.requirePermission(auth.PermInstancesCommand)).Post("/{id}/commands", s.handleCreateInstanceCommand)
+			r.With(s.requirePermission(auth.PermInstancesCommand)).Delete("/{id}/commands/{command}", s.handleCancelInstanceCommand)
+			r.With(s.requirePermission(auth.PermInstancesDelete)).Delete("/{id}", s.handleDeleteInstance)
+		})
+
+		// =====================
+		// Organizations
+		// =====================
+		r.Route("/organizations", func(r chi.Router) {
+			r.With(s.requirePermission(auth.PermOrganizationsRead)).Get("/", s.handleListOrganizations)
+			r.With(s.requirePermission(auth.PermOrganizationsWrite)).Post("/", s.handleCreateOrganization)
+			r.With(s.requirePermission(auth.PermOrganizationsRead)).Get("/{id}", s.handleGetOrganization)
+			r.With(s.requirePermission(auth.PermOrganizationsWrite)).Put("/{id}", s.handleUpdateOrganization)
+			r.With(s.requirePermission(auth.PermOrganizationsWrite)).Delete("/{id}", s.handleDeleteOrganization)
+			r.With(s.requirePermission(auth.PermOrganizationsRead)).Get("/{id}/members", s.handleListOrganizationMembers)
+			r.With(s.requirePermission(auth.PermOrganizationsWrite)).Put("/{id}/members/{user}", s.handleAddOrganizationMember)
+			r.With(s.requirePermission(auth.PermOrganizationsWrite)).Delete("/{id}/members/{user}", s.handleRemoveOrganizationMember)
 		})
 
 		// =====================
 		// Admin endpoints
 		// =====================
 		r.Route("/admin", func(r chi.Router) {
-			// License management - read is public for dashboard, write requires JWT admin
-			r.Get("/licenses", s.handleListLicenses)
-			r.Get("/licenses/{id}", s.handleGetLicense)
-			r.With(auth.JWTMiddleware(s.authService), auth.RequireRole("admin")).Post("/licenses", s.handleCreateLicense)
-			r.With(auth.JWTMiddleware(s.authService), auth.RequireRole("admin")).Put("/licenses/{id}", s.handleUpdateLicense)
-			r.With(auth.JWTMiddleware(s.authService), auth.RequireRole("admin")).Delete("/licenses/{id}", s.handleDeleteLicense)
-
-			// User management - requires JWT admin
+			// License management
+			r.With(s.requirePermission(auth.PermLicensesRead)).Get("/licenses", s.handleListLicenses)
+			r.With(s.requirePermission(auth.PermLicensesRead)).Get("/licenses/{id}", s.handleGetLicense)
+			r.With(s.requirePermission(auth.PermLicensesWrite)).Post("/licenses", s.handleCreateLicense)
+			r.With(s.requirePermission(auth.PermLicensesWrite)).Put("/licenses/{id}", s.handleUpdateLicense)
+			r.With(s.requirePermission(auth.PermLicensesWrite)).Delete("/licenses/{id}", s.handleDeleteLicense)
+
+			// User management
+			r.With(s.requirePermission(auth.PermUsersRead)).Get("/users", s.authHandler.HandleListUsers)
+			r.With(s.requirePermission(auth.PermUsersWrite)).Post("/users", s.authHandler.HandleCreateUser)
+			r.With(s.requirePermission(auth.PermUsersRead)).Get("/users/{id}", s.authHandler.HandleGetUser)
+			r.With(s.requirePermission(auth.PermUsersWrite)).Put("/users/{id}", s.authHandler.HandleUpdateUser)
+			r.With(s.requirePermission(auth.PermUsersWrite)).Delete("/users/{id}", s.authHandler.HandleDeleteUser)
+			r.With(s.requirePermission(auth.PermUsersRead)).Get("/users/{id}/sessions", s.authHandler.HandleListUserSessions)
+			r.With(s.requirePermission(auth.PermUsersWrite)).Delete("/users/{id}/sessions", s.authHandler.HandleAdminRevokeUserSessions)
+			r.With(s.requirePermission(auth.PermUsersWrite)).Delete("/users/{id}/sessions/{session}", s.authHandler.HandleAdminRevokeSession)
+
+			// Roles and permissions
+			r.With(s.requirePermission(auth.PermUsersRead)).Get("/permissions", s.authHandler.HandleListPermissions)
+			r.With(s.requirePermission(auth.PermUsersRead)).Get("/roles", s.authHandler.HandleListRoles)
+			r.With(s.requirePermission(auth.PermUsersRead)).Get("/roles/{name}", s.authHandler.HandleGetRole)
+			r.With(s.requirePermission(auth.PermRolesManage)).Post("/roles", s.authHandler.HandleCreateRole)
+			r.With(s.requirePermission(auth.PermRolesManage)).Put("/roles/{name}", s.authHandler.HandleUpdateRole)
+			r.With(s.requirePermission(auth.PermRolesManage)).Delete("/roles/{name}", s.authHandler.HandleDeleteRole)
+
+			// Service accounts and API tokens
 			r.Group(func(r chi.Router) {
-				r.Use(auth.JWTMiddleware(s.authService))
-				r.Use(auth.RequireRole("admin"))
-				r.Get("/users", s.authHandler.HandleListUsers)
-				r.Post("/users", s.authHandler.HandleCreateUser)
-				r.Get("/users/{id}", s.authHandler.HandleGetUser)
-				r.Put("/users/{id}", s.authHandler.HandleUpdateUser)
-				r.Delete("/users/{id}", s.authHandler.HandleDeleteUser)
+				r.Use(s.requirePermission(auth.PermTokensManage))
+				r.Get("/service-accounts", s.authHandler.HandleListServiceAccounts)
+				r.Post("/service-accounts", s.authHandler.HandleCreateServiceAccount)
+				r.Post("/service-accounts/{id}/tokens", s.authHandler.HandleCreateServiceAccountToken)
+				r.Get("/tokens", s.authHandler.HandleListAllAPITokens)
+				r.Delete("/tokens/{id}", s.authHandler.HandleAdminRevokeAPIToken)
+			})
+
+			// Administrative audit log
+			r.With(s.requirePermission(auth.PermAuditRead)).Get("/audit", s.handleListAudit)
+			r.With(s.requirePermission(auth.PermAuditRead)).Get("/audit/export", s.handleExportAudit)
+			r.With(s.requirePermission(auth.PermAuditRead)).Get("/audit/verify", s.handleVerifyAudit)
+
+			// Access token signing keys
+			r.Group(func(r chi.Router) {
+				r.Use(s.requirePermission(auth.PermKeysManage))
+				r.Get("/signing-keys", s.authHandler.HandleListSigningKeys)
+				r.Post("/signing-keys/rotate", s.authHandler.HandleRotateSigningKey)
+			})
+
+			// Artifact retention
+			r.Group(func(r chi.Router) {
+				r.Use(s.requirePermission(auth.PermRetentionManage))
+				r.Get("/retention/policies", s.handleListRetentionPolicies)
+				r.Put("/retention/policies/{product}/{channel}", s.handleSetRetentionPolicy)
+				r.Delete("/retention/policies/{product}/{channel}", s.handleDeleteRetentionPolicy)
+				r.Post("/retention/gc", s.handleRunRetentionGC)
 			})
 		})
 	})
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/products"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/releases"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/storage"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/uploads"
+)
+
+// Resumable upload handlers
+//
+// Protocol:
+//   POST   /api/v1/uploads                 create a session for product, version, filename and size
+//   PUT    /api/v1/uploads/{id}            append a chunk; the Upload-Offset header must equal received_bytes
+//   GET    /api/v1/uploads/{id}            get received_bytes to resume an interrupted upload
+//   POST   /api/v1/uploads/{id}/complete   verify {"sha256": "..."} and store the artifact
+//   DELETE /api/v1/uploads/{id}            abort and discard the upload
+
+func (s *Server) handleCreateUpload(w http.ResponseWriter, r *http.Request) {
+	var req uploads.CreateSessionRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if !requireProductAccess(w, r, req.Product) {
+		return
+	}
+
+	svc := uploads.NewService(s.db, s.storage, s.config.Uploads)
+	session, err := svc.CreateSession(r.Context(), req, requestActor(r))
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/uploads/"+session.ID)
+	writeJSON(w, http.StatusCreated, session)
+}
+
+func (s *Server) handleGetUpload(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	svc := uploads.NewService(s.db, s.storage, s.config.Uploads)
+	session, err := svc.GetSession(r.Context(), id)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+	if !requireProductAccess(w, r, session.ProductName) {
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.ReceivedBytes, 10))
+	writeJSON(w, http.StatusOK, session)
+}
+
+func (s *Server) handleUploadChunk(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	defer r.Body.Close()
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		writeError(w, http.StatusBadRequest, "Upload-Offset header is required")
+		return
+	}
+
+	svc := uploads.NewService(s.db, s.storage, s.config.Uploads)
+	if !s.requireUploadAccess(w, r, svc, id) {
+		return
+	}
+
+	session, err := svc.WriteChunk(r.Context(), id, offset, r.Body)
+	if session != nil {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(session.ReceivedBytes, 10))
+	}
+	if err != nil {
+		if errors.Is(err, uploads.ErrOffsetMismatch) && session != nil {
+			writeJSON(w, http.StatusConflict, map[string]interface{}{
+				"error":          err.Error(),
+				"received_bytes": session.ReceivedBytes,
+			})
+			return
+		}
+		writeUploadError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, session)
+}
+
+func (s *Server) handleCompleteUpload(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var req struct {
+		SHA256 string `json:"sha256"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	svc := uploads.NewService(s.db, s.storage, s.config.Uploads)
+	if !s.requireUploadAccess(w, r, svc, id) {
+		return
+	}
+
+	result, err := svc.Complete(r.Context(), id, req.SHA256)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+	if result.Release != nil {
+		s.releaseCache.Invalidate(result.Release.ProductName)
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) handleAbortUpload(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	svc := uploads.NewService(s.db, s.storage, s.config.Uploads)
+	if !s.requireUploadAccess(w, r, svc, id) {
+		return
+	}
+
+	if err := svc.Abort(r.Context(), id); err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "aborted"})
+}
+
+// requireUploadAccess checks that the request's API token may act on the session's product
+func (s *Server) requireUploadAccess(w http.ResponseWriter, r *http.Request, svc *uploads.Service, id string) bool {
+	session, err := svc.GetSession(r.Context(), id)
+	if err != nil {
+		writeUploadError(w, err)
+		return false
+	}
+	return requireProductAccess(w, r, session.ProductName)
+}
+
+func writeUploadError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, uploads.ErrSessionNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, products.ErrProductNotFound):
+		writeError(w, http.StatusBadRequest, "unknown product: register it under /api/v1/products first")
+	case errors.Is(err, uploads.ErrInvalidUpload), errors.Is(err, uploads.ErrChecksumMismatch),
+		errors.Is(err, releases.ErrInvalidChannel):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, uploads.ErrTooLarge), errors.Is(err, uploads.ErrChunkTooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, uploads.ErrSessionCompleted), errors.Is(err, uploads.ErrIncomplete),
+		errors.Is(err, uploads.ErrOffsetMismatch), errors.Is(err, releases.ErrReleaseNotDraft),
+		errors.Is(err, releases.ErrReleaseExists), errors.Is(err, storage.ErrArtifactExists):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,258 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// maxCapturedResponse bounds how much of a response body is kept as the "after" snapshot
+const maxCapturedResponse = 64 << 10
+
+type contextKey struct{}
+
+// recorder collects what handlers and auth middleware learn about a request.
+// It is shared through the request context, so values set by inner handlers
+// reach the audit middleware after they return.
+type recorder struct {
+	mu         sync.Mutex
+	actorType  string
+	actorID    string
+	actorEmail string
+	tokenID    string
+	targetType string
+	targetID   string
+	before     interface{}
+	after      interface{}
+	afterSet   bool
+	skip       bool
+	force      bool
+}
+
+func fromContext(ctx context.Context) *recorder {
+	rec, _ := ctx.Value(contextKey{}).(*recorder)
+	return rec
+}
+
+// SetActor records who made the request. token is nil for user access tokens.
+func SetActor(ctx context.Context, user *types.User, token *types.APIToken) {
+	rec := fromContext(ctx)
+	if rec == nil || user == nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.actorType = ActorUser
+	rec.actorID = user.ID
+	rec.actorEmail = user.Email
+	if token != nil {
+		rec.actorType = ActorAPIToken
+		rec.tokenID = token.ID
+	}
+}
+
+// SetTarget records the object a request acted on, replacing the one derived from the route
+func SetTarget(ctx context.Context, targetType, targetID string) {
+	rec := fromContext(ctx)
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.targetType = targetType
+	rec.targetID = targetID
+}
+
+// SetBefore records the target's state before the change
+func SetBefore(ctx context.Context, before interface{}) {
+	rec := fromContext(ctx)
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.before = before
+}
+
+// SetAfter records the target's state after the change. Without it the JSON
+// response body is used.
+func SetAfter(ctx context.Context, after interface{}) {
+	rec := fromContext(ctx)
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.after = after
+	rec.afterSet = true
+}
+
+// Skip leaves the current request out of the audit log
+func Skip(ctx context.Context) {
+	rec := fromContext(ctx)
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.skip = true
+}
+
+// Force records the current request even if its route is skipped, e.g. when
+// it was rejected for abuse
+func Force(ctx context.Context) {
+	rec := fromContext(ctx)
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.force = true
+}
+
+// Middleware records every POST, PUT, PATCH and DELETE request, including
+// rejected ones. Requests whose route pattern is in skip are not recorded
+// unless a handler calls Force.
+func Middleware(service *Service, skip map[string]bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &recorder{actorType: ActorAnonymous}
+			body := &limitedBuffer{limit: maxCapturedResponse}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(body)
+
+			next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), contextKey{}, rec)))
+
+			pattern := ""
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				pattern = rctx.RoutePattern()
+			}
+			action := r.Method + " " + pattern
+
+			rec.mu.Lock()
+			defer rec.mu.Unlock()
+			if rec.skip || (skip[action] && !rec.force) {
+				return
+			}
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			entry := &types.AuditEntry{
+				ActorType:  rec.actorType,
+				ActorID:    rec.actorID,
+				ActorEmail: rec.actorEmail,
+				TokenID:    rec.tokenID,
+				Action:     action,
+				TargetType: rec.targetType,
+				TargetID:   rec.targetID,
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				Status:     status,
+				IPAddress:  clientIP(r),
+				UserAgent:  r.UserAgent(),
+				RequestID:  middleware.GetReqID(r.Context()),
+			}
+
+			// Successful JSON responses describe the target after the change
+			after := rec.after
+			if !rec.afterSet && status < 300 && !body.overflow &&
+				strings.HasPrefix(ww.Header().Get("Content-Type"), "application/json") && body.Len() > 0 {
+				after = body.Bytes()
+			}
+			if entry.TargetType == "" {
+				entry.TargetType, entry.TargetID = routeTarget(r, pattern)
+			}
+			if entry.TargetID == "" {
+				entry.TargetID = responseID(after)
+			}
+
+			if err := service.Record(context.WithoutCancel(r.Context()), entry, rec.before, after); err != nil {
+				log.Printf("Failed to record audit entry for %s %s: %v", r.Method, r.URL.Path, err)
+			}
+		})
+	}
+}
+
+// routeTarget derives the target from the route: its first fixed segment after
+// /api/v1 (and /admin) and its URL parameters
+func routeTarget(r *http.Request, pattern string) (string, string) {
+	var targetType string
+	for _, segment := range strings.Split(strings.TrimPrefix(pattern, "/api/v1"), "/") {
+		if segment == "" || segment == "admin" || strings.HasPrefix(segment, "{") {
+			continue
+		}
+		targetType = segment
+		break
+	}
+
+	var params []string
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		for i, key := range rctx.URLParams.Keys {
+			if key != "*" && i < len(rctx.URLParams.Values) {
+				params = append(params, rctx.URLParams.Values[i])
+			}
+		}
+	}
+
+	return targetType, strings.Join(params, "/")
+}
+
+// responseID returns the "id" field of a JSON object snapshot
+func responseID(after interface{}) string {
+	data, ok := after.([]byte)
+	if !ok {
+		return ""
+	}
+	value, err := decode(data)
+	if err != nil {
+		return ""
+	}
+	if fields, ok := value.(map[string]interface{}); ok {
+		if id, ok := fields["id"].(string); ok {
+			return id
+		}
+	}
+	return ""
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// limitedBuffer keeps up to limit bytes and notes whether more were written
+type limitedBuffer struct {
+	bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.overflow || b.Len()+len(p) > b.limit {
+		b.overflow = true
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
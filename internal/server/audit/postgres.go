@@ -0,0 +1,133 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// chainLockKey is the advisory lock that serializes appends to the hash chain
+const chainLockKey = 0x61756469 // "audi"
+
+// PostgresRepository stores the audit log in PostgreSQL
+type PostgresRepository struct {
+	db *database.DB
+}
+
+// NewPostgresRepository creates a repository backed by PostgreSQL
+func NewPostgresRepository(db *database.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+const entryColumns = `id, actor_type, COALESCE(actor_id, ''), COALESCE(actor_email, ''), COALESCE(token_id, ''),
+	action, COALESCE(target_type, ''), COALESCE(target_id, ''), method, path, status,
+	before::text, after::text, changes::text, COALESCE(ip_address, ''), COALESCE(user_agent, ''),
+	COALESCE(request_id, ''), created_at, prev_hash, hash`
+
+// Append links an entry to the end of the chain and stores it. It assigns the
+// entry's ID, PrevHash and Hash.
+func (r *PostgresRepository) Append(ctx context.Context, entry *types.AuditEntry) error {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, chainLockKey); err != nil {
+		return fmt.Errorf("failed to lock audit log: %w", err)
+	}
+
+	var lastID int64
+	var lastHash string
+	err = tx.QueryRow(ctx, `SELECT id, hash FROM audit_log ORDER BY id DESC LIMIT 1`).Scan(&lastID, &lastHash)
+	if err != nil && err != pgx.ErrNoRows {
+		return fmt.Errorf("failed to read audit log head: %w", err)
+	}
+
+	entry.ID = lastID + 1
+	entry.PrevHash = lastHash
+	entry.Hash = computeHash(entry)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO audit_log (id, actor_type, actor_id, actor_email, token_id, action, target_type, target_id,
+			method, path, status, before, after, changes, ip_address, user_agent, request_id, created_at,
+			prev_hash, hash)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), $6, NULLIF($7, ''), NULLIF($8, ''),
+			$9, $10, $11, $12::json, $13::json, $14::json, NULLIF($15, ''), NULLIF($16, ''), NULLIF($17, ''), $18,
+			$19, $20)
+	`, entry.ID, entry.ActorType, entry.ActorID, entry.ActorEmail, entry.TokenID, entry.Action,
+		entry.TargetType, entry.TargetID, entry.Method, entry.Path, entry.Status,
+		jsonText(entry.Before), jsonText(entry.After), jsonText(entry.Changes),
+		entry.IPAddress, entry.UserAgent, entry.RequestID, entry.CreatedAt, entry.PrevHash, entry.Hash)
+	if err != nil {
+		return fmt.Errorf("failed to append audit entry: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// List returns a page of entries matching filter, newest first, and the number of matches
+func (r *PostgresRepository) List(ctx context.Context, filter types.AuditFilter, limit, offset int) ([]types.AuditEntry, int64, error) {
+	where, args := filterClause(filter, database.DriverPostgres)
+
+	var total int64
+	if err := r.db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM audit_log WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit entries: %w", err)
+	}
+
+	args = append(args, limit, offset)
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT `+entryColumns+`
+		FROM audit_log
+		WHERE `+where+`
+		ORDER BY id DESC
+		LIMIT $`+strconv.Itoa(len(args)-1)+` OFFSET $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []types.AuditEntry{}
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, *entry)
+	}
+
+	return entries, total, rows.Err()
+}
+
+// Each calls fn for every entry matching filter, oldest first, without loading
+// them all into memory
+func (r *PostgresRepository) Each(ctx context.Context, filter types.AuditFilter, fn func(*types.AuditEntry) error) error {
+	where, args := filterClause(filter, database.DriverPostgres)
+
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT `+entryColumns+`
+		FROM audit_log
+		WHERE `+where+`
+		ORDER BY id ASC`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to read audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,105 @@
+package audit
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// Repository handles audit log database operations
+type Repository interface {
+	// Append links an entry to the end of the chain and stores it. It assigns the
+	// entry's ID, PrevHash and Hash.
+	Append(ctx context.Context, entry *types.AuditEntry) error
+	// List returns a page of entries matching filter, newest first, and the number of matches
+	List(ctx context.Context, filter types.AuditFilter, limit, offset int) ([]types.AuditEntry, int64, error)
+	// Each calls fn for every entry matching filter, oldest first, without loading
+	// them all into memory
+	Each(ctx context.Context, filter types.AuditFilter, fn func(*types.AuditEntry) error) error
+}
+
+// NewRepository creates an audit repository for the configured database
+func NewRepository(db *database.DB) Repository {
+	if db.Driver == database.DriverSQLite {
+		return NewSQLiteRepository(db)
+	}
+	return NewPostgresRepository(db)
+}
+
+func scanEntry(row database.Row) (*types.AuditEntry, error) {
+	var entry types.AuditEntry
+	var before, after, changes *string
+	err := row.Scan(
+		&entry.ID, &entry.ActorType, &entry.ActorID, &entry.ActorEmail, &entry.TokenID,
+		&entry.Action, &entry.TargetType, &entry.TargetID, &entry.Method, &entry.Path, &entry.Status,
+		&before, &after, &changes, &entry.IPAddress, &entry.UserAgent,
+		&entry.RequestID, &entry.CreatedAt, &entry.PrevHash, &entry.Hash,
+	)
+	if err != nil {
+		return nil, err
+	}
+	entry.CreatedAt = entry.CreatedAt.UTC()
+	entry.Before = rawJSON(before)
+	entry.After = rawJSON(after)
+	entry.Changes = rawJSON(changes)
+	return &entry, nil
+}
+
+func rawJSON(value *string) []byte {
+	if value == nil {
+		return nil
+	}
+	return []byte(*value)
+}
+
+func jsonText(value []byte) *string {
+	if len(value) == 0 {
+		return nil
+	}
+	text := string(value)
+	return &text
+}
+
+// filterClause builds the WHERE clause for a filter in the given driver's dialect
+func filterClause(filter types.AuditFilter, driver string) (string, []interface{}) {
+	// SQLite's LIKE is already case-insensitive and its JSON columns are text
+	like, text := "ILIKE", "::text"
+	if driver == database.DriverSQLite {
+		like, text = "LIKE", ""
+	}
+
+	conditions := []string{"TRUE"}
+	var args []interface{}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(args))))
+	}
+
+	if filter.Actor != "" {
+		add(`(actor_email `+like+` ? OR actor_id = ?)`, filter.Actor)
+	}
+	if filter.Action != "" {
+		add(`action `+like+` '%' || ? || '%'`, filter.Action)
+	}
+	if filter.TargetType != "" {
+		add(`target_type = ?`, filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		add(`target_id = ?`, filter.TargetID)
+	}
+	if filter.Query != "" {
+		add(`(path `+like+` '%' || ? || '%' OR target_id `+like+` '%' || ? || '%' OR actor_email `+like+` '%' || ? || '%'
+			OR before`+text+` `+like+` '%' || ? || '%' OR after`+text+` `+like+` '%' || ? || '%')`, filter.Query)
+	}
+	if filter.From != nil {
+		add(`created_at >= ?`, *filter.From)
+	}
+	if filter.To != nil {
+		add(`created_at < ?`, *filter.To)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
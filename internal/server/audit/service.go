@@ -0,0 +1,378 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// Actor types
+const (
+	ActorUser      = "user"
+	ActorAPIToken  = "api_token"
+	ActorAnonymous = "anonymous"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+var ErrInvalidExportFormat = errors.New("export format must be csv or json")
+
+// redactedFields are never stored in before/after snapshots. Hashes are
+// included: API key hashes authenticate updaters, and a leaked hash of a short
+// code can be brute-forced.
+var redactedFields = map[string]bool{
+	"password":           true,
+	"current_password":   true,
+	"new_password":       true,
+	"password_hash":      true,
+	"token":              true,
+	"access_token":       true,
+	"refresh_token":      true,
+	"refresh_token_hash": true,
+	"token_hash":         true,
+	"id_token":           true,
+	"mfa_token":          true,
+	"mfa_secret":         true,
+	"totp_code":          true,
+	"qr_code_url":        true, // otpauth:// URL carrying the TOTP secret
+	"qr_code_data":       true,
+	"api_key":            true,
+	"api_key_hash":       true,
+	"license_key":        true,
+	"key":                true, // license key in heartbeat license status
+	"secret":             true,
+	"client_secret":      true,
+	"backup_codes":       true,
+	"mfa_backup_codes":   true,
+}
+
+// ignoredChanges are left out of the field diff because they change on every write
+var ignoredChanges = map[string]bool{
+	"updated_at": true,
+}
+
+// Service records and reads the administrative audit log
+type Service struct {
+	repo Repository
+}
+
+// NewService creates a new audit service
+func NewService(db *database.DB) *Service {
+	return &Service{repo: NewRepository(db)}
+}
+
+// Record appends an entry for a request. before and after are snapshots of the
+// target, or nil; they are redacted and diffed into the entry's changes.
+func (s *Service) Record(ctx context.Context, entry *types.AuditEntry, before, after interface{}) error {
+	var err error
+	if entry.Before, err = snapshot(before); err != nil {
+		return fmt.Errorf("failed to encode audit snapshot: %w", err)
+	}
+	if entry.After, err = snapshot(after); err != nil {
+		return fmt.Errorf("failed to encode audit snapshot: %w", err)
+	}
+	if entry.Changes, err = diff(entry.Before, entry.After); err != nil {
+		return fmt.Errorf("failed to diff audit snapshots: %w", err)
+	}
+
+	// The database keeps microseconds; hash what will be read back
+	entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+
+	return s.repo.Append(ctx, entry)
+}
+
+// List returns one page of entries matching filter, newest first
+func (s *Service) List(ctx context.Context, filter types.AuditFilter, page, perPage int) (*types.AuditPage, error) {
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = DefaultPageSize
+	}
+	if perPage > MaxPageSize {
+		perPage = MaxPageSize
+	}
+
+	entries, total, err := s.repo.List(ctx, filter, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.AuditPage{Entries: entries, Total: total, Page: page, PerPage: perPage}, nil
+}
+
+// Export writes every entry matching filter to w, oldest first, as CSV or a JSON array
+func (s *Service) Export(ctx context.Context, w io.Writer, format string, filter types.AuditFilter) error {
+	switch format {
+	case "csv":
+		return s.exportCSV(ctx, w, filter)
+	case "json":
+		return s.exportJSON(ctx, w, filter)
+	default:
+		return ErrInvalidExportFormat
+	}
+}
+
+var csvHeader = []string{
+	"id", "created_at", "actor_type", "actor_id", "actor_email", "token_id", "action", "method", "path",
+	"status", "target_type", "target_id", "ip_address", "user_agent", "request_id", "changes", "before",
+	"after", "prev_hash", "hash",
+}
+
+func (s *Service) exportCSV(ctx context.Context, w io.Writer, filter types.AuditFilter) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	err := s.repo.Each(ctx, filter, func(e *types.AuditEntry) error {
+		return cw.Write([]string{
+			strconv.FormatInt(e.ID, 10), e.CreatedAt.Format(time.RFC3339Nano), e.ActorType, e.ActorID,
+			e.ActorEmail, e.TokenID, e.Action, e.Method, e.Path, strconv.Itoa(e.Status), e.TargetType,
+			e.TargetID, e.IPAddress, e.UserAgent, e.RequestID, string(e.Changes), string(e.Before),
+			string(e.After), e.PrevHash, e.Hash,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func (s *Service) exportJSON(ctx context.Context, w io.Writer, filter types.AuditFilter) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	first := true
+	err := s.repo.Each(ctx, filter, func(e *types.AuditEntry) error {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if !first {
+			if _, err := io.WriteString(w, ",\n"); err != nil {
+				return err
+			}
+		}
+		first = false
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "]\n")
+	return err
+}
+
+// Verify walks the whole chain and reports the first entry that was changed,
+// removed or reordered
+func (s *Service) Verify(ctx context.Context) (*types.AuditVerification, error) {
+	result := &types.AuditVerification{Valid: true}
+	var prevHash string
+	var prevID int64
+
+	err := s.repo.Each(ctx, types.AuditFilter{}, func(e *types.AuditEntry) error {
+		if !result.Valid {
+			return nil
+		}
+		result.Entries++
+
+		var reason string
+		switch {
+		case e.ID != prevID+1:
+			reason = fmt.Sprintf("entries %d to %d are missing", prevID+1, e.ID-1)
+		case e.PrevHash != prevHash:
+			reason = "previous hash does not match the entry before it"
+		case computeHash(e) != e.Hash:
+			reason = "entry does not match its hash"
+		}
+		if reason != "" {
+			id := e.ID
+			result.Valid = false
+			result.BrokenAt = &id
+			result.Reason = reason
+			return nil
+		}
+
+		prevID, prevHash = e.ID, e.Hash
+		result.HeadHash = e.Hash
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// hashedEntry fixes the fields and order covered by an entry's hash
+type hashedEntry struct {
+	ID         int64           `json:"id"`
+	ActorType  string          `json:"actor_type"`
+	ActorID    string          `json:"actor_id"`
+	ActorEmail string          `json:"actor_email"`
+	TokenID    string          `json:"token_id"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Method     string          `json:"method"`
+	Path       string          `json:"path"`
+	Status     int             `json:"status"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	Changes    json.RawMessage `json:"changes"`
+	IPAddress  string          `json:"ip_address"`
+	UserAgent  string          `json:"user_agent"`
+	RequestID  string          `json:"request_id"`
+	CreatedAt  string          `json:"created_at"`
+	PrevHash   string          `json:"prev_hash"`
+}
+
+// computeHash returns SHA-256 over an entry and the hash before it
+func computeHash(e *types.AuditEntry) string {
+	data, _ := json.Marshal(hashedEntry{
+		ID: e.ID, ActorType: e.ActorType, ActorID: e.ActorID, ActorEmail: e.ActorEmail, TokenID: e.TokenID,
+		Action: e.Action, TargetType: e.TargetType, TargetID: e.TargetID, Method: e.Method, Path: e.Path,
+		Status: e.Status, Before: nullJSON(e.Before), After: nullJSON(e.After), Changes: nullJSON(e.Changes),
+		IPAddress: e.IPAddress, UserAgent: e.UserAgent, RequestID: e.RequestID,
+		CreatedAt: e.CreatedAt.UTC().Format(time.RFC3339Nano), PrevHash: e.PrevHash,
+	})
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func nullJSON(value json.RawMessage) json.RawMessage {
+	if len(value) == 0 {
+		return json.RawMessage("null")
+	}
+	return value
+}
+
+// snapshot encodes a value as redacted JSON
+func snapshot(value interface{}) (json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case json.RawMessage:
+		data = v
+	case []byte:
+		data = v
+	default:
+		var err error
+		if data, err = json.Marshal(value); err != nil {
+			return nil, err
+		}
+	}
+
+	decoded, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if decoded == nil {
+		return nil, nil
+	}
+	return json.Marshal(redact(decoded))
+}
+
+// diff lists the top-level fields that differ between two object snapshots
+func diff(before, after json.RawMessage) (json.RawMessage, error) {
+	if len(before) == 0 || len(after) == 0 {
+		return nil, nil
+	}
+
+	beforeValue, err := decode(before)
+	if err != nil {
+		return nil, err
+	}
+	afterValue, err := decode(after)
+	if err != nil {
+		return nil, err
+	}
+	beforeFields, ok1 := beforeValue.(map[string]interface{})
+	afterFields, ok2 := afterValue.(map[string]interface{})
+	if !ok1 || !ok2 {
+		return nil, nil
+	}
+
+	keys := make(map[string]bool)
+	for k := range beforeFields {
+		keys[k] = true
+	}
+	for k := range afterFields {
+		keys[k] = true
+	}
+	names := make([]string, 0, len(keys))
+	for k := range keys {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	changes := make(map[string]map[string]interface{})
+	for _, name := range names {
+		if ignoredChanges[name] {
+			continue
+		}
+		b, _ := json.Marshal(beforeFields[name])
+		a, _ := json.Marshal(afterFields[name])
+		if !bytes.Equal(a, b) {
+			changes[name] = map[string]interface{}{"before": beforeFields[name], "after": afterFields[name]}
+		}
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(changes)
+}
+
+// decode parses JSON keeping numbers exactly as written
+func decode(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if redactedFields[strings.ToLower(key)] {
+				v[key] = "[REDACTED]"
+			} else {
+				v[key] = redact(field)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redact(v[i])
+		}
+	}
+	return value
+}
@@ -0,0 +1,39 @@
+package audit
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+func TestSnapshotRedacts(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  interface{}
+		secret string
+	}{
+		{"license", &types.License{LicenseKey: "LIC-SECRET-1", CustomerName: "Acme"}, "LIC-SECRET-1"},
+		{"license request", map[string]interface{}{"License_Key": "LIC-SECRET-2"}, "LIC-SECRET-2"},
+		{"instance key hash", map[string]interface{}{"instance_id": "inst-a", "api_key_hash": "deadbeef"}, "deadbeef"},
+		{"heartbeat license", &types.Instance{
+			InstanceID:        "inst-a",
+			LastHeartbeatData: &types.Heartbeat{License: types.LicenseStatus{Key: "LIC-SECRET-3", Valid: true}},
+		}, "LIC-SECRET-3"},
+		{"nested in list", []interface{}{map[string]interface{}{"client_secret": "oidc-secret"}}, "oidc-secret"},
+		{"mfa setup", &types.MFASetupResponse{Secret: "JBSWY3DP", QRCodeURL: "otpauth://totp/x?secret=JBSWY3DP"}, "JBSWY3DP"},
+	}
+	for _, tt := range tests {
+		data, err := snapshot(tt.value)
+		if err != nil {
+			t.Fatalf("%s: snapshot: %v", tt.name, err)
+		}
+		if strings.Contains(string(data), tt.secret) {
+			t.Errorf("%s: snapshot leaks the secret: %s", tt.name, data)
+		}
+		if !json.Valid(data) || !strings.Contains(string(data), "[REDACTED]") {
+			t.Errorf("%s: snapshot = %s, want a redacted field", tt.name, data)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+const sqliteEntryColumns = `id, actor_type, COALESCE(actor_id, ''), COALESCE(actor_email, ''), COALESCE(token_id, ''),
+	action, COALESCE(target_type, ''), COALESCE(target_id, ''), method, path, status,
+	before, after, changes, COALESCE(ip_address, ''), COALESCE(user_agent, ''),
+	COALESCE(request_id, ''), created_at, prev_hash, hash`
+
+// SQLiteRepository stores the audit log in a SQLite database
+type SQLiteRepository struct {
+	db *database.SQLite
+}
+
+// NewSQLiteRepository creates a repository backed by SQLite
+func NewSQLiteRepository(db *database.DB) *SQLiteRepository {
+	return &SQLiteRepository{db: db.SQLite}
+}
+
+// Append implements Repository. The transaction holds the database write lock,
+// which serializes appends to the chain.
+func (r *SQLiteRepository) Append(ctx context.Context, entry *types.AuditEntry) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var lastID int64
+	var lastHash string
+	err = tx.QueryRowContext(ctx, `SELECT id, hash FROM audit_log ORDER BY id DESC LIMIT 1`).Scan(&lastID, &lastHash)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to read audit log head: %w", err)
+	}
+
+	entry.ID = lastID + 1
+	entry.PrevHash = lastHash
+	entry.Hash = computeHash(entry)
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO audit_log (id, actor_type, actor_id, actor_email, token_id, action, target_type, target_id,
+			method, path, status, before, after, changes, ip_address, user_agent, request_id, created_at,
+			prev_hash, hash)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), $6, NULLIF($7, ''), NULLIF($8, ''),
+			$9, $10, $11, $12, $13, $14, NULLIF($15, ''), NULLIF($16, ''), NULLIF($17, ''), $18,
+			$19, $20)
+	`, entry.ID, entry.ActorType, entry.ActorID, entry.ActorEmail, entry.TokenID, entry.Action,
+		entry.TargetType, entry.TargetID, entry.Method, entry.Path, entry.Status,
+		jsonText(entry.Before), jsonText(entry.After), jsonText(entry.Changes),
+		entry.IPAddress, entry.UserAgent, entry.RequestID, entry.CreatedAt, entry.PrevHash, entry.Hash)
+	if err != nil {
+		return fmt.Errorf("failed to append audit entry: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// List implements Repository
+func (r *SQLiteRepository) List(ctx context.Context, filter types.AuditFilter, limit, offset int) ([]types.AuditEntry, int64, error) {
+	where, args := filterClause(filter, database.DriverSQLite)
+
+	var total int64
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM audit_log WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit entries: %w", err)
+	}
+
+	args = append(args, limit, offset)
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+sqliteEntryColumns+`
+		FROM audit_log
+		WHERE `+where+`
+		ORDER BY id DESC
+		LIMIT $`+strconv.Itoa(len(args)-1)+` OFFSET $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []types.AuditEntry{}
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, *entry)
+	}
+
+	return entries, total, rows.Err()
+}
+
+// Each implements Repository
+func (r *SQLiteRepository) Each(ctx context.Context, filter types.AuditFilter, fn func(*types.AuditEntry) error) error {
+	where, args := filterClause(filter, database.DriverSQLite)
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+sqliteEntryColumns+`
+		FROM audit_log
+		WHERE `+where+`
+		ORDER BY id ASC`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to read audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
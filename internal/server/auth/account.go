@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/mail"
+)
+
+const (
+	PasswordResetTokenDuration     = time.Hour
+	EmailVerificationTokenDuration = 48 * time.Hour
+)
+
+// Account token purposes
+const (
+	tokenPurposePasswordReset     = "password_reset"
+	tokenPurposeEmailVerification = "email_verification"
+	tokenPurposeOIDCLink          = "oidc_link"
+	tokenPurposeOIDCLogin         = "oidc_login"
+)
+
+var (
+	ErrMailNotConfigured    = errors.New("email is not configured")
+	ErrEmailAlreadyVerified = errors.New("email is already verified")
+	ErrNoEmail              = errors.New("service accounts have no email address")
+)
+
+// EnableMail turns on password reset and email verification. Links in emails
+// point at dashboardURL.
+func (s *Service) EnableMail(sender mail.Sender, dashboardURL string) {
+	s.mailer = sender
+	s.dashboardURL = strings.TrimRight(dashboardURL, "/")
+}
+
+// RequestPasswordReset emails a reset link. It succeeds whether or not the
+// address belongs to a user, so callers cannot use it to discover accounts.
+func (s *Service) RequestPasswordReset(ctx context.Context, email, ip, userAgent string) error {
+	if s.mailer == nil {
+		return ErrMailNotConfigured
+	}
+
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			s.repo.LogAuditEvent(ctx, "", "password_reset_denied", ip, userAgent, map[string]interface{}{
+				"email":  email,
+				"reason": "unknown email",
+			})
+			return nil
+		}
+		return err
+	}
+	if user.IsServiceAccount || !user.IsActive {
+		s.repo.LogAuditEvent(ctx, user.ID, "password_reset_denied", ip, userAgent, map[string]interface{}{
+			"reason": "service account or disabled user",
+		})
+		return nil
+	}
+
+	disabled, err := s.localPasswordDisabled(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if disabled {
+		s.repo.LogAuditEvent(ctx, user.ID, "password_reset_denied", ip, userAgent, map[string]interface{}{
+			"reason": "local passwords are disabled for SSO users",
+		})
+		return nil
+	}
+
+	link, err := s.issueAccountToken(ctx, user.ID, tokenPurposePasswordReset, "/reset-password", PasswordResetTokenDuration)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf(`Hello %s,
+
+Someone asked to reset the password of your MySoc Updates account. To choose a
+new password, open this link within %s:
+
+%s
+
+If you did not ask for this, you can ignore this email. Your password will not change.
+`, user.Name, formatTokenDuration(PasswordResetTokenDuration), link)
+
+	s.sendAccountMail(ctx, user.ID, user.Email, "Reset your MySoc Updates password", body, "password_reset_requested", ip, userAgent)
+	return nil
+}
+
+// ResetPassword sets a new password with a reset token and signs the user out everywhere
+func (s *Service) ResetPassword(ctx context.Context, token, newPassword, ip, userAgent string) error {
+	if len(newPassword) < 8 {
+		return ErrPasswordTooWeak
+	}
+
+	userID, err := s.repo.ConsumeAccountToken(ctx, hashToken(token), tokenPurposePasswordReset)
+	if err != nil {
+		if errors.Is(err, ErrAccountTokenInvalid) {
+			s.repo.LogAuditEvent(ctx, "", "password_reset_failed", ip, userAgent, map[string]interface{}{
+				"reason": err.Error(),
+			})
+		}
+		return err
+	}
+
+	disabled, err := s.localPasswordDisabled(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if disabled {
+		s.repo.LogAuditEvent(ctx, userID, "password_reset_failed", ip, userAgent, map[string]interface{}{
+			"reason": "local passwords are disabled for SSO users",
+		})
+		return ErrLocalPasswordDisabled
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.UpdatePassword(ctx, userID, string(hash)); err != nil {
+		return err
+	}
+
+	// The reset link proves the user controls the address, and clears any lockout
+	s.repo.MarkEmailVerified(ctx, userID)
+	s.repo.ResetFailedAttempts(ctx, userID)
+	s.repo.RevokeAllUserSessions(ctx, userID, "password_reset")
+	s.repo.LogAuditEvent(ctx, userID, "password_reset", ip, userAgent, nil)
+
+	return nil
+}
+
+// SendEmailVerification emails a verification link to a user
+func (s *Service) SendEmailVerification(ctx context.Context, userID, ip, userAgent string) error {
+	if s.mailer == nil {
+		return ErrMailNotConfigured
+	}
+
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+	if user.IsServiceAccount {
+		return ErrNoEmail
+	}
+
+	link, err := s.issueAccountToken(ctx, user.ID, tokenPurposeEmailVerification, "/verify-email", EmailVerificationTokenDuration)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf(`Hello %s,
+
+Please confirm that this is your email address by opening this link within %s:
+
+%s
+
+If you do not have a MySoc Updates account, you can ignore this email.
+`, user.Name, formatTokenDuration(EmailVerificationTokenDuration), link)
+
+	if !s.sendAccountMail(ctx, user.ID, user.Email, "Verify your MySoc Updates email address", body, "email_verification_sent", ip, userAgent) {
+		return fmt.Errorf("failed to send verification email")
+	}
+	return nil
+}
+
+// VerifyEmail marks a user's email verified with a verification token
+func (s *Service) VerifyEmail(ctx context.Context, token, ip, userAgent string) error {
+	userID, err := s.repo.ConsumeAccountToken(ctx, hashToken(token), tokenPurposeEmailVerification)
+	if err != nil {
+		if errors.Is(err, ErrAccountTokenInvalid) {
+			s.repo.LogAuditEvent(ctx, "", "email_verification_failed", ip, userAgent, map[string]interface{}{
+				"reason": err.Error(),
+			})
+		}
+		return err
+	}
+
+	if err := s.repo.MarkEmailVerified(ctx, userID); err != nil {
+		return err
+	}
+	s.repo.LogAuditEvent(ctx, userID, "email_verified", ip, userAgent, nil)
+
+	return nil
+}
+
+// issueAccountToken stores a new single-use token and returns the dashboard link carrying it
+func (s *Service) issueAccountToken(ctx context.Context, userID, purpose, path string, duration time.Duration) (string, error) {
+	token, err := s.generateRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	if err := s.repo.CreateAccountToken(ctx, userID, purpose, hashToken(token), time.Now().Add(duration)); err != nil {
+		return "", err
+	}
+	return s.dashboardURL + path + "?token=" + url.QueryEscape(token), nil
+}
+
+// sendAccountMail sends an account email and records the attempt in the audit log
+func (s *Service) sendAccountMail(ctx context.Context, userID, to, subject, body, eventType, ip, userAgent string) bool {
+	err := s.mailer.Send(ctx, mail.Message{To: to, Subject: subject, Body: body})
+	if err != nil {
+		log.Printf("Failed to send %s email to user %s: %v", eventType, userID, err)
+		s.repo.LogAuditEvent(ctx, userID, eventType, ip, userAgent, map[string]interface{}{
+			"delivered": false,
+			"error":     err.Error(),
+		})
+		return false
+	}
+
+	s.repo.LogAuditEvent(ctx, userID, eventType, ip, userAgent, map[string]interface{}{
+		"delivered": true,
+	})
+	return true
+}
+
+func formatTokenDuration(d time.Duration) string {
+	switch hours := int(d.Hours()); {
+	case hours > 1:
+		return fmt.Sprintf("%d hours", hours)
+	case hours == 1:
+		return "1 hour"
+	default:
+		return fmt.Sprintf("%d minutes", int(d.Minutes()))
+	}
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"strings"
+)
+
+// Device types recorded on sessions
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceCLI     = "cli"
+	DeviceUnknown = "unknown"
+)
+
+// deviceInfo describes the client a session was signed in from
+type deviceInfo struct {
+	Browser string
+	OS      string
+	Type    string
+}
+
+// userAgentToken maps a product token in a User-Agent header to a name
+type userAgentToken struct {
+	token string
+	name  string
+}
+
+// Browser tokens, most specific first: Edge and Opera also send Chrome and
+// Safari, and Chrome also sends Safari
+var browserTokens = []userAgentToken{
+	{"Edg/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Version/", "Safari"},
+}
+
+// Command-line clients, which sign in through the API directly
+var cliTokens = []userAgentToken{
+	{"curl/", "curl"},
+	{"Wget/", "Wget"},
+	{"HTTPie/", "HTTPie"},
+	{"python-requests/", "Python Requests"},
+	{"Go-http-client/", "Go"},
+	{"PostmanRuntime/", "Postman"},
+}
+
+// parseUserAgent extracts the browser, operating system and device type from a
+// User-Agent header. Parts it cannot recognise are left empty.
+func parseUserAgent(userAgent string) deviceInfo {
+	if userAgent == "" {
+		return deviceInfo{Type: DeviceUnknown}
+	}
+
+	for _, t := range cliTokens {
+		if version, ok := tokenVersion(userAgent, t.token); ok {
+			return deviceInfo{Browser: withVersion(t.name, version), Type: DeviceCLI}
+		}
+	}
+
+	info := deviceInfo{OS: parseOS(userAgent), Type: DeviceDesktop}
+	for _, t := range browserTokens {
+		if version, ok := tokenVersion(userAgent, t.token); ok {
+			info.Browser = withVersion(t.name, version)
+			break
+		}
+	}
+
+	switch {
+	case strings.Contains(userAgent, "iPad"), strings.Contains(userAgent, "Tablet"),
+		strings.Contains(userAgent, "Android") && !strings.Contains(userAgent, "Mobile"):
+		info.Type = DeviceTablet
+	case strings.Contains(userAgent, "Mobi"), strings.Contains(userAgent, "iPhone"):
+		info.Type = DeviceMobile
+	case info.Browser == "" && info.OS == "":
+		info.Type = DeviceUnknown
+	}
+
+	return info
+}
+
+// parseOS names the operating system in a browser User-Agent header
+func parseOS(userAgent string) string {
+	switch {
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"):
+		return "iOS"
+	case strings.Contains(userAgent, "Android"):
+		return "Android"
+	case strings.Contains(userAgent, "CrOS"):
+		return "ChromeOS"
+	case strings.Contains(userAgent, "Windows"):
+		return "Windows"
+	case strings.Contains(userAgent, "Macintosh"), strings.Contains(userAgent, "Mac OS X"):
+		return "macOS"
+	case strings.Contains(userAgent, "Linux"):
+		return "Linux"
+	default:
+		return ""
+	}
+}
+
+// tokenVersion returns the major version following token, e.g. "120" for
+// "Chrome/" in "Chrome/120.0.6099.71"
+func tokenVersion(userAgent, token string) (string, bool) {
+	i := strings.Index(userAgent, token)
+	if i < 0 {
+		return "", false
+	}
+	version := userAgent[i+len(token):]
+	if end := strings.IndexAny(version, ". ;)"); end >= 0 {
+		version = version[:end]
+	}
+	return version, true
+}
+
+func withVersion(name, version string) string {
+	if version == "" {
+		return name
+	}
+	return name + " " + version
+}
@@ -4,11 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/audit"
 	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
 )
 
@@ -34,18 +38,15 @@ func writeError(w http.ResponseWriter, status int, message string) {
 	writeJSON(w, status, map[string]string{"error": message})
 }
 
+// getClientIP returns the client address. The router has already replaced
+// RemoteAddr with the forwarded client when the request came through a
+// trusted proxy, so headers are not read here.
 func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		parts := strings.Split(xff, ",")
-		return strings.TrimSpace(parts[0])
-	}
-	// Check X-Real-IP header
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
 	}
-	// Fall back to RemoteAddr
-	return r.RemoteAddr
+	return host
 }
 
 // HandleLogin handles POST /api/v1/auth/login
@@ -71,6 +72,8 @@ func (h *Handlers) HandleLogin(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusUnauthorized, "invalid email or password")
 		case errors.Is(err, ErrAccountLocked):
 			writeError(w, http.StatusForbidden, "account is locked due to too many failed attempts")
+		case errors.Is(err, ErrLocalPasswordDisabled):
+			writeError(w, http.StatusForbidden, "password login is disabled for this account; sign in with SSO")
 		default:
 			writeError(w, http.StatusInternalServerError, err.Error())
 		}
@@ -88,21 +91,26 @@ func (h *Handlers) HandleMFAVerify(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.MFAToken == "" || req.TOTPCode == "" {
-		writeError(w, http.StatusBadRequest, "mfa_token and totp_code are required")
+	if req.MFAToken == "" || (req.TOTPCode == "" && req.WebAuthn == nil) {
+		writeError(w, http.StatusBadRequest, "mfa_token and either totp_code or webauthn are required")
 		return
 	}
 
 	ip := getClientIP(r)
 	userAgent := r.UserAgent()
 
-	resp, err := h.service.VerifyMFA(r.Context(), req.MFAToken, req.TOTPCode, ip, userAgent)
+	resp, err := h.service.VerifyMFA(r.Context(), req, ip, userAgent)
 	if err != nil {
 		switch {
 		case errors.Is(err, ErrInvalidToken), errors.Is(err, ErrTokenExpired):
 			writeError(w, http.StatusUnauthorized, "invalid or expired MFA token")
 		case errors.Is(err, ErrInvalidMFACode):
 			writeError(w, http.StatusUnauthorized, "invalid MFA code")
+		case errors.Is(err, ErrWebAuthnVerification), errors.Is(err, ErrWebAuthnChallengeInvalid),
+			errors.Is(err, ErrWebAuthnCredentialNotFound):
+			writeError(w, http.StatusUnauthorized, err.Error())
+		case errors.Is(err, ErrWebAuthnRequired), errors.Is(err, ErrMFANotEnabled):
+			writeError(w, http.StatusBadRequest, err.Error())
 		default:
 			writeError(w, http.StatusInternalServerError, err.Error())
 		}
@@ -133,6 +141,8 @@ func (h *Handlers) HandleRefresh(w http.ResponseWriter, r *http.Request) {
 		switch {
 		case errors.Is(err, ErrSessionNotFound), errors.Is(err, ErrSessionExpired):
 			writeError(w, http.StatusUnauthorized, "invalid or expired session")
+		case errors.Is(err, ErrRefreshTokenReused):
+			writeError(w, http.StatusUnauthorized, err.Error())
 		default:
 			writeError(w, http.StatusInternalServerError, err.Error())
 		}
@@ -244,7 +254,9 @@ func (h *Handlers) HandleChangePassword(w http.ResponseWriter, r *http.Request)
 		switch {
 		case errors.Is(err, ErrInvalidCredentials):
 			writeError(w, http.StatusUnauthorized, "current password is incorrect")
-		case errors.Is(err, ErrPasswordTooWeak):
+		case errors.Is(err, ErrLocalPasswordDisabled):
+			writeError(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, ErrPasswordTooWeak), errors.Is(err, ErrInvalidRole):
 			writeError(w, http.StatusBadRequest, err.Error())
 		default:
 			writeError(w, http.StatusInternalServerError, err.Error())
@@ -255,6 +267,118 @@ func (h *Handlers) HandleChangePassword(w http.ResponseWriter, r *http.Request)
 	writeJSON(w, http.StatusOK, map[string]string{"status": "password changed"})
 }
 
+// HandleForgotPassword handles POST /api/v1/auth/password/forgot
+func (h *Handlers) HandleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req types.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.Email == "" {
+		writeError(w, http.StatusBadRequest, "email is required")
+		return
+	}
+
+	err := h.service.RequestPasswordReset(r.Context(), req.Email, getClientIP(r), r.UserAgent())
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrMailNotConfigured):
+			writeError(w, http.StatusNotFound, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	// The same response whether or not the address belongs to a user
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"status": "if the address belongs to an account, a reset link has been sent",
+	})
+}
+
+// HandleResetPassword handles POST /api/v1/auth/password/reset
+func (h *Handlers) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req types.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.Token == "" || req.NewPassword == "" {
+		writeError(w, http.StatusBadRequest, "token and new_password are required")
+		return
+	}
+
+	err := h.service.ResetPassword(r.Context(), req.Token, req.NewPassword, getClientIP(r), r.UserAgent())
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrAccountTokenInvalid), errors.Is(err, ErrPasswordTooWeak):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, ErrLocalPasswordDisabled):
+			writeError(w, http.StatusForbidden, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "password reset"})
+}
+
+// HandleVerifyEmail handles POST /api/v1/auth/email/verify
+func (h *Handlers) HandleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req types.VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.Token == "" {
+		writeError(w, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	err := h.service.VerifyEmail(r.Context(), req.Token, getClientIP(r), r.UserAgent())
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrAccountTokenInvalid):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "email verified"})
+}
+
+// HandleSendEmailVerification handles POST /api/v1/auth/email/verification
+func (h *Handlers) HandleSendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	err := h.service.SendEmailVerification(r.Context(), user.ID, getClientIP(r), r.UserAgent())
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrMailNotConfigured):
+			writeError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, ErrEmailAlreadyVerified):
+			writeError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, ErrNoEmail):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "verification email sent"})
+}
+
 // HandleMFASetup handles GET /api/v1/auth/mfa/setup
 func (h *Handlers) HandleMFASetup(w http.ResponseWriter, r *http.Request) {
 	user := GetUserFromContext(r.Context())
@@ -362,7 +486,7 @@ func (h *Handlers) HandleGetSessions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sessions, err := h.service.GetSessions(r.Context(), user.ID)
+	sessions, err := h.service.GetSessions(r.Context(), user.ID, GetSessionIDFromContext(r.Context()))
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -371,6 +495,92 @@ func (h *Handlers) HandleGetSessions(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, sessions)
 }
 
+// HandleRevokeSession handles DELETE /api/v1/auth/sessions/{id}
+func (h *Handlers) HandleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	audit.SetTarget(r.Context(), "sessions", id)
+
+	session, err := h.service.RevokeSession(r.Context(), id, user.ID, user.ID, getClientIP(r), r.UserAgent())
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	audit.SetBefore(r.Context(), session)
+	audit.SetAfter(r.Context(), nil)
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+// HandleListUserSessions handles GET /api/v1/admin/users/{id}/sessions
+func (h *Handlers) HandleListUserSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := h.service.GetUserSessions(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+// HandleAdminRevokeSession handles DELETE /api/v1/admin/users/{id}/sessions/{session}
+func (h *Handlers) HandleAdminRevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+	id := chi.URLParam(r, "session")
+	audit.SetTarget(r.Context(), "sessions", id)
+
+	actorID := ""
+	if user := GetUserFromContext(r.Context()); user != nil {
+		actorID = user.ID
+	}
+
+	session, err := h.service.RevokeSession(r.Context(), id, userID, actorID, getClientIP(r), r.UserAgent())
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	audit.SetBefore(r.Context(), session)
+	audit.SetAfter(r.Context(), nil)
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+// HandleAdminRevokeUserSessions handles DELETE /api/v1/admin/users/{id}/sessions
+func (h *Handlers) HandleAdminRevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+
+	actorID := ""
+	if user := GetUserFromContext(r.Context()); user != nil {
+		actorID = user.ID
+	}
+
+	revoked, err := h.service.RevokeUserSessions(r.Context(), userID, actorID, getClientIP(r), r.UserAgent())
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "revoked", "revoked": revoked})
+}
+
+func writeSessionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrSessionNotFound):
+		writeError(w, http.StatusNotFound, "session not found")
+	case errors.Is(err, ErrUserNotFound):
+		writeError(w, http.StatusNotFound, "user not found")
+	case errors.Is(err, ErrPermissionNotHeld):
+		writeError(w, http.StatusForbidden, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
 // HandleGetAuditLog handles GET /api/v1/auth/audit
 func (h *Handlers) HandleGetAuditLog(w http.ResponseWriter, r *http.Request) {
 	user := GetUserFromContext(r.Context())
@@ -415,7 +625,7 @@ func (h *Handlers) HandleCreateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if req.Role == "" {
-		req.Role = "viewer"
+		req.Role = RoleViewer
 	}
 
 	user, err := h.service.CreateUser(r.Context(), req.Email, req.Password, req.Name, req.Role)
@@ -423,14 +633,21 @@ func (h *Handlers) HandleCreateUser(w http.ResponseWriter, r *http.Request) {
 		switch {
 		case errors.Is(err, ErrUserExists):
 			writeError(w, http.StatusConflict, "user already exists")
-		case errors.Is(err, ErrPasswordTooWeak):
+		case errors.Is(err, ErrPasswordTooWeak), errors.Is(err, ErrInvalidRole):
 			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, ErrPermissionNotHeld):
+			writeError(w, http.StatusForbidden, err.Error())
 		default:
 			writeError(w, http.StatusInternalServerError, err.Error())
 		}
 		return
 	}
 
+	// Best effort: the user can ask for another link from their profile
+	if !user.EmailVerified {
+		h.service.SendEmailVerification(r.Context(), user.ID, getClientIP(r), r.UserAgent())
+	}
+
 	writeJSON(w, http.StatusCreated, user)
 }
 
@@ -469,12 +686,23 @@ func (h *Handlers) HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before, _ := h.service.GetProfile(r.Context(), id)
+	audit.SetBefore(r.Context(), before)
+
 	user, err := h.service.UpdateUser(r.Context(), id, req.Name, req.Role, req.IsActive)
 	if err != nil {
 		if errors.Is(err, ErrUserNotFound) {
 			writeError(w, http.StatusNotFound, "user not found")
 			return
 		}
+		if errors.Is(err, ErrInvalidRole) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if errors.Is(err, ErrPermissionNotHeld) {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -497,23 +725,614 @@ func (h *Handlers) HandleDeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before, _ := h.service.GetProfile(r.Context(), id)
+	audit.SetBefore(r.Context(), before)
+	audit.SetAfter(r.Context(), nil)
+
 	err := h.service.DeleteUser(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, ErrUserNotFound) {
 			writeError(w, http.StatusNotFound, "user not found")
 			return
 		}
+		if errors.Is(err, ErrPermissionNotHeld) {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// API token handlers
+
+// HandleListAPITokens handles GET /api/v1/auth/tokens
+func (h *Handlers) HandleListAPITokens(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	tokens, err := h.service.ListAPITokens(r.Context(), user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// HandleCreateAPIToken handles POST /api/v1/auth/tokens
+func (h *Handlers) HandleCreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req types.CreateAPITokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	resp, err := h.service.CreateAPIToken(r.Context(), user, user.ID, req, getClientIP(r), r.UserAgent())
+	if err != nil {
+		writeAPITokenError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// HandleRevokeAPIToken handles DELETE /api/v1/auth/tokens/{id}
+func (h *Handlers) HandleRevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if err := h.service.RevokeAPIToken(r.Context(), id, user.ID, user.ID, getClientIP(r), r.UserAgent()); err != nil {
+		writeAPITokenError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+// HandleListAllAPITokens handles GET /api/v1/admin/tokens
+func (h *Handlers) HandleListAllAPITokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := h.service.ListAPITokens(r.Context(), "")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// HandleAdminRevokeAPIToken handles DELETE /api/v1/admin/tokens/{id}
+func (h *Handlers) HandleAdminRevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	actorID := ""
+	if user := GetUserFromContext(r.Context()); user != nil {
+		actorID = user.ID
+	}
+
+	if err := h.service.RevokeAPIToken(r.Context(), id, "", actorID, getClientIP(r), r.UserAgent()); err != nil {
+		writeAPITokenError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+// HandleListServiceAccounts handles GET /api/v1/admin/service-accounts
+func (h *Handlers) HandleListServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	accounts, err := h.service.ListServiceAccounts(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, accounts)
+}
+
+// HandleCreateServiceAccount handles POST /api/v1/admin/service-accounts
+func (h *Handlers) HandleCreateServiceAccount(w http.ResponseWriter, r *http.Request) {
+	var req types.CreateServiceAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = RoleAdmin
+	}
+
+	account, err := h.service.CreateServiceAccount(r.Context(), req.Name, req.Role)
+	if err != nil {
+		if errors.Is(err, ErrUserExists) {
+			writeError(w, http.StatusConflict, "service account already exists")
+			return
+		}
+		if errors.Is(err, ErrInvalidRole) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if errors.Is(err, ErrPermissionNotHeld) {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, account)
+}
+
+// HandleCreateServiceAccountToken handles POST /api/v1/admin/service-accounts/{id}/tokens
+func (h *Handlers) HandleCreateServiceAccountToken(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var req types.CreateAPITokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	creatorID := ""
+	if user := GetUserFromContext(r.Context()); user != nil {
+		creatorID = user.ID
+	}
+
+	resp, err := h.service.CreateServiceAccountToken(r.Context(), id, creatorID, req, getClientIP(r), r.UserAgent())
+	if err != nil {
+		writeAPITokenError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func writeAPITokenError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrAPITokenNotFound):
+		writeError(w, http.StatusNotFound, "API token not found")
+	case errors.Is(err, ErrUserNotFound):
+		writeError(w, http.StatusNotFound, "user not found")
+	case errors.Is(err, ErrInvalidScope), errors.Is(err, ErrInvalidTokenName), errors.Is(err, ErrNotServiceAccount):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrPermissionNotHeld):
+		writeError(w, http.StatusForbidden, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// HandleListPermissions handles GET /api/v1/admin/permissions
+func (h *Handlers) HandleListPermissions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, AllPermissions)
+}
+
+// HandleListRoles handles GET /api/v1/admin/roles
+func (h *Handlers) HandleListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.service.ListRoles(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, roles)
+}
+
+// HandleGetRole handles GET /api/v1/admin/roles/{name}
+func (h *Handlers) HandleGetRole(w http.ResponseWriter, r *http.Request) {
+	role, err := h.service.GetRole(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		writeRoleError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, role)
+}
+
+// HandleCreateRole handles POST /api/v1/admin/roles
+func (h *Handlers) HandleCreateRole(w http.ResponseWriter, r *http.Request) {
+	var req types.CreateRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	actorID := ""
+	if user := GetUserFromContext(r.Context()); user != nil {
+		actorID = user.ID
+	}
+
+	role, err := h.service.CreateRole(r.Context(), req, actorID, getClientIP(r), r.UserAgent())
+	if err != nil {
+		writeRoleError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, role)
+}
+
+// HandleUpdateRole handles PUT /api/v1/admin/roles/{name}
+func (h *Handlers) HandleUpdateRole(w http.ResponseWriter, r *http.Request) {
+	var req types.UpdateRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	actorID := ""
+	if user := GetUserFromContext(r.Context()); user != nil {
+		actorID = user.ID
+	}
+
+	before, _ := h.service.GetRole(r.Context(), chi.URLParam(r, "name"))
+	audit.SetBefore(r.Context(), before)
+
+	role, err := h.service.UpdateRole(r.Context(), chi.URLParam(r, "name"), req, actorID, getClientIP(r), r.UserAgent())
+	if err != nil {
+		writeRoleError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, role)
+}
+
+// HandleDeleteRole handles DELETE /api/v1/admin/roles/{name}
+func (h *Handlers) HandleDeleteRole(w http.ResponseWriter, r *http.Request) {
+	actorID := ""
+	if user := GetUserFromContext(r.Context()); user != nil {
+		actorID = user.ID
+	}
+
+	before, _ := h.service.GetRole(r.Context(), chi.URLParam(r, "name"))
+	audit.SetBefore(r.Context(), before)
+	audit.SetAfter(r.Context(), nil)
+
+	if err := h.service.DeleteRole(r.Context(), chi.URLParam(r, "name"), actorID, getClientIP(r), r.UserAgent()); err != nil {
+		writeRoleError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func writeRoleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrRoleNotFound):
+		writeError(w, http.StatusNotFound, "role not found")
+	case errors.Is(err, ErrRoleExists), errors.Is(err, ErrRoleInUse):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrInvalidRole), errors.Is(err, ErrInvalidPermission), errors.Is(err, ErrBuiltInRole):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrPermissionNotHeld):
+		writeError(w, http.StatusForbidden, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// HandleWebAuthnLoginOptions handles POST /api/v1/auth/mfa/webauthn/options
+func (h *Handlers) HandleWebAuthnLoginOptions(w http.ResponseWriter, r *http.Request) {
+	var req types.WebAuthnLoginOptionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.MFAToken == "" {
+		writeError(w, http.StatusBadRequest, "mfa_token is required")
+		return
+	}
+
+	options, err := h.service.BeginWebAuthnLogin(r.Context(), req.MFAToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidToken), errors.Is(err, ErrTokenExpired):
+			writeError(w, http.StatusUnauthorized, "invalid or expired MFA token")
+		default:
+			writeWebAuthnError(w, err)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, options)
+}
+
+// HandleWebAuthnRegisterBegin handles POST /api/v1/auth/webauthn/register/begin
+func (h *Handlers) HandleWebAuthnRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	options, err := h.service.BeginWebAuthnRegistration(r.Context(), user.ID)
+	if err != nil {
+		writeWebAuthnError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, options)
+}
+
+// HandleWebAuthnRegisterFinish handles POST /api/v1/auth/webauthn/register/finish
+func (h *Handlers) HandleWebAuthnRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req types.WebAuthnRegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.ChallengeID == "" {
+		writeError(w, http.StatusBadRequest, "challenge_id is required")
+		return
+	}
+
+	credential, err := h.service.FinishWebAuthnRegistration(r.Context(), user.ID, req, getClientIP(r), r.UserAgent())
+	if err != nil {
+		writeWebAuthnError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, credential)
+}
+
+// HandleListWebAuthnCredentials handles GET /api/v1/auth/webauthn/credentials
+func (h *Handlers) HandleListWebAuthnCredentials(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	credentials, err := h.service.ListWebAuthnCredentials(r.Context(), user.ID)
+	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	writeJSON(w, http.StatusOK, credentials)
+}
+
+// HandleRenameWebAuthnCredential handles PUT /api/v1/auth/webauthn/credentials/{id}
+func (h *Handlers) HandleRenameWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req types.RenameWebAuthnCredentialRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.service.RenameWebAuthnCredential(r.Context(), user.ID, chi.URLParam(r, "id"), req.Name); err != nil {
+		writeWebAuthnError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "renamed"})
+}
+
+// HandleDeleteWebAuthnCredential handles DELETE /api/v1/auth/webauthn/credentials/{id}
+func (h *Handlers) HandleDeleteWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	err := h.service.DeleteWebAuthnCredential(r.Context(), user.ID, chi.URLParam(r, "id"), getClientIP(r), r.UserAgent())
+	if err != nil {
+		writeWebAuthnError(w, err)
+		return
+	}
+
 	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
+func writeWebAuthnError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrWebAuthnNotConfigured), errors.Is(err, ErrWebAuthnCredentialNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrWebAuthnCredentialExists), errors.Is(err, ErrWebAuthnRequired):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrWebAuthnVerification), errors.Is(err, ErrWebAuthnChallengeInvalid),
+		errors.Is(err, ErrInvalidCredentialName), errors.Is(err, ErrMFANotEnabled):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// HandleOIDCStatus handles GET /api/v1/auth/oidc
+func (h *Handlers) HandleOIDCStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.service.OIDCStatus())
+}
+
+// HandleOIDCLogin handles GET /api/v1/auth/oidc/login, sending the browser to the
+// identity provider. ?redirect_to= is the dashboard path to return to, and
+// ?link= a token from HandleOIDCLink. The state of the login is kept in a
+// cookie, so only this browser can complete it.
+func (h *Handlers) HandleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	authURL, state, err := h.service.StartOIDCLogin(r.Context(), query.Get("redirect_to"), query.Get("link"))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrOIDCNotConfigured):
+			writeError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, ErrAccountTokenInvalid):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	http.SetCookie(w, h.service.oidcStateCookie(state))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// HandleOIDCCallback handles GET /api/v1/auth/oidc/callback, where the identity
+// provider returns the browser. When a dashboard URL is configured the browser is
+// sent on to the dashboard's /login/callback page with a one-time code, which the
+// dashboard redeems at /api/v1/auth/oidc/token; tokens never appear in a URL.
+// Otherwise the login response is returned as JSON.
+func (h *Handlers) HandleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	dashboardURL := h.service.oidcDashboardURL()
+	fail := func(status int, message string) {
+		if dashboardURL != "" {
+			http.Redirect(w, r, dashboardURL+"/login?error="+url.QueryEscape(message), http.StatusFound)
+			return
+		}
+		writeError(w, status, message)
+	}
+
+	var browserState string
+	if cookie, err := r.Cookie(oidcStateCookieName); err == nil {
+		browserState = cookie.Value
+	}
+	http.SetCookie(w, h.service.oidcStateCookie(""))
+
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		fail(http.StatusUnauthorized, strings.TrimSpace("single sign-on failed: "+providerError+" "+query.Get("error_description")))
+		return
+	}
+	if query.Get("code") == "" || query.Get("state") == "" {
+		fail(http.StatusBadRequest, "code and state are required")
+		return
+	}
+
+	ip := getClientIP(r)
+	userAgent := r.UserAgent()
+
+	loginCode, redirectTo, err := h.service.CompleteOIDCLogin(r.Context(), query.Get("code"), query.Get("state"), browserState, ip, userAgent)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrOIDCNotConfigured):
+			fail(http.StatusNotFound, err.Error())
+		case errors.Is(err, ErrOIDCStateInvalid):
+			fail(http.StatusBadRequest, "login expired, please try again")
+		case errors.Is(err, ErrOIDCAccessDenied):
+			fail(http.StatusForbidden, "your account is not permitted to access this dashboard")
+		case errors.Is(err, ErrOIDCAccountExists), errors.Is(err, ErrOIDCIdentityLinked):
+			fail(http.StatusConflict, err.Error())
+		case errors.Is(err, ErrOIDCLoginFailed):
+			fail(http.StatusUnauthorized, err.Error())
+		default:
+			fail(http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	if dashboardURL != "" {
+		params := url.Values{"code": {loginCode}}
+		if redirectTo != "" {
+			params.Set("redirect_to", redirectTo)
+		}
+		http.Redirect(w, r, dashboardURL+"/login/callback?"+params.Encode(), http.StatusFound)
+		return
+	}
+
+	resp, err := h.service.RedeemOIDCLogin(r.Context(), loginCode, ip, userAgent)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// HandleOIDCToken handles POST /api/v1/auth/oidc/token, exchanging the one-time
+// code from the single sign-on callback for tokens, or for an MFA token when
+// the user must still complete a security key challenge
+func (h *Handlers) HandleOIDCToken(w http.ResponseWriter, r *http.Request) {
+	var req types.OIDCTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Code == "" {
+		writeError(w, http.StatusBadRequest, "code is required")
+		return
+	}
+
+	resp, err := h.service.RedeemOIDCLogin(r.Context(), req.Code, getClientIP(r), r.UserAgent())
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrOIDCNotConfigured):
+			writeError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, ErrAccountTokenInvalid):
+			writeError(w, http.StatusBadRequest, "login expired, please try again")
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// HandleOIDCLink handles POST /api/v1/auth/oidc/link. The returned token starts a
+// login at /api/v1/auth/oidc/login?link= that links the caller's account to
+// their identity at the provider.
+func (h *Handlers) HandleOIDCLink(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	token, err := h.service.StartOIDCLink(r.Context(), user.ID, getClientIP(r), r.UserAgent())
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrOIDCNotConfigured):
+			writeError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, ErrOIDCLoginFailed):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, types.OIDCLinkResponse{Token: token})
+}
+
 // Context key for user
 type contextKey string
 
-const userContextKey contextKey = "user"
+const (
+	userContextKey     contextKey = "user"
+	apiTokenContextKey contextKey = "api_token"
+	sessionContextKey  contextKey = "session"
+)
 
 // GetUserFromContext extracts the user from the request context
 func GetUserFromContext(ctx context.Context) *types.User {
@@ -524,7 +1343,48 @@ func GetUserFromContext(ctx context.Context) *types.User {
 	return user
 }
 
+// GetSessionIDFromContext returns the session of the access token that
+// authenticated the request, or "" if there is none
+func GetSessionIDFromContext(ctx context.Context) string {
+	sessionID, _ := ctx.Value(sessionContextKey).(string)
+	return sessionID
+}
+
 // SetUserInContext sets the user in the request context
 func SetUserInContext(ctx context.Context, user *types.User) context.Context {
 	return context.WithValue(ctx, userContextKey, user)
 }
+
+// HandleJWKS handles GET /.well-known/jwks.json
+func (h *Handlers) HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	// Upcoming keys are published an hour before use, so short caching is safe
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, h.service.JWKS())
+}
+
+// HandleListSigningKeys handles GET /api/v1/admin/signing-keys
+func (h *Handlers) HandleListSigningKeys(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.service.SigningKeys())
+}
+
+// HandleRotateSigningKey handles POST /api/v1/admin/signing-keys/rotate
+func (h *Handlers) HandleRotateSigningKey(w http.ResponseWriter, r *http.Request) {
+	var req types.RotateSigningKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	actorID := ""
+	if user := GetUserFromContext(r.Context()); user != nil {
+		actorID = user.ID
+	}
+
+	key, err := h.service.RotateSigningKey(r.Context(), req.RevokePrevious, actorID, getClientIP(r), r.UserAgent())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, key)
+}
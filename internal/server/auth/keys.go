@@ -0,0 +1,509 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+const (
+	// SigningKeyPrepublish is how long a new key is published before it signs
+	// tokens, so verifiers that cache the JWKS know it in time
+	SigningKeyPrepublish = time.Hour
+	// SigningKeyRetention is how long a retired key still verifies tokens. It
+	// outlives every token the key signed.
+	SigningKeyRetention = 24 * time.Hour
+
+	// keyReloadInterval limits reloads caused by tokens with an unknown kid
+	keyReloadInterval = 10 * time.Second
+)
+
+// Signing key algorithms
+const (
+	SigningAlgorithmEdDSA = "EdDSA"
+	SigningAlgorithmES256 = "ES256"
+)
+
+// Signing key statuses
+const (
+	SigningKeyPending = "pending"
+	SigningKeyActive  = "active"
+	SigningKeyRetired = "retired"
+)
+
+var (
+	ErrInvalidSigningAlgorithm = errors.New("JWT algorithm must be EdDSA or ES256")
+	ErrNoSigningKey            = errors.New("no signing key is available")
+)
+
+// KeyManager signs access tokens with asymmetric keys kept in the database,
+// so every replica signs and verifies with the same keys. Each key signs for
+// one rotation period; the next key is created and published ahead of time.
+type KeyManager struct {
+	repo      Repository
+	algorithm string
+	rotation  time.Duration
+	sealKey   [32]byte // encrypts private keys at rest
+
+	mu       sync.RWMutex
+	keys     []*signingKey // ordered by NotBefore
+	loadedAt time.Time
+}
+
+// signingKey is a loaded key. private is nil when the key cannot be decrypted
+// with the configured secret; it can then only verify.
+type signingKey struct {
+	types.SigningKey
+	public  crypto.PublicKey
+	private crypto.Signer
+}
+
+// NewKeyManager creates a key manager. Call Load before signing tokens.
+func NewKeyManager(repo Repository, cfg config.AuthConfig) (*KeyManager, error) {
+	if cfg.JWTAlgorithm != SigningAlgorithmEdDSA && cfg.JWTAlgorithm != SigningAlgorithmES256 {
+		return nil, ErrInvalidSigningAlgorithm
+	}
+	if cfg.JWTKeyRotation <= SigningKeyPrepublish {
+		return nil, fmt.Errorf("JWT key rotation must be longer than %s", SigningKeyPrepublish)
+	}
+
+	return &KeyManager{
+		repo:      repo,
+		algorithm: cfg.JWTAlgorithm,
+		rotation:  cfg.JWTKeyRotation,
+		sealKey:   sha256.Sum256([]byte("mysoc-updates signing keys\x00" + cfg.JWTSecret)),
+	}, nil
+}
+
+// Load creates the first signing key if needed and loads all keys
+func (m *KeyManager) Load(ctx context.Context) error {
+	_, err := m.update(ctx, false, false)
+	return err
+}
+
+// Run creates upcoming keys and reloads keys rotated by other replicas every
+// interval until ctx is cancelled
+func (m *KeyManager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := m.update(ctx, false, false); err != nil {
+				log.Printf("Signing key rotation failed: %v", err)
+			}
+		}
+	}
+}
+
+// Rotate retires the current signing key and starts signing with a new one.
+// With revokePrevious, tokens signed by earlier keys stop verifying at once.
+func (m *KeyManager) Rotate(ctx context.Context, revokePrevious bool) (*types.SigningKey, error) {
+	return m.update(ctx, true, revokePrevious)
+}
+
+// Keys lists the keys that currently verify tokens
+func (m *KeyManager) Keys() []types.SigningKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	keys := make([]types.SigningKey, len(m.keys))
+	for i, key := range m.keys {
+		keys[i] = key.SigningKey
+		keys[i].Status = signingKeyStatus(&key.SigningKey, now)
+	}
+	return keys
+}
+
+// JWKS returns the public keys that verify tokens, including upcoming ones
+func (m *KeyManager) JWKS() types.JWKS {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	jwks := types.JWKS{Keys: []types.JWK{}}
+	for _, key := range m.keys {
+		jwk, err := publicJWK(key)
+		if err != nil {
+			log.Printf("Failed to publish signing key %s: %v", key.ID, err)
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
+
+// Sign signs claims with the current key and sets the kid header
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	key := m.current(time.Now())
+	if key == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.private)
+}
+
+// Keyfunc selects the verification key for a token by its kid header
+func (m *KeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid")
+	}
+
+	key := m.find(kid)
+	if key == nil && m.reloadDue() {
+		// The key may have been rotated in by another replica
+		if err := m.reload(context.Background()); err != nil {
+			log.Printf("Failed to reload signing keys: %v", err)
+		}
+		key = m.find(kid)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.public, nil
+}
+
+// ValidMethods lists the algorithms tokens may be signed with
+func (m *KeyManager) ValidMethods() []string {
+	return []string{SigningAlgorithmEdDSA, SigningAlgorithmES256}
+}
+
+// current returns the newest key that signs at now and can be decrypted
+func (m *KeyManager) current(now time.Time) *signingKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for i := len(m.keys) - 1; i >= 0; i-- {
+		key := m.keys[i]
+		if key.private != nil && signingKeyStatus(&key.SigningKey, now) == SigningKeyActive {
+			return key
+		}
+	}
+	return nil
+}
+
+func (m *KeyManager) find(kid string) *signingKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, key := range m.keys {
+		if key.ID == kid && time.Now().Before(key.ExpiresAt) {
+			return key
+		}
+	}
+	return nil
+}
+
+func (m *KeyManager) reloadDue() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return time.Since(m.loadedAt) > keyReloadInterval
+}
+
+func (m *KeyManager) reload(ctx context.Context) error {
+	records, err := m.repo.ListSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+	return m.setKeys(records)
+}
+
+// update plans key changes under the repository's lock and loads the result.
+// It returns the key that signs from now on.
+func (m *KeyManager) update(ctx context.Context, rotate, revokePrevious bool) (*types.SigningKey, error) {
+	var created []*signingKeyRecord
+	records, err := m.repo.UpdateSigningKeys(ctx, func(keys []*signingKeyRecord, now time.Time) ([]*signingKeyRecord, error) {
+		var err error
+		created, err = m.plan(keys, now, rotate, revokePrevious)
+		return created, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := m.setKeys(records); err != nil {
+		return nil, err
+	}
+
+	for _, key := range created {
+		log.Printf("Created %s signing key %s, signing from %s", key.Algorithm, key.ID, key.NotBefore.Format(time.RFC3339))
+	}
+
+	current := m.current(time.Now())
+	if current == nil {
+		return nil, ErrNoSigningKey
+	}
+	key := current.SigningKey
+	key.Status = SigningKeyActive
+	return &key, nil
+}
+
+// plan retires keys and returns the keys to create so that one key signs at
+// now and, within SigningKeyPrepublish of its end, the next one is published.
+// rotate retires every key and starts a new one at now.
+func (m *KeyManager) plan(keys []*signingKeyRecord, now time.Time, rotate, revokePrevious bool) ([]*signingKeyRecord, error) {
+	var current, next *signingKeyRecord
+	for _, key := range keys {
+		if rotate {
+			retireSigningKey(key, now, revokePrevious)
+			continue
+		}
+		if !m.canSign(key) {
+			// Keys sealed with another JWT_SECRET stop signing but keep verifying
+			if signingKeyStatus(&key.SigningKey, now) != SigningKeyRetired {
+				retireSigningKey(key, now, false)
+			}
+			continue
+		}
+		switch {
+		case signingKeyStatus(&key.SigningKey, now) == SigningKeyActive:
+			current = key
+		case current != nil && !key.NotBefore.Before(current.NotAfter):
+			next = key
+		}
+	}
+
+	var created []*signingKeyRecord
+	if current == nil {
+		key, err := m.generate(now)
+		if err != nil {
+			return nil, err
+		}
+		current = key
+		created = append(created, key)
+	}
+	if next == nil && current.NotAfter.Sub(now) <= SigningKeyPrepublish {
+		key, err := m.generate(current.NotAfter)
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, key)
+	}
+	return created, nil
+}
+
+func (m *KeyManager) setKeys(records []*signingKeyRecord) error {
+	keys := make([]*signingKey, 0, len(records))
+	for _, record := range records {
+		key, err := m.open(record)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys = keys
+	m.loadedAt = time.Now()
+	return nil
+}
+
+// retireSigningKey stops a key signing at now. A revoked key stops verifying too.
+func retireSigningKey(key *signingKeyRecord, now time.Time, revoke bool) {
+	if key.NotBefore.After(now) {
+		key.NotBefore = now
+	}
+	if key.NotAfter.After(now) {
+		key.NotAfter = now
+		key.ExpiresAt = now.Add(SigningKeyRetention)
+	}
+	if revoke {
+		key.ExpiresAt = now
+	}
+}
+
+func signingKeyStatus(key *types.SigningKey, now time.Time) string {
+	switch {
+	case now.Before(key.NotBefore):
+		return SigningKeyPending
+	case now.Before(key.NotAfter):
+		return SigningKeyActive
+	default:
+		return SigningKeyRetired
+	}
+}
+
+// generate creates a key that signs for one rotation period from notBefore
+func (m *KeyManager) generate(notBefore time.Time) (*signingKeyRecord, error) {
+	var private crypto.Signer
+	var err error
+	switch m.algorithm {
+	case SigningAlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case SigningAlgorithmES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		err = ErrInvalidSigningAlgorithm
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	record := &signingKeyRecord{SigningKey: types.SigningKey{
+		ID:        base64.RawURLEncoding.EncodeToString(id),
+		Algorithm: m.algorithm,
+		NotBefore: notBefore,
+		NotAfter:  notBefore.Add(m.rotation),
+		ExpiresAt: notBefore.Add(m.rotation + SigningKeyRetention),
+		CreatedAt: time.Now(),
+	}}
+	if record.PublicKey, err = x509.MarshalPKIXPublicKey(private.Public()); err != nil {
+		return nil, err
+	}
+	if record.PrivateKey, err = m.seal(record.ID, private); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (m *KeyManager) canSign(record *signingKeyRecord) bool {
+	_, err := m.unseal(record.ID, record.PrivateKey)
+	return err == nil
+}
+
+// open parses a stored key. The private key is left out if it cannot be decrypted.
+func (m *KeyManager) open(record *signingKeyRecord) (*signingKey, error) {
+	public, err := x509.ParsePKIXPublicKey(record.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key for signing key %s: %w", record.ID, err)
+	}
+
+	key := &signingKey{SigningKey: record.SigningKey, public: public}
+	if private, err := m.unseal(record.ID, record.PrivateKey); err == nil {
+		key.private = private
+	}
+	return key, nil
+}
+
+// seal encrypts a private key with AES-GCM, bound to its kid
+func (m *KeyManager) seal(kid string, private crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := m.gcm()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, der, []byte(kid)), nil
+}
+
+func (m *KeyManager) unseal(kid string, sealed []byte) (crypto.Signer, error) {
+	gcm, err := m.gcm()
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("sealed key is too short")
+	}
+
+	der, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(kid))
+	if err != nil {
+		return nil, err
+	}
+	private, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", private)
+	}
+	return signer, nil
+}
+
+func (m *KeyManager) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(m.sealKey[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// publicJWK formats a key's public half as a JWK
+func publicJWK(key *signingKey) (types.JWK, error) {
+	jwk := types.JWK{Kid: key.ID, Use: "sig", Alg: key.Algorithm}
+
+	switch public := key.public.(type) {
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	case *ecdsa.PublicKey:
+		point, err := public.ECDH()
+		if err != nil {
+			return jwk, err
+		}
+		// Uncompressed point: 0x04 || X || Y
+		raw := point.Bytes()
+		size := (len(raw) - 1) / 2
+		jwk.Kty = "EC"
+		jwk.Crv = public.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(raw[1 : 1+size])
+		jwk.Y = base64.RawURLEncoding.EncodeToString(raw[1+size:])
+	default:
+		return jwk, fmt.Errorf("unsupported key type %T", key.public)
+	}
+	return jwk, nil
+}
+
+// JWKS returns the public keys that verify access tokens
+func (s *Service) JWKS() types.JWKS {
+	return s.keys.JWKS()
+}
+
+// SigningKeys lists the keys that sign or verify access tokens
+func (s *Service) SigningKeys() []types.SigningKey {
+	return s.keys.Keys()
+}
+
+// RotateSigningKey starts signing with a new key at once, e.g. after a leak
+func (s *Service) RotateSigningKey(ctx context.Context, revokePrevious bool, actorID, ip, userAgent string) (*types.SigningKey, error) {
+	key, err := s.keys.Rotate(ctx, revokePrevious)
+	if err != nil {
+		return nil, err
+	}
+
+	s.repo.LogAuditEvent(ctx, actorID, "signing_key_rotate", ip, userAgent, map[string]interface{}{
+		"kid":             key.ID,
+		"revoke_previous": revokePrevious,
+	})
+	return key, nil
+}
@@ -0,0 +1,375 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database/dbtest"
+)
+
+const testRotation = 30 * 24 * time.Hour
+
+func newTestKeyManager(t *testing.T, repo Repository, algorithm, secret string) *KeyManager {
+	t.Helper()
+	m, err := NewKeyManager(repo, config.AuthConfig{JWTSecret: secret, JWTAlgorithm: algorithm, JWTKeyRotation: testRotation})
+	if err != nil {
+		t.Fatalf("NewKeyManager: %v", err)
+	}
+	return m
+}
+
+// signTest signs a short-lived token with m's current key
+func signTest(t *testing.T, m *KeyManager) string {
+	t.Helper()
+	token, err := m.Sign(jwt.RegisteredClaims{Subject: "alice", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return token
+}
+
+// verifyTest verifies a token the way JWTMiddleware does
+func verifyTest(m *KeyManager, token string) error {
+	_, err := jwt.Parse(token, m.Keyfunc, jwt.WithValidMethods(m.ValidMethods()))
+	return err
+}
+
+func kidOf(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified: %v", err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestKeyRotation(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		ctx := context.Background()
+		for _, algorithm := range []string{SigningAlgorithmEdDSA, SigningAlgorithmES256} {
+			m := newTestKeyManager(t, NewRepository(db), algorithm, "rotation-secret-"+algorithm)
+			if err := m.Load(ctx); err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			first := signTest(t, m)
+			if err := verifyTest(m, first); err != nil {
+				t.Fatalf("%s: verify = %v", algorithm, err)
+			}
+
+			// Tokens signed by the previous key keep verifying after a rotation
+			key, err := m.Rotate(ctx, false)
+			if err != nil {
+				t.Fatalf("Rotate: %v", err)
+			}
+			second := signTest(t, m)
+			if kidOf(t, second) != key.ID || key.ID == kidOf(t, first) {
+				t.Errorf("%s: after Rotate signed with %s, want the new key %s", algorithm, kidOf(t, second), key.ID)
+			}
+			for name, token := range map[string]string{"previous key": first, "new key": second} {
+				if err := verifyTest(m, token); err != nil {
+					t.Errorf("%s: token signed by the %s = %v, want it verified", algorithm, name, err)
+				}
+			}
+			statuses := make(map[string]string)
+			for _, key := range m.Keys() {
+				statuses[key.ID] = key.Status
+			}
+			if statuses[kidOf(t, first)] != SigningKeyRetired || statuses[key.ID] != SigningKeyActive {
+				t.Errorf("%s: key statuses = %v, want the previous key retired and the new one active", algorithm, statuses)
+			}
+
+			// Revoking stops every earlier key verifying at once
+			key, err = m.Rotate(ctx, true)
+			if err != nil {
+				t.Fatalf("Rotate(revoke): %v", err)
+			}
+			for name, token := range map[string]string{"first key": first, "second key": second} {
+				if err := verifyTest(m, token); err == nil {
+					t.Errorf("%s: token signed by the revoked %s verified", algorithm, name)
+				}
+			}
+			if third := signTest(t, m); kidOf(t, third) != key.ID || verifyTest(m, third) != nil {
+				t.Errorf("%s: token after revoking = kid %s, %v; want a verified token from %s",
+					algorithm, kidOf(t, third), verifyTest(m, third), key.ID)
+			}
+		}
+	})
+}
+
+func TestKeyfuncRejected(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		m := newTestKeyManager(t, NewRepository(db), SigningAlgorithmEdDSA, "keyfunc-secret")
+		if err := m.Load(context.Background()); err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		kid := kidOf(t, signTest(t, m))
+		claims := jwt.RegisteredClaims{Subject: "mallory", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}
+
+		// forge signs claims with another method and key under a kid
+		forge := func(method jwt.SigningMethod, key interface{}, kid string) string {
+			token := jwt.NewWithClaims(method, claims)
+			if kid != "" {
+				token.Header["kid"] = kid
+			}
+			signed, err := token.SignedString(key)
+			if err != nil {
+				t.Fatalf("sign %s: %v", method.Alg(), err)
+			}
+			return signed
+		}
+		_, otherEd25519, _ := ed25519.GenerateKey(rand.Reader)
+		otherECDSA, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		public := m.find(kid).public
+
+		tests := []struct {
+			name    string
+			token   string
+			wantErr string
+		}{
+			{"no kid", forge(jwt.SigningMethodEdDSA, otherEd25519, ""), "token has no kid"},
+			{"unknown kid", forge(jwt.SigningMethodEdDSA, otherEd25519, "no-such-key"), "unknown signing key"},
+			{"other key", forge(jwt.SigningMethodEdDSA, otherEd25519, kid), "signature is invalid"},
+			// The algorithm comes from the kid's key, never from the token
+			{"ES256 under an EdDSA kid", forge(jwt.SigningMethodES256, otherECDSA, kid), "unexpected signing method"},
+			{"HS256 keyed with the public key", forge(jwt.SigningMethodHS256, []byte(public.(ed25519.PublicKey)), kid), "unexpected signing method"},
+		}
+		for _, tt := range tests {
+			// Keyfunc rejects them on its own, without WithValidMethods
+			if _, err := jwt.Parse(tt.token, m.Keyfunc); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: verify = %v, want %q", tt.name, err, tt.wantErr)
+			}
+		}
+
+		// A key past its expiry no longer verifies
+		token := signTest(t, m)
+		m.mu.Lock()
+		for _, key := range m.keys {
+			key.ExpiresAt = time.Now().Add(-time.Second)
+		}
+		m.loadedAt = time.Now()
+		m.mu.Unlock()
+		if err := verifyTest(m, token); err == nil || !strings.Contains(err.Error(), "unknown signing key") {
+			t.Errorf("token of an expired key = %v, want an unknown signing key", err)
+		}
+	})
+}
+
+func TestKeyfuncReload(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		ctx := context.Background()
+		repo := NewRepository(db)
+
+		// Two replicas sharing the keys; one of them rotates
+		rotating := newTestKeyManager(t, repo, SigningAlgorithmEdDSA, "reload-secret")
+		other := newTestKeyManager(t, repo, SigningAlgorithmEdDSA, "reload-secret")
+		for _, m := range []*KeyManager{rotating, other} {
+			if err := m.Load(ctx); err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+		}
+		if _, err := rotating.Rotate(ctx, false); err != nil {
+			t.Fatalf("Rotate: %v", err)
+		}
+		token := signTest(t, rotating)
+
+		// Unknown kids reload at most every keyReloadInterval
+		if err := verifyTest(other, token); err == nil {
+			t.Error("token of a key created since the last reload verified without reloading")
+		}
+		other.mu.Lock()
+		other.loadedAt = time.Now().Add(-keyReloadInterval - time.Second)
+		other.mu.Unlock()
+		if err := verifyTest(other, token); err != nil {
+			t.Errorf("token of a key rotated in by another replica = %v, want it verified after a reload", err)
+		}
+	})
+}
+
+func TestJWKS(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		for _, algorithm := range []string{SigningAlgorithmEdDSA, SigningAlgorithmES256} {
+			m := newTestKeyManager(t, NewRepository(db), algorithm, "jwks-secret-"+algorithm)
+			if err := m.Load(context.Background()); err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+
+			jwks := m.JWKS()
+			if len(jwks.Keys) == 0 {
+				t.Fatalf("%s: JWKS is empty", algorithm)
+			}
+			encoded, err := json.Marshal(jwks)
+			if err != nil {
+				t.Fatalf("marshal JWKS: %v", err)
+			}
+			var raw struct{ Keys []map[string]interface{} }
+			if err := json.Unmarshal(encoded, &raw); err != nil {
+				t.Fatalf("unmarshal JWKS: %v", err)
+			}
+			for _, jwk := range raw.Keys {
+				for _, private := range []string{"d", "p", "q", "dp", "dq", "qi", "k"} {
+					if _, ok := jwk[private]; ok {
+						t.Errorf("%s: JWK %v has private member %q", algorithm, jwk["kid"], private)
+					}
+				}
+			}
+
+			// Each JWK is the public half of a loaded key, including the keys
+			// earlier runs left with another algorithm
+			signing := m.current(time.Now())
+			published := false
+			for _, jwk := range jwks.Keys {
+				published = published || jwk.Kid == signing.ID
+				key := m.find(jwk.Kid)
+				if key == nil || jwk.Alg != key.Algorithm || jwk.Use != "sig" {
+					t.Errorf("%s: JWK %+v does not describe a loaded key", algorithm, jwk)
+					continue
+				}
+				x, _ := base64.RawURLEncoding.DecodeString(jwk.X)
+				y, _ := base64.RawURLEncoding.DecodeString(jwk.Y)
+				switch public := key.public.(type) {
+				case ed25519.PublicKey:
+					if jwk.Kty != "OKP" || jwk.Crv != "Ed25519" || !public.Equal(ed25519.PublicKey(x)) || jwk.Y != "" {
+						t.Errorf("%s: JWK %+v does not match the public key", algorithm, jwk)
+					}
+				case *ecdsa.PublicKey:
+					if jwk.Kty != "EC" || jwk.Crv != "P-256" || len(x) != 32 || len(y) != 32 ||
+						public.X.Cmp(new(big.Int).SetBytes(x)) != 0 || public.Y.Cmp(new(big.Int).SetBytes(y)) != 0 {
+						t.Errorf("%s: JWK %+v does not match the public key", algorithm, jwk)
+					}
+				}
+			}
+			if !published || signing.Algorithm != algorithm {
+				t.Errorf("%s: JWKS does not publish the %s signing key %s", algorithm, signing.Algorithm, signing.ID)
+			}
+		}
+	})
+}
+
+func TestKeyPlan(t *testing.T) {
+	m := newTestKeyManager(t, nil, SigningAlgorithmEdDSA, "plan-secret")
+	other := newTestKeyManager(t, nil, SigningAlgorithmEdDSA, "another-secret")
+	now := time.Now()
+
+	// key returns a key of manager signing from notBefore
+	key := func(manager *KeyManager, notBefore time.Time) *signingKeyRecord {
+		record, err := manager.generate(notBefore)
+		if err != nil {
+			t.Fatalf("generate: %v", err)
+		}
+		return record
+	}
+
+	t.Run("no keys", func(t *testing.T) {
+		created, err := m.plan(nil, now, false, false)
+		if err != nil || len(created) != 1 || !created[0].NotBefore.Equal(now) || !created[0].NotAfter.Equal(now.Add(testRotation)) ||
+			!created[0].ExpiresAt.Equal(now.Add(testRotation+SigningKeyRetention)) {
+			t.Errorf("plan = %+v, %v; want one key signing from now for a rotation period", created, err)
+		}
+	})
+
+	t.Run("current key", func(t *testing.T) {
+		if created, err := m.plan([]*signingKeyRecord{key(m, now.Add(-time.Hour))}, now, false, false); err != nil || len(created) != 0 {
+			t.Errorf("plan = %d keys, %v; want none", len(created), err)
+		}
+	})
+
+	// Within SigningKeyPrepublish of its end the next key is published
+	t.Run("current key ending", func(t *testing.T) {
+		current := key(m, now.Add(-testRotation+SigningKeyPrepublish/2))
+		created, err := m.plan([]*signingKeyRecord{current}, now, false, false)
+		if err != nil || len(created) != 1 || !created[0].NotBefore.Equal(current.NotAfter) {
+			t.Fatalf("plan = %+v, %v; want the next key from %s", created, err, current.NotAfter)
+		}
+		if created, err := m.plan([]*signingKeyRecord{current, created[0]}, now, false, false); err != nil || len(created) != 0 {
+			t.Errorf("plan with the next key published = %d keys, %v; want none", len(created), err)
+		}
+	})
+
+	// Keys sealed with another JWT_SECRET cannot sign, but keep verifying
+	t.Run("key of another secret", func(t *testing.T) {
+		foreign := key(other, now.Add(-time.Hour))
+		created, err := m.plan([]*signingKeyRecord{foreign}, now, false, false)
+		if err != nil || len(created) != 1 || !created[0].NotBefore.Equal(now) {
+			t.Errorf("plan = %+v, %v; want a new key from now", created, err)
+		}
+		if !foreign.NotAfter.Equal(now) || !foreign.ExpiresAt.Equal(now.Add(SigningKeyRetention)) {
+			t.Errorf("foreign key signs until %s and verifies until %s, want it retired at now", foreign.NotAfter, foreign.ExpiresAt)
+		}
+	})
+
+	// Rotating retires every key at now, moving up a pending one, and starts a new one
+	for _, revoke := range []bool{false, true} {
+		current := key(m, now.Add(-testRotation+SigningKeyPrepublish/2))
+		pending := key(m, current.NotAfter)
+		created, err := m.plan([]*signingKeyRecord{current, pending}, now, true, revoke)
+		if err != nil || len(created) != 1 || !created[0].NotBefore.Equal(now) {
+			t.Errorf("rotate(revoke %v) = %+v, %v; want a new key from now", revoke, created, err)
+		}
+		wantExpiry := now.Add(SigningKeyRetention)
+		if revoke {
+			wantExpiry = now
+		}
+		for name, key := range map[string]*signingKeyRecord{"current": current, "pending": pending} {
+			if signingKeyStatus(&key.SigningKey, now) != SigningKeyRetired || !key.ExpiresAt.Equal(wantExpiry) {
+				t.Errorf("rotate(revoke %v): %s key signs %s-%s and verifies until %s, want it retired and verifying until %s",
+					revoke, name, key.NotBefore, key.NotAfter, key.ExpiresAt, wantExpiry)
+			}
+		}
+	}
+}
+
+func TestSealUnseal(t *testing.T) {
+	m := newTestKeyManager(t, nil, SigningAlgorithmES256, "seal-secret")
+	other := newTestKeyManager(t, nil, SigningAlgorithmES256, "another-secret")
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	sealed, err := m.seal("kid-1", private)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	opened, err := m.unseal("kid-1", sealed)
+	if err != nil || !private.Equal(opened) {
+		t.Fatalf("unseal = %v, %v; want the sealed key", opened, err)
+	}
+	if again, _ := m.seal("kid-1", private); string(again) == string(sealed) {
+		t.Error("sealing twice gave the same ciphertext; nonces must be random")
+	}
+
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 1
+	tests := []struct {
+		name    string
+		manager *KeyManager
+		kid     string
+		sealed  []byte
+	}{
+		// Sealed keys are bound to their kid, so rows cannot be swapped
+		{"other kid", m, "kid-2", sealed},
+		{"other secret", other, "kid-1", sealed},
+		{"tampered", m, "kid-1", tampered},
+		{"truncated", m, "kid-1", sealed[:8]},
+		{"empty", m, "kid-1", nil},
+	}
+	for _, tt := range tests {
+		if key, err := tt.manager.unseal(tt.kid, tt.sealed); err == nil {
+			t.Errorf("unseal(%s) = %v, want an error", tt.name, key)
+		}
+	}
+}
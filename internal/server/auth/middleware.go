@@ -1,8 +1,14 @@
 package auth
 
 import (
+	"context"
 	"net/http"
 	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/audit"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
 )
 
 // JWTMiddleware creates middleware that validates JWT tokens
@@ -26,11 +32,12 @@ func JWTMiddleware(service *Service) func(http.Handler) http.Handler {
 			tokenString := parts[1]
 
 			// Validate token
-			user, err := service.GetUserFromToken(r.Context(), tokenString)
+			user, claims, err := service.authenticate(r.Context(), tokenString)
 			if err != nil {
 				writeError(w, http.StatusUnauthorized, "invalid or expired token")
 				return
 			}
+			audit.SetActor(r.Context(), user, nil)
 
 			// Check if user is active
 			if !user.IsActive {
@@ -38,75 +45,120 @@ func JWTMiddleware(service *Service) func(http.Handler) http.Handler {
 				return
 			}
 
-			// Set user in context
+			// Set user and session in context
 			ctx := SetUserInContext(r.Context(), user)
+			ctx = context.WithValue(ctx, sessionContextKey, claims.SessionID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-// RequireRole middleware checks if the user has the required role
-func RequireRole(roles ...string) func(http.Handler) http.Handler {
+// RequirePermission creates middleware that allows a request only when its credential
+// grants permission. It accepts a user access token ("Authorization: Bearer <jwt>"),
+// whose role must grant the permission (and whose owner must have registered a
+// security key if the role requires one), or an API token (X-API-Key header or
+// "Authorization: Bearer msu_..."), which must carry the permission as a scope while
+// its owner's role still grants it. API tokens restricted to certain products are
+// rejected when the route's {product} is not among them.
+func RequirePermission(service *Service, permission string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			user := GetUserFromContext(r.Context())
-			if user == nil {
-				writeError(w, http.StatusUnauthorized, "unauthorized")
+			ctx, status, message := authorize(service, r, permission)
+			if status != 0 {
+				writeError(w, status, message)
 				return
 			}
-
-			// Check if user has required role
-			hasRole := false
-			for _, role := range roles {
-				if user.Role == role {
-					hasRole = true
-					break
-				}
-			}
-
-			if !hasRole {
-				writeError(w, http.StatusForbidden, "insufficient permissions")
-				return
-			}
-
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-// OptionalJWTMiddleware validates JWT if present but doesn't require it
-func OptionalJWTMiddleware(service *Service) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Get token from Authorization header
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				// No token, continue without user
-				next.ServeHTTP(w, r)
-				return
-			}
+// CallerHasPermission reports whether the request carries a credential that
+// RequirePermission would accept for permission. Public routes use it to show
+// more to signed-in callers; requests without a credential are not allowed.
+func CallerHasPermission(service *Service, r *http.Request, permission string) bool {
+	if r.Header.Get("X-API-Key") == "" && r.Header.Get("Authorization") == "" {
+		return false
+	}
+	_, status, _ := authorize(service, r, permission)
+	return status == 0
+}
 
-			// Extract Bearer token
-			parts := strings.SplitN(authHeader, " ", 2)
-			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-				// Invalid format, continue without user
-				next.ServeHTTP(w, r)
-				return
-			}
+// authorize checks the credential of a request for RequirePermission. It
+// returns the request context with the caller added, or the status and
+// message to reject the request with.
+func authorize(service *Service, r *http.Request, permission string) (context.Context, int, string) {
+	credential := r.Header.Get("X-API-Key")
+	if credential == "" {
+		parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+		if len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
+			credential = parts[1]
+		}
+	}
+	if credential == "" {
+		return nil, http.StatusUnauthorized, "API token or authorization header is required"
+	}
 
-			tokenString := parts[1]
+	// User access token
+	if !strings.HasPrefix(credential, APITokenPrefix) {
+		user, err := service.GetUserFromToken(r.Context(), credential)
+		if err != nil {
+			return nil, http.StatusUnauthorized, "invalid or expired token"
+		}
+		audit.SetActor(r.Context(), user, nil)
+		if !user.IsActive {
+			return nil, http.StatusForbidden, "account is disabled"
+		}
+		enrollment, err := service.WebAuthnEnrollmentRequired(r.Context(), user)
+		if err != nil {
+			return nil, http.StatusInternalServerError, "failed to check security keys"
+		}
+		if enrollment {
+			return nil, http.StatusForbidden, "your role requires a security key; register one before continuing"
+		}
+		allowed, err := service.HasPermission(r.Context(), user, permission)
+		if err != nil {
+			return nil, http.StatusInternalServerError, "failed to check permissions"
+		}
+		if !allowed {
+			return nil, http.StatusForbidden, "missing permission " + permission
+		}
+		return SetUserInContext(r.Context(), user), 0, ""
+	}
 
-			// Validate token
-			user, err := service.GetUserFromToken(r.Context(), tokenString)
-			if err != nil || !user.IsActive {
-				// Invalid token, continue without user
-				next.ServeHTTP(w, r)
-				return
-			}
+	// API token
+	user, token, err := service.AuthenticateAPIToken(r.Context(), credential, getClientIP(r), r.UserAgent(), r.Method, r.URL.Path)
+	if err != nil {
+		return nil, http.StatusUnauthorized, "invalid, expired or revoked API token"
+	}
+	audit.SetActor(r.Context(), user, token)
+	allowed, err := service.HasPermission(r.Context(), user, permission)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "failed to check permissions"
+	}
+	if !TokenHasScope(token, permission) || !allowed {
+		return nil, http.StatusForbidden, "API token lacks the " + permission + " scope"
+	}
+	if product := chi.URLParam(r, "product"); product != "" && !TokenAllowsProduct(token, product) {
+		return nil, http.StatusForbidden, "API token is not allowed to act on " + product
+	}
 
-			// Set user in context
-			ctx := SetUserInContext(r.Context(), user)
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
+	ctx := SetUserInContext(r.Context(), user)
+	return context.WithValue(ctx, apiTokenContextKey, token), 0, ""
+}
+
+// GetAPITokenFromContext returns the API token that authenticated the request, if any
+func GetAPITokenFromContext(ctx context.Context) *types.APIToken {
+	token, ok := ctx.Value(apiTokenContextKey).(*types.APIToken)
+	if !ok {
+		return nil
 	}
+	return token
+}
+
+// AllowsProduct reports whether the request may act on a product. Only API tokens
+// restricted to certain products are limited.
+func AllowsProduct(ctx context.Context, product string) bool {
+	token := GetAPITokenFromContext(ctx)
+	return token == nil || TokenAllowsProduct(token, product)
 }
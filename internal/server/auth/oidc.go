@@ -0,0 +1,756 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+const (
+	OIDCLoginStateDuration = 10 * time.Minute
+	// OIDCLoginCodeDuration is how long the dashboard has to redeem a completed login
+	OIDCLoginCodeDuration = time.Minute
+	// OIDCLinkTokenDuration is how long a signed-in user has to start linking an identity
+	OIDCLinkTokenDuration = 5 * time.Minute
+	// oidcKeyRefreshInterval limits JWKS refetches triggered by unknown key IDs
+	oidcKeyRefreshInterval = time.Minute
+	// oidcStateCookieName holds the state of a pending login in the browser
+	oidcStateCookieName = "oidc_state"
+)
+
+var (
+	ErrOIDCNotConfigured     = errors.New("single sign-on is not configured")
+	ErrOIDCLoginFailed       = errors.New("single sign-on failed")
+	ErrOIDCAccessDenied      = errors.New("no role is mapped to the user's groups")
+	ErrOIDCAccountExists     = errors.New("an account with this email already exists; sign in to it and link single sign-on from your profile")
+	ErrOIDCIdentityLinked    = errors.New("this identity is already linked to another account")
+	ErrLocalPasswordDisabled = errors.New("password login is disabled for single sign-on users")
+)
+
+// oidcLoginState is a pending authorization-code login
+type oidcLoginState struct {
+	CodeVerifier string
+	Nonce        string
+	RedirectTo   string
+	LinkUserID   string // set when a signed-in user is linking their account
+	ExpiresAt    time.Time
+}
+
+// oidcClaims are the ID token claims used to provision a user
+type oidcClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Groups        []string
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// OIDCProvider performs the authorization-code flow with PKCE against an OpenID
+// Connect provider. Discovery and signing keys are fetched on first use, so the
+// server starts even while the provider is unreachable.
+type OIDCProvider struct {
+	config config.OIDCConfig
+	client *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+// NewOIDCProvider creates a provider for the configured issuer
+func NewOIDCProvider(cfg config.OIDCConfig) *OIDCProvider {
+	return &OIDCProvider{
+		config: cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// AuthCodeURL returns the provider URL that starts a login
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the raw ID token
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"client_id":     {p.config.ClientID},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return "", fmt.Errorf("%w: token endpoint returned %d %s", ErrOIDCLoginFailed, resp.StatusCode, strings.TrimSpace(body.Error+" "+body.ErrorDescription))
+	}
+	if body.IDToken == "" {
+		return "", fmt.Errorf("%w: token response has no id_token", ErrOIDCLoginFailed)
+	}
+	return body.IDToken, nil
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of an ID token
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*oidcClaims, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwt.Parse(rawIDToken, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid ID token: %v", ErrOIDCLoginFailed, err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("%w: invalid ID token", ErrOIDCLoginFailed)
+	}
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+		return nil, fmt.Errorf("%w: ID token nonce does not match", ErrOIDCLoginFailed)
+	}
+
+	result := &oidcClaims{}
+	result.Subject, _ = claims["sub"].(string)
+	result.Email, _ = claims["email"].(string)
+	result.Email = strings.ToLower(strings.TrimSpace(result.Email))
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = verified
+	case string:
+		result.EmailVerified = verified == "true"
+	}
+	result.Name, _ = claims["name"].(string)
+	if result.Name == "" {
+		result.Name, _ = claims["preferred_username"].(string)
+	}
+	switch groups := claims[p.config.GroupsClaim].(type) {
+	case []interface{}:
+		for _, group := range groups {
+			if name, ok := group.(string); ok {
+				result.Groups = append(result.Groups, name)
+			}
+		}
+	case string:
+		result.Groups = strings.Fields(groups)
+	}
+
+	if result.Subject == "" {
+		return nil, fmt.Errorf("%w: ID token has no subject", ErrOIDCLoginFailed)
+	}
+	if result.Email == "" {
+		return nil, fmt.Errorf("%w: ID token has no email claim; request the email scope", ErrOIDCLoginFailed)
+	}
+	if result.Name == "" {
+		result.Name = result.Email
+	}
+	return result, nil
+}
+
+// MapRole returns the role of the first mapping that matches one of groups, or
+// the default role
+func (p *OIDCProvider) MapRole(groups []string) string {
+	if role := p.mappedRole(groups); role != "" {
+		return role
+	}
+	return p.config.DefaultRole
+}
+
+// mappedRole returns the role of the first mapping that matches one of groups,
+// or "" if none does
+func (p *OIDCProvider) mappedRole(groups []string) string {
+	for _, mapping := range p.config.RoleMapping {
+		if containsString(groups, mapping.Group) {
+			return mapping.Role
+		}
+	}
+	return ""
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := p.getJSON(ctx, p.config.IssuerURL+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider: %w", err)
+	}
+	if strings.TrimRight(discovery.Issuer, "/") != p.config.IssuerURL {
+		return nil, fmt.Errorf("OIDC provider reports issuer %q, expected %q", discovery.Issuer, p.config.IssuerURL)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document is missing endpoints")
+	}
+
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// key returns the signing key with a key ID, refetching the key set when the
+// provider has rotated its keys
+func (p *OIDCProvider) key(ctx context.Context, kid string) (interface{}, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < oidcKeyRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, discovery.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch OIDC signing keys: %w", err)
+	}
+
+	keys := make(map[string]interface{})
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := parseJSONWebKey(jwk); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey finds a cached key. Tokens without a key ID are accepted when the
+// provider publishes a single key.
+func (p *OIDCProvider) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, endpoint string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+func parseJSONWebKey(jwk jsonWebKey) (interface{}, error) {
+	decode := func(value string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
+
+// Single sign-on
+
+// EnableOIDC turns on single sign-on through a provider
+func (s *Service) EnableOIDC(provider *OIDCProvider) {
+	s.oidc = provider
+}
+
+// OIDCStatus reports which login methods are available
+func (s *Service) OIDCStatus() types.OIDCStatus {
+	if s.oidc == nil {
+		return types.OIDCStatus{}
+	}
+	return types.OIDCStatus{
+		Enabled:               true,
+		DisableLocalPasswords: s.oidc.config.DisableLocalPasswords,
+	}
+}
+
+func (s *Service) oidcDashboardURL() string {
+	if s.oidc == nil {
+		return ""
+	}
+	return s.oidc.config.DashboardURL
+}
+
+// StartOIDCLogin records a pending login and returns the provider URL to send the
+// browser to, and the state the browser must present again on its return.
+// redirectTo is the dashboard path to return to afterwards. linkToken, from
+// StartOIDCLink, links the identity to the signed-in user who requested it.
+func (s *Service) StartOIDCLogin(ctx context.Context, redirectTo, linkToken string) (string, string, error) {
+	if s.oidc == nil {
+		return "", "", ErrOIDCNotConfigured
+	}
+
+	// Only local paths, so the login cannot be used as an open redirect
+	if !strings.HasPrefix(redirectTo, "/") || strings.HasPrefix(redirectTo, "//") || strings.Contains(redirectTo, "\\") {
+		redirectTo = ""
+	}
+
+	loginState := &oidcLoginState{RedirectTo: redirectTo}
+	if linkToken != "" {
+		userID, err := s.repo.ConsumeAccountToken(ctx, hashToken(linkToken), tokenPurposeOIDCLink)
+		if err != nil {
+			return "", "", err
+		}
+		loginState.LinkUserID = userID
+	}
+
+	var values [3]string
+	for i := range values {
+		value, err := s.generateRefreshToken()
+		if err != nil {
+			return "", "", err
+		}
+		values[i] = strings.TrimRight(value, "=")
+	}
+	state, nonce, codeVerifier := values[0], values[1], values[2]
+	loginState.Nonce, loginState.CodeVerifier = nonce, codeVerifier
+
+	authURL, err := s.oidc.AuthCodeURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := s.repo.CreateOIDCLoginState(ctx, hashToken(state), loginState, time.Now().Add(OIDCLoginStateDuration)); err != nil {
+		return "", "", fmt.Errorf("failed to store login state: %w", err)
+	}
+
+	return authURL, state, nil
+}
+
+// StartOIDCLink returns a short-lived token with which a signed-in user starts a
+// login that links their account to an identity at the provider. Accounts are
+// only linked this way, never by matching email addresses.
+func (s *Service) StartOIDCLink(ctx context.Context, userID, ip, userAgent string) (string, error) {
+	if s.oidc == nil {
+		return "", ErrOIDCNotConfigured
+	}
+
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if user.IsServiceAccount {
+		return "", fmt.Errorf("%w: service accounts cannot use single sign-on", ErrOIDCLoginFailed)
+	}
+
+	token, err := s.generateRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	if err := s.repo.CreateAccountToken(ctx, userID, tokenPurposeOIDCLink, hashToken(token), time.Now().Add(OIDCLinkTokenDuration)); err != nil {
+		return "", err
+	}
+	s.repo.LogAuditEvent(ctx, userID, "oidc_link_started", ip, userAgent, nil)
+
+	return token, nil
+}
+
+// CompleteOIDCLogin redeems the authorization code from the provider callback and
+// provisions, links or updates the user. browserState is the state the browser
+// kept from StartOIDCLogin, so a callback cannot be replayed into another
+// browser. It returns a one-time code for RedeemOIDCLogin, which starts the
+// session, and the dashboard path the login started from.
+func (s *Service) CompleteOIDCLogin(ctx context.Context, code, state, browserState, ip, userAgent string) (string, string, error) {
+	if s.oidc == nil {
+		return "", "", ErrOIDCNotConfigured
+	}
+	if subtle.ConstantTimeCompare([]byte(state), []byte(browserState)) != 1 {
+		return "", "", ErrOIDCStateInvalid
+	}
+
+	loginState, err := s.repo.ConsumeOIDCLoginState(ctx, hashToken(state))
+	if err != nil {
+		return "", "", err
+	}
+
+	rawIDToken, err := s.oidc.Exchange(ctx, code, loginState.CodeVerifier)
+	if err != nil {
+		return "", loginState.RedirectTo, err
+	}
+
+	claims, err := s.oidc.VerifyIDToken(ctx, rawIDToken, loginState.Nonce)
+	if err != nil {
+		return "", loginState.RedirectTo, err
+	}
+
+	user, err := s.resolveOIDCUser(ctx, claims, loginState.LinkUserID, ip, userAgent)
+	if err != nil {
+		return "", loginState.RedirectTo, err
+	}
+
+	loginCode, err := s.generateRefreshToken()
+	if err != nil {
+		return "", loginState.RedirectTo, err
+	}
+	if err := s.repo.CreateAccountToken(ctx, user.ID, tokenPurposeOIDCLogin, hashToken(loginCode), time.Now().Add(OIDCLoginCodeDuration)); err != nil {
+		return "", loginState.RedirectTo, err
+	}
+	return loginCode, loginState.RedirectTo, nil
+}
+
+// RedeemOIDCLogin exchanges the one-time code from CompleteOIDCLogin for a session
+func (s *Service) RedeemOIDCLogin(ctx context.Context, loginCode, ip, userAgent string) (*types.LoginResponse, error) {
+	if s.oidc == nil {
+		return nil, ErrOIDCNotConfigured
+	}
+
+	userID, err := s.repo.ConsumeAccountToken(ctx, hashToken(loginCode), tokenPurposeOIDCLogin)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, errors.New("account is disabled")
+	}
+
+	// The provider is responsible for second factors, except for roles that
+	// must use a security key: they get the same challenge as after a password,
+	// so single sign-on is no way around it
+	challenge, err := s.oidcWebAuthnChallenge(ctx, user)
+	if err != nil || challenge != nil {
+		return challenge, err
+	}
+
+	return s.generateAuthTokens(ctx, user, ip, userAgent)
+}
+
+// oidcStateCookie returns the cookie that keeps the state of a login in the
+// browser that started it. It is scoped to the callback and sent along with the
+// provider's top-level redirect, which SameSite=Lax allows. An empty value
+// clears it.
+func (s *Service) oidcStateCookie(state string) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   int(OIDCLoginStateDuration / time.Second),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if s.oidc != nil {
+		if u, err := url.Parse(s.oidc.config.RedirectURL); err == nil {
+			cookie.Secure = u.Scheme == "https"
+			if u.Path != "" {
+				cookie.Path = u.Path
+			}
+		}
+	}
+	if state == "" {
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
+
+// oidcWebAuthnChallenge returns the security key challenge a user signing in
+// with single sign-on must complete with VerifyMFA, or nil if there is none.
+// Users in a required role who have not registered a key yet are limited to
+// registering one, as after a password login.
+func (s *Service) oidcWebAuthnChallenge(ctx context.Context, user *types.User) (*types.LoginResponse, error) {
+	if !s.webAuthnRequired(user.Role) {
+		return nil, nil
+	}
+	count, err := s.repo.CountWebAuthnCredentials(ctx, user.ID)
+	if err != nil || count == 0 {
+		return nil, err
+	}
+
+	mfaToken, err := s.generateToken(user.ID, user.Email, user.Role, "mfa", "", MFATokenDuration)
+	if err != nil {
+		return nil, err
+	}
+	return &types.LoginResponse{
+		RequiresMFA: true,
+		MFAToken:    mfaToken,
+		MFAMethods:  []string{MFAMethodWebAuthn},
+	}, nil
+}
+
+// resolveOIDCUser finds the user for an identity, linking it to the signed-in
+// user who started the login with linkUserID or provisioning a new account, and
+// applies the role mapped from the user's groups. An existing account with the
+// same email is never linked on its own: whoever controls the email at the
+// provider would otherwise take it over, role and all.
+func (s *Service) resolveOIDCUser(ctx context.Context, claims *oidcClaims, linkUserID, ip, userAgent string) (*types.User, error) {
+	issuer := s.oidc.config.IssuerURL
+
+	identity, err := s.repo.GetIdentity(ctx, issuer, claims.Subject)
+	if err != nil && !errors.Is(err, ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	var user *types.User
+	provisioned := false
+	switch {
+	case identity != nil:
+		if linkUserID != "" && linkUserID != identity.UserID {
+			return nil, ErrOIDCIdentityLinked
+		}
+		user, err = s.repo.GetUserByID(ctx, identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		s.repo.TouchIdentity(ctx, identity.ID, claims.Email)
+
+	case linkUserID != "":
+		user, err = s.repo.GetUserByID(ctx, linkUserID)
+		if err != nil {
+			return nil, err
+		}
+		if user.IsServiceAccount {
+			return nil, fmt.Errorf("%w: service accounts cannot use single sign-on", ErrOIDCLoginFailed)
+		}
+		if err := s.createIdentity(ctx, user.ID, claims); err != nil {
+			return nil, err
+		}
+		s.repo.LogAuditEvent(ctx, user.ID, "oidc_link", ip, userAgent, map[string]interface{}{
+			"issuer":  issuer,
+			"subject": claims.Subject,
+		})
+
+	default:
+		_, err := s.repo.GetUserByEmail(ctx, claims.Email)
+		if err == nil {
+			return nil, ErrOIDCAccountExists
+		}
+		if !errors.Is(err, ErrUserNotFound) {
+			return nil, err
+		}
+
+		role := s.oidc.MapRole(claims.Groups)
+		if role == "" {
+			return nil, ErrOIDCAccessDenied
+		}
+		if err := s.validateRole(ctx, role); err != nil {
+			return nil, err
+		}
+		user, err = s.repo.CreateSSOUser(ctx, claims.Email, claims.Name, role, claims.EmailVerified)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.createIdentity(ctx, user.ID, claims); err != nil {
+			return nil, err
+		}
+		s.repo.LogAuditEvent(ctx, user.ID, "oidc_provision", ip, userAgent, map[string]interface{}{
+			"issuer":  issuer,
+			"subject": claims.Subject,
+			"role":    role,
+			"groups":  claims.Groups,
+		})
+		provisioned = true
+	}
+
+	if !user.IsActive {
+		return nil, errors.New("account is disabled")
+	}
+
+	// The provider decides who may sign in at all, but only a configured group
+	// mapping changes the role of an existing user: the default role is for new
+	// accounts, and never replaces a role an administrator gave
+	if s.oidc.MapRole(claims.Groups) == "" {
+		s.repo.LogAuditEvent(ctx, user.ID, "oidc_denied", ip, userAgent, map[string]interface{}{
+			"groups": claims.Groups,
+		})
+		return nil, ErrOIDCAccessDenied
+	}
+	if role := s.oidc.mappedRole(claims.Groups); !provisioned && role != "" && role != user.Role {
+		if err := s.validateRole(ctx, role); err != nil {
+			return nil, err
+		}
+		previous := user.Role
+		user, err = s.repo.UpdateUserAdmin(ctx, user.ID, "", role, nil)
+		if err != nil {
+			return nil, err
+		}
+		s.repo.LogAuditEvent(ctx, user.ID, "oidc_role_sync", ip, userAgent, map[string]interface{}{
+			"previous_role": previous,
+			"role":          role,
+			"groups":        claims.Groups,
+		})
+	}
+
+	return user, nil
+}
+
+// createIdentity links a user to the identity in claims
+func (s *Service) createIdentity(ctx context.Context, userID string, claims *oidcClaims) error {
+	identity := &types.UserIdentity{
+		UserID:  userID,
+		Issuer:  s.oidc.config.IssuerURL,
+		Subject: claims.Subject,
+		Email:   claims.Email,
+	}
+	if err := s.repo.CreateIdentity(ctx, identity); err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+	return nil
+}
+
+// localPasswordDisabled reports whether a user must sign in through single sign-on
+func (s *Service) localPasswordDisabled(ctx context.Context, userID string) (bool, error) {
+	if s.oidc == nil || !s.oidc.config.DisableLocalPasswords {
+		return false, nil
+	}
+	return s.repo.HasIdentity(ctx, userID)
+}
@@ -0,0 +1,510 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database/dbtest"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+const testClientID = "update-server"
+
+// fakeIssuer is an in-process OpenID Connect provider. Its authorization
+// endpoint signs in whoever has claims set, and its token endpoint enforces
+// PKCE before issuing an ID token with the nonce of the authorization request.
+type fakeIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	claims jwt.MapClaims         // the identity the next login returns
+	nonce  string                // replaces the requested nonce when set
+	signer *rsa.PrivateKey       // replaces the published key when set
+	grants map[string]url.Values // authorization requests by code
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	idp := &fakeIssuer{key: key, grants: make(map[string]url.Values)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "test-key",
+			"kty": "RSA",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("GET /authorize", idp.authorize)
+	mux.HandleFunc("POST /token", idp.token)
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// login sets the identity the next login returns
+func (idp *fakeIssuer) login(subject, email string, verified bool, groups ...string) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.claims = jwt.MapClaims{"sub": subject, "email": email, "email_verified": verified, "name": subject, "groups": groups}
+}
+
+// tamper changes how the issuer misbehaves
+func (idp *fakeIssuer) tamper(change func()) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	change()
+}
+
+func (idp *fakeIssuer) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("response_type") != "code" || query.Get("client_id") != testClientID ||
+		query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	random := make([]byte, 16)
+	rand.Read(random)
+	code := hex.EncodeToString(random)
+	idp.mu.Lock()
+	idp.grants[code] = query
+	idp.mu.Unlock()
+
+	callback, _ := url.Parse(query.Get("redirect_uri"))
+	callback.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+	http.Redirect(w, r, callback.String(), http.StatusFound)
+}
+
+func (idp *fakeIssuer) token(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	grant, ok := idp.grants[r.FormValue("code")]
+	delete(idp.grants, r.FormValue("code"))
+	verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if !ok || r.FormValue("grant_type") != "authorization_code" || r.FormValue("redirect_uri") != grant.Get("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.Get("code_challenge") {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   idp.URL,
+		"aud":   testClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": grant.Get("nonce"),
+	}
+	for name, value := range idp.claims {
+		claims[name] = value
+	}
+	if idp.nonce != "" {
+		claims["nonce"] = idp.nonce
+	}
+	signer := idp.key
+	if idp.signer != nil {
+		signer = idp.signer
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test-key"
+	idToken, err := token.SignedString(signer)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+}
+
+// newOIDCService returns a service signing in through idp, with operators
+// and admins mapped from groups and nobody else let in
+func newOIDCService(t *testing.T, db *database.DB, idp *fakeIssuer) *Service {
+	t.Helper()
+	svc := newTestService(t, db)
+	svc.EnableOIDC(NewOIDCProvider(config.OIDCConfig{
+		IssuerURL:   idp.URL,
+		ClientID:    testClientID,
+		RedirectURL: "https://updates.example.com/api/v1/auth/oidc/callback",
+		Scopes:      []string{"openid", "email", "profile"},
+		GroupsClaim: "groups",
+		RoleMapping: []config.OIDCRoleMapping{{Group: "admins", Role: RoleAdmin}, {Group: "ops", Role: RoleOperator}},
+	}))
+	return svc
+}
+
+// signIn starts a login, follows the provider's authorization endpoint like a
+// browser, completes the login with the code and state it returns and redeems
+// the one-time code as the dashboard does
+func signIn(t *testing.T, svc *Service) (*types.LoginResponse, string, error) {
+	t.Helper()
+	return signInLinking(t, svc, "")
+}
+
+// signInLinking signs in with a link token from StartOIDCLink
+func signInLinking(t *testing.T, svc *Service, linkToken string) (*types.LoginResponse, string, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	authURL, state, err := svc.StartOIDCLogin(ctx, "/releases", linkToken)
+	if err != nil {
+		return nil, "", err
+	}
+	callback := followAuthorization(t, authURL)
+	loginCode, redirectTo, err := svc.CompleteOIDCLogin(ctx, callback.Get("code"), callback.Get("state"), state, "192.0.2.1", "test")
+	if err != nil {
+		return nil, redirectTo, err
+	}
+	resp, err := svc.RedeemOIDCLogin(ctx, loginCode, "192.0.2.1", "test")
+	return resp, redirectTo, err
+}
+
+// followAuthorization sends the browser to authURL and returns the callback parameters
+func followAuthorization(t *testing.T, authURL string) url.Values {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatalf("authorize returned %d without a redirect", resp.StatusCode)
+	}
+	return location.Query()
+}
+
+func TestOIDCLogin(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		idp := newFakeIssuer(t)
+		svc := newOIDCService(t, db, idp)
+
+		tests := []struct {
+			name        string
+			groups      []string
+			defaultRole string
+			wantRole    string
+			wantErr     error
+		}{
+			{"provisioned", []string{"ops"}, "", RoleOperator, nil},
+			// Mapped groups decide the role on every login
+			{"promoted", []string{"staff", "admins", "ops"}, "", RoleAdmin, nil},
+			// The default role is for new accounts only
+			{"default", []string{"staff"}, RoleViewer, RoleAdmin, nil},
+			{"unmapped", []string{"staff"}, "", "", ErrOIDCAccessDenied},
+		}
+		for _, tt := range tests {
+			svc.oidc.config.DefaultRole = tt.defaultRole
+			idp.login("alice", "Alice@Example.com", true, tt.groups...)
+			resp, redirectTo, err := signIn(t, svc)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("%s: CompleteOIDCLogin = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			if err != nil {
+				continue
+			}
+			if resp.AccessToken == "" || resp.User == nil || resp.User.Email != "alice@example.com" || resp.User.Role != tt.wantRole {
+				t.Errorf("%s: login = %+v, want an %s session for alice@example.com", tt.name, resp, tt.wantRole)
+			}
+			if redirectTo != "/releases" {
+				t.Errorf("%s: redirect = %q, want /releases", tt.name, redirectTo)
+			}
+		}
+	})
+}
+
+func TestOIDCLoginRejected(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		ctx := context.Background()
+		idp := newFakeIssuer(t)
+		svc := newOIDCService(t, db, idp)
+		if _, err := NewRepository(db).CreateUser(ctx, "bob@example.com", "hash", "Bob", RoleViewer); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+
+		t.Run("replayed state", func(t *testing.T) {
+			idp.login("alice", "alice@example.com", true, "ops")
+			authURL, state, _ := svc.StartOIDCLogin(ctx, "", "")
+			callback := followAuthorization(t, authURL)
+			if _, _, err := svc.CompleteOIDCLogin(ctx, callback.Get("code"), callback.Get("state"), state, "", ""); err != nil {
+				t.Fatalf("CompleteOIDCLogin: %v", err)
+			}
+			if _, _, err := svc.CompleteOIDCLogin(ctx, callback.Get("code"), callback.Get("state"), state, "", ""); !errors.Is(err, ErrOIDCStateInvalid) {
+				t.Errorf("replayed state = %v, want ErrOIDCStateInvalid", err)
+			}
+		})
+
+		// A callback carried into another browser, which has another state
+		// cookie or none, must not sign that browser in
+		t.Run("state from another browser", func(t *testing.T) {
+			idp.login("alice", "alice@example.com", true, "ops")
+			authURL, state, _ := svc.StartOIDCLogin(ctx, "", "")
+			_, otherState, _ := svc.StartOIDCLogin(ctx, "", "")
+			callback := followAuthorization(t, authURL)
+			for _, browserState := range []string{otherState, ""} {
+				if _, _, err := svc.CompleteOIDCLogin(ctx, callback.Get("code"), callback.Get("state"), browserState, "", ""); !errors.Is(err, ErrOIDCStateInvalid) {
+					t.Errorf("CompleteOIDCLogin(browser state %q) = %v, want ErrOIDCStateInvalid", browserState, err)
+				}
+			}
+			if _, _, err := svc.CompleteOIDCLogin(ctx, callback.Get("code"), callback.Get("state"), state, "", ""); err != nil {
+				t.Errorf("CompleteOIDCLogin in the browser that started it = %v", err)
+			}
+		})
+
+		t.Run("replayed login code", func(t *testing.T) {
+			idp.login("alice", "alice@example.com", true, "ops")
+			authURL, state, _ := svc.StartOIDCLogin(ctx, "", "")
+			callback := followAuthorization(t, authURL)
+			loginCode, _, err := svc.CompleteOIDCLogin(ctx, callback.Get("code"), callback.Get("state"), state, "", "")
+			if err != nil {
+				t.Fatalf("CompleteOIDCLogin: %v", err)
+			}
+			if _, err := svc.RedeemOIDCLogin(ctx, loginCode, "", ""); err != nil {
+				t.Fatalf("RedeemOIDCLogin: %v", err)
+			}
+			if _, err := svc.RedeemOIDCLogin(ctx, loginCode, "", ""); !errors.Is(err, ErrAccountTokenInvalid) {
+				t.Errorf("replayed login code = %v, want ErrAccountTokenInvalid", err)
+			}
+		})
+
+		t.Run("wrong code verifier", func(t *testing.T) {
+			authURL, _, _ := svc.StartOIDCLogin(ctx, "", "")
+			callback := followAuthorization(t, authURL)
+			if _, err := svc.oidc.Exchange(ctx, callback.Get("code"), "not-the-verifier"); !errors.Is(err, ErrOIDCLoginFailed) {
+				t.Errorf("Exchange with another verifier = %v, want ErrOIDCLoginFailed", err)
+			}
+		})
+
+		t.Run("wrong nonce", func(t *testing.T) {
+			idp.nonce = "another-login"
+			defer func() { idp.nonce = "" }()
+			if _, _, err := signIn(t, svc); !errors.Is(err, ErrOIDCLoginFailed) {
+				t.Errorf("CompleteOIDCLogin = %v, want ErrOIDCLoginFailed", err)
+			}
+		})
+
+		t.Run("unknown signing key", func(t *testing.T) {
+			forger, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				t.Fatalf("generate key: %v", err)
+			}
+			idp.signer = forger
+			defer func() { idp.signer = nil }()
+			if _, _, err := signIn(t, svc); !errors.Is(err, ErrOIDCLoginFailed) {
+				t.Errorf("CompleteOIDCLogin = %v, want ErrOIDCLoginFailed", err)
+			}
+		})
+
+		// Whoever controls the email at the provider does not get the account,
+		// verified or not
+		t.Run("email of local account", func(t *testing.T) {
+			for _, verified := range []bool{false, true} {
+				idp.login("mallory", "bob@example.com", verified, "admins")
+				if _, _, err := signIn(t, svc); !errors.Is(err, ErrOIDCAccountExists) {
+					t.Errorf("CompleteOIDCLogin(email_verified %v) = %v, want ErrOIDCAccountExists", verified, err)
+				}
+			}
+		})
+	})
+}
+
+func TestOIDCLink(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		ctx := context.Background()
+		idp := newFakeIssuer(t)
+		svc := newOIDCService(t, db, idp)
+		svc.oidc.config.DefaultRole = RoleViewer
+		repo := NewRepository(db)
+		root, err := repo.CreateUser(ctx, "root@example.com", "hash", "Root", RoleAdmin)
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		other, err := repo.CreateUser(ctx, "other@example.com", "hash", "Other", RoleViewer)
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+
+		// The local admin links their identity and keeps their role, although
+		// their groups only earn the default role
+		idp.login("root-at-idp", "someone-else@example.com", true, "staff")
+		linkToken, err := svc.StartOIDCLink(ctx, root.ID, "", "")
+		if err != nil {
+			t.Fatalf("StartOIDCLink: %v", err)
+		}
+		resp, _, err := signInLinking(t, svc, linkToken)
+		if err != nil {
+			t.Fatalf("linking login: %v", err)
+		}
+		if resp.User == nil || resp.User.ID != root.ID || resp.User.Role != RoleAdmin {
+			t.Errorf("linking login = %+v, want an admin session for %s", resp.User, root.ID)
+		}
+		if _, _, err := svc.StartOIDCLogin(ctx, "", linkToken); !errors.Is(err, ErrAccountTokenInvalid) {
+			t.Errorf("reused link token = %v, want ErrAccountTokenInvalid", err)
+		}
+
+		// Later logins find the linked account, and only a mapped group changes its role
+		if resp, _, err := signIn(t, svc); err != nil || resp.User.ID != root.ID || resp.User.Role != RoleAdmin {
+			t.Errorf("login without a mapped group = %+v, %v; want admin %s", resp, err, root.ID)
+		}
+		idp.login("root-at-idp", "someone-else@example.com", true, "ops")
+		if resp, _, err := signIn(t, svc); err != nil || resp.User.ID != root.ID || resp.User.Role != RoleOperator {
+			t.Errorf("login with a mapped group = %+v, %v; want operator %s", resp, err, root.ID)
+		}
+
+		// An identity belongs to one account
+		linkToken, err = svc.StartOIDCLink(ctx, other.ID, "", "")
+		if err != nil {
+			t.Fatalf("StartOIDCLink: %v", err)
+		}
+		if _, _, err := signInLinking(t, svc, linkToken); !errors.Is(err, ErrOIDCIdentityLinked) {
+			t.Errorf("linking another account's identity = %v, want ErrOIDCIdentityLinked", err)
+		}
+	})
+}
+
+func TestOIDCLoginWebAuthnChallenge(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		idp := newFakeIssuer(t)
+		svc := newOIDCService(t, db, idp)
+		svc.EnableWebAuthn(NewWebAuthn(config.WebAuthnConfig{RPID: "updates.example.com", RequiredRoles: []string{RoleAdmin}}))
+
+		// Until a security key is registered the session is limited to registering one
+		idp.login("alice", "alice@example.com", true, "admins")
+		resp, _, err := signIn(t, svc)
+		if err != nil || resp.RequiresMFA || resp.AccessToken == "" {
+			t.Fatalf("login without a security key = %+v, %v; want a session", resp, err)
+		}
+
+		credential := &types.WebAuthnCredential{
+			UserID:       resp.User.ID,
+			Name:         "key",
+			CredentialID: "credential-1",
+			PublicKey:    []byte{0xa0},
+		}
+		if err := svc.repo.CreateWebAuthnCredential(context.Background(), credential); err != nil {
+			t.Fatalf("CreateWebAuthnCredential: %v", err)
+		}
+
+		resp, _, err = signIn(t, svc)
+		if err != nil {
+			t.Fatalf("CompleteOIDCLogin: %v", err)
+		}
+		if !resp.RequiresMFA || resp.MFAToken == "" || resp.AccessToken != "" ||
+			len(resp.MFAMethods) != 1 || resp.MFAMethods[0] != MFAMethodWebAuthn {
+			t.Errorf("login with a security key = %+v, want a WebAuthn challenge and no session", resp)
+		}
+
+		// Roles without the requirement leave second factors to the provider
+		idp.login("carol", "carol@example.com", true, "ops")
+		if resp, _, err := signIn(t, svc); err != nil || resp.RequiresMFA || resp.AccessToken == "" {
+			t.Errorf("operator login = %+v, %v; want a session", resp, err)
+		}
+	})
+}
+
+func TestOIDCHandlers(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		idp := newFakeIssuer(t)
+		svc := newOIDCService(t, db, idp)
+		svc.oidc.config.DashboardURL = "https://dashboard.example.com"
+		handlers := NewHandlers(svc)
+		idp.login("alice", "alice@example.com", true, "ops")
+
+		// start sends a browser to the provider and returns the state cookie it gets
+		start := func() (*http.Cookie, url.Values) {
+			w := httptest.NewRecorder()
+			handlers.HandleOIDCLogin(w, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/login?redirect_to=/releases", nil))
+			if w.Code != http.StatusFound {
+				t.Fatalf("login = %d, want a redirect", w.Code)
+			}
+			cookies := w.Result().Cookies()
+			if len(cookies) != 1 {
+				t.Fatalf("login set %d cookies, want the state cookie", len(cookies))
+			}
+			return cookies[0], followAuthorization(t, w.Header().Get("Location"))
+		}
+		callback := func(callback url.Values, cookie *http.Cookie) *url.URL {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/callback?"+callback.Encode(), nil)
+			if cookie != nil {
+				r.AddCookie(cookie)
+			}
+			w := httptest.NewRecorder()
+			handlers.HandleOIDCCallback(w, r)
+			location, err := w.Result().Location()
+			if err != nil {
+				t.Fatalf("callback = %d, want a redirect", w.Code)
+			}
+			return location
+		}
+
+		cookie, params := start()
+		if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode ||
+			cookie.Path != "/api/v1/auth/oidc/callback" || cookie.Value != params.Get("state") {
+			t.Errorf("state cookie = %+v, want the state, HttpOnly, Secure, SameSite=Lax and scoped to the callback", cookie)
+		}
+
+		// Without the cookie of the browser that started it the login fails
+		if location := callback(params, nil); location.Path != "/login" || location.Query().Get("error") == "" {
+			t.Errorf("callback without the state cookie went to %s, want the login page with an error", location)
+		}
+
+		cookie, params = start()
+		location := callback(params, cookie)
+		if location.Host != "dashboard.example.com" || location.Path != "/login/callback" || location.Fragment != "" {
+			t.Fatalf("callback went to %s, want the dashboard callback page", location)
+		}
+		query := location.Query()
+		if query.Get("access_token") != "" || query.Get("refresh_token") != "" || query.Get("code") == "" || query.Get("redirect_to") != "/releases" {
+			t.Errorf("callback parameters = %v, want a login code and no tokens", query)
+		}
+
+		redeem := func(code string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			body, _ := json.Marshal(types.OIDCTokenRequest{Code: code})
+			handlers.HandleOIDCToken(w, httptest.NewRequest(http.MethodPost, "/api/v1/auth/oidc/token", bytes.NewReader(body)))
+			return w
+		}
+		w := redeem(query.Get("code"))
+		var resp types.LoginResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || w.Code != http.StatusOK || resp.AccessToken == "" {
+			t.Errorf("redeeming the login code = %d %+v, want a session", w.Code, resp)
+		}
+		if w := redeem(query.Get("code")); w.Code != http.StatusBadRequest {
+			t.Errorf("redeeming the login code again = %d, want 400", w.Code)
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package auth
+
+import "github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+
+// Permissions checked by the API. API token scopes are permissions too.
+const (
+	PermLicensesRead     = "licenses:read"
+	PermLicensesWrite    = "licenses:write"
+	PermInstancesRead    = "instances:read"
+	PermInstancesDelete  = "instances:delete"
+	PermInstancesManage  = "instances:manage"
+	PermInstancesCommand = "instances:command"
+	PermProductsWrite    = "products:write"
+	PermReleasesUpload   = "releases:upload"
+	PermReleasesPublish  = "releases:publish"
+	PermRetentionManage  = "retention:manage"
+	PermUsersRead        = "users:read"
+	PermUsersWrite       = "users:write"
+	PermTokensManage     = "tokens:manage"
+	PermRolesManage      = "roles:manage"
+	PermAuditRead        = "audit:read"
+	PermKeysManage       = "keys:manage"
+	PermMetricsRead      = "metrics:read"
+
+	PermOrganizationsRead  = "organizations:read"
+	PermOrganizationsWrite = "organizations:write"
+	// PermOrganizationsAll grants access to every organization's licenses and
+	// instances; without it users only see the organizations they belong to.
+	// Of the built-in roles only admin has it.
+	PermOrganizationsAll = "organizations:all"
+)
+
+// Built-in roles
+const (
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleViewer   = "viewer"
+)
+
+// AllPermissions lists every permission a role can grant
+var AllPermissions = []types.Permission{
+	{Name: PermLicensesRead, Description: "View licenses"},
+	{Name: PermLicensesWrite, Description: "Create, update and delete licenses"},
+	{Name: PermInstancesRead, Description: "View instances and their heartbeats"},
+	{Name: PermInstancesDelete, Description: "Delete instances"},
+	{Name: PermInstancesManage, Description: "Set the versions and updater settings of instances"},
+	{Name: PermInstancesCommand, Description: "Send commands to instances"},
+	{Name: PermProductsWrite, Description: "Register, update and delete products"},
+	{Name: PermReleasesUpload, Description: "Upload release artifacts"},
+	{Name: PermReleasesPublish, Description: "Publish, deprecate, promote, yank and pin releases"},
+	{Name: PermRetentionManage, Description: "Manage retention policies and run garbage collection"},
+	{Name: PermUsersRead, Description: "View users and roles"},
+	{Name: PermUsersWrite, Description: "Create, update and delete users"},
+	{Name: PermTokensManage, Description: "Manage service accounts and all API tokens"},
+	{Name: PermRolesManage, Description: "Create, update and delete custom roles"},
+	{Name: PermAuditRead, Description: "View, export and verify the administrative audit log"},
+	{Name: PermKeysManage, Description: "View and rotate the keys that sign access tokens"},
+	{Name: PermMetricsRead, Description: "Scrape Prometheus metrics"},
+	{Name: PermOrganizationsRead, Description: "View organizations and their members"},
+	{Name: PermOrganizationsWrite, Description: "Manage organizations and their members"},
+	{Name: PermOrganizationsAll, Description: "Access every organization instead of only the user's own"},
+}
+
+// builtInRoles are always available and cannot be modified
+var builtInRoles = []types.Role{
+	{
+		Name:        RoleAdmin,
+		Description: "Full access",
+		Permissions: permissionNames(),
+		BuiltIn:     true,
+	},
+	{
+		Name:        RoleOperator,
+		Description: "Manage licenses, instances and releases",
+		Permissions: []string{
+			PermLicensesRead, PermLicensesWrite, PermInstancesRead, PermInstancesDelete, PermInstancesManage,
+			PermInstancesCommand, PermReleasesUpload, PermReleasesPublish, PermOrganizationsRead, PermMetricsRead,
+		},
+		BuiltIn: true,
+	},
+	{
+		Name:        RoleViewer,
+		Description: "Read-only access to licenses and instances",
+		Permissions: []string{PermLicensesRead, PermInstancesRead, PermOrganizationsRead},
+		BuiltIn:     true,
+	},
+}
+
+// IsValidPermission reports whether a permission exists
+func IsValidPermission(permission string) bool {
+	for _, p := range AllPermissions {
+		if p.Name == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func builtInRole(name string) *types.Role {
+	for i := range builtInRoles {
+		if builtInRoles[i].Name == name {
+			return &builtInRoles[i]
+		}
+	}
+	return nil
+}
+
+func permissionNames() []string {
+	names := make([]string, len(AllPermissions))
+	for i, p := range AllPermissions {
+		names[i] = p.Name
+	}
+	return names
+}
@@ -0,0 +1,1279 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// PostgresRepository stores users, sessions and credentials in PostgreSQL
+type PostgresRepository struct {
+	db *database.DB
+}
+
+// NewPostgresRepository creates a repository backed by PostgreSQL
+func NewPostgresRepository(db *database.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+// CreateUser creates a new user
+func (r *PostgresRepository) CreateUser(ctx context.Context, email, passwordHash, name, role string) (*types.User, error) {
+	var user types.User
+	var lastLoginAt, mfaVerifiedAt, emailVerifiedAt, lockedUntil pgtype.Timestamptz
+
+	err := r.db.Pool.QueryRow(ctx, `
+		INSERT INTO users (email, password_hash, name, role)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, email, name, role, avatar_url, mfa_enabled, is_active, is_service_account, email_verified,
+				  last_login_at, password_changed_at, created_at, updated_at
+	`, email, passwordHash, name, role).Scan(
+		&user.ID, &user.Email, &user.Name, &user.Role, &user.AvatarURL,
+		&user.MFAEnabled, &user.IsActive, &user.IsServiceAccount, &user.EmailVerified,
+		&lastLoginAt, &user.PasswordChangedAt, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		if err.Error() == "ERROR: duplicate key value violates unique constraint \"users_email_key\" (SQLSTATE 23505)" {
+			return nil, ErrUserExists
+		}
+		return nil, err
+	}
+
+	if lastLoginAt.Valid {
+		user.LastLoginAt = &lastLoginAt.Time
+	}
+	_ = mfaVerifiedAt
+	_ = emailVerifiedAt
+	_ = lockedUntil
+
+	return &user, nil
+}
+
+// GetUserByEmail retrieves a user by email (includes password hash for auth)
+func (r *PostgresRepository) GetUserByEmail(ctx context.Context, email string) (*types.UserWithPassword, error) {
+	var user types.UserWithPassword
+	var lastLoginAt, lockedUntil pgtype.Timestamptz
+	var avatarURL, mfaSecret sql.NullString
+	var backupCodes []string
+
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT id, email, password_hash, name, role, avatar_url, 
+			   mfa_enabled, mfa_secret, mfa_backup_codes, is_active, is_service_account, email_verified,
+			   last_login_at, password_changed_at, failed_login_attempts, locked_until,
+			   created_at, updated_at
+		FROM users
+		WHERE email = $1
+	`, email).Scan(
+		&user.ID, &user.Email, &user.PasswordHash, &user.Name, &user.Role, &avatarURL,
+		&user.MFAEnabled, &mfaSecret, &backupCodes, &user.IsActive, &user.IsServiceAccount, &user.EmailVerified,
+		&lastLoginAt, &user.PasswordChangedAt, &user.FailedLoginAttempts, &lockedUntil,
+		&user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	if avatarURL.Valid {
+		user.AvatarURL = avatarURL.String
+	}
+	if mfaSecret.Valid {
+		user.MFASecret = mfaSecret.String
+	}
+	if lastLoginAt.Valid {
+		user.LastLoginAt = &lastLoginAt.Time
+	}
+	if lockedUntil.Valid {
+		user.LockedUntil = &lockedUntil.Time
+	}
+	user.MFABackupCodes = backupCodes
+
+	return &user, nil
+}
+
+// GetUserByID retrieves a user by ID
+func (r *PostgresRepository) GetUserByID(ctx context.Context, id string) (*types.User, error) {
+	var user types.User
+	var lastLoginAt pgtype.Timestamptz
+	var avatarURL sql.NullString
+
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT id, email, name, role, avatar_url, mfa_enabled, is_active, is_service_account, email_verified,
+			   last_login_at, password_changed_at, created_at, updated_at
+		FROM users
+		WHERE id = $1
+	`, id).Scan(
+		&user.ID, &user.Email, &user.Name, &user.Role, &avatarURL,
+		&user.MFAEnabled, &user.IsActive, &user.IsServiceAccount, &user.EmailVerified,
+		&lastLoginAt, &user.PasswordChangedAt, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	if avatarURL.Valid {
+		user.AvatarURL = avatarURL.String
+	}
+	if lastLoginAt.Valid {
+		user.LastLoginAt = &lastLoginAt.Time
+	}
+
+	return &user, nil
+}
+
+// ListUsers returns all users
+func (r *PostgresRepository) ListUsers(ctx context.Context) ([]types.User, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT id, email, name, role, avatar_url, mfa_enabled, is_active, is_service_account, email_verified,
+			   last_login_at, password_changed_at, created_at, updated_at
+		FROM users
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []types.User
+	for rows.Next() {
+		var user types.User
+		var lastLoginAt pgtype.Timestamptz
+		var avatarURL sql.NullString
+
+		if err := rows.Scan(
+			&user.ID, &user.Email, &user.Name, &user.Role, &avatarURL,
+			&user.MFAEnabled, &user.IsActive, &user.IsServiceAccount, &user.EmailVerified,
+			&lastLoginAt, &user.PasswordChangedAt, &user.CreatedAt, &user.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		if avatarURL.Valid {
+			user.AvatarURL = avatarURL.String
+		}
+		if lastLoginAt.Valid {
+			user.LastLoginAt = &lastLoginAt.Time
+		}
+
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// UpdateUser updates user profile
+func (r *PostgresRepository) UpdateUser(ctx context.Context, id, name, avatarURL string) (*types.User, error) {
+	var user types.User
+	var lastLoginAt pgtype.Timestamptz
+	var avatar sql.NullString
+
+	err := r.db.Pool.QueryRow(ctx, `
+		UPDATE users
+		SET name = COALESCE(NULLIF($2, ''), name),
+			avatar_url = COALESCE(NULLIF($3, ''), avatar_url),
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING id, email, name, role, avatar_url, mfa_enabled, is_active, is_service_account, email_verified,
+				  last_login_at, password_changed_at, created_at, updated_at
+	`, id, name, avatarURL).Scan(
+		&user.ID, &user.Email, &user.Name, &user.Role, &avatar,
+		&user.MFAEnabled, &user.IsActive, &user.IsServiceAccount, &user.EmailVerified,
+		&lastLoginAt, &user.PasswordChangedAt, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	if avatar.Valid {
+		user.AvatarURL = avatar.String
+	}
+	if lastLoginAt.Valid {
+		user.LastLoginAt = &lastLoginAt.Time
+	}
+
+	return &user, nil
+}
+
+// UpdatePassword updates user password
+func (r *PostgresRepository) UpdatePassword(ctx context.Context, id, passwordHash string) error {
+	result, err := r.db.Pool.Exec(ctx, `
+		UPDATE users
+		SET password_hash = $2, password_changed_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`, id, passwordHash)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// UpdateMFASecret sets the MFA secret for a user
+func (r *PostgresRepository) UpdateMFASecret(ctx context.Context, id, secret string) error {
+	result, err := r.db.Pool.Exec(ctx, `
+		UPDATE users
+		SET mfa_secret = $2, updated_at = NOW()
+		WHERE id = $1
+	`, id, secret)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// EnableMFA enables MFA for a user and sets backup codes
+func (r *PostgresRepository) EnableMFA(ctx context.Context, id string, backupCodes []string) error {
+	result, err := r.db.Pool.Exec(ctx, `
+		UPDATE users
+		SET mfa_enabled = true, mfa_backup_codes = $2, mfa_verified_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`, id, backupCodes)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// DisableMFA disables MFA for a user
+func (r *PostgresRepository) DisableMFA(ctx context.Context, id string) error {
+	result, err := r.db.Pool.Exec(ctx, `
+		UPDATE users
+		SET mfa_enabled = false, mfa_secret = NULL, mfa_backup_codes = NULL, 
+			mfa_verified_at = NULL, updated_at = NOW()
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// IncrementFailedAttempts increments failed login attempts
+func (r *PostgresRepository) IncrementFailedAttempts(ctx context.Context, id string) (int, error) {
+	var attempts int
+	err := r.db.Pool.QueryRow(ctx, `
+		UPDATE users
+		SET failed_login_attempts = failed_login_attempts + 1,
+			locked_until = CASE 
+				WHEN failed_login_attempts >= 4 THEN NOW() + INTERVAL '15 minutes'
+				ELSE locked_until
+			END,
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING failed_login_attempts
+	`, id).Scan(&attempts)
+	return attempts, err
+}
+
+// ResetFailedAttempts resets failed login attempts
+func (r *PostgresRepository) ResetFailedAttempts(ctx context.Context, id string) error {
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE users
+		SET failed_login_attempts = 0, locked_until = NULL, updated_at = NOW()
+		WHERE id = $1
+	`, id)
+	return err
+}
+
+// UpdateLastLogin updates last login time and IP
+func (r *PostgresRepository) UpdateLastLogin(ctx context.Context, id, ip string) error {
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE users
+		SET last_login_at = NOW(), last_login_ip = $2, updated_at = NOW()
+		WHERE id = $1
+	`, id, ip)
+	return err
+}
+
+// UseBackupCode uses a backup code and removes it
+func (r *PostgresRepository) UseBackupCode(ctx context.Context, id, code string) (bool, error) {
+	// Hash the code to compare
+	codeHash := sha256.Sum256([]byte(code))
+	codeHashStr := hex.EncodeToString(codeHash[:])
+
+	result, err := r.db.Pool.Exec(ctx, `
+		UPDATE users
+		SET mfa_backup_codes = array_remove(mfa_backup_codes, $2),
+			updated_at = NOW()
+		WHERE id = $1 AND $2 = ANY(mfa_backup_codes)
+	`, id, codeHashStr)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// DeleteUser deletes a user
+func (r *PostgresRepository) DeleteUser(ctx context.Context, id string) error {
+	result, err := r.db.Pool.Exec(ctx, `DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// UpdateUserAdmin updates user (admin operation)
+func (r *PostgresRepository) UpdateUserAdmin(ctx context.Context, id string, name, role string, isActive *bool) (*types.User, error) {
+	var user types.User
+	var lastLoginAt pgtype.Timestamptz
+	var avatar sql.NullString
+
+	query := `
+		UPDATE users
+		SET name = COALESCE(NULLIF($2, ''), name),
+			role = COALESCE(NULLIF($3, ''), role),
+			is_active = COALESCE($4, is_active),
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING id, email, name, role, avatar_url, mfa_enabled, is_active, is_service_account, email_verified,
+				  last_login_at, password_changed_at, created_at, updated_at
+	`
+
+	err := r.db.Pool.QueryRow(ctx, query, id, name, role, isActive).Scan(
+		&user.ID, &user.Email, &user.Name, &user.Role, &avatar,
+		&user.MFAEnabled, &user.IsActive, &user.IsServiceAccount, &user.EmailVerified,
+		&lastLoginAt, &user.PasswordChangedAt, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	if avatar.Valid {
+		user.AvatarURL = avatar.String
+	}
+	if lastLoginAt.Valid {
+		user.LastLoginAt = &lastLoginAt.Time
+	}
+
+	return &user, nil
+}
+
+// Session operations
+
+// sessionColumns are the columns scanned by scanSession
+const sessionColumns = `id, user_id, user_agent, ip_address, browser, os, device_type,
+	last_used_at, expires_at, revoked_at, revoked_reason, created_at`
+
+func scanSession(row pgx.Row) (*types.Session, error) {
+	var session types.Session
+	var userAgent, ipAddress, browser, osName, deviceType, revokedReason sql.NullString
+	var revokedAt pgtype.Timestamptz
+
+	if err := row.Scan(
+		&session.ID, &session.UserID, &userAgent, &ipAddress, &browser, &osName, &deviceType,
+		&session.LastUsedAt, &session.ExpiresAt, &revokedAt, &revokedReason, &session.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	session.UserAgent = userAgent.String
+	session.IPAddress = ipAddress.String
+	session.Browser = browser.String
+	session.OS = osName.String
+	session.DeviceType = deviceType.String
+	session.RevokedReason = revokedReason.String
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+
+	return &session, nil
+}
+
+// CreateSession creates a new session
+func (r *PostgresRepository) CreateSession(ctx context.Context, userID, refreshTokenHash, userAgent, ip string, device deviceInfo, expiresAt time.Time) (*types.Session, error) {
+	row := r.db.Pool.QueryRow(ctx, `
+		INSERT INTO sessions (user_id, refresh_token_hash, user_agent, ip_address, browser, os, device_type, expires_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7, $8)
+		RETURNING `+sessionColumns,
+		userID, refreshTokenHash, userAgent, ip, device.Browser, device.OS, device.Type, expiresAt)
+	return scanSession(row)
+}
+
+// GetSession retrieves a session by ID, whether or not it is still active
+func (r *PostgresRepository) GetSession(ctx context.Context, id string) (*types.Session, error) {
+	session, err := scanSession(r.db.Pool.QueryRow(ctx, `
+		SELECT `+sessionColumns+` FROM sessions WHERE id = $1
+	`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetSessionByToken retrieves a session by refresh token hash
+func (r *PostgresRepository) GetSessionByToken(ctx context.Context, refreshTokenHash string) (*types.Session, error) {
+	session, err := scanSession(r.db.Pool.QueryRow(ctx, `
+		SELECT `+sessionColumns+` FROM sessions WHERE refresh_token_hash = $1
+	`, refreshTokenHash))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	// Check if expired
+	if session.ExpiresAt.Before(time.Now()) {
+		return nil, ErrSessionExpired
+	}
+	// Check if revoked
+	if session.RevokedAt != nil {
+		return nil, ErrSessionExpired
+	}
+
+	return session, nil
+}
+
+// IsSessionActive reports whether a session exists and has not been revoked or expired
+func (r *PostgresRepository) IsSessionActive(ctx context.Context, id string) (bool, error) {
+	var active bool
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM sessions WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		)
+	`, id).Scan(&active)
+	return active, err
+}
+
+// RotateSessionToken replaces a session's refresh token and records the old one
+// as used. It returns ErrSessionNotFound if the session was revoked or its
+// token rotated by another request in the meantime.
+func (r *PostgresRepository) RotateSessionToken(ctx context.Context, id, oldTokenHash, newTokenHash, ip string) error {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `
+		UPDATE sessions SET refresh_token_hash = $3, ip_address = $4, last_used_at = NOW()
+		WHERE id = $1 AND refresh_token_hash = $2 AND revoked_at IS NULL
+	`, id, oldTokenHash, newTokenHash, ip)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO used_refresh_tokens (token_hash, session_id) VALUES ($1, $2)
+	`, oldTokenHash, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetUsedRefreshToken looks up a refresh token a session has rotated past and
+// returns the session and when the token was replaced
+func (r *PostgresRepository) GetUsedRefreshToken(ctx context.Context, tokenHash string) (string, time.Time, error) {
+	var sessionID string
+	var usedAt time.Time
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT session_id, used_at FROM used_refresh_tokens WHERE token_hash = $1
+	`, tokenHash).Scan(&sessionID, &usedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", time.Time{}, ErrSessionNotFound
+		}
+		return "", time.Time{}, err
+	}
+	return sessionID, usedAt, nil
+}
+
+// RevokeSession revokes a session, recording why
+func (r *PostgresRepository) RevokeSession(ctx context.Context, id, reason string) error {
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE sessions SET revoked_at = NOW(), revoked_reason = $2 WHERE id = $1 AND revoked_at IS NULL
+	`, id, reason)
+	return err
+}
+
+// RevokeAllUserSessions revokes all sessions for a user, recording why, and
+// returns how many were active
+func (r *PostgresRepository) RevokeAllUserSessions(ctx context.Context, userID, reason string) (int64, error) {
+	result, err := r.db.Pool.Exec(ctx, `
+		UPDATE sessions SET revoked_at = NOW(), revoked_reason = $2 WHERE user_id = $1 AND revoked_at IS NULL
+	`, userID, reason)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+// GetUserSessions returns all active sessions for a user, most recently used first
+func (r *PostgresRepository) GetUserSessions(ctx context.Context, userID string) ([]types.Session, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT `+sessionColumns+`
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_used_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []types.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// CleanupExpiredSessions removes expired sessions
+func (r *PostgresRepository) CleanupExpiredSessions(ctx context.Context) error {
+	_, err := r.db.Pool.Exec(ctx, `
+		DELETE FROM sessions WHERE expires_at < NOW() OR revoked_at IS NOT NULL
+	`)
+	return err
+}
+
+// Audit logging
+
+// LogAuditEvent logs an authentication event. userID may be empty for events
+// that cannot be tied to a user.
+func (r *PostgresRepository) LogAuditEvent(ctx context.Context, userID, eventType, ip, userAgent string, details map[string]interface{}) error {
+	_, err := r.db.Pool.Exec(ctx, `
+		INSERT INTO auth_audit_log (user_id, event_type, ip_address, user_agent, details)
+		VALUES (NULLIF($1, '')::uuid, $2, $3, $4, $5)
+	`, userID, eventType, ip, userAgent, details)
+	return err
+}
+
+// GetAuditLog returns audit events for a user
+func (r *PostgresRepository) GetAuditLog(ctx context.Context, userID string, limit int) ([]types.AuthAuditLog, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT id, user_id, event_type, ip_address, user_agent, details, created_at
+		FROM auth_audit_log
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []types.AuthAuditLog
+	for rows.Next() {
+		var event types.AuthAuditLog
+		var ipAddress, userAgent sql.NullString
+		var userIDStr sql.NullString
+
+		if err := rows.Scan(
+			&event.ID, &userIDStr, &event.EventType, &ipAddress, &userAgent,
+			&event.Details, &event.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		if userIDStr.Valid {
+			event.UserID = userIDStr.String
+		}
+		if ipAddress.Valid {
+			event.IPAddress = ipAddress.String
+		}
+		if userAgent.Valid {
+			event.UserAgent = userAgent.String
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// Service accounts
+
+// CreateServiceAccount creates a user that cannot log in and only authenticates with API tokens
+func (r *PostgresRepository) CreateServiceAccount(ctx context.Context, email, name, role string) (*types.User, error) {
+	var user types.User
+	var lastLoginAt pgtype.Timestamptz
+	var avatar sql.NullString
+
+	err := r.db.Pool.QueryRow(ctx, `
+		INSERT INTO users (email, password_hash, name, role, is_service_account, email_verified)
+		VALUES ($1, '!', $2, $3, true, true)
+		RETURNING id, email, name, role, avatar_url, mfa_enabled, is_active, is_service_account, email_verified,
+				  last_login_at, password_changed_at, created_at, updated_at
+	`, email, name, role).Scan(
+		&user.ID, &user.Email, &user.Name, &user.Role, &avatar,
+		&user.MFAEnabled, &user.IsActive, &user.IsServiceAccount, &user.EmailVerified,
+		&lastLoginAt, &user.PasswordChangedAt, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, ErrUserExists
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// API token operations
+
+const apiTokenColumns = `t.id, t.user_id, u.email, t.name, t.token_prefix, t.scopes, t.products, t.expires_at,
+	t.last_used_at, COALESCE(t.last_used_ip, ''), t.revoked_at, COALESCE(t.created_by::text, ''), t.created_at`
+
+func scanAPIToken(row pgx.Row) (*types.APIToken, error) {
+	var token types.APIToken
+	err := row.Scan(
+		&token.ID, &token.UserID, &token.UserEmail, &token.Name, &token.Prefix, &token.Scopes, &token.Products,
+		&token.ExpiresAt, &token.LastUsedAt, &token.LastUsedIP, &token.RevokedAt, &token.CreatedBy, &token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// CreateAPIToken stores a new API token by its hash
+func (r *PostgresRepository) CreateAPIToken(ctx context.Context, token *types.APIToken, tokenHash string) error {
+	return r.db.Pool.QueryRow(ctx, `
+		INSERT INTO api_tokens (user_id, name, token_prefix, token_hash, scopes, products, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, '')::uuid)
+		RETURNING id, created_at
+	`, token.UserID, token.Name, token.Prefix, tokenHash, token.Scopes, token.Products, token.ExpiresAt, token.CreatedBy).Scan(
+		&token.ID, &token.CreatedAt,
+	)
+}
+
+// GetAPITokenByHash retrieves an API token by its hash
+func (r *PostgresRepository) GetAPITokenByHash(ctx context.Context, tokenHash string) (*types.APIToken, error) {
+	token, err := scanAPIToken(r.db.Pool.QueryRow(ctx, `
+		SELECT `+apiTokenColumns+`
+		FROM api_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1
+	`, tokenHash))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAPITokenNotFound
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+// GetAPITokenByID retrieves an API token by ID
+func (r *PostgresRepository) GetAPITokenByID(ctx context.Context, id string) (*types.APIToken, error) {
+	token, err := scanAPIToken(r.db.Pool.QueryRow(ctx, `
+		SELECT `+apiTokenColumns+`
+		FROM api_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.id = $1
+	`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAPITokenNotFound
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+// ListAPITokens returns the API tokens of a user, or of all users when userID is empty
+func (r *PostgresRepository) ListAPITokens(ctx context.Context, userID string) ([]types.APIToken, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT `+apiTokenColumns+`
+		FROM api_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE $1 = '' OR t.user_id::text = $1
+		ORDER BY t.created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []types.APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+
+	return tokens, nil
+}
+
+// RevokeAPIToken revokes an API token
+func (r *PostgresRepository) RevokeAPIToken(ctx context.Context, id string) error {
+	result, err := r.db.Pool.Exec(ctx, `
+		UPDATE api_tokens SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrAPITokenNotFound
+	}
+	return nil
+}
+
+// TouchAPIToken records when and from where an API token was last used
+func (r *PostgresRepository) TouchAPIToken(ctx context.Context, id, ip string) error {
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE api_tokens SET last_used_at = NOW(), last_used_ip = $2 WHERE id = $1
+	`, id, ip)
+	return err
+}
+
+// Role operations
+
+// ListRoles returns all custom roles
+func (r *PostgresRepository) ListRoles(ctx context.Context) ([]types.Role, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT name, COALESCE(description, ''), permissions, created_at, updated_at
+		FROM roles
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []types.Role
+	for rows.Next() {
+		var role types.Role
+		if err := rows.Scan(&role.Name, &role.Description, &role.Permissions, &role.CreatedAt, &role.UpdatedAt); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, nil
+}
+
+// GetRole retrieves a custom role by name
+func (r *PostgresRepository) GetRole(ctx context.Context, name string) (*types.Role, error) {
+	var role types.Role
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT name, COALESCE(description, ''), permissions, created_at, updated_at
+		FROM roles
+		WHERE name = $1
+	`, name).Scan(&role.Name, &role.Description, &role.Permissions, &role.CreatedAt, &role.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+	return &role, nil
+}
+
+// CreateRole creates a custom role
+func (r *PostgresRepository) CreateRole(ctx context.Context, role *types.Role) error {
+	err := r.db.Pool.QueryRow(ctx, `
+		INSERT INTO roles (name, description, permissions)
+		VALUES ($1, NULLIF($2, ''), $3)
+		RETURNING created_at, updated_at
+	`, role.Name, role.Description, role.Permissions).Scan(&role.CreatedAt, &role.UpdatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrRoleExists
+		}
+		return err
+	}
+	return nil
+}
+
+// UpdateRole replaces the description and permissions of a custom role
+func (r *PostgresRepository) UpdateRole(ctx context.Context, role *types.Role) error {
+	err := r.db.Pool.QueryRow(ctx, `
+		UPDATE roles SET description = NULLIF($2, ''), permissions = $3
+		WHERE name = $1
+		RETURNING created_at, updated_at
+	`, role.Name, role.Description, role.Permissions).Scan(&role.CreatedAt, &role.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrRoleNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteRole deletes a custom role
+func (r *PostgresRepository) DeleteRole(ctx context.Context, name string) error {
+	result, err := r.db.Pool.Exec(ctx, `DELETE FROM roles WHERE name = $1`, name)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+// CountUsersWithRole returns how many users are assigned a role
+func (r *PostgresRepository) CountUsersWithRole(ctx context.Context, name string) (int, error) {
+	var count int
+	err := r.db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM users WHERE role = $1`, name).Scan(&count)
+	return count, err
+}
+
+// SSO operations
+
+// CreateSSOUser creates a user provisioned by single sign-on. It has no usable password.
+func (r *PostgresRepository) CreateSSOUser(ctx context.Context, email, name, role string, emailVerified bool) (*types.User, error) {
+	var user types.User
+	var lastLoginAt pgtype.Timestamptz
+	var avatar sql.NullString
+
+	err := r.db.Pool.QueryRow(ctx, `
+		INSERT INTO users (email, password_hash, name, role, email_verified)
+		VALUES ($1, '!', $2, $3, $4)
+		RETURNING id, email, name, role, avatar_url, mfa_enabled, is_active, is_service_account, email_verified,
+				  last_login_at, password_changed_at, created_at, updated_at
+	`, email, name, role, emailVerified).Scan(
+		&user.ID, &user.Email, &user.Name, &user.Role, &avatar,
+		&user.MFAEnabled, &user.IsActive, &user.IsServiceAccount, &user.EmailVerified,
+		&lastLoginAt, &user.PasswordChangedAt, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, ErrUserExists
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// GetIdentity retrieves the identity an OIDC provider knows a user by
+func (r *PostgresRepository) GetIdentity(ctx context.Context, issuer, subject string) (*types.UserIdentity, error) {
+	var identity types.UserIdentity
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT id, user_id, issuer, subject, COALESCE(email, ''), created_at, last_login_at
+		FROM user_identities
+		WHERE issuer = $1 AND subject = $2
+	`, issuer, subject).Scan(
+		&identity.ID, &identity.UserID, &identity.Issuer, &identity.Subject, &identity.Email,
+		&identity.CreatedAt, &identity.LastLoginAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrIdentityNotFound
+		}
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// CreateIdentity links a user to an OIDC provider identity
+func (r *PostgresRepository) CreateIdentity(ctx context.Context, identity *types.UserIdentity) error {
+	return r.db.Pool.QueryRow(ctx, `
+		INSERT INTO user_identities (user_id, issuer, subject, email, last_login_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NOW())
+		RETURNING id, created_at, last_login_at
+	`, identity.UserID, identity.Issuer, identity.Subject, identity.Email).Scan(
+		&identity.ID, &identity.CreatedAt, &identity.LastLoginAt,
+	)
+}
+
+// TouchIdentity records an SSO login and the email the provider reported
+func (r *PostgresRepository) TouchIdentity(ctx context.Context, id, email string) error {
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE user_identities SET last_login_at = NOW(), email = COALESCE(NULLIF($2, ''), email) WHERE id = $1
+	`, id, email)
+	return err
+}
+
+// HasIdentity reports whether a user is managed by single sign-on
+func (r *PostgresRepository) HasIdentity(ctx context.Context, userID string) (bool, error) {
+	var exists bool
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM user_identities WHERE user_id = $1)
+	`, userID).Scan(&exists)
+	return exists, err
+}
+
+// CreateOIDCLoginState stores a pending SSO login and removes expired ones
+func (r *PostgresRepository) CreateOIDCLoginState(ctx context.Context, stateHash string, state *oidcLoginState, expiresAt time.Time) error {
+	if _, err := r.db.Pool.Exec(ctx, `DELETE FROM oidc_login_states WHERE expires_at < NOW()`); err != nil {
+		return err
+	}
+
+	_, err := r.db.Pool.Exec(ctx, `
+		INSERT INTO oidc_login_states (state_hash, code_verifier, nonce, redirect_to, link_user_id, expires_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, '')::uuid, $6)
+	`, stateHash, state.CodeVerifier, state.Nonce, state.RedirectTo, state.LinkUserID, expiresAt)
+	return err
+}
+
+// ConsumeOIDCLoginState retrieves and deletes a pending SSO login, so each state is used once
+func (r *PostgresRepository) ConsumeOIDCLoginState(ctx context.Context, stateHash string) (*oidcLoginState, error) {
+	var state oidcLoginState
+	err := r.db.Pool.QueryRow(ctx, `
+		DELETE FROM oidc_login_states
+		WHERE state_hash = $1
+		RETURNING code_verifier, nonce, COALESCE(redirect_to, ''), COALESCE(link_user_id::text, ''), expires_at
+	`, stateHash).Scan(&state.CodeVerifier, &state.Nonce, &state.RedirectTo, &state.LinkUserID, &state.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrOIDCStateInvalid
+		}
+		return nil, err
+	}
+	if state.ExpiresAt.Before(time.Now()) {
+		return nil, ErrOIDCStateInvalid
+	}
+	return &state, nil
+}
+
+// WebAuthn operations
+
+const webAuthnCredentialColumns = `id, user_id, name, credential_id, public_key, sign_count, transports,
+	COALESCE(aaguid, ''), last_used_at, created_at`
+
+func scanWebAuthnCredential(row pgx.Row) (*types.WebAuthnCredential, error) {
+	var credential types.WebAuthnCredential
+	var signCount int64
+	err := row.Scan(
+		&credential.ID, &credential.UserID, &credential.Name, &credential.CredentialID, &credential.PublicKey,
+		&signCount, &credential.Transports, &credential.AAGUID, &credential.LastUsedAt, &credential.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	credential.SignCount = uint32(signCount)
+	return &credential, nil
+}
+
+// ListWebAuthnCredentials returns a user's credentials
+func (r *PostgresRepository) ListWebAuthnCredentials(ctx context.Context, userID string) ([]types.WebAuthnCredential, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT `+webAuthnCredentialColumns+`
+		FROM webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credentials := []types.WebAuthnCredential{}
+	for rows.Next() {
+		credential, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, *credential)
+	}
+
+	return credentials, nil
+}
+
+// GetWebAuthnCredential retrieves a credential by its browser-facing credential ID
+func (r *PostgresRepository) GetWebAuthnCredential(ctx context.Context, credentialID string) (*types.WebAuthnCredential, error) {
+	credential, err := scanWebAuthnCredential(r.db.Pool.QueryRow(ctx, `
+		SELECT `+webAuthnCredentialColumns+`
+		FROM webauthn_credentials
+		WHERE credential_id = $1
+	`, credentialID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrWebAuthnCredentialNotFound
+		}
+		return nil, err
+	}
+	return credential, nil
+}
+
+// CountWebAuthnCredentials returns how many credentials a user has registered
+func (r *PostgresRepository) CountWebAuthnCredentials(ctx context.Context, userID string) (int, error) {
+	var count int
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM webauthn_credentials WHERE user_id = $1
+	`, userID).Scan(&count)
+	return count, err
+}
+
+// CreateWebAuthnCredential stores a newly registered credential
+func (r *PostgresRepository) CreateWebAuthnCredential(ctx context.Context, credential *types.WebAuthnCredential) error {
+	err := r.db.Pool.QueryRow(ctx, `
+		INSERT INTO webauthn_credentials (user_id, name, credential_id, public_key, sign_count, transports, aaguid)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
+		RETURNING id, created_at
+	`, credential.UserID, credential.Name, credential.CredentialID, credential.PublicKey,
+		int64(credential.SignCount), credential.Transports, credential.AAGUID).Scan(&credential.ID, &credential.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrWebAuthnCredentialExists
+		}
+		return err
+	}
+	return nil
+}
+
+// RenameWebAuthnCredential renames one of a user's credentials
+func (r *PostgresRepository) RenameWebAuthnCredential(ctx context.Context, id, userID, name string) error {
+	result, err := r.db.Pool.Exec(ctx, `
+		UPDATE webauthn_credentials SET name = $3 WHERE id::text = $1 AND user_id = $2
+	`, id, userID, name)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrWebAuthnCredentialExists
+		}
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
+	return nil
+}
+
+// DeleteWebAuthnCredential removes one of a user's credentials
+func (r *PostgresRepository) DeleteWebAuthnCredential(ctx context.Context, id, userID string) error {
+	result, err := r.db.Pool.Exec(ctx, `
+		DELETE FROM webauthn_credentials WHERE id::text = $1 AND user_id = $2
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
+	return nil
+}
+
+// TouchWebAuthnCredential records a successful assertion and the authenticator's new signature counter
+func (r *PostgresRepository) TouchWebAuthnCredential(ctx context.Context, id string, signCount uint32) error {
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE webauthn_credentials SET sign_count = $2, last_used_at = NOW() WHERE id = $1
+	`, id, int64(signCount))
+	return err
+}
+
+// CreateWebAuthnChallenge stores a challenge for a ceremony and removes expired ones
+func (r *PostgresRepository) CreateWebAuthnChallenge(ctx context.Context, userID, ceremony, challenge string, expiresAt time.Time) (string, error) {
+	if _, err := r.db.Pool.Exec(ctx, `DELETE FROM webauthn_challenges WHERE expires_at < NOW()`); err != nil {
+		return "", err
+	}
+
+	var id string
+	err := r.db.Pool.QueryRow(ctx, `
+		INSERT INTO webauthn_challenges (user_id, ceremony, challenge, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, userID, ceremony, challenge, expiresAt).Scan(&id)
+	return id, err
+}
+
+// ConsumeWebAuthnChallenge retrieves and deletes a user's challenge for a ceremony
+func (r *PostgresRepository) ConsumeWebAuthnChallenge(ctx context.Context, id, userID, ceremony string) (string, error) {
+	var challenge string
+	var valid bool
+	err := r.db.Pool.QueryRow(ctx, `
+		DELETE FROM webauthn_challenges
+		WHERE id::text = $1 AND user_id = $2 AND ceremony = $3
+		RETURNING challenge, expires_at > NOW()
+	`, id, userID, ceremony).Scan(&challenge, &valid)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrWebAuthnChallengeInvalid
+		}
+		return "", err
+	}
+	if !valid {
+		return "", ErrWebAuthnChallengeInvalid
+	}
+	return challenge, nil
+}
+
+// Account token operations
+
+// CreateAccountToken stores a hashed single-use token. Earlier unused tokens for
+// the same purpose are removed so only the latest link works.
+func (r *PostgresRepository) CreateAccountToken(ctx context.Context, userID, purpose, tokenHash string, expiresAt time.Time) error {
+	_, err := r.db.Pool.Exec(ctx, `
+		DELETE FROM account_tokens
+		WHERE expires_at < NOW() OR (user_id = $1 AND purpose = $2 AND used_at IS NULL)
+	`, userID, purpose)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Pool.Exec(ctx, `
+		INSERT INTO account_tokens (user_id, purpose, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, userID, purpose, tokenHash, expiresAt)
+	return err
+}
+
+// ConsumeAccountToken marks an unexpired token used and returns its user
+func (r *PostgresRepository) ConsumeAccountToken(ctx context.Context, tokenHash, purpose string) (string, error) {
+	var userID string
+	err := r.db.Pool.QueryRow(ctx, `
+		UPDATE account_tokens
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`, tokenHash, purpose).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrAccountTokenInvalid
+		}
+		return "", err
+	}
+	return userID, nil
+}
+
+// MarkEmailVerified records that a user controls their email address
+func (r *PostgresRepository) MarkEmailVerified(ctx context.Context, userID string) error {
+	result, err := r.db.Pool.Exec(ctx, `
+		UPDATE users
+		SET email_verified = true, email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+		WHERE id = $1
+	`, userID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// signingKeyLockKey is the advisory lock that serializes signing key rotation between replicas
+const signingKeyLockKey = 0x6a776b73 // "jwks"
+
+func querySigningKeys(ctx context.Context, q interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}) ([]*signingKeyRecord, error) {
+	rows, err := q.Query(ctx, `
+		SELECT id, algorithm, public_key, private_key, not_before, not_after, expires_at, created_at
+		FROM signing_keys
+		WHERE expires_at > NOW()
+		ORDER BY not_before, created_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*signingKeyRecord
+	for rows.Next() {
+		var key signingKeyRecord
+		if err := rows.Scan(&key.ID, &key.Algorithm, &key.PublicKey, &key.PrivateKey,
+			&key.NotBefore, &key.NotAfter, &key.ExpiresAt, &key.CreatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+	return keys, rows.Err()
+}
+
+// ListSigningKeys returns the keys that have not expired, oldest first
+func (r *PostgresRepository) ListSigningKeys(ctx context.Context) ([]*signingKeyRecord, error) {
+	return querySigningKeys(ctx, r.db.Pool)
+}
+
+// UpdateSigningKeys lets plan change the unexpired keys and add new ones while
+// holding a lock, so only one replica rotates at a time. Changes plan makes to
+// existing keys' validity are saved. Expired keys are removed, and the keys
+// left afterwards are returned.
+func (r *PostgresRepository) UpdateSigningKeys(ctx context.Context, plan func(keys []*signingKeyRecord, now time.Time) ([]*signingKeyRecord, error)) ([]*signingKeyRecord, error) {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, signingKeyLockKey); err != nil {
+		return nil, err
+	}
+
+	keys, err := querySigningKeys(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	created, err := plan(keys, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		_, err := tx.Exec(ctx, `
+			UPDATE signing_keys SET not_before = $2, not_after = $3, expires_at = $4 WHERE id = $1
+		`, key.ID, key.NotBefore, key.NotAfter, key.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range created {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO signing_keys (id, algorithm, public_key, private_key, not_before, not_after, expires_at, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, key.ID, key.Algorithm, key.PublicKey, key.PrivateKey, key.NotBefore, key.NotAfter, key.ExpiresAt, key.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM signing_keys WHERE expires_at <= NOW()`); err != nil {
+		return nil, err
+	}
+
+	keys, err = querySigningKeys(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
@@ -2,15 +2,9 @@ package auth
 
 import (
 	"context"
-	"crypto/sha256"
-	"database/sql"
-	"encoding/hex"
 	"errors"
 	"time"
 
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgtype"
-
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
 	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
 )
@@ -22,545 +16,187 @@ var (
 	ErrSessionExpired   = errors.New("session expired")
 	ErrAccountLocked    = errors.New("account locked due to failed attempts")
 	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrAPITokenNotFound = errors.New("API token not found")
+	ErrRoleNotFound     = errors.New("role not found")
+	ErrRoleExists       = errors.New("role already exists")
+	ErrIdentityNotFound = errors.New("identity not found")
+	ErrOIDCStateInvalid = errors.New("invalid or expired login state")
+	ErrWebAuthnCredentialNotFound = errors.New("WebAuthn credential not found")
+	ErrWebAuthnCredentialExists   = errors.New("a WebAuthn credential with this name or ID already exists")
+	ErrWebAuthnChallengeInvalid   = errors.New("invalid or expired WebAuthn challenge")
+	ErrAccountTokenInvalid        = errors.New("invalid, expired or already used link")
 )
 
 // Repository handles auth database operations
-type Repository struct {
-	db *database.DB
-}
-
-// NewRepository creates a new auth repository
-func NewRepository(db *database.DB) *Repository {
-	return &Repository{db: db}
-}
-
-// CreateUser creates a new user
-func (r *Repository) CreateUser(ctx context.Context, email, passwordHash, name, role string) (*types.User, error) {
-	var user types.User
-	var lastLoginAt, mfaVerifiedAt, emailVerifiedAt, lockedUntil pgtype.Timestamptz
-
-	err := r.db.Pool.QueryRow(ctx, `
-		INSERT INTO users (email, password_hash, name, role)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, email, name, role, avatar_url, mfa_enabled, is_active, email_verified,
-				  last_login_at, password_changed_at, created_at, updated_at
-	`, email, passwordHash, name, role).Scan(
-		&user.ID, &user.Email, &user.Name, &user.Role, &user.AvatarURL,
-		&user.MFAEnabled, &user.IsActive, &user.EmailVerified,
-		&lastLoginAt, &user.PasswordChangedAt, &user.CreatedAt, &user.UpdatedAt,
-	)
-	if err != nil {
-		if err.Error() == "ERROR: duplicate key value violates unique constraint \"users_email_key\" (SQLSTATE 23505)" {
-			return nil, ErrUserExists
-		}
-		return nil, err
-	}
-
-	if lastLoginAt.Valid {
-		user.LastLoginAt = &lastLoginAt.Time
-	}
-	_ = mfaVerifiedAt
-	_ = emailVerifiedAt
-	_ = lockedUntil
-
-	return &user, nil
-}
-
-// GetUserByEmail retrieves a user by email (includes password hash for auth)
-func (r *Repository) GetUserByEmail(ctx context.Context, email string) (*types.UserWithPassword, error) {
-	var user types.UserWithPassword
-	var lastLoginAt, lockedUntil pgtype.Timestamptz
-	var avatarURL, mfaSecret sql.NullString
-	var backupCodes []string
-
-	err := r.db.Pool.QueryRow(ctx, `
-		SELECT id, email, password_hash, name, role, avatar_url, 
-			   mfa_enabled, mfa_secret, mfa_backup_codes, is_active, email_verified,
-			   last_login_at, password_changed_at, failed_login_attempts, locked_until,
-			   created_at, updated_at
-		FROM users
-		WHERE email = $1
-	`, email).Scan(
-		&user.ID, &user.Email, &user.PasswordHash, &user.Name, &user.Role, &avatarURL,
-		&user.MFAEnabled, &mfaSecret, &backupCodes, &user.IsActive, &user.EmailVerified,
-		&lastLoginAt, &user.PasswordChangedAt, &user.FailedLoginAttempts, &lockedUntil,
-		&user.CreatedAt, &user.UpdatedAt,
-	)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, ErrUserNotFound
-		}
-		return nil, err
-	}
-
-	if avatarURL.Valid {
-		user.AvatarURL = avatarURL.String
-	}
-	if mfaSecret.Valid {
-		user.MFASecret = mfaSecret.String
-	}
-	if lastLoginAt.Valid {
-		user.LastLoginAt = &lastLoginAt.Time
-	}
-	if lockedUntil.Valid {
-		user.LockedUntil = &lockedUntil.Time
-	}
-	user.MFABackupCodes = backupCodes
-
-	return &user, nil
-}
-
-// GetUserByID retrieves a user by ID
-func (r *Repository) GetUserByID(ctx context.Context, id string) (*types.User, error) {
-	var user types.User
-	var lastLoginAt pgtype.Timestamptz
-	var avatarURL sql.NullString
-
-	err := r.db.Pool.QueryRow(ctx, `
-		SELECT id, email, name, role, avatar_url, mfa_enabled, is_active, email_verified,
-			   last_login_at, password_changed_at, created_at, updated_at
-		FROM users
-		WHERE id = $1
-	`, id).Scan(
-		&user.ID, &user.Email, &user.Name, &user.Role, &avatarURL,
-		&user.MFAEnabled, &user.IsActive, &user.EmailVerified,
-		&lastLoginAt, &user.PasswordChangedAt, &user.CreatedAt, &user.UpdatedAt,
-	)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, ErrUserNotFound
-		}
-		return nil, err
-	}
-
-	if avatarURL.Valid {
-		user.AvatarURL = avatarURL.String
-	}
-	if lastLoginAt.Valid {
-		user.LastLoginAt = &lastLoginAt.Time
-	}
-
-	return &user, nil
-}
-
-// ListUsers returns all users
-func (r *Repository) ListUsers(ctx context.Context) ([]types.User, error) {
-	rows, err := r.db.Pool.Query(ctx, `
-		SELECT id, email, name, role, avatar_url, mfa_enabled, is_active, email_verified,
-			   last_login_at, password_changed_at, created_at, updated_at
-		FROM users
-		ORDER BY created_at DESC
-	`)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var users []types.User
-	for rows.Next() {
-		var user types.User
-		var lastLoginAt pgtype.Timestamptz
-		var avatarURL sql.NullString
-
-		if err := rows.Scan(
-			&user.ID, &user.Email, &user.Name, &user.Role, &avatarURL,
-			&user.MFAEnabled, &user.IsActive, &user.EmailVerified,
-			&lastLoginAt, &user.PasswordChangedAt, &user.CreatedAt, &user.UpdatedAt,
-		); err != nil {
-			return nil, err
-		}
-
-		if avatarURL.Valid {
-			user.AvatarURL = avatarURL.String
-		}
-		if lastLoginAt.Valid {
-			user.LastLoginAt = &lastLoginAt.Time
-		}
-
-		users = append(users, user)
-	}
-
-	return users, nil
-}
-
-// UpdateUser updates user profile
-func (r *Repository) UpdateUser(ctx context.Context, id, name, avatarURL string) (*types.User, error) {
-	var user types.User
-	var lastLoginAt pgtype.Timestamptz
-	var avatar sql.NullString
-
-	err := r.db.Pool.QueryRow(ctx, `
-		UPDATE users
-		SET name = COALESCE(NULLIF($2, ''), name),
-			avatar_url = COALESCE(NULLIF($3, ''), avatar_url),
-			updated_at = NOW()
-		WHERE id = $1
-		RETURNING id, email, name, role, avatar_url, mfa_enabled, is_active, email_verified,
-				  last_login_at, password_changed_at, created_at, updated_at
-	`, id, name, avatarURL).Scan(
-		&user.ID, &user.Email, &user.Name, &user.Role, &avatar,
-		&user.MFAEnabled, &user.IsActive, &user.EmailVerified,
-		&lastLoginAt, &user.PasswordChangedAt, &user.CreatedAt, &user.UpdatedAt,
-	)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, ErrUserNotFound
-		}
-		return nil, err
-	}
-
-	if avatar.Valid {
-		user.AvatarURL = avatar.String
-	}
-	if lastLoginAt.Valid {
-		user.LastLoginAt = &lastLoginAt.Time
-	}
-
-	return &user, nil
-}
-
-// UpdatePassword updates user password
-func (r *Repository) UpdatePassword(ctx context.Context, id, passwordHash string) error {
-	result, err := r.db.Pool.Exec(ctx, `
-		UPDATE users
-		SET password_hash = $2, password_changed_at = NOW(), updated_at = NOW()
-		WHERE id = $1
-	`, id, passwordHash)
-	if err != nil {
-		return err
-	}
-	if result.RowsAffected() == 0 {
-		return ErrUserNotFound
-	}
-	return nil
-}
-
-// UpdateMFASecret sets the MFA secret for a user
-func (r *Repository) UpdateMFASecret(ctx context.Context, id, secret string) error {
-	result, err := r.db.Pool.Exec(ctx, `
-		UPDATE users
-		SET mfa_secret = $2, updated_at = NOW()
-		WHERE id = $1
-	`, id, secret)
-	if err != nil {
-		return err
-	}
-	if result.RowsAffected() == 0 {
-		return ErrUserNotFound
-	}
-	return nil
-}
-
-// EnableMFA enables MFA for a user and sets backup codes
-func (r *Repository) EnableMFA(ctx context.Context, id string, backupCodes []string) error {
-	result, err := r.db.Pool.Exec(ctx, `
-		UPDATE users
-		SET mfa_enabled = true, mfa_backup_codes = $2, mfa_verified_at = NOW(), updated_at = NOW()
-		WHERE id = $1
-	`, id, backupCodes)
-	if err != nil {
-		return err
-	}
-	if result.RowsAffected() == 0 {
-		return ErrUserNotFound
-	}
-	return nil
-}
-
-// DisableMFA disables MFA for a user
-func (r *Repository) DisableMFA(ctx context.Context, id string) error {
-	result, err := r.db.Pool.Exec(ctx, `
-		UPDATE users
-		SET mfa_enabled = false, mfa_secret = NULL, mfa_backup_codes = NULL, 
-			mfa_verified_at = NULL, updated_at = NOW()
-		WHERE id = $1
-	`, id)
-	if err != nil {
-		return err
-	}
-	if result.RowsAffected() == 0 {
-		return ErrUserNotFound
-	}
-	return nil
-}
-
-// IncrementFailedAttempts increments failed login attempts
-func (r *Repository) IncrementFailedAttempts(ctx context.Context, id string) (int, error) {
-	var attempts int
-	err := r.db.Pool.QueryRow(ctx, `
-		UPDATE users
-		SET failed_login_attempts = failed_login_attempts + 1,
-			locked_until = CASE 
-				WHEN failed_login_attempts >= 4 THEN NOW() + INTERVAL '15 minutes'
-				ELSE locked_until
-			END,
-			updated_at = NOW()
-		WHERE id = $1
-		RETURNING failed_login_attempts
-	`, id).Scan(&attempts)
-	return attempts, err
-}
-
-// ResetFailedAttempts resets failed login attempts
-func (r *Repository) ResetFailedAttempts(ctx context.Context, id string) error {
-	_, err := r.db.Pool.Exec(ctx, `
-		UPDATE users
-		SET failed_login_attempts = 0, locked_until = NULL, updated_at = NOW()
-		WHERE id = $1
-	`, id)
-	return err
-}
-
-// UpdateLastLogin updates last login time and IP
-func (r *Repository) UpdateLastLogin(ctx context.Context, id, ip string) error {
-	_, err := r.db.Pool.Exec(ctx, `
-		UPDATE users
-		SET last_login_at = NOW(), last_login_ip = $2, updated_at = NOW()
-		WHERE id = $1
-	`, id, ip)
-	return err
-}
-
-// UseBackupCode uses a backup code and removes it
-func (r *Repository) UseBackupCode(ctx context.Context, id, code string) (bool, error) {
-	// Hash the code to compare
-	codeHash := sha256.Sum256([]byte(code))
-	codeHashStr := hex.EncodeToString(codeHash[:])
-
-	result, err := r.db.Pool.Exec(ctx, `
-		UPDATE users
-		SET mfa_backup_codes = array_remove(mfa_backup_codes, $2),
-			updated_at = NOW()
-		WHERE id = $1 AND $2 = ANY(mfa_backup_codes)
-	`, id, codeHashStr)
-	if err != nil {
-		return false, err
-	}
-	return result.RowsAffected() > 0, nil
-}
-
-// DeleteUser deletes a user
-func (r *Repository) DeleteUser(ctx context.Context, id string) error {
-	result, err := r.db.Pool.Exec(ctx, `DELETE FROM users WHERE id = $1`, id)
-	if err != nil {
-		return err
-	}
-	if result.RowsAffected() == 0 {
-		return ErrUserNotFound
-	}
-	return nil
-}
-
-// UpdateUserAdmin updates user (admin operation)
-func (r *Repository) UpdateUserAdmin(ctx context.Context, id string, name, role string, isActive *bool) (*types.User, error) {
-	var user types.User
-	var lastLoginAt pgtype.Timestamptz
-	var avatar sql.NullString
-
-	query := `
-		UPDATE users
-		SET name = COALESCE(NULLIF($2, ''), name),
-			role = COALESCE(NULLIF($3, ''), role),
-			is_active = COALESCE($4, is_active),
-			updated_at = NOW()
-		WHERE id = $1
-		RETURNING id, email, name, role, avatar_url, mfa_enabled, is_active, email_verified,
-				  last_login_at, password_changed_at, created_at, updated_at
-	`
-
-	err := r.db.Pool.QueryRow(ctx, query, id, name, role, isActive).Scan(
-		&user.ID, &user.Email, &user.Name, &user.Role, &avatar,
-		&user.MFAEnabled, &user.IsActive, &user.EmailVerified,
-		&lastLoginAt, &user.PasswordChangedAt, &user.CreatedAt, &user.UpdatedAt,
-	)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, ErrUserNotFound
-		}
-		return nil, err
-	}
-
-	if avatar.Valid {
-		user.AvatarURL = avatar.String
-	}
-	if lastLoginAt.Valid {
-		user.LastLoginAt = &lastLoginAt.Time
-	}
-
-	return &user, nil
-}
-
-// Session operations
-
-// CreateSession creates a new session
-func (r *Repository) CreateSession(ctx context.Context, userID, refreshTokenHash, userAgent, ip string, expiresAt time.Time) (*types.Session, error) {
-	var session types.Session
-	err := r.db.Pool.QueryRow(ctx, `
-		INSERT INTO sessions (user_id, refresh_token_hash, user_agent, ip_address, expires_at)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, user_id, user_agent, ip_address, expires_at, created_at
-	`, userID, refreshTokenHash, userAgent, ip, expiresAt).Scan(
-		&session.ID, &session.UserID, &session.UserAgent, &session.IPAddress,
-		&session.ExpiresAt, &session.CreatedAt,
-	)
-	return &session, err
-}
-
-// GetSessionByToken retrieves a session by refresh token hash
-func (r *Repository) GetSessionByToken(ctx context.Context, refreshTokenHash string) (*types.Session, error) {
-	var session types.Session
-	var revokedAt pgtype.Timestamptz
-	var userAgent, ipAddress sql.NullString
-
-	err := r.db.Pool.QueryRow(ctx, `
-		SELECT id, user_id, user_agent, ip_address, expires_at, revoked_at, created_at
-		FROM sessions
-		WHERE refresh_token_hash = $1
-	`, refreshTokenHash).Scan(
-		&session.ID, &session.UserID, &userAgent, &ipAddress,
-		&session.ExpiresAt, &revokedAt, &session.CreatedAt,
-	)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, ErrSessionNotFound
-		}
-		return nil, err
-	}
-
-	if userAgent.Valid {
-		session.UserAgent = userAgent.String
-	}
-	if ipAddress.Valid {
-		session.IPAddress = ipAddress.String
-	}
-	if revokedAt.Valid {
-		session.RevokedAt = &revokedAt.Time
-	}
-
-	// Check if expired
-	if session.ExpiresAt.Before(time.Now()) {
-		return nil, ErrSessionExpired
-	}
-	// Check if revoked
-	if session.RevokedAt != nil {
-		return nil, ErrSessionExpired
-	}
-
-	return &session, nil
-}
-
-// RevokeSession revokes a session
-func (r *Repository) RevokeSession(ctx context.Context, id string) error {
-	_, err := r.db.Pool.Exec(ctx, `
-		UPDATE sessions SET revoked_at = NOW() WHERE id = $1
-	`, id)
-	return err
-}
-
-// RevokeAllUserSessions revokes all sessions for a user
-func (r *Repository) RevokeAllUserSessions(ctx context.Context, userID string) error {
-	_, err := r.db.Pool.Exec(ctx, `
-		UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL
-	`, userID)
-	return err
-}
-
-// GetUserSessions returns all active sessions for a user
-func (r *Repository) GetUserSessions(ctx context.Context, userID string) ([]types.Session, error) {
-	rows, err := r.db.Pool.Query(ctx, `
-		SELECT id, user_id, user_agent, ip_address, expires_at, created_at
-		FROM sessions
-		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
-		ORDER BY created_at DESC
-	`, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var sessions []types.Session
-	for rows.Next() {
-		var session types.Session
-		var userAgent, ipAddress sql.NullString
-
-		if err := rows.Scan(
-			&session.ID, &session.UserID, &userAgent, &ipAddress,
-			&session.ExpiresAt, &session.CreatedAt,
-		); err != nil {
-			return nil, err
-		}
-
-		if userAgent.Valid {
-			session.UserAgent = userAgent.String
-		}
-		if ipAddress.Valid {
-			session.IPAddress = ipAddress.String
-		}
-
-		sessions = append(sessions, session)
-	}
-
-	return sessions, nil
-}
-
-// CleanupExpiredSessions removes expired sessions
-func (r *Repository) CleanupExpiredSessions(ctx context.Context) error {
-	_, err := r.db.Pool.Exec(ctx, `
-		DELETE FROM sessions WHERE expires_at < NOW() OR revoked_at IS NOT NULL
-	`)
-	return err
-}
-
-// Audit logging
-
-// LogAuditEvent logs an authentication event
-func (r *Repository) LogAuditEvent(ctx context.Context, userID, eventType, ip, userAgent string, details map[string]interface{}) error {
-	_, err := r.db.Pool.Exec(ctx, `
-		INSERT INTO auth_audit_log (user_id, event_type, ip_address, user_agent, details)
-		VALUES ($1, $2, $3, $4, $5)
-	`, userID, eventType, ip, userAgent, details)
-	return err
-}
-
-// GetAuditLog returns audit events for a user
-func (r *Repository) GetAuditLog(ctx context.Context, userID string, limit int) ([]types.AuthAuditLog, error) {
-	rows, err := r.db.Pool.Query(ctx, `
-		SELECT id, user_id, event_type, ip_address, user_agent, details, created_at
-		FROM auth_audit_log
-		WHERE user_id = $1
-		ORDER BY created_at DESC
-		LIMIT $2
-	`, userID, limit)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var events []types.AuthAuditLog
-	for rows.Next() {
-		var event types.AuthAuditLog
-		var ipAddress, userAgent sql.NullString
-		var userIDStr sql.NullString
-
-		if err := rows.Scan(
-			&event.ID, &userIDStr, &event.EventType, &ipAddress, &userAgent,
-			&event.Details, &event.CreatedAt,
-		); err != nil {
-			return nil, err
-		}
-
-		if userIDStr.Valid {
-			event.UserID = userIDStr.String
-		}
-		if ipAddress.Valid {
-			event.IPAddress = ipAddress.String
-		}
-		if userAgent.Valid {
-			event.UserAgent = userAgent.String
-		}
-
-		events = append(events, event)
-	}
-
-	return events, nil
+type Repository interface {
+	// CreateUser creates a new user
+	CreateUser(ctx context.Context, email, passwordHash, name, role string) (*types.User, error)
+	// GetUserByEmail retrieves a user by email (includes password hash for auth)
+	GetUserByEmail(ctx context.Context, email string) (*types.UserWithPassword, error)
+	// GetUserByID retrieves a user by ID
+	GetUserByID(ctx context.Context, id string) (*types.User, error)
+	// ListUsers returns all users
+	ListUsers(ctx context.Context) ([]types.User, error)
+	// UpdateUser updates user profile
+	UpdateUser(ctx context.Context, id, name, avatarURL string) (*types.User, error)
+	// UpdatePassword updates user password
+	UpdatePassword(ctx context.Context, id, passwordHash string) error
+	// UpdateMFASecret sets the MFA secret for a user
+	UpdateMFASecret(ctx context.Context, id, secret string) error
+	// EnableMFA enables MFA for a user and sets backup codes
+	EnableMFA(ctx context.Context, id string, backupCodes []string) error
+	// DisableMFA disables MFA for a user
+	DisableMFA(ctx context.Context, id string) error
+	// IncrementFailedAttempts increments failed login attempts
+	IncrementFailedAttempts(ctx context.Context, id string) (int, error)
+	// ResetFailedAttempts resets failed login attempts
+	ResetFailedAttempts(ctx context.Context, id string) error
+	// UpdateLastLogin updates last login time and IP
+	UpdateLastLogin(ctx context.Context, id, ip string) error
+	// UseBackupCode uses a backup code and removes it
+	UseBackupCode(ctx context.Context, id, code string) (bool, error)
+	// DeleteUser deletes a user
+	DeleteUser(ctx context.Context, id string) error
+	// UpdateUserAdmin updates user (admin operation)
+	UpdateUserAdmin(ctx context.Context, id string, name, role string, isActive *bool) (*types.User, error)
+
+	// Session operations
+
+	// CreateSession creates a new session
+	CreateSession(ctx context.Context, userID, refreshTokenHash, userAgent, ip string, device deviceInfo, expiresAt time.Time) (*types.Session, error)
+	// GetSession retrieves a session by ID, whether or not it is still active
+	GetSession(ctx context.Context, id string) (*types.Session, error)
+	// GetSessionByToken retrieves a session by refresh token hash
+	GetSessionByToken(ctx context.Context, refreshTokenHash string) (*types.Session, error)
+	// IsSessionActive reports whether a session exists and has not been revoked or expired
+	IsSessionActive(ctx context.Context, id string) (bool, error)
+	// RotateSessionToken replaces a session's refresh token and records the old one
+	// as used. It returns ErrSessionNotFound if the session was revoked or its
+	// token rotated by another request in the meantime.
+	RotateSessionToken(ctx context.Context, id, oldTokenHash, newTokenHash, ip string) error
+	// GetUsedRefreshToken looks up a refresh token a session has rotated past and
+	// returns the session and when the token was replaced
+	GetUsedRefreshToken(ctx context.Context, tokenHash string) (string, time.Time, error)
+	// RevokeSession revokes a session, recording why
+	RevokeSession(ctx context.Context, id, reason string) error
+	// RevokeAllUserSessions revokes all sessions for a user, recording why, and
+	// returns how many were active
+	RevokeAllUserSessions(ctx context.Context, userID, reason string) (int64, error)
+	// GetUserSessions returns all active sessions for a user, most recently used first
+	GetUserSessions(ctx context.Context, userID string) ([]types.Session, error)
+	// CleanupExpiredSessions removes expired sessions
+	CleanupExpiredSessions(ctx context.Context) error
+
+	// Audit logging
+
+	// LogAuditEvent logs an authentication event. userID may be empty for events
+	// that cannot be tied to a user.
+	LogAuditEvent(ctx context.Context, userID, eventType, ip, userAgent string, details map[string]interface{}) error
+	// GetAuditLog returns audit events for a user
+	GetAuditLog(ctx context.Context, userID string, limit int) ([]types.AuthAuditLog, error)
+
+	// Service accounts
+
+	// CreateServiceAccount creates a user that cannot log in and only authenticates with API tokens
+	CreateServiceAccount(ctx context.Context, email, name, role string) (*types.User, error)
+
+	// API token operations
+
+	// CreateAPIToken stores a new API token by its hash
+	CreateAPIToken(ctx context.Context, token *types.APIToken, tokenHash string) error
+	// GetAPITokenByHash retrieves an API token by its hash
+	GetAPITokenByHash(ctx context.Context, tokenHash string) (*types.APIToken, error)
+	// GetAPITokenByID retrieves an API token by ID
+	GetAPITokenByID(ctx context.Context, id string) (*types.APIToken, error)
+	// ListAPITokens returns the API tokens of a user, or of all users when userID is empty
+	ListAPITokens(ctx context.Context, userID string) ([]types.APIToken, error)
+	// RevokeAPIToken revokes an API token
+	RevokeAPIToken(ctx context.Context, id string) error
+	// TouchAPIToken records when and from where an API token was last used
+	TouchAPIToken(ctx context.Context, id, ip string) error
+
+	// Role operations
+
+	// ListRoles returns all custom roles
+	ListRoles(ctx context.Context) ([]types.Role, error)
+	// GetRole retrieves a custom role by name
+	GetRole(ctx context.Context, name string) (*types.Role, error)
+	// CreateRole creates a custom role
+	CreateRole(ctx context.Context, role *types.Role) error
+	// UpdateRole replaces the description and permissions of a custom role
+	UpdateRole(ctx context.Context, role *types.Role) error
+	// DeleteRole deletes a custom role
+	DeleteRole(ctx context.Context, name string) error
+	// CountUsersWithRole returns how many users are assigned a role
+	CountUsersWithRole(ctx context.Context, name string) (int, error)
+
+	// SSO operations
+
+	// CreateSSOUser creates a user provisioned by single sign-on. It has no usable password.
+	CreateSSOUser(ctx context.Context, email, name, role string, emailVerified bool) (*types.User, error)
+	// GetIdentity retrieves the identity an OIDC provider knows a user by
+	GetIdentity(ctx context.Context, issuer, subject string) (*types.UserIdentity, error)
+	// CreateIdentity links a user to an OIDC provider identity
+	CreateIdentity(ctx context.Context, identity *types.UserIdentity) error
+	// TouchIdentity records an SSO login and the email the provider reported
+	TouchIdentity(ctx context.Context, id, email string) error
+	// HasIdentity reports whether a user is managed by single sign-on
+	HasIdentity(ctx context.Context, userID string) (bool, error)
+	// CreateOIDCLoginState stores a pending SSO login and removes expired ones
+	CreateOIDCLoginState(ctx context.Context, stateHash string, state *oidcLoginState, expiresAt time.Time) error
+	// ConsumeOIDCLoginState retrieves and deletes a pending SSO login, so each state is used once
+	ConsumeOIDCLoginState(ctx context.Context, stateHash string) (*oidcLoginState, error)
+
+	// WebAuthn operations
+
+	// ListWebAuthnCredentials returns a user's credentials
+	ListWebAuthnCredentials(ctx context.Context, userID string) ([]types.WebAuthnCredential, error)
+	// GetWebAuthnCredential retrieves a credential by its browser-facing credential ID
+	GetWebAuthnCredential(ctx context.Context, credentialID string) (*types.WebAuthnCredential, error)
+	// CountWebAuthnCredentials returns how many credentials a user has registered
+	CountWebAuthnCredentials(ctx context.Context, userID string) (int, error)
+	// CreateWebAuthnCredential stores a newly registered credential
+	CreateWebAuthnCredential(ctx context.Context, credential *types.WebAuthnCredential) error
+	// RenameWebAuthnCredential renames one of a user's credentials
+	RenameWebAuthnCredential(ctx context.Context, id, userID, name string) error
+	// DeleteWebAuthnCredential removes one of a user's credentials
+	DeleteWebAuthnCredential(ctx context.Context, id, userID string) error
+	// TouchWebAuthnCredential records a successful assertion and the authenticator's new signature counter
+	TouchWebAuthnCredential(ctx context.Context, id string, signCount uint32) error
+	// CreateWebAuthnChallenge stores a challenge for a ceremony and removes expired ones
+	CreateWebAuthnChallenge(ctx context.Context, userID, ceremony, challenge string, expiresAt time.Time) (string, error)
+	// ConsumeWebAuthnChallenge retrieves and deletes a user's challenge for a ceremony
+	ConsumeWebAuthnChallenge(ctx context.Context, id, userID, ceremony string) (string, error)
+
+	// Account token operations
+
+	// CreateAccountToken stores a hashed single-use token. Earlier unused tokens for
+	// the same purpose are removed so only the latest link works.
+	CreateAccountToken(ctx context.Context, userID, purpose, tokenHash string, expiresAt time.Time) error
+	// ConsumeAccountToken marks an unexpired token used and returns its user
+	ConsumeAccountToken(ctx context.Context, tokenHash, purpose string) (string, error)
+	// MarkEmailVerified records that a user controls their email address
+	MarkEmailVerified(ctx context.Context, userID string) error
+	// ListSigningKeys returns the keys that have not expired, oldest first
+	ListSigningKeys(ctx context.Context) ([]*signingKeyRecord, error)
+	// UpdateSigningKeys lets plan change the unexpired keys and add new ones while
+	// holding a lock, so only one replica rotates at a time. Changes plan makes to
+	// existing keys' validity are saved. Expired keys are removed, and the keys
+	// left afterwards are returned.
+	UpdateSigningKeys(ctx context.Context, plan func(keys []*signingKeyRecord, now time.Time) ([]*signingKeyRecord, error)) ([]*signingKeyRecord, error)
+}
+
+// NewRepository creates an auth repository for the configured database
+func NewRepository(db *database.DB) Repository {
+	if db.Driver == database.DriverSQLite {
+		return NewSQLiteRepository(db)
+	}
+	return NewPostgresRepository(db)
+}
+
+// signingKeyRecord is a stored signing key
+type signingKeyRecord struct {
+	types.SigningKey
+	PublicKey  []byte // PKIX DER
+	PrivateKey []byte // sealed PKCS #8 DER
 }
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database/dbtest"
+)
+
+func TestRepositoryUsers(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		ctx := context.Background()
+		repo := NewRepository(db)
+
+		user, err := repo.CreateUser(ctx, "dev@example.com", "hash", "Dev", RoleOperator)
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		if _, err := repo.CreateUser(ctx, "dev@example.com", "hash", "Dev", RoleOperator); err == nil {
+			t.Error("CreateUser accepted a duplicate email")
+		}
+
+		got, err := repo.GetUserByEmail(ctx, "dev@example.com")
+		if err != nil || got.ID != user.ID || got.PasswordHash != "hash" || got.Role != RoleOperator || !got.IsActive {
+			t.Fatalf("GetUserByEmail = %+v, %v", got, err)
+		}
+		if _, err := repo.GetUserByEmail(ctx, "nobody@example.com"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("GetUserByEmail(missing) = %v, want ErrUserNotFound", err)
+		}
+
+		for want := 1; want <= 3; want++ {
+			if attempts, err := repo.IncrementFailedAttempts(ctx, user.ID); err != nil || attempts != want {
+				t.Errorf("IncrementFailedAttempts = %d, %v; want %d", attempts, err, want)
+			}
+		}
+		if err := repo.ResetFailedAttempts(ctx, user.ID); err != nil {
+			t.Fatalf("ResetFailedAttempts: %v", err)
+		}
+		if attempts, _ := repo.IncrementFailedAttempts(ctx, user.ID); attempts != 1 {
+			t.Errorf("IncrementFailedAttempts after reset = %d, want 1", attempts)
+		}
+
+		inactive := false
+		updated, err := repo.UpdateUserAdmin(ctx, user.ID, "Renamed", RoleViewer, &inactive)
+		if err != nil || updated.Name != "Renamed" || updated.Role != RoleViewer || updated.IsActive {
+			t.Errorf("UpdateUserAdmin = %+v, %v", updated, err)
+		}
+
+		// The repository stores backup codes hashed, as EnableMFA does
+		var hashes []string
+		for _, code := range []string{"code-1", "code-2"} {
+			hash := sha256.Sum256([]byte(code))
+			hashes = append(hashes, hex.EncodeToString(hash[:]))
+		}
+		if err := repo.EnableMFA(ctx, user.ID, hashes); err != nil {
+			t.Fatalf("EnableMFA: %v", err)
+		}
+		tests := []struct {
+			code string
+			want bool
+		}{
+			{"code-1", true},
+			{"code-1", false}, // backup codes work once
+			{"wrong", false},
+			{"code-2", true},
+		}
+		for _, tt := range tests {
+			if ok, err := repo.UseBackupCode(ctx, user.ID, tt.code); err != nil || ok != tt.want {
+				t.Errorf("UseBackupCode(%s) = %v, %v; want %v", tt.code, ok, err, tt.want)
+			}
+		}
+	})
+}
+
+func TestRepositorySessions(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		ctx := context.Background()
+		repo := NewRepository(db)
+
+		user, err := repo.CreateUser(ctx, "dev@example.com", "hash", "Dev", RoleOperator)
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		device := deviceInfo{Browser: "Firefox", OS: "Linux", Type: "desktop"}
+		session, err := repo.CreateSession(ctx, user.ID, "token-1", "Mozilla/5.0", "192.0.2.1", device, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+
+		if err := repo.RotateSessionToken(ctx, session.ID, "token-1", "token-2", "192.0.2.2"); err != nil {
+			t.Fatalf("RotateSessionToken: %v", err)
+		}
+		// A second rotation of the same token lost the race
+		if err := repo.RotateSessionToken(ctx, session.ID, "token-1", "token-3", "192.0.2.2"); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("RotateSessionToken(stale token) = %v, want ErrSessionNotFound", err)
+		}
+		if id, _, err := repo.GetUsedRefreshToken(ctx, "token-1"); err != nil || id != session.ID {
+			t.Errorf("GetUsedRefreshToken = %q, %v; want %s", id, err, session.ID)
+		}
+		if current, err := repo.GetSessionByToken(ctx, "token-2"); err != nil || current == nil || current.ID != session.ID {
+			t.Errorf("GetSessionByToken = %+v, %v", current, err)
+		}
+
+		if sessions, err := repo.GetUserSessions(ctx, user.ID); err != nil || len(sessions) != 1 {
+			t.Errorf("GetUserSessions = %+v, %v; want 1 session", sessions, err)
+		}
+		if revoked, err := repo.RevokeAllUserSessions(ctx, user.ID, "test"); err != nil || revoked != 1 {
+			t.Errorf("RevokeAllUserSessions = %d, %v; want 1", revoked, err)
+		}
+		if active, err := repo.IsSessionActive(ctx, session.ID); err != nil || active {
+			t.Errorf("IsSessionActive after revoke = %v, %v; want false", active, err)
+		}
+		if err := repo.RotateSessionToken(ctx, session.ID, "token-2", "token-3", "192.0.2.2"); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("RotateSessionToken(revoked) = %v, want ErrSessionNotFound", err)
+		}
+	})
+}
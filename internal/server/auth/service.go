@@ -17,12 +17,14 @@ import (
 	"github.com/pquerna/otp/totp"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/mail"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/tracing"
 	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
 )
 
 const (
 	AccessTokenDuration  = 15 * time.Minute
-	RefreshTokenDuration = 7 * 24 * time.Hour
+	RefreshTokenDuration = 7 * 24 * time.Hour // default idle and absolute session timeout
 	MFATokenDuration     = 5 * time.Minute
 	MaxLoginAttempts     = 5
 	LockoutDuration      = 15 * time.Minute
@@ -36,26 +38,52 @@ var (
 	ErrMFANotEnabled    = errors.New("MFA is not enabled")
 	ErrMFAAlreadyEnabled = errors.New("MFA is already enabled")
 	ErrPasswordTooWeak  = errors.New("password must be at least 8 characters")
+	ErrInvalidAPIToken   = errors.New("invalid, expired or revoked API token")
+	ErrInvalidScope      = errors.New("invalid API token scope")
+	ErrInvalidTokenName  = errors.New("API token name is required")
+	ErrNotServiceAccount = errors.New("user is not a service account")
+	ErrInvalidRole       = errors.New("invalid role")
+	ErrInvalidPermission = errors.New("invalid permission")
+	ErrBuiltInRole       = errors.New("built-in roles cannot be changed")
+	ErrRoleInUse         = errors.New("role is assigned to users")
+	ErrPermissionNotHeld = errors.New("you cannot grant a permission you do not have")
 )
 
+// APITokenPrefix marks API tokens so they can be told apart from JWTs
+const APITokenPrefix = "msu_"
+
 // Service handles authentication operations
 type Service struct {
-	repo      *Repository
-	jwtSecret []byte
-	issuer    string
+	repo     Repository
+	keys     *KeyManager
+	issuer   string
+	oidc     *OIDCProvider // nil unless single sign-on is enabled
+	webAuthn *WebAuthn     // nil unless security keys are enabled
+	mailer   mail.Sender   // nil disables password reset and email verification
+	// dashboardURL is the base of links sent by email
+	dashboardURL string
+	// A session ends idleTimeout after it was last refreshed or absoluteTimeout
+	// after sign-in, whichever comes first
+	idleTimeout     time.Duration
+	absoluteTimeout time.Duration
 }
 
-// NewService creates a new auth service
-func NewService(repo *Repository, jwtSecret, issuer string) *Service {
+// NewService creates a new auth service that signs tokens with keys
+func NewService(repo Repository, keys *KeyManager, issuer string) *Service {
 	return &Service{
-		repo:      repo,
-		jwtSecret: []byte(jwtSecret),
-		issuer:    issuer,
+		repo:            repo,
+		keys:            keys,
+		issuer:          issuer,
+		idleTimeout:     RefreshTokenDuration,
+		absoluteTimeout: RefreshTokenDuration,
 	}
 }
 
 // Login authenticates a user with email and password
-func (s *Service) Login(ctx context.Context, email, password, ip, userAgent string) (*types.LoginResponse, error) {
+func (s *Service) Login(ctx context.Context, email, password, ip, userAgent string) (_ *types.LoginResponse, err error) {
+	ctx, span := tracing.Start(ctx, "auth.Login")
+	defer func() { tracing.End(span, err) }()
+
 	user, err := s.repo.GetUserByEmail(ctx, email)
 	if err != nil {
 		if errors.Is(err, ErrUserNotFound) {
@@ -64,6 +92,11 @@ func (s *Service) Login(ctx context.Context, email, password, ip, userAgent stri
 		return nil, err
 	}
 
+	// Service accounts only authenticate with API tokens
+	if user.IsServiceAccount {
+		return nil, ErrInvalidCredentials
+	}
+
 	// Check if account is locked
 	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
 		return nil, ErrAccountLocked
@@ -88,15 +121,29 @@ func (s *Service) Login(ctx context.Context, email, password, ip, userAgent stri
 	// Reset failed attempts on successful password verification
 	s.repo.ResetFailedAttempts(ctx, user.ID)
 
-	// If MFA is enabled, return a temporary token for MFA verification
-	if user.MFAEnabled {
-		mfaToken, err := s.generateToken(user.ID, user.Email, user.Role, "mfa", MFATokenDuration)
+	// Checked after the password so the response does not reveal which users use SSO
+	disabled, err := s.localPasswordDisabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if disabled {
+		return nil, ErrLocalPasswordDisabled
+	}
+
+	// If a second factor is set up, return a temporary token for MFA verification
+	methods, err := s.mfaMethods(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if len(methods) > 0 {
+		mfaToken, err := s.generateToken(user.ID, user.Email, user.Role, "mfa", "", MFATokenDuration)
 		if err != nil {
 			return nil, err
 		}
 		return &types.LoginResponse{
 			RequiresMFA: true,
 			MFAToken:    mfaToken,
+			MFAMethods:  methods,
 		}, nil
 	}
 
@@ -104,10 +151,10 @@ func (s *Service) Login(ctx context.Context, email, password, ip, userAgent stri
 	return s.generateAuthTokens(ctx, &user.User, ip, userAgent)
 }
 
-// VerifyMFA verifies the TOTP code and completes login
-func (s *Service) VerifyMFA(ctx context.Context, mfaToken, totpCode, ip, userAgent string) (*types.LoginResponse, error) {
+// VerifyMFA completes login with a TOTP or backup code, or a WebAuthn assertion
+func (s *Service) VerifyMFA(ctx context.Context, req types.MFAVerifyRequest, ip, userAgent string) (*types.LoginResponse, error) {
 	// Parse and validate MFA token
-	claims, err := s.validateToken(mfaToken, "mfa")
+	claims, err := s.validateToken(req.MFAToken, "mfa")
 	if err != nil {
 		return nil, err
 	}
@@ -117,23 +164,46 @@ func (s *Service) VerifyMFA(ctx context.Context, mfaToken, totpCode, ip, userAge
 		return nil, err
 	}
 
-	if !user.MFAEnabled || user.MFASecret == "" {
+	methods, err := s.mfaMethods(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	method := MFAMethodTOTP
+	if req.WebAuthn != nil {
+		method = MFAMethodWebAuthn
+	}
+	if !containsString(methods, method) {
+		if s.webAuthnRequired(user.Role) && containsString(methods, MFAMethodWebAuthn) {
+			return nil, ErrWebAuthnRequired
+		}
 		return nil, ErrMFANotEnabled
 	}
 
-	// Verify TOTP code
-	valid := totp.Validate(totpCode, user.MFASecret)
-	if !valid {
+	details := map[string]interface{}{"method": method}
+	if method == MFAMethodWebAuthn {
+		credential, err := s.verifyWebAuthnLogin(ctx, user.ID, req.WebAuthn)
+		if err != nil {
+			if credential != nil {
+				details["credential_id"] = credential.ID
+			}
+			details["error"] = err.Error()
+			s.repo.LogAuditEvent(ctx, user.ID, "failed_mfa", ip, userAgent, details)
+			return nil, err
+		}
+		details["credential_id"] = credential.ID
+		details["credential_name"] = credential.Name
+	} else if !totp.Validate(req.TOTPCode, user.MFASecret) {
 		// Try backup codes
-		used, err := s.repo.UseBackupCode(ctx, user.ID, totpCode)
+		used, err := s.repo.UseBackupCode(ctx, user.ID, req.TOTPCode)
 		if err != nil || !used {
-			s.repo.LogAuditEvent(ctx, user.ID, "failed_mfa", ip, userAgent, nil)
+			s.repo.LogAuditEvent(ctx, user.ID, "failed_mfa", ip, userAgent, details)
 			return nil, ErrInvalidMFACode
 		}
 	}
 
 	// Log successful MFA
-	s.repo.LogAuditEvent(ctx, user.ID, "mfa_success", ip, userAgent, nil)
+	s.repo.LogAuditEvent(ctx, user.ID, "mfa_success", ip, userAgent, details)
 
 	// Generate full auth tokens
 	return s.generateAuthTokens(ctx, &user.User, ip, userAgent)
@@ -141,11 +211,6 @@ func (s *Service) VerifyMFA(ctx context.Context, mfaToken, totpCode, ip, userAge
 
 // generateAuthTokens creates access and refresh tokens
 func (s *Service) generateAuthTokens(ctx context.Context, user *types.User, ip, userAgent string) (*types.LoginResponse, error) {
-	accessToken, err := s.generateToken(user.ID, user.Email, user.Role, "access", AccessTokenDuration)
-	if err != nil {
-		return nil, err
-	}
-
 	refreshToken, err := s.generateRefreshToken()
 	if err != nil {
 		return nil, err
@@ -155,7 +220,12 @@ func (s *Service) generateAuthTokens(ctx context.Context, user *types.User, ip,
 	refreshTokenHash := hashToken(refreshToken)
 
 	// Create session
-	_, err = s.repo.CreateSession(ctx, user.ID, refreshTokenHash, userAgent, ip, time.Now().Add(RefreshTokenDuration))
+	session, err := s.repo.CreateSession(ctx, user.ID, refreshTokenHash, userAgent, ip, parseUserAgent(userAgent), time.Now().Add(s.absoluteTimeout))
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := s.generateToken(user.ID, user.Email, user.Role, "access", session.ID, AccessTokenDuration)
 	if err != nil {
 		return nil, err
 	}
@@ -164,6 +234,11 @@ func (s *Service) generateAuthTokens(ctx context.Context, user *types.User, ip,
 	s.repo.UpdateLastLogin(ctx, user.ID, ip)
 	s.repo.LogAuditEvent(ctx, user.ID, "login", ip, userAgent, nil)
 
+	user.Permissions, err = s.RolePermissions(ctx, user.Role)
+	if err != nil {
+		return nil, err
+	}
+
 	return &types.LoginResponse{
 		RequiresMFA:  false,
 		AccessToken:  accessToken,
@@ -173,42 +248,67 @@ func (s *Service) generateAuthTokens(ctx context.Context, user *types.User, ip,
 	}, nil
 }
 
-// RefreshTokens generates new access and refresh tokens
-func (s *Service) RefreshTokens(ctx context.Context, refreshToken, ip, userAgent string) (*types.RefreshTokenResponse, error) {
+// RefreshTokens generates new access and refresh tokens. The session's refresh
+// token is rotated, and presenting one it has rotated past revokes the session.
+func (s *Service) RefreshTokens(ctx context.Context, refreshToken, ip, userAgent string) (_ *types.RefreshTokenResponse, err error) {
+	ctx, span := tracing.Start(ctx, "auth.RefreshTokens")
+	defer func() { tracing.End(span, err) }()
+
 	refreshTokenHash := hashToken(refreshToken)
 
 	session, err := s.repo.GetSessionByToken(ctx, refreshTokenHash)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil, s.checkRefreshTokenReuse(ctx, refreshTokenHash, ip, userAgent)
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	// Enforce the configured timeouts, which may be shorter than when the
+	// session was created
+	now := time.Now()
+	reason := ""
+	switch {
+	case now.After(session.CreatedAt.Add(s.absoluteTimeout)):
+		reason = "absolute_timeout"
+	case now.After(session.LastUsedAt.Add(s.idleTimeout)):
+		reason = "idle_timeout"
+	}
+	if reason != "" {
+		s.repo.RevokeSession(ctx, session.ID, reason)
+		s.repo.LogAuditEvent(ctx, session.UserID, "session_expired", ip, userAgent, map[string]interface{}{
+			"session_id": session.ID,
+			"reason":     reason,
+		})
+		return nil, ErrSessionExpired
+	}
+
 	user, err := s.repo.GetUserByID(ctx, session.UserID)
 	if err != nil {
 		return nil, err
 	}
 
 	if !user.IsActive {
-		s.repo.RevokeSession(ctx, session.ID)
+		s.repo.RevokeSession(ctx, session.ID, "account_disabled")
 		return nil, errors.New("account is disabled")
 	}
 
-	// Revoke old session
-	s.repo.RevokeSession(ctx, session.ID)
-
-	// Generate new tokens
-	accessToken, err := s.generateToken(user.ID, user.Email, user.Role, "access", AccessTokenDuration)
+	newRefreshToken, err := s.generateRefreshToken()
 	if err != nil {
 		return nil, err
 	}
 
-	newRefreshToken, err := s.generateRefreshToken()
+	// Rotate the refresh token, keeping the old one to detect reuse
+	err = s.repo.RotateSessionToken(ctx, session.ID, refreshTokenHash, hashToken(newRefreshToken), ip)
+	if errors.Is(err, ErrSessionNotFound) {
+		// Another request rotated or revoked the session first
+		return nil, s.checkRefreshTokenReuse(ctx, refreshTokenHash, ip, userAgent)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	// Create new session
-	newRefreshTokenHash := hashToken(newRefreshToken)
-	_, err = s.repo.CreateSession(ctx, user.ID, newRefreshTokenHash, userAgent, ip, time.Now().Add(RefreshTokenDuration))
+	accessToken, err := s.generateToken(user.ID, user.Email, user.Role, "access", session.ID, AccessTokenDuration)
 	if err != nil {
 		return nil, err
 	}
@@ -224,8 +324,8 @@ func (s *Service) RefreshTokens(ctx context.Context, refreshToken, ip, userAgent
 func (s *Service) Logout(ctx context.Context, refreshToken, userID, ip, userAgent string) error {
 	refreshTokenHash := hashToken(refreshToken)
 	session, err := s.repo.GetSessionByToken(ctx, refreshTokenHash)
-	if err == nil {
-		s.repo.RevokeSession(ctx, session.ID)
+	if err == nil && session.UserID == userID {
+		s.repo.RevokeSession(ctx, session.ID, "logout")
 	}
 	s.repo.LogAuditEvent(ctx, userID, "logout", ip, userAgent, nil)
 	return nil
@@ -233,7 +333,7 @@ func (s *Service) Logout(ctx context.Context, refreshToken, userID, ip, userAgen
 
 // LogoutAll revokes all sessions for a user
 func (s *Service) LogoutAll(ctx context.Context, userID, ip, userAgent string) error {
-	s.repo.RevokeAllUserSessions(ctx, userID)
+	s.repo.RevokeAllUserSessions(ctx, userID, "logout_all")
 	s.repo.LogAuditEvent(ctx, userID, "logout_all", ip, userAgent, nil)
 	return nil
 }
@@ -245,11 +345,33 @@ func (s *Service) ValidateAccessToken(tokenString string) (*types.JWTClaims, err
 
 // GetUserFromToken gets user from a valid access token
 func (s *Service) GetUserFromToken(ctx context.Context, tokenString string) (*types.User, error) {
+	user, _, err := s.authenticate(ctx, tokenString)
+	return user, err
+}
+
+// authenticate validates an access token and returns its user and claims.
+// Tokens of revoked sessions are rejected before they expire.
+func (s *Service) authenticate(ctx context.Context, tokenString string) (*types.User, *types.JWTClaims, error) {
 	claims, err := s.ValidateAccessToken(tokenString)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return s.repo.GetUserByID(ctx, claims.UserID)
+
+	if claims.SessionID != "" {
+		active, err := s.repo.IsSessionActive(ctx, claims.SessionID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !active {
+			return nil, nil, ErrSessionExpired
+		}
+	}
+
+	user, err := s.repo.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, claims, nil
 }
 
 // SetupMFA generates a TOTP secret and QR code for MFA setup
@@ -412,6 +534,14 @@ func (s *Service) ChangePassword(ctx context.Context, userID, currentPassword, n
 		}
 	}
 
+	disabled, err := s.localPasswordDisabled(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if disabled {
+		return ErrLocalPasswordDisabled
+	}
+
 	// Verify current password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(currentPassword)); err != nil {
 		return ErrInvalidCredentials
@@ -429,7 +559,7 @@ func (s *Service) ChangePassword(ctx context.Context, userID, currentPassword, n
 	}
 
 	// Revoke all sessions
-	s.repo.RevokeAllUserSessions(ctx, user.ID)
+	s.repo.RevokeAllUserSessions(ctx, user.ID, "password_change")
 	s.repo.LogAuditEvent(ctx, user.ID, "password_change", ip, userAgent, nil)
 
 	return nil
@@ -441,6 +571,10 @@ func (s *Service) CreateUser(ctx context.Context, email, password, name, role st
 		return nil, ErrPasswordTooWeak
 	}
 
+	if err := s.validateGrant(ctx, role); err != nil {
+		return nil, err
+	}
+
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, err
@@ -454,9 +588,18 @@ func (s *Service) UpdateProfile(ctx context.Context, userID, name, avatarURL str
 	return s.repo.UpdateUser(ctx, userID, name, avatarURL)
 }
 
-// GetProfile gets user profile
+// GetProfile gets user profile, including the permissions granted by the user's role
 func (s *Service) GetProfile(ctx context.Context, userID string) (*types.User, error) {
-	return s.repo.GetUserByID(ctx, userID)
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Permissions, err = s.RolePermissions(ctx, user.Role)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
 // ListUsers lists all users (admin only)
@@ -464,29 +607,425 @@ func (s *Service) ListUsers(ctx context.Context) ([]types.User, error) {
 	return s.repo.ListUsers(ctx)
 }
 
-// UpdateUser updates a user (admin only)
+// UpdateUser updates a user (admin only). Users whose role grants more than
+// the caller has cannot be changed.
 func (s *Service) UpdateUser(ctx context.Context, userID, name, role string, isActive *bool) (*types.User, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validateGrant(ctx, user.Role); err != nil {
+		return nil, err
+	}
+	if role != "" {
+		if err := s.validateGrant(ctx, role); err != nil {
+			return nil, err
+		}
+	}
 	return s.repo.UpdateUserAdmin(ctx, userID, name, role, isActive)
 }
 
-// DeleteUser deletes a user (admin only)
+// DeleteUser deletes a user (admin only). Users whose role grants more than
+// the caller has cannot be deleted.
 func (s *Service) DeleteUser(ctx context.Context, userID string) error {
+	if err := s.validateTarget(ctx, userID); err != nil {
+		return err
+	}
 	return s.repo.DeleteUser(ctx, userID)
 }
 
-// GetSessions returns active sessions for a user
-func (s *Service) GetSessions(ctx context.Context, userID string) ([]types.Session, error) {
-	return s.repo.GetUserSessions(ctx, userID)
-}
-
 // GetAuditLog returns audit events for a user
 func (s *Service) GetAuditLog(ctx context.Context, userID string, limit int) ([]types.AuthAuditLog, error) {
 	return s.repo.GetAuditLog(ctx, userID, limit)
 }
 
+// CreateServiceAccount creates a service account for CI and automation
+func (s *Service) CreateServiceAccount(ctx context.Context, name, role string) (*types.User, error) {
+	if err := s.validateGrant(ctx, role); err != nil {
+		return nil, err
+	}
+	email := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), " ", "-")) + "@service-accounts." + s.issuer
+	return s.repo.CreateServiceAccount(ctx, email, name, role)
+}
+
+// ListServiceAccounts lists all service accounts
+func (s *Service) ListServiceAccounts(ctx context.Context) ([]types.User, error) {
+	users, err := s.repo.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := []types.User{}
+	for _, user := range users {
+		if user.IsServiceAccount {
+			accounts = append(accounts, user)
+		}
+	}
+	return accounts, nil
+}
+
+// CreateServiceAccountToken creates an API token for a service account
+func (s *Service) CreateServiceAccountToken(ctx context.Context, accountID, creatorID string, req types.CreateAPITokenRequest, ip, userAgent string) (*types.CreateAPITokenResponse, error) {
+	account, err := s.repo.GetUserByID(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if !account.IsServiceAccount {
+		return nil, ErrNotServiceAccount
+	}
+	return s.CreateAPIToken(ctx, account, creatorID, req, ip, userAgent)
+}
+
+// CreateAPIToken creates an API token for owner. Its scopes must be granted by
+// both the owner's role and the caller in ctx. The plaintext token is only
+// returned here; a SHA-256 hash is stored.
+func (s *Service) CreateAPIToken(ctx context.Context, owner *types.User, creatorID string, req types.CreateAPITokenRequest, ip, userAgent string) (*types.CreateAPITokenResponse, error) {
+	if strings.TrimSpace(req.Name) == "" {
+		return nil, ErrInvalidTokenName
+	}
+	if len(req.Scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	granted, err := s.RolePermissions(ctx, owner.Role)
+	if err != nil {
+		return nil, err
+	}
+	for _, scope := range req.Scopes {
+		if !IsValidPermission(scope) {
+			return nil, fmt.Errorf("%w: unknown scope %q", ErrInvalidScope, scope)
+		}
+		if !containsString(granted, scope) {
+			return nil, fmt.Errorf("%w: role %s cannot grant %s", ErrInvalidScope, owner.Role, scope)
+		}
+	}
+	// Nobody mints a token that can do more than they can
+	if err := s.holdsPermissions(ctx, req.Scopes); err != nil {
+		return nil, err
+	}
+	if req.ExpiresInDays < 0 {
+		return nil, fmt.Errorf("%w: expires_in_days must not be negative", ErrInvalidScope)
+	}
+
+	secret, err := s.generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	plaintext := APITokenPrefix + strings.TrimRight(secret, "=")
+
+	token := &types.APIToken{
+		UserID:    owner.ID,
+		UserEmail: owner.Email,
+		Name:      strings.TrimSpace(req.Name),
+		Prefix:    plaintext[:len(APITokenPrefix)+8],
+		Scopes:    req.Scopes,
+		Products:  req.Products,
+		CreatedBy: creatorID,
+	}
+	if token.Products == nil {
+		token.Products = []string{}
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := s.repo.CreateAPIToken(ctx, token, hashToken(plaintext)); err != nil {
+		return nil, err
+	}
+
+	s.repo.LogAuditEvent(ctx, owner.ID, "api_token_create", ip, userAgent, map[string]interface{}{
+		"token_id":   token.ID,
+		"token_name": token.Name,
+		"scopes":     token.Scopes,
+		"products":   token.Products,
+		"created_by": creatorID,
+	})
+
+	return &types.CreateAPITokenResponse{
+		Token:    plaintext,
+		APIToken: token,
+	}, nil
+}
+
+// ListAPITokens lists the API tokens of a user, or all tokens when userID is empty
+func (s *Service) ListAPITokens(ctx context.Context, userID string) ([]types.APIToken, error) {
+	return s.repo.ListAPITokens(ctx, userID)
+}
+
+// RevokeAPIToken revokes an API token. With ownerID set, only that user's tokens can be revoked.
+func (s *Service) RevokeAPIToken(ctx context.Context, tokenID, ownerID, actorID, ip, userAgent string) error {
+	token, err := s.repo.GetAPITokenByID(ctx, tokenID)
+	if err != nil {
+		return err
+	}
+	if ownerID != "" && token.UserID != ownerID {
+		return ErrAPITokenNotFound
+	}
+
+	if err := s.repo.RevokeAPIToken(ctx, token.ID); err != nil {
+		return err
+	}
+
+	s.repo.LogAuditEvent(ctx, token.UserID, "api_token_revoke", ip, userAgent, map[string]interface{}{
+		"token_id":   token.ID,
+		"token_name": token.Name,
+		"revoked_by": actorID,
+	})
+	return nil
+}
+
+// AuthenticateAPIToken validates an API token, records its use in the audit log and
+// returns the owning user
+func (s *Service) AuthenticateAPIToken(ctx context.Context, plaintext, ip, userAgent, method, path string) (*types.User, *types.APIToken, error) {
+	token, err := s.repo.GetAPITokenByHash(ctx, hashToken(plaintext))
+	if err != nil {
+		if errors.Is(err, ErrAPITokenNotFound) {
+			return nil, nil, ErrInvalidAPIToken
+		}
+		return nil, nil, err
+	}
+
+	if token.RevokedAt != nil || (token.ExpiresAt != nil && token.ExpiresAt.Before(time.Now())) {
+		s.repo.LogAuditEvent(ctx, token.UserID, "api_token_rejected", ip, userAgent, map[string]interface{}{
+			"token_id":   token.ID,
+			"token_name": token.Name,
+			"method":     method,
+			"path":       path,
+		})
+		return nil, nil, ErrInvalidAPIToken
+	}
+
+	user, err := s.repo.GetUserByID(ctx, token.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !user.IsActive {
+		return nil, nil, ErrInvalidAPIToken
+	}
+
+	s.repo.TouchAPIToken(ctx, token.ID, ip)
+	s.repo.LogAuditEvent(ctx, user.ID, "api_token_used", ip, userAgent, map[string]interface{}{
+		"token_id":   token.ID,
+		"token_name": token.Name,
+		"method":     method,
+		"path":       path,
+	})
+
+	return user, token, nil
+}
+
+// Roles and permissions
+
+// RolePermissions returns the permissions granted by a role. Unknown roles grant nothing.
+func (s *Service) RolePermissions(ctx context.Context, role string) ([]string, error) {
+	if builtIn := builtInRole(role); builtIn != nil {
+		return builtIn.Permissions, nil
+	}
+
+	custom, err := s.repo.GetRole(ctx, role)
+	if err != nil {
+		if errors.Is(err, ErrRoleNotFound) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	return custom.Permissions, nil
+}
+
+// HasPermission reports whether a user's role grants a permission
+func (s *Service) HasPermission(ctx context.Context, user *types.User, permission string) (bool, error) {
+	granted, err := s.RolePermissions(ctx, user.Role)
+	if err != nil {
+		return false, err
+	}
+	return containsString(granted, permission), nil
+}
+
+// ListRoles lists the built-in roles followed by the custom roles
+func (s *Service) ListRoles(ctx context.Context) ([]types.Role, error) {
+	custom, err := s.repo.ListRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]types.Role{}, builtInRoles...), custom...), nil
+}
+
+// GetRole retrieves a built-in or custom role
+func (s *Service) GetRole(ctx context.Context, name string) (*types.Role, error) {
+	if builtIn := builtInRole(name); builtIn != nil {
+		return builtIn, nil
+	}
+	return s.repo.GetRole(ctx, name)
+}
+
+// CreateRole creates a custom role
+func (s *Service) CreateRole(ctx context.Context, req types.CreateRoleRequest, actorID, ip, userAgent string) (*types.Role, error) {
+	name := strings.ToLower(strings.TrimSpace(req.Name))
+	if name == "" || len(name) > 50 || strings.ContainsAny(name, " /") {
+		return nil, fmt.Errorf("%w: name must be 1-50 characters without spaces or slashes", ErrInvalidRole)
+	}
+	if builtInRole(name) != nil {
+		return nil, ErrRoleExists
+	}
+	if err := validatePermissions(req.Permissions); err != nil {
+		return nil, err
+	}
+	if err := s.holdsPermissions(ctx, req.Permissions); err != nil {
+		return nil, err
+	}
+
+	role := &types.Role{
+		Name:        name,
+		Description: req.Description,
+		Permissions: req.Permissions,
+	}
+	if err := s.repo.CreateRole(ctx, role); err != nil {
+		return nil, err
+	}
+
+	s.repo.LogAuditEvent(ctx, actorID, "role_create", ip, userAgent, map[string]interface{}{
+		"role":        role.Name,
+		"permissions": role.Permissions,
+	})
+	return role, nil
+}
+
+// UpdateRole replaces the description and permissions of a custom role. The
+// caller must hold every permission the role grants, before and after.
+func (s *Service) UpdateRole(ctx context.Context, name string, req types.UpdateRoleRequest, actorID, ip, userAgent string) (*types.Role, error) {
+	if builtInRole(name) != nil {
+		return nil, ErrBuiltInRole
+	}
+	if err := validatePermissions(req.Permissions); err != nil {
+		return nil, err
+	}
+	current, err := s.repo.GetRole(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.holdsPermissions(ctx, append(current.Permissions, req.Permissions...)); err != nil {
+		return nil, err
+	}
+
+	role := &types.Role{
+		Name:        name,
+		Description: req.Description,
+		Permissions: req.Permissions,
+	}
+	if err := s.repo.UpdateRole(ctx, role); err != nil {
+		return nil, err
+	}
+
+	s.repo.LogAuditEvent(ctx, actorID, "role_update", ip, userAgent, map[string]interface{}{
+		"role":        role.Name,
+		"permissions": role.Permissions,
+	})
+	return role, nil
+}
+
+// DeleteRole deletes a custom role that is no longer assigned to any user
+func (s *Service) DeleteRole(ctx context.Context, name, actorID, ip, userAgent string) error {
+	if builtInRole(name) != nil {
+		return ErrBuiltInRole
+	}
+
+	count, err := s.repo.CountUsersWithRole(ctx, name)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %d users still have the %s role", ErrRoleInUse, count, name)
+	}
+
+	if err := s.repo.DeleteRole(ctx, name); err != nil {
+		return err
+	}
+
+	s.repo.LogAuditEvent(ctx, actorID, "role_delete", ip, userAgent, map[string]interface{}{
+		"role": name,
+	})
+	return nil
+}
+
+// validateRole checks that a role exists before it is assigned
+func (s *Service) validateRole(ctx context.Context, role string) error {
+	if _, err := s.GetRole(ctx, role); err != nil {
+		if errors.Is(err, ErrRoleNotFound) {
+			return fmt.Errorf("%w: %s does not exist", ErrInvalidRole, role)
+		}
+		return err
+	}
+	return nil
+}
+
+// validateGrant checks that a role exists and that the caller holds every
+// permission it grants, so nobody can give an account more than they have
+func (s *Service) validateGrant(ctx context.Context, role string) error {
+	if err := s.validateRole(ctx, role); err != nil {
+		return err
+	}
+	permissions, err := s.RolePermissions(ctx, role)
+	if err != nil {
+		return err
+	}
+	return s.holdsPermissions(ctx, permissions)
+}
+
+// holdsPermissions checks that the caller in ctx holds every permission. An
+// API token holds the scopes its owner's role still grants.
+func (s *Service) holdsPermissions(ctx context.Context, permissions []string) error {
+	caller := GetUserFromContext(ctx)
+	if caller == nil {
+		return ErrPermissionNotHeld
+	}
+	held, err := s.RolePermissions(ctx, caller.Role)
+	if err != nil {
+		return err
+	}
+	token := GetAPITokenFromContext(ctx)
+
+	for _, permission := range permissions {
+		if !containsString(held, permission) || (token != nil && !TokenHasScope(token, permission)) {
+			return fmt.Errorf("%w: %s", ErrPermissionNotHeld, permission)
+		}
+	}
+	return nil
+}
+
+func validatePermissions(permissions []string) error {
+	if len(permissions) == 0 {
+		return fmt.Errorf("%w: at least one permission is required", ErrInvalidPermission)
+	}
+	for _, permission := range permissions {
+		if !IsValidPermission(permission) {
+			return fmt.Errorf("%w: unknown permission %q", ErrInvalidPermission, permission)
+		}
+	}
+	return nil
+}
+
+// TokenHasScope reports whether an API token grants a scope
+func TokenHasScope(token *types.APIToken, scope string) bool {
+	return containsString(token.Scopes, scope)
+}
+
+// TokenAllowsProduct reports whether an API token may act on a product
+func TokenAllowsProduct(token *types.APIToken, product string) bool {
+	return len(token.Products) == 0 || containsString(token.Products, product)
+}
+
 // Helper functions
 
-func (s *Service) generateToken(userID, email, role, tokenType string, duration time.Duration) (string, error) {
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) generateToken(userID, email, role, tokenType, sessionID string, duration time.Duration) (string, error) {
 	now := time.Now()
 	claims := jwt.MapClaims{
 		"user_id": userID,
@@ -497,18 +1036,15 @@ func (s *Service) generateToken(userID, email, role, tokenType string, duration
 		"exp":     now.Add(duration).Unix(),
 		"iss":     s.issuer,
 	}
+	if sessionID != "" {
+		claims["sid"] = sessionID
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.jwtSecret)
+	return s.keys.Sign(claims)
 }
 
 func (s *Service) validateToken(tokenString, expectedType string) (*types.JWTClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return s.jwtSecret, nil
-	})
+	token, err := jwt.Parse(tokenString, s.keys.Keyfunc, jwt.WithValidMethods(s.keys.ValidMethods()))
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
@@ -528,11 +1064,15 @@ func (s *Service) validateToken(tokenString, expectedType string) (*types.JWTCla
 		return nil, ErrInvalidToken
 	}
 
+	// Tokens issued before sessions were recorded in them have no sid
+	sessionID, _ := claims["sid"].(string)
+
 	return &types.JWTClaims{
-		UserID: claims["user_id"].(string),
-		Email:  claims["email"].(string),
-		Role:   claims["role"].(string),
-		Type:   tokenType,
+		UserID:    claims["user_id"].(string),
+		Email:     claims["email"].(string),
+		Role:      claims["role"].(string),
+		Type:      tokenType,
+		SessionID: sessionID,
 	}, nil
 }
 
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database/dbtest"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// newTestService returns a service signing access tokens with a loaded EdDSA key
+func newTestService(t *testing.T, db *database.DB) *Service {
+	t.Helper()
+	repo := NewRepository(db)
+	keys, err := NewKeyManager(repo, config.AuthConfig{
+		JWTSecret:      "test-secret",
+		JWTAlgorithm:   SigningAlgorithmEdDSA,
+		JWTKeyRotation: 30 * 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewKeyManager: %v", err)
+	}
+	if err := keys.Load(context.Background()); err != nil {
+		t.Fatalf("load keys: %v", err)
+	}
+	return NewService(repo, keys, "test")
+}
+
+func TestUserAdministrationLimitedToCallerRole(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		svc := newTestService(t, db)
+		repo := svc.repo
+
+		admin, err := repo.CreateUser(context.Background(), "admin@example.com", "hash", "Admin", RoleAdmin)
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		viewer, err := repo.CreateUser(context.Background(), "viewer@example.com", "hash", "Viewer", RoleViewer)
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		operator, err := repo.CreateUser(context.Background(), "operator@example.com", "hash", "Operator", RoleOperator)
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		session, err := repo.CreateSession(context.Background(), admin.ID, "token-1", "test", "192.0.2.1", deviceInfo{}, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+
+		// An operator cannot act on an admin, whose role grants more
+		ctx := SetUserInContext(context.Background(), operator)
+		if err := svc.DeleteUser(ctx, admin.ID); !errors.Is(err, ErrPermissionNotHeld) {
+			t.Errorf("DeleteUser(admin) = %v, want ErrPermissionNotHeld", err)
+		}
+		if _, err := svc.RevokeSession(ctx, session.ID, admin.ID, operator.ID, "192.0.2.2", "test"); !errors.Is(err, ErrPermissionNotHeld) {
+			t.Errorf("RevokeSession(admin) = %v, want ErrPermissionNotHeld", err)
+		}
+		if _, err := svc.RevokeUserSessions(ctx, admin.ID, operator.ID, "192.0.2.2", "test"); !errors.Is(err, ErrPermissionNotHeld) {
+			t.Errorf("RevokeUserSessions(admin) = %v, want ErrPermissionNotHeld", err)
+		}
+		if _, err := repo.GetUserByID(context.Background(), admin.ID); err != nil {
+			t.Errorf("admin deleted: %v", err)
+		}
+		if active, err := repo.IsSessionActive(context.Background(), session.ID); err != nil || !active {
+			t.Errorf("IsSessionActive = %v, %v; want the admin still signed in", active, err)
+		}
+
+		// Users whose role grants no more than the caller's can be removed
+		if err := svc.DeleteUser(ctx, viewer.ID); err != nil {
+			t.Errorf("DeleteUser(viewer) = %v", err)
+		}
+		// Admins sign out their own sessions
+		ctx = SetUserInContext(context.Background(), admin)
+		if _, err := svc.RevokeSession(ctx, session.ID, admin.ID, admin.ID, "192.0.2.1", "test"); err != nil {
+			t.Errorf("RevokeSession(own) = %v", err)
+		}
+		if err := svc.DeleteUser(ctx, operator.ID); err != nil {
+			t.Errorf("DeleteUser(operator) by admin = %v", err)
+		}
+	})
+}
+
+func TestServiceAccountTokenLimitedToCallerPermissions(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		svc := newTestService(t, db)
+		repo := svc.repo
+
+		role := &types.Role{Name: "token-manager", Permissions: []string{PermTokensManage, PermReleasesUpload}}
+		if err := repo.CreateRole(context.Background(), role); err != nil {
+			t.Fatalf("CreateRole: %v", err)
+		}
+		manager, err := repo.CreateUser(context.Background(), "tokens@example.com", "hash", "Tokens", role.Name)
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		account, err := repo.CreateServiceAccount(context.Background(), "deploy@service-accounts.test", "deploy", RoleAdmin)
+		if err != nil {
+			t.Fatalf("CreateServiceAccount: %v", err)
+		}
+
+		ctx := SetUserInContext(context.Background(), manager)
+		create := func(scopes ...string) error {
+			req := types.CreateAPITokenRequest{Name: "ci", Scopes: scopes}
+			_, err := svc.CreateServiceAccountToken(ctx, account.ID, manager.ID, req, "192.0.2.1", "test")
+			return err
+		}
+		// The admin account's role grants it, but the caller does not hold it
+		if err := create(PermUsersWrite); !errors.Is(err, ErrPermissionNotHeld) {
+			t.Errorf("CreateServiceAccountToken(users:write) = %v, want ErrPermissionNotHeld", err)
+		}
+		if err := create(PermReleasesUpload, PermKeysManage); !errors.Is(err, ErrPermissionNotHeld) {
+			t.Errorf("CreateServiceAccountToken(keys:manage) = %v, want ErrPermissionNotHeld", err)
+		}
+		if err := create(PermReleasesUpload); err != nil {
+			t.Errorf("CreateServiceAccountToken(releases:upload) = %v", err)
+		}
+	})
+}
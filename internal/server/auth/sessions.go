@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// RefreshReuseGracePeriod is how long a rotated refresh token is rejected
+// without revoking its session. Clients that refresh from two tabs at once
+// present the same token twice; replays after this window are treated as theft.
+const RefreshReuseGracePeriod = 30 * time.Second
+
+// ErrRefreshTokenReused is returned when a refresh token that was already
+// rotated is presented again
+var ErrRefreshTokenReused = errors.New("refresh token has already been used")
+
+// SetSessionTimeouts sets how long sessions last without a refresh and since sign-in
+func (s *Service) SetSessionTimeouts(idle, absolute time.Duration) {
+	s.idleTimeout = idle
+	s.absoluteTimeout = absolute
+}
+
+// checkRefreshTokenReuse handles a refresh token that matches no session. If
+// the token was rotated past more than RefreshReuseGracePeriod ago, it has been
+// copied, so the session it belonged to is revoked along with every token it
+// has issued since.
+func (s *Service) checkRefreshTokenReuse(ctx context.Context, refreshTokenHash, ip, userAgent string) error {
+	sessionID, usedAt, err := s.repo.GetUsedRefreshToken(ctx, refreshTokenHash)
+	if err != nil {
+		return err
+	}
+	if time.Since(usedAt) < RefreshReuseGracePeriod {
+		return ErrRefreshTokenReused
+	}
+
+	session, err := s.repo.GetSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.RevokeSession(ctx, session.ID, "refresh_token_reuse"); err != nil {
+		return err
+	}
+
+	s.repo.LogAuditEvent(ctx, session.UserID, "refresh_token_reuse", ip, userAgent, map[string]interface{}{
+		"session_id": session.ID,
+		"used_at":    usedAt,
+	})
+	return ErrRefreshTokenReused
+}
+
+// GetSessions returns active sessions for a user, marking currentSessionID
+func (s *Service) GetSessions(ctx context.Context, userID, currentSessionID string) ([]types.Session, error) {
+	sessions, err := s.repo.GetUserSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Leave out sessions past a timeout that have not been refreshed since
+	now := time.Now()
+	active := make([]types.Session, 0, len(sessions))
+	for _, session := range sessions {
+		absolute := session.CreatedAt.Add(s.absoluteTimeout)
+		if absolute.Before(session.ExpiresAt) {
+			session.ExpiresAt = absolute
+		}
+		session.IdleExpiresAt = session.LastUsedAt.Add(s.idleTimeout)
+		if session.ExpiresAt.Before(session.IdleExpiresAt) {
+			session.IdleExpiresAt = session.ExpiresAt
+		}
+		if !now.Before(session.IdleExpiresAt) {
+			continue
+		}
+
+		session.Current = session.ID == currentSessionID
+		active = append(active, session)
+	}
+
+	return active, nil
+}
+
+// GetUserSessions returns a user's active sessions for an administrator
+func (s *Service) GetUserSessions(ctx context.Context, userID string) ([]types.Session, error) {
+	if _, err := s.repo.GetUserByID(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.GetSessions(ctx, userID, "")
+}
+
+// RevokeSession signs out a single session. When ownerID is set the session
+// must belong to that user; actorID records who revoked it. Sessions of
+// users whose role grants more than the caller has cannot be revoked by
+// anyone but their owner.
+func (s *Service) RevokeSession(ctx context.Context, sessionID, ownerID, actorID, ip, userAgent string) (*types.Session, error) {
+	session, err := s.repo.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if ownerID != "" && session.UserID != ownerID {
+		return nil, ErrSessionNotFound
+	}
+	if actorID != session.UserID {
+		if err := s.validateTarget(ctx, session.UserID); err != nil {
+			return nil, err
+		}
+	}
+	if session.RevokedAt != nil {
+		return session, nil
+	}
+
+	reason := "revoked"
+	if actorID != session.UserID {
+		reason = "admin_revoked"
+	}
+	if err := s.repo.RevokeSession(ctx, session.ID, reason); err != nil {
+		return nil, err
+	}
+
+	s.repo.LogAuditEvent(ctx, session.UserID, "session_revoke", ip, userAgent, map[string]interface{}{
+		"session_id": session.ID,
+		"revoked_by": actorID,
+	})
+	return session, nil
+}
+
+// RevokeUserSessions signs a user out everywhere on behalf of an administrator
+// and returns how many sessions were revoked. Users whose role grants more
+// than the caller has cannot be signed out.
+func (s *Service) RevokeUserSessions(ctx context.Context, userID, actorID, ip, userAgent string) (int64, error) {
+	if err := s.validateTarget(ctx, userID); err != nil {
+		return 0, err
+	}
+
+	revoked, err := s.repo.RevokeAllUserSessions(ctx, userID, "admin_revoked")
+	if err != nil {
+		return 0, err
+	}
+
+	s.repo.LogAuditEvent(ctx, userID, "session_revoke_all", ip, userAgent, map[string]interface{}{
+		"sessions":   revoked,
+		"revoked_by": actorID,
+	})
+	return revoked, nil
+}
+
+// validateTarget checks that the caller in ctx holds every permission of the
+// user an administrator acts on
+func (s *Service) validateTarget(ctx context.Context, userID string) error {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.validateGrant(ctx, user.Role)
+}
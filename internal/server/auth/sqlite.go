@@ -0,0 +1,1138 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// SQLiteRepository stores users, sessions and credentials in a SQLite database
+type SQLiteRepository struct {
+	db *database.SQLite
+}
+
+// NewSQLiteRepository creates a repository backed by SQLite
+func NewSQLiteRepository(db *database.DB) *SQLiteRepository {
+	return &SQLiteRepository{db: db.SQLite}
+}
+
+// sqliteUserColumns are the columns scanned by scanSQLiteUser
+const sqliteUserColumns = `id, email, name, role, avatar_url, mfa_enabled, is_active, is_service_account, email_verified,
+	last_login_at, password_changed_at, created_at, updated_at`
+
+func scanSQLiteUser(row database.Row) (*types.User, error) {
+	var user types.User
+	var avatar sql.NullString
+
+	if err := row.Scan(
+		&user.ID, &user.Email, &user.Name, &user.Role, &avatar,
+		&user.MFAEnabled, &user.IsActive, &user.IsServiceAccount, &user.EmailVerified,
+		&user.LastLoginAt, &user.PasswordChangedAt, &user.CreatedAt, &user.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	user.AvatarURL = avatar.String
+
+	return &user, nil
+}
+
+// insertUser creates a user and maps a duplicate email to ErrUserExists
+func (r *SQLiteRepository) insertUser(ctx context.Context, email, passwordHash, name, role string, serviceAccount, emailVerified bool) (*types.User, error) {
+	now := time.Now()
+	user, err := scanSQLiteUser(r.db.QueryRowContext(ctx, `
+		INSERT INTO users (id, email, password_hash, name, role, is_service_account, email_verified,
+			password_changed_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8, $8)
+		RETURNING `+sqliteUserColumns,
+		uuid.New().String(), email, passwordHash, name, role, serviceAccount, emailVerified, now))
+	if err != nil {
+		if database.IsUniqueViolation(err) {
+			return nil, ErrUserExists
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// CreateUser implements Repository
+func (r *SQLiteRepository) CreateUser(ctx context.Context, email, passwordHash, name, role string) (*types.User, error) {
+	return r.insertUser(ctx, email, passwordHash, name, role, false, false)
+}
+
+// GetUserByEmail implements Repository
+func (r *SQLiteRepository) GetUserByEmail(ctx context.Context, email string) (*types.UserWithPassword, error) {
+	var user types.UserWithPassword
+	var avatarURL, mfaSecret sql.NullString
+	var backupCodes database.StringList
+
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, email, password_hash, name, role, avatar_url,
+			   mfa_enabled, mfa_secret, mfa_backup_codes, is_active, is_service_account, email_verified,
+			   last_login_at, password_changed_at, failed_login_attempts, locked_until,
+			   created_at, updated_at
+		FROM users
+		WHERE email = $1
+	`, email).Scan(
+		&user.ID, &user.Email, &user.PasswordHash, &user.Name, &user.Role, &avatarURL,
+		&user.MFAEnabled, &mfaSecret, &backupCodes, &user.IsActive, &user.IsServiceAccount, &user.EmailVerified,
+		&user.LastLoginAt, &user.PasswordChangedAt, &user.FailedLoginAttempts, &user.LockedUntil,
+		&user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	user.AvatarURL = avatarURL.String
+	user.MFASecret = mfaSecret.String
+	user.MFABackupCodes = backupCodes
+
+	return &user, nil
+}
+
+// GetUserByID implements Repository
+func (r *SQLiteRepository) GetUserByID(ctx context.Context, id string) (*types.User, error) {
+	user, err := scanSQLiteUser(r.db.QueryRowContext(ctx, `
+		SELECT `+sqliteUserColumns+`
+		FROM users
+		WHERE id = $1
+	`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// ListUsers implements Repository
+func (r *SQLiteRepository) ListUsers(ctx context.Context) ([]types.User, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+sqliteUserColumns+`
+		FROM users
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []types.User
+	for rows.Next() {
+		user, err := scanSQLiteUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+
+	return users, rows.Err()
+}
+
+// UpdateUser implements Repository
+func (r *SQLiteRepository) UpdateUser(ctx context.Context, id, name, avatarURL string) (*types.User, error) {
+	user, err := scanSQLiteUser(r.db.QueryRowContext(ctx, `
+		UPDATE users
+		SET name = COALESCE(NULLIF($2, ''), name),
+			avatar_url = COALESCE(NULLIF($3, ''), avatar_url),
+			updated_at = $4
+		WHERE id = $1
+		RETURNING `+sqliteUserColumns,
+		id, name, avatarURL, time.Now()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// updateUser runs an UPDATE on one user, returning ErrUserNotFound if there is no such user
+func (r *SQLiteRepository) updateUser(ctx context.Context, query string, args ...interface{}) error {
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// UpdatePassword implements Repository
+func (r *SQLiteRepository) UpdatePassword(ctx context.Context, id, passwordHash string) error {
+	return r.updateUser(ctx, `
+		UPDATE users
+		SET password_hash = $2, password_changed_at = $3, updated_at = $3
+		WHERE id = $1
+	`, id, passwordHash, time.Now())
+}
+
+// UpdateMFASecret implements Repository
+func (r *SQLiteRepository) UpdateMFASecret(ctx context.Context, id, secret string) error {
+	return r.updateUser(ctx, `
+		UPDATE users
+		SET mfa_secret = $2, updated_at = $3
+		WHERE id = $1
+	`, id, secret, time.Now())
+}
+
+// EnableMFA implements Repository
+func (r *SQLiteRepository) EnableMFA(ctx context.Context, id string, backupCodes []string) error {
+	return r.updateUser(ctx, `
+		UPDATE users
+		SET mfa_enabled = 1, mfa_backup_codes = $2, mfa_verified_at = $3, updated_at = $3
+		WHERE id = $1
+	`, id, database.StringList(backupCodes), time.Now())
+}
+
+// DisableMFA implements Repository
+func (r *SQLiteRepository) DisableMFA(ctx context.Context, id string) error {
+	return r.updateUser(ctx, `
+		UPDATE users
+		SET mfa_enabled = 0, mfa_secret = NULL, mfa_backup_codes = NULL,
+			mfa_verified_at = NULL, updated_at = $2
+		WHERE id = $1
+	`, id, time.Now())
+}
+
+// IncrementFailedAttempts implements Repository
+func (r *SQLiteRepository) IncrementFailedAttempts(ctx context.Context, id string) (int, error) {
+	now := time.Now()
+	var attempts int
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE users
+		SET failed_login_attempts = failed_login_attempts + 1,
+			locked_until = CASE
+				WHEN failed_login_attempts >= 4 THEN $2
+				ELSE locked_until
+			END,
+			updated_at = $3
+		WHERE id = $1
+		RETURNING failed_login_attempts
+	`, id, now.Add(15*time.Minute), now).Scan(&attempts)
+	return attempts, err
+}
+
+// ResetFailedAttempts implements Repository
+func (r *SQLiteRepository) ResetFailedAttempts(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE users
+		SET failed_login_attempts = 0, locked_until = NULL, updated_at = $2
+		WHERE id = $1
+	`, id, time.Now())
+	return err
+}
+
+// UpdateLastLogin implements Repository
+func (r *SQLiteRepository) UpdateLastLogin(ctx context.Context, id, ip string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE users
+		SET last_login_at = $3, last_login_ip = $2, updated_at = $3
+		WHERE id = $1
+	`, id, ip, time.Now())
+	return err
+}
+
+// UseBackupCode implements Repository
+func (r *SQLiteRepository) UseBackupCode(ctx context.Context, id, code string) (bool, error) {
+	// Hash the code to compare
+	codeHash := sha256.Sum256([]byte(code))
+	codeHashStr := hex.EncodeToString(codeHash[:])
+
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE users
+		SET mfa_backup_codes = (SELECT json_group_array(value) FROM json_each(mfa_backup_codes) WHERE value != $2),
+			updated_at = $3
+		WHERE id = $1 AND EXISTS (SELECT 1 FROM json_each(mfa_backup_codes) WHERE value = $2)
+	`, id, codeHashStr, time.Now())
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteUser implements Repository
+func (r *SQLiteRepository) DeleteUser(ctx context.Context, id string) error {
+	return r.updateUser(ctx, `DELETE FROM users WHERE id = $1`, id)
+}
+
+// UpdateUserAdmin implements Repository
+func (r *SQLiteRepository) UpdateUserAdmin(ctx context.Context, id string, name, role string, isActive *bool) (*types.User, error) {
+	user, err := scanSQLiteUser(r.db.QueryRowContext(ctx, `
+		UPDATE users
+		SET name = COALESCE(NULLIF($2, ''), name),
+			role = COALESCE(NULLIF($3, ''), role),
+			is_active = COALESCE($4, is_active),
+			updated_at = $5
+		WHERE id = $1
+		RETURNING `+sqliteUserColumns,
+		id, name, role, isActive, time.Now()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// Session operations
+
+func scanSQLiteSession(row database.Row) (*types.Session, error) {
+	var session types.Session
+	var userAgent, ipAddress, browser, osName, deviceType, revokedReason sql.NullString
+
+	if err := row.Scan(
+		&session.ID, &session.UserID, &userAgent, &ipAddress, &browser, &osName, &deviceType,
+		&session.LastUsedAt, &session.ExpiresAt, &session.RevokedAt, &revokedReason, &session.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	session.UserAgent = userAgent.String
+	session.IPAddress = ipAddress.String
+	session.Browser = browser.String
+	session.OS = osName.String
+	session.DeviceType = deviceType.String
+	session.RevokedReason = revokedReason.String
+
+	return &session, nil
+}
+
+// CreateSession implements Repository
+func (r *SQLiteRepository) CreateSession(ctx context.Context, userID, refreshTokenHash, userAgent, ip string, device deviceInfo, expiresAt time.Time) (*types.Session, error) {
+	row := r.db.QueryRowContext(ctx, `
+		INSERT INTO sessions (id, user_id, refresh_token_hash, user_agent, ip_address, browser, os, device_type,
+			last_used_at, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), $8, $9, $10, $9)
+		RETURNING `+sessionColumns,
+		uuid.New().String(), userID, refreshTokenHash, userAgent, ip, device.Browser, device.OS, device.Type,
+		time.Now(), expiresAt)
+	return scanSQLiteSession(row)
+}
+
+// GetSession implements Repository
+func (r *SQLiteRepository) GetSession(ctx context.Context, id string) (*types.Session, error) {
+	session, err := scanSQLiteSession(r.db.QueryRowContext(ctx, `
+		SELECT `+sessionColumns+` FROM sessions WHERE id = $1
+	`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetSessionByToken implements Repository
+func (r *SQLiteRepository) GetSessionByToken(ctx context.Context, refreshTokenHash string) (*types.Session, error) {
+	session, err := scanSQLiteSession(r.db.QueryRowContext(ctx, `
+		SELECT `+sessionColumns+` FROM sessions WHERE refresh_token_hash = $1
+	`, refreshTokenHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	if session.ExpiresAt.Before(time.Now()) || session.RevokedAt != nil {
+		return nil, ErrSessionExpired
+	}
+
+	return session, nil
+}
+
+// IsSessionActive implements Repository
+func (r *SQLiteRepository) IsSessionActive(ctx context.Context, id string) (bool, error) {
+	var active bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM sessions WHERE id = $1 AND revoked_at IS NULL AND expires_at > $2
+		)
+	`, id, time.Now()).Scan(&active)
+	return active, err
+}
+
+// RotateSessionToken implements Repository
+func (r *SQLiteRepository) RotateSessionToken(ctx context.Context, id, oldTokenHash, newTokenHash, ip string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.ExecContext(ctx, `
+		UPDATE sessions SET refresh_token_hash = $3, ip_address = $4, last_used_at = $5
+		WHERE id = $1 AND refresh_token_hash = $2 AND revoked_at IS NULL
+	`, id, oldTokenHash, newTokenHash, ip, now)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrSessionNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO used_refresh_tokens (token_hash, session_id, used_at) VALUES ($1, $2, $3)
+	`, oldTokenHash, id, now)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetUsedRefreshToken implements Repository
+func (r *SQLiteRepository) GetUsedRefreshToken(ctx context.Context, tokenHash string) (string, time.Time, error) {
+	var sessionID string
+	var usedAt time.Time
+	err := r.db.QueryRowContext(ctx, `
+		SELECT session_id, used_at FROM used_refresh_tokens WHERE token_hash = $1
+	`, tokenHash).Scan(&sessionID, &usedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", time.Time{}, ErrSessionNotFound
+		}
+		return "", time.Time{}, err
+	}
+	return sessionID, usedAt, nil
+}
+
+// RevokeSession implements Repository
+func (r *SQLiteRepository) RevokeSession(ctx context.Context, id, reason string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE sessions SET revoked_at = $3, revoked_reason = $2 WHERE id = $1 AND revoked_at IS NULL
+	`, id, reason, time.Now())
+	return err
+}
+
+// RevokeAllUserSessions implements Repository
+func (r *SQLiteRepository) RevokeAllUserSessions(ctx context.Context, userID, reason string) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE sessions SET revoked_at = $3, revoked_reason = $2 WHERE user_id = $1 AND revoked_at IS NULL
+	`, userID, reason, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetUserSessions implements Repository
+func (r *SQLiteRepository) GetUserSessions(ctx context.Context, userID string) ([]types.Session, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+sessionColumns+`
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY last_used_at DESC
+	`, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []types.Session{}
+	for rows.Next() {
+		session, err := scanSQLiteSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// CleanupExpiredSessions implements Repository
+func (r *SQLiteRepository) CleanupExpiredSessions(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, `
+		DELETE FROM sessions WHERE expires_at < $1 OR revoked_at IS NOT NULL
+	`, time.Now())
+	return err
+}
+
+// Audit logging
+
+// LogAuditEvent implements Repository
+func (r *SQLiteRepository) LogAuditEvent(ctx context.Context, userID, eventType, ip, userAgent string, details map[string]interface{}) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO auth_audit_log (id, user_id, event_type, ip_address, user_agent, details, created_at)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7)
+	`, uuid.New().String(), userID, eventType, ip, userAgent, database.JSON{V: details}, time.Now())
+	return err
+}
+
+// GetAuditLog implements Repository
+func (r *SQLiteRepository) GetAuditLog(ctx context.Context, userID string, limit int) ([]types.AuthAuditLog, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, event_type, ip_address, user_agent, details, created_at
+		FROM auth_audit_log
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []types.AuthAuditLog
+	for rows.Next() {
+		var event types.AuthAuditLog
+		var userIDStr, ipAddress, userAgent sql.NullString
+
+		if err := rows.Scan(
+			&event.ID, &userIDStr, &event.EventType, &ipAddress, &userAgent,
+			database.JSON{V: &event.Details}, &event.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		event.UserID = userIDStr.String
+		event.IPAddress = ipAddress.String
+		event.UserAgent = userAgent.String
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// Service accounts
+
+// CreateServiceAccount implements Repository
+func (r *SQLiteRepository) CreateServiceAccount(ctx context.Context, email, name, role string) (*types.User, error) {
+	return r.insertUser(ctx, email, "!", name, role, true, true)
+}
+
+// API token operations
+
+const sqliteAPITokenColumns = `t.id, t.user_id, u.email, t.name, t.token_prefix, t.scopes, t.products, t.expires_at,
+	t.last_used_at, COALESCE(t.last_used_ip, ''), t.revoked_at, COALESCE(t.created_by, ''), t.created_at`
+
+func scanSQLiteAPIToken(row database.Row) (*types.APIToken, error) {
+	var token types.APIToken
+	err := row.Scan(
+		&token.ID, &token.UserID, &token.UserEmail, &token.Name, &token.Prefix,
+		(*database.StringList)(&token.Scopes), (*database.StringList)(&token.Products),
+		&token.ExpiresAt, &token.LastUsedAt, &token.LastUsedIP, &token.RevokedAt, &token.CreatedBy, &token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// CreateAPIToken implements Repository
+func (r *SQLiteRepository) CreateAPIToken(ctx context.Context, token *types.APIToken, tokenHash string) error {
+	token.ID = uuid.New().String()
+	token.CreatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO api_tokens (id, user_id, name, token_prefix, token_hash, scopes, products, expires_at, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10)
+	`, token.ID, token.UserID, token.Name, token.Prefix, tokenHash, database.StringList(token.Scopes),
+		database.StringList(token.Products), token.ExpiresAt, token.CreatedBy, token.CreatedAt)
+	return err
+}
+
+// GetAPITokenByHash implements Repository
+func (r *SQLiteRepository) GetAPITokenByHash(ctx context.Context, tokenHash string) (*types.APIToken, error) {
+	token, err := scanSQLiteAPIToken(r.db.QueryRowContext(ctx, `
+		SELECT `+sqliteAPITokenColumns+`
+		FROM api_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1
+	`, tokenHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAPITokenNotFound
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+// GetAPITokenByID implements Repository
+func (r *SQLiteRepository) GetAPITokenByID(ctx context.Context, id string) (*types.APIToken, error) {
+	token, err := scanSQLiteAPIToken(r.db.QueryRowContext(ctx, `
+		SELECT `+sqliteAPITokenColumns+`
+		FROM api_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.id = $1
+	`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAPITokenNotFound
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+// ListAPITokens implements Repository
+func (r *SQLiteRepository) ListAPITokens(ctx context.Context, userID string) ([]types.APIToken, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+sqliteAPITokenColumns+`
+		FROM api_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE $1 = '' OR t.user_id = $1
+		ORDER BY t.created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []types.APIToken
+	for rows.Next() {
+		token, err := scanSQLiteAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// RevokeAPIToken implements Repository
+func (r *SQLiteRepository) RevokeAPIToken(ctx context.Context, id string) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE api_tokens SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL
+	`, id, time.Now())
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrAPITokenNotFound
+	}
+	return nil
+}
+
+// TouchAPIToken implements Repository
+func (r *SQLiteRepository) TouchAPIToken(ctx context.Context, id, ip string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE api_tokens SET last_used_at = $3, last_used_ip = $2 WHERE id = $1
+	`, id, ip, time.Now())
+	return err
+}
+
+// Role operations
+
+// ListRoles implements Repository
+func (r *SQLiteRepository) ListRoles(ctx context.Context) ([]types.Role, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT name, COALESCE(description, ''), permissions, created_at, updated_at
+		FROM roles
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []types.Role
+	for rows.Next() {
+		var role types.Role
+		if err := rows.Scan(&role.Name, &role.Description, (*database.StringList)(&role.Permissions),
+			&role.CreatedAt, &role.UpdatedAt); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// GetRole implements Repository
+func (r *SQLiteRepository) GetRole(ctx context.Context, name string) (*types.Role, error) {
+	var role types.Role
+	err := r.db.QueryRowContext(ctx, `
+		SELECT name, COALESCE(description, ''), permissions, created_at, updated_at
+		FROM roles
+		WHERE name = $1
+	`, name).Scan(&role.Name, &role.Description, (*database.StringList)(&role.Permissions), &role.CreatedAt, &role.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+	return &role, nil
+}
+
+// CreateRole implements Repository
+func (r *SQLiteRepository) CreateRole(ctx context.Context, role *types.Role) error {
+	now := time.Now()
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO roles (name, description, permissions, created_at, updated_at)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $4)
+	`, role.Name, role.Description, database.StringList(role.Permissions), now)
+	if err != nil {
+		if database.IsUniqueViolation(err) {
+			return ErrRoleExists
+		}
+		return err
+	}
+	role.CreatedAt = now
+	role.UpdatedAt = now
+	return nil
+}
+
+// UpdateRole implements Repository
+func (r *SQLiteRepository) UpdateRole(ctx context.Context, role *types.Role) error {
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE roles SET description = NULLIF($2, ''), permissions = $3, updated_at = $4
+		WHERE name = $1
+		RETURNING created_at, updated_at
+	`, role.Name, role.Description, database.StringList(role.Permissions), time.Now()).Scan(&role.CreatedAt, &role.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRoleNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteRole implements Repository
+func (r *SQLiteRepository) DeleteRole(ctx context.Context, name string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM roles WHERE name = $1`, name)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+// CountUsersWithRole implements Repository
+func (r *SQLiteRepository) CountUsersWithRole(ctx context.Context, name string) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE role = $1`, name).Scan(&count)
+	return count, err
+}
+
+// SSO operations
+
+// CreateSSOUser implements Repository
+func (r *SQLiteRepository) CreateSSOUser(ctx context.Context, email, name, role string, emailVerified bool) (*types.User, error) {
+	return r.insertUser(ctx, email, "!", name, role, false, emailVerified)
+}
+
+// GetIdentity implements Repository
+func (r *SQLiteRepository) GetIdentity(ctx context.Context, issuer, subject string) (*types.UserIdentity, error) {
+	var identity types.UserIdentity
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, user_id, issuer, subject, COALESCE(email, ''), created_at, last_login_at
+		FROM user_identities
+		WHERE issuer = $1 AND subject = $2
+	`, issuer, subject).Scan(
+		&identity.ID, &identity.UserID, &identity.Issuer, &identity.Subject, &identity.Email,
+		&identity.CreatedAt, &identity.LastLoginAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrIdentityNotFound
+		}
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// CreateIdentity implements Repository
+func (r *SQLiteRepository) CreateIdentity(ctx context.Context, identity *types.UserIdentity) error {
+	id := uuid.New().String()
+	now := time.Now()
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_identities (id, user_id, issuer, subject, email, created_at, last_login_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $6)
+	`, id, identity.UserID, identity.Issuer, identity.Subject, identity.Email, now)
+	if err != nil {
+		return err
+	}
+
+	identity.ID = id
+	identity.CreatedAt = now
+	identity.LastLoginAt = &now
+	return nil
+}
+
+// TouchIdentity implements Repository
+func (r *SQLiteRepository) TouchIdentity(ctx context.Context, id, email string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE user_identities SET last_login_at = $3, email = COALESCE(NULLIF($2, ''), email) WHERE id = $1
+	`, id, email, time.Now())
+	return err
+}
+
+// HasIdentity implements Repository
+func (r *SQLiteRepository) HasIdentity(ctx context.Context, userID string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM user_identities WHERE user_id = $1)
+	`, userID).Scan(&exists)
+	return exists, err
+}
+
+// CreateOIDCLoginState implements Repository
+func (r *SQLiteRepository) CreateOIDCLoginState(ctx context.Context, stateHash string, state *oidcLoginState, expiresAt time.Time) error {
+	now := time.Now()
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM oidc_login_states WHERE expires_at < $1`, now); err != nil {
+		return err
+	}
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO oidc_login_states (state_hash, code_verifier, nonce, redirect_to, link_user_id, expires_at, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7)
+	`, stateHash, state.CodeVerifier, state.Nonce, state.RedirectTo, state.LinkUserID, expiresAt, now)
+	return err
+}
+
+// ConsumeOIDCLoginState implements Repository
+func (r *SQLiteRepository) ConsumeOIDCLoginState(ctx context.Context, stateHash string) (*oidcLoginState, error) {
+	var state oidcLoginState
+	err := r.db.QueryRowContext(ctx, `
+		DELETE FROM oidc_login_states
+		WHERE state_hash = $1
+		RETURNING code_verifier, nonce, COALESCE(redirect_to, ''), COALESCE(link_user_id, ''), expires_at
+	`, stateHash).Scan(&state.CodeVerifier, &state.Nonce, &state.RedirectTo, &state.LinkUserID, &state.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOIDCStateInvalid
+		}
+		return nil, err
+	}
+	if state.ExpiresAt.Before(time.Now()) {
+		return nil, ErrOIDCStateInvalid
+	}
+	return &state, nil
+}
+
+// WebAuthn operations
+
+func scanSQLiteWebAuthnCredential(row database.Row) (*types.WebAuthnCredential, error) {
+	var credential types.WebAuthnCredential
+	var signCount int64
+	err := row.Scan(
+		&credential.ID, &credential.UserID, &credential.Name, &credential.CredentialID, &credential.PublicKey,
+		&signCount, (*database.StringList)(&credential.Transports), &credential.AAGUID, &credential.LastUsedAt,
+		&credential.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	credential.SignCount = uint32(signCount)
+	return &credential, nil
+}
+
+// ListWebAuthnCredentials implements Repository
+func (r *SQLiteRepository) ListWebAuthnCredentials(ctx context.Context, userID string) ([]types.WebAuthnCredential, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+webAuthnCredentialColumns+`
+		FROM webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credentials := []types.WebAuthnCredential{}
+	for rows.Next() {
+		credential, err := scanSQLiteWebAuthnCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, *credential)
+	}
+
+	return credentials, rows.Err()
+}
+
+// GetWebAuthnCredential implements Repository
+func (r *SQLiteRepository) GetWebAuthnCredential(ctx context.Context, credentialID string) (*types.WebAuthnCredential, error) {
+	credential, err := scanSQLiteWebAuthnCredential(r.db.QueryRowContext(ctx, `
+		SELECT `+webAuthnCredentialColumns+`
+		FROM webauthn_credentials
+		WHERE credential_id = $1
+	`, credentialID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWebAuthnCredentialNotFound
+		}
+		return nil, err
+	}
+	return credential, nil
+}
+
+// CountWebAuthnCredentials implements Repository
+func (r *SQLiteRepository) CountWebAuthnCredentials(ctx context.Context, userID string) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM webauthn_credentials WHERE user_id = $1
+	`, userID).Scan(&count)
+	return count, err
+}
+
+// CreateWebAuthnCredential implements Repository
+func (r *SQLiteRepository) CreateWebAuthnCredential(ctx context.Context, credential *types.WebAuthnCredential) error {
+	id := uuid.New().String()
+	now := time.Now()
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO webauthn_credentials (id, user_id, name, credential_id, public_key, sign_count, transports, aaguid, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9)
+	`, id, credential.UserID, credential.Name, credential.CredentialID, credential.PublicKey,
+		int64(credential.SignCount), database.StringList(credential.Transports), credential.AAGUID, now)
+	if err != nil {
+		if database.IsUniqueViolation(err) {
+			return ErrWebAuthnCredentialExists
+		}
+		return err
+	}
+
+	credential.ID = id
+	credential.CreatedAt = now
+	return nil
+}
+
+// RenameWebAuthnCredential implements Repository
+func (r *SQLiteRepository) RenameWebAuthnCredential(ctx context.Context, id, userID, name string) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE webauthn_credentials SET name = $3 WHERE id = $1 AND user_id = $2
+	`, id, userID, name)
+	if err != nil {
+		if database.IsUniqueViolation(err) {
+			return ErrWebAuthnCredentialExists
+		}
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
+	return nil
+}
+
+// DeleteWebAuthnCredential implements Repository
+func (r *SQLiteRepository) DeleteWebAuthnCredential(ctx context.Context, id, userID string) error {
+	result, err := r.db.ExecContext(ctx, `
+		DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
+	return nil
+}
+
+// TouchWebAuthnCredential implements Repository
+func (r *SQLiteRepository) TouchWebAuthnCredential(ctx context.Context, id string, signCount uint32) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE webauthn_credentials SET sign_count = $2, last_used_at = $3 WHERE id = $1
+	`, id, int64(signCount), time.Now())
+	return err
+}
+
+// CreateWebAuthnChallenge implements Repository
+func (r *SQLiteRepository) CreateWebAuthnChallenge(ctx context.Context, userID, ceremony, challenge string, expiresAt time.Time) (string, error) {
+	now := time.Now()
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM webauthn_challenges WHERE expires_at < $1`, now); err != nil {
+		return "", err
+	}
+
+	id := uuid.New().String()
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO webauthn_challenges (id, user_id, ceremony, challenge, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, id, userID, ceremony, challenge, expiresAt, now)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// ConsumeWebAuthnChallenge implements Repository
+func (r *SQLiteRepository) ConsumeWebAuthnChallenge(ctx context.Context, id, userID, ceremony string) (string, error) {
+	var challenge string
+	var valid bool
+	err := r.db.QueryRowContext(ctx, `
+		DELETE FROM webauthn_challenges
+		WHERE id = $1 AND user_id = $2 AND ceremony = $3
+		RETURNING challenge, expires_at > $4
+	`, id, userID, ceremony, time.Now()).Scan(&challenge, &valid)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrWebAuthnChallengeInvalid
+		}
+		return "", err
+	}
+	if !valid {
+		return "", ErrWebAuthnChallengeInvalid
+	}
+	return challenge, nil
+}
+
+// Account token operations
+
+// CreateAccountToken implements Repository
+func (r *SQLiteRepository) CreateAccountToken(ctx context.Context, userID, purpose, tokenHash string, expiresAt time.Time) error {
+	now := time.Now()
+	_, err := r.db.ExecContext(ctx, `
+		DELETE FROM account_tokens
+		WHERE expires_at < $3 OR (user_id = $1 AND purpose = $2 AND used_at IS NULL)
+	`, userID, purpose, now)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO account_tokens (id, user_id, purpose, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, uuid.New().String(), userID, purpose, tokenHash, expiresAt, now)
+	return err
+}
+
+// ConsumeAccountToken implements Repository
+func (r *SQLiteRepository) ConsumeAccountToken(ctx context.Context, tokenHash, purpose string) (string, error) {
+	var userID string
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE account_tokens
+		SET used_at = $3
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > $3
+		RETURNING user_id
+	`, tokenHash, purpose, time.Now()).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrAccountTokenInvalid
+		}
+		return "", err
+	}
+	return userID, nil
+}
+
+// MarkEmailVerified implements Repository
+func (r *SQLiteRepository) MarkEmailVerified(ctx context.Context, userID string) error {
+	return r.updateUser(ctx, `
+		UPDATE users
+		SET email_verified = 1, email_verified_at = COALESCE(email_verified_at, $2), updated_at = $2
+		WHERE id = $1
+	`, userID, time.Now())
+}
+
+func querySQLiteSigningKeys(ctx context.Context, q interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}, now time.Time) ([]*signingKeyRecord, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, algorithm, public_key, private_key, not_before, not_after, expires_at, created_at
+		FROM signing_keys
+		WHERE expires_at > $1
+		ORDER BY not_before, created_at
+	`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*signingKeyRecord
+	for rows.Next() {
+		var key signingKeyRecord
+		if err := rows.Scan(&key.ID, &key.Algorithm, &key.PublicKey, &key.PrivateKey,
+			&key.NotBefore, &key.NotAfter, &key.ExpiresAt, &key.CreatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+	return keys, rows.Err()
+}
+
+// ListSigningKeys implements Repository
+func (r *SQLiteRepository) ListSigningKeys(ctx context.Context) ([]*signingKeyRecord, error) {
+	return querySQLiteSigningKeys(ctx, r.db, time.Now())
+}
+
+// UpdateSigningKeys implements Repository. The transaction holds the database
+// write lock, which serializes rotations.
+func (r *SQLiteRepository) UpdateSigningKeys(ctx context.Context, plan func(keys []*signingKeyRecord, now time.Time) ([]*signingKeyRecord, error)) ([]*signingKeyRecord, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	keys, err := querySQLiteSigningKeys(ctx, tx, now)
+	if err != nil {
+		return nil, err
+	}
+	created, err := plan(keys, now)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE signing_keys SET not_before = $2, not_after = $3, expires_at = $4 WHERE id = $1
+		`, key.ID, key.NotBefore, key.NotAfter, key.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range created {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO signing_keys (id, algorithm, public_key, private_key, not_before, not_after, expires_at, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, key.ID, key.Algorithm, key.PublicKey, key.PrivateKey, key.NotBefore, key.NotAfter, key.ExpiresAt, key.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM signing_keys WHERE expires_at <= $1`, now); err != nil {
+		return nil, err
+	}
+
+	keys, err = querySQLiteSigningKeys(ctx, tx, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
@@ -0,0 +1,728 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+const (
+	WebAuthnChallengeDuration = 5 * time.Minute
+
+	// Second factors reported in LoginResponse.MFAMethods
+	MFAMethodTOTP     = "totp"
+	MFAMethodWebAuthn = "webauthn"
+
+	webAuthnCeremonyRegistration = "registration"
+	webAuthnCeremonyLogin        = "login"
+)
+
+var (
+	ErrWebAuthnNotConfigured = errors.New("WebAuthn is not configured")
+	ErrWebAuthnVerification  = errors.New("WebAuthn verification failed")
+	ErrWebAuthnRequired      = errors.New("your role requires a security key as second factor")
+	ErrInvalidCredentialName = errors.New("credential name must be 1-100 characters")
+)
+
+// COSE algorithm identifiers
+const (
+	coseAlgES256 = -7
+	coseAlgEdDSA = -8
+	coseAlgRS256 = -257
+)
+
+// Authenticator data flags
+const (
+	authDataUserPresent  = 0x01
+	authDataAttestedData = 0x40
+)
+
+// WebAuthn verifies registration and assertion ceremonies for the dashboard's
+// relying party ID. Attestation is not requested, so registered authenticators
+// are trusted by their owner rather than by make and model.
+type WebAuthn struct {
+	config   config.WebAuthnConfig
+	rpIDHash [32]byte
+}
+
+// NewWebAuthn creates a verifier. Without configured origins, https://<RPID> is allowed.
+func NewWebAuthn(cfg config.WebAuthnConfig) *WebAuthn {
+	if len(cfg.Origins) == 0 {
+		cfg.Origins = []string{"https://" + cfg.RPID}
+	}
+	return &WebAuthn{
+		config:   cfg,
+		rpIDHash: sha256.Sum256([]byte(cfg.RPID)),
+	}
+}
+
+type collectedClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type authenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    []byte // COSE_Key, present after registration only
+}
+
+// verifyRegistration checks an attestation response and returns the new credential
+func (wa *WebAuthn) verifyRegistration(resp types.WebAuthnCredentialResponse, challenge string) (*types.WebAuthnCredential, error) {
+	if resp.Type != "public-key" {
+		return nil, fmt.Errorf("%w: unexpected credential type %q", ErrWebAuthnVerification, resp.Type)
+	}
+	if _, err := wa.verifyClientData(resp.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	attestationObject, err := decodeBase64URL(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid attestationObject", ErrWebAuthnVerification)
+	}
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid attestationObject: %v", ErrWebAuthnVerification, err)
+	}
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid attestationObject", ErrWebAuthnVerification)
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: attestationObject has no authData", ErrWebAuthnVerification)
+	}
+
+	authData, err := wa.verifyAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.CredentialID == nil {
+		return nil, fmt.Errorf("%w: no attested credential data", ErrWebAuthnVerification)
+	}
+	if rawID, err := decodeBase64URL(resp.RawID); err != nil || !bytes.Equal(rawID, authData.CredentialID) {
+		return nil, fmt.Errorf("%w: credential ID does not match", ErrWebAuthnVerification)
+	}
+	if _, _, err := parseCOSEKey(authData.PublicKey); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnVerification, err)
+	}
+
+	credential := &types.WebAuthnCredential{
+		CredentialID: base64.RawURLEncoding.EncodeToString(authData.CredentialID),
+		PublicKey:    authData.PublicKey,
+		SignCount:    authData.SignCount,
+		Transports:   resp.Response.Transports,
+	}
+	if credential.Transports == nil {
+		credential.Transports = []string{}
+	}
+	if a := hex.EncodeToString(authData.AAGUID); a != strings.Repeat("0", 32) {
+		credential.AAGUID = a[0:8] + "-" + a[8:12] + "-" + a[12:16] + "-" + a[16:20] + "-" + a[20:32]
+	}
+	return credential, nil
+}
+
+// verifyAssertion checks an assertion response against a stored credential and
+// returns the authenticator's new signature counter
+func (wa *WebAuthn) verifyAssertion(resp types.WebAuthnCredentialResponse, challenge string, credential *types.WebAuthnCredential) (uint32, error) {
+	clientDataJSON, err := wa.verifyClientData(resp.Response.ClientDataJSON, "webauthn.get", challenge)
+	if err != nil {
+		return 0, err
+	}
+
+	rawAuthData, err := decodeBase64URL(resp.Response.AuthenticatorData)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid authenticatorData", ErrWebAuthnVerification)
+	}
+	authData, err := wa.verifyAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+
+	signature, err := decodeBase64URL(resp.Response.Signature)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid signature", ErrWebAuthnVerification)
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, rawAuthData...), clientDataHash[:]...)
+	if err := verifyCOSESignature(credential.PublicKey, signed, signature); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrWebAuthnVerification, err)
+	}
+
+	// A counter that does not increase means the authenticator may have been cloned.
+	// Authenticators without a counter always report zero.
+	if (authData.SignCount != 0 || credential.SignCount != 0) && authData.SignCount <= credential.SignCount {
+		return 0, fmt.Errorf("%w: signature counter did not increase", ErrWebAuthnVerification)
+	}
+	return authData.SignCount, nil
+}
+
+func (wa *WebAuthn) verifyClientData(encoded, ceremonyType, challenge string) ([]byte, error) {
+	raw, err := decodeBase64URL(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid clientDataJSON", ErrWebAuthnVerification)
+	}
+
+	var clientData collectedClientData
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return nil, fmt.Errorf("%w: invalid clientDataJSON", ErrWebAuthnVerification)
+	}
+	if clientData.Type != ceremonyType {
+		return nil, fmt.Errorf("%w: unexpected client data type %q", ErrWebAuthnVerification, clientData.Type)
+	}
+	if strings.TrimRight(clientData.Challenge, "=") != challenge {
+		return nil, fmt.Errorf("%w: challenge does not match", ErrWebAuthnVerification)
+	}
+	if !containsString(wa.config.Origins, clientData.Origin) {
+		return nil, fmt.Errorf("%w: origin %q is not allowed", ErrWebAuthnVerification, clientData.Origin)
+	}
+	return raw, nil
+}
+
+func (wa *WebAuthn) verifyAuthenticatorData(data []byte) (*authenticatorData, error) {
+	authData, err := parseAuthenticatorData(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnVerification, err)
+	}
+	if !bytes.Equal(authData.RPIDHash, wa.rpIDHash[:]) {
+		return nil, fmt.Errorf("%w: credential belongs to another relying party", ErrWebAuthnVerification)
+	}
+	if authData.Flags&authDataUserPresent == 0 {
+		return nil, fmt.Errorf("%w: user presence was not confirmed", ErrWebAuthnVerification)
+	}
+	return authData, nil
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, errors.New("authenticator data is too short")
+	}
+
+	authData := &authenticatorData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if authData.Flags&authDataAttestedData == 0 {
+		return authData, nil
+	}
+
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, errors.New("attested credential data is too short")
+	}
+	authData.AAGUID = rest[:16]
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLength {
+		return nil, errors.New("credential ID is truncated")
+	}
+	authData.CredentialID = rest[:idLength]
+	rest = rest[idLength:]
+
+	// The public key is followed by extensions, if any, so only its own bytes are kept
+	_, n, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credential public key: %v", err)
+	}
+	authData.PublicKey = rest[:n]
+	return authData, nil
+}
+
+// parseCOSEKey parses an ES256, EdDSA or RS256 COSE_Key
+func parseCOSEKey(data []byte) (int64, crypto.PublicKey, error) {
+	decoded, _, err := decodeCBOR(data)
+	if err != nil {
+		return 0, nil, err
+	}
+	key, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return 0, nil, errors.New("public key is not a COSE key")
+	}
+
+	alg, _ := key[int64(3)].(int64)
+	param := func(label int64) []byte {
+		b, _ := key[label].([]byte)
+		return b
+	}
+
+	switch alg {
+	case coseAlgES256:
+		x, y := param(-2), param(-3)
+		if crv, _ := key[int64(-1)].(int64); crv != 1 || len(x) != 32 || len(y) != 32 {
+			return 0, nil, errors.New("ES256 key must use P-256")
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return 0, nil, errors.New("ES256 key is not on the curve")
+		}
+		return alg, pub, nil
+	case coseAlgEdDSA:
+		x := param(-2)
+		if crv, _ := key[int64(-1)].(int64); crv != 6 || len(x) != ed25519.PublicKeySize {
+			return 0, nil, errors.New("EdDSA key must use Ed25519")
+		}
+		return alg, ed25519.PublicKey(x), nil
+	case coseAlgRS256:
+		n, e := param(-1), param(-2)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return 0, nil, errors.New("RS256 key must have at least 2048 bits")
+		}
+		return alg, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	default:
+		return 0, nil, fmt.Errorf("unsupported COSE algorithm %d", alg)
+	}
+}
+
+func verifyCOSESignature(coseKey, data, signature []byte) error {
+	alg, pub, err := parseCOSEKey(coseKey)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256(data)
+	switch alg {
+	case coseAlgES256:
+		if !ecdsa.VerifyASN1(pub.(*ecdsa.PublicKey), digest[:], signature) {
+			return errors.New("invalid signature")
+		}
+	case coseAlgEdDSA:
+		if !ed25519.Verify(pub.(ed25519.PublicKey), data, signature) {
+			return errors.New("invalid signature")
+		}
+	case coseAlgRS256:
+		if err := rsa.VerifyPKCS1v15(pub.(*rsa.PublicKey), crypto.SHA256, digest[:], signature); err != nil {
+			return errors.New("invalid signature")
+		}
+	}
+	return nil
+}
+
+func decodeBase64URL(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
+
+// decodeCBOR decodes the subset of CBOR used by WebAuthn: definite-length integers,
+// byte and text strings, arrays and maps. It returns the value and the number of
+// bytes it occupied.
+func decodeCBOR(data []byte) (interface{}, int, error) {
+	d := &cborDecoder{data: data}
+	v, err := d.value(0)
+	return v, d.pos, err
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *cborDecoder) value(depth int) (interface{}, error) {
+	if depth > 16 {
+		return nil, errors.New("cbor: nested too deeply")
+	}
+
+	major, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > 1<<63-1 {
+			return nil, errors.New("cbor: integer overflow")
+		}
+		return int64(arg), nil
+	case 1:
+		if arg > 1<<63-1 {
+			return nil, errors.New("cbor: integer overflow")
+		}
+		return -1 - int64(arg), nil
+	case 2, 3:
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, errors.New("cbor: string is truncated")
+		}
+		b := d.data[d.pos : d.pos+int(arg)]
+		d.pos += int(arg)
+		if major == 3 {
+			return string(b), nil
+		}
+		return b, nil
+	case 4:
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, errors.New("cbor: array is truncated")
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case 5:
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, errors.New("cbor: map is truncated")
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, errors.New("cbor: unsupported map key")
+			}
+			val, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = val
+		}
+		return m, nil
+	case 6:
+		// Tags carry no meaning for WebAuthn; use the tagged value
+		return d.value(depth + 1)
+	default:
+		switch arg {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		}
+		return nil, errors.New("cbor: unsupported simple value")
+	}
+}
+
+// head reads an item's major type and argument
+func (d *cborDecoder) head() (byte, uint64, error) {
+	if d.pos >= len(d.data) {
+		return 0, 0, errors.New("cbor: unexpected end of data")
+	}
+	initial := d.data[d.pos]
+	d.pos++
+	major, info := initial>>5, initial&0x1f
+
+	var size int
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, 0, errors.New("cbor: indefinite lengths are not supported")
+	}
+	if d.pos+size > len(d.data) {
+		return 0, 0, errors.New("cbor: unexpected end of data")
+	}
+
+	var arg uint64
+	for _, b := range d.data[d.pos : d.pos+size] {
+		arg = arg<<8 | uint64(b)
+	}
+	d.pos += size
+
+	// Floats are not used by WebAuthn
+	if major == 7 && size > 1 {
+		return 0, 0, errors.New("cbor: floats are not supported")
+	}
+	return major, arg, nil
+}
+
+// WebAuthn second factor
+
+// EnableWebAuthn turns on security keys as a second factor
+func (s *Service) EnableWebAuthn(webAuthn *WebAuthn) {
+	s.webAuthn = webAuthn
+}
+
+// webAuthnRequired reports whether a role must use a security key as second factor
+func (s *Service) webAuthnRequired(role string) bool {
+	return s.webAuthn != nil && containsString(s.webAuthn.config.RequiredRoles, role)
+}
+
+// WebAuthnEnrollmentRequired reports whether a user's role requires a security key
+// the user has not registered yet. Such users can only use self-service endpoints,
+// which lets them register one.
+func (s *Service) WebAuthnEnrollmentRequired(ctx context.Context, user *types.User) (bool, error) {
+	if user.IsServiceAccount || !s.webAuthnRequired(user.Role) {
+		return false, nil
+	}
+	count, err := s.repo.CountWebAuthnCredentials(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
+
+// mfaMethods returns the second factors a user can complete login with. Users
+// whose role requires WebAuthn cannot fall back to TOTP once they have a key.
+func (s *Service) mfaMethods(ctx context.Context, user *types.UserWithPassword) ([]string, error) {
+	methods := []string{}
+	if s.webAuthn != nil {
+		count, err := s.repo.CountWebAuthnCredentials(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			if s.webAuthnRequired(user.Role) {
+				return []string{MFAMethodWebAuthn}, nil
+			}
+			methods = append(methods, MFAMethodWebAuthn)
+		}
+	}
+	if user.MFAEnabled && user.MFASecret != "" {
+		methods = append(methods, MFAMethodTOTP)
+	}
+	return methods, nil
+}
+
+// BeginWebAuthnRegistration returns the options for navigator.credentials.create()
+func (s *Service) BeginWebAuthnRegistration(ctx context.Context, userID string) (*types.WebAuthnOptions, error) {
+	if s.webAuthn == nil {
+		return nil, ErrWebAuthnNotConfigured
+	}
+
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.repo.ListWebAuthnCredentials(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	challengeID, challenge, err := s.createWebAuthnChallenge(ctx, user.ID, webAuthnCeremonyRegistration)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.WebAuthnOptions{
+		ChallengeID: challengeID,
+		PublicKey: map[string]interface{}{
+			"rp": map[string]string{
+				"id":   s.webAuthn.config.RPID,
+				"name": s.webAuthn.config.RPName,
+			},
+			"user": map[string]string{
+				"id":          base64.RawURLEncoding.EncodeToString([]byte(user.ID)),
+				"name":        user.Email,
+				"displayName": user.Name,
+			},
+			"challenge": challenge,
+			"pubKeyCredParams": []map[string]interface{}{
+				{"type": "public-key", "alg": coseAlgES256},
+				{"type": "public-key", "alg": coseAlgEdDSA},
+				{"type": "public-key", "alg": coseAlgRS256},
+			},
+			"timeout":            WebAuthnChallengeDuration.Milliseconds(),
+			"attestation":        "none",
+			"excludeCredentials": credentialDescriptors(existing),
+			"authenticatorSelection": map[string]string{
+				"residentKey":      "discouraged",
+				"userVerification": "preferred",
+			},
+		},
+	}, nil
+}
+
+// FinishWebAuthnRegistration verifies the browser's attestation and stores the credential
+func (s *Service) FinishWebAuthnRegistration(ctx context.Context, userID string, req types.WebAuthnRegisterRequest, ip, userAgent string) (*types.WebAuthnCredential, error) {
+	if s.webAuthn == nil {
+		return nil, ErrWebAuthnNotConfigured
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return nil, ErrInvalidCredentialName
+	}
+
+	challenge, err := s.repo.ConsumeWebAuthnChallenge(ctx, req.ChallengeID, userID, webAuthnCeremonyRegistration)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := s.webAuthn.verifyRegistration(req.Credential, challenge)
+	if err != nil {
+		return nil, err
+	}
+	credential.UserID = userID
+	credential.Name = name
+
+	if err := s.repo.CreateWebAuthnCredential(ctx, credential); err != nil {
+		return nil, err
+	}
+
+	s.repo.LogAuditEvent(ctx, userID, "webauthn_register", ip, userAgent, map[string]interface{}{
+		"credential_id":   credential.ID,
+		"credential_name": credential.Name,
+		"aaguid":          credential.AAGUID,
+	})
+	return credential, nil
+}
+
+// ListWebAuthnCredentials lists a user's security keys
+func (s *Service) ListWebAuthnCredentials(ctx context.Context, userID string) ([]types.WebAuthnCredential, error) {
+	return s.repo.ListWebAuthnCredentials(ctx, userID)
+}
+
+// RenameWebAuthnCredential renames one of a user's security keys
+func (s *Service) RenameWebAuthnCredential(ctx context.Context, userID, id, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return ErrInvalidCredentialName
+	}
+	return s.repo.RenameWebAuthnCredential(ctx, id, userID, name)
+}
+
+// DeleteWebAuthnCredential removes one of a user's security keys. The last key
+// cannot be removed while the user's role requires one.
+func (s *Service) DeleteWebAuthnCredential(ctx context.Context, userID, id, ip, userAgent string) error {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if s.webAuthnRequired(user.Role) {
+		count, err := s.repo.CountWebAuthnCredentials(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if count <= 1 {
+			return fmt.Errorf("%w: register another key before removing this one", ErrWebAuthnRequired)
+		}
+	}
+
+	if err := s.repo.DeleteWebAuthnCredential(ctx, id, userID); err != nil {
+		return err
+	}
+
+	s.repo.LogAuditEvent(ctx, userID, "webauthn_remove", ip, userAgent, map[string]interface{}{
+		"credential_id": id,
+	})
+	return nil
+}
+
+// BeginWebAuthnLogin returns the options for navigator.credentials.get() to
+// complete a login that is waiting for its second factor
+func (s *Service) BeginWebAuthnLogin(ctx context.Context, mfaToken string) (*types.WebAuthnOptions, error) {
+	if s.webAuthn == nil {
+		return nil, ErrWebAuthnNotConfigured
+	}
+
+	claims, err := s.validateToken(mfaToken, "mfa")
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := s.repo.ListWebAuthnCredentials(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if len(credentials) == 0 {
+		return nil, ErrMFANotEnabled
+	}
+
+	challengeID, challenge, err := s.createWebAuthnChallenge(ctx, claims.UserID, webAuthnCeremonyLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.WebAuthnOptions{
+		ChallengeID: challengeID,
+		PublicKey: map[string]interface{}{
+			"challenge":        challenge,
+			"rpId":             s.webAuthn.config.RPID,
+			"timeout":          WebAuthnChallengeDuration.Milliseconds(),
+			"allowCredentials": credentialDescriptors(credentials),
+			"userVerification": "preferred",
+		},
+	}, nil
+}
+
+// verifyWebAuthnLogin verifies an assertion made with one of the user's keys
+func (s *Service) verifyWebAuthnLogin(ctx context.Context, userID string, assertion *types.WebAuthnAssertion) (*types.WebAuthnCredential, error) {
+	challenge, err := s.repo.ConsumeWebAuthnChallenge(ctx, assertion.ChallengeID, userID, webAuthnCeremonyLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	credentialID := strings.TrimRight(assertion.Credential.RawID, "=")
+	if credentialID == "" {
+		credentialID = strings.TrimRight(assertion.Credential.ID, "=")
+	}
+	credential, err := s.repo.GetWebAuthnCredential(ctx, credentialID)
+	if err != nil {
+		return nil, err
+	}
+	if credential.UserID != userID {
+		return nil, ErrWebAuthnCredentialNotFound
+	}
+
+	signCount, err := s.webAuthn.verifyAssertion(assertion.Credential, challenge, credential)
+	if err != nil {
+		return credential, err
+	}
+
+	if err := s.repo.TouchWebAuthnCredential(ctx, credential.ID, signCount); err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+func (s *Service) createWebAuthnChallenge(ctx context.Context, userID, ceremony string) (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(b)
+
+	id, err := s.repo.CreateWebAuthnChallenge(ctx, userID, ceremony, challenge, time.Now().Add(WebAuthnChallengeDuration))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to store WebAuthn challenge: %w", err)
+	}
+	return id, challenge, nil
+}
+
+func credentialDescriptors(credentials []types.WebAuthnCredential) []map[string]interface{} {
+	descriptors := make([]map[string]interface{}, len(credentials))
+	for i, credential := range credentials {
+		descriptors[i] = map[string]interface{}{
+			"type":       "public-key",
+			"id":         credential.CredentialID,
+			"transports": credential.Transports,
+		}
+	}
+	return descriptors
+}
@@ -0,0 +1,380 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database/dbtest"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+const testRPID = "updates.example.com"
+
+// cborHead encodes the head of a CBOR item with its major type and argument
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+	}
+}
+
+func cborInt(i int64) []byte {
+	if i < 0 {
+		return cborHead(1, uint64(-1-i))
+	}
+	return cborHead(0, uint64(i))
+}
+
+func cborBytes(b []byte) []byte { return append(cborHead(2, uint64(len(b))), b...) }
+func cborText(s string) []byte  { return append(cborHead(3, uint64(len(s))), s...) }
+
+// cborMap encodes alternating keys and values
+func cborMap(items ...[]byte) []byte {
+	out := cborHead(5, uint64(len(items)/2))
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+// softKey is a software authenticator holding one ES256 credential. Its
+// fields can be changed to make it misbehave like a phishing site or a
+// cloned key would.
+type softKey struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	rpID         string
+	origin       string
+	signCount    uint32
+}
+
+func newSoftKey(t *testing.T) *softKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &softKey{key: key, credentialID: id, rpID: testRPID, origin: "https://" + testRPID}
+}
+
+func (k *softKey) coseKey() []byte {
+	return cborMap(
+		cborInt(1), cborInt(2), // kty: EC2
+		cborInt(3), cborInt(coseAlgES256),
+		cborInt(-1), cborInt(1), // crv: P-256
+		cborInt(-2), cborBytes(k.key.X.FillBytes(make([]byte, 32))),
+		cborInt(-3), cborBytes(k.key.Y.FillBytes(make([]byte, 32))),
+	)
+}
+
+func (k *softKey) clientData(ceremonyType, challenge string) []byte {
+	data, _ := json.Marshal(collectedClientData{Type: ceremonyType, Challenge: challenge, Origin: k.origin})
+	return data
+}
+
+func (k *softKey) authData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(k.rpID))
+	return binary.BigEndian.AppendUint32(append(rpIDHash[:], flags), k.signCount)
+}
+
+// attestationObject returns the attestation of a new credential without an attestation statement
+func (k *softKey) attestationObject() []byte {
+	authData := k.authData(authDataUserPresent | authDataAttestedData)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(k.credentialID)))
+	authData = append(append(authData, k.credentialID...), k.coseKey()...)
+	return cborMap(
+		cborText("fmt"), cborText("none"),
+		cborText("attStmt"), cborMap(),
+		cborText("authData"), cborBytes(authData),
+	)
+}
+
+// register answers navigator.credentials.create()
+func (k *softKey) register(challenge string) types.WebAuthnCredentialResponse {
+	k.signCount++
+	id := base64.RawURLEncoding.EncodeToString(k.credentialID)
+	return types.WebAuthnCredentialResponse{
+		ID:    id,
+		RawID: id,
+		Type:  "public-key",
+		Response: types.WebAuthnAuthenticatorResponse{
+			ClientDataJSON:    base64.RawURLEncoding.EncodeToString(k.clientData("webauthn.create", challenge)),
+			AttestationObject: base64.RawURLEncoding.EncodeToString(k.attestationObject()),
+			Transports:        []string{"usb"},
+		},
+	}
+}
+
+// assert answers navigator.credentials.get()
+func (k *softKey) assert(t *testing.T, challenge string) types.WebAuthnCredentialResponse {
+	t.Helper()
+	k.signCount++
+	clientData := k.clientData("webauthn.get", challenge)
+	authData := k.authData(authDataUserPresent)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, k.key, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	id := base64.RawURLEncoding.EncodeToString(k.credentialID)
+	return types.WebAuthnCredentialResponse{
+		ID:    id,
+		RawID: id,
+		Type:  "public-key",
+		Response: types.WebAuthnAuthenticatorResponse{
+			ClientDataJSON:    base64.RawURLEncoding.EncodeToString(clientData),
+			AuthenticatorData: base64.RawURLEncoding.EncodeToString(authData),
+			Signature:         base64.RawURLEncoding.EncodeToString(signature),
+		},
+	}
+}
+
+func TestWebAuthnLogin(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		ctx := context.Background()
+		svc := newTestService(t, db)
+		svc.EnableWebAuthn(NewWebAuthn(config.WebAuthnConfig{RPID: testRPID, RequiredRoles: []string{RoleAdmin}}))
+
+		hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+		if err != nil {
+			t.Fatalf("hash password: %v", err)
+		}
+		user, err := svc.repo.CreateUser(ctx, "admin@example.com", string(hash), "Admin", RoleAdmin)
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+
+		key := newSoftKey(t)
+		options, err := svc.BeginWebAuthnRegistration(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("BeginWebAuthnRegistration: %v", err)
+		}
+		register := types.WebAuthnRegisterRequest{
+			ChallengeID: options.ChallengeID,
+			Name:        "desk key",
+			Credential:  key.register(options.PublicKey["challenge"].(string)),
+		}
+		credential, err := svc.FinishWebAuthnRegistration(ctx, user.ID, register, "192.0.2.1", "test")
+		if err != nil {
+			t.Fatalf("FinishWebAuthnRegistration: %v", err)
+		}
+		if credential.CredentialID != register.Credential.RawID || credential.SignCount != 1 || !bytes.Equal(credential.PublicKey, key.coseKey()) {
+			t.Errorf("registered %+v, want the key's credential at count 1", credential)
+		}
+		// A registration response only counts once
+		if _, err := svc.FinishWebAuthnRegistration(ctx, user.ID, register, "192.0.2.1", "test"); !errors.Is(err, ErrWebAuthnChallengeInvalid) {
+			t.Errorf("FinishWebAuthnRegistration(replayed) = %v, want ErrWebAuthnChallengeInvalid", err)
+		}
+
+		// login signs in with the password and answers the WebAuthn challenge with assertion
+		login := func(assertion func(challenge string) types.WebAuthnCredentialResponse) (*types.LoginResponse, *types.WebAuthnAssertion, error) {
+			t.Helper()
+			resp, err := svc.Login(ctx, "admin@example.com", "correct horse", "192.0.2.1", "test")
+			if err != nil || !resp.RequiresMFA {
+				t.Fatalf("Login = %+v, %v; want a second factor challenge", resp, err)
+			}
+			options, err := svc.BeginWebAuthnLogin(ctx, resp.MFAToken)
+			if err != nil {
+				t.Fatalf("BeginWebAuthnLogin: %v", err)
+			}
+			answer := &types.WebAuthnAssertion{ChallengeID: options.ChallengeID, Credential: assertion(options.PublicKey["challenge"].(string))}
+			resp, err = svc.VerifyMFA(ctx, types.MFAVerifyRequest{MFAToken: resp.MFAToken, WebAuthn: answer}, "192.0.2.1", "test")
+			return resp, answer, err
+		}
+		sign := func(challenge string) types.WebAuthnCredentialResponse { return key.assert(t, challenge) }
+
+		resp, answer, err := login(sign)
+		if err != nil || resp.AccessToken == "" {
+			t.Fatalf("VerifyMFA = %+v, %v; want a session", resp, err)
+		}
+
+		// An assertion only counts once, even with a fresh MFA token
+		mfa, _ := svc.Login(ctx, "admin@example.com", "correct horse", "192.0.2.1", "test")
+		replay := types.MFAVerifyRequest{MFAToken: mfa.MFAToken, WebAuthn: answer}
+		if _, err := svc.VerifyMFA(ctx, replay, "192.0.2.1", "test"); !errors.Is(err, ErrWebAuthnChallengeInvalid) {
+			t.Errorf("VerifyMFA(replayed assertion) = %v, want ErrWebAuthnChallengeInvalid", err)
+		}
+
+		// A counter that goes back means the key was cloned
+		cloned := func(challenge string) types.WebAuthnCredentialResponse {
+			key.signCount = 1
+			return key.assert(t, challenge)
+		}
+		if _, _, err := login(cloned); !errors.Is(err, ErrWebAuthnVerification) {
+			t.Errorf("VerifyMFA(counter regressed) = %v, want ErrWebAuthnVerification", err)
+		}
+		key.signCount = 10
+		if _, _, err := login(sign); err != nil {
+			t.Errorf("VerifyMFA(counter advanced) = %v", err)
+		}
+
+		// Admins cannot fall back to a TOTP code once they have a key
+		mfa, _ = svc.Login(ctx, "admin@example.com", "correct horse", "192.0.2.1", "test")
+		if _, err := svc.VerifyMFA(ctx, types.MFAVerifyRequest{MFAToken: mfa.MFAToken, TOTPCode: "123456"}, "192.0.2.1", "test"); !errors.Is(err, ErrWebAuthnRequired) {
+			t.Errorf("VerifyMFA(TOTP) = %v, want ErrWebAuthnRequired", err)
+		}
+	})
+}
+
+func TestWebAuthnVerification(t *testing.T) {
+	wa := NewWebAuthn(config.WebAuthnConfig{RPID: testRPID})
+	const challenge = "c2VydmVyIGNoYWxsZW5nZQ"
+
+	key := newSoftKey(t)
+	credential, err := wa.verifyRegistration(key.register(challenge), challenge)
+	if err != nil {
+		t.Fatalf("verifyRegistration: %v", err)
+	}
+	if count, err := wa.verifyAssertion(key.assert(t, challenge), challenge, credential); err != nil || count != 2 {
+		t.Fatalf("verifyAssertion = %d, %v; want count 2", count, err)
+	}
+	credential.SignCount = 2
+
+	tests := []struct {
+		name   string
+		change func(k *softKey, resp *types.WebAuthnCredentialResponse)
+	}{
+		{"other relying party", func(k *softKey, _ *types.WebAuthnCredentialResponse) { k.rpID = "updates.example.com.evil.test" }},
+		{"other origin", func(k *softKey, _ *types.WebAuthnCredentialResponse) { k.origin = "https://updates-example.com" }},
+		{"plain HTTP origin", func(k *softKey, _ *types.WebAuthnCredentialResponse) { k.origin = "http://" + testRPID }},
+		{"other challenge", func(_ *softKey, resp *types.WebAuthnCredentialResponse) {
+			resp.Response.ClientDataJSON = base64.RawURLEncoding.EncodeToString(key.clientData("webauthn.get", "b3RoZXI"))
+		}},
+		{"other key", func(k *softKey, _ *types.WebAuthnCredentialResponse) {
+			k.key, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		}},
+		{"forged signature", func(_ *softKey, resp *types.WebAuthnCredentialResponse) {
+			resp.Response.Signature = base64.RawURLEncoding.EncodeToString([]byte{0x30, 0x06, 0x02, 0x01, 0x01, 0x02, 0x01, 0x01})
+		}},
+		{"counter regressed", func(k *softKey, _ *types.WebAuthnCredentialResponse) { k.signCount = 0 }},
+	}
+	for _, tt := range tests {
+		k := *key
+		var resp types.WebAuthnCredentialResponse
+		tt.change(&k, &resp)
+		signed := k.assert(t, challenge)
+		if resp.Response.ClientDataJSON != "" {
+			signed.Response.ClientDataJSON = resp.Response.ClientDataJSON
+		}
+		if resp.Response.Signature != "" {
+			signed.Response.Signature = resp.Response.Signature
+		}
+		if _, err := wa.verifyAssertion(signed, challenge, credential); !errors.Is(err, ErrWebAuthnVerification) {
+			t.Errorf("verifyAssertion(%s) = %v, want ErrWebAuthnVerification", tt.name, err)
+		}
+	}
+
+	// Registrations are held to the same relying party and origin
+	for name, change := range map[string]func(k *softKey){
+		"other relying party": func(k *softKey) { k.rpID = "evil.test" },
+		"other origin":        func(k *softKey) { k.origin = "https://evil.test" },
+	} {
+		k := *newSoftKey(t)
+		change(&k)
+		if _, err := wa.verifyRegistration(k.register(challenge), challenge); !errors.Is(err, ErrWebAuthnVerification) {
+			t.Errorf("verifyRegistration(%s) = %v, want ErrWebAuthnVerification", name, err)
+		}
+	}
+	// An assertion is not a registration, and the other way round
+	k := newSoftKey(t)
+	registration := k.register(challenge)
+	assertion := k.assert(t, challenge)
+	registration.Response.ClientDataJSON = assertion.Response.ClientDataJSON
+	if _, err := wa.verifyRegistration(registration, challenge); !errors.Is(err, ErrWebAuthnVerification) {
+		t.Errorf("verifyRegistration(webauthn.get) = %v, want ErrWebAuthnVerification", err)
+	}
+}
+
+func TestWebAuthnMalformedInput(t *testing.T) {
+	wa := NewWebAuthn(config.WebAuthnConfig{RPID: testRPID})
+	const challenge = "c2VydmVyIGNoYWxsZW5nZQ"
+	key := newSoftKey(t)
+	valid := key.register(challenge)
+	attestation := key.attestationObject()
+
+	// Every truncation of a valid attestation is refused without panicking
+	for n := 0; n < len(attestation); n++ {
+		resp := valid
+		resp.Response.AttestationObject = base64.RawURLEncoding.EncodeToString(attestation[:n])
+		if _, err := wa.verifyRegistration(resp, challenge); !errors.Is(err, ErrWebAuthnVerification) {
+			t.Fatalf("verifyRegistration(first %d of %d bytes) = %v, want ErrWebAuthnVerification", n, len(attestation), err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated length", []byte{0x59, 0x01}},
+		{"byte string longer than its input", append(cborHead(2, 1<<20), 0x00)},
+		{"byte string longer than memory", cborHead(2, 1<<63)},
+		{"text string longer than its input", append(cborHead(3, 100), "short"...)},
+		{"array longer than its input", append(cborHead(4, 1<<32), 0x00)},
+		{"map longer than its input", append(cborHead(5, 1<<40), 0x01, 0x02)},
+		{"integer overflow", cborHead(0, 1<<63)},
+		{"negative integer overflow", cborHead(1, 1<<63)},
+		{"indefinite length", []byte{0x5f, 0x41, 0x00, 0xff}},
+		{"float", []byte{0xfb, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"array map key", cborMap(cborHead(4, 0), cborInt(1))},
+		{"nested too deeply", append(bytes.Repeat([]byte{0x81}, 1000), 0x00)},
+	}
+	for _, tt := range tests {
+		if _, _, err := decodeCBOR(tt.data); err == nil {
+			t.Errorf("decodeCBOR(%s) succeeded", tt.name)
+		}
+	}
+
+	// The credential ID length must fit the authenticator data
+	authData := key.authData(authDataUserPresent | authDataAttestedData)
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, 0xffff)
+	authData = append(authData, key.credentialID...)
+	if _, err := parseAuthenticatorData(authData); err == nil {
+		t.Error("parseAuthenticatorData(oversized credential ID) succeeded")
+	}
+
+	// Keys are checked before they are stored
+	for name, coseKey := range map[string][]byte{
+		"unsupported algorithm": cborMap(cborInt(1), cborInt(2), cborInt(3), cborInt(-35)),
+		"other curve": cborMap(cborInt(1), cborInt(2), cborInt(3), cborInt(coseAlgES256), cborInt(-1), cborInt(2),
+			cborInt(-2), cborBytes(make([]byte, 32)), cborInt(-3), cborBytes(make([]byte, 32))),
+		"point off the curve": cborMap(cborInt(1), cborInt(2), cborInt(3), cborInt(coseAlgES256), cborInt(-1), cborInt(1),
+			cborInt(-2), cborBytes(bytes.Repeat([]byte{1}, 32)), cborInt(-3), cborBytes(bytes.Repeat([]byte{2}, 32))),
+		"short Ed25519 key": cborMap(cborInt(1), cborInt(1), cborInt(3), cborInt(coseAlgEdDSA), cborInt(-1), cborInt(6),
+			cborInt(-2), cborBytes(make([]byte, 16))),
+		"short RSA key": cborMap(cborInt(1), cborInt(3), cborInt(3), cborInt(coseAlgRS256),
+			cborInt(-1), cborBytes(make([]byte, 128)), cborInt(-2), cborBytes([]byte{1, 0, 1})),
+		"not a map": cborBytes([]byte("key")),
+	} {
+		if _, _, err := parseCOSEKey(coseKey); err == nil {
+			t.Errorf("parseCOSEKey(%s) succeeded", name)
+		}
+	}
+}
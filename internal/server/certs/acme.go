@@ -0,0 +1,96 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+)
+
+// acmeClient talks to the directory in cfg, trusting cfg.CARootFile in
+// addition to the system roots when it is set
+func acmeClient(cfg config.ACMEConfig) (*acme.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.CARootFile != "" {
+		pem, err := os.ReadFile(cfg.CARootFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ACME CA root: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ACME CA root %s", cfg.CARootFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	}
+
+	return &acme.Client{
+		DirectoryURL: cfg.DirectoryURL,
+		HTTPClient: &http.Client{
+			Transport: &orderLocations{next: transport, orders: make(map[string]string)},
+			Timeout:   time.Minute,
+		},
+	}, nil
+}
+
+// orderLocations adds the order URL to finalize responses that lack it.
+// The acme package polls the Location of a finalize response while the
+// certificate is issued, but RFC 8555 does not require one and some CAs,
+// including the Pebble test server, leave it out. The URL is remembered
+// from the response that created the order.
+type orderLocations struct {
+	next http.RoundTripper
+
+	mu     sync.Mutex
+	orders map[string]string // finalize URL to order URL
+}
+
+func (t *orderLocations) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || req.Method != http.MethodPost || resp.StatusCode >= 300 {
+		return resp, err
+	}
+
+	location := resp.Header.Get("Location")
+	if location != "" && resp.StatusCode == http.StatusCreated {
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+
+		var order struct {
+			Finalize string `json:"finalize"`
+		}
+		if json.Unmarshal(body, &order) == nil && order.Finalize != "" {
+			t.mu.Lock()
+			t.orders[order.Finalize] = location
+			t.mu.Unlock()
+		}
+		return resp, nil
+	}
+
+	if location == "" {
+		t.mu.Lock()
+		order, ok := t.orders[req.URL.String()]
+		delete(t.orders, req.URL.String())
+		t.mu.Unlock()
+		if ok {
+			resp.Header.Set("Location", order)
+		}
+	}
+	return resp, nil
+}
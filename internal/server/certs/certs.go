@@ -0,0 +1,188 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+)
+
+// Manager supplies the certificate the server presents, either from files
+// that are reloaded when they change or from an ACME certificate authority
+type Manager struct {
+	file *fileCertificate
+	acme *autocert.Manager
+}
+
+// New creates a Manager for cfg, loading the certificate files or preparing
+// the ACME client. TLS must be enabled in cfg.
+func New(cfg config.ServerConfig) (*Manager, error) {
+	if cfg.ACME.Enabled() {
+		client, err := acmeClient(cfg.ACME)
+		if err != nil {
+			return nil, err
+		}
+		return &Manager{acme: &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(cfg.ACME.CacheDir),
+			HostPolicy: autocert.HostWhitelist(cfg.ACME.Domains...),
+			Email:      cfg.ACME.Email,
+			Client:     client,
+		}}, nil
+	}
+
+	file, err := loadFileCertificate(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Manager{file: file}, nil
+}
+
+// TLSConfig returns the settings for the HTTPS listener. With ACME it also
+// answers TLS-ALPN-01 challenges.
+func (m *Manager) TLSConfig() *tls.Config {
+	if m.acme != nil {
+		cfg := m.acme.TLSConfig()
+		cfg.MinVersion = tls.VersionTLS12
+		return cfg
+	}
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: m.file.get,
+	}
+}
+
+// HTTPHandler returns the handler for the plain HTTP listener, which answers
+// ACME HTTP-01 challenges and redirects everything else to the HTTPS port
+func (m *Manager) HTTPHandler(httpsPort int) http.Handler {
+	redirect := RedirectHandler(httpsPort)
+	if m.acme != nil {
+		return m.acme.HTTPHandler(redirect)
+	}
+	return redirect
+}
+
+// Run reloads certificate files that have changed every interval until ctx
+// is cancelled. A certificate that fails to load is reported and the
+// previous one kept, so a half-written renewal does not take the server down.
+// ACME certificates renew themselves and need no polling.
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	if m.file == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := m.file.reload()
+			if err != nil {
+				log.Printf("TLS certificate reload failed, still serving the previous one: %v", err)
+			} else if reloaded {
+				log.Printf("Reloaded TLS certificate from %s", m.file.certFile)
+			}
+		}
+	}
+}
+
+// RedirectHandler redirects requests to the same host and path over HTTPS
+// on httpsPort
+func RedirectHandler(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		// Only safe methods are redirected; anything else would be replayed
+		// over HTTPS with its credentials already sent in the clear
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "use HTTPS: https://"+host+r.URL.RequestURI(), http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// fileCertificate is a certificate and key loaded from files
+type fileCertificate struct {
+	certFile, keyFile string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	version string // modification times and sizes of both files when loaded
+}
+
+func loadFileCertificate(certFile, keyFile string) (*fileCertificate, error) {
+	f := &fileCertificate{certFile: certFile, keyFile: keyFile}
+	if _, err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *fileCertificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.cert, nil
+}
+
+// reload loads the files if either has changed since they were last loaded
+func (f *fileCertificate) reload() (bool, error) {
+	version, err := fileVersion(f.certFile, f.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	f.mu.RLock()
+	unchanged := version == f.version
+	f.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(f.certFile, f.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	f.mu.Lock()
+	f.cert = &cert
+	f.version = version
+	f.mu.Unlock()
+	return true, nil
+}
+
+func fileVersion(paths ...string) (string, error) {
+	version := ""
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read TLS certificate: %w", err)
+		}
+		version += fmt.Sprintf("%d:%d;", info.ModTime().UnixNano(), info.Size())
+	}
+	return version, nil
+}
@@ -0,0 +1,207 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+)
+
+// writeCertificate writes a self-signed certificate for name and its key,
+// dated modified so that every write is seen as a change
+func writeCertificate(t *testing.T, certFile, keyFile, name string, modified time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), modified)
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), modified)
+}
+
+func writeFile(t *testing.T, path string, data []byte, modified time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatalf("touch %s: %v", path, err)
+	}
+}
+
+// served returns the DNS name of the certificate m presents
+func served(t *testing.T, m *Manager) string {
+	t.Helper()
+	cert, err := m.TLSConfig().GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	return leaf.DNSNames[0]
+}
+
+func TestFileCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	cfg := config.ServerConfig{TLSCertFile: certFile, TLSKeyFile: keyFile}
+
+	if _, err := New(cfg); err == nil {
+		t.Fatal("New succeeded without certificate files")
+	}
+
+	modified := time.Now().Add(-time.Hour)
+	writeCertificate(t, certFile, keyFile, "first.example.com", modified)
+	m, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if name := served(t, m); name != "first.example.com" {
+		t.Errorf("served %s, want first.example.com", name)
+	}
+	if reloaded, err := m.file.reload(); err != nil || reloaded {
+		t.Errorf("reload(unchanged) = %v, %v; want false", reloaded, err)
+	}
+
+	modified = modified.Add(time.Minute)
+	writeCertificate(t, certFile, keyFile, "renewed.example.com", modified)
+	if reloaded, err := m.file.reload(); err != nil || !reloaded {
+		t.Fatalf("reload(renewed) = %v, %v; want true", reloaded, err)
+	}
+	if name := served(t, m); name != "renewed.example.com" {
+		t.Errorf("served %s after renewal, want renewed.example.com", name)
+	}
+
+	// A renewal caught half-written keeps the previous certificate
+	modified = modified.Add(time.Minute)
+	writeFile(t, certFile, []byte("-----BEGIN CERTIFICATE-----\n"), modified)
+	if _, err := m.file.reload(); err == nil {
+		t.Error("reload(half-written) succeeded")
+	}
+	if name := served(t, m); name != "renewed.example.com" {
+		t.Errorf("served %s after a failed reload, want renewed.example.com", name)
+	}
+	os.Remove(keyFile)
+	if _, err := m.file.reload(); err == nil {
+		t.Error("reload(missing key) succeeded")
+	}
+	if name := served(t, m); name != "renewed.example.com" {
+		t.Errorf("served %s after a failed reload, want renewed.example.com", name)
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		port       int
+		method     string
+		host       string
+		wantStatus int
+		wantURL    string
+	}{
+		{"default port", 443, http.MethodGet, "updates.example.com", http.StatusMovedPermanently, "https://updates.example.com/releases?channel=beta"},
+		{"plain port dropped", 443, http.MethodGet, "updates.example.com:80", http.StatusMovedPermanently, "https://updates.example.com/releases?channel=beta"},
+		{"custom port", 8443, http.MethodHead, "updates.example.com:8080", http.StatusMovedPermanently, "https://updates.example.com:8443/releases?channel=beta"},
+		{"IPv6", 443, http.MethodGet, "[2001:db8::1]:80", http.StatusMovedPermanently, "https://[2001:db8::1]/releases?channel=beta"},
+		{"IPv6 custom port", 8443, http.MethodGet, "[2001:db8::1]", http.StatusMovedPermanently, "https://[2001:db8::1]:8443/releases?channel=beta"},
+		// Credentials already sent in the clear are not replayed over HTTPS
+		{"unsafe method", 443, http.MethodPost, "updates.example.com", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "http://"+tt.host+"/releases?channel=beta", nil)
+		rec := httptest.NewRecorder()
+		RedirectHandler(tt.port).ServeHTTP(rec, req)
+
+		if rec.Code != tt.wantStatus || rec.Header().Get("Location") != tt.wantURL {
+			t.Errorf("%s: %d %q, want %d %q", tt.name, rec.Code, rec.Header().Get("Location"), tt.wantStatus, tt.wantURL)
+		}
+	}
+}
+
+// Environment variables pointing the ACME test at a Pebble server, such as
+// the one in deployments/docker/docker-compose.acme.yaml
+const (
+	acmeDirectoryEnv = "TEST_ACME_DIRECTORY_URL" // e.g. https://localhost:14000/dir
+	acmeCARootEnv    = "TEST_ACME_CA_ROOT_FILE"  // Pebble's pebble.minica.pem
+)
+
+// TestACME obtains a certificate from Pebble, which must run with
+// PEBBLE_VA_ALWAYS_VALID so that it accepts challenges without reaching
+// this test
+func TestACME(t *testing.T) {
+	directory := os.Getenv(acmeDirectoryEnv)
+	if directory == "" {
+		t.Skip(acmeDirectoryEnv + " is not set")
+	}
+
+	cfg := config.ServerConfig{ACME: config.ACMEConfig{
+		Domains:      []string{"updates.test"},
+		Email:        "ops@updates.test",
+		DirectoryURL: directory,
+		CacheDir:     t.TempDir(),
+		CARootFile:   os.Getenv(acmeCARootEnv),
+	}}
+	obtain := func() *x509.Certificate {
+		t.Helper()
+		m, err := New(cfg)
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		cert, err := m.TLSConfig().GetCertificate(&tls.ClientHelloInfo{ServerName: "updates.test"})
+		if err != nil {
+			t.Fatalf("GetCertificate: %v", err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatalf("parse certificate: %v", err)
+		}
+		return leaf
+	}
+
+	issued := obtain()
+	if !slices.Contains(issued.DNSNames, "updates.test") || issued.Issuer.String() == issued.Subject.String() {
+		t.Errorf("certificate for %v issued by %s, want one for updates.test from Pebble", issued.DNSNames, issued.Issuer)
+	}
+
+	// A restarted server serves the cached certificate instead of ordering another
+	if cached := obtain(); cached.SerialNumber.Cmp(issued.SerialNumber) != 0 {
+		t.Errorf("restart obtained certificate %s, want the cached %s", cached.SerialNumber, issued.SerialNumber)
+	}
+
+	m, _ := New(cfg)
+	if _, err := m.TLSConfig().GetCertificate(&tls.ClientHelloInfo{ServerName: "other.test"}); err == nil {
+		t.Error("obtained a certificate for a domain that is not configured")
+	}
+}
@@ -0,0 +1,221 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// PostgresRepository stores instance commands in PostgreSQL
+type PostgresRepository struct {
+	db *database.DB
+}
+
+// NewPostgresRepository creates a repository backed by PostgreSQL
+func NewPostgresRepository(db *database.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+// commandColumns are scanned by scanCommand
+const commandColumns = `
+	c.id, i.instance_id, c.type, COALESCE(c.product, ''), c.args, c.signature, c.expires_at,
+	c.status, COALESCE(c.output, ''), COALESCE(c.error, ''), COALESCE(c.created_by, ''),
+	c.created_at, c.delivered_at, c.completed_at
+`
+
+func scanCommand(row pgx.Row) (*types.InstanceCommand, error) {
+	var command types.InstanceCommand
+	var args []byte
+	err := row.Scan(&command.ID, &command.InstanceID, &command.Type, &command.Product, &args, &command.Signature, &command.ExpiresAt,
+		&command.Status, &command.Output, &command.Error, &command.CreatedBy,
+		&command.CreatedAt, &command.DeliveredAt, &command.CompletedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(args, &command.Args); err != nil {
+		return nil, fmt.Errorf("failed to decode command args: %w", err)
+	}
+	return &command, nil
+}
+
+// Create implements Repository
+func (r *PostgresRepository) Create(ctx context.Context, id string, command *types.InstanceCommand) error {
+	args, err := encodeArgs(command.Args)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Pool.Exec(ctx, `
+		INSERT INTO instance_commands (id, instance_id, type, product, args, signature, status, created_by, created_at, expires_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9, $10)
+	`, command.ID, id, command.Type, command.Product, args, command.Signature, command.Status,
+		command.CreatedBy, command.CreatedAt, command.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create command: %w", err)
+	}
+	return nil
+}
+
+// Get implements Repository
+func (r *PostgresRepository) Get(ctx context.Context, commandID string) (*types.InstanceCommand, error) {
+	command, err := scanCommand(r.db.Pool.QueryRow(ctx, `
+		SELECT `+commandColumns+`
+		FROM instance_commands c JOIN instances i ON i.id = c.instance_id
+		WHERE c.id::text = $1
+	`, commandID))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get command: %w", err)
+	}
+	return command, nil
+}
+
+// List implements Repository
+func (r *PostgresRepository) List(ctx context.Context, id string, limit int) ([]types.InstanceCommand, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT `+commandColumns+`
+		FROM instance_commands c JOIN instances i ON i.id = c.instance_id
+		WHERE c.instance_id = $1
+		ORDER BY c.created_at DESC
+		LIMIT $2
+	`, id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commands: %w", err)
+	}
+	defer rows.Close()
+
+	commands := []types.InstanceCommand{}
+	for rows.Next() {
+		command, err := scanCommand(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan command: %w", err)
+		}
+		commands = append(commands, *command)
+	}
+
+	return commands, rows.Err()
+}
+
+// Cancel implements Repository
+func (r *PostgresRepository) Cancel(ctx context.Context, id, commandID string) (bool, error) {
+	tag, err := r.db.Pool.Exec(ctx, `
+		UPDATE instance_commands SET status = 'cancelled', completed_at = NOW()
+		WHERE id::text = $1 AND instance_id = $2 AND status = 'pending'
+	`, commandID, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel command: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// PendingInstances implements Repository
+func (r *PostgresRepository) PendingInstances(ctx context.Context) ([]string, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT DISTINCT i.instance_id
+		FROM instance_commands c JOIN instances i ON i.id = c.instance_id
+		WHERE c.status = 'pending' AND c.expires_at > NOW()
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instances with pending commands: %w", err)
+	}
+	defer rows.Close()
+
+	var instanceIDs []string
+	for rows.Next() {
+		var instanceID string
+		if err := rows.Scan(&instanceID); err != nil {
+			return nil, fmt.Errorf("failed to scan instance ID: %w", err)
+		}
+		instanceIDs = append(instanceIDs, instanceID)
+	}
+
+	return instanceIDs, rows.Err()
+}
+
+// Claim implements Repository. Updating in one statement means a command is
+// delivered once even when replicas receive heartbeats from the same instance.
+func (r *PostgresRepository) Claim(ctx context.Context, instanceID string) ([]types.Command, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		WITH claimed AS (
+			UPDATE instance_commands SET status = 'delivered', delivered_at = NOW()
+			WHERE instance_id = (SELECT id FROM instances WHERE instance_id = $1)
+				AND status = 'pending' AND expires_at > NOW()
+			RETURNING id, type, product, args, expires_at, signature, created_at
+		)
+		SELECT id, type, COALESCE(product, ''), args, expires_at, signature
+		FROM claimed
+		ORDER BY created_at
+	`, instanceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim commands: %w", err)
+	}
+	defer rows.Close()
+
+	var commands []types.Command
+	for rows.Next() {
+		command := types.Command{InstanceID: instanceID}
+		var args []byte
+		if err := rows.Scan(&command.ID, &command.Type, &command.Product, &args, &command.ExpiresAt, &command.Signature); err != nil {
+			return nil, fmt.Errorf("failed to scan command: %w", err)
+		}
+		if err := json.Unmarshal(args, &command.Args); err != nil {
+			return nil, fmt.Errorf("failed to decode command args: %w", err)
+		}
+		commands = append(commands, command)
+	}
+
+	return commands, rows.Err()
+}
+
+// Complete implements Repository
+func (r *PostgresRepository) Complete(ctx context.Context, instanceID string, results []types.CommandResult) (int, error) {
+	commandIDs := make([]string, len(results))
+	statuses := make([]string, len(results))
+	outputs := make([]string, len(results))
+	errs := make([]string, len(results))
+	completedAt := make([]time.Time, len(results))
+	for i, result := range results {
+		commandIDs[i] = result.CommandID
+		statuses[i] = result.Status
+		outputs[i] = result.Output
+		errs[i] = result.Error
+		completedAt[i] = result.Time
+	}
+
+	tag, err := r.db.Pool.Exec(ctx, `
+		UPDATE instance_commands c
+		SET status = r.status, output = NULLIF(r.output, ''), error = NULLIF(r.error, ''), completed_at = r.completed_at
+		FROM unnest($2::text[], $3::text[], $4::text[], $5::text[], $6::timestamptz[])
+				AS r(id, status, output, error, completed_at)
+		WHERE c.id::text = r.id AND c.status IN ('delivered', 'expired')
+			AND c.instance_id = (SELECT id FROM instances WHERE instance_id = $1)
+	`, instanceID, commandIDs, statuses, outputs, errs, completedAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record command results: %w", err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// Expire implements Repository
+func (r *PostgresRepository) Expire(ctx context.Context, resultTimeout time.Duration) (int64, error) {
+	tag, err := r.db.Pool.Exec(ctx, `
+		UPDATE instance_commands
+		SET status = 'expired', completed_at = NOW(),
+			error = CASE WHEN status = 'pending' THEN $1 ELSE $2 END
+		WHERE (status = 'pending' AND expires_at <= NOW())
+			OR (status = 'delivered' AND delivered_at <= $3)
+	`, errNotDelivered, errNoResult, time.Now().Add(-resultTimeout))
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire commands: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
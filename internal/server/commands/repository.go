@@ -0,0 +1,62 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// Repository handles instance command database operations. Instances are
+// identified by their ID, except where updaters name them by instance ID.
+type Repository interface {
+	// Create queues a command for the instance with ID id
+	Create(ctx context.Context, id string, command *types.InstanceCommand) error
+	// Get retrieves a command, or nil if there is none
+	Get(ctx context.Context, commandID string) (*types.InstanceCommand, error)
+	// List retrieves the most recent commands of an instance, newest first
+	List(ctx context.Context, id string, limit int) ([]types.InstanceCommand, error)
+	// Cancel cancels a pending command of an instance, reporting whether it was pending
+	Cancel(ctx context.Context, id, commandID string) (bool, error)
+	// PendingInstances retrieves the instance IDs that have commands to deliver
+	PendingInstances(ctx context.Context) ([]string, error)
+	// Claim marks the pending commands of an instance delivered and returns
+	// them, oldest first
+	Claim(ctx context.Context, instanceID string) ([]types.Command, error)
+	// Complete records the results of delivered commands of an instance,
+	// returning how many were recorded. Results for unknown commands or
+	// commands of other instances are dropped.
+	Complete(ctx context.Context, instanceID string, results []types.CommandResult) (int, error)
+	// Expire expires commands not delivered by their expiry, and delivered
+	// commands without a result after resultTimeout
+	Expire(ctx context.Context, resultTimeout time.Duration) (int64, error)
+}
+
+// NewRepository creates a command repository for the configured database
+func NewRepository(db *database.DB) Repository {
+	if db.Driver == database.DriverSQLite {
+		return NewSQLiteRepository(db)
+	}
+	return NewPostgresRepository(db)
+}
+
+// Errors recorded on expired commands
+const (
+	errNotDelivered = "the instance did not send a heartbeat before the command expired"
+	errNoResult     = "the instance did not report a result in time"
+)
+
+// encodeArgs encodes command arguments for the args column
+func encodeArgs(args map[string]string) ([]byte, error) {
+	if args == nil {
+		args = map[string]string{}
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode command args: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,193 @@
+package commands
+
+import (
+	"context"
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database/dbtest"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/licensing"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// createInstance registers an instance and returns its ID
+func createInstance(t *testing.T, db *database.DB, instanceID string) string {
+	t.Helper()
+	instance := &types.Instance{InstanceID: instanceID, InstanceType: "siemcore", Hostname: instanceID, Status: "online"}
+	if err := licensing.NewInstanceRepository(db).Create(context.Background(), instance); err != nil {
+		t.Fatalf("create instance: %v", err)
+	}
+	return instance.ID
+}
+
+// queue queues a command of type commandType, created at createdAt
+func queue(t *testing.T, repo Repository, id, commandType string, createdAt, expiresAt time.Time) *types.InstanceCommand {
+	t.Helper()
+	command := &types.InstanceCommand{
+		Command: types.Command{
+			ID:        uuid.New().String(),
+			Type:      commandType,
+			Args:      map[string]string{"reason": "test"},
+			ExpiresAt: expiresAt,
+			Signature: "sig",
+		},
+		Status:    types.CommandPending,
+		CreatedBy: "tester",
+		CreatedAt: createdAt,
+	}
+	if err := repo.Create(context.Background(), id, command); err != nil {
+		t.Fatalf("Create %s: %v", commandType, err)
+	}
+	return command
+}
+
+func TestRepositoryClaimComplete(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		ctx := context.Background()
+		repo := NewRepository(db)
+		a := createInstance(t, db, "inst-a")
+		b := createInstance(t, db, "inst-b")
+
+		now := time.Now()
+		first := queue(t, repo, a, types.CommandCheckUpdate, now.Add(-2*time.Minute), now.Add(time.Hour))
+		second := queue(t, repo, a, types.CommandSecurityScan, now.Add(-time.Minute), now.Add(time.Hour))
+		queue(t, repo, a, types.CommandRestartService, now.Add(-time.Hour), now.Add(-time.Minute))
+		foreign := queue(t, repo, b, types.CommandCheckUpdate, now, now.Add(time.Hour))
+
+		pending, err := repo.PendingInstances(ctx)
+		if err != nil || len(pending) != 2 {
+			t.Errorf("PendingInstances = %v, %v; want inst-a and inst-b", pending, err)
+		}
+
+		claimed, err := repo.Claim(ctx, "inst-a")
+		if err != nil {
+			t.Fatalf("Claim: %v", err)
+		}
+		if len(claimed) != 2 || claimed[0].ID != first.ID || claimed[1].ID != second.ID {
+			t.Fatalf("Claim = %+v, want the two unexpired commands oldest first", claimed)
+		}
+		if claimed[0].InstanceID != "inst-a" || claimed[0].Args["reason"] != "test" || claimed[0].Signature != "sig" {
+			t.Errorf("claimed command = %+v", claimed[0])
+		}
+		if again, err := repo.Claim(ctx, "inst-a"); err != nil || len(again) != 0 {
+			t.Errorf("second Claim = %+v, %v; want nothing", again, err)
+		}
+
+		tests := []struct {
+			name   string
+			result types.CommandResult
+			want   int
+		}{
+			{"delivered", types.CommandResult{CommandID: first.ID, Status: types.CommandSucceeded, Output: "ok"}, 1},
+			{"already completed", types.CommandResult{CommandID: first.ID, Status: types.CommandFailed}, 0},
+			// Commands of other instances cannot be completed, delivered or not
+			{"other instance", types.CommandResult{CommandID: foreign.ID, Status: types.CommandSucceeded}, 0},
+			{"unknown", types.CommandResult{CommandID: uuid.New().String(), Status: types.CommandSucceeded}, 0},
+		}
+		for _, tt := range tests {
+			tt.result.InstanceID = "inst-a"
+			tt.result.Time = now
+			completed, err := repo.Complete(ctx, "inst-a", []types.CommandResult{tt.result})
+			if err != nil || completed != tt.want {
+				t.Errorf("Complete(%s) = %d, %v; want %d", tt.name, completed, err, tt.want)
+			}
+		}
+
+		got, _ := repo.Get(ctx, first.ID)
+		if got.Status != types.CommandSucceeded || got.Output != "ok" || got.DeliveredAt == nil || got.CompletedAt == nil {
+			t.Errorf("completed command = %+v", got)
+		}
+		if untouched, _ := repo.Get(ctx, foreign.ID); untouched.Status != types.CommandPending {
+			t.Errorf("command of inst-b status = %s, want pending", untouched.Status)
+		}
+	})
+}
+
+func TestRepositoryCancelExpire(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		ctx := context.Background()
+		repo := NewRepository(db)
+		a := createInstance(t, db, "inst-a")
+		b := createInstance(t, db, "inst-b")
+
+		now := time.Now()
+		cancelled := queue(t, repo, a, types.CommandCheckUpdate, now, now.Add(time.Hour))
+		if ok, err := repo.Cancel(ctx, b, cancelled.ID); err != nil || ok {
+			t.Errorf("Cancel by another instance = %v, %v; want false", ok, err)
+		}
+		if ok, err := repo.Cancel(ctx, a, cancelled.ID); err != nil || !ok {
+			t.Errorf("Cancel = %v, %v; want true", ok, err)
+		}
+
+		undelivered := queue(t, repo, a, types.CommandSecurityScan, now.Add(-time.Hour), now.Add(-time.Minute))
+		if n, err := repo.Expire(ctx, time.Hour); err != nil || n != 1 {
+			t.Errorf("Expire = %d, %v; want 1", n, err)
+		}
+
+		list, err := repo.List(ctx, a, 10)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		statuses := map[string]string{}
+		for _, command := range list {
+			statuses[command.ID] = command.Status
+		}
+		if statuses[cancelled.ID] != types.CommandCancelled || statuses[undelivered.ID] != types.CommandExpired {
+			t.Errorf("statuses = %v", statuses)
+		}
+		if got, _ := repo.Get(ctx, undelivered.ID); got.Error != errNotDelivered {
+			t.Errorf("expired command error = %q, want %q", got.Error, errNotDelivered)
+		}
+	})
+}
+
+// racingRepository runs onClaim once commands have been claimed, as a command
+// created concurrently with a heartbeat would
+type racingRepository struct {
+	Repository
+	onClaim func()
+}
+
+func (r *racingRepository) Claim(ctx context.Context, instanceID string) ([]types.Command, error) {
+	commands, err := r.Repository.Claim(ctx, instanceID)
+	if r.onClaim != nil {
+		onClaim := r.onClaim
+		r.onClaim = nil
+		onClaim()
+	}
+	return commands, err
+}
+
+func TestServiceClaimRace(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		ctx := context.Background()
+		_, key, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		repo := &racingRepository{Repository: NewRepository(db)}
+		s := &Service{repo: repo, key: key, ttl: time.Hour, cacheTTL: time.Hour}
+
+		instance := &types.Instance{InstanceID: "racing"}
+		instance.ID = createInstance(t, db, instance.InstanceID)
+		create := func(commandType string) {
+			t.Helper()
+			if _, err := s.Create(ctx, instance, types.CreateCommandRequest{Type: commandType}, "tester"); err != nil {
+				t.Fatalf("Create(%s): %v", commandType, err)
+			}
+		}
+
+		create(types.CommandCheckUpdate)
+		repo.onClaim = func() { create(types.CommandSecurityScan) }
+		if got := s.Claim(ctx, instance.InstanceID); len(got) != 1 || got[0].Type != types.CommandCheckUpdate {
+			t.Fatalf("Claim = %+v, want the check_update command", got)
+		}
+		if got := s.Claim(ctx, instance.InstanceID); len(got) != 1 || got[0].Type != types.CommandSecurityScan {
+			t.Errorf("Claim after a concurrent Create = %+v, want the security_scan command", got)
+		}
+	})
+}
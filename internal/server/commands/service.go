@@ -0,0 +1,232 @@
+// Package commands queues commands operators send to instances, such as
+// restarting a product's service. Commands are signed, delivered in the
+// instance's next heartbeat response, and updaters report back their result.
+package commands
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+var (
+	ErrCommandsDisabled  = errors.New("commands are disabled: no signing key is configured")
+	ErrInvalidCommand    = errors.New("invalid command")
+	ErrCommandNotPending = errors.New("only pending commands can be cancelled")
+	ErrForeignResult     = errors.New("results can only be reported by their instance")
+)
+
+// MaxOutputSize limits the output kept from a command
+const MaxOutputSize = 64 << 10
+
+// maxDiagnosticLines limits the log lines collect_diagnostics asks for
+const maxDiagnosticLines = 10000
+
+// Service queues commands and hands them to heartbeats. Few instances have
+// commands waiting, so the instances that do are kept in memory for the cache
+// TTL rather than looked up per heartbeat.
+type Service struct {
+	repo     Repository
+	key      ed25519.PrivateKey // nil when commands are disabled
+	ttl      time.Duration
+	cacheTTL time.Duration
+
+	mu      sync.Mutex
+	pending map[string]bool // instance IDs with commands waiting
+	expires time.Time
+}
+
+// NewService creates the command service, loading the signing key if one is
+// configured. A cacheTTL of 0 looks up waiting commands for every heartbeat.
+func NewService(db *database.DB, cfg config.CommandConfig, cacheTTL time.Duration) (*Service, error) {
+	s := &Service{repo: NewRepository(db), ttl: cfg.TTL, cacheTTL: cacheTTL}
+	if cfg.Enabled() {
+		key, err := cfg.SigningKey()
+		if err != nil {
+			return nil, err
+		}
+		s.key = key
+	}
+	return s, nil
+}
+
+// Create signs and queues a command for an instance
+func (s *Service) Create(ctx context.Context, instance *types.Instance, req types.CreateCommandRequest, actor string) (*types.InstanceCommand, error) {
+	if s.key == nil {
+		return nil, ErrCommandsDisabled
+	}
+	if err := validate(req); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	command := &types.InstanceCommand{
+		Command: types.Command{
+			ID:         uuid.New().String(),
+			InstanceID: instance.InstanceID,
+			Type:       req.Type,
+			Product:    req.Product,
+			Args:       req.Args,
+			// Whole seconds, so the signed time survives the database
+			ExpiresAt: now.Add(s.ttl).UTC().Truncate(time.Second),
+		},
+		Status:    types.CommandPending,
+		CreatedBy: actor,
+		CreatedAt: now,
+	}
+	command.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, command.SigningPayload()))
+
+	if err := s.repo.Create(ctx, instance.ID, command); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if s.pending != nil {
+		s.pending[instance.InstanceID] = true
+	}
+	s.mu.Unlock()
+
+	return command, nil
+}
+
+// validate checks the type, product and arguments of a command
+func validate(req types.CreateCommandRequest) error {
+	allowedArgs := map[string]bool{}
+	switch req.Type {
+	case types.CommandCheckUpdate, types.CommandSecurityScan:
+	case types.CommandRestartService:
+		if req.Product == "" {
+			return fmt.Errorf("%w: %s needs a product", ErrInvalidCommand, req.Type)
+		}
+	case types.CommandRollback:
+		if req.Product == "" {
+			return fmt.Errorf("%w: %s needs a product", ErrInvalidCommand, req.Type)
+		}
+		allowedArgs["version"] = true
+	case types.CommandCollectDiagnostics:
+		allowedArgs["lines"] = true
+		if lines, ok := req.Args["lines"]; ok {
+			if n, err := strconv.Atoi(lines); err != nil || n <= 0 || n > maxDiagnosticLines {
+				return fmt.Errorf("%w: lines must be between 1 and %d", ErrInvalidCommand, maxDiagnosticLines)
+			}
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidCommand, req.Type)
+	}
+
+	for name := range req.Args {
+		if !allowedArgs[name] {
+			return fmt.Errorf("%w: %s takes no argument %q", ErrInvalidCommand, req.Type, name)
+		}
+	}
+	return nil
+}
+
+// Get retrieves a command, or nil if there is none
+func (s *Service) Get(ctx context.Context, commandID string) (*types.InstanceCommand, error) {
+	return s.repo.Get(ctx, commandID)
+}
+
+// List retrieves the most recent commands of the instance with ID id
+func (s *Service) List(ctx context.Context, id string, limit int) ([]types.InstanceCommand, error) {
+	return s.repo.List(ctx, id, limit)
+}
+
+// Cancel cancels a command of the instance with ID id before it is delivered
+func (s *Service) Cancel(ctx context.Context, id, commandID string) error {
+	cancelled, err := s.repo.Cancel(ctx, id, commandID)
+	if err != nil {
+		return err
+	}
+	if !cancelled {
+		return ErrCommandNotPending
+	}
+	return nil
+}
+
+// Claim returns the commands waiting for an instance, marking them delivered.
+// Failures are logged and the commands are left for the next heartbeat.
+func (s *Service) Claim(ctx context.Context, instanceID string) []types.Command {
+	s.mu.Lock()
+	if s.pending == nil || !time.Now().Before(s.expires) {
+		instanceIDs, err := s.repo.PendingInstances(ctx)
+		if err != nil {
+			log.Printf("Failed to load instances with pending commands: %v", err)
+		} else {
+			s.pending = make(map[string]bool, len(instanceIDs))
+			for _, id := range instanceIDs {
+				s.pending[id] = true
+			}
+		}
+		// Also after a failure, so an unavailable database is not hit per heartbeat
+		s.expires = time.Now().Add(s.cacheTTL)
+	}
+	waiting := s.pending[instanceID]
+	// Cleared before claiming, so a command created meanwhile marks the
+	// instance again and is delivered with the next heartbeat
+	delete(s.pending, instanceID)
+	s.mu.Unlock()
+
+	if !waiting {
+		return nil
+	}
+
+	commands, err := s.repo.Claim(ctx, instanceID)
+	if err != nil {
+		log.Printf("Failed to deliver commands to %s: %v", instanceID, err)
+		s.mu.Lock()
+		s.pending[instanceID] = true
+		s.mu.Unlock()
+		return nil
+	}
+
+	return commands
+}
+
+// Complete records results reported by the updater of an instance, returning
+// how many were recorded. Results naming another instance are refused, and
+// results for commands of other instances are not recorded.
+func (s *Service) Complete(ctx context.Context, instanceID string, results []types.CommandResult) (int, error) {
+	for i := range results {
+		if results[i].InstanceID != instanceID {
+			return 0, fmt.Errorf("%w: result for instance %s", ErrForeignResult, results[i].InstanceID)
+		}
+		if len(results[i].Output) > MaxOutputSize {
+			results[i].Output = results[i].Output[:MaxOutputSize]
+		}
+	}
+	return s.repo.Complete(ctx, instanceID, results)
+}
+
+// RunExpiry expires undelivered and unanswered commands every interval until
+// ctx is cancelled
+func (s *Service) RunExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, err := s.repo.Expire(ctx, s.ttl)
+			if err != nil {
+				log.Printf("Failed to expire commands: %v", err)
+			} else if expired > 0 {
+				log.Printf("Expired %d commands", expired)
+			}
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package commands
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// SQLiteRepository stores instance commands in a SQLite database
+type SQLiteRepository struct {
+	db *database.SQLite
+}
+
+// NewSQLiteRepository creates a repository backed by SQLite
+func NewSQLiteRepository(db *database.DB) *SQLiteRepository {
+	return &SQLiteRepository{db: db.SQLite}
+}
+
+// scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSQLiteCommand(row scanner) (*types.InstanceCommand, error) {
+	var command types.InstanceCommand
+	err := row.Scan(&command.ID, &command.InstanceID, &command.Type, &command.Product, database.JSON{V: &command.Args},
+		&command.Signature, &command.ExpiresAt, &command.Status, &command.Output, &command.Error, &command.CreatedBy,
+		&command.CreatedAt, &command.DeliveredAt, &command.CompletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &command, nil
+}
+
+// Create implements Repository
+func (r *SQLiteRepository) Create(ctx context.Context, id string, command *types.InstanceCommand) error {
+	args, err := encodeArgs(command.Args)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO instance_commands (id, instance_id, type, product, args, signature, status, created_by, created_at, expires_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9, $10)
+	`, command.ID, id, command.Type, command.Product, string(args), command.Signature, command.Status,
+		command.CreatedBy, command.CreatedAt, command.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create command: %w", err)
+	}
+	return nil
+}
+
+// Get implements Repository
+func (r *SQLiteRepository) Get(ctx context.Context, commandID string) (*types.InstanceCommand, error) {
+	command, err := scanSQLiteCommand(r.db.QueryRowContext(ctx, `
+		SELECT `+commandColumns+`
+		FROM instance_commands c JOIN instances i ON i.id = c.instance_id
+		WHERE c.id = $1
+	`, commandID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get command: %w", err)
+	}
+	return command, nil
+}
+
+// List implements Repository
+func (r *SQLiteRepository) List(ctx context.Context, id string, limit int) ([]types.InstanceCommand, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+commandColumns+`
+		FROM instance_commands c JOIN instances i ON i.id = c.instance_id
+		WHERE c.instance_id = $1
+		ORDER BY c.created_at DESC
+		LIMIT $2
+	`, id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commands: %w", err)
+	}
+	defer rows.Close()
+
+	commands := []types.InstanceCommand{}
+	for rows.Next() {
+		command, err := scanSQLiteCommand(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan command: %w", err)
+		}
+		commands = append(commands, *command)
+	}
+
+	return commands, rows.Err()
+}
+
+// Cancel implements Repository
+func (r *SQLiteRepository) Cancel(ctx context.Context, id, commandID string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE instance_commands SET status = 'cancelled', completed_at = $3
+		WHERE id = $1 AND instance_id = $2 AND status = 'pending'
+	`, commandID, id, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel command: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// PendingInstances implements Repository
+func (r *SQLiteRepository) PendingInstances(ctx context.Context) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT DISTINCT i.instance_id
+		FROM instance_commands c JOIN instances i ON i.id = c.instance_id
+		WHERE c.status = 'pending' AND c.expires_at > $1
+	`, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instances with pending commands: %w", err)
+	}
+	defer rows.Close()
+
+	var instanceIDs []string
+	for rows.Next() {
+		var instanceID string
+		if err := rows.Scan(&instanceID); err != nil {
+			return nil, fmt.Errorf("failed to scan instance ID: %w", err)
+		}
+		instanceIDs = append(instanceIDs, instanceID)
+	}
+
+	return instanceIDs, rows.Err()
+}
+
+// Claim implements Repository
+func (r *SQLiteRepository) Claim(ctx context.Context, instanceID string) ([]types.Command, error) {
+	now := time.Now()
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE instance_commands SET status = 'delivered', delivered_at = $2
+		WHERE instance_id = (SELECT id FROM instances WHERE instance_id = $1)
+			AND status = 'pending' AND expires_at > $2
+		RETURNING id, type, COALESCE(product, ''), args, expires_at, signature, created_at
+	`, instanceID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim commands: %w", err)
+	}
+	defer rows.Close()
+
+	type claimedCommand struct {
+		command   types.Command
+		createdAt time.Time
+	}
+	var claimed []claimedCommand
+	for rows.Next() {
+		c := claimedCommand{command: types.Command{InstanceID: instanceID}}
+		if err := rows.Scan(&c.command.ID, &c.command.Type, &c.command.Product, database.JSON{V: &c.command.Args},
+			&c.command.ExpiresAt, &c.command.Signature, &c.createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan command: %w", err)
+		}
+		claimed = append(claimed, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to claim commands: %w", err)
+	}
+
+	// RETURNING rows come in no particular order
+	sort.Slice(claimed, func(i, j int) bool { return claimed[i].createdAt.Before(claimed[j].createdAt) })
+	var commands []types.Command
+	for _, c := range claimed {
+		commands = append(commands, c.command)
+	}
+	return commands, nil
+}
+
+// Complete implements Repository
+func (r *SQLiteRepository) Complete(ctx context.Context, instanceID string, results []types.CommandResult) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record command results: %w", err)
+	}
+	defer tx.Rollback()
+
+	completed := 0
+	for _, result := range results {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE instance_commands
+			SET status = $3, output = NULLIF($4, ''), error = NULLIF($5, ''), completed_at = $6
+			WHERE id = $1 AND instance_id = (SELECT id FROM instances WHERE instance_id = $2)
+				AND status IN ('delivered', 'expired')
+		`, result.CommandID, instanceID, result.Status, result.Output, result.Error, result.Time)
+		if err != nil {
+			return 0, fmt.Errorf("failed to record command results: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		completed += int(n)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to record command results: %w", err)
+	}
+	return completed, nil
+}
+
+// Expire implements Repository
+func (r *SQLiteRepository) Expire(ctx context.Context, resultTimeout time.Duration) (int64, error) {
+	now := time.Now()
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE instance_commands
+		SET status = 'expired', completed_at = $1,
+			error = CASE WHEN status = 'pending' THEN $2 ELSE $3 END
+		WHERE (status = 'pending' AND expires_at <= $1)
+			OR (status = 'delivered' AND delivered_at <= $4)
+	`, now, errNotDelivered, errNoResult, now.Add(-resultTimeout))
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire commands: %w", err)
+	}
+	return result.RowsAffected()
+}
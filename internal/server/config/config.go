@@ -1,98 +1,417 @@
 package config
 
 import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/netip"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds all configuration for the update server
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Storage  StorageConfig
-	Auth     AuthConfig
+	Server     ServerConfig    `yaml:"server" toml:"server"`
+	Database   DatabaseConfig  `yaml:"database" toml:"database"`
+	Storage    StorageConfig   `yaml:"storage" toml:"storage"`
+	Auth       AuthConfig      `yaml:"auth" toml:"auth"`
+	Retention  RetentionConfig `yaml:"retention" toml:"retention"`
+	Uploads    UploadConfig    `yaml:"uploads" toml:"uploads"`
+	Mail       MailConfig      `yaml:"mail" toml:"mail"`
+	RateLimit  RateLimitConfig `yaml:"rate_limit" toml:"rate_limit"`
+	Heartbeats HeartbeatConfig `yaml:"heartbeats" toml:"heartbeats"`
+	Commands   CommandConfig   `yaml:"commands" toml:"commands"`
+	Telemetry  TelemetryConfig `yaml:"telemetry" toml:"telemetry"`
+}
+
+// HeartbeatConfig holds heartbeat ingestion settings. Heartbeats are queued
+// and written to the database in batches.
+type HeartbeatConfig struct {
+	QueueSize     int           `yaml:"queue_size" toml:"queue_size"`         // heartbeats waiting to be written before updaters are asked to back off
+	BatchSize     int           `yaml:"batch_size" toml:"batch_size"`         // most heartbeats written at once
+	FlushInterval time.Duration `yaml:"flush_interval" toml:"flush_interval"` // longest a heartbeat waits for its batch to fill
+	RetryAfter    time.Duration `yaml:"retry_after" toml:"retry_after"`       // sent to updaters when the queue is full
+	// Interval is the heartbeat interval sent to updaters. Once the queue is
+	// half full it is stretched, up to MaxInterval when the queue is full.
+	Interval    time.Duration `yaml:"interval" toml:"interval"`
+	MaxInterval time.Duration `yaml:"max_interval" toml:"max_interval"`
+	// ReleaseCacheTTL is how long latest releases, instance controls and
+	// instance API keys are cached for heartbeats. Changes made through this server apply at once; it
+	// bounds how long other replicas and scheduled publishes take to be seen.
+	// 0 disables the cache.
+	ReleaseCacheTTL time.Duration `yaml:"release_cache_ttl" toml:"release_cache_ttl"`
+	// HistoryRetention is how long heartbeat history and instance alerts are
+	// kept. 0 keeps them forever.
+	HistoryRetention time.Duration `yaml:"history_retention" toml:"history_retention"`
+}
+
+// CommandConfig holds settings for commands operators send to instances
+type CommandConfig struct {
+	// SigningKeyFile is a PEM Ed25519 private key, e.g. from
+	// "openssl genpkey -algorithm ed25519". Updaters only run commands signed
+	// with it; without one no commands can be sent.
+	SigningKeyFile string `yaml:"signing_key_file" toml:"signing_key_file"`
+	// TTL is how long a command waits for the instance's next heartbeat, and
+	// then for its result, before it expires
+	TTL time.Duration `yaml:"ttl" toml:"ttl"`
+}
+
+// Enabled reports whether commands can be sent
+func (c CommandConfig) Enabled() bool {
+	return c.SigningKeyFile != ""
+}
+
+// SigningKey reads the key that signs commands
+func (c CommandConfig) SigningKey() (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(c.SigningKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM private key in %s", c.SigningKeyFile)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 key", c.SigningKeyFile)
+	}
+	return private, nil
+}
+
+// TelemetryConfig holds metrics and tracing settings
+type TelemetryConfig struct {
+	MetricsEnabled bool `yaml:"metrics_enabled" toml:"metrics_enabled"`
+	// MetricsAddr serves /metrics without authentication on a separate
+	// address, e.g. 127.0.0.1:9090. When empty /metrics is served on the API
+	// port to callers with the metrics:read permission.
+	MetricsAddr string `yaml:"metrics_addr" toml:"metrics_addr"`
+	// InstanceOfflineAfter is how long an instance may go without a heartbeat
+	// before it is marked offline
+	InstanceOfflineAfter time.Duration `yaml:"instance_offline_after" toml:"instance_offline_after"`
+	OTLPEndpoint         string        `yaml:"otlp_endpoint" toml:"otlp_endpoint"`           // OTLP/HTTP collector for traces; empty disables tracing
+	TraceSampleRatio     float64       `yaml:"trace_sample_ratio" toml:"trace_sample_ratio"` // share of new traces recorded, 0 to 1
+}
+
+// RateLimitConfig holds token-bucket limits for the public endpoints
+type RateLimitConfig struct {
+	Enabled    bool      `yaml:"enabled" toml:"enabled"`
+	Backend    string    `yaml:"backend" toml:"backend"`         // "memory" for a single replica, "postgres" to share limits between replicas
+	Login      RateLimit `yaml:"login" toml:"login"`             // per IP across sign-in, MFA and password reset
+	License    RateLimit `yaml:"license" toml:"license"`         // per IP across license activation and validation
+	LicenseKey RateLimit `yaml:"license_key" toml:"license_key"` // per license key across license activation and validation
+	Heartbeat  RateLimit `yaml:"heartbeat" toml:"heartbeat"`     // per IP
+}
+
+// RateLimit allows bursts of Requests, refilled evenly over Period. A zero
+// Requests disables the limit.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Enabled reports whether the limit applies
+func (l RateLimit) Enabled() bool {
+	return l.Requests > 0 && l.Period > 0
+}
+
+// String formats the limit as "requests/period"
+func (l RateLimit) String() string {
+	return strconv.Itoa(l.Requests) + "/" + l.Period.String()
+}
+
+// MailConfig holds outgoing email settings
+type MailConfig struct {
+	Driver       string `yaml:"driver" toml:"driver"` // "smtp", or "file" or "log" in dev mode; empty sends no mail
+	From         string `yaml:"from" toml:"from"`
+	DashboardURL string `yaml:"dashboard_url" toml:"dashboard_url"` // base of the links sent in emails
+	SMTPHost     string `yaml:"smtp_host" toml:"smtp_host"`
+	SMTPPort     int    `yaml:"smtp_port" toml:"smtp_port"`
+	SMTPUsername string `yaml:"smtp_username" toml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password" toml:"smtp_password"`
+	SMTPTLS      string `yaml:"smtp_tls" toml:"smtp_tls"`   // "starttls", "tls" or "none"
+	FilePath     string `yaml:"file_path" toml:"file_path"` // where the file driver appends messages
+}
+
+// UploadConfig holds resumable upload settings
+type UploadConfig struct {
+	TempPath   string        `yaml:"temp_path" toml:"temp_path"`     // where chunks are assembled before finalizing
+	MaxSize    ByteSize      `yaml:"max_size" toml:"max_size"`       // largest artifact accepted
+	SessionTTL time.Duration `yaml:"session_ttl" toml:"session_ttl"` // sessions idle longer than this are removed
+	// Timeout replaces Server.ReadTimeout and WriteTimeout for requests that
+	// carry an artifact, which take longer to transfer. Zero means no limit.
+	Timeout time.Duration `yaml:"timeout" toml:"timeout"`
+}
+
+// RetentionConfig holds artifact garbage collection settings
+type RetentionConfig struct {
+	GCInterval time.Duration `yaml:"gc_interval" toml:"gc_interval"` // 0 disables scheduled garbage collection
+	DryRun     bool          `yaml:"dry_run" toml:"dry_run"`         // only log what scheduled runs would delete
 }
 
 // AuthConfig holds authentication configuration
 type AuthConfig struct {
-	JWTSecret string
-	Issuer    string
+	JWTSecret      string        `yaml:"jwt_secret" toml:"jwt_secret"`             // encrypts signing keys stored in the database
+	JWTAlgorithm   string        `yaml:"jwt_algorithm" toml:"jwt_algorithm"`       // "EdDSA" or "ES256"
+	JWTKeyRotation time.Duration `yaml:"jwt_key_rotation" toml:"jwt_key_rotation"` // how long each signing key is used
+	// A session ends when it goes unused for SessionIdleTimeout or reaches
+	// SessionAbsoluteTimeout since sign-in, whichever comes first
+	SessionIdleTimeout     time.Duration  `yaml:"session_idle_timeout" toml:"session_idle_timeout"`
+	SessionAbsoluteTimeout time.Duration  `yaml:"session_absolute_timeout" toml:"session_absolute_timeout"`
+	Issuer                 string         `yaml:"issuer" toml:"issuer"`
+	OIDC                   OIDCConfig     `yaml:"oidc" toml:"oidc"`
+	WebAuthn               WebAuthnConfig `yaml:"webauthn" toml:"webauthn"`
+}
+
+// WebAuthnConfig holds security key settings. WebAuthn is enabled when RPID is set.
+type WebAuthnConfig struct {
+	RPID          string   `yaml:"rp_id" toml:"rp_id"`                   // the dashboard's domain, e.g. updates.mysoc.ai
+	RPName        string   `yaml:"rp_name" toml:"rp_name"`               // shown by browsers while registering
+	Origins       []string `yaml:"origins" toml:"origins"`               // dashboard origins allowed to use credentials
+	RequiredRoles []string `yaml:"required_roles" toml:"required_roles"` // roles that must use a security key as their second factor
+}
+
+// Enabled reports whether WebAuthn is configured
+func (c WebAuthnConfig) Enabled() bool {
+	return c.RPID != ""
+}
+
+// OIDCConfig holds single sign-on settings. SSO is enabled when IssuerURL is set.
+type OIDCConfig struct {
+	IssuerURL    string            `yaml:"issuer_url" toml:"issuer_url"`
+	ClientID     string            `yaml:"client_id" toml:"client_id"`
+	ClientSecret string            `yaml:"client_secret" toml:"client_secret"` // empty for public clients, which rely on PKCE alone
+	RedirectURL  string            `yaml:"redirect_url" toml:"redirect_url"`   // must point at /api/v1/auth/oidc/callback
+	Scopes       []string          `yaml:"scopes" toml:"scopes"`
+	GroupsClaim  string            `yaml:"groups_claim" toml:"groups_claim"`
+	RoleMapping  []OIDCRoleMapping `yaml:"role_mapping" toml:"role_mapping"` // checked in order; the first matching group wins
+	DefaultRole  string            `yaml:"default_role" toml:"default_role"` // role for new users in no mapped group; empty denies unmapped users
+	// DisableLocalPasswords stops users with an SSO identity from logging in with a password
+	DisableLocalPasswords bool   `yaml:"disable_local_passwords" toml:"disable_local_passwords"`
+	DashboardURL          string `yaml:"dashboard_url" toml:"dashboard_url"` // where the callback sends the browser; empty returns JSON
+}
+
+// OIDCRoleMapping maps an identity provider group to a role
+type OIDCRoleMapping struct {
+	Group string `yaml:"group" toml:"group"`
+	Role  string `yaml:"role" toml:"role"`
+}
+
+// Enabled reports whether single sign-on is configured
+func (c OIDCConfig) Enabled() bool {
+	return c.IssuerURL != ""
 }
 
 // ServerConfig holds HTTP server configuration
 type ServerConfig struct {
-	Port     int
-	Host     string
-	APIKey   string // Admin API key for management endpoints
-	CORSOrigins []string
+	Port int    `yaml:"port" toml:"port"`
+	Host string `yaml:"host" toml:"host"`
+	// CORSOrigins lists the browser origins allowed to call the API from
+	// another site. Empty allows none, which suits a dashboard served from
+	// the same origin.
+	CORSOrigins          []string `yaml:"cors_origins" toml:"cors_origins"`
+	CORSAllowCredentials bool     `yaml:"cors_allow_credentials" toml:"cors_allow_credentials"`
+	// TrustedProxies lists the addresses or CIDR ranges of reverse proxies in
+	// front of the server. Only requests from them have their client taken
+	// from X-Forwarded-For or X-Real-IP; any other client could forge those
+	// to dodge per-IP rate limits.
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+	// Zero ReadTimeout, WriteTimeout and IdleTimeout mean no limit
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"` // how long in-flight requests get to finish
+	TLSCertFile       string        `yaml:"tls_cert_file" toml:"tls_cert_file"`       // serve HTTPS when set together with TLSKeyFile
+	TLSKeyFile        string        `yaml:"tls_key_file" toml:"tls_key_file"`         // reloaded with the certificate when either changes
+	ACME              ACMEConfig    `yaml:"acme" toml:"acme"`                         // obtain certificates automatically instead of from files
+	// HTTPRedirectPort, when set with TLS, listens for plain HTTP and
+	// redirects it to HTTPS. It also answers ACME HTTP-01 challenges.
+	HTTPRedirectPort int `yaml:"http_redirect_port" toml:"http_redirect_port"`
+	// MaxBodySize limits request bodies other than artifact uploads, which
+	// Uploads.MaxSize limits instead
+	MaxBodySize ByteSize `yaml:"max_body_size" toml:"max_body_size"`
+	// DevMode allows settings that are only safe on a developer's machine,
+	// such as mail drivers that write password reset links to the log or a file
+	DevMode bool `yaml:"dev_mode" toml:"dev_mode"`
+}
+
+// TrustedProxyPrefixes parses TrustedProxies. A bare address is a range of
+// one address.
+func (c ServerConfig) TrustedProxyPrefixes() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(c.TrustedProxies))
+	for _, proxy := range c.TrustedProxies {
+		if addr, err := netip.ParseAddr(proxy); err == nil {
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR range", proxy)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// TLSEnabled reports whether the server listens for HTTPS
+func (c ServerConfig) TLSEnabled() bool {
+	return c.TLSCertFile != "" || c.TLSKeyFile != "" || c.ACME.Enabled()
+}
+
+// ACMEConfig holds automatic certificate settings. ACME is enabled when
+// Domains is set.
+type ACMEConfig struct {
+	Domains      []string `yaml:"domains" toml:"domains"`             // host names to obtain certificates for
+	Email        string   `yaml:"email" toml:"email"`                 // contact for expiry and account notices
+	DirectoryURL string   `yaml:"directory_url" toml:"directory_url"` // the CA's directory; Let's Encrypt by default
+	CacheDir     string   `yaml:"cache_dir" toml:"cache_dir"`         // keeps the account key and certificates across restarts
+	// CARootFile is a PEM bundle trusted when connecting to the directory,
+	// for private CAs and local test servers such as Pebble
+	CARootFile string `yaml:"ca_root_file" toml:"ca_root_file"`
+}
+
+// Enabled reports whether certificates are obtained with ACME
+func (c ACMEConfig) Enabled() bool {
+	return len(c.Domains) > 0
 }
 
 // DatabaseConfig holds database connection configuration
 type DatabaseConfig struct {
-	Host     string
-	Port     int
-	Name     string
-	User     string
-	Password string
-	SSLMode  string
+	Driver      string `yaml:"driver" toml:"driver"` // "postgres", or "sqlite" for a single node
+	Path        string `yaml:"path" toml:"path"`     // SQLite database file
+	Host        string `yaml:"host" toml:"host"`
+	Port        int    `yaml:"port" toml:"port"`
+	Name        string `yaml:"name" toml:"name"`
+	User        string `yaml:"user" toml:"user"`
+	Password    string `yaml:"password" toml:"password"`
+	SSLMode     string `yaml:"ssl_mode" toml:"ssl_mode"`
+	AutoMigrate bool   `yaml:"auto_migrate" toml:"auto_migrate"` // apply pending migrations when the server starts
 }
 
 // StorageConfig holds artifact storage configuration
 type StorageConfig struct {
-	Type     string // "local" or "s3"
-	LocalPath string
+	Type      string `yaml:"type" toml:"type"` // "local" or "s3"
+	LocalPath string `yaml:"local_path" toml:"local_path"`
 	// S3 configuration (for future use)
-	S3Bucket   string
-	S3Region   string
-	S3Endpoint string
+	S3Bucket   string `yaml:"s3_bucket" toml:"s3_bucket"`
+	S3Region   string `yaml:"s3_region" toml:"s3_region"`
+	S3Endpoint string `yaml:"s3_endpoint" toml:"s3_endpoint"`
 }
 
-// Load loads configuration from environment variables
-func Load() (*Config, error) {
-	cfg := &Config{
+// Load builds the configuration from the defaults, then the YAML or TOML
+// file at path unless path is empty, then environment variables, which
+// override the file. Call Validate before serving with the result.
+func Load(path string) (*Config, error) {
+	cfg := defaults()
+
+	if path != "" {
+		if err := loadFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := loadEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	cfg.Auth.OIDC.IssuerURL = strings.TrimRight(cfg.Auth.OIDC.IssuerURL, "/")
+	cfg.Auth.OIDC.DashboardURL = strings.TrimRight(cfg.Auth.OIDC.DashboardURL, "/")
+	cfg.Mail.DashboardURL = strings.TrimRight(cfg.Mail.DashboardURL, "/")
+
+	return cfg, nil
+}
+
+// defaults returns the configuration used for settings that are neither in
+// the file nor in the environment. There is no default JWT secret.
+func defaults() *Config {
+	return &Config{
 		Server: ServerConfig{
-			Port:     getEnvInt("SERVER_PORT", 8080),
-			Host:     getEnv("SERVER_HOST", "0.0.0.0"),
-			APIKey:   getEnv("ADMIN_API_KEY", ""),
-			CORSOrigins: []string{"*"},
+			Port:                 8080,
+			Host:                 "0.0.0.0",
+			CORSAllowCredentials: true,
+			ReadTimeout:          15 * time.Second,
+			ReadHeaderTimeout:    10 * time.Second,
+			WriteTimeout:         15 * time.Second,
+			IdleTimeout:          60 * time.Second,
+			ShutdownTimeout:      30 * time.Second,
+			MaxBodySize:          1 << 20,
+			ACME: ACMEConfig{
+				DirectoryURL: "https://acme-v02.api.letsencrypt.org/directory",
+				CacheDir:     "./acme",
+			},
 		},
 		Database: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     getEnvInt("DB_PORT", 5432),
-			Name:     getEnv("DB_NAME", "mysoc_updates"),
-			User:     getEnv("DB_USER", "postgres"),
-			Password: getEnv("DB_PASSWORD", ""),
-			SSLMode:  getEnv("DB_SSL_MODE", "disable"),
+			Driver:  "postgres",
+			Path:    "./mysoc_updates.db",
+			Host:    "localhost",
+			Port:    5432,
+			Name:    "mysoc_updates",
+			User:    "postgres",
+			SSLMode: "disable",
 		},
 		Storage: StorageConfig{
-			Type:      getEnv("STORAGE_TYPE", "local"),
-			LocalPath: getEnv("STORAGE_LOCAL_PATH", "./artifacts"),
-			S3Bucket:  getEnv("STORAGE_S3_BUCKET", ""),
-			S3Region:  getEnv("STORAGE_S3_REGION", ""),
-			S3Endpoint: getEnv("STORAGE_S3_ENDPOINT", ""),
+			Type:      "local",
+			LocalPath: "./artifacts",
 		},
 		Auth: AuthConfig{
-			JWTSecret: getEnv("JWT_SECRET", "change-this-secret-in-production"),
-			Issuer:    getEnv("JWT_ISSUER", "updates.mysoc.ai"),
+			JWTAlgorithm:           "EdDSA",
+			JWTKeyRotation:         30 * 24 * time.Hour,
+			SessionIdleTimeout:     7 * 24 * time.Hour,
+			SessionAbsoluteTimeout: 30 * 24 * time.Hour,
+			Issuer:                 "updates.mysoc.ai",
+			OIDC: OIDCConfig{
+				Scopes:      []string{"openid", "email", "profile", "groups"},
+				GroupsClaim: "groups",
+			},
+			WebAuthn: WebAuthnConfig{
+				RPName: "MySoc Updates",
+			},
+		},
+		Uploads: UploadConfig{
+			TempPath:   "./uploads",
+			MaxSize:    2048 << 20,
+			SessionTTL: 24 * time.Hour,
+			Timeout:    30 * time.Minute,
+		},
+		Mail: MailConfig{
+			From:         "MySoc Updates <noreply@mysoc.ai>",
+			DashboardURL: "http://localhost:3001",
+			SMTPPort:     587,
+			SMTPTLS:      "starttls",
+			FilePath:     "./mail.log",
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:    true,
+			Backend:    "memory",
+			Login:      RateLimit{Requests: 10, Period: time.Minute},
+			License:    RateLimit{Requests: 30, Period: time.Minute},
+			LicenseKey: RateLimit{Requests: 10, Period: time.Minute},
+			Heartbeat:  RateLimit{Requests: 600, Period: time.Minute},
+		},
+		Heartbeats: HeartbeatConfig{
+			QueueSize:        10000,
+			BatchSize:        500,
+			FlushInterval:    time.Second,
+			RetryAfter:       30 * time.Second,
+			Interval:         time.Minute,
+			MaxInterval:      4 * time.Minute,
+			ReleaseCacheTTL:  30 * time.Second,
+			HistoryRetention: 30 * 24 * time.Hour,
+		},
+		Commands: CommandConfig{
+			TTL: time.Hour,
+		},
+		Telemetry: TelemetryConfig{
+			MetricsEnabled:       true,
+			InstanceOfflineAfter: 5 * time.Minute,
+			TraceSampleRatio:     1,
 		},
 	}
-
-	return cfg, nil
-}
-
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
-
-func getEnvInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
-		}
-	}
-	return defaultValue
 }
-
@@ -0,0 +1,259 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loadEnv overrides cfg with the environment variables that are set.
+// Values that cannot be parsed are reported rather than ignored.
+func loadEnv(cfg *Config) error {
+	e := &envReader{}
+
+	e.int("SERVER_PORT", &cfg.Server.Port)
+	e.string("SERVER_HOST", &cfg.Server.Host)
+	e.list("CORS_ORIGINS", &cfg.Server.CORSOrigins)
+	e.bool("CORS_ALLOW_CREDENTIALS", &cfg.Server.CORSAllowCredentials)
+	e.list("TRUSTED_PROXIES", &cfg.Server.TrustedProxies)
+	e.duration("SERVER_READ_TIMEOUT", &cfg.Server.ReadTimeout)
+	e.duration("SERVER_READ_HEADER_TIMEOUT", &cfg.Server.ReadHeaderTimeout)
+	e.duration("SERVER_WRITE_TIMEOUT", &cfg.Server.WriteTimeout)
+	e.duration("SERVER_IDLE_TIMEOUT", &cfg.Server.IdleTimeout)
+	e.duration("SERVER_SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout)
+	e.string("TLS_CERT_FILE", &cfg.Server.TLSCertFile)
+	e.string("TLS_KEY_FILE", &cfg.Server.TLSKeyFile)
+	e.int("HTTP_REDIRECT_PORT", &cfg.Server.HTTPRedirectPort)
+	e.list("ACME_DOMAINS", &cfg.Server.ACME.Domains)
+	e.string("ACME_EMAIL", &cfg.Server.ACME.Email)
+	e.string("ACME_DIRECTORY_URL", &cfg.Server.ACME.DirectoryURL)
+	e.string("ACME_CACHE_DIR", &cfg.Server.ACME.CacheDir)
+	e.string("ACME_CA_ROOT_FILE", &cfg.Server.ACME.CARootFile)
+	e.size("SERVER_MAX_BODY_SIZE", &cfg.Server.MaxBodySize)
+	e.bool("DEV_MODE", &cfg.Server.DevMode)
+
+	e.string("DB_DRIVER", &cfg.Database.Driver)
+	e.string("DB_PATH", &cfg.Database.Path)
+	e.string("DB_HOST", &cfg.Database.Host)
+	e.int("DB_PORT", &cfg.Database.Port)
+	e.string("DB_NAME", &cfg.Database.Name)
+	e.string("DB_USER", &cfg.Database.User)
+	e.string("DB_PASSWORD", &cfg.Database.Password)
+	e.string("DB_SSL_MODE", &cfg.Database.SSLMode)
+	e.bool("DB_AUTO_MIGRATE", &cfg.Database.AutoMigrate)
+
+	e.string("STORAGE_TYPE", &cfg.Storage.Type)
+	e.string("STORAGE_LOCAL_PATH", &cfg.Storage.LocalPath)
+	e.string("STORAGE_S3_BUCKET", &cfg.Storage.S3Bucket)
+	e.string("STORAGE_S3_REGION", &cfg.Storage.S3Region)
+	e.string("STORAGE_S3_ENDPOINT", &cfg.Storage.S3Endpoint)
+
+	e.string("JWT_SECRET", &cfg.Auth.JWTSecret)
+	e.string("JWT_ALGORITHM", &cfg.Auth.JWTAlgorithm)
+	e.duration("JWT_KEY_ROTATION", &cfg.Auth.JWTKeyRotation)
+	e.duration("SESSION_IDLE_TIMEOUT", &cfg.Auth.SessionIdleTimeout)
+	e.duration("SESSION_ABSOLUTE_TIMEOUT", &cfg.Auth.SessionAbsoluteTimeout)
+	e.string("JWT_ISSUER", &cfg.Auth.Issuer)
+
+	e.string("OIDC_ISSUER_URL", &cfg.Auth.OIDC.IssuerURL)
+	e.string("OIDC_CLIENT_ID", &cfg.Auth.OIDC.ClientID)
+	e.string("OIDC_CLIENT_SECRET", &cfg.Auth.OIDC.ClientSecret)
+	e.string("OIDC_REDIRECT_URL", &cfg.Auth.OIDC.RedirectURL)
+	if value := os.Getenv("OIDC_SCOPES"); value != "" {
+		cfg.Auth.OIDC.Scopes = strings.Fields(value)
+	}
+	e.string("OIDC_GROUPS_CLAIM", &cfg.Auth.OIDC.GroupsClaim)
+	if value := os.Getenv("OIDC_ROLE_MAPPING"); value != "" {
+		cfg.Auth.OIDC.RoleMapping = parseRoleMapping(value)
+	}
+	e.string("OIDC_DEFAULT_ROLE", &cfg.Auth.OIDC.DefaultRole)
+	e.bool("OIDC_DISABLE_LOCAL_PASSWORDS", &cfg.Auth.OIDC.DisableLocalPasswords)
+	e.string("OIDC_DASHBOARD_URL", &cfg.Auth.OIDC.DashboardURL)
+
+	e.string("WEBAUTHN_RP_ID", &cfg.Auth.WebAuthn.RPID)
+	e.string("WEBAUTHN_RP_NAME", &cfg.Auth.WebAuthn.RPName)
+	e.list("WEBAUTHN_ORIGINS", &cfg.Auth.WebAuthn.Origins)
+	e.list("WEBAUTHN_REQUIRED_ROLES", &cfg.Auth.WebAuthn.RequiredRoles)
+
+	e.duration("RETENTION_GC_INTERVAL", &cfg.Retention.GCInterval)
+	e.bool("RETENTION_GC_DRY_RUN", &cfg.Retention.DryRun)
+
+	e.string("UPLOAD_TEMP_PATH", &cfg.Uploads.TempPath)
+	var maxSizeMB int
+	if e.int("UPLOAD_MAX_SIZE_MB", &maxSizeMB) {
+		cfg.Uploads.MaxSize = ByteSize(maxSizeMB) << 20
+	}
+	e.duration("UPLOAD_SESSION_TTL", &cfg.Uploads.SessionTTL)
+	e.duration("UPLOAD_TIMEOUT", &cfg.Uploads.Timeout)
+
+	e.string("MAIL_DRIVER", &cfg.Mail.Driver)
+	e.string("MAIL_FROM", &cfg.Mail.From)
+	e.string("MAIL_DASHBOARD_URL", &cfg.Mail.DashboardURL)
+	e.string("SMTP_HOST", &cfg.Mail.SMTPHost)
+	e.int("SMTP_PORT", &cfg.Mail.SMTPPort)
+	e.string("SMTP_USERNAME", &cfg.Mail.SMTPUsername)
+	e.string("SMTP_PASSWORD", &cfg.Mail.SMTPPassword)
+	e.string("SMTP_TLS", &cfg.Mail.SMTPTLS)
+	e.string("MAIL_FILE_PATH", &cfg.Mail.FilePath)
+
+	e.bool("RATE_LIMIT_ENABLED", &cfg.RateLimit.Enabled)
+	e.string("RATE_LIMIT_BACKEND", &cfg.RateLimit.Backend)
+	e.rateLimit("RATE_LIMIT_LOGIN", &cfg.RateLimit.Login)
+	e.rateLimit("RATE_LIMIT_LICENSE", &cfg.RateLimit.License)
+	e.rateLimit("RATE_LIMIT_LICENSE_KEY", &cfg.RateLimit.LicenseKey)
+	e.rateLimit("RATE_LIMIT_HEARTBEAT", &cfg.RateLimit.Heartbeat)
+
+	e.int("HEARTBEAT_QUEUE_SIZE", &cfg.Heartbeats.QueueSize)
+	e.int("HEARTBEAT_BATCH_SIZE", &cfg.Heartbeats.BatchSize)
+	e.duration("HEARTBEAT_FLUSH_INTERVAL", &cfg.Heartbeats.FlushInterval)
+	e.duration("HEARTBEAT_RETRY_AFTER", &cfg.Heartbeats.RetryAfter)
+	e.duration("HEARTBEAT_INTERVAL", &cfg.Heartbeats.Interval)
+	e.duration("HEARTBEAT_MAX_INTERVAL", &cfg.Heartbeats.MaxInterval)
+	e.duration("RELEASE_CACHE_TTL", &cfg.Heartbeats.ReleaseCacheTTL)
+	e.duration("HEARTBEAT_HISTORY_RETENTION", &cfg.Heartbeats.HistoryRetention)
+
+	e.string("COMMAND_SIGNING_KEY_FILE", &cfg.Commands.SigningKeyFile)
+	e.duration("COMMAND_TTL", &cfg.Commands.TTL)
+
+	e.bool("METRICS_ENABLED", &cfg.Telemetry.MetricsEnabled)
+	e.string("METRICS_ADDR", &cfg.Telemetry.MetricsAddr)
+	e.duration("INSTANCE_OFFLINE_AFTER", &cfg.Telemetry.InstanceOfflineAfter)
+	e.string("OTEL_EXPORTER_OTLP_ENDPOINT", &cfg.Telemetry.OTLPEndpoint)
+	e.float("OTEL_TRACES_SAMPLER_ARG", &cfg.Telemetry.TraceSampleRatio)
+
+	return errors.Join(e.errs...)
+}
+
+// envReader copies environment variables that are set into settings,
+// collecting the ones it cannot parse. Each method reports whether it
+// changed the setting.
+type envReader struct {
+	errs []error
+}
+
+func (e *envReader) lookup(key string) (string, bool) {
+	value := os.Getenv(key)
+	return value, value != ""
+}
+
+func (e *envReader) invalid(key, value, want string) bool {
+	e.errs = append(e.errs, fmt.Errorf("%s=%q is not %s", key, value, want))
+	return false
+}
+
+func (e *envReader) string(key string, dst *string) bool {
+	value, ok := e.lookup(key)
+	if ok {
+		*dst = value
+	}
+	return ok
+}
+
+func (e *envReader) int(key string, dst *int) bool {
+	value, ok := e.lookup(key)
+	if !ok {
+		return false
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return e.invalid(key, value, "a whole number")
+	}
+	*dst = n
+	return true
+}
+
+func (e *envReader) float(key string, dst *float64) bool {
+	value, ok := e.lookup(key)
+	if !ok {
+		return false
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return e.invalid(key, value, "a number")
+	}
+	*dst = f
+	return true
+}
+
+func (e *envReader) duration(key string, dst *time.Duration) bool {
+	value, ok := e.lookup(key)
+	if !ok {
+		return false
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return e.invalid(key, value, "a duration such as 30s or 1h")
+	}
+	*dst = duration
+	return true
+}
+
+func (e *envReader) bool(key string, dst *bool) bool {
+	value, ok := e.lookup(key)
+	if !ok {
+		return false
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return e.invalid(key, value, "true or false")
+	}
+	*dst = b
+	return true
+}
+
+// list reads a comma-separated list
+func (e *envReader) list(key string, dst *[]string) bool {
+	value, ok := e.lookup(key)
+	if !ok {
+		return false
+	}
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	*dst = values
+	return true
+}
+
+func (e *envReader) size(key string, dst *ByteSize) bool {
+	value, ok := e.lookup(key)
+	if !ok {
+		return false
+	}
+	if err := dst.UnmarshalText([]byte(value)); err != nil {
+		return e.invalid(key, value, "a size such as 1MB")
+	}
+	return true
+}
+
+func (e *envReader) rateLimit(key string, dst *RateLimit) bool {
+	value, ok := e.lookup(key)
+	if !ok {
+		return false
+	}
+	if err := dst.UnmarshalText([]byte(value)); err != nil {
+		return e.invalid(key, value, "a rate limit such as 10/1m or off")
+	}
+	return true
+}
+
+// parseRoleMapping parses "group=role,group=role"
+func parseRoleMapping(value string) []OIDCRoleMapping {
+	var mappings []OIDCRoleMapping
+	for _, pair := range strings.Split(value, ",") {
+		group, role, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		group, role = strings.TrimSpace(group), strings.TrimSpace(role)
+		if group != "" && role != "" {
+			mappings = append(mappings, OIDCRoleMapping{Group: group, Role: role})
+		}
+	}
+	return mappings
+}
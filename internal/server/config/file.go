@@ -0,0 +1,137 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// loadFile decodes a YAML or TOML file, chosen by its extension, over cfg.
+// Settings the file leaves out keep their value, and unknown settings are
+// rejected so that a misspelt key is not silently ignored.
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, key := range undecoded {
+				keys[i] = key.String()
+			}
+			return fmt.Errorf("invalid config file %s: unknown settings %s", path, strings.Join(keys, ", "))
+		}
+	default:
+		return fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+	}
+
+	return nil
+}
+
+// UnmarshalText reads a limit as "requests/period", e.g. "10/1m" or "100/h".
+// "0" or "off" disables it.
+func (l *RateLimit) UnmarshalText(text []byte) error {
+	limit, err := parseRateLimit(string(text))
+	if err != nil {
+		return err
+	}
+	*l = limit
+	return nil
+}
+
+func parseRateLimit(value string) (RateLimit, error) {
+	value = strings.TrimSpace(value)
+	if value == "0" || value == "off" {
+		return RateLimit{}, nil
+	}
+
+	invalid := fmt.Errorf("invalid rate limit %q, want requests/period such as 10/1m", value)
+	requests, period, ok := strings.Cut(value, "/")
+	if !ok {
+		return RateLimit{}, invalid
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(requests))
+	if err != nil || count < 0 {
+		return RateLimit{}, invalid
+	}
+	period = strings.TrimSpace(period)
+	if period != "" && !strings.ContainsAny(period[:1], "0123456789") {
+		period = "1" + period
+	}
+	duration, err := time.ParseDuration(period)
+	if err != nil || duration <= 0 {
+		return RateLimit{}, invalid
+	}
+
+	return RateLimit{Requests: count, Period: duration}, nil
+}
+
+// ByteSize is a size in bytes, written as a number of bytes or with a KB,
+// MB or GB suffix. The suffixes are powers of 1024 and may also be written
+// KiB, MiB and GiB.
+type ByteSize int64
+
+var byteSizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30},
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+	{"B", 1},
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (s *ByteSize) UnmarshalText(text []byte) error {
+	value := strings.ToUpper(strings.TrimSpace(string(text)))
+	multiplier := int64(1)
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value, multiplier = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix)), unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 || n > (1<<62)/multiplier {
+		return fmt.Errorf("invalid size %q, want bytes or a number with KB, MB or GB", string(text))
+	}
+	*s = ByteSize(n * multiplier)
+	return nil
+}
+
+// String formats the size with the largest unit that divides it
+func (s ByteSize) String() string {
+	switch {
+	case s != 0 && s%(1<<30) == 0:
+		return strconv.FormatInt(int64(s>>30), 10) + "GB"
+	case s != 0 && s%(1<<20) == 0:
+		return strconv.FormatInt(int64(s>>20), 10) + "MB"
+	case s != 0 && s%(1<<10) == 0:
+		return strconv.FormatInt(int64(s>>10), 10) + "KB"
+	default:
+		return strconv.FormatInt(int64(s), 10) + "B"
+	}
+}
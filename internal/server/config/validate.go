@@ -0,0 +1,246 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// MinJWTSecretLength is the shortest JWT secret accepted
+const MinJWTSecretLength = 32
+
+// placeholderSecrets are example JWT secrets from earlier defaults and docs,
+// which must never reach production
+var placeholderSecrets = []string{
+	"change-this-secret-in-production",
+	"changeme-generate-secure-jwt-secret",
+	"your-jwt-secret",
+	"your-secret-jwt-key",
+}
+
+// Validate reports every setting that is invalid or unsafe to serve with.
+// Each problem names the file setting and the environment variable that set it.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	// Listener
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		fail("server.port (SERVER_PORT) must be between 1 and 65535, got %d", c.Server.Port)
+	}
+	for _, timeout := range []struct {
+		name, env string
+		value     time.Duration
+	}{
+		{"read_timeout", "SERVER_READ_TIMEOUT", c.Server.ReadTimeout},
+		{"write_timeout", "SERVER_WRITE_TIMEOUT", c.Server.WriteTimeout},
+		{"idle_timeout", "SERVER_IDLE_TIMEOUT", c.Server.IdleTimeout},
+	} {
+		if timeout.value < 0 {
+			fail("server.%s (%s) must not be negative", timeout.name, timeout.env)
+		}
+	}
+	if c.Server.ReadHeaderTimeout <= 0 {
+		fail("server.read_header_timeout (SERVER_READ_HEADER_TIMEOUT) must be positive; without it slow clients can hold connections open")
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		fail("server.shutdown_timeout (SERVER_SHUTDOWN_TIMEOUT) must be positive")
+	}
+	if c.Server.MaxBodySize <= 0 {
+		fail("server.max_body_size (SERVER_MAX_BODY_SIZE) must be positive")
+	}
+
+	// TLS
+	switch {
+	case c.Server.TLSCertFile == "" && c.Server.TLSKeyFile != "":
+		fail("server.tls_key_file (TLS_KEY_FILE) is set without server.tls_cert_file (TLS_CERT_FILE)")
+	case c.Server.TLSCertFile != "" && c.Server.TLSKeyFile == "":
+		fail("server.tls_cert_file (TLS_CERT_FILE) is set without server.tls_key_file (TLS_KEY_FILE)")
+	case c.Server.TLSCertFile != "" && c.Server.ACME.Enabled():
+		fail("server.tls_cert_file (TLS_CERT_FILE) and server.acme.domains (ACME_DOMAINS) cannot both be set")
+	case c.Server.TLSCertFile != "":
+		if _, err := tls.LoadX509KeyPair(c.Server.TLSCertFile, c.Server.TLSKeyFile); err != nil {
+			fail("server.tls_cert_file and server.tls_key_file (TLS_CERT_FILE, TLS_KEY_FILE): %v", err)
+		}
+	}
+	if c.Server.ACME.Enabled() {
+		if u, err := url.Parse(c.Server.ACME.DirectoryURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			fail("server.acme.directory_url (ACME_DIRECTORY_URL) must be an https URL, got %q", c.Server.ACME.DirectoryURL)
+		}
+		if c.Server.ACME.CacheDir == "" {
+			fail("server.acme.cache_dir (ACME_CACHE_DIR) is required; without it every restart requests new certificates")
+		}
+		if c.Server.ACME.CARootFile != "" {
+			if _, err := os.Stat(c.Server.ACME.CARootFile); err != nil {
+				fail("server.acme.ca_root_file (ACME_CA_ROOT_FILE): %v", err)
+			}
+		}
+	}
+	if port := c.Server.HTTPRedirectPort; port != 0 {
+		switch {
+		case !c.Server.TLSEnabled():
+			fail("server.http_redirect_port (HTTP_REDIRECT_PORT) requires TLS")
+		case port < 1 || port > 65535 || port == c.Server.Port:
+			fail("server.http_redirect_port (HTTP_REDIRECT_PORT) must be between 1 and 65535 and differ from server.port, got %d", port)
+		}
+	}
+
+	// CORS
+	for _, origin := range c.Server.CORSOrigins {
+		if origin == "*" {
+			if c.Server.CORSAllowCredentials {
+				fail("server.cors_origins (CORS_ORIGINS) cannot contain \"*\" while server.cors_allow_credentials (CORS_ALLOW_CREDENTIALS) is true; " +
+					"list the dashboard origins instead, or disable credentials")
+			}
+			continue
+		}
+		if err := checkOrigin(origin); err != nil {
+			fail("server.cors_origins (CORS_ORIGINS): %v", err)
+		}
+	}
+
+	// Proxies
+	if _, err := c.Server.TrustedProxyPrefixes(); err != nil {
+		fail("server.trusted_proxies (TRUSTED_PROXIES): %v", err)
+	}
+
+	// Database
+	switch c.Database.Driver {
+	case "postgres":
+		if c.Database.Host == "" {
+			fail("database.host (DB_HOST) is required for the postgres driver")
+		}
+	case "sqlite":
+		if c.Database.Path == "" {
+			fail("database.path (DB_PATH) is required for the sqlite driver")
+		}
+		if c.RateLimit.Enabled && c.RateLimit.Backend == "postgres" {
+			fail("rate_limit.backend (RATE_LIMIT_BACKEND) postgres requires the postgres database driver")
+		}
+	default:
+		fail("database.driver (DB_DRIVER) must be postgres or sqlite, got %q", c.Database.Driver)
+	}
+
+	// Authentication
+	switch secret := c.Auth.JWTSecret; {
+	case secret == "":
+		fail("auth.jwt_secret (JWT_SECRET) is required; generate one with: openssl rand -base64 48")
+	case isPlaceholderSecret(secret):
+		fail("auth.jwt_secret (JWT_SECRET) is an example value; generate one with: openssl rand -base64 48")
+	case len(secret) < MinJWTSecretLength:
+		fail("auth.jwt_secret (JWT_SECRET) must be at least %d characters, got %d", MinJWTSecretLength, len(secret))
+	}
+	if c.Auth.JWTAlgorithm != "EdDSA" && c.Auth.JWTAlgorithm != "ES256" {
+		fail("auth.jwt_algorithm (JWT_ALGORITHM) must be EdDSA or ES256, got %q", c.Auth.JWTAlgorithm)
+	}
+	if c.Auth.JWTKeyRotation <= 0 {
+		fail("auth.jwt_key_rotation (JWT_KEY_ROTATION) must be positive")
+	}
+	if c.Auth.SessionIdleTimeout <= 0 || c.Auth.SessionAbsoluteTimeout <= 0 {
+		fail("auth.session_idle_timeout and auth.session_absolute_timeout (SESSION_IDLE_TIMEOUT, SESSION_ABSOLUTE_TIMEOUT) must be positive")
+	}
+	if c.Auth.OIDC.Enabled() && (c.Auth.OIDC.ClientID == "" || c.Auth.OIDC.RedirectURL == "") {
+		fail("auth.oidc.client_id and auth.oidc.redirect_url (OIDC_CLIENT_ID, OIDC_REDIRECT_URL) are required when auth.oidc.issuer_url is set")
+	}
+
+	// Uploads
+	if c.Uploads.MaxSize <= 0 {
+		fail("uploads.max_size (UPLOAD_MAX_SIZE_MB) must be positive")
+	}
+	if c.Uploads.Timeout < 0 {
+		fail("uploads.timeout (UPLOAD_TIMEOUT) must not be negative")
+	}
+
+	// Mail
+	switch c.Mail.Driver {
+	case "", "smtp":
+	case "file", "log":
+		if !c.Server.DevMode {
+			fail("mail.driver (MAIL_DRIVER) %s writes password reset links where anyone who reads them can sign in as any user; "+
+				"use smtp, or set server.dev_mode (DEV_MODE) on a development machine", c.Mail.Driver)
+		}
+	default:
+		fail("mail.driver (MAIL_DRIVER) must be smtp, file or log, got %q", c.Mail.Driver)
+	}
+
+	// Rate limits
+	if c.RateLimit.Backend != "memory" && c.RateLimit.Backend != "postgres" {
+		fail("rate_limit.backend (RATE_LIMIT_BACKEND) must be memory or postgres, got %q", c.RateLimit.Backend)
+	}
+
+	// Heartbeats
+	if c.Heartbeats.QueueSize <= 0 || c.Heartbeats.BatchSize <= 0 {
+		fail("heartbeats.queue_size and heartbeats.batch_size (HEARTBEAT_QUEUE_SIZE, HEARTBEAT_BATCH_SIZE) must be positive")
+	}
+	if c.Heartbeats.FlushInterval <= 0 {
+		fail("heartbeats.flush_interval (HEARTBEAT_FLUSH_INTERVAL) must be positive")
+	}
+	if c.Heartbeats.RetryAfter < time.Second {
+		fail("heartbeats.retry_after (HEARTBEAT_RETRY_AFTER) must be at least 1s")
+	}
+	if c.Heartbeats.Interval < time.Second {
+		fail("heartbeats.interval (HEARTBEAT_INTERVAL) must be at least 1s")
+	}
+	if c.Heartbeats.MaxInterval < c.Heartbeats.Interval {
+		fail("heartbeats.max_interval (HEARTBEAT_MAX_INTERVAL) must not be less than heartbeats.interval")
+	}
+	if c.Heartbeats.MaxInterval >= c.Telemetry.InstanceOfflineAfter {
+		fail("heartbeats.max_interval (HEARTBEAT_MAX_INTERVAL) must be less than telemetry.instance_offline_after (INSTANCE_OFFLINE_AFTER), or slowed instances are reported offline")
+	}
+	if c.Heartbeats.ReleaseCacheTTL < 0 {
+		fail("heartbeats.release_cache_ttl (RELEASE_CACHE_TTL) must not be negative")
+	}
+	if c.Heartbeats.HistoryRetention < 0 {
+		fail("heartbeats.history_retention (HEARTBEAT_HISTORY_RETENTION) must not be negative")
+	}
+
+	// Commands
+	if c.Commands.Enabled() {
+		if _, err := c.Commands.SigningKey(); err != nil {
+			fail("commands.signing_key_file (COMMAND_SIGNING_KEY_FILE): %v", err)
+		}
+	}
+	if c.Commands.TTL < time.Minute {
+		fail("commands.ttl (COMMAND_TTL) must be at least 1m")
+	}
+
+	// Telemetry
+	if c.Telemetry.InstanceOfflineAfter <= 0 {
+		fail("telemetry.instance_offline_after (INSTANCE_OFFLINE_AFTER) must be positive")
+	}
+	if c.Telemetry.OTLPEndpoint != "" {
+		if u, err := url.Parse(c.Telemetry.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("telemetry.otlp_endpoint (OTEL_EXPORTER_OTLP_ENDPOINT) must be an http or https URL, got %q", c.Telemetry.OTLPEndpoint)
+		}
+	}
+	if c.Telemetry.TraceSampleRatio < 0 || c.Telemetry.TraceSampleRatio > 1 {
+		fail("telemetry.trace_sample_ratio (OTEL_TRACES_SAMPLER_ARG) must be between 0 and 1, got %g", c.Telemetry.TraceSampleRatio)
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkOrigin accepts a browser origin: a scheme and host, with an optional port
+func checkOrigin(origin string) error {
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("%q is not an origin such as https://updates.example.com", origin)
+	}
+	return nil
+}
+
+func isPlaceholderSecret(secret string) bool {
+	for _, placeholder := range placeholderSecrets {
+		if strings.EqualFold(secret, placeholder) {
+			return true
+		}
+	}
+	return false
+}
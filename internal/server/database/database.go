@@ -4,18 +4,45 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/tracing"
 )
 
-// DB wraps the PostgreSQL connection pool
+// Database drivers
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite" // single-node and test deployments
+)
+
+// DB wraps the PostgreSQL connection pool, or a SQLite database file
 type DB struct {
-	Pool *pgxpool.Pool
+	Driver string
+	Pool   *pgxpool.Pool // set for DriverPostgres
+	SQLite *SQLite       // set for DriverSQLite
 }
 
-// New creates a new database connection pool
+// New connects to the configured database
 func New(cfg config.DatabaseConfig) (*DB, error) {
+	switch cfg.Driver {
+	case "", DriverPostgres:
+		return newPostgres(cfg)
+	case DriverSQLite:
+		db, err := OpenSQLite(cfg.Path)
+		if err != nil {
+			return nil, err
+		}
+		return &DB{Driver: DriverSQLite, SQLite: db}, nil
+	default:
+		return nil, fmt.Errorf("unknown database driver: %s", cfg.Driver)
+	}
+}
+
+// newPostgres creates a new database connection pool
+func newPostgres(cfg config.DatabaseConfig) (*DB, error) {
 	connString := fmt.Sprintf(
 		"postgres://%s:%s@%s:%d/%s?sslmode=%s",
 		cfg.User,
@@ -30,6 +57,7 @@ func New(cfg config.DatabaseConfig) (*DB, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse connection string: %w", err)
 	}
+	poolConfig.ConnConfig.Tracer = queryTracer{}
 
 	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
@@ -41,17 +69,42 @@ func New(cfg config.DatabaseConfig) (*DB, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return &DB{Pool: pool}, nil
+	return &DB{Driver: DriverPostgres, Pool: pool}, nil
+}
+
+// queryTracer records a span for each PostgreSQL statement
+type queryTracer struct{}
+
+type querySpanKey struct{}
+
+// TraceQueryStart implements pgx.QueryTracer
+func (queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, span := tracing.StartQuery(ctx, "postgresql", data.SQL)
+	return context.WithValue(ctx, querySpanKey{}, span)
+}
+
+// TraceQueryEnd implements pgx.QueryTracer
+func (queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	if span, ok := ctx.Value(querySpanKey{}).(trace.Span); ok {
+		tracing.End(span, data.Err)
+	}
 }
 
 // Close closes the database connection pool
 func (db *DB) Close() {
+	if db.SQLite != nil {
+		db.SQLite.Close()
+		return
+	}
 	db.Pool.Close()
 }
 
 // Exec executes a query without returning rows
 func (db *DB) Exec(ctx context.Context, sql string, args ...interface{}) error {
+	if db.SQLite != nil {
+		_, err := db.SQLite.ExecContext(ctx, sql, args...)
+		return err
+	}
 	_, err := db.Pool.Exec(ctx, sql, args...)
 	return err
 }
-
@@ -0,0 +1,451 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// migrationLockKey is the advisory lock that keeps replicas from migrating at once
+const migrationLockKey = 0x6d696772 // "migr"
+
+// migrationFile matches migration file names such as 001_initial.up.sql
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a schema change and the SQL that reverts it
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // SHA-256 of Up
+}
+
+// MigrationStatus describes a migration and whether it has been applied
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+	// Modified is set when the applied migration's file has changed since
+	Modified bool
+	// Missing is set when an applied migration has no file in this build
+	Missing bool
+}
+
+// Migrator applies the migrations in a file system and records them in the
+// schema_migrations table
+type Migrator struct {
+	db         *DB
+	migrations []Migration
+}
+
+// appliedMigration is a row of schema_migrations
+type appliedMigration struct {
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// NewMigrator reads the migrations in fsys
+func NewMigrator(db *DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// LoadMigrations reads NNN_name.up.sql and NNN_name.down.sql files, ordered by version
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %03d has two names: %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(data)
+			sum := sha256.Sum256(data)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %03d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Up applies all pending migrations in order and returns them. It refuses to
+// run if an applied migration's file has changed.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(conn migrationConn, done map[int64]appliedMigration) error {
+		if err := m.verify(done); err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			if err := runMigration(ctx, conn, migration, migration.Up, true); err != nil {
+				return err
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns them
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.withLock(ctx, func(conn migrationConn, done map[int64]appliedMigration) error {
+		versions := make([]int64, 0, len(done))
+		for version := range done {
+			versions = append(versions, version)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+		for _, version := range versions {
+			if len(reverted) == steps {
+				break
+			}
+			migration := m.find(version)
+			if migration == nil {
+				return fmt.Errorf("migration %03d is applied but not included in this build", version)
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %03d_%s has no down file", migration.Version, migration.Name)
+			}
+			if err := runMigration(ctx, conn, *migration, migration.Down, false); err != nil {
+				return err
+			}
+			reverted = append(reverted, *migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Baseline records every migration up to version as applied without running
+// it, for databases that were migrated by hand before migrations were tracked
+func (m *Migrator) Baseline(ctx context.Context, version int64) ([]Migration, error) {
+	if m.find(version) == nil {
+		return nil, fmt.Errorf("unknown migration version %d", version)
+	}
+
+	var recorded []Migration
+	err := m.withLock(ctx, func(conn migrationConn, done map[int64]appliedMigration) error {
+		for _, migration := range m.migrations {
+			if migration.Version > version {
+				break
+			}
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			err := conn.exec(ctx, `
+				INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)
+			`, migration.Version, migration.Name, migration.Checksum)
+			if err != nil {
+				return fmt.Errorf("failed to record migration %03d: %w", migration.Version, err)
+			}
+			recorded = append(recorded, migration)
+		}
+		return nil
+	})
+	return recorded, err
+}
+
+// Status lists every known or applied migration in version order
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(ctx, func(conn migrationConn, done map[int64]appliedMigration) error {
+		for _, migration := range m.migrations {
+			status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+			if applied, ok := done[migration.Version]; ok {
+				status.AppliedAt = &applied.AppliedAt
+				status.Modified = applied.Checksum != migration.Checksum
+			}
+			statuses = append(statuses, status)
+		}
+		for version, applied := range done {
+			if m.find(version) == nil {
+				appliedAt := applied.AppliedAt
+				statuses = append(statuses, MigrationStatus{
+					Version: version, Name: applied.Name, AppliedAt: &appliedAt, Missing: true,
+				})
+			}
+		}
+		return nil
+	})
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, err
+}
+
+// Pending returns how many migrations have not been applied
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// withLock runs fn on a connection with the migrations applied so far. On
+// PostgreSQL the connection holds the migration advisory lock, so other
+// replicas wait for it. SQLite needs no lock: each migration's transaction
+// holds the write lock, and a migration another process applied first fails
+// on its schema_migrations row.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn migrationConn, done map[int64]appliedMigration) error) error {
+	var conn migrationConn
+	if m.db.SQLite != nil {
+		sqlConn, err := m.db.SQLite.Conn(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to acquire connection: %w", err)
+		}
+		defer sqlConn.Close()
+
+		conn = &sqliteMigrationConn{conn: sqlConn}
+	} else {
+		pgConn, err := m.db.Pool.Acquire(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to acquire connection: %w", err)
+		}
+		defer pgConn.Release()
+
+		if _, err := pgConn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		defer pgConn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+
+		conn = &postgresMigrationConn{conn: pgConn}
+	}
+
+	if err := conn.createTable(ctx); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	done, err := conn.applied(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+
+	return fn(conn, done)
+}
+
+// verify checks that applied migrations match this build's files
+func (m *Migrator) verify(done map[int64]appliedMigration) error {
+	for version, applied := range done {
+		migration := m.find(version)
+		if migration == nil {
+			continue // applied by a newer build
+		}
+		if applied.Checksum != migration.Checksum {
+			return fmt.Errorf("migration %03d_%s has changed since it was applied", version, migration.Name)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) find(version int64) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+// runMigration executes one direction of a migration and records it in the
+// same transaction
+func runMigration(ctx context.Context, conn migrationConn, migration Migration, sql string, up bool) error {
+	return conn.inTx(ctx, func(exec func(sql string, args ...interface{}) error) error {
+		if err := exec(sql); err != nil {
+			return fmt.Errorf("migration %03d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+
+		var err error
+		if up {
+			err = exec(`
+				INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)
+			`, migration.Version, migration.Name, migration.Checksum)
+		} else {
+			err = exec(`DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to record migration %03d: %w", migration.Version, err)
+		}
+		return nil
+	})
+}
+
+// migrationConn is a database connection migrations run on
+type migrationConn interface {
+	createTable(ctx context.Context) error
+	applied(ctx context.Context) (map[int64]appliedMigration, error)
+	exec(ctx context.Context, sql string, args ...interface{}) error
+	// inTx runs fn in a transaction that commits if fn returns nil
+	inTx(ctx context.Context, fn func(exec func(sql string, args ...interface{}) error) error) error
+}
+
+type postgresMigrationConn struct {
+	conn *pgxpool.Conn
+}
+
+func (c *postgresMigrationConn) createTable(ctx context.Context) error {
+	return c.exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum VARCHAR(64) NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		)
+	`)
+}
+
+func (c *postgresMigrationConn) applied(ctx context.Context) (map[int64]appliedMigration, error) {
+	rows, err := c.conn.Query(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	done := make(map[int64]appliedMigration)
+	for rows.Next() {
+		var version int64
+		var applied appliedMigration
+		if err := rows.Scan(&version, &applied.Name, &applied.Checksum, &applied.AppliedAt); err != nil {
+			return nil, err
+		}
+		done[version] = applied
+	}
+	return done, rows.Err()
+}
+
+func (c *postgresMigrationConn) exec(ctx context.Context, sql string, args ...interface{}) error {
+	_, err := c.conn.Exec(ctx, sql, args...)
+	return err
+}
+
+func (c *postgresMigrationConn) inTx(ctx context.Context, fn func(exec func(sql string, args ...interface{}) error) error) error {
+	tx, err := c.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = fn(func(sql string, args ...interface{}) error {
+		_, err := tx.Exec(ctx, sql, args...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+type sqliteMigrationConn struct {
+	conn *sql.Conn
+}
+
+func (c *sqliteMigrationConn) createTable(ctx context.Context) error {
+	return c.exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+}
+
+func (c *sqliteMigrationConn) applied(ctx context.Context) (map[int64]appliedMigration, error) {
+	rows, err := c.conn.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	done := make(map[int64]appliedMigration)
+	for rows.Next() {
+		var version int64
+		var applied appliedMigration
+		if err := rows.Scan(&version, &applied.Name, &applied.Checksum, &applied.AppliedAt); err != nil {
+			return nil, err
+		}
+		done[version] = applied
+	}
+	return done, rows.Err()
+}
+
+func (c *sqliteMigrationConn) exec(ctx context.Context, sql string, args ...interface{}) error {
+	_, err := c.conn.ExecContext(ctx, sql, args...)
+	return err
+}
+
+func (c *sqliteMigrationConn) inTx(ctx context.Context, fn func(exec func(sql string, args ...interface{}) error) error) error {
+	tx, err := c.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = fn(func(sql string, args ...interface{}) error {
+		_, err := tx.ExecContext(ctx, sql, args...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,198 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/tracing"
+)
+
+// sqliteOptions enforce foreign keys, let readers work alongside the writer,
+// wait for locks instead of failing, and take the write lock when a
+// transaction begins so read-then-write transactions cannot deadlock
+const sqliteOptions = "_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)" +
+	"&_time_format=sqlite&_txlock=immediate"
+
+// SQLite wraps a SQLite database. Times are stored as text, which only
+// compares correctly in one time zone, so time arguments are converted to UTC.
+type SQLite struct {
+	*sql.DB
+}
+
+// SQLiteTx is a transaction on a SQLite database
+type SQLiteTx struct {
+	*sql.Tx
+}
+
+// Row is a single row returned by QueryRowContext, or the current row of a
+// *sql.Rows
+type Row interface {
+	Scan(dest ...interface{}) error
+}
+
+// OpenSQLite opens the database file at path, creating it if needed. A path of
+// ":memory:" opens a private in-memory database.
+func OpenSQLite(path string) (*SQLite, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?"+sqliteOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if path == ":memory:" {
+		// Every connection would get its own empty database
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	return &SQLite{DB: db}, nil
+}
+
+// ExecContext executes a query without returning rows
+func (db *SQLite) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := tracing.StartQuery(ctx, "sqlite", query)
+	result, err := db.DB.ExecContext(ctx, query, utcArgs(args)...)
+	tracing.End(span, err)
+	return result, err
+}
+
+// QueryContext executes a query that returns rows
+func (db *SQLite) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := tracing.StartQuery(ctx, "sqlite", query)
+	rows, err := db.DB.QueryContext(ctx, query, utcArgs(args)...)
+	tracing.End(span, err)
+	return rows, err
+}
+
+// QueryRowContext executes a query that returns at most one row
+func (db *SQLite) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := tracing.StartQuery(ctx, "sqlite", query)
+	row := db.DB.QueryRowContext(ctx, query, utcArgs(args)...)
+	tracing.End(span, row.Err())
+	return row
+}
+
+// Begin starts a transaction. It holds the database write lock until it ends.
+func (db *SQLite) Begin(ctx context.Context) (*SQLiteTx, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteTx{Tx: tx}, nil
+}
+
+// ExecContext executes a query without returning rows
+func (tx *SQLiteTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.ExecContext(ctx, query, utcArgs(args)...)
+}
+
+// QueryContext executes a query that returns rows
+func (tx *SQLiteTx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.QueryContext(ctx, query, utcArgs(args)...)
+}
+
+// QueryRowContext executes a query that returns at most one row
+func (tx *SQLiteTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRowContext(ctx, query, utcArgs(args)...)
+}
+
+func utcArgs(args []interface{}) []interface{} {
+	converted := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case time.Time:
+			converted[i] = v.UTC()
+		case *time.Time:
+			if v != nil {
+				converted[i] = v.UTC()
+			}
+		default:
+			converted[i] = arg
+		}
+	}
+	return converted
+}
+
+// StringList stores a string slice as a JSON array, SQLite having no array type
+type StringList []string
+
+// Value implements driver.Valuer. A nil list is stored as an empty array.
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]string(l))
+	return string(data), err
+}
+
+// Scan implements sql.Scanner. NULL scans as a nil list.
+func (l *StringList) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), (*[]string)(l))
+	case []byte:
+		return json.Unmarshal(v, (*[]string)(l))
+	default:
+		return fmt.Errorf("cannot scan %T into a string list", src)
+	}
+}
+
+// JSON stores V as JSON text. As an argument it is encoded; as a scan
+// destination V must be a pointer, which NULL leaves unchanged.
+type JSON struct {
+	V interface{}
+}
+
+// Value implements driver.Valuer
+func (j JSON) Value() (driver.Value, error) {
+	data, err := json.Marshal(j.V)
+	return string(data), err
+}
+
+// Scan implements sql.Scanner
+func (j JSON) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), j.V)
+	case []byte:
+		return json.Unmarshal(v, j.V)
+	default:
+		return fmt.Errorf("cannot scan %T as JSON", src)
+	}
+}
+
+// IsUniqueViolation reports whether a SQLite statement failed on a unique or
+// primary key constraint
+func IsUniqueViolation(err error) bool {
+	code := sqliteErrorCode(err)
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+// IsForeignKeyViolation reports whether a SQLite statement failed on a
+// foreign key constraint
+func IsForeignKeyViolation(err error) bool {
+	return sqliteErrorCode(err) == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY
+}
+
+func sqliteErrorCode(err error) int {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code()
+	}
+	return 0
+}
@@ -0,0 +1,58 @@
+package heartbeats
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/licensing"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// Controls answers heartbeats with the control operators set for their
+// instance. Few instances have one, so every control is loaded at once and
+// kept for the TTL rather than looked up per heartbeat.
+type Controls struct {
+	repo licensing.InstanceRepository
+	ttl  time.Duration
+
+	mu       sync.Mutex
+	controls map[string]types.InstanceControl
+	expires  time.Time
+}
+
+// NewControls creates the control lookup for db. A ttl of 0 reloads the
+// controls for every heartbeat.
+func NewControls(db *database.DB, ttl time.Duration) *Controls {
+	return &Controls{repo: licensing.NewInstanceRepository(db), ttl: ttl}
+}
+
+// Get returns the control of the instance with instanceID. If the controls
+// cannot be loaded the last ones loaded are used.
+func (c *Controls) Get(ctx context.Context, instanceID string) types.InstanceControl {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.controls == nil || !time.Now().Before(c.expires) {
+		controls, err := c.repo.ListControls(ctx)
+		if err != nil {
+			log.Printf("Failed to load instance controls: %v", err)
+		} else {
+			c.controls = controls
+		}
+		// Also after a failure, so an unavailable database is not hit per heartbeat
+		c.expires = time.Now().Add(c.ttl)
+	}
+
+	return c.controls[instanceID]
+}
+
+// Invalidate makes the next Get reload the controls
+func (c *Controls) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expires = time.Time{}
+}
@@ -0,0 +1,84 @@
+package heartbeats
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/licensing"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// Keys authenticates updaters by the API key their instance was activated
+// with. Instances found are kept for the TTL so heartbeats do not look up
+// their key every time; a key replaced by a new activation keeps working
+// until then. Unknown keys are not kept.
+type Keys struct {
+	repo licensing.InstanceRepository
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]keyEntry
+	swept   time.Time
+}
+
+type keyEntry struct {
+	instance *types.Instance
+	expires  time.Time
+}
+
+// NewKeys creates the API key lookup for db. A ttl of 0 looks up every key.
+func NewKeys(db *database.DB, ttl time.Duration) *Keys {
+	return &Keys{
+		repo:    licensing.NewInstanceRepository(db),
+		ttl:     ttl,
+		entries: make(map[string]keyEntry),
+	}
+}
+
+// Instance returns the instance with API key apiKey, or nil if there is none
+func (k *Keys) Instance(ctx context.Context, apiKey string) (*types.Instance, error) {
+	hash := licensing.HashAPIKey(apiKey)
+	now := time.Now()
+
+	k.mu.Lock()
+	entry, ok := k.entries[hash]
+	k.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.instance, nil
+	}
+
+	instance, err := k.repo.GetByAPIKeyHash(ctx, hash)
+	if err != nil || instance == nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	// Drop expired keys once per TTL, so the map is bounded by the instances
+	// seen within it
+	if now.Sub(k.swept) >= k.ttl {
+		for h, e := range k.entries {
+			if !now.Before(e.expires) {
+				delete(k.entries, h)
+			}
+		}
+		k.swept = now
+	}
+	k.entries[hash] = keyEntry{instance: instance, expires: now.Add(k.ttl)}
+	return instance, nil
+}
+
+// Forget drops the cached key of the instance with ID id, so a deleted
+// instance stops authenticating at once
+func (k *Keys) Forget(id string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for h, e := range k.entries {
+		if e.instance.ID == id {
+			delete(k.entries, h)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package heartbeats
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/licensing"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/metrics"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// ErrQueueFull is returned by Enqueue when heartbeats arrive faster than they
+// can be written; the updater should retry later
+var ErrQueueFull = errors.New("heartbeat queue is full")
+
+// flushTimeout bounds a single batch write, including the final one at shutdown
+const flushTimeout = 30 * time.Second
+
+// Pipeline records heartbeats asynchronously. Heartbeats wait in a bounded
+// queue and are written in batches, so the database sees one statement per
+// batch instead of one per heartbeat. Every heartbeat is also added to the
+// heartbeat history.
+type Pipeline struct {
+	repo          licensing.InstanceRepository
+	queue         chan licensing.HeartbeatUpdate
+	batchSize     int
+	flushInterval time.Duration
+	interval      time.Duration
+	maxInterval   time.Duration
+	metrics       *metrics.Metrics
+}
+
+// NewPipeline creates a pipeline writing to db. Nothing is written until Run
+// is started.
+func NewPipeline(db *database.DB, cfg config.HeartbeatConfig, m *metrics.Metrics) *Pipeline {
+	p := &Pipeline{
+		repo:          licensing.NewInstanceRepository(db),
+		queue:         make(chan licensing.HeartbeatUpdate, cfg.QueueSize),
+		batchSize:     cfg.BatchSize,
+		flushInterval: cfg.FlushInterval,
+		interval:      cfg.Interval,
+		maxInterval:   cfg.MaxInterval,
+		metrics:       m,
+	}
+	m.TrackHeartbeatQueue(p.Len)
+	return p
+}
+
+// Enqueue queues a heartbeat received now, without waiting. It returns
+// ErrQueueFull when the queue has no room.
+func (p *Pipeline) Enqueue(heartbeat *types.Heartbeat) error {
+	select {
+	case p.queue <- licensing.HeartbeatUpdate{Heartbeat: heartbeat, ReceivedAt: time.Now()}:
+		return nil
+	default:
+		p.metrics.ObserveHeartbeats(metrics.HeartbeatRejected, 1)
+		return ErrQueueFull
+	}
+}
+
+// Len returns the number of heartbeats waiting to be written
+func (p *Pipeline) Len() int {
+	return len(p.queue)
+}
+
+// Busy reports whether the queue is more than half full, when heartbeats that
+// can wait, such as replays, should be turned away
+func (p *Pipeline) Busy() bool {
+	return len(p.queue) > cap(p.queue)/2
+}
+
+// Replay records heartbeats an updater could not deliver when they were
+// sent, at their original times, and returns how many belonged to known
+// instances. They are written at once rather than queued: the updater keeps
+// them until this succeeds.
+func (p *Pipeline) Replay(ctx context.Context, heartbeats []types.Heartbeat) (int, error) {
+	if len(heartbeats) == 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	updates := make([]licensing.HeartbeatUpdate, len(heartbeats))
+	for i := range heartbeats {
+		updates[i] = licensing.HeartbeatUpdate{Heartbeat: &heartbeats[i], ReceivedAt: ReplayTime(heartbeats[i].Timestamp, now)}
+	}
+
+	if err := p.repo.UpdateHeartbeats(ctx, latestPerInstance(updates)); err != nil {
+		return 0, err
+	}
+	recorded, err := p.repo.RecordHistory(ctx, updates)
+	if err != nil {
+		return 0, err
+	}
+
+	p.metrics.ObserveHeartbeats(metrics.HeartbeatReplayed, recorded)
+	return recorded, nil
+}
+
+// ReplayTime returns the time to record a replayed heartbeat or alert at: the
+// time the updater gave, unless it is missing or in the future
+func ReplayTime(t, now time.Time) time.Time {
+	if t.IsZero() || t.After(now) {
+		return now
+	}
+	return t
+}
+
+// NextHeartbeatIn returns how long updaters should wait before their next
+// heartbeat. It is the configured interval until the queue is half full, then
+// grows with the queue up to the maximum interval, slowing the fleet down
+// before heartbeats have to be turned away.
+func (p *Pipeline) NextHeartbeatIn() time.Duration {
+	fill := float64(len(p.queue)) / float64(cap(p.queue))
+	if fill <= 0.5 {
+		return p.interval
+	}
+	return p.interval + time.Duration((fill-0.5)*2*float64(p.maxInterval-p.interval))
+}
+
+// Run writes queued heartbeats until ctx is cancelled, whenever a batch fills
+// or flushInterval passes. It then writes what is still queued and returns,
+// so stop accepting heartbeats before cancelling ctx.
+func (p *Pipeline) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]licensing.HeartbeatUpdate, 0, p.batchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case update := <-p.queue:
+					batch = append(batch, update)
+					if len(batch) == p.batchSize {
+						batch = p.flush(batch)
+					}
+				default:
+					p.flush(batch)
+					return
+				}
+			}
+		case update := <-p.queue:
+			batch = append(batch, update)
+			if len(batch) == p.batchSize {
+				batch = p.flush(batch)
+			}
+		case <-ticker.C:
+			batch = p.flush(batch)
+		}
+	}
+}
+
+// flush writes a batch and returns it emptied for reuse
+func (p *Pipeline) flush(batch []licensing.HeartbeatUpdate) []licensing.HeartbeatUpdate {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	// Not the Run context, which is cancelled before the final flush
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+
+	err := p.repo.UpdateHeartbeats(ctx, latestPerInstance(batch))
+	if err == nil {
+		_, err = p.repo.RecordHistory(ctx, batch)
+	}
+	if err != nil {
+		log.Printf("Failed to record %d heartbeats: %v", len(batch), err)
+		p.metrics.ObserveHeartbeats(metrics.HeartbeatError, len(batch))
+	} else {
+		p.metrics.ObserveHeartbeats(metrics.HeartbeatOK, len(batch))
+	}
+
+	return batch[:0]
+}
+
+// latestPerInstance returns the newest heartbeat of each instance in updates,
+// which are in the order they were received. A statement updating an instance
+// twice would apply either heartbeat.
+func latestPerInstance(updates []licensing.HeartbeatUpdate) []licensing.HeartbeatUpdate {
+	latest := make(map[string]int, len(updates))
+	result := make([]licensing.HeartbeatUpdate, 0, len(updates))
+	for _, update := range updates {
+		if i, ok := latest[update.Heartbeat.InstanceID]; ok {
+			if !update.ReceivedAt.Before(result[i].ReceivedAt) {
+				result[i] = update
+			}
+			continue
+		}
+		latest[update.Heartbeat.InstanceID] = len(result)
+		result = append(result, update)
+	}
+	return result
+}
@@ -0,0 +1,129 @@
+package heartbeats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database/dbtest"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/licensing"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// createInstances registers instances inst-0 to inst-<n-1>
+func createInstances(tb testing.TB, db *database.DB, n int) {
+	tb.Helper()
+	repo := licensing.NewInstanceRepository(db)
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("inst-%d", i)
+		instance := &types.Instance{InstanceID: id, InstanceType: "siemcore", Hostname: id, Status: "online"}
+		if err := repo.Create(context.Background(), instance); err != nil {
+			tb.Fatalf("create instance: %v", err)
+		}
+	}
+}
+
+// heartbeat returns a heartbeat of the instance reporting version
+func heartbeat(instanceID, version string) *types.Heartbeat {
+	return &types.Heartbeat{
+		InstanceID: instanceID,
+		Timestamp:  time.Now(),
+		Products:   []types.ProductStatus{{Name: "siemcore", Version: version}},
+	}
+}
+
+// start runs the pipeline and returns a function that stops it once
+// everything queued is written
+func start(p *Pipeline) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Run(ctx)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		ctx := context.Background()
+		createInstances(t, db, 2)
+		p := NewPipeline(db, config.HeartbeatConfig{QueueSize: 4, BatchSize: 2, FlushInterval: time.Hour}, nil)
+
+		for _, hb := range []*types.Heartbeat{
+			heartbeat("inst-0", "1.0.0"),
+			heartbeat("inst-1", "1.0.0"),
+			heartbeat("inst-0", "1.1.0"),
+			heartbeat("inst-unknown", "1.0.0"),
+		} {
+			if err := p.Enqueue(hb); err != nil {
+				t.Fatalf("Enqueue: %v", err)
+			}
+		}
+		if err := p.Enqueue(heartbeat("inst-1", "1.1.0")); !errors.Is(err, ErrQueueFull) {
+			t.Errorf("Enqueue(full) = %v, want ErrQueueFull", err)
+		}
+
+		// The final flush writes what is left when the pipeline stops
+		start(p)()
+
+		counts, err := licensing.NewInstanceRepository(db).CountVersions(ctx)
+		if err != nil {
+			t.Fatalf("CountVersions: %v", err)
+		}
+		want := map[string]int{"1.0.0": 1, "1.1.0": 1}
+		if len(counts) != len(want) {
+			t.Fatalf("CountVersions = %+v, want %v", counts, want)
+		}
+		for _, count := range counts {
+			if count.Instances != want[count.Version] {
+				t.Errorf("instances on %s = %d, want %d", count.Version, count.Instances, want[count.Version])
+			}
+		}
+	})
+}
+
+// BenchmarkHeartbeatPipeline measures how many heartbeats a second the pipeline
+// writes, from Enqueue until they are in the database, at several batch sizes
+func BenchmarkHeartbeatPipeline(b *testing.B) {
+	const instances = 1000
+
+	dbtest.RunBenchmark(b, func(b *testing.B, db *database.DB) {
+		createInstances(b, db, instances)
+		heartbeats := make([]*types.Heartbeat, instances)
+		for i := range heartbeats {
+			heartbeats[i] = heartbeat(fmt.Sprintf("inst-%d", i), "1.0.0")
+		}
+
+		for _, batchSize := range []int{1, 100, 500} {
+			b.Run(fmt.Sprintf("batch=%d", batchSize), func(b *testing.B) {
+				p := NewPipeline(db, config.HeartbeatConfig{
+					QueueSize:     10000,
+					BatchSize:     batchSize,
+					FlushInterval: 100 * time.Millisecond,
+				}, nil)
+
+				b.ResetTimer()
+				stop := start(p)
+				for i := 0; i < b.N; i++ {
+					// Wait for room rather than measure rejections
+					for p.Enqueue(heartbeats[i%instances]) != nil {
+						runtime.Gosched()
+					}
+				}
+				stop()
+				b.StopTimer()
+
+				b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "heartbeats/s")
+			})
+		}
+	})
+}
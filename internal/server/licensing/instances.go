@@ -6,216 +6,113 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5"
-
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
 	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
 )
 
+const instanceFrom = `instances i LEFT JOIN licenses l ON l.id = i.license_id`
+
 // InstanceRepository handles instance database operations
-type InstanceRepository struct {
-	db *database.DB
+type InstanceRepository interface {
+	// Create creates a new instance
+	Create(ctx context.Context, instance *types.Instance) error
+	// GetByID retrieves an instance by ID, or nil if there is none
+	GetByID(ctx context.Context, id string) (*types.Instance, error)
+	// GetByInstanceID retrieves an instance by instance_id, or nil if there is none
+	GetByInstanceID(ctx context.Context, instanceID string) (*types.Instance, error)
+	// GetByAPIKeyHash retrieves an instance by API key hash, or nil if there is none
+	GetByAPIKeyHash(ctx context.Context, apiKeyHash string) (*types.Instance, error)
+	// List retrieves instances, limited to the organizations in scope unless scope is nil
+	List(ctx context.Context, scope []string) ([]types.Instance, error)
+	// Update updates an instance
+	Update(ctx context.Context, instance *types.Instance) error
+	// UpdateHeartbeat updates the last heartbeat for an instance
+	UpdateHeartbeat(ctx context.Context, instanceID string, heartbeat *types.Heartbeat) error
+	// UpdateHeartbeats records a batch of heartbeats at once. A heartbeat older
+	// than the one already recorded for its instance is skipped.
+	UpdateHeartbeats(ctx context.Context, updates []HeartbeatUpdate) error
+	// RecordHistory adds heartbeats to the heartbeat history at the time they
+	// were received, returning how many belonged to known instances
+	RecordHistory(ctx context.Context, updates []HeartbeatUpdate) (int, error)
+	// PruneHistory deletes heartbeat history and alerts from before cutoff
+	PruneHistory(ctx context.Context, cutoff time.Time) (int64, error)
+	// CreateAlerts stores alerts raised by updaters, returning how many
+	// belonged to known instances
+	CreateAlerts(ctx context.Context, alerts []types.InstanceAlert) (int, error)
+	// ListAlerts retrieves the most recent alerts of an instance by ID
+	ListAlerts(ctx context.Context, id string, limit int) ([]types.InstanceAlert, error)
+	// GetControl retrieves the control of an instance by ID
+	GetControl(ctx context.Context, id string) (*types.InstanceControl, error)
+	// SetControl replaces the control of an instance by ID
+	SetControl(ctx context.Context, id string, control *types.InstanceControl) error
+	// ListControls retrieves the controls of every instance that has one, by
+	// instance_id
+	ListControls(ctx context.Context) (map[string]types.InstanceControl, error)
+	// Delete deletes an instance
+	Delete(ctx context.Context, id string) error
+	// UpdateOfflineInstances marks instances as offline if no heartbeat in threshold
+	UpdateOfflineInstances(ctx context.Context, threshold time.Duration) error
+	// CountByStatus counts instances by status
+	CountByStatus(ctx context.Context) (map[string]int, error)
+	// CountVersions counts the instances running each product version, as
+	// reported by their last heartbeat
+	CountVersions(ctx context.Context) ([]VersionCount, error)
 }
 
-// NewInstanceRepository creates a new instance repository
-func NewInstanceRepository(db *database.DB) *InstanceRepository {
-	return &InstanceRepository{db: db}
+// HeartbeatUpdate is a heartbeat and when it was received
+type HeartbeatUpdate struct {
+	Heartbeat  *types.Heartbeat
+	ReceivedAt time.Time
 }
 
-// Create creates a new instance
-func (r *InstanceRepository) Create(ctx context.Context, instance *types.Instance) error {
-	instance.ID = uuid.New().String()
-	instance.CreatedAt = time.Now()
-	instance.UpdatedAt = time.Now()
-
-	_, err := r.db.Pool.Exec(ctx, `
-		INSERT INTO instances (id, instance_id, instance_type, hostname, license_id, api_key_hash, status, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-	`, instance.ID, instance.InstanceID, instance.InstanceType, instance.Hostname,
-		instance.LicenseID, instance.APIKeyHash, instance.Status, instance.CreatedAt, instance.UpdatedAt)
-
-	return err
+// VersionCount is the number of instances running a product version
+type VersionCount struct {
+	Product   string
+	Version   string
+	Instances int
 }
 
-// GetByID retrieves an instance by ID
-func (r *InstanceRepository) GetByID(ctx context.Context, id string) (*types.Instance, error) {
-	var instance types.Instance
-	var lastHeartbeatData []byte
-
-	err := r.db.Pool.QueryRow(ctx, `
-		SELECT id, instance_id, instance_type, hostname, license_id, api_key_hash, last_heartbeat, last_heartbeat_data, status, created_at, updated_at
-		FROM instances
-		WHERE id = $1
-	`, id).Scan(
-		&instance.ID, &instance.InstanceID, &instance.InstanceType, &instance.Hostname,
-		&instance.LicenseID, &instance.APIKeyHash, &instance.LastHeartbeat, &lastHeartbeatData,
-		&instance.Status, &instance.CreatedAt, &instance.UpdatedAt)
-
-	if err == pgx.ErrNoRows {
-		return nil, nil
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to get instance: %w", err)
-	}
-
-	if lastHeartbeatData != nil {
-		var heartbeat types.Heartbeat
-		if err := json.Unmarshal(lastHeartbeatData, &heartbeat); err == nil {
-			instance.LastHeartbeatData = &heartbeat
-		}
+// NewInstanceRepository creates an instance repository for the configured database
+func NewInstanceRepository(db *database.DB) InstanceRepository {
+	if db.Driver == database.DriverSQLite {
+		return NewSQLiteInstanceRepository(db)
 	}
-
-	return &instance, nil
+	return NewPostgresInstanceRepository(db)
 }
 
-// GetByInstanceID retrieves an instance by instance_id
-func (r *InstanceRepository) GetByInstanceID(ctx context.Context, instanceID string) (*types.Instance, error) {
-	var instance types.Instance
-	var lastHeartbeatData []byte
-
-	err := r.db.Pool.QueryRow(ctx, `
-		SELECT id, instance_id, instance_type, hostname, license_id, api_key_hash, last_heartbeat, last_heartbeat_data, status, created_at, updated_at
-		FROM instances
-		WHERE instance_id = $1
-	`, instanceID).Scan(
-		&instance.ID, &instance.InstanceID, &instance.InstanceType, &instance.Hostname,
-		&instance.LicenseID, &instance.APIKeyHash, &instance.LastHeartbeat, &lastHeartbeatData,
-		&instance.Status, &instance.CreatedAt, &instance.UpdatedAt)
-
-	if err == pgx.ErrNoRows {
-		return nil, nil
+// encodeControl returns the desired_versions and updater_config column values
+// of a control; updater_config is nil when it holds no settings
+func encodeControl(control *types.InstanceControl) (desired, config []byte, err error) {
+	desiredVersions := control.DesiredVersions
+	if desiredVersions == nil {
+		desiredVersions = map[string]string{}
 	}
+	desired, err = json.Marshal(desiredVersions)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get instance: %w", err)
+		return nil, nil, fmt.Errorf("failed to marshal desired versions: %w", err)
 	}
-
-	if lastHeartbeatData != nil {
-		var heartbeat types.Heartbeat
-		if err := json.Unmarshal(lastHeartbeatData, &heartbeat); err == nil {
-			instance.LastHeartbeatData = &heartbeat
+	if control.Config.Hash() != "" {
+		config, err = json.Marshal(control.Config)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal updater config: %w", err)
 		}
 	}
-
-	return &instance, nil
+	return desired, config, nil
 }
 
-// GetByAPIKeyHash retrieves an instance by API key hash
-func (r *InstanceRepository) GetByAPIKeyHash(ctx context.Context, apiKeyHash string) (*types.Instance, error) {
-	var instance types.Instance
-	var lastHeartbeatData []byte
-
-	err := r.db.Pool.QueryRow(ctx, `
-		SELECT id, instance_id, instance_type, hostname, license_id, api_key_hash, last_heartbeat, last_heartbeat_data, status, created_at, updated_at
-		FROM instances
-		WHERE api_key_hash = $1
-	`, apiKeyHash).Scan(
-		&instance.ID, &instance.InstanceID, &instance.InstanceType, &instance.Hostname,
-		&instance.LicenseID, &instance.APIKeyHash, &instance.LastHeartbeat, &lastHeartbeatData,
-		&instance.Status, &instance.CreatedAt, &instance.UpdatedAt)
-
-	if err == pgx.ErrNoRows {
-		return nil, nil
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to get instance: %w", err)
-	}
-
-	if lastHeartbeatData != nil {
-		var heartbeat types.Heartbeat
-		if err := json.Unmarshal(lastHeartbeatData, &heartbeat); err == nil {
-			instance.LastHeartbeatData = &heartbeat
+// decodeControl is the reverse of encodeControl
+func decodeControl(desired, config []byte) (*types.InstanceControl, error) {
+	control := &types.InstanceControl{DesiredVersions: map[string]string{}}
+	if len(desired) > 0 {
+		if err := json.Unmarshal(desired, &control.DesiredVersions); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal desired versions: %w", err)
 		}
 	}
-
-	return &instance, nil
-}
-
-// List retrieves all instances
-func (r *InstanceRepository) List(ctx context.Context) ([]types.Instance, error) {
-	rows, err := r.db.Pool.Query(ctx, `
-		SELECT id, instance_id, instance_type, hostname, license_id, api_key_hash, last_heartbeat, last_heartbeat_data, status, created_at, updated_at
-		FROM instances
-		ORDER BY created_at DESC
-	`)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list instances: %w", err)
-	}
-	defer rows.Close()
-
-	var instances []types.Instance
-	for rows.Next() {
-		var instance types.Instance
-		var lastHeartbeatData []byte
-
-		err := rows.Scan(
-			&instance.ID, &instance.InstanceID, &instance.InstanceType, &instance.Hostname,
-			&instance.LicenseID, &instance.APIKeyHash, &instance.LastHeartbeat, &lastHeartbeatData,
-			&instance.Status, &instance.CreatedAt, &instance.UpdatedAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan instance: %w", err)
+	if len(config) > 0 {
+		control.Config = &types.UpdaterConfig{}
+		if err := json.Unmarshal(config, control.Config); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal updater config: %w", err)
 		}
-
-		if lastHeartbeatData != nil {
-			var heartbeat types.Heartbeat
-			if err := json.Unmarshal(lastHeartbeatData, &heartbeat); err == nil {
-				instance.LastHeartbeatData = &heartbeat
-			}
-		}
-
-		instances = append(instances, instance)
-	}
-
-	return instances, nil
-}
-
-// Update updates an instance
-func (r *InstanceRepository) Update(ctx context.Context, instance *types.Instance) error {
-	instance.UpdatedAt = time.Now()
-
-	_, err := r.db.Pool.Exec(ctx, `
-		UPDATE instances
-		SET hostname = $2, api_key_hash = $3, status = $4, updated_at = $5
-		WHERE id = $1
-	`, instance.ID, instance.Hostname, instance.APIKeyHash, instance.Status, instance.UpdatedAt)
-
-	return err
-}
-
-// UpdateHeartbeat updates the last heartbeat for an instance
-func (r *InstanceRepository) UpdateHeartbeat(ctx context.Context, instanceID string, heartbeat *types.Heartbeat) error {
-	heartbeatData, err := json.Marshal(heartbeat)
-	if err != nil {
-		return fmt.Errorf("failed to marshal heartbeat: %w", err)
 	}
-
-	now := time.Now()
-
-	_, err = r.db.Pool.Exec(ctx, `
-		UPDATE instances
-		SET last_heartbeat = $2, last_heartbeat_data = $3, status = 'online', updated_at = $4
-		WHERE instance_id = $1
-	`, instanceID, now, heartbeatData, now)
-
-	return err
+	return control, nil
 }
-
-// Delete deletes an instance
-func (r *InstanceRepository) Delete(ctx context.Context, id string) error {
-	_, err := r.db.Pool.Exec(ctx, `DELETE FROM instances WHERE id = $1`, id)
-	return err
-}
-
-// UpdateOfflineInstances marks instances as offline if no heartbeat in threshold
-func (r *InstanceRepository) UpdateOfflineInstances(ctx context.Context, threshold time.Duration) error {
-	cutoff := time.Now().Add(-threshold)
-
-	_, err := r.db.Pool.Exec(ctx, `
-		UPDATE instances
-		SET status = 'offline', updated_at = NOW()
-		WHERE last_heartbeat < $1 AND status = 'online'
-	`, cutoff)
-
-	return err
-}
-
@@ -0,0 +1,431 @@
+package licensing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// PostgresInstanceRepository stores instances in PostgreSQL
+type PostgresInstanceRepository struct {
+	db *database.DB
+}
+
+// NewPostgresInstanceRepository creates a repository backed by PostgreSQL
+func NewPostgresInstanceRepository(db *database.DB) *PostgresInstanceRepository {
+	return &PostgresInstanceRepository{db: db}
+}
+
+// Instances belong to the organization that owns their license
+const instanceColumns = `i.id, i.instance_id, i.instance_type, i.hostname, COALESCE(i.license_id::text, ''),
+	COALESCE(l.organization_id::text, ''), i.api_key_hash, i.last_heartbeat, i.last_heartbeat_data, i.status,
+	i.created_at, i.updated_at`
+
+func scanInstance(row pgx.Row) (*types.Instance, error) {
+	var instance types.Instance
+	var lastHeartbeatData []byte
+
+	err := row.Scan(
+		&instance.ID, &instance.InstanceID, &instance.InstanceType, &instance.Hostname,
+		&instance.LicenseID, &instance.OrganizationID, &instance.APIKeyHash, &instance.LastHeartbeat,
+		&lastHeartbeatData, &instance.Status, &instance.CreatedAt, &instance.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if lastHeartbeatData != nil {
+		var heartbeat types.Heartbeat
+		if err := json.Unmarshal(lastHeartbeatData, &heartbeat); err == nil {
+			instance.LastHeartbeatData = &heartbeat
+		}
+	}
+
+	return &instance, nil
+}
+
+// Create creates a new instance
+func (r *PostgresInstanceRepository) Create(ctx context.Context, instance *types.Instance) error {
+	instance.ID = uuid.New().String()
+	instance.CreatedAt = time.Now()
+	instance.UpdatedAt = time.Now()
+
+	_, err := r.db.Pool.Exec(ctx, `
+		INSERT INTO instances (id, instance_id, instance_type, hostname, license_id, api_key_hash, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, instance.ID, instance.InstanceID, instance.InstanceType, instance.Hostname,
+		instance.LicenseID, instance.APIKeyHash, instance.Status, instance.CreatedAt, instance.UpdatedAt)
+
+	return err
+}
+
+// GetByID retrieves an instance by ID
+func (r *PostgresInstanceRepository) GetByID(ctx context.Context, id string) (*types.Instance, error) {
+	instance, err := scanInstance(r.db.Pool.QueryRow(ctx, `
+		SELECT `+instanceColumns+`
+		FROM `+instanceFrom+`
+		WHERE i.id = $1
+	`, id))
+
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get instance: %w", err)
+	}
+
+	return instance, nil
+}
+
+// GetByInstanceID retrieves an instance by instance_id
+func (r *PostgresInstanceRepository) GetByInstanceID(ctx context.Context, instanceID string) (*types.Instance, error) {
+	instance, err := scanInstance(r.db.Pool.QueryRow(ctx, `
+		SELECT `+instanceColumns+`
+		FROM `+instanceFrom+`
+		WHERE i.instance_id = $1
+	`, instanceID))
+
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get instance: %w", err)
+	}
+
+	return instance, nil
+}
+
+// GetByAPIKeyHash retrieves an instance by API key hash
+func (r *PostgresInstanceRepository) GetByAPIKeyHash(ctx context.Context, apiKeyHash string) (*types.Instance, error) {
+	instance, err := scanInstance(r.db.Pool.QueryRow(ctx, `
+		SELECT `+instanceColumns+`
+		FROM `+instanceFrom+`
+		WHERE i.api_key_hash = $1
+	`, apiKeyHash))
+
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get instance: %w", err)
+	}
+
+	return instance, nil
+}
+
+// List retrieves instances, limited to the organizations in scope unless scope is nil
+func (r *PostgresInstanceRepository) List(ctx context.Context, scope []string) ([]types.Instance, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT `+instanceColumns+`
+		FROM `+instanceFrom+`
+		WHERE $1::text[] IS NULL OR l.organization_id::text = ANY($1)
+		ORDER BY i.created_at DESC
+	`, scope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instances: %w", err)
+	}
+	defer rows.Close()
+
+	var instances []types.Instance
+	for rows.Next() {
+		instance, err := scanInstance(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan instance: %w", err)
+		}
+		instances = append(instances, *instance)
+	}
+
+	return instances, nil
+}
+
+// Update updates an instance
+func (r *PostgresInstanceRepository) Update(ctx context.Context, instance *types.Instance) error {
+	instance.UpdatedAt = time.Now()
+
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE instances
+		SET hostname = $2, api_key_hash = $3, status = $4, updated_at = $5
+		WHERE id = $1
+	`, instance.ID, instance.Hostname, instance.APIKeyHash, instance.Status, instance.UpdatedAt)
+
+	return err
+}
+
+// UpdateHeartbeat updates the last heartbeat for an instance
+func (r *PostgresInstanceRepository) UpdateHeartbeat(ctx context.Context, instanceID string, heartbeat *types.Heartbeat) error {
+	heartbeatData, err := json.Marshal(heartbeat)
+	if err != nil {
+		return fmt.Errorf("failed to marshal heartbeat: %w", err)
+	}
+
+	now := time.Now()
+
+	_, err = r.db.Pool.Exec(ctx, `
+		UPDATE instances
+		SET last_heartbeat = $2, last_heartbeat_data = $3, status = 'online', updated_at = $4
+		WHERE instance_id = $1
+	`, instanceID, now, heartbeatData, now)
+
+	return err
+}
+
+// heartbeatArrays splits heartbeats into the instance ID, received time and
+// JSON arrays passed to unnest
+func heartbeatArrays(updates []HeartbeatUpdate) (instanceIDs []string, receivedAt []time.Time, data []string, err error) {
+	instanceIDs = make([]string, len(updates))
+	receivedAt = make([]time.Time, len(updates))
+	data = make([]string, len(updates))
+	for i, update := range updates {
+		heartbeatData, err := json.Marshal(update.Heartbeat)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to marshal heartbeat: %w", err)
+		}
+		instanceIDs[i] = update.Heartbeat.InstanceID
+		receivedAt[i] = update.ReceivedAt
+		data[i] = string(heartbeatData)
+	}
+	return instanceIDs, receivedAt, data, nil
+}
+
+// UpdateHeartbeats records a batch of heartbeats in one statement
+func (r *PostgresInstanceRepository) UpdateHeartbeats(ctx context.Context, updates []HeartbeatUpdate) error {
+	instanceIDs, receivedAt, data, err := heartbeatArrays(updates)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Pool.Exec(ctx, `
+		UPDATE instances i
+		SET last_heartbeat = h.received_at, last_heartbeat_data = h.data::jsonb, status = 'online', updated_at = NOW()
+		FROM unnest($1::text[], $2::timestamptz[], $3::text[]) AS h(instance_id, received_at, data)
+		WHERE i.instance_id = h.instance_id
+		  AND (i.last_heartbeat IS NULL OR i.last_heartbeat <= h.received_at)
+	`, instanceIDs, receivedAt, data)
+	if err != nil {
+		return fmt.Errorf("failed to record heartbeats: %w", err)
+	}
+
+	return nil
+}
+
+// RecordHistory implements InstanceRepository in one statement
+func (r *PostgresInstanceRepository) RecordHistory(ctx context.Context, updates []HeartbeatUpdate) (int, error) {
+	instanceIDs, receivedAt, data, err := heartbeatArrays(updates)
+	if err != nil {
+		return 0, err
+	}
+
+	tag, err := r.db.Pool.Exec(ctx, `
+		INSERT INTO heartbeat_history (instance_id, heartbeat_data, received_at)
+		SELECT i.id, h.data::jsonb, h.received_at
+		FROM unnest($1::text[], $2::timestamptz[], $3::text[]) AS h(instance_id, received_at, data)
+		JOIN instances i ON i.instance_id = h.instance_id
+	`, instanceIDs, receivedAt, data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record heartbeat history: %w", err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// PruneHistory implements InstanceRepository
+func (r *PostgresInstanceRepository) PruneHistory(ctx context.Context, cutoff time.Time) (int64, error) {
+	history, err := r.db.Pool.Exec(ctx, `DELETE FROM heartbeat_history WHERE received_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune heartbeat history: %w", err)
+	}
+	alerts, err := r.db.Pool.Exec(ctx, `DELETE FROM instance_alerts WHERE occurred_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune instance alerts: %w", err)
+	}
+
+	return history.RowsAffected() + alerts.RowsAffected(), nil
+}
+
+// CreateAlerts implements InstanceRepository in one statement
+func (r *PostgresInstanceRepository) CreateAlerts(ctx context.Context, alerts []types.InstanceAlert) (int, error) {
+	instanceIDs := make([]string, len(alerts))
+	alertTypes := make([]string, len(alerts))
+	severities := make([]string, len(alerts))
+	messages := make([]string, len(alerts))
+	details := make([]string, len(alerts))
+	occurredAt := make([]time.Time, len(alerts))
+	for i, alert := range alerts {
+		instanceIDs[i] = alert.InstanceID
+		alertTypes[i] = alert.Type
+		severities[i] = alert.Severity
+		messages[i] = alert.Message
+		details[i] = alert.Details
+		occurredAt[i] = alert.Time
+	}
+
+	tag, err := r.db.Pool.Exec(ctx, `
+		INSERT INTO instance_alerts (instance_id, type, severity, message, details, occurred_at)
+		SELECT i.id, a.type, a.severity, a.message, NULLIF(a.details, ''), a.occurred_at
+		FROM unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::text[], $6::timestamptz[])
+			AS a(instance_id, type, severity, message, details, occurred_at)
+		JOIN instances i ON i.instance_id = a.instance_id
+	`, instanceIDs, alertTypes, severities, messages, details, occurredAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create instance alerts: %w", err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// ListAlerts implements InstanceRepository
+func (r *PostgresInstanceRepository) ListAlerts(ctx context.Context, id string, limit int) ([]types.InstanceAlert, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT a.id, i.instance_id, a.type, a.severity, a.message, COALESCE(a.details, ''), a.occurred_at, a.received_at
+		FROM instance_alerts a JOIN instances i ON i.id = a.instance_id
+		WHERE a.instance_id = $1
+		ORDER BY a.occurred_at DESC
+		LIMIT $2
+	`, id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instance alerts: %w", err)
+	}
+	defer rows.Close()
+
+	alerts := []types.InstanceAlert{}
+	for rows.Next() {
+		var alert types.InstanceAlert
+		if err := rows.Scan(&alert.ID, &alert.InstanceID, &alert.Type, &alert.Severity, &alert.Message,
+			&alert.Details, &alert.Time, &alert.ReceivedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan instance alert: %w", err)
+		}
+		alerts = append(alerts, alert)
+	}
+
+	return alerts, rows.Err()
+}
+
+// GetControl implements InstanceRepository
+func (r *PostgresInstanceRepository) GetControl(ctx context.Context, id string) (*types.InstanceControl, error) {
+	var desired, config []byte
+	err := r.db.Pool.QueryRow(ctx, `SELECT desired_versions, updater_config FROM instances WHERE id = $1`, id).
+		Scan(&desired, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get instance control: %w", err)
+	}
+	return decodeControl(desired, config)
+}
+
+// SetControl implements InstanceRepository
+func (r *PostgresInstanceRepository) SetControl(ctx context.Context, id string, control *types.InstanceControl) error {
+	desired, config, err := encodeControl(control)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Pool.Exec(ctx, `
+		UPDATE instances SET desired_versions = $2, updater_config = $3, updated_at = NOW() WHERE id = $1
+	`, id, desired, config)
+	if err != nil {
+		return fmt.Errorf("failed to set instance control: %w", err)
+	}
+	return nil
+}
+
+// ListControls implements InstanceRepository
+func (r *PostgresInstanceRepository) ListControls(ctx context.Context) (map[string]types.InstanceControl, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT instance_id, desired_versions, updater_config FROM instances
+		WHERE desired_versions <> '{}'::jsonb OR updater_config IS NOT NULL
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instance controls: %w", err)
+	}
+	defer rows.Close()
+
+	controls := make(map[string]types.InstanceControl)
+	for rows.Next() {
+		var instanceID string
+		var desired, config []byte
+		if err := rows.Scan(&instanceID, &desired, &config); err != nil {
+			return nil, fmt.Errorf("failed to scan instance control: %w", err)
+		}
+		control, err := decodeControl(desired, config)
+		if err != nil {
+			return nil, err
+		}
+		controls[instanceID] = *control
+	}
+
+	return controls, rows.Err()
+}
+
+// Delete deletes an instance
+func (r *PostgresInstanceRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.Pool.Exec(ctx, `DELETE FROM instances WHERE id = $1`, id)
+	return err
+}
+
+// UpdateOfflineInstances marks instances as offline if no heartbeat in threshold
+func (r *PostgresInstanceRepository) UpdateOfflineInstances(ctx context.Context, threshold time.Duration) error {
+	cutoff := time.Now().Add(-threshold)
+
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE instances
+		SET status = 'offline', updated_at = NOW()
+		WHERE last_heartbeat < $1 AND status = 'online'
+	`, cutoff)
+
+	return err
+}
+
+// CountByStatus counts instances by status
+func (r *PostgresInstanceRepository) CountByStatus(ctx context.Context) (map[string]int, error) {
+	rows, err := r.db.Pool.Query(ctx, `SELECT status, COUNT(*) FROM instances GROUP BY status`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count instances: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan instance count: %w", err)
+		}
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// CountVersions counts the instances running each product version
+func (r *PostgresInstanceRepository) CountVersions(ctx context.Context) ([]VersionCount, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT p->>'name', p->>'version', COUNT(DISTINCT i.id)
+		FROM instances i
+		CROSS JOIN LATERAL jsonb_array_elements(
+			CASE WHEN jsonb_typeof(i.last_heartbeat_data->'products') = 'array'
+				 THEN i.last_heartbeat_data->'products' ELSE '[]'::jsonb END
+		) p
+		WHERE p->>'name' IS NOT NULL AND p->>'version' IS NOT NULL
+		GROUP BY 1, 2
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count instance versions: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []VersionCount
+	for rows.Next() {
+		var count VersionCount
+		if err := rows.Scan(&count.Product, &count.Version, &count.Instances); err != nil {
+			return nil, fmt.Errorf("failed to scan instance version count: %w", err)
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
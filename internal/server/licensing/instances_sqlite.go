@@ -0,0 +1,414 @@
+package licensing
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// SQLiteInstanceRepository stores instances in a SQLite database
+type SQLiteInstanceRepository struct {
+	db *database.SQLite
+}
+
+// NewSQLiteInstanceRepository creates a repository backed by SQLite
+func NewSQLiteInstanceRepository(db *database.DB) *SQLiteInstanceRepository {
+	return &SQLiteInstanceRepository{db: db.SQLite}
+}
+
+// Instances belong to the organization that owns their license
+const sqliteInstanceColumns = `i.id, i.instance_id, i.instance_type, i.hostname, COALESCE(i.license_id, ''),
+	COALESCE(l.organization_id, ''), i.api_key_hash, i.last_heartbeat, i.last_heartbeat_data, i.status,
+	i.created_at, i.updated_at`
+
+func scanSQLiteInstance(row database.Row) (*types.Instance, error) {
+	var instance types.Instance
+	var lastHeartbeatData sql.NullString
+
+	err := row.Scan(
+		&instance.ID, &instance.InstanceID, &instance.InstanceType, &instance.Hostname,
+		&instance.LicenseID, &instance.OrganizationID, &instance.APIKeyHash, &instance.LastHeartbeat,
+		&lastHeartbeatData, &instance.Status, &instance.CreatedAt, &instance.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if lastHeartbeatData.Valid {
+		var heartbeat types.Heartbeat
+		if err := json.Unmarshal([]byte(lastHeartbeatData.String), &heartbeat); err == nil {
+			instance.LastHeartbeatData = &heartbeat
+		}
+	}
+
+	return &instance, nil
+}
+
+// Create implements InstanceRepository
+func (r *SQLiteInstanceRepository) Create(ctx context.Context, instance *types.Instance) error {
+	instance.ID = uuid.New().String()
+	instance.CreatedAt = time.Now()
+	instance.UpdatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO instances (id, instance_id, instance_type, hostname, license_id, api_key_hash, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9)
+	`, instance.ID, instance.InstanceID, instance.InstanceType, instance.Hostname,
+		instance.LicenseID, instance.APIKeyHash, instance.Status, instance.CreatedAt, instance.UpdatedAt)
+
+	return err
+}
+
+// GetByID implements InstanceRepository
+func (r *SQLiteInstanceRepository) GetByID(ctx context.Context, id string) (*types.Instance, error) {
+	return r.get(ctx, `i.id = $1`, id)
+}
+
+// GetByInstanceID implements InstanceRepository
+func (r *SQLiteInstanceRepository) GetByInstanceID(ctx context.Context, instanceID string) (*types.Instance, error) {
+	return r.get(ctx, `i.instance_id = $1`, instanceID)
+}
+
+// GetByAPIKeyHash implements InstanceRepository
+func (r *SQLiteInstanceRepository) GetByAPIKeyHash(ctx context.Context, apiKeyHash string) (*types.Instance, error) {
+	return r.get(ctx, `i.api_key_hash = $1`, apiKeyHash)
+}
+
+func (r *SQLiteInstanceRepository) get(ctx context.Context, condition, value string) (*types.Instance, error) {
+	instance, err := scanSQLiteInstance(r.db.QueryRowContext(ctx, `
+		SELECT `+sqliteInstanceColumns+`
+		FROM `+instanceFrom+`
+		WHERE `+condition, value))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get instance: %w", err)
+	}
+
+	return instance, nil
+}
+
+// List implements InstanceRepository
+func (r *SQLiteInstanceRepository) List(ctx context.Context, scope []string) ([]types.Instance, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+sqliteInstanceColumns+`
+		FROM `+instanceFrom+`
+		WHERE $1 IS NULL OR l.organization_id IN (SELECT value FROM json_each($1))
+		ORDER BY i.created_at DESC
+	`, scopeArg(scope))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instances: %w", err)
+	}
+	defer rows.Close()
+
+	var instances []types.Instance
+	for rows.Next() {
+		instance, err := scanSQLiteInstance(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan instance: %w", err)
+		}
+		instances = append(instances, *instance)
+	}
+
+	return instances, rows.Err()
+}
+
+// Update implements InstanceRepository
+func (r *SQLiteInstanceRepository) Update(ctx context.Context, instance *types.Instance) error {
+	instance.UpdatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE instances
+		SET hostname = $2, api_key_hash = $3, status = $4, updated_at = $5
+		WHERE id = $1
+	`, instance.ID, instance.Hostname, instance.APIKeyHash, instance.Status, instance.UpdatedAt)
+
+	return err
+}
+
+// UpdateHeartbeat implements InstanceRepository
+func (r *SQLiteInstanceRepository) UpdateHeartbeat(ctx context.Context, instanceID string, heartbeat *types.Heartbeat) error {
+	heartbeatData, err := json.Marshal(heartbeat)
+	if err != nil {
+		return fmt.Errorf("failed to marshal heartbeat: %w", err)
+	}
+
+	now := time.Now()
+
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE instances
+		SET last_heartbeat = $2, last_heartbeat_data = $3, status = 'online', updated_at = $4
+		WHERE instance_id = $1
+	`, instanceID, now, string(heartbeatData), now)
+
+	return err
+}
+
+// UpdateHeartbeats implements InstanceRepository. SQLite has a single
+// writer, so the batch is one transaction rather than one per heartbeat.
+func (r *SQLiteInstanceRepository) UpdateHeartbeats(ctx context.Context, updates []HeartbeatUpdate) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to record heartbeats: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, update := range updates {
+		heartbeatData, err := json.Marshal(update.Heartbeat)
+		if err != nil {
+			return fmt.Errorf("failed to marshal heartbeat: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE instances
+			SET last_heartbeat = $2, last_heartbeat_data = $3, status = 'online', updated_at = $4
+			WHERE instance_id = $1 AND (last_heartbeat IS NULL OR last_heartbeat <= $2)
+		`, update.Heartbeat.InstanceID, update.ReceivedAt, string(heartbeatData), now)
+		if err != nil {
+			return fmt.Errorf("failed to record heartbeats: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to record heartbeats: %w", err)
+	}
+	return nil
+}
+
+// RecordHistory implements InstanceRepository in one transaction
+func (r *SQLiteInstanceRepository) RecordHistory(ctx context.Context, updates []HeartbeatUpdate) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record heartbeat history: %w", err)
+	}
+	defer tx.Rollback()
+
+	recorded := 0
+	for _, update := range updates {
+		heartbeatData, err := json.Marshal(update.Heartbeat)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal heartbeat: %w", err)
+		}
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO heartbeat_history (id, instance_id, heartbeat_data, received_at)
+			SELECT $1, id, $2, $3 FROM instances WHERE instance_id = $4
+		`, uuid.New().String(), string(heartbeatData), update.ReceivedAt, update.Heartbeat.InstanceID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to record heartbeat history: %w", err)
+		}
+		n, _ := result.RowsAffected()
+		recorded += int(n)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to record heartbeat history: %w", err)
+	}
+	return recorded, nil
+}
+
+// PruneHistory implements InstanceRepository
+func (r *SQLiteInstanceRepository) PruneHistory(ctx context.Context, cutoff time.Time) (int64, error) {
+	history, err := r.db.ExecContext(ctx, `DELETE FROM heartbeat_history WHERE received_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune heartbeat history: %w", err)
+	}
+	alerts, err := r.db.ExecContext(ctx, `DELETE FROM instance_alerts WHERE occurred_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune instance alerts: %w", err)
+	}
+
+	historyDeleted, _ := history.RowsAffected()
+	alertsDeleted, _ := alerts.RowsAffected()
+	return historyDeleted + alertsDeleted, nil
+}
+
+// CreateAlerts implements InstanceRepository in one transaction
+func (r *SQLiteInstanceRepository) CreateAlerts(ctx context.Context, alerts []types.InstanceAlert) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create instance alerts: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	created := 0
+	for _, alert := range alerts {
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO instance_alerts (id, instance_id, type, severity, message, details, occurred_at, received_at)
+			SELECT $1, id, $2, $3, $4, NULLIF($5, ''), $6, $7 FROM instances WHERE instance_id = $8
+		`, uuid.New().String(), alert.Type, alert.Severity, alert.Message, alert.Details, alert.Time, now, alert.InstanceID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create instance alerts: %w", err)
+		}
+		n, _ := result.RowsAffected()
+		created += int(n)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to create instance alerts: %w", err)
+	}
+	return created, nil
+}
+
+// ListAlerts implements InstanceRepository
+func (r *SQLiteInstanceRepository) ListAlerts(ctx context.Context, id string, limit int) ([]types.InstanceAlert, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT a.id, i.instance_id, a.type, a.severity, a.message, COALESCE(a.details, ''), a.occurred_at, a.received_at
+		FROM instance_alerts a JOIN instances i ON i.id = a.instance_id
+		WHERE a.instance_id = $1
+		ORDER BY a.occurred_at DESC
+		LIMIT $2
+	`, id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instance alerts: %w", err)
+	}
+	defer rows.Close()
+
+	alerts := []types.InstanceAlert{}
+	for rows.Next() {
+		var alert types.InstanceAlert
+		if err := rows.Scan(&alert.ID, &alert.InstanceID, &alert.Type, &alert.Severity, &alert.Message,
+			&alert.Details, &alert.Time, &alert.ReceivedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan instance alert: %w", err)
+		}
+		alerts = append(alerts, alert)
+	}
+
+	return alerts, rows.Err()
+}
+
+// GetControl implements InstanceRepository
+func (r *SQLiteInstanceRepository) GetControl(ctx context.Context, id string) (*types.InstanceControl, error) {
+	var desired string
+	var config sql.NullString
+	err := r.db.QueryRowContext(ctx, `SELECT desired_versions, updater_config FROM instances WHERE id = $1`, id).
+		Scan(&desired, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get instance control: %w", err)
+	}
+	return decodeControl([]byte(desired), []byte(config.String))
+}
+
+// SetControl implements InstanceRepository
+func (r *SQLiteInstanceRepository) SetControl(ctx context.Context, id string, control *types.InstanceControl) error {
+	desired, config, err := encodeControl(control)
+	if err != nil {
+		return err
+	}
+
+	var configArg interface{}
+	if config != nil {
+		configArg = string(config)
+	}
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE instances SET desired_versions = $2, updater_config = $3, updated_at = $4 WHERE id = $1
+	`, id, string(desired), configArg, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to set instance control: %w", err)
+	}
+	return nil
+}
+
+// ListControls implements InstanceRepository
+func (r *SQLiteInstanceRepository) ListControls(ctx context.Context) (map[string]types.InstanceControl, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT instance_id, desired_versions, updater_config FROM instances
+		WHERE desired_versions <> '{}' OR updater_config IS NOT NULL
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instance controls: %w", err)
+	}
+	defer rows.Close()
+
+	controls := make(map[string]types.InstanceControl)
+	for rows.Next() {
+		var instanceID, desired string
+		var config sql.NullString
+		if err := rows.Scan(&instanceID, &desired, &config); err != nil {
+			return nil, fmt.Errorf("failed to scan instance control: %w", err)
+		}
+		control, err := decodeControl([]byte(desired), []byte(config.String))
+		if err != nil {
+			return nil, err
+		}
+		controls[instanceID] = *control
+	}
+
+	return controls, rows.Err()
+}
+
+// Delete implements InstanceRepository
+func (r *SQLiteInstanceRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM instances WHERE id = $1`, id)
+	return err
+}
+
+// UpdateOfflineInstances implements InstanceRepository
+func (r *SQLiteInstanceRepository) UpdateOfflineInstances(ctx context.Context, threshold time.Duration) error {
+	now := time.Now()
+
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE instances
+		SET status = 'offline', updated_at = $2
+		WHERE last_heartbeat < $1 AND status = 'online'
+	`, now.Add(-threshold), now)
+
+	return err
+}
+
+// CountByStatus implements InstanceRepository
+func (r *SQLiteInstanceRepository) CountByStatus(ctx context.Context) (map[string]int, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT status, COUNT(*) FROM instances GROUP BY status`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count instances: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan instance count: %w", err)
+		}
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// CountVersions implements InstanceRepository
+func (r *SQLiteInstanceRepository) CountVersions(ctx context.Context) ([]VersionCount, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT json_extract(p.value, '$.name'), json_extract(p.value, '$.version'), COUNT(DISTINCT i.id)
+		FROM instances i, json_each(
+			CASE WHEN json_type(i.last_heartbeat_data, '$.products') = 'array'
+				 THEN json_extract(i.last_heartbeat_data, '$.products') ELSE '[]' END
+		) p
+		WHERE json_extract(p.value, '$.name') IS NOT NULL AND json_extract(p.value, '$.version') IS NOT NULL
+		GROUP BY 1, 2
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count instance versions: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []VersionCount
+	for rows.Next() {
+		var count VersionCount
+		if err := rows.Scan(&count.Product, &count.Version, &count.Instances); err != nil {
+			return nil, fmt.Errorf("failed to scan instance version count: %w", err)
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
@@ -0,0 +1,134 @@
+package licensing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// PostgresRepository stores licenses in PostgreSQL
+type PostgresRepository struct {
+	db *database.DB
+}
+
+// NewPostgresRepository creates a repository backed by PostgreSQL
+func NewPostgresRepository(db *database.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+func scanLicense(row pgx.Row) (*types.License, error) {
+	var license types.License
+	err := row.Scan(
+		&license.ID, &license.LicenseKey, &license.OrganizationID, &license.CustomerID, &license.CustomerName,
+		&license.Type, &license.Products, &license.Features, &license.Limits,
+		&license.IssuedAt, &license.ExpiresAt, &license.BoundTo, &license.IsActive,
+		&license.CreatedAt, &license.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &license, nil
+}
+
+// Create creates a new license
+func (r *PostgresRepository) Create(ctx context.Context, license *types.License) error {
+	license.ID = uuid.New().String()
+	license.CreatedAt = time.Now()
+	license.UpdatedAt = time.Now()
+
+	_, err := r.db.Pool.Exec(ctx, `
+		INSERT INTO licenses (id, license_key, organization_id, customer_id, customer_name, license_type, products, features, limits, issued_at, expires_at, bound_to, is_active, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+	`, license.ID, license.LicenseKey, license.OrganizationID, license.CustomerID, license.CustomerName, license.Type,
+		license.Products, license.Features, license.Limits, license.IssuedAt, license.ExpiresAt,
+		license.BoundTo, license.IsActive, license.CreatedAt, license.UpdatedAt)
+
+	return err
+}
+
+// GetByKey retrieves a license by its key
+func (r *PostgresRepository) GetByKey(ctx context.Context, licenseKey string) (*types.License, error) {
+	license, err := scanLicense(r.db.Pool.QueryRow(ctx, `
+		SELECT `+licenseColumns+`
+		FROM licenses
+		WHERE license_key = $1
+	`, licenseKey))
+
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get license: %w", err)
+	}
+
+	return license, nil
+}
+
+// GetByID retrieves a license by ID
+func (r *PostgresRepository) GetByID(ctx context.Context, id string) (*types.License, error) {
+	license, err := scanLicense(r.db.Pool.QueryRow(ctx, `
+		SELECT `+licenseColumns+`
+		FROM licenses
+		WHERE id = $1
+	`, id))
+
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get license: %w", err)
+	}
+
+	return license, nil
+}
+
+// List retrieves licenses, limited to the organizations in scope unless scope is nil
+func (r *PostgresRepository) List(ctx context.Context, scope []string) ([]types.License, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT `+licenseColumns+`
+		FROM licenses
+		WHERE $1::text[] IS NULL OR organization_id::text = ANY($1)
+		ORDER BY created_at DESC
+	`, scope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list licenses: %w", err)
+	}
+	defer rows.Close()
+
+	var licenses []types.License
+	for rows.Next() {
+		license, err := scanLicense(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan license: %w", err)
+		}
+		licenses = append(licenses, *license)
+	}
+
+	return licenses, nil
+}
+
+// Update updates a license
+func (r *PostgresRepository) Update(ctx context.Context, license *types.License) error {
+	license.UpdatedAt = time.Now()
+
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE licenses
+		SET customer_name = $2, products = $3, features = $4, limits = $5, expires_at = $6, bound_to = $7, is_active = $8, updated_at = $9
+		WHERE id = $1
+	`, license.ID, license.CustomerName, license.Products, license.Features, license.Limits,
+		license.ExpiresAt, license.BoundTo, license.IsActive, license.UpdatedAt)
+
+	return err
+}
+
+// Delete deletes a license
+func (r *PostgresRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.Pool.Exec(ctx, `DELETE FROM licenses WHERE id = $1`, id)
+	return err
+}
+
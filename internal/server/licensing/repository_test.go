@@ -0,0 +1,220 @@
+package licensing
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database/dbtest"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/organizations"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// createOrganization creates the organization that owns the test licenses
+func createOrganization(t *testing.T, db *database.DB, slug string) string {
+	t.Helper()
+	org := &types.Organization{Slug: slug, Name: slug}
+	if err := organizations.NewRepository(db).Create(context.Background(), org); err != nil {
+		t.Fatalf("create organization: %v", err)
+	}
+	return org.ID
+}
+
+// createLicense creates a license of the organization with ID orgID
+func createLicense(t *testing.T, db *database.DB, orgID, key string) *types.License {
+	t.Helper()
+	license := &types.License{
+		LicenseKey:     key,
+		OrganizationID: orgID,
+		CustomerID:     "cust-" + key,
+		CustomerName:   "Customer " + key,
+		Type:           "siemcore",
+		Products:       []string{"siemcore", "siemcore-api"},
+		Limits:         types.LicenseLimits{MaxUsers: 10},
+		IssuedAt:       time.Now().Add(-time.Hour).Truncate(time.Second),
+		ExpiresAt:      time.Now().Add(365 * 24 * time.Hour).Truncate(time.Second),
+		IsActive:       true,
+	}
+	if err := NewRepository(db).Create(context.Background(), license); err != nil {
+		t.Fatalf("create license: %v", err)
+	}
+	return license
+}
+
+func TestLicenseRepository(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		ctx := context.Background()
+		repo := NewRepository(db)
+		acme := createOrganization(t, db, "acme")
+		globex := createOrganization(t, db, "globex")
+
+		license := createLicense(t, db, acme, "KEY-ACME")
+		createLicense(t, db, globex, "KEY-GLOBEX")
+
+		got, err := repo.GetByKey(ctx, "KEY-ACME")
+		if err != nil || got == nil {
+			t.Fatalf("GetByKey = %v, %v", got, err)
+		}
+		if got.ID != license.ID || got.OrganizationID != acme || got.Limits.MaxUsers != 10 ||
+			!slices.Equal(got.Products, license.Products) || !got.ExpiresAt.Equal(license.ExpiresAt) {
+			t.Errorf("GetByKey = %+v, want %+v", got, license)
+		}
+		if missing, err := repo.GetByKey(ctx, "KEY-MISSING"); err != nil || missing != nil {
+			t.Errorf("GetByKey(missing) = %v, %v; want nil, nil", missing, err)
+		}
+
+		tests := []struct {
+			name  string
+			scope []string
+			want  []string
+		}{
+			{"all", nil, []string{"KEY-ACME", "KEY-GLOBEX"}},
+			{"scoped", []string{acme}, []string{"KEY-ACME"}},
+			{"empty scope", []string{}, nil},
+		}
+		for _, tt := range tests {
+			list, err := repo.List(ctx, tt.scope)
+			if err != nil {
+				t.Fatalf("List(%s): %v", tt.name, err)
+			}
+			var keys []string
+			for _, l := range list {
+				keys = append(keys, l.LicenseKey)
+			}
+			slices.Sort(keys)
+			if !slices.Equal(keys, tt.want) {
+				t.Errorf("List(%s) = %v, want %v", tt.name, keys, tt.want)
+			}
+		}
+
+		got.IsActive = false
+		got.BoundTo = "host-1"
+		if err := repo.Update(ctx, got); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		if updated, _ := repo.GetByID(ctx, license.ID); updated == nil || updated.IsActive || updated.BoundTo != "host-1" {
+			t.Errorf("after Update = %+v", updated)
+		}
+
+		if err := repo.Delete(ctx, license.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if deleted, _ := repo.GetByID(ctx, license.ID); deleted != nil {
+			t.Error("license still exists after Delete")
+		}
+	})
+}
+
+func TestInstanceRepository(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		ctx := context.Background()
+		repo := NewInstanceRepository(db)
+		acme := createOrganization(t, db, "acme")
+		license := createLicense(t, db, acme, "KEY-ACME")
+
+		instance := &types.Instance{
+			InstanceID:   "inst-a",
+			InstanceType: "siemcore",
+			Hostname:     "host-a",
+			LicenseID:    license.ID,
+			APIKeyHash:   HashAPIKey("sk_inst_a"),
+			Status:       "online",
+		}
+		other := &types.Instance{InstanceID: "inst-b", InstanceType: "mysoc", Hostname: "host-b", Status: "online"}
+		for _, i := range []*types.Instance{instance, other} {
+			if err := repo.Create(ctx, i); err != nil {
+				t.Fatalf("Create %s: %v", i.InstanceID, err)
+			}
+		}
+
+		byKey, err := repo.GetByAPIKeyHash(ctx, HashAPIKey("sk_inst_a"))
+		if err != nil || byKey == nil || byKey.ID != instance.ID || byKey.OrganizationID != acme {
+			t.Fatalf("GetByAPIKeyHash = %+v, %v", byKey, err)
+		}
+		if unknown, err := repo.GetByAPIKeyHash(ctx, HashAPIKey("sk_inst_unknown")); err != nil || unknown != nil {
+			t.Errorf("GetByAPIKeyHash(unknown) = %v, %v; want nil, nil", unknown, err)
+		}
+		if scoped, err := repo.List(ctx, []string{acme}); err != nil || len(scoped) != 1 || scoped[0].ID != instance.ID {
+			t.Errorf("List(acme) = %+v, %v", scoped, err)
+		}
+
+		// A replayed heartbeat older than the recorded one does not replace it
+		now := time.Now()
+		heartbeat := func(version string) *types.Heartbeat {
+			return &types.Heartbeat{
+				InstanceID: "inst-a",
+				Products:   []types.ProductStatus{{Name: "siemcore", Version: version}},
+			}
+		}
+		err = repo.UpdateHeartbeats(ctx, []HeartbeatUpdate{
+			{Heartbeat: heartbeat("1.1.0"), ReceivedAt: now},
+			{Heartbeat: heartbeat("1.0.0"), ReceivedAt: now.Add(-time.Minute)},
+		})
+		if err != nil {
+			t.Fatalf("UpdateHeartbeats: %v", err)
+		}
+		got, _ := repo.GetByInstanceID(ctx, "inst-a")
+		if got.LastHeartbeatData == nil || got.LastHeartbeatData.Products[0].Version != "1.1.0" {
+			t.Errorf("last heartbeat = %+v, want version 1.1.0", got.LastHeartbeatData)
+		}
+
+		recorded, err := repo.RecordHistory(ctx, []HeartbeatUpdate{
+			{Heartbeat: heartbeat("1.1.0"), ReceivedAt: now},
+			{Heartbeat: &types.Heartbeat{InstanceID: "inst-unknown"}, ReceivedAt: now},
+		})
+		if err != nil || recorded != 1 {
+			t.Errorf("RecordHistory = %d, %v; want 1", recorded, err)
+		}
+
+		counts, err := repo.CountVersions(ctx)
+		if err != nil || len(counts) != 1 || counts[0] != (VersionCount{Product: "siemcore", Version: "1.1.0", Instances: 1}) {
+			t.Errorf("CountVersions = %+v, %v", counts, err)
+		}
+
+		created, err := repo.CreateAlerts(ctx, []types.InstanceAlert{
+			{InstanceID: "inst-a", Type: "disk", Severity: "high", Message: "disk full", Time: now.Add(-2 * time.Hour)},
+			{InstanceID: "inst-a", Type: "cpu", Severity: "low", Message: "busy", Time: now},
+			{InstanceID: "inst-unknown", Type: "cpu", Severity: "low", Message: "busy", Time: now},
+		})
+		if err != nil || created != 2 {
+			t.Errorf("CreateAlerts = %d, %v; want 2", created, err)
+		}
+		alerts, err := repo.ListAlerts(ctx, instance.ID, 10)
+		if err != nil || len(alerts) != 2 || alerts[0].Type != "cpu" || alerts[0].InstanceID != "inst-a" {
+			t.Errorf("ListAlerts = %+v, %v; want newest first", alerts, err)
+		}
+		if pruned, err := repo.PruneHistory(ctx, now.Add(-time.Hour)); err != nil || pruned != 1 {
+			t.Errorf("PruneHistory = %d, %v; want 1", pruned, err)
+		}
+
+		autoUpdate := false
+		control := &types.InstanceControl{
+			DesiredVersions: map[string]string{"siemcore": "1.0.0"},
+			Config:          &types.UpdaterConfig{Channel: "beta", AutoUpdate: &autoUpdate},
+		}
+		if err := repo.SetControl(ctx, instance.ID, control); err != nil {
+			t.Fatalf("SetControl: %v", err)
+		}
+		controls, err := repo.ListControls(ctx)
+		if err != nil {
+			t.Fatalf("ListControls: %v", err)
+		}
+		if len(controls) != 1 {
+			t.Fatalf("ListControls = %+v, want only inst-a", controls)
+		}
+		listed := controls["inst-a"]
+		if listed.DesiredVersions["siemcore"] != "1.0.0" || listed.Config == nil || listed.Config.Channel != "beta" ||
+			listed.Config.AutoUpdate == nil || *listed.Config.AutoUpdate {
+			t.Errorf("ListControls[inst-a] = %+v", listed)
+		}
+
+		if err := repo.Delete(ctx, instance.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if deleted, _ := repo.GetByAPIKeyHash(ctx, HashAPIKey("sk_inst_a")); deleted != nil {
+			t.Error("instance still authenticates after Delete")
+		}
+	})
+}
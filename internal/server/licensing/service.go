@@ -6,26 +6,34 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"log"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/organizations"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/products"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/tracing"
 	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
 )
 
 // Service handles license business logic
 type Service struct {
-	repo         *Repository
-	instanceRepo *InstanceRepository
+	repo          Repository
+	instanceRepo  InstanceRepository
+	products      *products.Service
+	organizations *organizations.Service
 }
 
 // NewService creates a new licensing service
 func NewService(db *database.DB) *Service {
 	return &Service{
 		repo:         NewRepository(db),
-		instanceRepo: NewInstanceRepository(db),
+		instanceRepo:  NewInstanceRepository(db),
+		products:      products.NewService(db),
+		organizations: organizations.NewService(db),
 	}
 }
 
@@ -55,21 +63,31 @@ func HashAPIKey(apiKey string) string {
 	return hex.EncodeToString(hash[:])
 }
 
-// CreateLicense creates a new license
+// CreateLicense creates a new license for an organization. Without an organization_id,
+// the organization whose slug is the customer_id is used, and created if needed.
 func (s *Service) CreateLicense(ctx context.Context, req CreateLicenseRequest) (*types.License, error) {
+	org, err := s.organizations.ResolveForLicense(ctx, req.OrganizationID, req.CustomerID, req.CustomerName)
+	if err != nil {
+		return nil, err
+	}
+	if req.CustomerName == "" {
+		req.CustomerName = org.Name
+	}
+
 	licenseKey := GenerateLicenseKey(req.Prefix)
 
 	license := &types.License{
-		LicenseKey:   licenseKey,
-		CustomerID:   req.CustomerID,
-		CustomerName: req.CustomerName,
-		Type:         req.Type,
-		Products:     req.Products,
-		Features:     req.Features,
-		Limits:       req.Limits,
-		IssuedAt:     time.Now(),
-		ExpiresAt:    req.ExpiresAt,
-		IsActive:     true,
+		LicenseKey:     licenseKey,
+		OrganizationID: org.ID,
+		CustomerID:     org.Slug,
+		CustomerName:   req.CustomerName,
+		Type:           req.Type,
+		Products:       req.Products,
+		Features:       req.Features,
+		Limits:         req.Limits,
+		IssuedAt:       time.Now(),
+		ExpiresAt:      req.ExpiresAt,
+		IsActive:       true,
 	}
 
 	if err := s.repo.Create(ctx, license); err != nil {
@@ -80,7 +98,10 @@ func (s *Service) CreateLicense(ctx context.Context, req CreateLicenseRequest) (
 }
 
 // ActivateLicense activates a license and creates an instance
-func (s *Service) ActivateLicense(ctx context.Context, req types.LicenseActivationRequest) (*types.LicenseActivationResponse, error) {
+func (s *Service) ActivateLicense(ctx context.Context, req types.LicenseActivationRequest) (_ *types.LicenseActivationResponse, err error) {
+	ctx, span := tracing.Start(ctx, "licensing.ActivateLicense")
+	defer func() { tracing.End(span, err) }()
+
 	// Get the license
 	license, err := s.repo.GetByKey(ctx, req.LicenseKey)
 	if err != nil {
@@ -161,8 +182,12 @@ func (s *Service) ActivateLicense(ctx context.Context, req types.LicenseActivati
 		}
 	}
 
-	// Build install manifest
-	installManifest := buildInstallManifest(license)
+	// Build install manifest from the product registry
+	registry, err := s.products.ListProducts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list products: %w", err)
+	}
+	installManifest := buildInstallManifest(license, registry)
 
 	return &types.LicenseActivationResponse{
 		Success: true,
@@ -177,7 +202,10 @@ func (s *Service) ActivateLicense(ctx context.Context, req types.LicenseActivati
 }
 
 // ValidateLicense validates a license key
-func (s *Service) ValidateLicense(ctx context.Context, licenseKey string) (*types.License, error) {
+func (s *Service) ValidateLicense(ctx context.Context, licenseKey string) (_ *types.License, err error) {
+	ctx, span := tracing.Start(ctx, "licensing.ValidateLicense")
+	defer func() { tracing.End(span, err) }()
+
 	license, err := s.repo.GetByKey(ctx, licenseKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get license: %w", err)
@@ -189,14 +217,53 @@ func (s *Service) ValidateLicense(ctx context.Context, licenseKey string) (*type
 	return license, nil
 }
 
+// RunOfflineCheck marks instances that have not sent a heartbeat within
+// threshold as offline, every interval until ctx is cancelled
+func (s *Service) RunOfflineCheck(ctx context.Context, interval, threshold time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.instanceRepo.UpdateOfflineInstances(ctx, threshold); err != nil {
+				log.Printf("Offline instance check failed: %v", err)
+			}
+		}
+	}
+}
+
+// RunHistoryPrune deletes heartbeat history and alerts older than retention,
+// every interval until ctx is cancelled
+func (s *Service) RunHistoryPrune(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := s.instanceRepo.PruneHistory(ctx, time.Now().Add(-retention))
+			if err != nil {
+				log.Printf("Heartbeat history pruning failed: %v", err)
+			} else if deleted > 0 {
+				log.Printf("Pruned %d heartbeat history entries and alerts", deleted)
+			}
+		}
+	}
+}
+
 // GetLicense retrieves a license by ID
 func (s *Service) GetLicense(ctx context.Context, id string) (*types.License, error) {
 	return s.repo.GetByID(ctx, id)
 }
 
-// ListLicenses retrieves all licenses
-func (s *Service) ListLicenses(ctx context.Context) ([]types.License, error) {
-	return s.repo.List(ctx)
+// ListLicenses retrieves the licenses of the organizations in scope, or all licenses when scope is nil
+func (s *Service) ListLicenses(ctx context.Context, scope []string) ([]types.License, error) {
+	return s.repo.List(ctx, scope)
 }
 
 // UpdateLicense updates a license
@@ -211,14 +278,15 @@ func (s *Service) DeleteLicense(ctx context.Context, id string) error {
 
 // CreateLicenseRequest is the request to create a license
 type CreateLicenseRequest struct {
-	Prefix       string            `json:"prefix"`       // MYSOC or SIEM
-	CustomerID   string            `json:"customer_id"`
-	CustomerName string            `json:"customer_name"`
-	Type         string            `json:"type"`         // mysoc-cloud, siemcore, siemcore-lite
-	Products     []string          `json:"products"`
-	Features     []string          `json:"features"`
-	Limits       types.LicenseLimits `json:"limits"`
-	ExpiresAt    time.Time         `json:"expires_at"`
+	Prefix         string              `json:"prefix"` // MYSOC or SIEM
+	OrganizationID string              `json:"organization_id"`
+	CustomerID     string              `json:"customer_id"` // slug of the organization when organization_id is not set
+	CustomerName   string              `json:"customer_name"`
+	Type           string              `json:"type"` // mysoc-cloud, siemcore, siemcore-lite
+	Products       []string            `json:"products"`
+	Features       []string            `json:"features"`
+	Limits         types.LicenseLimits `json:"limits"`
+	ExpiresAt      time.Time           `json:"expires_at"`
 }
 
 // Helper functions
@@ -239,40 +307,14 @@ func generateInstanceID(license *types.License, hostname string) string {
 	return fmt.Sprintf("%s-%s", prefix, hex.EncodeToString(bytes))
 }
 
-func buildInstallManifest(license *types.License) *types.InstallManifest {
+func buildInstallManifest(license *types.License, registry []types.Product) *types.InstallManifest {
 	var products []types.ProductInstall
 
-	// Add products based on license type
-	switch license.Type {
-	case "siemcore", "siemcore-lite":
-		products = []types.ProductInstall{
-			{Name: "siemcore-api", Version: "latest", Channel: "stable"},
-			{Name: "siemcore-collector", Version: "latest", Channel: "stable"},
-			{Name: "siemcore-frontend", Version: "latest", Channel: "stable"},
-			{Name: "detection-rules", Version: "latest", Channel: "stable"},
-		}
-	case "mysoc-cloud":
-		products = []types.ProductInstall{
-			{Name: "mysoc-api", Version: "latest", Channel: "stable"},
-			{Name: "mysoc-frontend", Version: "latest", Channel: "stable"},
-		}
-	}
-
-	// Also add any additional products from license
-	for _, p := range license.Products {
-		found := false
-		for _, existing := range products {
-			if existing.Name == p {
-				found = true
-				break
-			}
-		}
-		if !found {
-			products = append(products, types.ProductInstall{
-				Name:    p,
-				Version: "latest",
-				Channel: "stable",
-			})
+	// Products installed by default for this license type, then any
+	// additional products granted by the license itself
+	for _, p := range registry {
+		if containsString(p.LicenseTypes, license.Type) || containsString(license.Products, p.Name) {
+			products = append(products, productInstall(p))
 		}
 	}
 
@@ -283,6 +325,30 @@ func buildInstallManifest(license *types.License) *types.InstallManifest {
 	}
 }
 
+func productInstall(p types.Product) types.ProductInstall {
+	installPath := p.InstallPath
+	if installPath == "" {
+		installPath = products.DefaultInstallPath(p.Name, p.Type)
+	}
+	return types.ProductInstall{
+		Name:           p.Name,
+		Version:        "latest",
+		Channel:        p.DefaultChannel,
+		Type:           p.Type,
+		InstallPath:    installPath,
+		HealthEndpoint: p.HealthEndpoint,
+	}
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 func getConfigTemplate(licenseType string) string {
 	switch licenseType {
 	case "siemcore", "siemcore-lite":
@@ -0,0 +1,131 @@
+package licensing
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// SQLiteRepository stores licenses in a SQLite database
+type SQLiteRepository struct {
+	db *database.SQLite
+}
+
+// NewSQLiteRepository creates a repository backed by SQLite
+func NewSQLiteRepository(db *database.DB) *SQLiteRepository {
+	return &SQLiteRepository{db: db.SQLite}
+}
+
+func scanSQLiteLicense(row database.Row) (*types.License, error) {
+	var license types.License
+	err := row.Scan(
+		&license.ID, &license.LicenseKey, &license.OrganizationID, &license.CustomerID, &license.CustomerName,
+		&license.Type, (*database.StringList)(&license.Products), (*database.StringList)(&license.Features),
+		database.JSON{V: &license.Limits}, &license.IssuedAt, &license.ExpiresAt, &license.BoundTo, &license.IsActive,
+		&license.CreatedAt, &license.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &license, nil
+}
+
+// Create implements Repository
+func (r *SQLiteRepository) Create(ctx context.Context, license *types.License) error {
+	license.ID = uuid.New().String()
+	license.CreatedAt = time.Now()
+	license.UpdatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO licenses (id, license_key, organization_id, customer_id, customer_name, license_type, products, features, limits, issued_at, expires_at, bound_to, is_active, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+	`, license.ID, license.LicenseKey, license.OrganizationID, license.CustomerID, license.CustomerName, license.Type,
+		database.StringList(license.Products), database.StringList(license.Features), database.JSON{V: license.Limits},
+		license.IssuedAt, license.ExpiresAt, license.BoundTo, license.IsActive, license.CreatedAt, license.UpdatedAt)
+
+	return err
+}
+
+// GetByKey implements Repository
+func (r *SQLiteRepository) GetByKey(ctx context.Context, licenseKey string) (*types.License, error) {
+	return r.get(ctx, `license_key = $1`, licenseKey)
+}
+
+// GetByID implements Repository
+func (r *SQLiteRepository) GetByID(ctx context.Context, id string) (*types.License, error) {
+	return r.get(ctx, `id = $1`, id)
+}
+
+func (r *SQLiteRepository) get(ctx context.Context, condition, value string) (*types.License, error) {
+	license, err := scanSQLiteLicense(r.db.QueryRowContext(ctx, `
+		SELECT `+licenseColumns+`
+		FROM licenses
+		WHERE `+condition, value))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get license: %w", err)
+	}
+
+	return license, nil
+}
+
+// List implements Repository
+func (r *SQLiteRepository) List(ctx context.Context, scope []string) ([]types.License, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+licenseColumns+`
+		FROM licenses
+		WHERE $1 IS NULL OR organization_id IN (SELECT value FROM json_each($1))
+		ORDER BY created_at DESC
+	`, scopeArg(scope))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list licenses: %w", err)
+	}
+	defer rows.Close()
+
+	var licenses []types.License
+	for rows.Next() {
+		license, err := scanSQLiteLicense(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan license: %w", err)
+		}
+		licenses = append(licenses, *license)
+	}
+
+	return licenses, rows.Err()
+}
+
+// Update implements Repository
+func (r *SQLiteRepository) Update(ctx context.Context, license *types.License) error {
+	license.UpdatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE licenses
+		SET customer_name = $2, products = $3, features = $4, limits = $5, expires_at = $6, bound_to = $7, is_active = $8, updated_at = $9
+		WHERE id = $1
+	`, license.ID, license.CustomerName, database.StringList(license.Products), database.StringList(license.Features),
+		database.JSON{V: license.Limits}, license.ExpiresAt, license.BoundTo, license.IsActive, license.UpdatedAt)
+
+	return err
+}
+
+// Delete implements Repository
+func (r *SQLiteRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM licenses WHERE id = $1`, id)
+	return err
+}
+
+// scopeArg passes an organization scope as a JSON array, or NULL for no limit
+func scopeArg(scope []string) interface{} {
+	if scope == nil {
+		return nil
+	}
+	return database.StringList(scope)
+}
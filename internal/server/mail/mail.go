@@ -0,0 +1,222 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers email
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New creates a sender based on configuration. Without a driver it returns
+// no sender, which disables password reset and email verification.
+func New(cfg config.MailConfig) (Sender, error) {
+	if cfg.Driver == "" {
+		return nil, nil
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mail sender address: %w", err)
+	}
+
+	switch cfg.Driver {
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("SMTP host is required")
+		}
+		switch cfg.SMTPTLS {
+		case "starttls", "tls", "none":
+		default:
+			return nil, fmt.Errorf("unknown SMTP TLS mode: %s", cfg.SMTPTLS)
+		}
+		return &SMTPSender{
+			from:     from,
+			host:     cfg.SMTPHost,
+			port:     cfg.SMTPPort,
+			username: cfg.SMTPUsername,
+			password: cfg.SMTPPassword,
+			tlsMode:  cfg.SMTPTLS,
+		}, nil
+	case "file":
+		return NewFileSender(from, cfg.FilePath), nil
+	case "log":
+		return &LogSender{}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver: %s", cfg.Driver)
+	}
+}
+
+// SMTPSender delivers email through an SMTP relay
+type SMTPSender struct {
+	from     *mail.Address
+	host     string
+	port     int
+	username string
+	password string
+	tlsMode  string
+}
+
+// Send delivers a message
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient: %w", err)
+	}
+
+	addr := net.JoinHostPort(s.host, strconv.Itoa(s.port))
+	tlsConfig := &tls.Config{ServerName: s.host}
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+
+	var conn net.Conn
+	if s.tlsMode == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(time.Minute))
+	}
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if s.tlsMode == "starttls" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(s.from.Address); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM failed: %w", err)
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return fmt.Errorf("SMTP RCPT TO failed: %w", err)
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := w.Write(render(s.from, to, msg)); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// FileSender appends messages to a file instead of delivering them. It is meant
+// for development and tests, which can read links out of the file.
+type FileSender struct {
+	from *mail.Address
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileSender creates a sender that appends to path
+func NewFileSender(from *mail.Address, path string) *FileSender {
+	return &FileSender{from: from, path: path}
+}
+
+// Send appends a message to the file
+func (s *FileSender) Send(ctx context.Context, msg Message) error {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open mail file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(render(s.from, to, msg), "\r\n.\r\n"...)); err != nil {
+		return fmt.Errorf("failed to write mail file: %w", err)
+	}
+	return nil
+}
+
+// LogSender writes messages to the server log, for development. Anyone who
+// reads the log can use the reset links in it.
+type LogSender struct{}
+
+// Send logs a message
+func (s *LogSender) Send(ctx context.Context, msg Message) error {
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// render formats a message with its headers
+func render(from, to *mail.Address, msg Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", messageID(), domain(from.Address))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	buf.Write(bytes.ReplaceAll([]byte(msg.Body), []byte("\n"), []byte("\r\n")))
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+func messageID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func domain(address string) string {
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		return address[i+1:]
+	}
+	return "localhost"
+}
@@ -0,0 +1,206 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/licensing"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/tracing"
+)
+
+const namespace = "update_server"
+
+// Heartbeat results
+const (
+	HeartbeatOK       = "ok"
+	HeartbeatInvalid  = "invalid"  // malformed
+	HeartbeatRejected = "rejected" // turned away because the queue was full
+	HeartbeatError    = "error"    // failed to be recorded
+	HeartbeatReplayed = "replayed" // sent late by an updater that could not reach the server
+)
+
+// Metrics collects the server's Prometheus metrics. A nil *Metrics records
+// nothing, so callers need not check whether metrics are enabled.
+type Metrics struct {
+	registry      *prometheus.Registry
+	requests      *prometheus.CounterVec
+	duration      *prometheus.HistogramVec
+	heartbeats    *prometheus.CounterVec
+	downloadBytes *prometheus.CounterVec
+}
+
+// New creates the metrics for a server using db. Instance counts and
+// connection pool statistics are read from db when scraped.
+func New(db *database.DB) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route and status code.",
+		}, []string{"method", "route", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method and route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		heartbeats: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "heartbeats_total",
+			Help:      "Heartbeats received from updaters by result.",
+		}, []string{"result"}),
+		downloadBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "download_bytes_total",
+			Help:      "Artifact bytes sent to clients by product.",
+		}, []string{"product"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.duration,
+		m.heartbeats,
+		m.downloadBytes,
+		newInstanceCollector(licensing.NewInstanceRepository(db)),
+	)
+	if db.Pool != nil {
+		m.registry.MustRegister(newPoolCollector(db))
+	}
+	if db.SQLite != nil {
+		m.registry.MustRegister(collectors.NewDBStatsCollector(db.SQLite.DB, "update_server"))
+	}
+
+	// Start the heartbeat series at zero so rates are defined before the first failure
+	for _, result := range []string{HeartbeatOK, HeartbeatInvalid, HeartbeatRejected, HeartbeatError, HeartbeatReplayed} {
+		m.heartbeats.WithLabelValues(result)
+	}
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware records the count, status and latency of requests by route.
+// Requests that match no route share the route "unmatched", so scans for
+// random paths cannot create new series.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := tracing.RoutePattern(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		m.requests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		m.duration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// ObserveHeartbeats counts n heartbeats with one of the Heartbeat results
+func (m *Metrics) ObserveHeartbeats(result string, n int) {
+	if m == nil {
+		return
+	}
+	m.heartbeats.WithLabelValues(result).Add(float64(n))
+}
+
+// TrackHeartbeatQueue reports the number of heartbeats waiting to be written
+func (m *Metrics) TrackHeartbeatQueue(length func() int) {
+	if m == nil {
+		return
+	}
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "heartbeat_queue_length",
+		Help:      "Heartbeats waiting to be written to the database.",
+	}, func() float64 { return float64(length()) }))
+}
+
+// AddDownloadBytes counts n artifact bytes sent for product
+func (m *Metrics) AddDownloadBytes(product string, n int64) {
+	if m == nil || n <= 0 {
+		return
+	}
+	m.downloadBytes.WithLabelValues(product).Add(float64(n))
+}
+
+// scrapeTimeout bounds the database queries made for a scrape
+const scrapeTimeout = 5 * time.Second
+
+// instanceCollector reports instances by status and by the product versions
+// they run
+type instanceCollector struct {
+	repo     licensing.InstanceRepository
+	status   *prometheus.Desc
+	versions *prometheus.Desc
+}
+
+func newInstanceCollector(repo licensing.InstanceRepository) *instanceCollector {
+	return &instanceCollector{
+		repo: repo,
+		status: prometheus.NewDesc(namespace+"_instances",
+			"Instances by status.", []string{"status"}, nil),
+		versions: prometheus.NewDesc(namespace+"_instance_versions",
+			"Instances running each product version, as reported by their last heartbeat.",
+			[]string{"product", "version"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *instanceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.status
+	ch <- c.versions
+}
+
+// Collect implements prometheus.Collector
+func (c *instanceCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+	defer cancel()
+
+	counts, err := c.repo.CountByStatus(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.status, err)
+	} else {
+		// Always report both states so alerts on zero online instances fire
+		for _, status := range []string{"online", "offline"} {
+			if _, ok := counts[status]; !ok {
+				counts[status] = 0
+			}
+		}
+		for status, count := range counts {
+			ch <- prometheus.MustNewConstMetric(c.status, prometheus.GaugeValue, float64(count), status)
+		}
+	}
+
+	versions, err := c.repo.CountVersions(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.versions, err)
+		return
+	}
+	for _, v := range versions {
+		ch <- prometheus.MustNewConstMetric(c.versions, prometheus.GaugeValue, float64(v.Instances), v.Product, v.Version)
+	}
+}
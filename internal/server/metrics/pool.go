@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+)
+
+// poolCollector reports PostgreSQL connection pool statistics
+type poolCollector struct {
+	db              *database.DB
+	maxConns        *prometheus.Desc
+	conns           *prometheus.Desc
+	acquires        *prometheus.Desc
+	emptyAcquires   *prometheus.Desc
+	canceledAcquire *prometheus.Desc
+	acquireDuration *prometheus.Desc
+}
+
+func newPoolCollector(db *database.DB) *poolCollector {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(namespace+"_db_pool_"+name, help, labels, nil)
+	}
+	return &poolCollector{
+		db:              db,
+		maxConns:        desc("max_connections", "Maximum size of the database connection pool."),
+		conns:           desc("connections", "Database connections by state.", "state"),
+		acquires:        desc("acquires_total", "Connections acquired from the pool."),
+		emptyAcquires:   desc("empty_acquires_total", "Acquires that waited because the pool had no idle connection."),
+		canceledAcquire: desc("canceled_acquires_total", "Acquires cancelled while waiting for a connection."),
+		acquireDuration: desc("acquire_duration_seconds_total", "Total time spent acquiring connections."),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxConns
+	ch <- c.conns
+	ch <- c.acquires
+	ch <- c.emptyAcquires
+	ch <- c.canceledAcquire
+	ch <- c.acquireDuration
+}
+
+// Collect implements prometheus.Collector
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.db.Pool.Stat()
+
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.conns, prometheus.GaugeValue, float64(stat.AcquiredConns()), "in_use")
+	ch <- prometheus.MustNewConstMetric(c.conns, prometheus.GaugeValue, float64(stat.IdleConns()), "idle")
+	ch <- prometheus.MustNewConstMetric(c.conns, prometheus.GaugeValue, float64(stat.ConstructingConns()), "constructing")
+	ch <- prometheus.MustNewConstMetric(c.acquires, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquires, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquire, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+}
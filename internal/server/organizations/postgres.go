@@ -0,0 +1,190 @@
+package organizations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// PostgresRepository stores organizations in PostgreSQL
+type PostgresRepository struct {
+	db *database.DB
+}
+
+// NewPostgresRepository creates a repository backed by PostgreSQL
+func NewPostgresRepository(db *database.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+// Create creates a new organization
+func (r *PostgresRepository) Create(ctx context.Context, org *types.Organization) error {
+	err := r.db.Pool.QueryRow(ctx, `
+		INSERT INTO organizations (slug, name)
+		VALUES ($1, $2)
+		RETURNING id, created_at, updated_at
+	`, org.Slug, org.Name).Scan(&org.ID, &org.CreatedAt, &org.UpdatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrOrganizationExists
+		}
+		return fmt.Errorf("failed to create organization: %w", err)
+	}
+	return nil
+}
+
+// GetByID retrieves an organization by ID
+func (r *PostgresRepository) GetByID(ctx context.Context, id string) (*types.Organization, error) {
+	return r.get(ctx, `id::text = $1`, id)
+}
+
+// GetBySlug retrieves an organization by slug
+func (r *PostgresRepository) GetBySlug(ctx context.Context, slug string) (*types.Organization, error) {
+	return r.get(ctx, `slug = $1`, slug)
+}
+
+func (r *PostgresRepository) get(ctx context.Context, condition string, value string) (*types.Organization, error) {
+	var org types.Organization
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT id, slug, name, created_at, updated_at
+		FROM organizations
+		WHERE `+condition, value).Scan(&org.ID, &org.Slug, &org.Name, &org.CreatedAt, &org.UpdatedAt)
+
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+
+	return &org, nil
+}
+
+// List retrieves organizations, limited to ids unless ids is nil
+func (r *PostgresRepository) List(ctx context.Context, ids []string) ([]types.Organization, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT id, slug, name, created_at, updated_at
+		FROM organizations
+		WHERE $1::text[] IS NULL OR id::text = ANY($1)
+		ORDER BY name
+	`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+	defer rows.Close()
+
+	orgs := []types.Organization{}
+	for rows.Next() {
+		var org types.Organization
+		if err := rows.Scan(&org.ID, &org.Slug, &org.Name, &org.CreatedAt, &org.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan organization: %w", err)
+		}
+		orgs = append(orgs, org)
+	}
+
+	return orgs, rows.Err()
+}
+
+// Update renames an organization
+func (r *PostgresRepository) Update(ctx context.Context, org *types.Organization) error {
+	return r.db.Pool.QueryRow(ctx, `
+		UPDATE organizations SET name = $2
+		WHERE id = $1
+		RETURNING updated_at
+	`, org.ID, org.Name).Scan(&org.UpdatedAt)
+}
+
+// Delete deletes an organization. It fails while the organization still owns licenses.
+func (r *PostgresRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.Pool.Exec(ctx, `DELETE FROM organizations WHERE id = $1`, id)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return ErrOrganizationInUse
+		}
+		return fmt.Errorf("failed to delete organization: %w", err)
+	}
+	return nil
+}
+
+// ListMembers retrieves the users of an organization
+func (r *PostgresRepository) ListMembers(ctx context.Context, orgID string) ([]types.OrganizationMember, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT u.id, u.email, u.name, u.role, m.created_at
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = $1
+		ORDER BY u.email
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organization members: %w", err)
+	}
+	defer rows.Close()
+
+	members := []types.OrganizationMember{}
+	for rows.Next() {
+		var member types.OrganizationMember
+		if err := rows.Scan(&member.UserID, &member.Email, &member.Name, &member.Role, &member.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan organization member: %w", err)
+		}
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+// AddMember gives a user access to an organization
+func (r *PostgresRepository) AddMember(ctx context.Context, orgID, userID string) error {
+	_, err := r.db.Pool.Exec(ctx, `
+		INSERT INTO organization_members (organization_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (organization_id, user_id) DO NOTHING
+	`, orgID, userID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && (pgErr.Code == "23503" || pgErr.Code == "22P02") {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("failed to add organization member: %w", err)
+	}
+	return nil
+}
+
+// RemoveMember removes a user from an organization, reporting whether they were a member
+func (r *PostgresRepository) RemoveMember(ctx context.Context, orgID, userID string) (bool, error) {
+	result, err := r.db.Pool.Exec(ctx, `
+		DELETE FROM organization_members WHERE organization_id = $1 AND user_id::text = $2
+	`, orgID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove organization member: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// UserOrganizationIDs retrieves the IDs of the organizations a user belongs to
+func (r *PostgresRepository) UserOrganizationIDs(ctx context.Context, userID string) ([]string, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT organization_id FROM organization_members WHERE user_id::text = $1
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user organizations: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan user organization: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
@@ -0,0 +1,40 @@
+package organizations
+
+import (
+	"context"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// Repository handles organization database operations
+type Repository interface {
+	// Create creates a new organization
+	Create(ctx context.Context, org *types.Organization) error
+	// GetByID retrieves an organization by ID, or nil if there is none
+	GetByID(ctx context.Context, id string) (*types.Organization, error)
+	// GetBySlug retrieves an organization by slug, or nil if there is none
+	GetBySlug(ctx context.Context, slug string) (*types.Organization, error)
+	// List retrieves organizations, limited to ids unless ids is nil
+	List(ctx context.Context, ids []string) ([]types.Organization, error)
+	// Update renames an organization
+	Update(ctx context.Context, org *types.Organization) error
+	// Delete deletes an organization. It fails while the organization still owns licenses.
+	Delete(ctx context.Context, id string) error
+	// ListMembers retrieves the users of an organization
+	ListMembers(ctx context.Context, orgID string) ([]types.OrganizationMember, error)
+	// AddMember gives a user access to an organization
+	AddMember(ctx context.Context, orgID, userID string) error
+	// RemoveMember removes a user from an organization, reporting whether they were a member
+	RemoveMember(ctx context.Context, orgID, userID string) (bool, error)
+	// UserOrganizationIDs retrieves the IDs of the organizations a user belongs to
+	UserOrganizationIDs(ctx context.Context, userID string) ([]string, error)
+}
+
+// NewRepository creates an organization repository for the configured database
+func NewRepository(db *database.DB) Repository {
+	if db.Driver == database.DriverSQLite {
+		return NewSQLiteRepository(db)
+	}
+	return NewPostgresRepository(db)
+}
@@ -0,0 +1,126 @@
+package organizations
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/auth"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database/dbtest"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+func TestRepository(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		ctx := context.Background()
+		repo := NewRepository(db)
+
+		acme := &types.Organization{Slug: "acme", Name: "Acme"}
+		globex := &types.Organization{Slug: "globex", Name: "Globex"}
+		for _, org := range []*types.Organization{acme, globex} {
+			if err := repo.Create(ctx, org); err != nil {
+				t.Fatalf("Create %s: %v", org.Slug, err)
+			}
+		}
+		if err := repo.Create(ctx, &types.Organization{Slug: "acme", Name: "Acme again"}); !errors.Is(err, ErrOrganizationExists) {
+			t.Errorf("Create(duplicate slug) = %v, want ErrOrganizationExists", err)
+		}
+
+		got, err := repo.GetBySlug(ctx, "acme")
+		if err != nil || got == nil || got.ID != acme.ID || got.Name != "Acme" {
+			t.Fatalf("GetBySlug = %+v, %v", got, err)
+		}
+		if missing, err := repo.GetByID(ctx, "00000000-0000-0000-0000-000000000000"); err != nil || missing != nil {
+			t.Errorf("GetByID(missing) = %v, %v; want nil, nil", missing, err)
+		}
+
+		acme.Name = "Acme Corp"
+		if err := repo.Update(ctx, acme); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		if renamed, _ := repo.GetByID(ctx, acme.ID); renamed == nil || renamed.Name != "Acme Corp" {
+			t.Errorf("after Update = %+v", renamed)
+		}
+
+		tests := []struct {
+			name string
+			ids  []string
+			want []string
+		}{
+			{"all", nil, []string{"acme", "globex"}},
+			{"scoped", []string{globex.ID}, []string{"globex"}},
+			{"empty scope", []string{}, nil},
+		}
+		for _, tt := range tests {
+			list, err := repo.List(ctx, tt.ids)
+			if err != nil {
+				t.Fatalf("List(%s): %v", tt.name, err)
+			}
+			var slugs []string
+			for _, org := range list {
+				slugs = append(slugs, org.Slug)
+			}
+			if !slices.Equal(slugs, tt.want) {
+				t.Errorf("List(%s) = %v, want %v", tt.name, slugs, tt.want)
+			}
+		}
+
+		if err := repo.Delete(ctx, globex.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if deleted, _ := repo.GetByID(ctx, globex.ID); deleted != nil {
+			t.Error("organization still exists after Delete")
+		}
+	})
+}
+
+func TestRepositoryMembers(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		ctx := context.Background()
+		repo := NewRepository(db)
+
+		org := &types.Organization{Slug: "acme", Name: "Acme"}
+		if err := repo.Create(ctx, org); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		user, err := auth.NewRepository(db).CreateUser(ctx, "member@example.com", "hash", "Member", "viewer")
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+
+		if err := repo.AddMember(ctx, org.ID, user.ID); err != nil {
+			t.Fatalf("AddMember: %v", err)
+		}
+		members, err := repo.ListMembers(ctx, org.ID)
+		if err != nil {
+			t.Fatalf("ListMembers: %v", err)
+		}
+		if len(members) != 1 || members[0].UserID != user.ID || members[0].Email != "member@example.com" {
+			t.Errorf("ListMembers = %+v", members)
+		}
+
+		ids, err := repo.UserOrganizationIDs(ctx, user.ID)
+		if err != nil || !slices.Equal(ids, []string{org.ID}) {
+			t.Errorf("UserOrganizationIDs = %v, %v; want [%s]", ids, err, org.ID)
+		}
+
+		tests := []struct {
+			name string
+			want bool
+		}{
+			{"member", true},
+			{"no longer a member", false},
+		}
+		for _, tt := range tests {
+			removed, err := repo.RemoveMember(ctx, org.ID, user.ID)
+			if err != nil || removed != tt.want {
+				t.Errorf("RemoveMember(%s) = %v, %v; want %v", tt.name, removed, err, tt.want)
+			}
+		}
+		if ids, _ := repo.UserOrganizationIDs(ctx, user.ID); len(ids) != 0 {
+			t.Errorf("UserOrganizationIDs after RemoveMember = %v", ids)
+		}
+	})
+}
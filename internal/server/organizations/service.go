@@ -0,0 +1,223 @@
+package organizations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+var (
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrOrganizationExists   = errors.New("organization already exists")
+	ErrOrganizationInUse    = errors.New("organization still owns licenses")
+	ErrInvalidOrganization  = errors.New("invalid organization")
+	ErrMemberNotFound       = errors.New("user is not a member of the organization")
+	ErrUserNotFound         = errors.New("user not found")
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// Service handles organizations and their members.
+//
+// Access to organization data is described by a scope: the IDs of the organizations
+// a caller may see, or nil when the caller may see every organization.
+type Service struct {
+	repo Repository
+}
+
+// NewService creates a new organization service
+func NewService(db *database.DB) *Service {
+	return &Service{repo: NewRepository(db)}
+}
+
+// CreateOrganizationRequest creates an organization
+type CreateOrganizationRequest struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+// InScope reports whether an organization is within scope
+func InScope(scope []string, orgID string) bool {
+	if scope == nil {
+		return true
+	}
+	for _, id := range scope {
+		if id == orgID {
+			return true
+		}
+	}
+	return false
+}
+
+// Narrow limits scope to a single organization, e.g. from an ?organization_id= filter
+func Narrow(scope []string, orgID string) []string {
+	if orgID == "" {
+		return scope
+	}
+	if !InScope(scope, orgID) {
+		return []string{}
+	}
+	return []string{orgID}
+}
+
+// UserScope returns the organizations a user belongs to
+func (s *Service) UserScope(ctx context.Context, userID string) ([]string, error) {
+	return s.repo.UserOrganizationIDs(ctx, userID)
+}
+
+// ListOrganizations retrieves the organizations within scope
+func (s *Service) ListOrganizations(ctx context.Context, scope []string) ([]types.Organization, error) {
+	return s.repo.List(ctx, scope)
+}
+
+// GetOrganization retrieves an organization within scope
+func (s *Service) GetOrganization(ctx context.Context, scope []string, id string) (*types.Organization, error) {
+	if !InScope(scope, id) {
+		return nil, ErrOrganizationNotFound
+	}
+
+	org, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if org == nil {
+		return nil, ErrOrganizationNotFound
+	}
+	return org, nil
+}
+
+// CreateOrganization creates an organization
+func (s *Service) CreateOrganization(ctx context.Context, req CreateOrganizationRequest) (*types.Organization, error) {
+	org := &types.Organization{
+		Slug: strings.ToLower(strings.TrimSpace(req.Slug)),
+		Name: strings.TrimSpace(req.Name),
+	}
+	if org.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidOrganization)
+	}
+	if org.Slug == "" {
+		org.Slug = slugify(org.Name)
+	}
+	if !slugPattern.MatchString(org.Slug) || len(org.Slug) > 100 {
+		return nil, fmt.Errorf("%w: slug may only contain lowercase letters, digits, dots, dashes and underscores", ErrInvalidOrganization)
+	}
+
+	if err := s.repo.Create(ctx, org); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+// RenameOrganization changes the display name of an organization within scope
+func (s *Service) RenameOrganization(ctx context.Context, scope []string, id, name string) (*types.Organization, error) {
+	org, err := s.GetOrganization(ctx, scope, id)
+	if err != nil {
+		return nil, err
+	}
+
+	org.Name = strings.TrimSpace(name)
+	if org.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidOrganization)
+	}
+	if err := s.repo.Update(ctx, org); err != nil {
+		return nil, fmt.Errorf("failed to update organization: %w", err)
+	}
+	return org, nil
+}
+
+// DeleteOrganization deletes an organization that no longer owns licenses
+func (s *Service) DeleteOrganization(ctx context.Context, scope []string, id string) error {
+	org, err := s.GetOrganization(ctx, scope, id)
+	if err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, org.ID)
+}
+
+// ListMembers retrieves the members of an organization within scope
+func (s *Service) ListMembers(ctx context.Context, scope []string, id string) ([]types.OrganizationMember, error) {
+	org, err := s.GetOrganization(ctx, scope, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.ListMembers(ctx, org.ID)
+}
+
+// AddMember gives a user access to an organization within scope
+func (s *Service) AddMember(ctx context.Context, scope []string, id, userID string) error {
+	org, err := s.GetOrganization(ctx, scope, id)
+	if err != nil {
+		return err
+	}
+	return s.repo.AddMember(ctx, org.ID, userID)
+}
+
+// RemoveMember removes a user from an organization within scope
+func (s *Service) RemoveMember(ctx context.Context, scope []string, id, userID string) error {
+	org, err := s.GetOrganization(ctx, scope, id)
+	if err != nil {
+		return err
+	}
+
+	removed, err := s.repo.RemoveMember(ctx, org.ID, userID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrMemberNotFound
+	}
+	return nil
+}
+
+// ResolveForLicense returns the organization a new license belongs to: the given
+// organization, or else the one whose slug is the customer ID, which is created
+// when it does not exist yet
+func (s *Service) ResolveForLicense(ctx context.Context, orgID, customerID, customerName string) (*types.Organization, error) {
+	if orgID != "" {
+		return s.GetOrganization(ctx, nil, orgID)
+	}
+
+	org, err := s.repo.GetBySlug(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	if org != nil {
+		return org, nil
+	}
+
+	if customerID == "" || customerName == "" {
+		return nil, fmt.Errorf("%w: organization_id, or customer_id and customer_name, are required", ErrInvalidOrganization)
+	}
+
+	// Customer IDs are kept as they are, so existing license payloads stay valid
+	org = &types.Organization{Slug: customerID, Name: customerName}
+	if err := s.repo.Create(ctx, org); err != nil {
+		if errors.Is(err, ErrOrganizationExists) {
+			// Created concurrently
+			return s.repo.GetBySlug(ctx, customerID)
+		}
+		return nil, err
+	}
+	return org, nil
+}
+
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+			dash = false
+		case !dash && b.Len() > 0:
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimRight(b.String(), "-")
+}
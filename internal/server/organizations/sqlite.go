@@ -0,0 +1,196 @@
+package organizations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// SQLiteRepository stores organizations in a SQLite database
+type SQLiteRepository struct {
+	db *database.SQLite
+}
+
+// NewSQLiteRepository creates a repository backed by SQLite
+func NewSQLiteRepository(db *database.DB) *SQLiteRepository {
+	return &SQLiteRepository{db: db.SQLite}
+}
+
+// Create implements Repository
+func (r *SQLiteRepository) Create(ctx context.Context, org *types.Organization) error {
+	org.ID = uuid.New().String()
+	org.CreatedAt = time.Now()
+	org.UpdatedAt = org.CreatedAt
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO organizations (id, slug, name, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, org.ID, org.Slug, org.Name, org.CreatedAt, org.UpdatedAt)
+	if err != nil {
+		if database.IsUniqueViolation(err) {
+			return ErrOrganizationExists
+		}
+		return fmt.Errorf("failed to create organization: %w", err)
+	}
+	return nil
+}
+
+// GetByID implements Repository
+func (r *SQLiteRepository) GetByID(ctx context.Context, id string) (*types.Organization, error) {
+	return r.get(ctx, `id = $1`, id)
+}
+
+// GetBySlug implements Repository
+func (r *SQLiteRepository) GetBySlug(ctx context.Context, slug string) (*types.Organization, error) {
+	return r.get(ctx, `slug = $1`, slug)
+}
+
+func (r *SQLiteRepository) get(ctx context.Context, condition string, value string) (*types.Organization, error) {
+	var org types.Organization
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, slug, name, created_at, updated_at
+		FROM organizations
+		WHERE `+condition, value).Scan(&org.ID, &org.Slug, &org.Name, &org.CreatedAt, &org.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+
+	return &org, nil
+}
+
+// List implements Repository
+func (r *SQLiteRepository) List(ctx context.Context, ids []string) ([]types.Organization, error) {
+	var idList interface{}
+	if ids != nil {
+		idList = database.StringList(ids)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, slug, name, created_at, updated_at
+		FROM organizations
+		WHERE $1 IS NULL OR id IN (SELECT value FROM json_each($1))
+		ORDER BY name
+	`, idList)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+	defer rows.Close()
+
+	orgs := []types.Organization{}
+	for rows.Next() {
+		var org types.Organization
+		if err := rows.Scan(&org.ID, &org.Slug, &org.Name, &org.CreatedAt, &org.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan organization: %w", err)
+		}
+		orgs = append(orgs, org)
+	}
+
+	return orgs, rows.Err()
+}
+
+// Update implements Repository
+func (r *SQLiteRepository) Update(ctx context.Context, org *types.Organization) error {
+	return r.db.QueryRowContext(ctx, `
+		UPDATE organizations SET name = $2, updated_at = $3
+		WHERE id = $1
+		RETURNING updated_at
+	`, org.ID, org.Name, time.Now()).Scan(&org.UpdatedAt)
+}
+
+// Delete implements Repository
+func (r *SQLiteRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM organizations WHERE id = $1`, id)
+	if err != nil {
+		if database.IsForeignKeyViolation(err) {
+			return ErrOrganizationInUse
+		}
+		return fmt.Errorf("failed to delete organization: %w", err)
+	}
+	return nil
+}
+
+// ListMembers implements Repository
+func (r *SQLiteRepository) ListMembers(ctx context.Context, orgID string) ([]types.OrganizationMember, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT u.id, u.email, u.name, u.role, m.created_at
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = $1
+		ORDER BY u.email
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organization members: %w", err)
+	}
+	defer rows.Close()
+
+	members := []types.OrganizationMember{}
+	for rows.Next() {
+		var member types.OrganizationMember
+		if err := rows.Scan(&member.UserID, &member.Email, &member.Name, &member.Role, &member.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan organization member: %w", err)
+		}
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+// AddMember implements Repository
+func (r *SQLiteRepository) AddMember(ctx context.Context, orgID, userID string) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO organization_members (organization_id, user_id, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (organization_id, user_id) DO NOTHING
+	`, orgID, userID, time.Now())
+	if err != nil {
+		if database.IsForeignKeyViolation(err) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("failed to add organization member: %w", err)
+	}
+	return nil
+}
+
+// RemoveMember implements Repository
+func (r *SQLiteRepository) RemoveMember(ctx context.Context, orgID, userID string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		DELETE FROM organization_members WHERE organization_id = $1 AND user_id = $2
+	`, orgID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove organization member: %w", err)
+	}
+	removed, err := result.RowsAffected()
+	return removed > 0, err
+}
+
+// UserOrganizationIDs implements Repository
+func (r *SQLiteRepository) UserOrganizationIDs(ctx context.Context, userID string) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT organization_id FROM organization_members WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user organizations: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan user organization: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
@@ -0,0 +1,119 @@
+package products
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// PostgresRepository stores products in PostgreSQL
+type PostgresRepository struct {
+	db *database.DB
+}
+
+// NewPostgresRepository creates a repository backed by PostgreSQL
+func NewPostgresRepository(db *database.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+// Create creates a new product
+func (r *PostgresRepository) Create(ctx context.Context, product *types.Product) error {
+	product.ID = uuid.New().String()
+	product.CreatedAt = time.Now()
+	product.UpdatedAt = time.Now()
+	if product.LicenseTypes == nil {
+		product.LicenseTypes = []string{}
+	}
+
+	_, err := r.db.Pool.Exec(ctx, `
+		INSERT INTO products (id, name, display_name, description, type, default_channel, install_path, health_endpoint, license_types, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), $9, $10, $11)
+	`, product.ID, product.Name, product.DisplayName, product.Description, product.Type, product.DefaultChannel,
+		product.InstallPath, product.HealthEndpoint, product.LicenseTypes, product.CreatedAt, product.UpdatedAt)
+
+	return err
+}
+
+// GetByName retrieves a product by its name
+func (r *PostgresRepository) GetByName(ctx context.Context, name string) (*types.Product, error) {
+	var product types.Product
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT `+productColumns+`
+		FROM products
+		WHERE name = $1
+	`, name).Scan(
+		&product.ID, &product.Name, &product.DisplayName, &product.Description, &product.Type,
+		&product.DefaultChannel, &product.InstallPath, &product.HealthEndpoint, &product.LicenseTypes,
+		&product.CreatedAt, &product.UpdatedAt)
+
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	return &product, nil
+}
+
+// List retrieves all products
+func (r *PostgresRepository) List(ctx context.Context) ([]types.Product, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT `+productColumns+`
+		FROM products
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list products: %w", err)
+	}
+	defer rows.Close()
+
+	var products []types.Product
+	for rows.Next() {
+		var product types.Product
+		err := rows.Scan(
+			&product.ID, &product.Name, &product.DisplayName, &product.Description, &product.Type,
+			&product.DefaultChannel, &product.InstallPath, &product.HealthEndpoint, &product.LicenseTypes,
+			&product.CreatedAt, &product.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan product: %w", err)
+		}
+		products = append(products, product)
+	}
+
+	return products, nil
+}
+
+// Update updates a product
+func (r *PostgresRepository) Update(ctx context.Context, product *types.Product) error {
+	product.UpdatedAt = time.Now()
+
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE products
+		SET display_name = $2, description = $3, type = $4, default_channel = $5,
+			install_path = NULLIF($6, ''), health_endpoint = NULLIF($7, ''), license_types = $8, updated_at = $9
+		WHERE id = $1
+	`, product.ID, product.DisplayName, product.Description, product.Type, product.DefaultChannel,
+		product.InstallPath, product.HealthEndpoint, product.LicenseTypes, product.UpdatedAt)
+
+	return err
+}
+
+// Delete deletes a product
+func (r *PostgresRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.Pool.Exec(ctx, `DELETE FROM products WHERE id = $1`, id)
+	return err
+}
+
+// CountReleases returns the number of releases published for a product
+func (r *PostgresRepository) CountReleases(ctx context.Context, name string) (int, error) {
+	var count int
+	err := r.db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM releases WHERE product_name = $1`, name).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,35 @@
+package products
+
+import (
+	"context"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+const productColumns = `id, name, display_name, COALESCE(description, ''), type, COALESCE(default_channel, 'stable'),
+	COALESCE(install_path, ''), COALESCE(health_endpoint, ''), license_types, created_at, updated_at`
+
+// Repository handles product database operations
+type Repository interface {
+	// Create creates a new product
+	Create(ctx context.Context, product *types.Product) error
+	// GetByName retrieves a product by its name, or nil if there is none
+	GetByName(ctx context.Context, name string) (*types.Product, error)
+	// List retrieves all products
+	List(ctx context.Context) ([]types.Product, error)
+	// Update updates a product
+	Update(ctx context.Context, product *types.Product) error
+	// Delete deletes a product
+	Delete(ctx context.Context, id string) error
+	// CountReleases returns the number of releases published for a product
+	CountReleases(ctx context.Context, name string) (int, error)
+}
+
+// NewRepository creates a product repository for the configured database
+func NewRepository(db *database.DB) Repository {
+	if db.Driver == database.DriverSQLite {
+		return NewSQLiteRepository(db)
+	}
+	return NewPostgresRepository(db)
+}
@@ -0,0 +1,80 @@
+package products
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database/dbtest"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+func TestRepository(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		ctx := context.Background()
+		repo := NewRepository(db)
+
+		product := &types.Product{
+			Name:           "test-agent",
+			DisplayName:    "Test Agent",
+			Type:           "binary",
+			DefaultChannel: "beta",
+			InstallPath:    "bin/test-agent",
+			LicenseTypes:   []string{"siemcore", "mysoc-cloud"},
+		}
+		if err := repo.Create(ctx, product); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if product.ID == "" {
+			t.Fatal("Create did not set the ID")
+		}
+		if err := repo.Create(ctx, &types.Product{Name: "test-agent", DisplayName: "Again", Type: "binary", DefaultChannel: "stable"}); err == nil {
+			t.Error("Create accepted a duplicate name")
+		}
+
+		got, err := repo.GetByName(ctx, "test-agent")
+		if err != nil || got == nil {
+			t.Fatalf("GetByName = %v, %v", got, err)
+		}
+		if got.DisplayName != "Test Agent" || got.DefaultChannel != "beta" || got.InstallPath != "bin/test-agent" ||
+			got.HealthEndpoint != "" || !slices.Equal(got.LicenseTypes, product.LicenseTypes) {
+			t.Errorf("GetByName = %+v, want %+v", got, product)
+		}
+
+		missing, err := repo.GetByName(ctx, "no-such-product")
+		if err != nil || missing != nil {
+			t.Errorf("GetByName(missing) = %v, %v; want nil, nil", missing, err)
+		}
+
+		got.DisplayName = "Renamed"
+		got.HealthEndpoint = "http://localhost:9000/health"
+		got.LicenseTypes = nil
+		if err := repo.Update(ctx, got); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		updated, _ := repo.GetByName(ctx, "test-agent")
+		if updated.DisplayName != "Renamed" || updated.HealthEndpoint != "http://localhost:9000/health" || len(updated.LicenseTypes) != 0 {
+			t.Errorf("after Update = %+v", updated)
+		}
+
+		list, err := repo.List(ctx)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if !slices.ContainsFunc(list, func(p types.Product) bool { return p.Name == "test-agent" }) {
+			t.Error("List does not include the created product")
+		}
+
+		if count, err := repo.CountReleases(ctx, "test-agent"); err != nil || count != 0 {
+			t.Errorf("CountReleases = %d, %v; want 0", count, err)
+		}
+
+		if err := repo.Delete(ctx, product.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if deleted, _ := repo.GetByName(ctx, "test-agent"); deleted != nil {
+			t.Error("product still exists after Delete")
+		}
+	})
+}
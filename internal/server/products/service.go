@@ -0,0 +1,238 @@
+package products
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+var (
+	ErrProductNotFound    = errors.New("product not found")
+	ErrProductExists      = errors.New("product already exists")
+	ErrProductHasReleases = errors.New("product has releases")
+	ErrInvalidProduct     = errors.New("invalid product")
+)
+
+var (
+	productNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+	productTypes       = []string{"binary", "data", "config"}
+	channels           = []string{"stable", "beta", "nightly"}
+)
+
+// Service handles product registry business logic
+type Service struct {
+	repo Repository
+}
+
+// NewService creates a new product service
+func NewService(db *database.DB) *Service {
+	return &Service{
+		repo: NewRepository(db),
+	}
+}
+
+// CreateProductRequest is the request to register a product
+type CreateProductRequest struct {
+	Name           string   `json:"name"`
+	DisplayName    string   `json:"display_name"`
+	Description    string   `json:"description"`
+	Type           string   `json:"type"` // binary, data, config
+	DefaultChannel string   `json:"default_channel"`
+	InstallPath    string   `json:"install_path"`
+	HealthEndpoint string   `json:"health_endpoint"`
+	LicenseTypes   []string `json:"license_types"`
+}
+
+// UpdateProductRequest updates a registered product; nil fields are left unchanged
+type UpdateProductRequest struct {
+	DisplayName    *string  `json:"display_name,omitempty"`
+	Description    *string  `json:"description,omitempty"`
+	Type           *string  `json:"type,omitempty"`
+	DefaultChannel *string  `json:"default_channel,omitempty"`
+	InstallPath    *string  `json:"install_path,omitempty"`
+	HealthEndpoint *string  `json:"health_endpoint,omitempty"`
+	LicenseTypes   []string `json:"license_types,omitempty"`
+}
+
+// CreateProduct registers a new product
+func (s *Service) CreateProduct(ctx context.Context, req CreateProductRequest) (*types.Product, error) {
+	if !productNamePattern.MatchString(req.Name) {
+		return nil, fmt.Errorf("%w: name must be lowercase alphanumeric with '-', '_' or '.'", ErrInvalidProduct)
+	}
+
+	existing, err := s.repo.GetByName(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrProductExists
+	}
+
+	product := &types.Product{
+		Name:           req.Name,
+		DisplayName:    req.DisplayName,
+		Description:    req.Description,
+		Type:           req.Type,
+		DefaultChannel: req.DefaultChannel,
+		InstallPath:    req.InstallPath,
+		HealthEndpoint: req.HealthEndpoint,
+		LicenseTypes:   req.LicenseTypes,
+	}
+	if product.DisplayName == "" {
+		product.DisplayName = product.Name
+	}
+	if product.Type == "" {
+		product.Type = "binary"
+	}
+	if product.DefaultChannel == "" {
+		product.DefaultChannel = "stable"
+	}
+	if product.InstallPath == "" {
+		product.InstallPath = DefaultInstallPath(product.Name, product.Type)
+	}
+
+	if err := validate(product); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Create(ctx, product); err != nil {
+		return nil, fmt.Errorf("failed to create product: %w", err)
+	}
+
+	return product, nil
+}
+
+// GetProduct retrieves a product by name
+func (s *Service) GetProduct(ctx context.Context, name string) (*types.Product, error) {
+	return s.repo.GetByName(ctx, name)
+}
+
+// ListProducts retrieves all registered products
+func (s *Service) ListProducts(ctx context.Context) ([]types.Product, error) {
+	return s.repo.List(ctx)
+}
+
+// ListForLicenseType retrieves the products installed by default for a license type
+func (s *Service) ListForLicenseType(ctx context.Context, licenseType string) ([]types.Product, error) {
+	all, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var products []types.Product
+	for _, p := range all {
+		if contains(p.LicenseTypes, licenseType) {
+			products = append(products, p)
+		}
+	}
+	return products, nil
+}
+
+// UpdateProduct applies changes to a registered product
+func (s *Service) UpdateProduct(ctx context.Context, name string, req UpdateProductRequest) (*types.Product, error) {
+	product, err := s.repo.GetByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, ErrProductNotFound
+	}
+
+	if req.DisplayName != nil {
+		product.DisplayName = *req.DisplayName
+	}
+	if req.Description != nil {
+		product.Description = *req.Description
+	}
+	if req.Type != nil {
+		product.Type = *req.Type
+	}
+	if req.DefaultChannel != nil {
+		product.DefaultChannel = *req.DefaultChannel
+	}
+	if req.InstallPath != nil {
+		product.InstallPath = *req.InstallPath
+	}
+	if req.HealthEndpoint != nil {
+		product.HealthEndpoint = *req.HealthEndpoint
+	}
+	if req.LicenseTypes != nil {
+		product.LicenseTypes = req.LicenseTypes
+	}
+
+	if err := validate(product); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Update(ctx, product); err != nil {
+		return nil, fmt.Errorf("failed to update product: %w", err)
+	}
+
+	return product, nil
+}
+
+// DeleteProduct removes a product that has no releases
+func (s *Service) DeleteProduct(ctx context.Context, name string) error {
+	product, err := s.repo.GetByName(ctx, name)
+	if err != nil {
+		return err
+	}
+	if product == nil {
+		return ErrProductNotFound
+	}
+
+	count, err := s.repo.CountReleases(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to count releases: %w", err)
+	}
+	if count > 0 {
+		return ErrProductHasReleases
+	}
+
+	return s.repo.Delete(ctx, product.ID)
+}
+
+// IsValidChannel reports whether channel is a known release channel
+func IsValidChannel(channel string) bool {
+	return contains(channels, channel)
+}
+
+// DefaultInstallPath returns where a product is installed when the registry does not say
+func DefaultInstallPath(name, productType string) string {
+	switch productType {
+	case "data":
+		return "rules/" + name
+	case "config":
+		return "etc/" + name
+	default:
+		return "bin/" + name
+	}
+}
+
+func validate(product *types.Product) error {
+	if !contains(productTypes, product.Type) {
+		return fmt.Errorf("%w: type must be one of binary, data, config", ErrInvalidProduct)
+	}
+	if !IsValidChannel(product.DefaultChannel) {
+		return fmt.Errorf("%w: default_channel must be one of stable, beta, nightly", ErrInvalidProduct)
+	}
+	if path.IsAbs(product.InstallPath) || strings.HasPrefix(path.Clean(product.InstallPath), "..") {
+		return fmt.Errorf("%w: install_path must be relative to the instance base dir", ErrInvalidProduct)
+	}
+	return nil
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
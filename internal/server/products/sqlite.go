@@ -0,0 +1,124 @@
+package products
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// SQLiteRepository stores products in a SQLite database
+type SQLiteRepository struct {
+	db *database.SQLite
+}
+
+// NewSQLiteRepository creates a repository backed by SQLite
+func NewSQLiteRepository(db *database.DB) *SQLiteRepository {
+	return &SQLiteRepository{db: db.SQLite}
+}
+
+func scanProduct(row database.Row) (*types.Product, error) {
+	var product types.Product
+	err := row.Scan(
+		&product.ID, &product.Name, &product.DisplayName, &product.Description, &product.Type,
+		&product.DefaultChannel, &product.InstallPath, &product.HealthEndpoint,
+		(*database.StringList)(&product.LicenseTypes), &product.CreatedAt, &product.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// Create implements Repository
+func (r *SQLiteRepository) Create(ctx context.Context, product *types.Product) error {
+	product.ID = uuid.New().String()
+	product.CreatedAt = time.Now()
+	product.UpdatedAt = time.Now()
+	if product.LicenseTypes == nil {
+		product.LicenseTypes = []string{}
+	}
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO products (id, name, display_name, description, type, default_channel, install_path, health_endpoint, license_types, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), $9, $10, $11)
+	`, product.ID, product.Name, product.DisplayName, product.Description, product.Type, product.DefaultChannel,
+		product.InstallPath, product.HealthEndpoint, database.StringList(product.LicenseTypes),
+		product.CreatedAt, product.UpdatedAt)
+
+	return err
+}
+
+// GetByName implements Repository
+func (r *SQLiteRepository) GetByName(ctx context.Context, name string) (*types.Product, error) {
+	product, err := scanProduct(r.db.QueryRowContext(ctx, `
+		SELECT `+productColumns+`
+		FROM products
+		WHERE name = $1
+	`, name))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	return product, nil
+}
+
+// List implements Repository
+func (r *SQLiteRepository) List(ctx context.Context) ([]types.Product, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+productColumns+`
+		FROM products
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list products: %w", err)
+	}
+	defer rows.Close()
+
+	var products []types.Product
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan product: %w", err)
+		}
+		products = append(products, *product)
+	}
+
+	return products, rows.Err()
+}
+
+// Update implements Repository
+func (r *SQLiteRepository) Update(ctx context.Context, product *types.Product) error {
+	product.UpdatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE products
+		SET display_name = $2, description = $3, type = $4, default_channel = $5,
+			install_path = NULLIF($6, ''), health_endpoint = NULLIF($7, ''), license_types = $8, updated_at = $9
+		WHERE id = $1
+	`, product.ID, product.DisplayName, product.Description, product.Type, product.DefaultChannel,
+		product.InstallPath, product.HealthEndpoint, database.StringList(product.LicenseTypes), product.UpdatedAt)
+
+	return err
+}
+
+// Delete implements Repository
+func (r *SQLiteRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM products WHERE id = $1`, id)
+	return err
+}
+
+// CountReleases implements Repository
+func (r *SQLiteRepository) CountReleases(ctx context.Context, name string) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM releases WHERE product_name = $1`, name).Scan(&count)
+	return count, err
+}
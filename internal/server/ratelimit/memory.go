@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+)
+
+// MemoryStore keeps buckets in process memory. Each replica limits on its own.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+}
+
+type memoryBucket struct {
+	bucket
+	fullAt time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*memoryBucket)}
+}
+
+// Take implements Store
+func (s *MemoryStore) Take(ctx context.Context, key string, limit config.RateLimit) (bool, time.Duration, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{bucket: newBucket(limit, now)}
+		s.buckets[key] = b
+	}
+
+	allowed, retryAfter := b.take(limit, now)
+	b.fullAt = b.bucket.fullAt(limit)
+	return allowed, retryAfter, nil
+}
+
+// Cleanup implements Store
+func (s *MemoryStore) Cleanup(ctx context.Context) (int64, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var removed int64
+	for key, b := range s.buckets {
+		if !b.fullAt.After(now) {
+			delete(s.buckets, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
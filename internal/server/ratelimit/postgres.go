@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+)
+
+// PostgresStore keeps buckets in the rate_limit_buckets table, so every
+// replica shares the same limits
+type PostgresStore struct {
+	db *database.DB
+}
+
+// NewPostgresStore creates a store backed by the database
+func NewPostgresStore(db *database.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Take implements Store. The bucket row is locked while it is updated.
+func (s *PostgresStore) Take(ctx context.Context, key string, limit config.RateLimit) (bool, time.Duration, error) {
+	now := time.Now()
+	b := newBucket(limit, now)
+
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO rate_limit_buckets (key, tokens, updated_at, full_at)
+		VALUES ($1, $2, $3, $3)
+		ON CONFLICT (key) DO NOTHING
+	`, key, b.tokens, b.updated)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to create rate limit bucket: %w", err)
+	}
+
+	err = tx.QueryRow(ctx, `
+		SELECT tokens, updated_at FROM rate_limit_buckets WHERE key = $1 FOR UPDATE
+	`, key).Scan(&b.tokens, &b.updated)
+	if err != nil && err != pgx.ErrNoRows {
+		return false, 0, fmt.Errorf("failed to read rate limit bucket: %w", err)
+	}
+
+	allowed, retryAfter := b.take(limit, now)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE rate_limit_buckets SET tokens = $2, updated_at = $3, full_at = $4 WHERE key = $1
+	`, key, b.tokens, b.updated, b.fullAt(limit))
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to update rate limit bucket: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, 0, fmt.Errorf("failed to commit rate limit bucket: %w", err)
+	}
+
+	return allowed, retryAfter, nil
+}
+
+// Cleanup implements Store
+func (s *PostgresStore) Cleanup(ctx context.Context) (int64, error) {
+	result, err := s.db.Pool.Exec(ctx, `DELETE FROM rate_limit_buckets WHERE full_at <= NOW()`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove rate limit buckets: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,315 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/audit"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+)
+
+// Scopes a rule counts requests by
+const (
+	ScopeIP         = "ip"
+	ScopeLicenseKey = "license_key"
+)
+
+// ipv6ClientBits is the prefix length IPv6 clients are counted by
+const ipv6ClientBits = 64
+
+// maxPeekedBody bounds how much of a request body is read to find a license key
+const maxPeekedBody = 1 << 20
+
+// Rejections are recorded in the audit log at most once per client and rule
+// every rejectionAuditInterval, and for at most maxAuditedClients at a time,
+// so a flood of rejected requests cannot flood the hash-chained log with them
+const (
+	rejectionAuditInterval = time.Minute
+	maxAuditedClients      = 10000
+)
+
+// Rule limits requests per client. Routes given the same rule share its buckets.
+type Rule struct {
+	Name  string
+	Scope string
+	Limit config.RateLimit
+}
+
+// Store keeps token buckets
+type Store interface {
+	// Take removes a token from the bucket for key. When the bucket is empty
+	// it returns false and how long until a token is available.
+	Take(ctx context.Context, key string, limit config.RateLimit) (bool, time.Duration, error)
+	// Cleanup removes buckets that have refilled completely
+	Cleanup(ctx context.Context) (int64, error)
+}
+
+// Limiter applies rules to requests
+type Limiter struct {
+	store      Store
+	rejections *rejections
+}
+
+// New creates a limiter with the configured backend. It returns nil when rate
+// limiting is disabled; a nil limiter lets every request through.
+func New(cfg config.RateLimitConfig, db *database.DB) (*Limiter, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	switch cfg.Backend {
+	case "memory":
+		return &Limiter{store: NewMemoryStore(), rejections: newRejections()}, nil
+	case "postgres":
+		if db.Driver != database.DriverPostgres {
+			return nil, fmt.Errorf("rate limit backend postgres requires DB_DRIVER=postgres")
+		}
+		return &Limiter{store: NewPostgresStore(db), rejections: newRejections()}, nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend: %s", cfg.Backend)
+	}
+}
+
+// Middleware rejects requests that exceed any of rules with 429 Too Many
+// Requests and a Retry-After header, and records a sample of them in the
+// audit log. Requests are let through if the store fails.
+func (l *Limiter) Middleware(rules ...Rule) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, rule := range rules {
+				if !rule.Limit.Enabled() {
+					continue
+				}
+				client := clientKey(r, rule.Scope)
+				if client == "" {
+					continue
+				}
+
+				key := rule.Name + ":" + rule.Scope + ":" + client
+				allowed, retryAfter, err := l.store.Take(r.Context(), key, rule.Limit)
+				if err != nil {
+					log.Printf("Rate limit check failed for %s: %v", rule.Name, err)
+					continue
+				}
+				if !allowed {
+					audited, suppressed := l.rejections.sample(key, time.Now())
+					reject(w, r, rule, retryAfter, audited, suppressed)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RunCleanup removes refilled buckets and rejection samples every interval
+// until ctx is cancelled
+func (l *Limiter) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := l.store.Cleanup(ctx); err != nil {
+				log.Printf("Rate limit cleanup failed: %v", err)
+			}
+			l.rejections.cleanup(time.Now())
+		}
+	}
+}
+
+// reject answers a request over rule's limit. Only audited rejections are
+// recorded in the audit log, with how many were left out since the last one.
+func reject(w http.ResponseWriter, r *http.Request, rule Rule, retryAfter time.Duration, audited bool, suppressed int) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	if audited {
+		audit.SetTarget(r.Context(), "rate_limit", rule.Name+"/"+rule.Scope)
+		audit.SetAfter(r.Context(), map[string]interface{}{
+			"rule":        rule.Name,
+			"scope":       rule.Scope,
+			"limit":       rule.Limit.String(),
+			"retry_after": seconds,
+			"suppressed":  suppressed,
+		})
+		audit.Force(r.Context())
+	} else {
+		audit.Skip(r.Context())
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":       "too many requests",
+		"retry_after": seconds,
+	})
+}
+
+// rejections samples rejected requests for the audit log
+type rejections struct {
+	mu      sync.Mutex
+	clients map[string]*rejectionSample
+}
+
+// rejectionSample tracks the rejections of a client by a rule
+type rejectionSample struct {
+	audited    time.Time // when a rejection was last recorded
+	suppressed int       // rejections left out since then
+}
+
+func newRejections() *rejections {
+	return &rejections{clients: make(map[string]*rejectionSample)}
+}
+
+// sample reports whether a rejection of the client with bucket key should be
+// recorded and, if so, how many of its rejections were left out before it
+func (s *rejections) sample(key string, now time.Time) (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sample, ok := s.clients[key]
+	if !ok {
+		if len(s.clients) >= maxAuditedClients {
+			return false, 0
+		}
+		s.clients[key] = &rejectionSample{audited: now}
+		return true, 0
+	}
+	if now.Sub(sample.audited) < rejectionAuditInterval {
+		sample.suppressed++
+		return false, 0
+	}
+	suppressed := sample.suppressed
+	*sample = rejectionSample{audited: now}
+	return true, suppressed
+}
+
+// cleanup forgets clients last recorded more than an interval ago
+func (s *rejections) cleanup(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, sample := range s.clients {
+		if now.Sub(sample.audited) >= rejectionAuditInterval {
+			delete(s.clients, key)
+		}
+	}
+}
+
+// clientKey identifies the client a rule counts against, or returns "" when
+// the request has nothing to count by
+func clientKey(r *http.Request, scope string) string {
+	switch scope {
+	case ScopeIP:
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		addr, err := netip.ParseAddr(host)
+		if err != nil {
+			return host
+		}
+		// A single IPv6 subscriber usually gets a whole /64, so counting each
+		// address would hand one client 2^64 buckets
+		addr = addr.WithZone("").Unmap()
+		if addr.Is6() {
+			return netip.PrefixFrom(addr, ipv6ClientBits).Masked().String()
+		}
+		return addr.String()
+	case ScopeLicenseKey:
+		key := peekLicenseKey(r)
+		if key == "" {
+			return ""
+		}
+		// Buckets outlive requests, so keep license keys out of them
+		sum := sha256.Sum256([]byte(key))
+		return hex.EncodeToString(sum[:16])
+	default:
+		return ""
+	}
+}
+
+// peekLicenseKey reads the license_key field of a JSON body and leaves the
+// body in place for the handler
+func peekLicenseKey(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPeekedBody))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		return ""
+	}
+
+	var fields struct {
+		LicenseKey string `json:"license_key"`
+	}
+	if json.Unmarshal(body, &fields) != nil {
+		return ""
+	}
+	return fields.LicenseKey
+}
+
+// bucket is the state of a token bucket
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// newBucket returns a full bucket
+func newBucket(limit config.RateLimit, now time.Time) bucket {
+	return bucket{tokens: float64(limit.Requests), updated: now}
+}
+
+// take refills the bucket up to now and removes a token if one is available.
+// Otherwise it returns how long until one is.
+func (b *bucket) take(limit config.RateLimit, now time.Time) (bool, time.Duration) {
+	rate := float64(limit.Requests) / limit.Period.Seconds()
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Requests), b.tokens+elapsed*rate)
+		b.updated = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+// fullAt returns when the bucket will have refilled completely
+func (b *bucket) fullAt(limit config.RateLimit) time.Time {
+	rate := float64(limit.Requests) / limit.Period.Seconds()
+	missing := float64(limit.Requests) - b.tokens
+	return b.updated.Add(time.Duration(missing / rate * float64(time.Second)))
+}
@@ -0,0 +1,280 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+)
+
+func TestBucketTake(t *testing.T) {
+	limit := config.RateLimit{Requests: 10, Period: 10 * time.Second} // one token a second
+	start := time.Now()
+
+	tests := []struct {
+		name           string
+		tokens         float64
+		at             time.Duration // since the bucket was last updated
+		wantAllowed    bool
+		wantTokens     float64
+		wantRetryAfter time.Duration
+	}{
+		{"full", 10, 0, true, 9, 0},
+		{"last token", 1, 0, true, 0, 0},
+		{"empty", 0, 0, false, 0, time.Second},
+		{"part of a token", 0.5, 0, false, 0.5, 500 * time.Millisecond},
+		{"refilled", 0, 3 * time.Second, true, 2, 0},
+		{"refill capped", 5, time.Hour, true, 9, 0},
+		{"refilling", 0, 250 * time.Millisecond, false, 0.25, 750 * time.Millisecond},
+		// A clock stepping back neither refills nor drains the bucket
+		{"clock stepped back", 0, -time.Minute, false, 0, time.Second},
+	}
+	for _, tt := range tests {
+		b := bucket{tokens: tt.tokens, updated: start}
+		allowed, retryAfter := b.take(limit, start.Add(tt.at))
+		if allowed != tt.wantAllowed || !approx(b.tokens, tt.wantTokens) || !approxDuration(retryAfter, tt.wantRetryAfter) {
+			t.Errorf("%s: take = %v, %v with %g tokens left; want %v, %v with %g",
+				tt.name, allowed, retryAfter, b.tokens, tt.wantAllowed, tt.wantRetryAfter, tt.wantTokens)
+		}
+	}
+}
+
+func TestBucketFullAt(t *testing.T) {
+	limit := config.RateLimit{Requests: 10, Period: 10 * time.Second}
+	start := time.Now()
+
+	tests := []struct {
+		tokens float64
+		want   time.Duration
+	}{
+		{10, 0},
+		{0, 10 * time.Second},
+		{7.5, 2500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		b := bucket{tokens: tt.tokens, updated: start}
+		if got := b.fullAt(limit).Sub(start); !approxDuration(got, tt.want) {
+			t.Errorf("fullAt(%g tokens) = start + %v, want start + %v", tt.tokens, got, tt.want)
+		}
+	}
+
+	if b := newBucket(limit, start); b.tokens != 10 || !b.fullAt(limit).Equal(start) {
+		t.Errorf("newBucket = %+v, want a full bucket", b)
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		want       string
+	}{
+		{"IPv4", "203.0.113.7:4000", "203.0.113.7"},
+		{"no port", "203.0.113.7", "203.0.113.7"},
+		// Every address of an IPv6 /64 is the same client
+		{"IPv6", "[2001:db8:1:2:3:4:5:6]:4000", "2001:db8:1:2::/64"},
+		{"same IPv6 /64", "[2001:db8:1:2:ffff::1]:4000", "2001:db8:1:2::/64"},
+		{"other IPv6 /64", "[2001:db8:1:3::1]:4000", "2001:db8:1:3::/64"},
+		{"IPv6 zone", "[fe80::1%eth0]:4000", "fe80::/64"},
+		{"mapped IPv4", "[::ffff:198.51.100.1]:4000", "198.51.100.1"},
+		{"unparsable", "pipe", "pipe"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if got := clientKey(r, ScopeIP); got != tt.want {
+			t.Errorf("clientKey(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	if got := clientKey(r, "tenant"); got != "" {
+		t.Errorf("clientKey(unknown scope) = %q, want none", got)
+	}
+}
+
+func TestClientKeyLicenseKey(t *testing.T) {
+	sum := sha256.Sum256([]byte("KEY-1"))
+	hashed := hex.EncodeToString(sum[:16])
+	oversized := `{"license_key": "KEY-1", "padding": "` + strings.Repeat("x", maxPeekedBody) + `"}`
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"license key", `{"license_key": "KEY-1", "instance_id": "a"}`, hashed},
+		{"no license key", `{"instance_id": "a"}`, ""},
+		{"not JSON", "license_key=KEY-1", ""},
+		{"empty", "", ""},
+		// Only the start of a large body is read, so it has no key to count by
+		{"oversized", oversized, ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/license/activate", strings.NewReader(tt.body))
+		if got := clientKey(r, ScopeLicenseKey); got != tt.want {
+			t.Errorf("clientKey(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+
+		// The handler still reads the whole body
+		body, err := io.ReadAll(r.Body)
+		if err != nil || string(body) != tt.body {
+			t.Errorf("%s: body after peeking = %d bytes, %v; want the %d bytes sent", tt.name, len(body), err, len(tt.body))
+		}
+		if err := r.Body.Close(); err != nil {
+			t.Errorf("%s: Close = %v", tt.name, err)
+		}
+	}
+}
+
+// failingStore is a store that is down
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, config.RateLimit) (bool, time.Duration, error) {
+	return false, 0, errors.New("store unavailable")
+}
+
+func (failingStore) Cleanup(context.Context) (int64, error) {
+	return 0, errors.New("store unavailable")
+}
+
+func TestMiddleware(t *testing.T) {
+	limiter := &Limiter{store: NewMemoryStore(), rejections: newRejections()}
+	login := Rule{Name: "login", Scope: ScopeIP, Limit: config.RateLimit{Requests: 2, Period: time.Minute}}
+	license := Rule{Name: "license", Scope: ScopeLicenseKey, Limit: config.RateLimit{Requests: 1, Period: time.Hour}}
+
+	var received []string
+	handler := limiter.Middleware(login, license)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, string(body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	send := func(remoteAddr, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/license/activate", strings.NewReader(body))
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		body           string
+		wantStatus     int
+		wantRetryAfter string
+	}{
+		{"first", "203.0.113.7:4000", "{}", http.StatusNoContent, ""},
+		{"second", "203.0.113.7:4001", "{}", http.StatusNoContent, ""},
+		// Two requests a minute refill one token every 30s
+		{"over the IP limit", "203.0.113.7:4002", "{}", http.StatusTooManyRequests, "30"},
+		{"other client", "198.51.100.1:4000", "{}", http.StatusNoContent, ""},
+		{"IPv6", "[2001:db8::1]:4000", "{}", http.StatusNoContent, ""},
+		{"same IPv6 /64", "[2001:db8::2]:4000", "{}", http.StatusNoContent, ""},
+		{"over the IPv6 /64 limit", "[2001:db8::ffff]:4000", "{}", http.StatusTooManyRequests, "30"},
+		{"license key", "192.0.2.1:4000", `{"license_key": "KEY-1"}`, http.StatusNoContent, ""},
+		{"over the license key limit", "192.0.2.2:4000", `{"license_key": "KEY-1"}`, http.StatusTooManyRequests, "3600"},
+	}
+	for _, tt := range tests {
+		received = nil
+		w := send(tt.remoteAddr, tt.body)
+		if w.Code != tt.wantStatus || w.Header().Get("Retry-After") != tt.wantRetryAfter {
+			t.Errorf("%s: %d with Retry-After %q, want %d with %q",
+				tt.name, w.Code, w.Header().Get("Retry-After"), tt.wantStatus, tt.wantRetryAfter)
+		}
+		if tt.wantStatus == http.StatusNoContent && (len(received) != 1 || received[0] != tt.body) {
+			t.Errorf("%s: handler received %q, want %q", tt.name, received, tt.body)
+		}
+		if tt.wantStatus == http.StatusTooManyRequests {
+			if len(received) != 0 {
+				t.Errorf("%s: rejected request reached the handler", tt.name)
+			}
+			if !bytes.Contains(w.Body.Bytes(), []byte(`"retry_after":`+tt.wantRetryAfter)) {
+				t.Errorf("%s: body = %s, want retry_after %s", tt.name, w.Body, tt.wantRetryAfter)
+			}
+		}
+	}
+
+	// Requests are let through when the limits cannot be checked, or are off
+	for name, limiter := range map[string]*Limiter{
+		"failing store": {store: failingStore{}, rejections: newRejections()},
+		"disabled":      nil,
+	} {
+		handler := limiter.Middleware(login)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		for i := 0; i < 3; i++ {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", nil))
+			if w.Code != http.StatusNoContent {
+				t.Errorf("%s: request %d = %d, want it let through", name, i, w.Code)
+			}
+		}
+	}
+}
+
+func approx(a, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
+
+func approxDuration(a, b time.Duration) bool {
+	return a-b < time.Microsecond && b-a < time.Microsecond
+}
+
+func TestRejectionSampling(t *testing.T) {
+	s := newRejections()
+	start := time.Now()
+
+	tests := []struct {
+		name           string
+		key            string
+		at             time.Duration
+		wantAudited    bool
+		wantSuppressed int
+	}{
+		{"first", "login:ip:a", 0, true, 0},
+		{"within interval", "login:ip:a", time.Second, false, 0},
+		{"still within", "login:ip:a", 30 * time.Second, false, 0},
+		{"other client", "login:ip:b", 30 * time.Second, true, 0},
+		{"next interval", "login:ip:a", rejectionAuditInterval, true, 2},
+		{"after that", "login:ip:a", rejectionAuditInterval + time.Second, false, 0},
+	}
+	for _, tt := range tests {
+		audited, suppressed := s.sample(tt.key, start.Add(tt.at))
+		if audited != tt.wantAudited || suppressed != tt.wantSuppressed {
+			t.Errorf("%s: sample = %v, %d; want %v, %d", tt.name, audited, suppressed, tt.wantAudited, tt.wantSuppressed)
+		}
+	}
+
+	s.cleanup(start.Add(rejectionAuditInterval + 30*time.Second))
+	if _, ok := s.clients["login:ip:b"]; ok {
+		t.Error("cleanup kept a client last recorded over an interval ago")
+	}
+	if _, ok := s.clients["login:ip:a"]; !ok {
+		t.Error("cleanup dropped a client recorded within the interval")
+	}
+}
+
+func TestRejectionSamplingBounded(t *testing.T) {
+	s := newRejections()
+	now := time.Now()
+	for i := 0; i < maxAuditedClients; i++ {
+		s.sample("login:ip:"+strconv.Itoa(i), now)
+	}
+	if audited, _ := s.sample("one too many", now); audited {
+		t.Error("sample recorded a client past maxAuditedClients")
+	}
+	if len(s.clients) != maxAuditedClients {
+		t.Errorf("tracking %d clients, want %d", len(s.clients), maxAuditedClients)
+	}
+}
@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database/dbtest"
+)
+
+// testStore takes tokens from store until a bucket is empty and checks that
+// Cleanup only removes buckets once they have refilled
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+	limit := config.RateLimit{Requests: 2, Period: 200 * time.Millisecond}
+
+	for i, want := range []bool{true, true, false} {
+		allowed, retryAfter, err := store.Take(ctx, "login:ip:a", limit)
+		if err != nil {
+			t.Fatalf("Take %d: %v", i, err)
+		}
+		if allowed != want {
+			t.Errorf("Take %d = %v, want %v", i, allowed, want)
+		}
+		if !allowed && (retryAfter <= 0 || retryAfter > limit.Period/2) {
+			t.Errorf("Take %d retry after %v, want at most one token's refill time %v", i, retryAfter, limit.Period/2)
+		}
+	}
+	if allowed, _, err := store.Take(ctx, "login:ip:b", limit); err != nil || !allowed {
+		t.Errorf("Take(other client) = %v, %v; want its own bucket", allowed, err)
+	}
+
+	if removed, err := store.Cleanup(ctx); err != nil || removed != 0 {
+		t.Errorf("Cleanup while refilling = %d, %v; want nothing removed", removed, err)
+	}
+	time.Sleep(limit.Period + 50*time.Millisecond)
+	if removed, err := store.Cleanup(ctx); err != nil || removed != 2 {
+		t.Errorf("Cleanup after refilling = %d, %v; want both buckets removed", removed, err)
+	}
+	if allowed, _, err := store.Take(ctx, "login:ip:a", limit); err != nil || !allowed {
+		t.Errorf("Take after Cleanup = %v, %v; want a new full bucket", allowed, err)
+	}
+
+	// Concurrent requests never take more tokens than the bucket holds
+	burst := config.RateLimit{Requests: 5, Period: time.Hour}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	granted := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			allowed, _, err := store.Take(ctx, "license:ip:c", burst)
+			if err != nil {
+				t.Errorf("concurrent Take: %v", err)
+				return
+			}
+			if allowed {
+				mu.Lock()
+				granted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if granted != burst.Requests {
+		t.Errorf("concurrent Take granted %d tokens, want %d", granted, burst.Requests)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestPostgresStore(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		if db.Driver != database.DriverPostgres {
+			t.Skip("the postgres backend requires PostgreSQL")
+		}
+		testStore(t, NewPostgresStore(db))
+	})
+}
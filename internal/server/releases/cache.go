@@ -0,0 +1,120 @@
+package releases
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// maxCacheEntries bounds each cache map. Heartbeats report versions
+// unauthenticated, so unknown versions must not grow the cache without limit.
+const maxCacheEntries = 10000
+
+// Cache keeps recent release lookups in memory so heartbeats need not query
+// the database for every product they report. Entries expire after the TTL;
+// a Service with the cache enabled also drops a product's entries whenever it
+// changes one of its releases. A nil *Cache caches nothing.
+type Cache struct {
+	ttl time.Duration
+
+	mu       sync.RWMutex
+	latest   map[cacheKey]cachedRelease // by product and channel
+	versions map[cacheKey]cachedRelease // by product and version
+	// generation counts invalidations, so a lookup that raced with one does
+	// not cache what it read before it
+	generation uint64
+}
+
+type cacheKey struct {
+	product string
+	key     string
+}
+
+// cachedRelease is a lookup result; release is nil when there was none
+type cachedRelease struct {
+	release *types.Release
+	expires time.Time
+}
+
+// NewCache creates a cache whose entries live for ttl. A ttl of 0 returns
+// nil, which disables caching.
+func NewCache(ttl time.Duration) *Cache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &Cache{
+		ttl:      ttl,
+		latest:   make(map[cacheKey]cachedRelease),
+		versions: make(map[cacheKey]cachedRelease),
+	}
+}
+
+// Invalidate drops the cached releases of product
+func (c *Cache) Invalidate(product string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for key := range c.latest {
+		if key.product == product {
+			delete(c.latest, key)
+		}
+	}
+	for key := range c.versions {
+		if key.product == product {
+			delete(c.versions, key)
+		}
+	}
+}
+
+// InvalidateAll drops every cached release
+func (c *Cache) InvalidateAll() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	clear(c.latest)
+	clear(c.versions)
+}
+
+// get returns a cached release and whether there was one, and the generation
+// to pass to put when there was not
+func (c *Cache) get(entries map[cacheKey]cachedRelease, key cacheKey) (*types.Release, bool, uint64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false, c.generation
+	}
+	return entry.release, true, c.generation
+}
+
+// put caches a release read at generation, unless the cache was invalidated since
+func (c *Cache) put(entries map[cacheKey]cachedRelease, key cacheKey, release *types.Release, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	now := time.Now()
+	if len(entries) >= maxCacheEntries {
+		for k, entry := range entries {
+			if now.After(entry.expires) {
+				delete(entries, k)
+			}
+		}
+		if len(entries) >= maxCacheEntries {
+			clear(entries)
+		}
+	}
+	entries[key] = cachedRelease{release: release, expires: now.Add(c.ttl)}
+}
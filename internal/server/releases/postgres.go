@@ -0,0 +1,292 @@
+package releases
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// PostgresRepository stores releases in PostgreSQL
+type PostgresRepository struct {
+	db *database.DB
+}
+
+// NewPostgresRepository creates a repository backed by PostgreSQL
+func NewPostgresRepository(db *database.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+// scanRelease scans a row selected with releaseColumns
+func scanRelease(row pgx.Row) (*types.Release, error) {
+	var release types.Release
+	var manifestJSON []byte
+
+	err := row.Scan(
+		&release.ID, &release.ProductName, &release.Version, &release.Channel, &release.Status, &release.StatusMessage, &manifestJSON,
+		&release.ArtifactPath, &release.ArtifactSize, &release.Checksum, &release.Signature,
+		&release.ReleaseNotes, &release.MinUpdaterVersion, &release.YankedAt, &release.YankReason,
+		&release.ReleasedAt, &release.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if manifestJSON != nil {
+		if err := json.Unmarshal(manifestJSON, &release.Manifest); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal manifest: %w", err)
+		}
+	}
+
+	return &release, nil
+}
+
+// Create creates a new release
+func (r *PostgresRepository) Create(ctx context.Context, release *types.Release) error {
+	release.ID = uuid.New().String()
+	release.CreatedAt = time.Now()
+	if release.ReleasedAt.IsZero() {
+		release.ReleasedAt = time.Now()
+	}
+	if release.Status == "" {
+		release.Status = types.ReleaseStatusDraft
+	}
+
+	manifestJSON, err := json.Marshal(release.Manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	_, err = r.db.Pool.Exec(ctx, `
+		INSERT INTO releases (id, product_name, version, channel, status, manifest, artifact_path, artifact_size, checksum, signature, release_notes, min_updater_version, released_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	`, release.ID, release.ProductName, release.Version, release.Channel, release.Status, manifestJSON,
+		release.ArtifactPath, release.ArtifactSize, release.Checksum, release.Signature,
+		release.ReleaseNotes, release.MinUpdaterVersion, release.ReleasedAt, release.CreatedAt)
+
+	return err
+}
+
+// GetByProductVersion retrieves a release by product and version
+func (r *PostgresRepository) GetByProductVersion(ctx context.Context, product, version string) (*types.Release, error) {
+	release, err := scanRelease(r.db.Pool.QueryRow(ctx, `
+		SELECT `+releaseColumns+`
+		FROM releases
+		WHERE product_name = $1 AND version = $2
+	`, product, version))
+
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get release: %w", err)
+	}
+
+	return release, nil
+}
+
+// GetLatestByProduct retrieves the latest live release for a product and channel.
+// Drafts, deprecated, end-of-life, yanked and not-yet-due scheduled releases are skipped.
+func (r *PostgresRepository) GetLatestByProduct(ctx context.Context, product, channel string) (*types.Release, error) {
+	release, err := scanRelease(r.db.Pool.QueryRow(ctx, `
+		SELECT `+releaseColumns+`
+		FROM releases
+		WHERE product_name = $1 AND channel = $2 AND yanked_at IS NULL
+		  AND status = 'published' AND released_at <= NOW()
+		ORDER BY released_at DESC
+		LIMIT 1
+	`, product, channel))
+
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get release: %w", err)
+	}
+
+	return release, nil
+}
+
+// List retrieves all releases
+func (r *PostgresRepository) List(ctx context.Context) ([]types.Release, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT `+releaseColumns+`
+		FROM releases
+		ORDER BY released_at DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list releases: %w", err)
+	}
+	defer rows.Close()
+
+	var releases []types.Release
+	for rows.Next() {
+		release, err := scanRelease(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan release: %w", err)
+		}
+		releases = append(releases, *release)
+	}
+
+	return releases, nil
+}
+
+// ListByProduct retrieves releases for a product
+func (r *PostgresRepository) ListByProduct(ctx context.Context, product string) ([]types.Release, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT `+releaseColumns+`
+		FROM releases
+		WHERE product_name = $1
+		ORDER BY released_at DESC
+	`, product)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list releases: %w", err)
+	}
+	defer rows.Close()
+
+	var releases []types.Release
+	for rows.Next() {
+		release, err := scanRelease(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan release: %w", err)
+		}
+		releases = append(releases, *release)
+	}
+
+	return releases, nil
+}
+
+// Delete deletes a release
+func (r *PostgresRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.Pool.Exec(ctx, `DELETE FROM releases WHERE id = $1`, id)
+	return err
+}
+
+// UpdateChannel moves a release to another channel and records the promotion
+func (r *PostgresRepository) UpdateChannel(ctx context.Context, release *types.Release, toChannel, actor string) error {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	fromChannel := release.Channel
+	release.Channel = toChannel
+	release.Manifest.Channel = toChannel
+
+	manifestJSON, err := json.Marshal(release.Manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE releases SET channel = $2, manifest = $3 WHERE id = $1
+	`, release.ID, toChannel, manifestJSON); err != nil {
+		return fmt.Errorf("failed to update channel: %w", err)
+	}
+
+	if err := insertHistory(ctx, tx, release.ID, "promote", fromChannel, toChannel, "", actor); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// SetYanked yanks or restores a release and records the change
+func (r *PostgresRepository) SetYanked(ctx context.Context, release *types.Release, yanked bool, reason, actor string) error {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	action := "unyank"
+	release.YankedAt = nil
+	release.YankReason = ""
+	if yanked {
+		now := time.Now()
+		action = "yank"
+		release.YankedAt = &now
+		release.YankReason = reason
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE releases SET yanked_at = $2, yank_reason = NULLIF($3, '') WHERE id = $1
+	`, release.ID, release.YankedAt, release.YankReason); err != nil {
+		return fmt.Errorf("failed to update release: %w", err)
+	}
+
+	if err := insertHistory(ctx, tx, release.ID, action, release.Channel, "", reason, actor); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UpdateStatus moves a release to a new lifecycle state and records the change
+func (r *PostgresRepository) UpdateStatus(ctx context.Context, release *types.Release, status, message string, releasedAt time.Time, action, actor string) error {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	release.Status = status
+	release.StatusMessage = message
+	release.ReleasedAt = releasedAt
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE releases SET status = $2, status_message = NULLIF($3, ''), released_at = $4 WHERE id = $1
+	`, release.ID, status, message, releasedAt); err != nil {
+		return fmt.Errorf("failed to update release status: %w", err)
+	}
+
+	if err := insertHistory(ctx, tx, release.ID, action, release.Channel, "", message, actor); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ListHistory returns the promotion and yank history of a release
+func (r *PostgresRepository) ListHistory(ctx context.Context, releaseID string) ([]types.ReleaseHistoryEntry, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT id, release_id, action, COALESCE(from_channel, ''), COALESCE(to_channel, ''),
+			   COALESCE(reason, ''), COALESCE(actor, ''), created_at
+		FROM release_history
+		WHERE release_id = $1
+		ORDER BY created_at DESC
+	`, releaseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list release history: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []types.ReleaseHistoryEntry
+	for rows.Next() {
+		var entry types.ReleaseHistoryEntry
+		if err := rows.Scan(&entry.ID, &entry.ReleaseID, &entry.Action, &entry.FromChannel,
+			&entry.ToChannel, &entry.Reason, &entry.Actor, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan release history: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func insertHistory(ctx context.Context, tx pgx.Tx, releaseID, action, fromChannel, toChannel, reason, actor string) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO release_history (release_id, action, from_channel, to_channel, reason, actor)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''))
+	`, releaseID, action, fromChannel, toChannel, reason, actor)
+	if err != nil {
+		return fmt.Errorf("failed to record release history: %w", err)
+	}
+	return nil
+}
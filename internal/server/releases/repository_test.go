@@ -0,0 +1,192 @@
+package releases
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database/dbtest"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/products"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// createProduct registers the product the test releases belong to
+func createProduct(t *testing.T, db *database.DB, name string) {
+	t.Helper()
+	err := products.NewRepository(db).Create(context.Background(), &types.Product{
+		Name: name, DisplayName: name, Type: "binary", DefaultChannel: "stable",
+	})
+	if err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+}
+
+func TestRepositoryLatest(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		ctx := context.Background()
+		repo := NewRepository(db)
+		createProduct(t, db, "test-agent")
+
+		now := time.Now()
+		releases := []struct {
+			version    string
+			channel    string
+			status     string
+			releasedAt time.Time
+			yanked     bool
+		}{
+			{"1.0.0", "stable", types.ReleaseStatusPublished, now.Add(-72 * time.Hour), false},
+			{"1.1.0", "stable", types.ReleaseStatusPublished, now.Add(-48 * time.Hour), false},
+			{"1.2.0", "stable", types.ReleaseStatusPublished, now.Add(-24 * time.Hour), true},
+			{"1.3.0", "stable", types.ReleaseStatusDraft, now.Add(-time.Hour), false},
+			{"1.4.0", "stable", types.ReleaseStatusPublished, now.Add(time.Hour), false},
+			{"2.0.0-beta", "beta", types.ReleaseStatusPublished, now.Add(-time.Hour), false},
+			{"0.9.0", "nightly", types.ReleaseStatusDeprecated, now.Add(-time.Hour), false},
+		}
+		for _, r := range releases {
+			release := &types.Release{
+				ProductName: "test-agent",
+				Version:     r.version,
+				Channel:     r.channel,
+				Status:      r.status,
+				ReleasedAt:  r.releasedAt,
+				Checksum:    "sha256-" + r.version,
+				Manifest:    types.Manifest{Product: "test-agent", Version: r.version, Channel: r.channel},
+			}
+			if err := repo.Create(ctx, release); err != nil {
+				t.Fatalf("Create %s: %v", r.version, err)
+			}
+			if r.yanked {
+				if err := repo.SetYanked(ctx, release, true, "broken", "tester"); err != nil {
+					t.Fatalf("SetYanked %s: %v", r.version, err)
+				}
+			}
+		}
+
+		tests := []struct {
+			channel string
+			want    string // "" for none
+		}{
+			// 1.2.0 is yanked, 1.3.0 a draft and 1.4.0 scheduled for later
+			{"stable", "1.1.0"},
+			{"beta", "2.0.0-beta"},
+			// Deprecated releases are not offered
+			{"nightly", ""},
+			{"unknown", ""},
+		}
+		for _, tt := range tests {
+			latest, err := repo.GetLatestByProduct(ctx, "test-agent", tt.channel)
+			if err != nil {
+				t.Fatalf("GetLatestByProduct(%s): %v", tt.channel, err)
+			}
+			got := ""
+			if latest != nil {
+				got = latest.Version
+			}
+			if got != tt.want {
+				t.Errorf("GetLatestByProduct(%s) = %q, want %q", tt.channel, got, tt.want)
+			}
+		}
+
+		list, err := repo.ListByProduct(ctx, "test-agent")
+		if err != nil {
+			t.Fatalf("ListByProduct: %v", err)
+		}
+		if len(list) != len(releases) {
+			t.Fatalf("ListByProduct returned %d releases, want %d", len(list), len(releases))
+		}
+		for i := 1; i < len(list); i++ {
+			if list[i].ReleasedAt.After(list[i-1].ReleasedAt) {
+				t.Errorf("ListByProduct is not newest first: %s before %s", list[i-1].Version, list[i].Version)
+			}
+		}
+	})
+}
+
+func TestRepositoryLifecycle(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		ctx := context.Background()
+		repo := NewRepository(db)
+		createProduct(t, db, "test-agent")
+
+		release := &types.Release{
+			ProductName:  "test-agent",
+			Version:      "1.0.0",
+			Channel:      "beta",
+			ArtifactPath: "test-agent/1.0.0/test-agent",
+			ArtifactSize: 1234,
+			Checksum:     "abc",
+			Manifest:     types.Manifest{Product: "test-agent", Version: "1.0.0", Channel: "beta"},
+		}
+		if err := repo.Create(ctx, release); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if release.Status != types.ReleaseStatusDraft {
+			t.Errorf("new release status = %s, want draft", release.Status)
+		}
+		if err := repo.Create(ctx, &types.Release{ProductName: "test-agent", Version: "1.0.0", Channel: "beta"}); err == nil {
+			t.Error("Create accepted a duplicate version")
+		}
+
+		got, err := repo.GetByProductVersion(ctx, "test-agent", "1.0.0")
+		if err != nil || got == nil {
+			t.Fatalf("GetByProductVersion = %v, %v", got, err)
+		}
+		if got.ID != release.ID || got.ArtifactSize != 1234 || got.Checksum != "abc" || got.Manifest.Version != "1.0.0" {
+			t.Errorf("GetByProductVersion = %+v", got)
+		}
+		if missing, err := repo.GetByProductVersion(ctx, "test-agent", "9.9.9"); err != nil || missing != nil {
+			t.Errorf("GetByProductVersion(missing) = %v, %v; want nil, nil", missing, err)
+		}
+
+		publishAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+		if err := repo.UpdateStatus(ctx, got, types.ReleaseStatusPublished, "", publishAt, "publish", "tester"); err != nil {
+			t.Fatalf("UpdateStatus: %v", err)
+		}
+		if err := repo.UpdateChannel(ctx, got, "stable", "tester"); err != nil {
+			t.Fatalf("UpdateChannel: %v", err)
+		}
+		if err := repo.SetYanked(ctx, got, true, "bad build", "tester"); err != nil {
+			t.Fatalf("SetYanked: %v", err)
+		}
+
+		yanked, _ := repo.GetByProductVersion(ctx, "test-agent", "1.0.0")
+		if yanked.Status != types.ReleaseStatusPublished || yanked.Channel != "stable" || yanked.Manifest.Channel != "stable" ||
+			yanked.YankedAt == nil || yanked.YankReason != "bad build" || !yanked.ReleasedAt.Equal(publishAt) {
+			t.Errorf("after publish, promote and yank = %+v", yanked)
+		}
+
+		if err := repo.SetYanked(ctx, yanked, false, "", "tester"); err != nil {
+			t.Fatalf("SetYanked(false): %v", err)
+		}
+		restored, _ := repo.GetByProductVersion(ctx, "test-agent", "1.0.0")
+		if restored.YankedAt != nil || restored.YankReason != "" {
+			t.Errorf("after unyank = %+v", restored)
+		}
+
+		history, err := repo.ListHistory(ctx, release.ID)
+		if err != nil {
+			t.Fatalf("ListHistory: %v", err)
+		}
+		actions := map[string]bool{}
+		for _, entry := range history {
+			actions[entry.Action] = true
+			if entry.Actor != "tester" {
+				t.Errorf("history entry %s actor = %q, want tester", entry.Action, entry.Actor)
+			}
+		}
+		for _, action := range []string{"publish", "promote", "yank", "unyank"} {
+			if !actions[action] {
+				t.Errorf("history has no %s entry: %+v", action, history)
+			}
+		}
+
+		if err := repo.Delete(ctx, release.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if deleted, _ := repo.GetByProductVersion(ctx, "test-agent", "1.0.0"); deleted != nil {
+			t.Error("release still exists after Delete")
+		}
+	})
+}
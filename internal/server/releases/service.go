@@ -4,28 +4,53 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/products"
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/storage"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/tracing"
 	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
 )
 
+var (
+	ErrInvalidChannel    = errors.New("channel must be one of stable, beta, nightly")
+	ErrReleaseNotFound   = errors.New("release not found")
+	ErrReleaseYanked     = errors.New("release is yanked")
+	ErrAlreadyInChannel  = errors.New("release is already in that channel")
+	ErrInvalidTransition = errors.New("invalid release status transition")
+	ErrReleaseExists     = errors.New("release already exists")
+	ErrReleaseNotDraft   = errors.New("artifacts can only be added to draft releases")
+)
+
 // Service handles release business logic
 type Service struct {
-	repo    *Repository
-	storage storage.Storage
+	repo     Repository
+	products *products.Service
+	storage  storage.Storage
+	cache    *Cache
 }
 
 // NewService creates a new release service
 func NewService(db *database.DB, store storage.Storage) *Service {
 	return &Service{
-		repo:    NewRepository(db),
-		storage: store,
+		repo:     NewRepository(db),
+		products: products.NewService(db),
+		storage:  store,
 	}
 }
 
+// EnableCache serves latest release lookups and release warnings from cache,
+// and invalidates it when this service changes a release
+func (s *Service) EnableCache(cache *Cache) {
+	s.cache = cache
+}
+
 // CreateReleaseRequest is the request to create a release
 type CreateReleaseRequest struct {
 	ProductName       string
@@ -39,7 +64,30 @@ type CreateReleaseRequest struct {
 }
 
 // CreateRelease creates a new release
-func (s *Service) CreateRelease(ctx context.Context, req CreateReleaseRequest) (*types.Release, error) {
+func (s *Service) CreateRelease(ctx context.Context, req CreateReleaseRequest) (_ *types.Release, err error) {
+	ctx, span := tracing.Start(ctx, "releases.CreateRelease", attribute.String("product", req.ProductName), attribute.String("version", req.Version))
+	defer func() { tracing.End(span, err) }()
+
+	product, err := s.RequireProduct(ctx, req.ProductName)
+	if err != nil {
+		return nil, err
+	}
+	if req.Channel == "" {
+		req.Channel = product.DefaultChannel
+	}
+	if !products.IsValidChannel(req.Channel) {
+		return nil, ErrInvalidChannel
+	}
+
+	// A failed create removes the artifact below, which must not be another release's
+	existing, err := s.repo.GetByProductVersion(ctx, req.ProductName, req.Version)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrReleaseExists, req.ProductName, req.Version)
+	}
+
 	// Calculate checksum while saving
 	hasher := sha256.New()
 	teeReader := io.TeeReader(req.File, hasher)
@@ -81,6 +129,7 @@ func (s *Service) CreateRelease(ctx context.Context, req CreateReleaseRequest) (
 		s.storage.Delete(req.ProductName, req.Version, req.Filename)
 		return nil, fmt.Errorf("failed to create release: %w", err)
 	}
+	s.cache.Invalidate(release.ProductName)
 
 	return release, nil
 }
@@ -90,9 +139,41 @@ func (s *Service) GetRelease(ctx context.Context, product, version string) (*typ
 	return s.repo.GetByProductVersion(ctx, product, version)
 }
 
+// CheckArtifact reports whether filename can be added to a version. Only
+// versions without a release or with a draft one take new artifacts, and
+// stored artifacts are never replaced.
+func (s *Service) CheckArtifact(ctx context.Context, product, version, filename string) error {
+	release, err := s.repo.GetByProductVersion(ctx, product, version)
+	if err != nil {
+		return err
+	}
+	if release != nil && release.Status != types.ReleaseStatusDraft {
+		return fmt.Errorf("%w: %s %s is %s", ErrReleaseNotDraft, product, version, release.Status)
+	}
+	if s.storage.Exists(product, version, filename) {
+		return fmt.Errorf("%w: %s/%s/%s", storage.ErrArtifactExists, product, version, filename)
+	}
+	return nil
+}
+
+// SaveArtifact stores another artifact of a version once CheckArtifact allows it
+func (s *Service) SaveArtifact(ctx context.Context, product, version, filename string, file io.Reader) (string, error) {
+	if err := s.CheckArtifact(ctx, product, version, filename); err != nil {
+		return "", err
+	}
+	path, err := s.storage.Save(product, version, filename, file)
+	if err != nil {
+		return "", fmt.Errorf("failed to save artifact: %w", err)
+	}
+	return path, nil
+}
+
 // GetLatestRelease retrieves the latest release for a product
-func (s *Service) GetLatestRelease(ctx context.Context, product, channel, currentVersion string) (*types.ReleaseInfo, error) {
-	release, err := s.repo.GetLatestByProduct(ctx, product, channel)
+func (s *Service) GetLatestRelease(ctx context.Context, product, channel, currentVersion string) (_ *types.ReleaseInfo, err error) {
+	ctx, span := tracing.Start(ctx, "releases.GetLatestRelease", attribute.String("product", product), attribute.String("channel", channel))
+	defer func() { tracing.End(span, err) }()
+
+	release, err := s.latestRelease(ctx, product, channel)
 	if err != nil {
 		return nil, err
 	}
@@ -100,6 +181,25 @@ func (s *Service) GetLatestRelease(ctx context.Context, product, channel, curren
 		return nil, nil
 	}
 
+	return releaseInfo(release, currentVersion), nil
+}
+
+// GetReleaseInfo returns the update to a specific version for an instance
+// running currentVersion, or nil if there is no such release or it was yanked
+func (s *Service) GetReleaseInfo(ctx context.Context, product, version, currentVersion string) (*types.ReleaseInfo, error) {
+	release, err := s.releaseByVersion(ctx, product, version)
+	if err != nil {
+		return nil, err
+	}
+	if release == nil || release.YankedAt != nil || !Published(release, time.Now()) {
+		return nil, nil
+	}
+
+	return releaseInfo(release, currentVersion), nil
+}
+
+// releaseInfo describes the update from currentVersion to release
+func releaseInfo(release *types.Release, currentVersion string) *types.ReleaseInfo {
 	updateAvailable := currentVersion == "" || currentVersion != release.Version
 
 	return &types.ReleaseInfo{
@@ -113,21 +213,276 @@ func (s *Service) GetLatestRelease(ctx context.Context, product, channel, curren
 		Size:            release.ArtifactSize,
 		ReleaseNotes:    release.ReleaseNotes,
 		ReleasedAt:      release.ReleasedAt,
-	}, nil
+	}
+}
+
+// Published reports whether a release may be seen by updaters and anonymous
+// callers: it is no longer a draft and its scheduled publish time has come
+func Published(release *types.Release, now time.Time) bool {
+	return release.Status != types.ReleaseStatusDraft && !release.ReleasedAt.After(now)
+}
+
+// ListReleases retrieves all releases. Unless drafts is set, only published
+// releases are listed.
+func (s *Service) ListReleases(ctx context.Context, drafts bool) ([]types.Release, error) {
+	releases, err := s.repo.List(ctx)
+	if err != nil || drafts {
+		return releases, err
+	}
+	return publishedOnly(releases), nil
+}
+
+// ListProductReleases retrieves releases for a product. Unless drafts is set,
+// only published releases are listed.
+func (s *Service) ListProductReleases(ctx context.Context, product string, drafts bool) ([]types.Release, error) {
+	releases, err := s.repo.ListByProduct(ctx, product)
+	if err != nil || drafts {
+		return releases, err
+	}
+	return publishedOnly(releases), nil
+}
+
+// publishedOnly filters releases down to the published ones
+func publishedOnly(releases []types.Release) []types.Release {
+	now := time.Now()
+	published := []types.Release{}
+	for _, release := range releases {
+		if Published(&release, now) {
+			published = append(published, release)
+		}
+	}
+	return published
+}
+
+// PromoteRelease re-points an existing release artifact to another channel
+func (s *Service) PromoteRelease(ctx context.Context, product, version, toChannel, actor string) (*types.Release, error) {
+	if !products.IsValidChannel(toChannel) {
+		return nil, ErrInvalidChannel
+	}
+
+	release, err := s.requireRelease(ctx, product, version)
+	if err != nil {
+		return nil, err
+	}
+	if release.YankedAt != nil {
+		return nil, ErrReleaseYanked
+	}
+	if release.Channel == toChannel {
+		return nil, ErrAlreadyInChannel
+	}
+
+	if err := s.repo.UpdateChannel(ctx, release, toChannel, actor); err != nil {
+		return nil, err
+	}
+	s.cache.Invalidate(release.ProductName)
+
+	return release, nil
+}
+
+// YankRelease hides a release from latest lookups while keeping it downloadable
+func (s *Service) YankRelease(ctx context.Context, product, version, reason, actor string) (*types.Release, error) {
+	release, err := s.requireRelease(ctx, product, version)
+	if err != nil {
+		return nil, err
+	}
+	if release.YankedAt != nil {
+		return release, nil
+	}
+
+	if err := s.repo.SetYanked(ctx, release, true, reason, actor); err != nil {
+		return nil, err
+	}
+	s.cache.Invalidate(release.ProductName)
+
+	return release, nil
+}
+
+// UnyankRelease makes a yanked release eligible for latest lookups again
+func (s *Service) UnyankRelease(ctx context.Context, product, version, actor string) (*types.Release, error) {
+	release, err := s.requireRelease(ctx, product, version)
+	if err != nil {
+		return nil, err
+	}
+	if release.YankedAt == nil {
+		return release, nil
+	}
+
+	if err := s.repo.SetYanked(ctx, release, false, "", actor); err != nil {
+		return nil, err
+	}
+	s.cache.Invalidate(release.ProductName)
+
+	return release, nil
+}
+
+// PublishRelease publishes a draft, either immediately or at publishAt
+func (s *Service) PublishRelease(ctx context.Context, product, version string, publishAt *time.Time, actor string) (*types.Release, error) {
+	release, err := s.requireRelease(ctx, product, version)
+	if err != nil {
+		return nil, err
+	}
+	if release.Status != types.ReleaseStatusDraft {
+		return nil, fmt.Errorf("%w: only drafts can be published (release is %s)", ErrInvalidTransition, release.Status)
+	}
+
+	releasedAt := time.Now()
+	if publishAt != nil && publishAt.After(releasedAt) {
+		releasedAt = *publishAt
+	}
+
+	if err := s.repo.UpdateStatus(ctx, release, types.ReleaseStatusPublished, "", releasedAt, "publish", actor); err != nil {
+		return nil, err
+	}
+	s.cache.Invalidate(release.ProductName)
+
+	return release, nil
+}
+
+// DeprecateRelease marks a published release as deprecated
+func (s *Service) DeprecateRelease(ctx context.Context, product, version, message, actor string) (*types.Release, error) {
+	release, err := s.requireRelease(ctx, product, version)
+	if err != nil {
+		return nil, err
+	}
+	if release.Status != types.ReleaseStatusPublished {
+		return nil, fmt.Errorf("%w: only published releases can be deprecated (release is %s)", ErrInvalidTransition, release.Status)
+	}
+	if message == "" {
+		message = fmt.Sprintf("%s %s is deprecated, please upgrade", release.ProductName, release.Version)
+	}
+
+	if err := s.repo.UpdateStatus(ctx, release, types.ReleaseStatusDeprecated, message, release.ReleasedAt, "deprecate", actor); err != nil {
+		return nil, err
+	}
+	s.cache.Invalidate(release.ProductName)
+
+	return release, nil
+}
+
+// EndOfLifeRelease marks a published or deprecated release as end-of-life
+func (s *Service) EndOfLifeRelease(ctx context.Context, product, version, message, actor string) (*types.Release, error) {
+	release, err := s.requireRelease(ctx, product, version)
+	if err != nil {
+		return nil, err
+	}
+	if release.Status != types.ReleaseStatusPublished && release.Status != types.ReleaseStatusDeprecated {
+		return nil, fmt.Errorf("%w: only published or deprecated releases can reach end-of-life (release is %s)", ErrInvalidTransition, release.Status)
+	}
+	if message == "" {
+		message = fmt.Sprintf("%s %s is end-of-life and no longer supported, upgrade now", release.ProductName, release.Version)
+	}
+
+	if err := s.repo.UpdateStatus(ctx, release, types.ReleaseStatusEOL, message, release.ReleasedAt, "eol", actor); err != nil {
+		return nil, err
+	}
+	s.cache.Invalidate(release.ProductName)
+
+	return release, nil
 }
 
-// ListReleases retrieves all releases
-func (s *Service) ListReleases(ctx context.Context) ([]types.Release, error) {
-	return s.repo.List(ctx)
+// GetReleaseWarnings returns warnings for installed products running deprecated or end-of-life versions
+func (s *Service) GetReleaseWarnings(ctx context.Context, installed []types.ProductStatus) []types.ReleaseWarning {
+	ctx, span := tracing.Start(ctx, "releases.GetReleaseWarnings")
+	defer span.End()
+
+	var warnings []types.ReleaseWarning
+	for _, product := range installed {
+		if product.Version == "" || product.Version == "unknown" {
+			continue
+		}
+		release, err := s.releaseByVersion(ctx, product.Name, product.Version)
+		if err != nil || release == nil {
+			continue
+		}
+		if release.Status == types.ReleaseStatusDeprecated || release.Status == types.ReleaseStatusEOL {
+			warnings = append(warnings, types.ReleaseWarning{
+				Product: release.ProductName,
+				Version: release.Version,
+				Status:  release.Status,
+				Message: release.StatusMessage,
+			})
+		}
+	}
+	return warnings
 }
 
-// ListProductReleases retrieves releases for a product
-func (s *Service) ListProductReleases(ctx context.Context, product string) ([]types.Release, error) {
-	return s.repo.ListByProduct(ctx, product)
+// GetReleaseHistory returns the promotion and yank history of a release
+func (s *Service) GetReleaseHistory(ctx context.Context, product, version string) ([]types.ReleaseHistoryEntry, error) {
+	release, err := s.requireRelease(ctx, product, version)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.ListHistory(ctx, release.ID)
+}
+
+func (s *Service) requireRelease(ctx context.Context, product, version string) (*types.Release, error) {
+	release, err := s.repo.GetByProductVersion(ctx, product, version)
+	if err != nil {
+		return nil, err
+	}
+	if release == nil {
+		return nil, ErrReleaseNotFound
+	}
+	return release, nil
 }
 
 // DeleteRelease deletes a release
 func (s *Service) DeleteRelease(ctx context.Context, id string) error {
-	return s.repo.Delete(ctx, id)
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	// Deleting by ID leaves the product unknown
+	s.cache.InvalidateAll()
+	return nil
 }
 
+// latestRelease is GetLatestByProduct through the cache
+func (s *Service) latestRelease(ctx context.Context, product, channel string) (*types.Release, error) {
+	if s.cache == nil {
+		return s.repo.GetLatestByProduct(ctx, product, channel)
+	}
+
+	key := cacheKey{product: product, key: channel}
+	release, ok, generation := s.cache.get(s.cache.latest, key)
+	if ok {
+		return release, nil
+	}
+	release, err := s.repo.GetLatestByProduct(ctx, product, channel)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.put(s.cache.latest, key, release, generation)
+	return release, nil
+}
+
+// releaseByVersion is GetByProductVersion through the cache
+func (s *Service) releaseByVersion(ctx context.Context, product, version string) (*types.Release, error) {
+	if s.cache == nil {
+		return s.repo.GetByProductVersion(ctx, product, version)
+	}
+
+	key := cacheKey{product: product, key: version}
+	release, ok, generation := s.cache.get(s.cache.versions, key)
+	if ok {
+		return release, nil
+	}
+	release, err := s.repo.GetByProductVersion(ctx, product, version)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.put(s.cache.versions, key, release, generation)
+	return release, nil
+}
+
+
+// RequireProduct returns the registered product or products.ErrProductNotFound
+func (s *Service) RequireProduct(ctx context.Context, name string) (*types.Product, error) {
+	product, err := s.products.GetProduct(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, fmt.Errorf("%w: %s", products.ErrProductNotFound, name)
+	}
+	return product, nil
+}
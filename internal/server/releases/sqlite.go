@@ -0,0 +1,268 @@
+package releases
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// SQLiteRepository stores releases in a SQLite database
+type SQLiteRepository struct {
+	db *database.SQLite
+}
+
+// NewSQLiteRepository creates a repository backed by SQLite
+func NewSQLiteRepository(db *database.DB) *SQLiteRepository {
+	return &SQLiteRepository{db: db.SQLite}
+}
+
+// scanSQLiteRelease scans a row selected with releaseColumns
+func scanSQLiteRelease(row database.Row) (*types.Release, error) {
+	var release types.Release
+
+	err := row.Scan(
+		&release.ID, &release.ProductName, &release.Version, &release.Channel, &release.Status, &release.StatusMessage,
+		database.JSON{V: &release.Manifest}, &release.ArtifactPath, &release.ArtifactSize, &release.Checksum,
+		&release.Signature, &release.ReleaseNotes, &release.MinUpdaterVersion, &release.YankedAt, &release.YankReason,
+		&release.ReleasedAt, &release.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &release, nil
+}
+
+// Create implements Repository
+func (r *SQLiteRepository) Create(ctx context.Context, release *types.Release) error {
+	release.ID = uuid.New().String()
+	release.CreatedAt = time.Now()
+	if release.ReleasedAt.IsZero() {
+		release.ReleasedAt = time.Now()
+	}
+	if release.Status == "" {
+		release.Status = types.ReleaseStatusDraft
+	}
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO releases (id, product_name, version, channel, status, manifest, artifact_path, artifact_size, checksum, signature, release_notes, min_updater_version, released_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	`, release.ID, release.ProductName, release.Version, release.Channel, release.Status, database.JSON{V: release.Manifest},
+		release.ArtifactPath, release.ArtifactSize, release.Checksum, release.Signature,
+		release.ReleaseNotes, release.MinUpdaterVersion, release.ReleasedAt, release.CreatedAt)
+
+	return err
+}
+
+// GetByProductVersion implements Repository
+func (r *SQLiteRepository) GetByProductVersion(ctx context.Context, product, version string) (*types.Release, error) {
+	release, err := scanSQLiteRelease(r.db.QueryRowContext(ctx, `
+		SELECT `+releaseColumns+`
+		FROM releases
+		WHERE product_name = $1 AND version = $2
+	`, product, version))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get release: %w", err)
+	}
+
+	return release, nil
+}
+
+// GetLatestByProduct implements Repository
+func (r *SQLiteRepository) GetLatestByProduct(ctx context.Context, product, channel string) (*types.Release, error) {
+	release, err := scanSQLiteRelease(r.db.QueryRowContext(ctx, `
+		SELECT `+releaseColumns+`
+		FROM releases
+		WHERE product_name = $1 AND channel = $2 AND yanked_at IS NULL
+		  AND status = 'published' AND released_at <= $3
+		ORDER BY released_at DESC
+		LIMIT 1
+	`, product, channel, time.Now()))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get release: %w", err)
+	}
+
+	return release, nil
+}
+
+// List implements Repository
+func (r *SQLiteRepository) List(ctx context.Context) ([]types.Release, error) {
+	return r.list(ctx, `
+		SELECT `+releaseColumns+`
+		FROM releases
+		ORDER BY released_at DESC
+	`)
+}
+
+// ListByProduct implements Repository
+func (r *SQLiteRepository) ListByProduct(ctx context.Context, product string) ([]types.Release, error) {
+	return r.list(ctx, `
+		SELECT `+releaseColumns+`
+		FROM releases
+		WHERE product_name = $1
+		ORDER BY released_at DESC
+	`, product)
+}
+
+func (r *SQLiteRepository) list(ctx context.Context, query string, args ...interface{}) ([]types.Release, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list releases: %w", err)
+	}
+	defer rows.Close()
+
+	var releases []types.Release
+	for rows.Next() {
+		release, err := scanSQLiteRelease(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan release: %w", err)
+		}
+		releases = append(releases, *release)
+	}
+
+	return releases, rows.Err()
+}
+
+// Delete implements Repository
+func (r *SQLiteRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM releases WHERE id = $1`, id)
+	return err
+}
+
+// UpdateChannel implements Repository
+func (r *SQLiteRepository) UpdateChannel(ctx context.Context, release *types.Release, toChannel, actor string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	fromChannel := release.Channel
+	release.Channel = toChannel
+	release.Manifest.Channel = toChannel
+
+	manifestJSON, err := json.Marshal(release.Manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE releases SET channel = $2, manifest = $3 WHERE id = $1
+	`, release.ID, toChannel, string(manifestJSON)); err != nil {
+		return fmt.Errorf("failed to update channel: %w", err)
+	}
+
+	if err := insertSQLiteHistory(ctx, tx, release.ID, "promote", fromChannel, toChannel, "", actor); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetYanked implements Repository
+func (r *SQLiteRepository) SetYanked(ctx context.Context, release *types.Release, yanked bool, reason, actor string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	action := "unyank"
+	release.YankedAt = nil
+	release.YankReason = ""
+	if yanked {
+		now := time.Now()
+		action = "yank"
+		release.YankedAt = &now
+		release.YankReason = reason
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE releases SET yanked_at = $2, yank_reason = NULLIF($3, '') WHERE id = $1
+	`, release.ID, release.YankedAt, release.YankReason); err != nil {
+		return fmt.Errorf("failed to update release: %w", err)
+	}
+
+	if err := insertSQLiteHistory(ctx, tx, release.ID, action, release.Channel, "", reason, actor); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateStatus implements Repository
+func (r *SQLiteRepository) UpdateStatus(ctx context.Context, release *types.Release, status, message string, releasedAt time.Time, action, actor string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	release.Status = status
+	release.StatusMessage = message
+	release.ReleasedAt = releasedAt
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE releases SET status = $2, status_message = NULLIF($3, ''), released_at = $4 WHERE id = $1
+	`, release.ID, status, message, releasedAt); err != nil {
+		return fmt.Errorf("failed to update release status: %w", err)
+	}
+
+	if err := insertSQLiteHistory(ctx, tx, release.ID, action, release.Channel, "", message, actor); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListHistory implements Repository
+func (r *SQLiteRepository) ListHistory(ctx context.Context, releaseID string) ([]types.ReleaseHistoryEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, release_id, action, COALESCE(from_channel, ''), COALESCE(to_channel, ''),
+			   COALESCE(reason, ''), COALESCE(actor, ''), created_at
+		FROM release_history
+		WHERE release_id = $1
+		ORDER BY created_at DESC
+	`, releaseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list release history: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []types.ReleaseHistoryEntry
+	for rows.Next() {
+		var entry types.ReleaseHistoryEntry
+		if err := rows.Scan(&entry.ID, &entry.ReleaseID, &entry.Action, &entry.FromChannel,
+			&entry.ToChannel, &entry.Reason, &entry.Actor, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan release history: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func insertSQLiteHistory(ctx context.Context, tx *database.SQLiteTx, releaseID, action, fromChannel, toChannel, reason, actor string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO release_history (id, release_id, action, from_channel, to_channel, reason, actor, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8)
+	`, uuid.New().String(), releaseID, action, fromChannel, toChannel, reason, actor, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to record release history: %w", err)
+	}
+	return nil
+}
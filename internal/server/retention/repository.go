@@ -0,0 +1,43 @@
+package retention
+
+import (
+	"context"
+	"strings"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// Repository handles retention policy and release pin database operations
+type Repository interface {
+	// ListPolicies retrieves all retention policies
+	ListPolicies(ctx context.Context) ([]types.RetentionPolicy, error)
+	// UpsertPolicy creates or replaces the policy for a product channel
+	UpsertPolicy(ctx context.Context, policy *types.RetentionPolicy) error
+	// DeletePolicy removes the policy for a product channel, reporting whether one existed
+	DeletePolicy(ctx context.Context, product, channel string) (bool, error)
+	// ListPins retrieves the pins of a release
+	ListPins(ctx context.Context, releaseID string) ([]types.ReleasePin, error)
+	// CreatePin pins a release for a customer; pinning twice updates the reason
+	CreatePin(ctx context.Context, pin *types.ReleasePin) error
+	// DeletePin removes a customer's pin, reporting whether one existed
+	DeletePin(ctx context.Context, releaseID, customerID string) (bool, error)
+	// PinnedReleaseIDs returns the IDs of all releases pinned by any customer
+	PinnedReleaseIDs(ctx context.Context) (map[string]bool, error)
+	// InstalledVersions returns the product versions reported by each instance's last heartbeat,
+	// keyed by installedKey(product, version)
+	InstalledVersions(ctx context.Context) (map[string]bool, error)
+}
+
+// NewRepository creates a retention repository for the configured database
+func NewRepository(db *database.DB) Repository {
+	if db.Driver == database.DriverSQLite {
+		return NewSQLiteRepository(db)
+	}
+	return NewPostgresRepository(db)
+}
+
+// installedKey normalizes a product version so "v1.2.0" and "1.2.0" match
+func installedKey(product, version string) string {
+	return product + "@" + strings.TrimPrefix(version, "v")
+}
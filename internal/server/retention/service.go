@@ -0,0 +1,308 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/products"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/releases"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/storage"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/tracing"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+var (
+	ErrInvalidPolicy  = errors.New("invalid retention policy")
+	ErrPolicyNotFound = errors.New("retention policy not found")
+	ErrPinNotFound    = errors.New("release pin not found")
+)
+
+// Service handles retention policies, release pins and artifact garbage collection
+type Service struct {
+	repo           Repository
+	releases       releases.Repository
+	releaseService *releases.Service // deletes releases, keeping its cache current
+	products       *products.Service
+	storage        storage.Storage
+}
+
+// NewService creates a new retention service that deletes releases through
+// releaseService
+func NewService(db *database.DB, releaseService *releases.Service, store storage.Storage) *Service {
+	return &Service{
+		repo:           NewRepository(db),
+		releases:       releases.NewRepository(db),
+		releaseService: releaseService,
+		products:       products.NewService(db),
+		storage:        store,
+	}
+}
+
+// SetPolicyRequest sets the retention policy of a product channel
+type SetPolicyRequest struct {
+	KeepLast   int `json:"keep_last"`
+	MaxAgeDays int `json:"max_age_days"`
+}
+
+// PinReleaseRequest pins a release for a customer
+type PinReleaseRequest struct {
+	CustomerID string `json:"customer_id"`
+	Reason     string `json:"reason"`
+}
+
+// ListPolicies retrieves all retention policies
+func (s *Service) ListPolicies(ctx context.Context) ([]types.RetentionPolicy, error) {
+	return s.repo.ListPolicies(ctx)
+}
+
+// SetPolicy creates or replaces the retention policy of a product channel
+func (s *Service) SetPolicy(ctx context.Context, product, channel string, req SetPolicyRequest) (*types.RetentionPolicy, error) {
+	if !products.IsValidChannel(channel) {
+		return nil, fmt.Errorf("%w: channel must be one of stable, beta, nightly", ErrInvalidPolicy)
+	}
+	if req.KeepLast < 0 || req.MaxAgeDays < 0 {
+		return nil, fmt.Errorf("%w: keep_last and max_age_days must not be negative", ErrInvalidPolicy)
+	}
+	if req.KeepLast == 0 && req.MaxAgeDays == 0 {
+		return nil, fmt.Errorf("%w: set keep_last, max_age_days or both", ErrInvalidPolicy)
+	}
+
+	existing, err := s.products.GetProduct(ctx, product)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, fmt.Errorf("%w: %s", products.ErrProductNotFound, product)
+	}
+
+	policy := &types.RetentionPolicy{
+		ProductName: product,
+		Channel:     channel,
+		KeepLast:    req.KeepLast,
+		MaxAgeDays:  req.MaxAgeDays,
+	}
+	if err := s.repo.UpsertPolicy(ctx, policy); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// DeletePolicy removes the retention policy of a product channel
+func (s *Service) DeletePolicy(ctx context.Context, product, channel string) error {
+	deleted, err := s.repo.DeletePolicy(ctx, product, channel)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrPolicyNotFound
+	}
+	return nil
+}
+
+// ListPins retrieves the customer pins of a release
+func (s *Service) ListPins(ctx context.Context, product, version string) ([]types.ReleasePin, error) {
+	release, err := s.requireRelease(ctx, product, version)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.ListPins(ctx, release.ID)
+}
+
+// PinRelease protects a release from garbage collection on behalf of a customer
+func (s *Service) PinRelease(ctx context.Context, product, version string, req PinReleaseRequest, actor string) (*types.ReleasePin, error) {
+	release, err := s.requireRelease(ctx, product, version)
+	if err != nil {
+		return nil, err
+	}
+
+	pin := &types.ReleasePin{
+		ReleaseID:   release.ID,
+		ProductName: release.ProductName,
+		Version:     release.Version,
+		CustomerID:  req.CustomerID,
+		Reason:      req.Reason,
+		CreatedBy:   actor,
+	}
+	if err := s.repo.CreatePin(ctx, pin); err != nil {
+		return nil, err
+	}
+
+	return pin, nil
+}
+
+// UnpinRelease removes a customer's pin from a release
+func (s *Service) UnpinRelease(ctx context.Context, product, version, customerID string) error {
+	release, err := s.requireRelease(ctx, product, version)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := s.repo.DeletePin(ctx, release.ID, customerID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrPinNotFound
+	}
+	return nil
+}
+
+// RunGC applies every retention policy. Drafts, releases still installed on an
+// instance (per its last heartbeat), pinned by a customer, or currently served
+// as the channel's latest release are never removed. With dryRun set nothing is deleted
+// and the report lists what would have been.
+func (s *Service) RunGC(ctx context.Context, dryRun bool) (_ *types.RetentionReport, err error) {
+	ctx, span := tracing.Start(ctx, "retention.RunGC", attribute.Bool("dry_run", dryRun))
+	defer func() { tracing.End(span, err) }()
+
+	report := &types.RetentionReport{
+		DryRun:    dryRun,
+		Deleted:   []types.RetentionCandidate{},
+		Protected: []types.RetentionCandidate{},
+		StartedAt: time.Now(),
+	}
+
+	policies, err := s.repo.ListPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	installed, err := s.repo.InstalledVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pinned, err := s.repo.PinnedReleaseIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, policy := range policies {
+		report.Policies++
+
+		expired, err := s.expiredReleases(ctx, policy, report.StartedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		latest, err := s.releases.GetLatestByProduct(ctx, policy.ProductName, policy.Channel)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, release := range expired {
+			candidate := types.RetentionCandidate{
+				ProductName: release.ProductName,
+				Version:     release.Version,
+				Channel:     release.Channel,
+				ReleasedAt:  release.ReleasedAt,
+			}
+
+			candidate.Size, err = s.storage.VersionSize(release.ProductName, release.Version)
+			if err != nil {
+				candidate.Size = release.ArtifactSize
+			}
+
+			switch {
+			case installed[installedKey(release.ProductName, release.Version)]:
+				candidate.Reason = "installed"
+			case pinned[release.ID]:
+				candidate.Reason = "pinned"
+			case latest != nil && latest.ID == release.ID:
+				candidate.Reason = "latest"
+			}
+			if candidate.Reason != "" {
+				report.Protected = append(report.Protected, candidate)
+				continue
+			}
+
+			if !dryRun {
+				// Remove the record first so a half-finished run never leaves
+				// a release pointing at a missing artifact
+				if err := s.releaseService.DeleteRelease(ctx, release.ID); err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("%s %s: failed to delete release: %v", release.ProductName, release.Version, err))
+					continue
+				}
+				freed, err := s.storage.DeleteVersion(release.ProductName, release.Version)
+				if err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("%s %s: %v", release.ProductName, release.Version, err))
+				}
+				candidate.Size = freed
+			}
+
+			report.Deleted = append(report.Deleted, candidate)
+			report.BytesReclaimed += candidate.Size
+		}
+	}
+
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// RunScheduled runs garbage collection every interval until ctx is cancelled
+func (s *Service) RunScheduled(ctx context.Context, interval time.Duration, dryRun bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := s.RunGC(ctx, dryRun)
+			if err != nil {
+				log.Printf("Retention GC failed: %v", err)
+				continue
+			}
+			log.Printf("Retention GC (dry run: %t): %d releases removed, %d protected, %d bytes reclaimed, %d errors",
+				report.DryRun, len(report.Deleted), len(report.Protected), report.BytesReclaimed, len(report.Errors))
+		}
+	}
+}
+
+// expiredReleases returns the releases of a policy's channel that the policy does
+// not retain. Drafts are left alone and not counted: they have not been offered
+// to anyone yet, and an old draft is usually one still being prepared.
+func (s *Service) expiredReleases(ctx context.Context, policy types.RetentionPolicy, now time.Time) ([]types.Release, error) {
+	all, err := s.releases.ListByProduct(ctx, policy.ProductName)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := now.AddDate(0, 0, -policy.MaxAgeDays)
+
+	// Releases are ordered newest first
+	var expired []types.Release
+	kept := 0
+	for _, release := range all {
+		if release.Channel != policy.Channel || release.Status == types.ReleaseStatusDraft {
+			continue
+		}
+		if policy.KeepLast > 0 && kept < policy.KeepLast {
+			kept++
+			continue
+		}
+		if policy.MaxAgeDays > 0 && release.ReleasedAt.After(cutoff) {
+			continue
+		}
+		expired = append(expired, release)
+	}
+
+	return expired, nil
+}
+
+func (s *Service) requireRelease(ctx context.Context, product, version string) (*types.Release, error) {
+	release, err := s.releases.GetByProductVersion(ctx, product, version)
+	if err != nil {
+		return nil, err
+	}
+	if release == nil {
+		return nil, releases.ErrReleaseNotFound
+	}
+	return release, nil
+}
@@ -0,0 +1,86 @@
+package retention
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database/dbtest"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/products"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/releases"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/storage"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+func TestRunGC(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		ctx := context.Background()
+		err := products.NewRepository(db).Create(ctx, &types.Product{
+			Name: "test-agent", DisplayName: "test-agent", Type: "binary", DefaultChannel: "stable",
+		})
+		if err != nil {
+			t.Fatalf("create product: %v", err)
+		}
+		store, err := storage.NewLocalStorage(t.TempDir())
+		if err != nil {
+			t.Fatalf("create storage: %v", err)
+		}
+
+		now := time.Now()
+		repo := releases.NewRepository(db)
+		for _, r := range []struct {
+			version    string
+			status     string
+			releasedAt time.Time
+		}{
+			{"0.9.0", types.ReleaseStatusDraft, now.AddDate(-1, 0, 0)},
+			{"1.0.0", types.ReleaseStatusPublished, now.AddDate(0, 0, -90)},
+			{"1.1.0", types.ReleaseStatusPublished, now.AddDate(0, 0, -60)},
+			{"1.2.0", types.ReleaseStatusPublished, now.AddDate(0, 0, -1)},
+		} {
+			release := &types.Release{
+				ProductName: "test-agent",
+				Version:     r.version,
+				Channel:     "stable",
+				Status:      r.status,
+				ReleasedAt:  r.releasedAt,
+				Manifest:    types.Manifest{Product: "test-agent", Version: r.version, Channel: "stable"},
+			}
+			if err := repo.Create(ctx, release); err != nil {
+				t.Fatalf("Create %s: %v", r.version, err)
+			}
+		}
+
+		releaseService := releases.NewService(db, store)
+		releaseService.EnableCache(releases.NewCache(time.Hour))
+		svc := NewService(db, releaseService, store)
+		if _, err := svc.SetPolicy(ctx, "test-agent", "stable", SetPolicyRequest{KeepLast: 1, MaxAgeDays: 30}); err != nil {
+			t.Fatalf("SetPolicy: %v", err)
+		}
+
+		// Cached before the release is collected
+		if info, _ := releaseService.GetReleaseInfo(ctx, "test-agent", "1.0.0", ""); info == nil {
+			t.Fatal("GetReleaseInfo(1.0.0) = nil before collection")
+		}
+
+		report, err := svc.RunGC(ctx, false)
+		if err != nil {
+			t.Fatalf("RunGC: %v", err)
+		}
+		var deleted []string
+		for _, candidate := range report.Deleted {
+			deleted = append(deleted, candidate.Version)
+		}
+		if len(deleted) != 2 || deleted[0] != "1.1.0" || deleted[1] != "1.0.0" || len(report.Errors) != 0 {
+			t.Errorf("deleted %v (errors %v), want 1.1.0 and 1.0.0 but not the draft", deleted, report.Errors)
+		}
+
+		if info, err := releaseService.GetReleaseInfo(ctx, "test-agent", "1.0.0", ""); err != nil || info != nil {
+			t.Errorf("GetReleaseInfo(1.0.0) after collection = %+v, %v; want nil from an invalidated cache", info, err)
+		}
+		if draft, _ := releaseService.GetRelease(ctx, "test-agent", "0.9.0"); draft == nil {
+			t.Error("the draft was collected")
+		}
+	})
+}
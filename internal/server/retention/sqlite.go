@@ -0,0 +1,184 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// SQLiteRepository stores retention policies and release pins in a SQLite database
+type SQLiteRepository struct {
+	db *database.SQLite
+}
+
+// NewSQLiteRepository creates a repository backed by SQLite
+func NewSQLiteRepository(db *database.DB) *SQLiteRepository {
+	return &SQLiteRepository{db: db.SQLite}
+}
+
+// ListPolicies implements Repository
+func (r *SQLiteRepository) ListPolicies(ctx context.Context) ([]types.RetentionPolicy, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, product_name, channel, keep_last, max_age_days, created_at, updated_at
+		FROM retention_policies
+		ORDER BY product_name, channel
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list retention policies: %w", err)
+	}
+	defer rows.Close()
+
+	var policies []types.RetentionPolicy
+	for rows.Next() {
+		var policy types.RetentionPolicy
+		if err := rows.Scan(&policy.ID, &policy.ProductName, &policy.Channel, &policy.KeepLast,
+			&policy.MaxAgeDays, &policy.CreatedAt, &policy.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan retention policy: %w", err)
+		}
+		policies = append(policies, policy)
+	}
+
+	return policies, rows.Err()
+}
+
+// UpsertPolicy implements Repository
+func (r *SQLiteRepository) UpsertPolicy(ctx context.Context, policy *types.RetentionPolicy) error {
+	now := time.Now()
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO retention_policies (id, product_name, channel, keep_last, max_age_days, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+		ON CONFLICT (product_name, channel)
+		DO UPDATE SET keep_last = excluded.keep_last, max_age_days = excluded.max_age_days, updated_at = excluded.updated_at
+		RETURNING id, created_at, updated_at
+	`, uuid.New().String(), policy.ProductName, policy.Channel, policy.KeepLast, policy.MaxAgeDays, now).Scan(
+		&policy.ID, &policy.CreatedAt, &policy.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save retention policy: %w", err)
+	}
+	return nil
+}
+
+// DeletePolicy implements Repository
+func (r *SQLiteRepository) DeletePolicy(ctx context.Context, product, channel string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		DELETE FROM retention_policies WHERE product_name = $1 AND channel = $2
+	`, product, channel)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete retention policy: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// ListPins implements Repository
+func (r *SQLiteRepository) ListPins(ctx context.Context, releaseID string) ([]types.ReleasePin, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT p.id, p.release_id, rel.product_name, rel.version, p.customer_id,
+			   COALESCE(p.reason, ''), COALESCE(p.created_by, ''), p.created_at
+		FROM release_pins p
+		JOIN releases rel ON rel.id = p.release_id
+		WHERE p.release_id = $1
+		ORDER BY p.created_at
+	`, releaseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list release pins: %w", err)
+	}
+	defer rows.Close()
+
+	var pins []types.ReleasePin
+	for rows.Next() {
+		var pin types.ReleasePin
+		if err := rows.Scan(&pin.ID, &pin.ReleaseID, &pin.ProductName, &pin.Version, &pin.CustomerID,
+			&pin.Reason, &pin.CreatedBy, &pin.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan release pin: %w", err)
+		}
+		pins = append(pins, pin)
+	}
+
+	return pins, rows.Err()
+}
+
+// CreatePin implements Repository
+func (r *SQLiteRepository) CreatePin(ctx context.Context, pin *types.ReleasePin) error {
+	pin.CreatedAt = time.Now()
+
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO release_pins (id, release_id, customer_id, reason, created_by, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6)
+		ON CONFLICT (release_id, customer_id)
+		DO UPDATE SET reason = excluded.reason
+		RETURNING id, created_at
+	`, uuid.New().String(), pin.ReleaseID, pin.CustomerID, pin.Reason, pin.CreatedBy, pin.CreatedAt).Scan(
+		&pin.ID, &pin.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to pin release: %w", err)
+	}
+	return nil
+}
+
+// DeletePin implements Repository
+func (r *SQLiteRepository) DeletePin(ctx context.Context, releaseID, customerID string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		DELETE FROM release_pins WHERE release_id = $1 AND customer_id = $2
+	`, releaseID, customerID)
+	if err != nil {
+		return false, fmt.Errorf("failed to unpin release: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// PinnedReleaseIDs implements Repository
+func (r *SQLiteRepository) PinnedReleaseIDs(ctx context.Context) (map[string]bool, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT DISTINCT release_id FROM release_pins`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pinned releases: %w", err)
+	}
+	defer rows.Close()
+
+	pinned := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan pinned release: %w", err)
+		}
+		pinned[id] = true
+	}
+
+	return pinned, rows.Err()
+}
+
+// InstalledVersions implements Repository
+func (r *SQLiteRepository) InstalledVersions(ctx context.Context) (map[string]bool, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT DISTINCT json_extract(p.value, '$.name'), json_extract(p.value, '$.version')
+		FROM instances i, json_each(
+			CASE WHEN json_type(i.last_heartbeat_data, '$.products') = 'array'
+				 THEN json_extract(i.last_heartbeat_data, '$.products') ELSE '[]' END
+		) p
+		WHERE i.last_heartbeat_data IS NOT NULL
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list installed versions: %w", err)
+	}
+	defer rows.Close()
+
+	installed := make(map[string]bool)
+	for rows.Next() {
+		var name, version *string
+		if err := rows.Scan(&name, &version); err != nil {
+			return nil, fmt.Errorf("failed to scan installed version: %w", err)
+		}
+		if name == nil || version == nil {
+			continue
+		}
+		installed[installedKey(*name, *version)] = true
+	}
+
+	return installed, rows.Err()
+}
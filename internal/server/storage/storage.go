@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -9,9 +10,13 @@ import (
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
 )
 
+// ErrArtifactExists is returned when saving an artifact that is already stored
+var ErrArtifactExists = errors.New("artifact already exists")
+
 // Storage interface for artifact storage
 type Storage interface {
-	// Save stores an artifact and returns the path
+	// Save stores an artifact and returns the path. Stored artifacts are never
+	// replaced; saving one again returns ErrArtifactExists.
 	Save(product, version, filename string, reader io.Reader) (string, error)
 	// Get returns a reader for an artifact
 	Get(product, version, filename string) (io.ReadCloser, error)
@@ -21,6 +26,10 @@ type Storage interface {
 	Exists(product, version, filename string) bool
 	// GetPath returns the full path to an artifact
 	GetPath(product, version, filename string) string
+	// VersionSize returns the total size of all artifacts of a version
+	VersionSize(product, version string) (int64, error)
+	// DeleteVersion removes all artifacts of a version and returns the bytes freed
+	DeleteVersion(product, version string) (int64, error)
 }
 
 // LocalStorage implements Storage for local filesystem
@@ -58,13 +67,21 @@ func (s *LocalStorage) Save(product, version, filename string, reader io.Reader)
 	}
 
 	path := filepath.Join(dir, filename)
-	file, err := os.Create(path)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return "", fmt.Errorf("%w: %s/%s/%s", ErrArtifactExists, product, version, filename)
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed to create file: %w", err)
 	}
-	defer file.Close()
 
-	if _, err := io.Copy(file, reader); err != nil {
+	_, err = io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Leave nothing behind, so the upload can be retried
+		os.Remove(path)
 		return "", fmt.Errorf("failed to write file: %w", err)
 	}
 
@@ -99,3 +116,41 @@ func (s *LocalStorage) GetPath(product, version, filename string) string {
 	return filepath.Join(s.basePath, product, version, filename)
 }
 
+
+// VersionSize returns the total size of all artifacts of a version
+func (s *LocalStorage) VersionSize(product, version string) (int64, error) {
+	var size int64
+	err := filepath.Walk(filepath.Join(s.basePath, product, version), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat artifacts: %w", err)
+	}
+	return size, nil
+}
+
+// DeleteVersion removes all artifacts of a version
+func (s *LocalStorage) DeleteVersion(product, version string) (int64, error) {
+	size, err := s.VersionSize(product, version)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.RemoveAll(filepath.Join(s.basePath, product, version)); err != nil {
+		return 0, fmt.Errorf("failed to remove artifacts: %w", err)
+	}
+
+	// Drop the product directory once its last version is gone
+	os.Remove(filepath.Join(s.basePath, product))
+
+	return size, nil
+}
@@ -0,0 +1,157 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+)
+
+const (
+	instrumentation = "github.com/cyfox-labs/updates-mysoc-ai/internal/server"
+	modulePrefix    = "github.com/cyfox-labs/updates-mysoc-ai/internal/server/"
+)
+
+// Setup exports spans over OTLP/HTTP to cfg.OTLPEndpoint. Without an
+// endpoint tracing stays disabled and spans cost next to nothing. The
+// returned function flushes spans that have not been exported yet.
+func Setup(ctx context.Context, cfg config.TelemetryConfig, version string) (func(context.Context) error, error) {
+	if cfg.OTLPEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	// Like OTEL_EXPORTER_OTLP_ENDPOINT, the endpoint is the collector's base URL
+	endpoint := strings.TrimSuffix(cfg.OTLPEndpoint, "/") + "/v1/traces"
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName("update-server"),
+		semconv.ServiceVersion(version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe tracing resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TraceSampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+// Start starts a span named after the operation, e.g. "licensing.ActivateLicense"
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentation).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err on span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Middleware starts a server span for each request, continuing a trace
+// propagated by the caller. The span is named after the matched route once
+// routing is done.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := otel.Tracer(instrumentation).Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				semconv.ClientAddress(r.RemoteAddr),
+				semconv.UserAgentOriginal(r.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		if route := RoutePattern(r); route != "" {
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+// RoutePattern returns the route a request matched, e.g.
+// "/api/v1/releases/{product}/latest", or "" if none did. It is complete
+// only once the router has handled the request.
+func RoutePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		return rctx.RoutePattern()
+	}
+	return ""
+}
+
+// StartQuery starts a client span for a database statement, named after the
+// repository method that issued it. Statements outside a sampled trace, such
+// as those of background jobs when they are not traced, get no span.
+func StartQuery(ctx context.Context, system, statement string) (context.Context, trace.Span) {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+	return otel.Tracer(instrumentation).Start(ctx, queryCaller(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemKey.String(system),
+			semconv.DBQueryText(statement),
+		),
+	)
+}
+
+// queryCaller names the first function on the stack outside the database
+// layer, such as "licensing.(*PostgresInstanceRepository).UpdateHeartbeat"
+func queryCaller() string {
+	pcs := make([]uintptr, 16)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		name := frame.Function
+		if strings.HasPrefix(name, modulePrefix) &&
+			!strings.HasPrefix(name, modulePrefix+"database.") &&
+			!strings.HasPrefix(name, modulePrefix+"tracing.") {
+			return strings.TrimPrefix(name, modulePrefix)
+		}
+		if !more {
+			return "db.query"
+		}
+	}
+}
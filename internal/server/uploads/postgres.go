@@ -0,0 +1,130 @@
+package uploads
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// PostgresRepository stores upload sessions in PostgreSQL
+type PostgresRepository struct {
+	db *database.DB
+}
+
+// NewPostgresRepository creates a repository backed by PostgreSQL
+func NewPostgresRepository(db *database.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+// Create creates a new upload session
+func (r *PostgresRepository) Create(ctx context.Context, session *types.UploadSession) error {
+	session.ID = uuid.New().String()
+	session.Status = types.UploadStatusOpen
+	session.CreatedAt = time.Now()
+	session.UpdatedAt = session.CreatedAt
+
+	_, err := r.db.Pool.Exec(ctx, `
+		INSERT INTO upload_sessions (id, product_name, version, filename, channel, release_notes, min_updater_version,
+			total_size, received_bytes, status, created_by, created_at, updated_at, expires_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8, 0, $9, NULLIF($10, ''), $11, $12, $13)
+	`, session.ID, session.ProductName, session.Version, session.Filename, session.Channel, session.ReleaseNotes,
+		session.MinUpdaterVersion, session.TotalSize, session.Status, session.CreatedBy, session.CreatedAt,
+		session.UpdatedAt, session.ExpiresAt)
+
+	return err
+}
+
+// GetByID retrieves an upload session
+func (r *PostgresRepository) GetByID(ctx context.Context, id string) (*types.UploadSession, error) {
+	session, err := scanSession(r.db.Pool.QueryRow(ctx, `
+		SELECT `+sessionColumns+`
+		FROM upload_sessions
+		WHERE id = $1
+	`, id))
+
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upload session: %w", err)
+	}
+
+	return session, nil
+}
+
+// WithLockedSession runs fn while holding a row lock on the session, so chunks of
+// one session are written one at a time. If fn returns nil the session's progress,
+// status, checksum and expiry are saved.
+func (r *PostgresRepository) WithLockedSession(ctx context.Context, id string, fn func(session *types.UploadSession) error) (*types.UploadSession, error) {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	session, err := scanSession(tx.QueryRow(ctx, `
+		SELECT `+sessionColumns+`
+		FROM upload_sessions
+		WHERE id = $1
+		FOR UPDATE
+	`, id))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock upload session: %w", err)
+	}
+
+	if err := fn(session); err != nil {
+		return nil, err
+	}
+
+	session.UpdatedAt = time.Now()
+	if _, err := tx.Exec(ctx, `
+		UPDATE upload_sessions
+		SET received_bytes = $2, status = $3, checksum = NULLIF($4, ''), updated_at = $5, expires_at = $6
+		WHERE id = $1
+	`, session.ID, session.ReceivedBytes, session.Status, session.Checksum, session.UpdatedAt, session.ExpiresAt); err != nil {
+		return nil, fmt.Errorf("failed to update upload session: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit upload session: %w", err)
+	}
+
+	return session, nil
+}
+
+// Delete deletes an upload session
+func (r *PostgresRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.Pool.Exec(ctx, `DELETE FROM upload_sessions WHERE id = $1`, id)
+	return err
+}
+
+// ListExpired retrieves the IDs of sessions past their expiry
+func (r *PostgresRepository) ListExpired(ctx context.Context, now time.Time) ([]string, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT id FROM upload_sessions WHERE expires_at < $1
+	`, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired upload sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan upload session: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
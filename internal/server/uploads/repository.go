@@ -0,0 +1,51 @@
+package uploads
+
+import (
+	"context"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+const sessionColumns = `id, product_name, version, filename, COALESCE(channel, ''), COALESCE(release_notes, ''),
+	COALESCE(min_updater_version, ''), total_size, received_bytes, status, COALESCE(checksum, ''),
+	COALESCE(created_by, ''), created_at, updated_at, expires_at`
+
+// Repository handles upload session database operations
+type Repository interface {
+	// Create creates a new upload session
+	Create(ctx context.Context, session *types.UploadSession) error
+	// GetByID retrieves an upload session, or nil if there is none
+	GetByID(ctx context.Context, id string) (*types.UploadSession, error)
+	// WithLockedSession runs fn while holding a lock on the session, so chunks of
+	// one session are written one at a time. If fn returns nil the session's progress,
+	// status, checksum and expiry are saved.
+	WithLockedSession(ctx context.Context, id string, fn func(session *types.UploadSession) error) (*types.UploadSession, error)
+	// Delete deletes an upload session
+	Delete(ctx context.Context, id string) error
+	// ListExpired retrieves the IDs of sessions past their expiry
+	ListExpired(ctx context.Context, now time.Time) ([]string, error)
+}
+
+// NewRepository creates an upload session repository for the configured database
+func NewRepository(db *database.DB) Repository {
+	if db.Driver == database.DriverSQLite {
+		return NewSQLiteRepository(db)
+	}
+	return NewPostgresRepository(db)
+}
+
+// scanSession scans a row selected with sessionColumns
+func scanSession(row database.Row) (*types.UploadSession, error) {
+	var session types.UploadSession
+	err := row.Scan(
+		&session.ID, &session.ProductName, &session.Version, &session.Filename, &session.Channel,
+		&session.ReleaseNotes, &session.MinUpdaterVersion, &session.TotalSize, &session.ReceivedBytes,
+		&session.Status, &session.Checksum, &session.CreatedBy, &session.CreatedAt, &session.UpdatedAt,
+		&session.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
@@ -0,0 +1,439 @@
+package uploads
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/releases"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/storage"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/tracing"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+var (
+	ErrSessionNotFound  = errors.New("upload session not found")
+	ErrSessionCompleted = errors.New("upload session is already completed")
+	ErrInvalidUpload    = errors.New("invalid upload")
+	ErrTooLarge         = errors.New("artifact exceeds the maximum upload size")
+	ErrOffsetMismatch   = errors.New("chunk offset does not match the bytes received so far")
+	ErrChunkTooLarge    = errors.New("chunk extends past the declared upload size")
+	ErrIncomplete       = errors.New("upload is incomplete")
+	ErrChecksumMismatch = errors.New("checksum does not match the uploaded data")
+)
+
+// Service handles resumable, chunked artifact uploads
+type Service struct {
+	repo     Repository
+	releases *releases.Service
+	storage  storage.Storage
+	config   config.UploadConfig
+}
+
+// NewService creates a new upload service
+func NewService(db *database.DB, store storage.Storage, cfg config.UploadConfig) *Service {
+	return &Service{
+		repo:     NewRepository(db),
+		releases: releases.NewService(db, store),
+		storage:  store,
+		config:   cfg,
+	}
+}
+
+// CreateSessionRequest starts a resumable upload
+type CreateSessionRequest struct {
+	Product           string `json:"product"`
+	Version           string `json:"version"`
+	Filename          string `json:"filename"`
+	Size              int64  `json:"size"`
+	Channel           string `json:"channel"`
+	ReleaseNotes      string `json:"release_notes"`
+	MinUpdaterVersion string `json:"min_updater_version"`
+}
+
+// CompleteResult is returned when an upload is finalized
+type CompleteResult struct {
+	Session     *types.UploadSession `json:"session"`
+	Release     *types.Release       `json:"release,omitempty"` // set when the upload created the release
+	DownloadURL string               `json:"download_url"`
+}
+
+// CreateSession validates the upload and opens a session for its chunks
+func (s *Service) CreateSession(ctx context.Context, req CreateSessionRequest, actor string) (*types.UploadSession, error) {
+	if req.Product == "" || req.Version == "" || req.Filename == "" {
+		return nil, fmt.Errorf("%w: product, version and filename are required", ErrInvalidUpload)
+	}
+	if filepath.Base(req.Filename) != req.Filename || req.Filename == "." || req.Filename == ".." ||
+		strings.Contains(req.Version, "/") || strings.Contains(req.Version, "..") {
+		return nil, fmt.Errorf("%w: version and filename must not contain path separators", ErrInvalidUpload)
+	}
+	if req.Size <= 0 {
+		return nil, fmt.Errorf("%w: size must be positive", ErrInvalidUpload)
+	}
+	if req.Size > int64(s.config.MaxSize) {
+		return nil, fmt.Errorf("%w (%d bytes)", ErrTooLarge, s.config.MaxSize)
+	}
+
+	if _, err := s.releases.RequireProduct(ctx, req.Product); err != nil {
+		return nil, err
+	}
+	// Fail before any data is sent; Complete checks again
+	if err := s.releases.CheckArtifact(ctx, req.Product, req.Version, req.Filename); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(s.config.TempPath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+
+	session := &types.UploadSession{
+		ProductName:       req.Product,
+		Version:           req.Version,
+		Filename:          req.Filename,
+		Channel:           req.Channel,
+		ReleaseNotes:      req.ReleaseNotes,
+		MinUpdaterVersion: req.MinUpdaterVersion,
+		TotalSize:         req.Size,
+		CreatedBy:         actor,
+		ExpiresAt:         time.Now().Add(s.config.SessionTTL),
+	}
+	if err := s.repo.Create(ctx, session); err != nil {
+		return nil, fmt.Errorf("failed to create upload session: %w", err)
+	}
+
+	return session, nil
+}
+
+// GetSession retrieves an upload session, e.g. to find the offset to resume from
+func (s *Service) GetSession(ctx context.Context, id string) (*types.UploadSession, error) {
+	session, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+// WriteChunk appends a chunk at offset, which must equal the bytes received so far.
+// The chunk is spooled to its own file before the session is locked, so the lock is
+// only held to commit it. A chunk that fails midway is discarded and can simply be
+// sent again.
+func (s *Service) WriteChunk(ctx context.Context, id string, offset int64, chunk io.Reader) (*types.UploadSession, error) {
+	session, err := s.GetSession(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != types.UploadStatusOpen {
+		return nil, ErrSessionCompleted
+	}
+	if offset != session.ReceivedBytes {
+		return session, ErrOffsetMismatch
+	}
+
+	spooled, written, err := s.spoolChunk(id, session.TotalSize-offset, chunk)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(spooled)
+
+	var current *types.UploadSession
+	session, err = s.repo.WithLockedSession(ctx, id, func(session *types.UploadSession) error {
+		current = session
+		// Another request may have committed a chunk while this one was spooled
+		if session.Status != types.UploadStatusOpen {
+			return ErrSessionCompleted
+		}
+		if offset != session.ReceivedBytes {
+			return ErrOffsetMismatch
+		}
+
+		if written > 0 {
+			if err := os.Rename(spooled, s.chunkPath(id, offset)); err != nil {
+				return fmt.Errorf("failed to store chunk: %w", err)
+			}
+		}
+
+		session.ReceivedBytes += written
+		session.ExpiresAt = time.Now().Add(s.config.SessionTTL)
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrOffsetMismatch) && current != nil {
+			return current, err
+		}
+		return nil, err
+	}
+	if session == nil {
+		return nil, ErrSessionNotFound
+	}
+
+	return session, nil
+}
+
+// Complete verifies the uploaded data against the expected SHA-256 and stores the
+// artifact. The first artifact of a version creates a draft release; later ones are
+// stored alongside it while it is a draft. Completing an already completed session
+// returns it unchanged.
+func (s *Service) Complete(ctx context.Context, id, expectedChecksum string) (_ *CompleteResult, err error) {
+	ctx, span := tracing.Start(ctx, "uploads.Complete")
+	defer func() { tracing.End(span, err) }()
+
+	expectedChecksum = strings.ToLower(strings.TrimSpace(expectedChecksum))
+	if expectedChecksum == "" {
+		return nil, fmt.Errorf("%w: sha256 is required", ErrInvalidUpload)
+	}
+
+	session, err := s.GetSession(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	result := &CompleteResult{DownloadURL: "/" + session.ProductName + "/" + session.Version + "/" + session.Filename}
+
+	if session.Status == types.UploadStatusCompleted {
+		if session.Checksum != expectedChecksum {
+			return nil, ErrChecksumMismatch
+		}
+		result.Session = session
+		return result, nil
+	}
+	if session.ReceivedBytes != session.TotalSize {
+		return nil, fmt.Errorf("%w: received %d of %d bytes", ErrIncomplete, session.ReceivedBytes, session.TotalSize)
+	}
+
+	// Verified and stored without the session lock, which on SQLite is the database
+	// write lock the release needs. Stored artifacts are never replaced, so of two
+	// concurrent completions only one stores the artifact.
+	checksum, err := s.uploadChecksum(session)
+	if err != nil {
+		return nil, err
+	}
+	if checksum != expectedChecksum {
+		return nil, fmt.Errorf("%w: got %s", ErrChecksumMismatch, checksum)
+	}
+
+	result.Release, err = s.storeArtifact(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err = s.repo.WithLockedSession(ctx, id, func(session *types.UploadSession) error {
+		session.Status = types.UploadStatusCompleted
+		session.Checksum = checksum
+		session.ExpiresAt = time.Now().Add(s.config.SessionTTL)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, ErrSessionNotFound
+	}
+
+	s.removeUpload(session.ID)
+	result.Session = session
+	return result, nil
+}
+
+// Abort cancels an upload and discards its data
+func (s *Service) Abort(ctx context.Context, id string) error {
+	session, err := s.GetSession(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.Delete(ctx, session.ID); err != nil {
+		return fmt.Errorf("failed to delete upload session: %w", err)
+	}
+	s.removeUpload(session.ID)
+	return nil
+}
+
+// CleanupExpired removes sessions that have been idle longer than the session TTL
+func (s *Service) CleanupExpired(ctx context.Context) (int, error) {
+	ids, err := s.repo.ListExpired(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if err := s.repo.Delete(ctx, id); err != nil {
+			return 0, fmt.Errorf("failed to delete upload session: %w", err)
+		}
+		s.removeUpload(id)
+	}
+
+	return len(ids), nil
+}
+
+// RunCleanup removes abandoned sessions every interval until ctx is cancelled
+func (s *Service) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := s.CleanupExpired(ctx)
+			if err != nil {
+				log.Printf("Upload session cleanup failed: %v", err)
+				continue
+			}
+			if removed > 0 {
+				log.Printf("Removed %d abandoned upload sessions", removed)
+			}
+		}
+	}
+}
+
+// storeArtifact moves a verified upload into release storage
+func (s *Service) storeArtifact(ctx context.Context, session *types.UploadSession) (*types.Release, error) {
+	file, err := s.openUpload(session)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	existing, err := s.releases.GetRelease(ctx, session.ProductName, session.Version)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if _, err := s.releases.SaveArtifact(ctx, session.ProductName, session.Version, session.Filename, file); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	return s.releases.CreateRelease(ctx, releases.CreateReleaseRequest{
+		ProductName:       session.ProductName,
+		Version:           session.Version,
+		Channel:           session.Channel,
+		ReleaseNotes:      session.ReleaseNotes,
+		MinUpdaterVersion: session.MinUpdaterVersion,
+		Filename:          session.Filename,
+		FileSize:          session.TotalSize,
+		File:              file,
+	})
+}
+
+// spoolChunk writes a chunk of at most remaining bytes to a temporary file
+func (s *Service) spoolChunk(id string, remaining int64, chunk io.Reader) (string, int64, error) {
+	file, err := os.CreateTemp(s.config.TempPath, id+".*.tmp")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create chunk file: %w", err)
+	}
+
+	written, err := io.Copy(file, io.LimitReader(chunk, remaining+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", 0, fmt.Errorf("failed to write chunk: %w", err)
+	}
+	if written > remaining {
+		os.Remove(file.Name())
+		return "", 0, ErrChunkTooLarge
+	}
+
+	return file.Name(), written, nil
+}
+
+// chunkPath names the chunk at offset so that a session's chunks sort in order
+func (s *Service) chunkPath(id string, offset int64) string {
+	return filepath.Join(s.config.TempPath, fmt.Sprintf("%s.%020d.chunk", id, offset))
+}
+
+// openUpload returns the data received for a session, read from its chunks in order
+func (s *Service) openUpload(session *types.UploadSession) (io.ReadCloser, error) {
+	paths, err := filepath.Glob(filepath.Join(s.config.TempPath, session.ID+".*.chunk"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list upload chunks: %w", err)
+	}
+	sort.Strings(paths)
+
+	upload := &chunkReader{}
+	var readers []io.Reader
+	var next int64
+	for _, path := range paths {
+		// Chunks past the received bytes were never committed
+		if next == session.ReceivedBytes {
+			break
+		}
+		if path != s.chunkPath(session.ID, next) {
+			break
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			upload.Close()
+			return nil, fmt.Errorf("failed to open upload chunk: %w", err)
+		}
+		upload.files = append(upload.files, file)
+		info, err := file.Stat()
+		if err != nil {
+			upload.Close()
+			return nil, fmt.Errorf("failed to stat upload chunk: %w", err)
+		}
+		readers = append(readers, file)
+		next += info.Size()
+	}
+	if next != session.ReceivedBytes {
+		upload.Close()
+		return nil, fmt.Errorf("upload data is missing from offset %d", next)
+	}
+
+	upload.Reader = io.MultiReader(readers...)
+	return upload, nil
+}
+
+// uploadChecksum returns the SHA-256 of the data received for a session
+func (s *Service) uploadChecksum(session *types.UploadSession) (string, error) {
+	file, err := s.openUpload(session)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", fmt.Errorf("failed to checksum upload: %w", err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// removeUpload deletes the chunks of a session and anything still being spooled
+func (s *Service) removeUpload(id string) {
+	paths, _ := filepath.Glob(filepath.Join(s.config.TempPath, id+".*"))
+	for _, path := range paths {
+		os.Remove(path)
+	}
+}
+
+// chunkReader reads the chunks of an upload as one stream
+type chunkReader struct {
+	io.Reader
+	files []*os.File
+}
+
+func (r *chunkReader) Close() error {
+	for _, file := range r.files {
+		file.Close()
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package uploads
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database/dbtest"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/products"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/releases"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/storage"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// newTestService returns a service storing artifacts and chunks in temporary directories
+func newTestService(t *testing.T, db *database.DB) *Service {
+	t.Helper()
+	err := products.NewRepository(db).Create(context.Background(), &types.Product{
+		Name: "test-agent", DisplayName: "test-agent", Type: "binary", DefaultChannel: "stable",
+	})
+	if err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	store, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("create storage: %v", err)
+	}
+	return NewService(db, store, config.UploadConfig{TempPath: t.TempDir(), MaxSize: 1 << 20, SessionTTL: time.Hour})
+}
+
+// upload sends data in chunks of chunkSize and completes the session
+func upload(t *testing.T, svc *Service, session *types.UploadSession, data []byte, chunkSize int) (*CompleteResult, error) {
+	t.Helper()
+	ctx := context.Background()
+	for offset := 0; offset < len(data); offset += chunkSize {
+		end := min(offset+chunkSize, len(data))
+		if _, err := svc.WriteChunk(ctx, session.ID, int64(offset), bytes.NewReader(data[offset:end])); err != nil {
+			t.Fatalf("WriteChunk at %d: %v", offset, err)
+		}
+	}
+	sum := sha256.Sum256(data)
+	return svc.Complete(ctx, session.ID, hex.EncodeToString(sum[:]))
+}
+
+func TestUploadChunks(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		ctx := context.Background()
+		svc := newTestService(t, db)
+		data := []byte(strings.Repeat("artifact data ", 100))
+
+		session, err := svc.CreateSession(ctx, CreateSessionRequest{
+			Product: "test-agent", Version: "1.0.0", Filename: "agent-linux-amd64", Size: int64(len(data)),
+		}, "tester")
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+
+		if _, err := svc.WriteChunk(ctx, session.ID, 0, bytes.NewReader(data[:500])); err != nil {
+			t.Fatalf("WriteChunk: %v", err)
+		}
+		// A chunk resent after a lost response is refused with the offset to resume from
+		current, err := svc.WriteChunk(ctx, session.ID, 0, bytes.NewReader(data[:500]))
+		if !errors.Is(err, ErrOffsetMismatch) || current == nil || current.ReceivedBytes != 500 {
+			t.Errorf("WriteChunk(stale offset) = %+v, %v; want ErrOffsetMismatch at 500", current, err)
+		}
+		if _, err := svc.WriteChunk(ctx, session.ID, 500, bytes.NewReader(data)); !errors.Is(err, ErrChunkTooLarge) {
+			t.Errorf("WriteChunk(past size) = %v, want ErrChunkTooLarge", err)
+		}
+		if _, err := svc.Complete(ctx, session.ID, "0000"); !errors.Is(err, ErrIncomplete) {
+			t.Errorf("Complete(incomplete) = %v, want ErrIncomplete", err)
+		}
+
+		for offset := 500; offset < len(data); offset += 300 {
+			end := min(offset+300, len(data))
+			if _, err := svc.WriteChunk(ctx, session.ID, int64(offset), bytes.NewReader(data[offset:end])); err != nil {
+				t.Fatalf("WriteChunk at %d: %v", offset, err)
+			}
+		}
+		sum := sha256.Sum256(data)
+		result, err := svc.Complete(ctx, session.ID, hex.EncodeToString(sum[:]))
+		if err != nil {
+			t.Fatalf("Complete: %v", err)
+		}
+		if result.Release == nil || result.Release.Status != types.ReleaseStatusDraft || result.Release.Checksum != hex.EncodeToString(sum[:]) {
+			t.Errorf("Complete release = %+v, want a draft with the upload's checksum", result.Release)
+		}
+
+		stored, err := os.ReadFile(svc.storage.GetPath("test-agent", "1.0.0", "agent-linux-amd64"))
+		if err != nil || !bytes.Equal(stored, data) {
+			t.Errorf("stored artifact differs from the upload (%v)", err)
+		}
+		if left, _ := filepath.Glob(filepath.Join(svc.config.TempPath, "*")); len(left) != 0 {
+			t.Errorf("chunks left behind: %v", left)
+		}
+	})
+}
+
+func TestUploadConflicts(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.DB) {
+		ctx := context.Background()
+		svc := newTestService(t, db)
+		data := []byte("linux build")
+
+		create := func(filename string) (*types.UploadSession, error) {
+			return svc.CreateSession(ctx, CreateSessionRequest{
+				Product: "test-agent", Version: "1.0.0", Filename: filename, Size: int64(len(data)),
+			}, "tester")
+		}
+
+		first, err := create("agent-linux-amd64")
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		// Two sessions race for the same file; only the first to complete stores it
+		second, err := create("agent-linux-amd64")
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		if _, err := upload(t, svc, first, data, 4); err != nil {
+			t.Fatalf("Complete: %v", err)
+		}
+		if _, err := upload(t, svc, second, []byte("other build"), 4); !errors.Is(err, storage.ErrArtifactExists) {
+			t.Errorf("Complete(existing file) = %v, want ErrArtifactExists", err)
+		}
+		if _, err := create("agent-linux-amd64"); !errors.Is(err, storage.ErrArtifactExists) {
+			t.Errorf("CreateSession(existing file) = %v, want ErrArtifactExists", err)
+		}
+
+		// Drafts take further artifacts
+		arm, err := create("agent-linux-arm64")
+		if err != nil {
+			t.Fatalf("CreateSession(draft): %v", err)
+		}
+		if result, err := upload(t, svc, arm, data, 4); err != nil || result.Release != nil {
+			t.Errorf("Complete(draft) = %+v, %v; want the artifact added to the draft", result, err)
+		}
+
+		if _, err := svc.releases.PublishRelease(ctx, "test-agent", "1.0.0", nil, "tester"); err != nil {
+			t.Fatalf("PublishRelease: %v", err)
+		}
+		if _, err := create("agent-darwin-arm64"); !errors.Is(err, releases.ErrReleaseNotDraft) {
+			t.Errorf("CreateSession(published) = %v, want ErrReleaseNotDraft", err)
+		}
+		stored, _ := os.ReadFile(svc.storage.GetPath("test-agent", "1.0.0", "agent-linux-amd64"))
+		if !bytes.Equal(stored, data) {
+			t.Errorf("stored artifact = %q, want %q", stored, data)
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package uploads
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// SQLiteRepository stores upload sessions in a SQLite database
+type SQLiteRepository struct {
+	db *database.SQLite
+}
+
+// NewSQLiteRepository creates a repository backed by SQLite
+func NewSQLiteRepository(db *database.DB) *SQLiteRepository {
+	return &SQLiteRepository{db: db.SQLite}
+}
+
+// Create implements Repository
+func (r *SQLiteRepository) Create(ctx context.Context, session *types.UploadSession) error {
+	session.ID = uuid.New().String()
+	session.Status = types.UploadStatusOpen
+	session.CreatedAt = time.Now()
+	session.UpdatedAt = session.CreatedAt
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO upload_sessions (id, product_name, version, filename, channel, release_notes, min_updater_version,
+			total_size, received_bytes, status, created_by, created_at, updated_at, expires_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8, 0, $9, NULLIF($10, ''), $11, $12, $13)
+	`, session.ID, session.ProductName, session.Version, session.Filename, session.Channel, session.ReleaseNotes,
+		session.MinUpdaterVersion, session.TotalSize, session.Status, session.CreatedBy, session.CreatedAt,
+		session.UpdatedAt, session.ExpiresAt)
+
+	return err
+}
+
+// GetByID implements Repository
+func (r *SQLiteRepository) GetByID(ctx context.Context, id string) (*types.UploadSession, error) {
+	session, err := scanSession(r.db.QueryRowContext(ctx, `
+		SELECT `+sessionColumns+`
+		FROM upload_sessions
+		WHERE id = $1
+	`, id))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upload session: %w", err)
+	}
+
+	return session, nil
+}
+
+// WithLockedSession implements Repository. SQLite has no row locks, so fn runs
+// while the transaction holds the database write lock.
+func (r *SQLiteRepository) WithLockedSession(ctx context.Context, id string, fn func(session *types.UploadSession) error) (*types.UploadSession, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	session, err := scanSession(tx.QueryRowContext(ctx, `
+		SELECT `+sessionColumns+`
+		FROM upload_sessions
+		WHERE id = $1
+	`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock upload session: %w", err)
+	}
+
+	if err := fn(session); err != nil {
+		return nil, err
+	}
+
+	session.UpdatedAt = time.Now()
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE upload_sessions
+		SET received_bytes = $2, status = $3, checksum = NULLIF($4, ''), updated_at = $5, expires_at = $6
+		WHERE id = $1
+	`, session.ID, session.ReceivedBytes, session.Status, session.Checksum, session.UpdatedAt, session.ExpiresAt); err != nil {
+		return nil, fmt.Errorf("failed to update upload session: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit upload session: %w", err)
+	}
+
+	return session, nil
+}
+
+// Delete implements Repository
+func (r *SQLiteRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM upload_sessions WHERE id = $1`, id)
+	return err
+}
+
+// ListExpired implements Repository
+func (r *SQLiteRepository) ListExpired(ctx context.Context, now time.Time) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id FROM upload_sessions WHERE expires_at < $1
+	`, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired upload sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan upload session: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
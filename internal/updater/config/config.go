@@ -1,6 +1,9 @@
 package config
 
 import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"os"
 	"time"
@@ -13,10 +16,14 @@ type Config struct {
 	Server    ServerConfig    `yaml:"server"`
 	Instance  InstanceConfig  `yaml:"instance"`
 	Heartbeat HeartbeatConfig `yaml:"heartbeat"`
+	Spool     SpoolConfig     `yaml:"spool"`
 	Update    UpdateConfig    `yaml:"update"`
 	Products  []ProductConfig `yaml:"products"`
 	Security  SecurityConfig  `yaml:"security"`
+	Commands  CommandsConfig  `yaml:"commands"`
 	Logging   LoggingConfig   `yaml:"logging"`
+
+	remote remoteConfig // settings from the update server, see remote.go
 }
 
 // ServerConfig holds update server connection settings
@@ -32,15 +39,29 @@ type InstanceConfig struct {
 	LicenseKey string `yaml:"license_key"`
 }
 
-// HeartbeatConfig holds heartbeat settings
+// HeartbeatConfig holds heartbeat settings. The server may ask for a
+// different interval in its heartbeat responses, which takes precedence.
 type HeartbeatConfig struct {
-	Interval time.Duration `yaml:"interval"`
-	Timeout  time.Duration `yaml:"timeout"`
+	Interval   time.Duration `yaml:"interval"`
+	Timeout    time.Duration `yaml:"timeout"`
+	Splay      time.Duration `yaml:"splay"`       // random delay before the first heartbeat
+	Jitter     float64       `yaml:"jitter"`      // fraction each interval is randomly varied by
+	MaxBackoff time.Duration `yaml:"max_backoff"` // longest wait between heartbeats after failures
+}
+
+// SpoolConfig holds settings for the heartbeats and alerts kept on disk while
+// the update server is unreachable
+type SpoolConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	Dir        string `yaml:"dir,omitempty"` // defaults to <base dir>/updater/spool
+	MaxEntries int    `yaml:"max_entries"`   // oldest heartbeats are dropped beyond this
+	BatchSize  int    `yaml:"batch_size"`    // entries sent per request when replaying, at most 1000
 }
 
-// UpdateConfig holds update settings
+// UpdateConfig holds update settings. The update server may override the
+// channel, auto_update and maintenance_window in its heartbeat responses.
 type UpdateConfig struct {
-	CheckInterval     time.Duration      `yaml:"check_interval"`
+	CheckInterval     time.Duration      `yaml:"check_interval"` // unused: updates arrive with heartbeats
 	Channel           string             `yaml:"channel"`
 	AutoUpdate        bool               `yaml:"auto_update"`
 	MaintenanceWindow *MaintenanceWindow `yaml:"maintenance_window,omitempty"`
@@ -60,10 +81,49 @@ type ProductConfig struct {
 	Binary         string `yaml:"binary"`         // path to binary
 	Config         string `yaml:"config"`         // path to config file
 	Type           string `yaml:"type"`           // binary, data
+	Channel        string `yaml:"channel,omitempty"` // overrides update.channel for this product
 	HealthEndpoint string `yaml:"health_endpoint"` // HTTP health check URL
 	HotReload      bool   `yaml:"hot_reload"`     // can reload without restart
 }
 
+// CommandsConfig holds settings for the commands operators send through the
+// update server. Commands are refused unless they are signed with the key
+// matching PublicKey and their type is allowed.
+type CommandsConfig struct {
+	PublicKey string   `yaml:"public_key,omitempty"` // PEM Ed25519 public key of the update server
+	Allow     []string `yaml:"allow"`                // command types the updater runs
+}
+
+// Key parses PublicKey. It returns nil when no key is configured.
+func (c CommandsConfig) Key() (ed25519.PublicKey, error) {
+	if c.PublicKey == "" {
+		return nil, nil
+	}
+	block, _ := pem.Decode([]byte(c.PublicKey))
+	if block == nil {
+		return nil, fmt.Errorf("commands.public_key is not a PEM public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid commands.public_key: %w", err)
+	}
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("commands.public_key is not an Ed25519 key")
+	}
+	return public, nil
+}
+
+// Allows reports whether commands of a type may run
+func (c CommandsConfig) Allows(commandType string) bool {
+	for _, allowed := range c.Allow {
+		if allowed == commandType {
+			return true
+		}
+	}
+	return false
+}
+
 // SecurityConfig holds security hardening settings
 type SecurityConfig struct {
 	Enabled       bool                   `yaml:"enabled"`
@@ -184,8 +244,16 @@ func DefaultConfig() *Config {
 			URL: "https://updates.mysoc.ai",
 		},
 		Heartbeat: HeartbeatConfig{
-			Interval: 60 * time.Second,
-			Timeout:  10 * time.Second,
+			Interval:   60 * time.Second,
+			Timeout:    10 * time.Second,
+			Splay:      30 * time.Second,
+			Jitter:     0.1,
+			MaxBackoff: 10 * time.Minute,
+		},
+		Spool: SpoolConfig{
+			Enabled:    true,
+			MaxEntries: 10000,
+			BatchSize:  100,
 		},
 		Update: UpdateConfig{
 			CheckInterval: 5 * time.Minute,
@@ -233,6 +301,10 @@ func DefaultConfig() *Config {
 				Schedule: "daily",
 			},
 		},
+		Commands: CommandsConfig{
+			// rollback replaces binaries, so instances opt in to it
+			Allow: []string{"check_update", "restart_service", "security_scan", "collect_diagnostics"},
+		},
 		Logging: LoggingConfig{
 			Level:      "info",
 			File:       "/var/log/mysoc-updater/updater.log",
@@ -271,6 +343,26 @@ func (c *Config) Save(path string) error {
 	return nil
 }
 
+// ChannelFor returns the update channel for a product, falling back to update.channel.
+// Channels set by the update server take precedence over the config file.
+func (c *Config) ChannelFor(productName string) string {
+	c.remote.mu.RLock()
+	defer c.remote.mu.RUnlock()
+	if channel := c.remote.settings.ProductChannels[productName]; channel != "" {
+		return channel
+	}
+
+	for _, p := range c.Products {
+		if p.Name == productName && p.Channel != "" {
+			return p.Channel
+		}
+	}
+	if c.remote.settings.Channel != "" {
+		return c.remote.settings.Channel
+	}
+	return c.Update.Channel
+}
+
 // ConfigPath returns the default config path based on instance type
 func ConfigPath(instanceType string) string {
 	switch instanceType {
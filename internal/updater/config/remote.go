@@ -0,0 +1,102 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// remoteConfig holds the settings the update server manages for this
+// updater. They arrive in heartbeat responses while other goroutines read
+// the config, so they are guarded by a lock.
+type remoteConfig struct {
+	mu       sync.RWMutex
+	settings types.UpdaterConfig
+}
+
+// remoteConfigPath is where the settings from the update server are kept
+// across restarts
+func (c *Config) remoteConfigPath() string {
+	return filepath.Join(BaseDir(c.Instance.Type), "updater", "remote-config.json")
+}
+
+// LoadRemote restores the settings last received from the update server
+func (c *Config) LoadRemote() error {
+	data, err := os.ReadFile(c.remoteConfigPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read remote config: %w", err)
+	}
+
+	var settings types.UpdaterConfig
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("failed to parse remote config: %w", err)
+	}
+
+	c.remote.mu.Lock()
+	defer c.remote.mu.Unlock()
+	c.remote.settings = settings
+	return nil
+}
+
+// ApplyRemote applies and keeps settings received from the update server.
+// Empty settings clear them, leaving the config file in charge.
+func (c *Config) ApplyRemote(settings types.UpdaterConfig) error {
+	c.remote.mu.Lock()
+	defer c.remote.mu.Unlock()
+
+	path := c.remoteConfigPath()
+	if settings.Hash() == "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove remote config: %w", err)
+		}
+	} else {
+		data, err := json.Marshal(settings)
+		if err != nil {
+			return fmt.Errorf("failed to marshal remote config: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create config directory: %w", err)
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return fmt.Errorf("failed to write remote config: %w", err)
+		}
+	}
+
+	c.remote.settings = settings
+	return nil
+}
+
+// RemoteHash identifies the settings in use from the update server
+func (c *Config) RemoteHash() string {
+	c.remote.mu.RLock()
+	defer c.remote.mu.RUnlock()
+	return c.remote.settings.Hash()
+}
+
+// AutoUpdateEnabled reports whether updates are applied as they are offered
+func (c *Config) AutoUpdateEnabled() bool {
+	c.remote.mu.RLock()
+	defer c.remote.mu.RUnlock()
+	if c.remote.settings.AutoUpdate != nil {
+		return *c.remote.settings.AutoUpdate
+	}
+	return c.Update.AutoUpdate
+}
+
+// UpdateWindow returns the maintenance window updates are applied in, or nil
+// if they can be applied at any time
+func (c *Config) UpdateWindow() *MaintenanceWindow {
+	c.remote.mu.RLock()
+	defer c.remote.mu.RUnlock()
+	if window := c.remote.settings.MaintenanceWindow; window != nil {
+		return &MaintenanceWindow{Start: window.Start, End: window.End, Timezone: window.Timezone}
+	}
+	return c.Update.MaintenanceWindow
+}
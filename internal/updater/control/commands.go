@@ -0,0 +1,86 @@
+package control
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/updater/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/updater/security"
+)
+
+const (
+	// maxOutputSize limits the output reported for a command, as the server
+	// keeps no more
+	maxOutputSize = 64 << 10
+	// defaultDiagnosticLines is how many log lines per service
+	// collect_diagnostics includes unless asked for more
+	defaultDiagnosticLines = 200
+)
+
+// securityScan runs a security scan and summarizes its checks
+func (d *Dispatcher) securityScan() string {
+	results := security.NewScanner(d.config).Scan()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Score: %d%% (%d/%d checks passed)\n", results.Score, results.PassedCount, results.TotalCount)
+	for _, check := range results.Checks {
+		status := "FAIL"
+		if check.Passed {
+			status = "PASS"
+		}
+		fmt.Fprintf(&b, "%s %s: %s\n", status, check.Name, check.Details)
+	}
+	return b.String()
+}
+
+// collectDiagnostics gathers the system, product versions, service status
+// and recent logs of each product
+func (d *Dispatcher) collectDiagnostics(lines string) string {
+	n, err := strconv.Atoi(lines)
+	if err != nil || n <= 0 {
+		n = defaultDiagnosticLines
+	}
+
+	var b strings.Builder
+	hostname, _ := os.Hostname()
+	fmt.Fprintf(&b, "Host: %s (%s/%s)\n", hostname, runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "Instance: %s (%s)\n", d.config.Instance.ID, d.config.Instance.Type)
+	fmt.Fprintf(&b, "Time: %s\n", time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "Uptime: %s\n", commandOutput("uptime"))
+
+	for _, product := range d.config.Products {
+		fmt.Fprintf(&b, "\n== %s %s ==\n", product.Name, productVersion(d.config, product.Name))
+		if product.Service == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "%s\n", commandOutput("systemctl", "status", product.Service, "--no-pager", "--lines=0"))
+		fmt.Fprintf(&b, "%s\n", commandOutput("journalctl", "-u", product.Service, "-n", strconv.Itoa(n), "--no-pager"))
+	}
+	return b.String()
+}
+
+// commandOutput runs a command for diagnostics, including why it failed
+func commandOutput(name string, args ...string) string {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	text := strings.TrimSpace(string(output))
+	if err != nil {
+		return fmt.Sprintf("%s (%s: %v)", text, name, err)
+	}
+	return text
+}
+
+// productVersion returns the installed version of a product
+func productVersion(cfg *config.Config, productName string) string {
+	versionFile := filepath.Join(config.BaseDir(cfg.Instance.Type), "updater", "versions", productName+".version")
+	data, err := os.ReadFile(versionFile)
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,161 @@
+// Package control acts on what the update server asks of the updater in its
+// heartbeat responses: updates, desired versions, settings and commands.
+package control
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/updater/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/updater/service"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/updater/update"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// Dispatcher hands heartbeat responses to the config, update and service
+// subsystems
+type Dispatcher struct {
+	config    *config.Config
+	checker   *update.Checker
+	monitor   *service.Monitor
+	publicKey ed25519.PublicKey // nil refuses all commands
+	report    func(types.CommandResult)
+
+	// seen holds the commands already run until they expire, so a command
+	// delivered twice runs once. Only verified commands are kept, as forged
+	// ones could claim to expire in any year. Only Dispatch uses it.
+	seen map[string]time.Time
+}
+
+// NewDispatcher creates a dispatcher for the given subsystems. Commands are
+// refused when commands.public_key is missing or invalid.
+func NewDispatcher(cfg *config.Config, checker *update.Checker, monitor *service.Monitor) *Dispatcher {
+	publicKey, err := cfg.Commands.Key()
+	if err != nil {
+		fmt.Printf("Commands disabled: %v\n", err)
+	}
+	return &Dispatcher{
+		config:    cfg,
+		checker:   checker,
+		monitor:   monitor,
+		publicKey: publicKey,
+		seen:      make(map[string]time.Time),
+	}
+}
+
+// EnableResults reports the results of commands through report. Call it
+// before the first Dispatch.
+func (d *Dispatcher) EnableResults(report func(types.CommandResult)) {
+	d.report = report
+}
+
+// Dispatch acts on a heartbeat response. It does not block on the work it
+// starts, so heartbeats keep their pace.
+func (d *Dispatcher) Dispatch(resp *types.HeartbeatResponse) {
+	// Settings first, as they decide whether the updates are applied
+	if resp.Config != nil {
+		if err := d.config.ApplyRemote(*resp.Config); err != nil {
+			fmt.Printf("Failed to apply settings from the update server: %v\n", err)
+		} else {
+			fmt.Println("Applied settings from the update server")
+		}
+	}
+
+	d.checker.Offer(resp.Updates, resp.DesiredVersions)
+
+	now := time.Now()
+	for id, expires := range d.seen {
+		if now.After(expires) {
+			delete(d.seen, id)
+		}
+	}
+	for _, command := range resp.Commands {
+		if _, ok := d.seen[command.ID]; ok {
+			continue
+		}
+		if err := d.verify(command); err != nil {
+			fmt.Printf("Refusing command %s (%s): %v\n", command.Type, command.ID, err)
+			d.finish(command, types.CommandResult{Status: types.CommandRejected, Error: err.Error()})
+			continue
+		}
+		d.seen[command.ID] = command.ExpiresAt
+
+		fmt.Printf("Running command %s (%s)\n", command.Type, command.ID)
+		go d.execute(command)
+	}
+}
+
+// verify checks that a command was signed by the update server for this
+// instance, has not expired and is allowed here
+func (d *Dispatcher) verify(command types.Command) error {
+	if d.publicKey == nil {
+		return errors.New("no commands.public_key is configured")
+	}
+	signature, err := base64.StdEncoding.DecodeString(command.Signature)
+	if err != nil || !ed25519.Verify(d.publicKey, command.SigningPayload(), signature) {
+		return errors.New("invalid signature")
+	}
+	if command.InstanceID != d.config.Instance.ID {
+		return fmt.Errorf("command is for instance %s", command.InstanceID)
+	}
+	if !time.Now().Before(command.ExpiresAt) {
+		return errors.New("command has expired")
+	}
+	if !d.config.Commands.Allows(command.Type) {
+		return fmt.Errorf("%s is not in commands.allow", command.Type)
+	}
+	return nil
+}
+
+// execute runs a command and reports its result
+func (d *Dispatcher) execute(command types.Command) {
+	output, err := d.run(command)
+	result := types.CommandResult{Status: types.CommandSucceeded, Output: output}
+	if err != nil {
+		fmt.Printf("Command %s (%s) failed: %v\n", command.Type, command.ID, err)
+		result.Status = types.CommandFailed
+		result.Error = err.Error()
+	} else {
+		fmt.Printf("Command %s (%s) succeeded\n", command.Type, command.ID)
+	}
+	d.finish(command, result)
+}
+
+// run runs a command, waiting for the subsystem it is handed to
+func (d *Dispatcher) run(command types.Command) (string, error) {
+	switch command.Type {
+	case types.CommandCheckUpdate:
+		result := <-d.checker.CheckNow()
+		return result.Output, result.Err
+	case types.CommandRollback:
+		result := <-d.checker.Rollback(command.Product, command.Args["version"])
+		return result.Output, result.Err
+	case types.CommandRestartService:
+		if err := <-d.monitor.Restart(command.Product); err != nil {
+			return "", err
+		}
+		return "Restarted " + command.Product, nil
+	case types.CommandSecurityScan:
+		return d.securityScan(), nil
+	case types.CommandCollectDiagnostics:
+		return d.collectDiagnostics(command.Args["lines"]), nil
+	default:
+		return "", fmt.Errorf("unknown command type %s", command.Type)
+	}
+}
+
+// finish reports the result of a command
+func (d *Dispatcher) finish(command types.Command, result types.CommandResult) {
+	if d.report == nil {
+		return
+	}
+	result.CommandID = command.ID
+	result.Time = time.Now()
+	if len(result.Output) > maxOutputSize {
+		result.Output = result.Output[:maxOutputSize]
+	}
+	d.report(result)
+}
@@ -0,0 +1,134 @@
+package control
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/updater/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/updater/update"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// newTestDispatcher returns a dispatcher for instance inst-1 that trusts the
+// returned key and records the results it reports
+func newTestDispatcher(t *testing.T) (*Dispatcher, ed25519.PrivateKey, func() []types.CommandResult) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	cfg := &config.Config{
+		Instance: config.InstanceConfig{ID: "inst-1"},
+		Commands: config.CommandsConfig{Allow: []string{types.CommandCheckUpdate}},
+	}
+	d := &Dispatcher{
+		config:    cfg,
+		checker:   update.NewChecker(cfg),
+		publicKey: public,
+		seen:      make(map[string]time.Time),
+	}
+
+	var mu sync.Mutex
+	var results []types.CommandResult
+	d.EnableResults(func(result types.CommandResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		results = append(results, result)
+	})
+	return d, private, func() []types.CommandResult {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]types.CommandResult(nil), results...)
+	}
+}
+
+// signed returns a check_update command for inst-1 signed with key
+func signed(key ed25519.PrivateKey, id string, change func(*types.Command)) types.Command {
+	command := types.Command{
+		ID:         id,
+		InstanceID: "inst-1",
+		Type:       types.CommandCheckUpdate,
+		ExpiresAt:  time.Now().Add(time.Hour),
+	}
+	if change != nil {
+		change(&command)
+	}
+	command.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, command.SigningPayload()))
+	return command
+}
+
+func TestVerify(t *testing.T) {
+	d, key, _ := newTestDispatcher(t)
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	tampered := signed(key, "cmd-1", nil)
+	tampered.Type = types.CommandRollback
+
+	tests := []struct {
+		name    string
+		command types.Command
+		wantErr string
+	}{
+		{"valid", signed(key, "cmd-1", nil), ""},
+		{"unsigned", types.Command{ID: "cmd-1", InstanceID: "inst-1", Type: types.CommandCheckUpdate, ExpiresAt: time.Now().Add(time.Hour)}, "invalid signature"},
+		{"signed by another key", signed(otherKey, "cmd-1", nil), "invalid signature"},
+		{"changed after signing", tampered, "invalid signature"},
+		{"other instance", signed(key, "cmd-1", func(c *types.Command) { c.InstanceID = "inst-2" }), "for instance inst-2"},
+		{"expired", signed(key, "cmd-1", func(c *types.Command) { c.ExpiresAt = time.Now().Add(-time.Second) }), "expired"},
+		{"not allowed", signed(key, "cmd-1", func(c *types.Command) { c.Type = types.CommandRollback }), "not in commands.allow"},
+	}
+	for _, tt := range tests {
+		err := d.verify(tt.command)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("verify(%s) = %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("verify(%s) = %v, want an error containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+
+	// Without a key every command is refused
+	d.publicKey = nil
+	if err := d.verify(signed(key, "cmd-1", nil)); err == nil {
+		t.Error("verify without a public key succeeded")
+	}
+}
+
+func TestDispatchCommands(t *testing.T) {
+	d, key, results := newTestDispatcher(t)
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	forged := signed(otherKey, "forged", func(c *types.Command) { c.ExpiresAt = time.Now().AddDate(100, 0, 0) })
+	valid := signed(key, "valid", nil)
+	d.Dispatch(&types.HeartbeatResponse{Commands: []types.Command{forged, valid}})
+
+	got := results()
+	if len(got) != 1 || got[0].CommandID != "forged" || got[0].Status != types.CommandRejected {
+		t.Fatalf("results = %+v, want only the forged command rejected", got)
+	}
+	// Forged commands are not remembered, however far off they claim to expire
+	if _, ok := d.seen["forged"]; ok {
+		t.Error("the forged command was remembered")
+	}
+	if _, ok := d.seen["valid"]; !ok {
+		t.Error("the valid command was not remembered")
+	}
+
+	// A command delivered again is not run again
+	d.Dispatch(&types.HeartbeatResponse{Commands: []types.Command{valid}})
+	if got := results(); len(got) != 1 {
+		t.Errorf("results after redelivery = %+v, want no more", got)
+	}
+
+	// Expired commands are forgotten
+	d.seen["valid"] = time.Now().Add(-time.Second)
+	d.Dispatch(&types.HeartbeatResponse{})
+	if len(d.seen) != 0 {
+		t.Errorf("seen = %v after expiry, want empty", d.seen)
+	}
+}
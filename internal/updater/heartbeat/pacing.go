@@ -0,0 +1,97 @@
+package heartbeat
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// statusError is a heartbeat the server did not accept
+type statusError struct {
+	status     int
+	retryAfter time.Duration // 0 when the server did not send Retry-After
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("heartbeat returned status %d", e.status)
+}
+
+// nextDelay returns the wait after an accepted heartbeat: the interval the
+// server asked for, or the configured one, with jitter
+func (r *Reporter) nextDelay(resp *types.HeartbeatResponse) time.Duration {
+	interval := r.config.Heartbeat.Interval
+	if resp.NextHeartbeatIn > 0 {
+		interval = time.Duration(resp.NextHeartbeatIn) * time.Second
+	}
+	return r.capDelay(r.jitter(interval))
+}
+
+// retryDelay returns the wait after the given number of consecutive failures.
+// A Retry-After from the server is honoured; otherwise the interval doubles
+// with each failure, up to MaxBackoff.
+func (r *Reporter) retryDelay(err error, failures int) time.Duration {
+	var se *statusError
+	if errors.As(err, &se) && se.retryAfter > 0 {
+		// Spread the retries of updaters turned away together
+		return r.capDelay(se.retryAfter + randomDuration(time.Duration(float64(se.retryAfter)*r.jitterFraction())))
+	}
+
+	backoff := r.config.Heartbeat.Interval
+	for i := 1; i < failures && backoff < r.maxBackoff(); i++ {
+		backoff *= 2
+	}
+	backoff = r.capDelay(backoff)
+
+	// Wait between half and all of the backoff, so failed updaters drift apart
+	return backoff/2 + randomDuration(backoff/2)
+}
+
+// jitter varies d randomly by up to Heartbeat.Jitter in either direction
+func (r *Reporter) jitter(d time.Duration) time.Duration {
+	spread := time.Duration(float64(d) * r.jitterFraction())
+	return d - spread + randomDuration(2*spread)
+}
+
+func (r *Reporter) jitterFraction() float64 {
+	return min(max(r.config.Heartbeat.Jitter, 0), 1)
+}
+
+// capDelay limits d to MaxBackoff, so a misbehaving server cannot silence the
+// updater for long
+func (r *Reporter) capDelay(d time.Duration) time.Duration {
+	return min(d, r.maxBackoff())
+}
+
+func (r *Reporter) maxBackoff() time.Duration {
+	return max(r.config.Heartbeat.MaxBackoff, r.config.Heartbeat.Interval)
+}
+
+// randomDuration returns a random duration in [0, d)
+func randomDuration(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP
+// date. It returns 0 when the header is missing or invalid.
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
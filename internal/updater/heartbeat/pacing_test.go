@@ -0,0 +1,76 @@
+package heartbeat
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/updater/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+func newPacingReporter() *Reporter {
+	cfg := config.DefaultConfig()
+	cfg.Heartbeat.Interval = time.Minute
+	cfg.Heartbeat.Jitter = 0.1
+	cfg.Heartbeat.MaxBackoff = 10 * time.Minute
+	return &Reporter{config: cfg}
+}
+
+func TestNextDelay(t *testing.T) {
+	r := newPacingReporter()
+	tests := []struct {
+		name     string
+		resp     types.HeartbeatResponse
+		min, max time.Duration
+	}{
+		{"configured interval", types.HeartbeatResponse{}, 54 * time.Second, 66 * time.Second},
+		{"server interval", types.HeartbeatResponse{NextHeartbeatIn: 240}, 216 * time.Second, 264 * time.Second},
+		{"capped", types.HeartbeatResponse{NextHeartbeatIn: 86400}, 10 * time.Minute, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			if d := r.nextDelay(&tt.resp); d < tt.min || d > tt.max {
+				t.Fatalf("nextDelay(%s) = %s, want %s to %s", tt.name, d, tt.min, tt.max)
+			}
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	r := newPacingReporter()
+	tests := []struct {
+		name     string
+		err      error
+		failures int
+		min, max time.Duration
+	}{
+		{"first failure", &statusError{status: http.StatusBadGateway}, 1, 30 * time.Second, time.Minute},
+		{"third failure", &statusError{status: http.StatusBadGateway}, 3, 2 * time.Minute, 4 * time.Minute},
+		{"backoff capped", &statusError{status: http.StatusBadGateway}, 20, 5 * time.Minute, 10 * time.Minute},
+		{"Retry-After", &statusError{status: http.StatusTooManyRequests, retryAfter: 2 * time.Minute}, 1, 2 * time.Minute, 132 * time.Second},
+		{"Retry-After capped", &statusError{status: http.StatusTooManyRequests, retryAfter: 24 * time.Hour}, 1, 10 * time.Minute, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			if d := r.retryDelay(tt.err, tt.failures); d < tt.min || d > tt.max {
+				t.Fatalf("retryDelay(%s) = %s, want %s to %s", tt.name, d, tt.min, tt.max)
+			}
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d := parseRetryAfter("120"); d != 2*time.Minute {
+		t.Errorf("parseRetryAfter(120) = %s, want 2m", d)
+	}
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if d := parseRetryAfter(date); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("parseRetryAfter(%s) = %s, want about 1h", date, d)
+	}
+	for _, value := range []string{"", "-5", "soon", "Mon, 01 Jan 2001 00:00:00 GMT"} {
+		if d := parseRetryAfter(value); d != 0 {
+			t.Errorf("parseRetryAfter(%q) = %s, want 0", value, d)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package heartbeat
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/updater/spool"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// maxBatchEntries is the most heartbeats, alerts and results the update
+// server takes in one batch
+const maxBatchEntries = 1000
+
+// ReportAlert sends an alert to the update server, spooling it until the
+// server is reachable. It does not wait for the alert to be delivered.
+func (r *Reporter) ReportAlert(alert types.InstanceAlert) {
+	alert.InstanceID = r.config.Instance.ID
+	if alert.Time.IsZero() {
+		alert.Time = time.Now()
+	}
+
+	if r.spool == nil {
+		// Nowhere to keep it, so try once
+		ctx, cancel := context.WithTimeout(context.Background(), r.config.Heartbeat.Timeout)
+		defer cancel()
+		if err := r.sendBatch(ctx, &types.HeartbeatBatch{Alerts: []types.InstanceAlert{alert}}); err != nil {
+			fmt.Printf("Failed to send alert %s: %v\n", alert.Type, err)
+		}
+		return
+	}
+
+	if err := r.spool.AddAlert(&alert); err != nil {
+		fmt.Printf("Failed to spool alert %s: %v\n", alert.Type, err)
+		return
+	}
+	r.wakeUp()
+}
+
+// ReportResult sends the result of a command to the update server, spooling
+// it until the server is reachable. It does not wait for the result to be
+// delivered.
+func (r *Reporter) ReportResult(result types.CommandResult) {
+	result.InstanceID = r.config.Instance.ID
+	if result.Time.IsZero() {
+		result.Time = time.Now()
+	}
+
+	if r.spool == nil {
+		// Nowhere to keep it, so try once
+		ctx, cancel := context.WithTimeout(context.Background(), r.config.Heartbeat.Timeout)
+		defer cancel()
+		if err := r.sendBatch(ctx, &types.HeartbeatBatch{Results: []types.CommandResult{result}}); err != nil {
+			fmt.Printf("Failed to send result of command %s: %v\n", result.CommandID, err)
+		}
+		return
+	}
+
+	if err := r.spool.AddResult(&result); err != nil {
+		fmt.Printf("Failed to spool result of command %s: %v\n", result.CommandID, err)
+		return
+	}
+	r.wakeUp()
+}
+
+// wakeUp has the reporter send spooled alerts and results now
+func (r *Reporter) wakeUp() {
+	select {
+	case r.reports <- struct{}{}:
+	default: // the reporter is already due to send
+	}
+}
+
+// spoolHeartbeat keeps a heartbeat that could not be delivered
+func (r *Reporter) spoolHeartbeat(heartbeat *types.Heartbeat) {
+	if r.spool == nil {
+		return
+	}
+	if err := r.spool.AddHeartbeat(heartbeat); err != nil {
+		fmt.Printf("Failed to spool heartbeat: %v\n", err)
+	}
+}
+
+// replay sends spooled heartbeats, alerts and results in batches, oldest first, until
+// the spool is empty or the server cannot take more
+func (r *Reporter) replay(ctx context.Context) error {
+	if r.spool == nil {
+		return nil
+	}
+
+	size := r.batchSize()
+	for {
+		entries, err := r.spool.Peek(size)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+
+		var batch types.HeartbeatBatch
+		for _, entry := range entries {
+			switch entry.Kind {
+			case spool.KindHeartbeat:
+				batch.Heartbeats = append(batch.Heartbeats, *entry.Heartbeat)
+			case spool.KindAlert:
+				batch.Alerts = append(batch.Alerts, *entry.Alert)
+			case spool.KindResult:
+				batch.Results = append(batch.Results, *entry.Result)
+			}
+		}
+
+		err = r.sendBatch(ctx, &batch)
+		if err != nil && retryable(err) {
+			return err
+		}
+		var se *statusError
+		if errors.As(err, &se) && se.status == http.StatusRequestEntityTooLarge && len(entries) > 1 {
+			// The server takes smaller batches than configured
+			size = len(entries) / 2
+			continue
+		}
+		if err != nil {
+			// The server will never accept these, so they must not block the rest
+			fmt.Printf("Dropping %d spooled heartbeats, %d alerts and %d results: %v\n",
+				len(batch.Heartbeats), len(batch.Alerts), len(batch.Results), err)
+		} else {
+			fmt.Printf("Replayed %d spooled heartbeats, %d alerts and %d results\n",
+				len(batch.Heartbeats), len(batch.Alerts), len(batch.Results))
+		}
+
+		if err := r.spool.Remove(entries); err != nil {
+			return err
+		}
+	}
+}
+
+// batchSize returns how many entries replay sends at once: Spool.BatchSize,
+// within what the server takes
+func (r *Reporter) batchSize() int {
+	return min(max(r.config.Spool.BatchSize, 1), maxBatchEntries)
+}
+
+// sendBatch sends heartbeats, alerts and results to the batch endpoint, compressed
+func (r *Reporter) sendBatch(ctx context.Context, batch *types.HeartbeatBatch) error {
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	if err := json.NewEncoder(gz).Encode(batch); err != nil {
+		return fmt.Errorf("failed to encode heartbeat batch: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to compress heartbeat batch: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", r.config.Server.URL+"/api/v1/heartbeat/batch", &body)
+	if err != nil {
+		return fmt.Errorf("failed to create heartbeat batch request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("X-API-Key", r.config.Server.APIKey)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send heartbeat batch: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{
+			status:     resp.StatusCode,
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+	return nil
+}
+
+// retryable reports whether a failed delivery may succeed later: the server
+// was unreachable, failed or asked to be retried, or refused the instance's
+// API key, which is fixed by configuring the rotated key, rather than refusing
+// the request itself
+func retryable(err error) bool {
+	var se *statusError
+	if !errors.As(err, &se) {
+		return true
+	}
+	switch se.status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return se.status >= 500
+}
@@ -0,0 +1,138 @@
+package heartbeat
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/updater/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// batchServer answers heartbeat batches with status, and with 413 to batches
+// of more than limit entries when limit is set
+type batchServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	status   int
+	limit    int
+	received []int // entries per accepted batch
+}
+
+func newBatchServer(t *testing.T) *batchServer {
+	t.Helper()
+	s := &batchServer{status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var batch types.HeartbeatBatch
+		if err := json.NewDecoder(gz).Decode(&batch); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entries := len(batch.Heartbeats) + len(batch.Alerts) + len(batch.Results)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch {
+		case s.limit > 0 && entries > s.limit:
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		case s.status != http.StatusOK:
+			w.WriteHeader(s.status)
+		default:
+			s.received = append(s.received, entries)
+			json.NewEncoder(w).Encode(types.HeartbeatBatchResponse{Heartbeats: len(batch.Heartbeats)})
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// newSpoolingReporter returns a reporter for server that spools n heartbeats
+func newSpoolingReporter(t *testing.T, server *batchServer, batchSize, n int) *Reporter {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.Server.URL = server.URL
+	cfg.Spool.Dir = t.TempDir()
+	cfg.Spool.BatchSize = batchSize
+	r := NewReporter(cfg)
+	if r.spool == nil {
+		t.Fatal("spool not opened")
+	}
+	for i := 0; i < n; i++ {
+		r.spoolHeartbeat(&types.Heartbeat{InstanceID: fmt.Sprintf("inst-%d", i)})
+	}
+	return r
+}
+
+func TestReplayStatus(t *testing.T) {
+	tests := []struct {
+		status   int
+		wantErr  bool
+		wantKept bool
+	}{
+		{http.StatusOK, false, false},
+		// The server is down or busy: try again later
+		{http.StatusInternalServerError, true, true},
+		{http.StatusServiceUnavailable, true, true},
+		{http.StatusTooManyRequests, true, true},
+		{http.StatusRequestTimeout, true, true},
+		// A rotated API key is fixed by configuring the new one
+		{http.StatusUnauthorized, true, true},
+		{http.StatusForbidden, true, true},
+		// The server will never take these
+		{http.StatusBadRequest, false, false},
+		{http.StatusUnprocessableEntity, false, false},
+	}
+	for _, tt := range tests {
+		server := newBatchServer(t)
+		server.status = tt.status
+		r := newSpoolingReporter(t, server, 2, 3)
+
+		err := r.replay(context.Background())
+		if (err != nil) != tt.wantErr {
+			t.Errorf("replay answered %d = %v, want error %v", tt.status, err, tt.wantErr)
+		}
+		if kept := r.spool.Len() == 3; kept != tt.wantKept {
+			t.Errorf("replay answered %d left %d entries spooled, want kept %v", tt.status, r.spool.Len(), tt.wantKept)
+		}
+	}
+}
+
+func TestReplayBatchSize(t *testing.T) {
+	server := newBatchServer(t)
+	r := newSpoolingReporter(t, server, 2, 5)
+	if err := r.replay(context.Background()); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if got := fmt.Sprint(server.received); got != "[2 2 1]" || r.spool.Len() != 0 {
+		t.Errorf("batches %s with %d left, want [2 2 1] and none", got, r.spool.Len())
+	}
+
+	// Batches are split until the server takes them rather than dropped
+	server = newBatchServer(t)
+	server.limit = 2
+	r = newSpoolingReporter(t, server, 5, 5)
+	if err := r.replay(context.Background()); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if got := fmt.Sprint(server.received); got != "[2 2 1]" || r.spool.Len() != 0 {
+		t.Errorf("batches %s with %d left, want [2 2 1] and none", got, r.spool.Len())
+	}
+
+	for _, tt := range []struct{ configured, want int }{{0, 1}, {100, 100}, {5000, maxBatchEntries}} {
+		r.config.Spool.BatchSize = tt.configured
+		if got := r.batchSize(); got != tt.want {
+			t.Errorf("batchSize with batch_size %d = %d, want %d", tt.configured, got, tt.want)
+		}
+	}
+}
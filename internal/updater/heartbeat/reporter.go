@@ -14,57 +14,112 @@ import (
 	"time"
 
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/updater/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/updater/spool"
 	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
 )
 
-// Reporter sends heartbeats to the update server
+// Reporter sends heartbeats, alerts and command results to the update server.
+// Those that cannot be delivered are spooled on disk and replayed once it is
+// reachable.
 type Reporter struct {
-	config *config.Config
-	client *http.Client
+	config  *config.Config
+	client  *http.Client
+	spool   *spool.Spool  // nil when spooling is disabled or unavailable
+	reports chan struct{} // signalled when alerts or results are spooled
+	// control is handed every heartbeat response, see EnableControl
+	control func(*types.HeartbeatResponse)
 }
 
 // NewReporter creates a new heartbeat reporter
 func NewReporter(cfg *config.Config) *Reporter {
-	return &Reporter{
+	r := &Reporter{
 		config: cfg,
 		client: &http.Client{
 			Timeout: cfg.Heartbeat.Timeout,
 		},
+		reports: make(chan struct{}, 1),
 	}
+
+	if cfg.Spool.Enabled {
+		dir := cfg.Spool.Dir
+		if dir == "" {
+			dir = filepath.Join(config.BaseDir(cfg.Instance.Type), "updater", "spool")
+		}
+		s, err := spool.Open(dir, cfg.Spool.MaxEntries)
+		if err != nil {
+			fmt.Printf("Heartbeat spool disabled: %v\n", err)
+		} else {
+			r.spool = s
+		}
+	}
+
+	return r
 }
 
-// Start begins the heartbeat reporting loop
-func (r *Reporter) Start(ctx context.Context) {
-	ticker := time.NewTicker(r.config.Heartbeat.Interval)
-	defer ticker.Stop()
+// EnableControl hands every heartbeat response to control, which acts on the
+// updates, settings and commands in it. Call it before Start.
+func (r *Reporter) EnableControl(control func(*types.HeartbeatResponse)) {
+	r.control = control
+}
 
-	// Send initial heartbeat
-	r.sendHeartbeat()
+// Start begins the heartbeat reporting loop. The first heartbeat is delayed
+// by up to Heartbeat.Splay so updaters started together do not report at once.
+func (r *Reporter) Start(ctx context.Context) {
+	timer := time.NewTimer(randomDuration(r.config.Heartbeat.Splay))
+	defer timer.Stop()
+	failures := 0
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			r.sendHeartbeat()
+		case <-r.reports:
+			if err := r.replay(ctx); err != nil && ctx.Err() == nil {
+				fmt.Printf("Failed to send alerts and results: %v (will retry)\n", err)
+			}
+			continue
+		case <-timer.C:
+		}
+
+		heartbeat := r.collectHeartbeat()
+		resp, err := r.sendHeartbeat(ctx, &heartbeat)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if retryable(err) {
+				r.spoolHeartbeat(&heartbeat)
+			}
+			failures++
+			delay := r.retryDelay(err, failures)
+			fmt.Printf("Heartbeat failed: %v (retrying in %s)\n", err, delay.Round(time.Second))
+			timer.Reset(delay)
+			continue
+		}
+
+		failures = 0
+		timer.Reset(r.nextDelay(resp))
+		if r.control != nil {
+			r.control(resp)
+		}
+
+		// The server is reachable again: send what it missed
+		if err := r.replay(ctx); err != nil && ctx.Err() == nil {
+			fmt.Printf("Failed to replay spooled heartbeats: %v (will retry)\n", err)
 		}
 	}
 }
 
 // sendHeartbeat sends a single heartbeat to the server
-func (r *Reporter) sendHeartbeat() {
-	heartbeat := r.collectHeartbeat()
-
+func (r *Reporter) sendHeartbeat(ctx context.Context, heartbeat *types.Heartbeat) (*types.HeartbeatResponse, error) {
 	body, err := json.Marshal(heartbeat)
 	if err != nil {
-		fmt.Printf("Failed to marshal heartbeat: %v\n", err)
-		return
+		return nil, fmt.Errorf("failed to marshal heartbeat: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", r.config.Server.URL+"/api/v1/heartbeat", bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, "POST", r.config.Server.URL+"/api/v1/heartbeat", bytes.NewReader(body))
 	if err != nil {
-		fmt.Printf("Failed to create heartbeat request: %v\n", err)
-		return
+		return nil, fmt.Errorf("failed to create heartbeat request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -72,14 +127,27 @@ func (r *Reporter) sendHeartbeat() {
 
 	resp, err := r.client.Do(req)
 	if err != nil {
-		fmt.Printf("Failed to send heartbeat: %v\n", err)
-		return
+		return nil, fmt.Errorf("failed to send heartbeat: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("Heartbeat returned status %d\n", resp.StatusCode)
+		return nil, &statusError{
+			status:     resp.StatusCode,
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
 	}
+
+	var hbResp types.HeartbeatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&hbResp); err != nil {
+		return nil, fmt.Errorf("failed to decode heartbeat response: %w", err)
+	}
+
+	for _, warning := range hbResp.Warnings {
+		fmt.Printf("WARNING: %s %s is %s: %s\n", warning.Product, warning.Version, warning.Status, warning.Message)
+	}
+
+	return &hbResp, nil
 }
 
 // collectHeartbeat gathers all heartbeat data
@@ -91,7 +159,7 @@ func (r *Reporter) collectHeartbeat() types.Heartbeat {
 		InstanceType:   r.config.Instance.Type,
 		Hostname:       hostname,
 		UpdaterVersion: "1.0.0", // TODO: Get from version
-		ConfigHash:     r.getConfigHash(),
+		ConfigHash:     r.config.RemoteHash(),
 		License:        r.getLicenseStatus(),
 		Products:       r.getProductStatuses(),
 		System:         r.getSystemMetrics(),
@@ -100,11 +168,6 @@ func (r *Reporter) collectHeartbeat() types.Heartbeat {
 	}
 }
 
-func (r *Reporter) getConfigHash() string {
-	// Simple hash of config for change detection
-	return fmt.Sprintf("%x", time.Now().Unix()/3600) // Changes hourly
-}
-
 func (r *Reporter) getLicenseStatus() types.LicenseStatus {
 	return types.LicenseStatus{
 		Key:       r.config.Instance.LicenseKey,
@@ -120,7 +183,7 @@ func (r *Reporter) getProductStatuses() []types.ProductStatus {
 		status := types.ProductStatus{
 			Name:    product.Name,
 			Version: r.getProductVersion(product.Name),
-			Channel: r.config.Update.Channel,
+			Channel: r.config.ChannelFor(product.Name),
 			Status:  r.getServiceStatus(product.Service),
 		}
 
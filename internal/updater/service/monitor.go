@@ -9,13 +9,26 @@ import (
 	"time"
 
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/updater/config"
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
 )
 
+// maxRestarts is how many times a service is restarted before giving up
+const maxRestarts = 5
+
 // Monitor watches services and restarts them if they crash
 type Monitor struct {
 	config       *config.Config
 	restartCount map[string]int
 	lastRestart  map[string]time.Time
+	gaveUp       map[string]bool
+	alert        func(types.InstanceAlert)
+	restarts     chan restartRequest // services operators asked to restart
+}
+
+// restartRequest asks for the service of a product to be restarted
+type restartRequest struct {
+	product string
+	done    chan<- error
 }
 
 // NewMonitor creates a new service monitor
@@ -24,9 +37,24 @@ func NewMonitor(cfg *config.Config) *Monitor {
 		config:       cfg,
 		restartCount: make(map[string]int),
 		lastRestart:  make(map[string]time.Time),
+		gaveUp:       make(map[string]bool),
+		restarts:     make(chan restartRequest, 16),
 	}
 }
 
+// EnableAlerts reports services that cannot be restarted through alert
+func (m *Monitor) EnableAlerts(alert func(types.InstanceAlert)) {
+	m.alert = alert
+}
+
+// raise reports an alert when alerts are enabled
+func (m *Monitor) raise(alertType, severity, message string) {
+	if m.alert == nil {
+		return
+	}
+	m.alert(types.InstanceAlert{Type: alertType, Severity: severity, Message: message, Time: time.Now()})
+}
+
 // Start begins the service monitoring loop
 func (m *Monitor) Start(ctx context.Context) {
 	ticker := time.NewTicker(30 * time.Second)
@@ -38,8 +66,36 @@ func (m *Monitor) Start(ctx context.Context) {
 			return
 		case <-ticker.C:
 			m.checkAllServices()
+		case req := <-m.restarts:
+			req.done <- m.restartProduct(req.product)
+		}
+	}
+}
+
+// Restart asks the monitor to restart the service of a product. It does not
+// block; the restart happens in the monitoring loop and its outcome is sent
+// on the returned channel.
+func (m *Monitor) Restart(productName string) <-chan error {
+	done := make(chan error, 1)
+	select {
+	case m.restarts <- restartRequest{product: productName, done: done}:
+	default:
+		done <- fmt.Errorf("too many restarts pending, not restarting %s", productName)
+	}
+	return done
+}
+
+// restartProduct restarts the service of a product on request, even if the
+// monitor had given up on it
+func (m *Monitor) restartProduct(productName string) error {
+	for _, product := range m.config.Products {
+		if product.Name == productName && product.Service != "" {
+			m.restartCount[product.Service] = 0
+			m.gaveUp[product.Service] = false
+			return m.restartService(product)
 		}
 	}
+	return fmt.Errorf("cannot restart %s: no such product with a service", productName)
 }
 
 // checkAllServices checks all managed services
@@ -58,6 +114,7 @@ func (m *Monitor) checkAllServices() {
 			}
 			// Reset restart count on healthy service
 			m.restartCount[product.Service] = 0
+			m.gaveUp[product.Service] = false
 
 		case "failed", "inactive":
 			fmt.Printf("Service %s is %s, attempting restart\n", product.Service, status)
@@ -88,27 +145,33 @@ func (m *Monitor) checkHealth(endpoint string) bool {
 	return resp.StatusCode == http.StatusOK
 }
 
-// restartService attempts to restart a service
-func (m *Monitor) restartService(product config.ProductConfig) {
+// restartService attempts to restart a service, returning why it did not
+// come back
+func (m *Monitor) restartService(product config.ProductConfig) error {
 	// Check restart cooldown (don't restart too frequently)
 	if lastRestart, ok := m.lastRestart[product.Service]; ok {
 		if time.Since(lastRestart) < 30*time.Second {
 			fmt.Printf("Skipping restart of %s (cooldown period)\n", product.Service)
-			return
+			return fmt.Errorf("%s was restarted less than 30s ago", product.Service)
 		}
 	}
 
 	// Check restart count (don't restart infinitely)
-	if count, ok := m.restartCount[product.Service]; ok && count >= 5 {
+	if count, ok := m.restartCount[product.Service]; ok && count >= maxRestarts {
 		fmt.Printf("Service %s has restarted too many times, giving up\n", product.Service)
-		return
+		if !m.gaveUp[product.Service] {
+			m.gaveUp[product.Service] = true
+			m.raise("service_restarts_exhausted", "critical",
+				fmt.Sprintf("Service %s is still down after %d restarts", product.Service, count))
+		}
+		return fmt.Errorf("%s has restarted too many times", product.Service)
 	}
 
 	// Attempt restart
 	cmd := exec.Command("systemctl", "restart", product.Service)
 	if err := cmd.Run(); err != nil {
 		fmt.Printf("Failed to restart %s: %v\n", product.Service, err)
-		return
+		return fmt.Errorf("failed to restart %s: %w", product.Service, err)
 	}
 
 	m.restartCount[product.Service]++
@@ -120,7 +183,11 @@ func (m *Monitor) restartService(product config.ProductConfig) {
 	time.Sleep(5 * time.Second)
 	if m.getServiceStatus(product.Service) != "active" {
 		fmt.Printf("Service %s failed to start after restart\n", product.Service)
+		m.raise("service_restart_failed", "high",
+			fmt.Sprintf("Service %s failed to start after restart %d", product.Service, m.restartCount[product.Service]))
+		return fmt.Errorf("%s failed to start after restart", product.Service)
 	}
+	return nil
 }
 
 // GetStatus returns the status of all managed services
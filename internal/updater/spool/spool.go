@@ -0,0 +1,261 @@
+// Package spool keeps the heartbeats, alerts and command results the updater
+// could not deliver on disk, so they can be sent once the update server is
+// reachable again.
+package spool
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// Kinds of spooled entries
+const (
+	KindHeartbeat = "heartbeat"
+	KindAlert     = "alert"
+	KindResult    = "result"
+)
+
+// fileSuffix ends every entry file: entries are stored gzip-compressed
+const fileSuffix = ".json.gz"
+
+// Entry is a spooled heartbeat, alert or command result
+type Entry struct {
+	Kind      string
+	Heartbeat *types.Heartbeat     // set when Kind is KindHeartbeat
+	Alert     *types.InstanceAlert // set when Kind is KindAlert
+	Result    *types.CommandResult // set when Kind is KindResult
+
+	name string
+}
+
+// Spool is a bounded, ordered queue of entries in a directory, one file each.
+// File names start with a sequence number, so they sort oldest first.
+type Spool struct {
+	dir        string
+	maxEntries int
+
+	mu   sync.Mutex
+	next uint64
+}
+
+// Open opens the spool in dir, creating it if needed. The spool holds at most
+// maxEntries entries; beyond that the oldest heartbeats are dropped first, as
+// alerts and command results are rarer and matter more.
+func Open(dir string, maxEntries int) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	s := &Spool{dir: dir, maxEntries: maxEntries}
+	names, err := s.names()
+	if err != nil {
+		return nil, err
+	}
+	if len(names) > 0 {
+		last, _ := parseName(names[len(names)-1])
+		s.next = last + 1
+	}
+	return s, nil
+}
+
+// AddHeartbeat spools a heartbeat
+func (s *Spool) AddHeartbeat(heartbeat *types.Heartbeat) error {
+	return s.add(KindHeartbeat, heartbeat)
+}
+
+// AddAlert spools an alert
+func (s *Spool) AddAlert(alert *types.InstanceAlert) error {
+	return s.add(KindAlert, alert)
+}
+
+// AddResult spools a command result
+func (s *Spool) AddResult(result *types.CommandResult) error {
+	return s.add(KindResult, result)
+}
+
+func (s *Spool) add(kind string, v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := fmt.Sprintf("%020d-%s%s", s.next, kind, fileSuffix)
+	if err := s.write(name, v); err != nil {
+		return err
+	}
+	s.next++
+
+	return s.trim()
+}
+
+// write stores v in a temporary file first, so a crash never leaves a
+// truncated entry behind
+func (s *Spool) write(name string, v interface{}) error {
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create spool entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	gz := gzip.NewWriter(tmp)
+	if err := json.NewEncoder(gz).Encode(v); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write spool entry: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write spool entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write spool entry: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, name)); err != nil {
+		return fmt.Errorf("failed to write spool entry: %w", err)
+	}
+	return nil
+}
+
+// trim drops entries beyond maxEntries, oldest heartbeats first
+func (s *Spool) trim() error {
+	names, err := s.names()
+	if err != nil {
+		return err
+	}
+	excess := len(names) - s.maxEntries
+	if excess <= 0 {
+		return nil
+	}
+
+	var heartbeats, others []string
+	for _, name := range names {
+		if _, kind := parseName(name); kind == KindHeartbeat {
+			heartbeats = append(heartbeats, name)
+		} else {
+			others = append(others, name)
+		}
+	}
+	drop := append(heartbeats, others...)[:excess]
+
+	for _, name := range drop {
+		if err := os.Remove(filepath.Join(s.dir, name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to drop spool entry: %w", err)
+		}
+	}
+	fmt.Printf("Spool full, dropped %d oldest entries\n", len(drop))
+	return nil
+}
+
+// Len returns the number of spooled entries
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names, err := s.names()
+	if err != nil {
+		return 0
+	}
+	return len(names)
+}
+
+// Peek returns up to n of the oldest entries without removing them. Entries
+// that cannot be read are removed.
+func (s *Spool) Peek(n int) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names, err := s.names()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, name := range names {
+		if len(entries) == n {
+			break
+		}
+		entry, err := s.read(name)
+		if err != nil {
+			fmt.Printf("Dropping unreadable spool entry %s: %v\n", name, err)
+			os.Remove(filepath.Join(s.dir, name))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (s *Spool) read(name string) (Entry, error) {
+	f, err := os.Open(filepath.Join(s.dir, name))
+	if err != nil {
+		return Entry{}, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return Entry{}, err
+	}
+	defer gz.Close()
+
+	entry := Entry{name: name}
+	_, entry.Kind = parseName(name)
+	switch entry.Kind {
+	case KindHeartbeat:
+		entry.Heartbeat = &types.Heartbeat{}
+		err = json.NewDecoder(gz).Decode(entry.Heartbeat)
+	case KindAlert:
+		entry.Alert = &types.InstanceAlert{}
+		err = json.NewDecoder(gz).Decode(entry.Alert)
+	case KindResult:
+		entry.Result = &types.CommandResult{}
+		err = json.NewDecoder(gz).Decode(entry.Result)
+	default:
+		err = fmt.Errorf("unknown entry kind %q", entry.Kind)
+	}
+	return entry, err
+}
+
+// Remove deletes delivered entries
+func (s *Spool) Remove(entries []Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range entries {
+		if err := os.Remove(filepath.Join(s.dir, entry.name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove spool entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// names returns the entry file names, oldest first
+func (s *Spool) names() ([]string, error) {
+	dirEntries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool directory: %w", err)
+	}
+
+	var names []string
+	for _, e := range dirEntries {
+		if e.Type().IsRegular() && strings.HasSuffix(e.Name(), fileSuffix) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// parseName splits an entry file name into its sequence number and kind
+func parseName(name string) (uint64, string) {
+	seq, kind, _ := strings.Cut(strings.TrimSuffix(name, fileSuffix), "-")
+	n, _ := strconv.ParseUint(seq, 10, 64)
+	return n, kind
+}
@@ -0,0 +1,105 @@
+package spool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
+)
+
+// describe returns the kind and identifying field of each entry
+func describe(entries []Entry) []string {
+	var out []string
+	for _, entry := range entries {
+		switch entry.Kind {
+		case KindHeartbeat:
+			out = append(out, "heartbeat "+entry.Heartbeat.InstanceID)
+		case KindAlert:
+			out = append(out, "alert "+entry.Alert.Type)
+		case KindResult:
+			out = append(out, "result "+entry.Result.CommandID)
+		}
+	}
+	return out
+}
+
+func equal(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSpoolOrder(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 100)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	s.AddHeartbeat(&types.Heartbeat{InstanceID: "1"})
+	s.AddAlert(&types.InstanceAlert{Type: "service_down"})
+	s.AddResult(&types.CommandResult{CommandID: "cmd-1"})
+
+	entries, err := s.Peek(2)
+	if err != nil {
+		t.Fatalf("Peek: %v", err)
+	}
+	if got, want := describe(entries), []string{"heartbeat 1", "alert service_down"}; !equal(got, want) {
+		t.Fatalf("Peek(2) = %v, want %v", got, want)
+	}
+	if err := s.Remove(entries); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	// A restarted updater queues behind what is left
+	s, err = Open(dir, 100)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	s.AddHeartbeat(&types.Heartbeat{InstanceID: "2"})
+	entries, _ = s.Peek(10)
+	if got, want := describe(entries), []string{"result cmd-1", "heartbeat 2"}; !equal(got, want) {
+		t.Errorf("Peek after reopening = %v, want %v", got, want)
+	}
+
+	// Entries that cannot be read are dropped instead of blocking the rest
+	if err := os.WriteFile(filepath.Join(dir, "00000000000000000000-heartbeat"+fileSuffix), []byte("not gzip"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ = s.Peek(10)
+	if got, want := describe(entries), []string{"result cmd-1", "heartbeat 2"}; !equal(got, want) || s.Len() != 2 {
+		t.Errorf("Peek with a corrupt entry = %v (%d spooled), want %v", got, s.Len(), want)
+	}
+}
+
+func TestSpoolLimit(t *testing.T) {
+	s, err := Open(t.TempDir(), 3)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	s.AddAlert(&types.InstanceAlert{Type: "restart_failed"})
+	s.AddHeartbeat(&types.Heartbeat{InstanceID: "1"})
+	s.AddHeartbeat(&types.Heartbeat{InstanceID: "2"})
+	s.AddResult(&types.CommandResult{CommandID: "cmd-1"})
+	s.AddHeartbeat(&types.Heartbeat{InstanceID: "3"})
+
+	// The oldest heartbeats go first, however old the alert is
+	entries, _ := s.Peek(10)
+	if got, want := describe(entries), []string{"alert restart_failed", "result cmd-1", "heartbeat 3"}; !equal(got, want) {
+		t.Errorf("spooled %v, want %v", got, want)
+	}
+
+	// Once only alerts and results are left, the oldest of those go
+	s.AddAlert(&types.InstanceAlert{Type: "service_down"})
+	s.AddAlert(&types.InstanceAlert{Type: "update_failed"})
+	entries, _ = s.Peek(10)
+	if got, want := describe(entries), []string{"result cmd-1", "alert service_down", "alert update_failed"}; !equal(got, want) {
+		t.Errorf("spooled %v, want %v", got, want)
+	}
+}
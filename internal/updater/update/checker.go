@@ -8,79 +8,224 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cyfox-labs/updates-mysoc-ai/internal/updater/config"
 	"github.com/cyfox-labs/updates-mysoc-ai/pkg/types"
 )
 
-// Checker periodically checks for updates
+// retryFailedAfter is how long a version that failed to apply, or was rolled
+// back, is not retried
+const retryFailedAfter = time.Hour
+
+// Checker applies the updates the update server offers in heartbeat
+// responses, and checks for updates or rolls back when operators ask to
 type Checker struct {
 	config  *config.Config
-	client  *http.Client
 	updater *Updater
+
+	mu       sync.Mutex
+	pending  *offer   // latest offer not yet looked at
+	requests []func() // operator requests not yet run, oldest first
+	wake     chan struct{}
+
+	failed map[string]time.Time // product@version -> when it failed to apply
+}
+
+// offer is what one heartbeat response offers
+type offer struct {
+	updates []types.ReleaseInfo
+	desired map[string]string
+}
+
+// Result is the outcome of an operator request
+type Result struct {
+	Output string
+	Err    error
 }
 
 // NewChecker creates a new update checker
 func NewChecker(cfg *config.Config) *Checker {
 	return &Checker{
 		config:  cfg,
-		client:  &http.Client{Timeout: 30 * time.Second},
 		updater: NewUpdater(cfg),
+		wake:    make(chan struct{}, 1),
+		failed:  make(map[string]time.Time),
 	}
 }
 
-// Start begins the update checking loop
-func (c *Checker) Start(ctx context.Context) {
-	ticker := time.NewTicker(c.config.Update.CheckInterval)
-	defer ticker.Stop()
+// Offer hands the updates and desired versions of a heartbeat response to the
+// checker. It does not block: an offer not yet looked at is replaced, as the
+// newer one supersedes it.
+func (c *Checker) Offer(updates []types.ReleaseInfo, desired map[string]string) {
+	c.mu.Lock()
+	c.pending = &offer{updates: updates, desired: desired}
+	c.mu.Unlock()
+	c.signal()
+}
 
-	// Initial check after a short delay
-	time.Sleep(10 * time.Second)
-	c.checkAllUpdates()
+// CheckNow asks the checker to check every product for updates, as an
+// operator asked for it. The result is sent on the returned channel.
+func (c *Checker) CheckNow() <-chan Result {
+	done := make(chan Result, 1)
+	c.request(func() { done <- c.checkAllUpdates() })
+	return done
+}
+
+// Rollback asks the checker to roll a product back to version, or to its most
+// recent backup when version is empty. The version rolled back from is held
+// back like a failed update, so it is not offered again straight away. The
+// result is sent on the returned channel.
+func (c *Checker) Rollback(productName, version string) <-chan Result {
+	done := make(chan Result, 1)
+	c.request(func() { done <- c.rollback(productName, version) })
+	return done
+}
 
+// request queues an operator request to run in the checker loop, so it never
+// runs alongside an update
+func (c *Checker) request(run func()) {
+	c.mu.Lock()
+	c.requests = append(c.requests, run)
+	c.mu.Unlock()
+	c.signal()
+}
+
+func (c *Checker) signal() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start applies offers and update checks as they come in
+func (c *Checker) Start(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			if c.isInMaintenanceWindow() || c.config.Update.MaintenanceWindow == nil {
-				c.checkAllUpdates()
-			}
+		case <-c.wake:
+		}
+
+		c.mu.Lock()
+		pending, requests := c.pending, c.requests
+		c.pending, c.requests = nil, nil
+		c.mu.Unlock()
+
+		for _, run := range requests {
+			run()
+		}
+		if pending != nil && c.isInMaintenanceWindow() {
+			c.apply(pending)
 		}
 	}
 }
 
-// checkAllUpdates checks and applies updates for all products
-func (c *Checker) checkAllUpdates() {
+// checkAllUpdates checks and applies updates for all products. It runs
+// outside the maintenance window, as it is only done when asked for.
+func (c *Checker) checkAllUpdates() Result {
+	var report []string
+	var failed int
+	checked := &offer{}
 	for _, product := range c.config.Products {
 		hasUpdate, releaseInfo, err := c.updater.CheckUpdate(product.Name)
 		if err != nil {
 			fmt.Printf("Error checking update for %s: %v\n", product.Name, err)
+			report = append(report, fmt.Sprintf("%s: check failed: %v", product.Name, err))
+			failed++
 			continue
 		}
+		if hasUpdate {
+			checked.updates = append(checked.updates, *releaseInfo)
+		} else {
+			report = append(report, product.Name+": up to date")
+		}
+	}
 
-		if hasUpdate && c.config.Update.AutoUpdate {
-			fmt.Printf("Update available for %s: %s -> %s\n",
-				product.Name, releaseInfo.CurrentVersion, releaseInfo.LatestVersion)
+	applied, errs := c.apply(checked)
+	report = append(report, applied...)
+	failed += errs
 
-			if err := c.updater.ApplyUpdate(product.Name, releaseInfo); err != nil {
-				fmt.Printf("Error applying update for %s: %v\n", product.Name, err)
-			} else {
-				fmt.Printf("Successfully updated %s to %s\n", product.Name, releaseInfo.LatestVersion)
-			}
+	result := Result{Output: strings.Join(report, "\n")}
+	if failed > 0 {
+		result.Err = fmt.Errorf("%d of %d products failed to check or update", failed, len(c.config.Products))
+	}
+	return result
+}
+
+// apply applies the updates offered, returning a line per update and how
+// many failed. Updates to a desired version are applied even when
+// auto_update is off; versions that failed recently are skipped.
+func (c *Checker) apply(o *offer) ([]string, int) {
+	var report []string
+	var failed int
+	for i := range o.updates {
+		releaseInfo := &o.updates[i]
+		_, desired := o.desired[releaseInfo.Product]
+		if !desired && !c.config.AutoUpdateEnabled() {
+			report = append(report, fmt.Sprintf("%s: %s available, not applied as auto_update is off",
+				releaseInfo.Product, releaseInfo.LatestVersion))
+			continue
+		}
+		if c.updater.getCurrentVersion(releaseInfo.Product) == releaseInfo.LatestVersion {
+			continue
+		}
+		key := releaseInfo.Product + "@" + releaseInfo.LatestVersion
+		if failedAt, ok := c.failed[key]; ok && time.Since(failedAt) < retryFailedAfter {
+			report = append(report, fmt.Sprintf("%s: %s held back after a failed update or rollback",
+				releaseInfo.Product, releaseInfo.LatestVersion))
+			continue
+		}
+
+		fmt.Printf("Update available for %s: %s -> %s\n",
+			releaseInfo.Product, releaseInfo.CurrentVersion, releaseInfo.LatestVersion)
+
+		if err := c.updater.ApplyUpdate(releaseInfo.Product, releaseInfo); err != nil {
+			fmt.Printf("Error applying update for %s: %v\n", releaseInfo.Product, err)
+			c.failed[key] = time.Now()
+			report = append(report, fmt.Sprintf("%s: update to %s failed: %v", releaseInfo.Product, releaseInfo.LatestVersion, err))
+			failed++
+		} else {
+			fmt.Printf("Successfully updated %s to %s\n", releaseInfo.Product, releaseInfo.LatestVersion)
+			delete(c.failed, key)
+			report = append(report, fmt.Sprintf("%s: updated %s -> %s", releaseInfo.Product, releaseInfo.CurrentVersion, releaseInfo.LatestVersion))
 		}
 	}
+	return report, failed
+}
+
+// rollback rolls a product back, holding back the version it ran before
+func (c *Checker) rollback(productName, version string) Result {
+	from := c.updater.getCurrentVersion(productName)
+	to, err := c.updater.Rollback(productName, version)
+	if err != nil {
+		fmt.Printf("Error rolling back %s: %v\n", productName, err)
+		return Result{Err: err}
+	}
+	if from != "" {
+		c.failed[productName+"@"+from] = time.Now()
+	}
+
+	fmt.Printf("Rolled back %s to %s\n", productName, to)
+	return Result{Output: fmt.Sprintf("%s: rolled back %s -> %s", productName, from, to)}
 }
 
 // isInMaintenanceWindow checks if current time is in maintenance window
 func (c *Checker) isInMaintenanceWindow() bool {
-	if c.config.Update.MaintenanceWindow == nil {
+	window := c.config.UpdateWindow()
+	if window == nil {
 		return true // No window defined, always allow
 	}
 
 	now := time.Now()
-	window := c.config.Update.MaintenanceWindow
+	if window.Timezone != "" {
+		loc, err := time.LoadLocation(window.Timezone)
+		if err != nil {
+			return true // Invalid timezone, allow updates
+		}
+		now = now.In(loc)
+	}
 
 	// Parse start and end times
 	startParts := strings.Split(window.Start, ":")
@@ -127,7 +272,7 @@ func (u *Updater) CheckUpdate(productName string) (bool, *types.ReleaseInfo, err
 	currentVersion := u.getCurrentVersion(productName)
 
 	url := fmt.Sprintf("%s/api/v1/releases/%s/latest?channel=%s&current_version=%s",
-		u.config.Server.URL, productName, u.config.Update.Channel, currentVersion)
+		u.config.Server.URL, productName, u.config.ChannelFor(productName), currentVersion)
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
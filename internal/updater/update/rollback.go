@@ -0,0 +1,111 @@
+package update
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/updater/config"
+)
+
+// Rollback restores the backup of a product kept by the last update and
+// restarts its service, returning the version rolled back to. An empty
+// version rolls back to the most recent backup.
+func (u *Updater) Rollback(productName, version string) (string, error) {
+	var productCfg *config.ProductConfig
+	for i := range u.config.Products {
+		if u.config.Products[i].Name == productName {
+			productCfg = &u.config.Products[i]
+			break
+		}
+	}
+	if productCfg == nil {
+		return "", fmt.Errorf("product %s not found in config", productName)
+	}
+
+	baseDir := config.BaseDir(u.config.Instance.Type)
+	backupDir := filepath.Join(baseDir, "updater", "backups")
+
+	backup, backupVersion, err := findBackup(backupDir, productName, version)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Printf("Rolling back %s to version %s\n", productName, backupVersion)
+
+	if productCfg.Service != "" {
+		if err := runCommand("systemctl", "stop", productCfg.Service); err != nil {
+			fmt.Printf("Warning: failed to stop service: %v\n", err)
+		}
+	}
+
+	// Keep the current binary, so the rollback can be undone by hand
+	if currentVersion := u.getCurrentVersion(productName); currentVersion != "" {
+		currentBackup := filepath.Join(backupDir, fmt.Sprintf("%s.%s.current.bak", productName, currentVersion))
+		if err := copyFile(productCfg.Binary, currentBackup); err != nil {
+			fmt.Printf("Warning: failed to backup current binary: %v\n", err)
+		}
+	}
+
+	if err := copyFile(backup, productCfg.Binary); err != nil {
+		return "", fmt.Errorf("failed to restore backup: %w", err)
+	}
+	if err := os.Chmod(productCfg.Binary, 0755); err != nil {
+		return "", fmt.Errorf("failed to set permissions: %w", err)
+	}
+
+	versionFile := filepath.Join(baseDir, "updater", "versions", productName+".version")
+	if err := os.WriteFile(versionFile, []byte(backupVersion), 0644); err != nil {
+		fmt.Printf("Warning: failed to update version file: %v\n", err)
+	}
+
+	if productCfg.Service != "" {
+		if err := runCommand("systemctl", "start", productCfg.Service); err != nil {
+			return "", fmt.Errorf("failed to start service: %w", err)
+		}
+	}
+
+	return backupVersion, nil
+}
+
+// findBackup finds the backup of a version of a product, or the most recent
+// backup when version is empty. Backups are named <product>.<version>.bak.
+func findBackup(backupDir, productName, version string) (string, string, error) {
+	entries, err := os.ReadDir(backupDir)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var latest, latestVersion string
+	var latestTime int64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, productName+".") || !strings.HasSuffix(name, ".bak") || strings.HasSuffix(name, ".current.bak") {
+			continue
+		}
+		backupVersion := strings.TrimSuffix(strings.TrimPrefix(name, productName+"."), ".bak")
+		if version != "" {
+			if backupVersion == version {
+				return filepath.Join(backupDir, name), backupVersion, nil
+			}
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if latest == "" || info.ModTime().UnixNano() > latestTime {
+			latest, latestVersion, latestTime = name, backupVersion, info.ModTime().UnixNano()
+		}
+	}
+
+	if version != "" {
+		return "", "", fmt.Errorf("no backup of %s %s found", productName, version)
+	}
+	if latest == "" {
+		return "", "", fmt.Errorf("no backup found for %s", productName)
+	}
+	return filepath.Join(backupDir, latest), latestVersion, nil
+}
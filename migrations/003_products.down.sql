@@ -0,0 +1,7 @@
+-- Rollback products registry
+
+DELETE FROM products WHERE name IN ('siemcore', 'mysoc');
+
+ALTER TABLE products DROP COLUMN IF EXISTS license_types;
+ALTER TABLE products DROP COLUMN IF EXISTS health_endpoint;
+ALTER TABLE products DROP COLUMN IF EXISTS install_path;
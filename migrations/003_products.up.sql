@@ -0,0 +1,25 @@
+-- MySoc Updates Platform - Products Registry
+-- Run with: psql -d mysoc_updates -f migrations/003_products.up.sql
+
+-- Install defaults that used to be hard-coded in the server and updater
+ALTER TABLE products ADD COLUMN IF NOT EXISTS install_path VARCHAR(500);      -- relative to the instance base dir
+ALTER TABLE products ADD COLUMN IF NOT EXISTS health_endpoint VARCHAR(500);
+ALTER TABLE products ADD COLUMN IF NOT EXISTS license_types TEXT[] NOT NULL DEFAULT '{}'; -- license types that install it by default
+
+UPDATE products SET install_path = 'bin/' || name WHERE install_path IS NULL AND type = 'binary';
+UPDATE products SET install_path = 'rules/' || name WHERE install_path IS NULL AND type = 'data';
+
+UPDATE products SET license_types = '{siemcore,siemcore-lite}'
+WHERE name IN ('siemcore-api', 'siemcore-collector', 'siemcore-frontend', 'detection-rules');
+
+UPDATE products SET license_types = '{mysoc-cloud}'
+WHERE name IN ('mysoc-api', 'mysoc-frontend');
+
+UPDATE products SET health_endpoint = 'http://localhost:8080/health'
+WHERE name IN ('siemcore-api', 'mysoc-api');
+
+-- Installer bundles uploaded via scripts/upload-release.sh
+INSERT INTO products (name, display_name, description, type, install_path) VALUES
+    ('siemcore', 'SIEMCore', 'SIEMCore installer bundle', 'binary', 'bin/siemcore'),
+    ('mysoc', 'MySoc', 'MySoc installer bundle', 'binary', 'bin/mysoc')
+ON CONFLICT (name) DO NOTHING;
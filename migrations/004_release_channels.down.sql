@@ -0,0 +1,7 @@
+-- Rollback channel promotion and yanked releases
+
+DROP TABLE IF EXISTS release_history;
+
+DROP INDEX IF EXISTS idx_releases_yanked_at;
+ALTER TABLE releases DROP COLUMN IF EXISTS yank_reason;
+ALTER TABLE releases DROP COLUMN IF EXISTS yanked_at;
@@ -0,0 +1,21 @@
+-- MySoc Updates Platform - Channel Promotion and Yanked Releases
+-- Run with: psql -d mysoc_updates -f migrations/004_release_channels.up.sql
+
+-- Yanked releases are hidden from "latest" lookups but stay downloadable
+ALTER TABLE releases ADD COLUMN IF NOT EXISTS yanked_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE releases ADD COLUMN IF NOT EXISTS yank_reason TEXT;
+
+-- History of channel promotions and yanks
+CREATE TABLE IF NOT EXISTS release_history (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    release_id UUID NOT NULL REFERENCES releases(id) ON DELETE CASCADE,
+    action VARCHAR(20) NOT NULL, -- promote, yank, unyank
+    from_channel VARCHAR(20),
+    to_channel VARCHAR(20),
+    reason TEXT,
+    actor VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_release_history_release_id ON release_history(release_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_releases_yanked_at ON releases(yanked_at);
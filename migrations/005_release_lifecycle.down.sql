@@ -0,0 +1,5 @@
+-- Rollback release lifecycle states
+
+DROP INDEX IF EXISTS idx_releases_status;
+ALTER TABLE releases DROP COLUMN IF EXISTS status_message;
+ALTER TABLE releases DROP COLUMN IF EXISTS status;
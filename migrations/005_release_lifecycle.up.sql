@@ -0,0 +1,11 @@
+-- MySoc Updates Platform - Release Lifecycle States
+-- Run with: psql -d mysoc_updates -f migrations/005_release_lifecycle.up.sql
+
+-- Existing releases were live on upload, so they start out published
+ALTER TABLE releases ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'published'; -- draft, published, deprecated, eol
+ALTER TABLE releases ADD COLUMN IF NOT EXISTS status_message TEXT;
+
+-- New uploads are drafts until published
+ALTER TABLE releases ALTER COLUMN status SET DEFAULT 'draft';
+
+CREATE INDEX IF NOT EXISTS idx_releases_status ON releases(product_name, channel, status);
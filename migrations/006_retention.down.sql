@@ -0,0 +1,4 @@
+-- Rollback artifact retention
+
+DROP TABLE IF EXISTS release_pins;
+DROP TABLE IF EXISTS retention_policies;
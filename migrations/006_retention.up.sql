@@ -0,0 +1,33 @@
+-- MySoc Updates Platform - Artifact Retention
+-- Run with: psql -d mysoc_updates -f migrations/006_retention.up.sql
+
+-- Retention policies per product and channel. A release is kept when it is
+-- among the newest keep_last releases or younger than max_age_days.
+CREATE TABLE IF NOT EXISTS retention_policies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    product_name VARCHAR(100) NOT NULL REFERENCES products(name) ON DELETE CASCADE,
+    channel VARCHAR(20) NOT NULL,
+    keep_last INTEGER NOT NULL DEFAULT 0,    -- 0 = no count-based retention
+    max_age_days INTEGER NOT NULL DEFAULT 0, -- 0 = no age-based retention
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE(product_name, channel)
+);
+
+-- Releases pinned by a customer are never garbage collected
+CREATE TABLE IF NOT EXISTS release_pins (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    release_id UUID NOT NULL REFERENCES releases(id) ON DELETE CASCADE,
+    customer_id VARCHAR(100) NOT NULL,
+    reason TEXT,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE(release_id, customer_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_release_pins_customer_id ON release_pins(customer_id);
+
+CREATE TRIGGER update_retention_policies_updated_at
+    BEFORE UPDATE ON retention_policies
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
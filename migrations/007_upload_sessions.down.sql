@@ -0,0 +1,3 @@
+-- Rollback resumable uploads
+
+DROP TABLE IF EXISTS upload_sessions;
@@ -0,0 +1,24 @@
+-- MySoc Updates Platform - Resumable Uploads
+-- Run with: psql -d mysoc_updates -f migrations/007_upload_sessions.up.sql
+
+-- Chunked upload sessions. Chunks are appended to a temporary file until the
+-- session is completed with the expected SHA-256 checksum.
+CREATE TABLE IF NOT EXISTS upload_sessions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    product_name VARCHAR(100) NOT NULL,
+    version VARCHAR(50) NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    channel VARCHAR(20),
+    release_notes TEXT,
+    min_updater_version VARCHAR(50),
+    total_size BIGINT NOT NULL,
+    received_bytes BIGINT NOT NULL DEFAULT 0,
+    status VARCHAR(20) NOT NULL DEFAULT 'open', -- open, completed
+    checksum VARCHAR(64),
+    created_by VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_upload_sessions_expires_at ON upload_sessions(expires_at);
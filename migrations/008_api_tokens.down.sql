@@ -0,0 +1,4 @@
+-- Rollback API tokens and service accounts
+
+DROP TABLE IF EXISTS api_tokens;
+ALTER TABLE users DROP COLUMN IF EXISTS is_service_account;
@@ -0,0 +1,25 @@
+-- MySoc Updates Platform - API Tokens and Service Accounts
+-- Run with: psql -d mysoc_updates -f migrations/008_api_tokens.up.sql
+
+-- Service accounts are users that cannot log in and only authenticate with API tokens
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_service_account BOOLEAN NOT NULL DEFAULT false;
+
+-- API tokens replace the shared ADMIN_API_KEY. Only a SHA-256 hash is stored.
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    token_prefix VARCHAR(16) NOT NULL,        -- shown in listings to identify a token
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',      -- e.g. releases:upload, releases:manage
+    products TEXT[] NOT NULL DEFAULT '{}',    -- empty = all products
+    expires_at TIMESTAMP WITH TIME ZONE,      -- NULL = never expires
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    last_used_ip VARCHAR(45),
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
+CREATE INDEX IF NOT EXISTS idx_api_tokens_token_hash ON api_tokens(token_hash);
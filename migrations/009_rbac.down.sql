@@ -0,0 +1,10 @@
+-- Rollback roles and permissions
+
+UPDATE api_tokens
+SET scopes = array_replace(scopes, 'releases:publish', 'releases:manage')
+WHERE 'releases:publish' = ANY(scopes);
+
+-- Users assigned a custom role fall back to viewer
+UPDATE users SET role = 'viewer' WHERE role NOT IN ('admin', 'operator', 'viewer');
+
+DROP TABLE IF EXISTS roles;
@@ -0,0 +1,24 @@
+-- MySoc Updates Platform - Roles and Permissions
+-- Run with: psql -d mysoc_updates -f migrations/009_rbac.up.sql
+
+-- Custom roles defined by admins. The built-in admin, operator and viewer roles
+-- are defined by the server and cannot be stored here.
+CREATE TABLE IF NOT EXISTS roles (
+    name VARCHAR(50) PRIMARY KEY,
+    description TEXT,
+    permissions TEXT[] NOT NULL DEFAULT '{}',  -- e.g. licenses:read, releases:publish
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    CONSTRAINT roles_not_built_in CHECK (name NOT IN ('admin', 'operator', 'viewer'))
+);
+
+DROP TRIGGER IF EXISTS update_roles_updated_at ON roles;
+CREATE TRIGGER update_roles_updated_at
+    BEFORE UPDATE ON roles
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- API token scopes are now permissions; releases:manage became releases:publish
+UPDATE api_tokens
+SET scopes = array_replace(scopes, 'releases:manage', 'releases:publish')
+WHERE 'releases:manage' = ANY(scopes);
@@ -0,0 +1,45 @@
+-- MySoc Updates Platform - Organizations
+-- Run with: psql -d mysoc_updates -f migrations/010_organizations.up.sql
+
+-- Customer organizations own licenses, and through them instances
+CREATE TABLE IF NOT EXISTS organizations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    slug VARCHAR(100) UNIQUE NOT NULL,  -- used as the customer_id of its licenses
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+DROP TRIGGER IF EXISTS update_organizations_updated_at ON organizations;
+CREATE TRIGGER update_organizations_updated_at
+    BEFORE UPDATE ON organizations
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Users see the licenses and instances of the organizations they belong to
+CREATE TABLE IF NOT EXISTS organization_members (
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_organization_members_user_id ON organization_members(user_id);
+
+ALTER TABLE licenses ADD COLUMN IF NOT EXISTS organization_id UUID REFERENCES organizations(id) ON DELETE RESTRICT;
+
+-- One organization per existing customer, named after its most recent license
+INSERT INTO organizations (slug, name)
+SELECT DISTINCT ON (customer_id) customer_id, customer_name
+FROM licenses
+ORDER BY customer_id, created_at DESC
+ON CONFLICT (slug) DO NOTHING;
+
+UPDATE licenses l
+SET organization_id = o.id
+FROM organizations o
+WHERE o.slug = l.customer_id AND l.organization_id IS NULL;
+
+ALTER TABLE licenses ALTER COLUMN organization_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_licenses_organization_id ON licenses(organization_id);
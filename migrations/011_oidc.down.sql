@@ -0,0 +1,4 @@
+-- Rollback OIDC single sign-on
+
+DROP TABLE IF EXISTS oidc_login_states;
+DROP TABLE IF EXISTS user_identities;
@@ -0,0 +1,28 @@
+-- MySoc Updates Platform - OIDC Single Sign-On
+-- Run with: psql -d mysoc_updates -f migrations/011_oidc.up.sql
+
+-- Links users to identities at an OIDC provider. Users with an identity are SSO-managed.
+CREATE TABLE IF NOT EXISTS user_identities (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,                    -- the ID token "sub" claim
+    email VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    last_login_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (issuer, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
+
+-- Pending authorization-code logins. Only a SHA-256 hash of the state is stored.
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    state_hash VARCHAR(64) PRIMARY KEY,
+    code_verifier TEXT NOT NULL,              -- PKCE verifier sent with the code exchange
+    nonce TEXT NOT NULL,
+    redirect_to TEXT,                         -- dashboard path to return to
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_oidc_login_states_expires_at ON oidc_login_states(expires_at);
@@ -0,0 +1,4 @@
+-- Rollback WebAuthn second factor
+
+DROP TABLE IF EXISTS webauthn_challenges;
+DROP TABLE IF EXISTS webauthn_credentials;
@@ -0,0 +1,31 @@
+-- MySoc Updates Platform - WebAuthn Second Factor
+-- Run with: psql -d mysoc_updates -f migrations/012_webauthn.up.sql
+
+-- Security keys and passkeys registered as a second factor
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    credential_id TEXT UNIQUE NOT NULL,       -- base64url credential ID
+    public_key BYTEA NOT NULL,                -- COSE_Key
+    sign_count BIGINT NOT NULL DEFAULT 0,     -- detects cloned authenticators
+    transports TEXT[] NOT NULL DEFAULT '{}',  -- e.g. usb, nfc, internal
+    aaguid VARCHAR(36),
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials(user_id);
+
+-- Outstanding registration and login challenges. Each is used once.
+CREATE TABLE IF NOT EXISTS webauthn_challenges (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ceremony VARCHAR(20) NOT NULL,            -- registration, login
+    challenge VARCHAR(64) NOT NULL,           -- base64url
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webauthn_challenges_expires_at ON webauthn_challenges(expires_at);
@@ -0,0 +1,3 @@
+-- Rollback password reset and email verification
+
+DROP TABLE IF EXISTS account_tokens;
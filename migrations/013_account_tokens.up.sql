@@ -0,0 +1,16 @@
+-- MySoc Updates Platform - Password Reset and Email Verification
+-- Run with: psql -d mysoc_updates -f migrations/013_account_tokens.up.sql
+
+-- Single-use tokens sent by email. Only a SHA-256 hash of each token is stored.
+CREATE TABLE IF NOT EXISTS account_tokens (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(30) NOT NULL,             -- password_reset, email_verification
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_tokens_user_id ON account_tokens(user_id, purpose);
+CREATE INDEX IF NOT EXISTS idx_account_tokens_expires_at ON account_tokens(expires_at);
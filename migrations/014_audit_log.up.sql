@@ -0,0 +1,50 @@
+-- MySoc Updates Platform - Administrative Audit Log
+-- Run with: psql -d mysoc_updates -f migrations/014_audit_log.up.sql
+
+-- Every mutating API call. Each entry's hash covers the entry and the previous
+-- entry's hash, so editing, removing or reordering entries breaks the chain.
+-- before, after and changes are JSON rather than JSONB to keep the exact hashed text.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGINT PRIMARY KEY,                    -- consecutive, assigned under an advisory lock
+    actor_type VARCHAR(20) NOT NULL,          -- user, api_token, anonymous
+    actor_id VARCHAR(64),
+    actor_email VARCHAR(255),
+    token_id VARCHAR(64),
+    action VARCHAR(255) NOT NULL,             -- e.g. "PUT /api/v1/admin/licenses/{id}"
+    target_type VARCHAR(50),
+    target_id VARCHAR(255),
+    method VARCHAR(10) NOT NULL,
+    path VARCHAR(1000) NOT NULL,
+    status INT NOT NULL,
+    before JSON,
+    after JSON,
+    changes JSON,
+    ip_address VARCHAR(45),
+    user_agent VARCHAR(500),
+    request_id VARCHAR(100),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    prev_hash VARCHAR(64) NOT NULL,
+    hash VARCHAR(64) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor_email);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
+
+-- The log is append-only
+CREATE OR REPLACE FUNCTION audit_log_append_only()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_update
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW
+    EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_truncate
+    BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT
+    EXECUTE FUNCTION audit_log_append_only();
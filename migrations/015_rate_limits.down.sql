@@ -0,0 +1,3 @@
+-- Rollback rate limits
+
+DROP TABLE IF EXISTS rate_limit_buckets;
@@ -0,0 +1,13 @@
+-- MySoc Updates Platform - Rate Limits
+-- Run with: psql -d mysoc_updates -f migrations/015_rate_limits.up.sql
+
+-- Token buckets shared by all replicas when RATE_LIMIT_BACKEND=postgres.
+-- A bucket is full again at full_at, after which its row can be removed.
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limit_buckets (
+    key VARCHAR(200) PRIMARY KEY,             -- rule, scope and client, e.g. login:ip:203.0.113.7
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    full_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_limit_buckets_full_at ON rate_limit_buckets(full_at);
@@ -0,0 +1,3 @@
+-- Rollback JWT signing keys
+
+DROP TABLE IF EXISTS signing_keys;
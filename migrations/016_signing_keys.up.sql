@@ -0,0 +1,18 @@
+-- MySoc Updates Platform - JWT Signing Keys
+-- Run with: psql -d mysoc_updates -f migrations/016_signing_keys.up.sql
+
+-- Asymmetric keys that sign access tokens. Each key signs between not_before
+-- and not_after and is published for verification until expires_at. Private
+-- keys are encrypted with a key derived from JWT_SECRET.
+CREATE TABLE IF NOT EXISTS signing_keys (
+    id VARCHAR(64) PRIMARY KEY,               -- the kid header of tokens it signs
+    algorithm VARCHAR(10) NOT NULL,           -- EdDSA, ES256
+    public_key BYTEA NOT NULL,                -- PKIX DER
+    private_key BYTEA NOT NULL,               -- AES-GCM sealed PKCS #8 DER
+    not_before TIMESTAMP WITH TIME ZONE NOT NULL,
+    not_after TIMESTAMP WITH TIME ZONE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_signing_keys_expires_at ON signing_keys(expires_at);
@@ -0,0 +1,9 @@
+-- Rollback session management
+
+DROP TABLE IF EXISTS used_refresh_tokens;
+
+ALTER TABLE sessions DROP COLUMN IF EXISTS revoked_reason;
+ALTER TABLE sessions DROP COLUMN IF EXISTS device_type;
+ALTER TABLE sessions DROP COLUMN IF EXISTS os;
+ALTER TABLE sessions DROP COLUMN IF EXISTS browser;
+ALTER TABLE sessions DROP COLUMN IF EXISTS last_used_at;
@@ -0,0 +1,27 @@
+-- MySoc Updates Platform - Session Management
+-- Run with: psql -d mysoc_updates -f migrations/017_session_management.up.sql
+
+-- A session now lasts for one sign-in: refreshing rotates its refresh token in
+-- place. last_used_at drives the idle timeout and expires_at is the absolute one.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP WITH TIME ZONE;
+UPDATE sessions SET last_used_at = created_at WHERE last_used_at IS NULL;
+ALTER TABLE sessions ALTER COLUMN last_used_at SET DEFAULT NOW();
+ALTER TABLE sessions ALTER COLUMN last_used_at SET NOT NULL;
+
+-- Device details parsed from the user agent at sign-in
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS browser VARCHAR(100);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS os VARCHAR(100);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS device_type VARCHAR(20);  -- desktop, mobile, tablet, cli, unknown
+
+-- logout, revoked, admin_revoked, password_change, idle_timeout, refresh_token_reuse, ...
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS revoked_reason VARCHAR(50);
+
+-- Refresh tokens a session has already rotated past. Presenting one again
+-- means the token was copied, so the whole session is revoked.
+CREATE TABLE IF NOT EXISTS used_refresh_tokens (
+    token_hash VARCHAR(64) PRIMARY KEY,
+    session_id UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    used_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_used_refresh_tokens_session_id ON used_refresh_tokens(session_id);
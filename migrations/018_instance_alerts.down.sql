@@ -0,0 +1,4 @@
+-- Rollback instance alerts
+
+DROP INDEX IF EXISTS idx_heartbeat_history_received_at;
+DROP TABLE IF EXISTS instance_alerts;
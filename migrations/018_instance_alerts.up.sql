@@ -0,0 +1,22 @@
+-- MySoc Updates Platform - Instance Alerts
+-- Run with: psql -d mysoc_updates -f migrations/018_instance_alerts.up.sql
+
+-- Alerts raised by updaters, such as a service that could not be restarted.
+-- occurred_at is when the updater raised it, which can be long before it was
+-- received if the server was unreachable.
+CREATE TABLE IF NOT EXISTS instance_alerts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    instance_id UUID NOT NULL REFERENCES instances(id) ON DELETE CASCADE,
+    type VARCHAR(100) NOT NULL,
+    severity VARCHAR(20) NOT NULL,  -- critical, high, medium, low
+    message TEXT NOT NULL,
+    details TEXT,
+    occurred_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    received_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_instance_alerts_instance ON instance_alerts(instance_id, occurred_at DESC);
+CREATE INDEX IF NOT EXISTS idx_instance_alerts_occurred_at ON instance_alerts(occurred_at);
+
+-- Heartbeat history is pruned by age
+CREATE INDEX IF NOT EXISTS idx_heartbeat_history_received_at ON heartbeat_history(received_at);
@@ -0,0 +1,4 @@
+-- Rollback instance control
+
+ALTER TABLE instances DROP COLUMN IF EXISTS updater_config;
+ALTER TABLE instances DROP COLUMN IF EXISTS desired_versions;
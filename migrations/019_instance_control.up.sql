@@ -0,0 +1,8 @@
+-- MySoc Updates Platform - Instance Control
+-- Run with: psql -d mysoc_updates -f migrations/019_instance_control.up.sql
+
+-- What operators tell an instance through its heartbeat responses: product
+-- versions to run whatever its channels offer, and updater settings that
+-- override its config file
+ALTER TABLE instances ADD COLUMN IF NOT EXISTS desired_versions JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE instances ADD COLUMN IF NOT EXISTS updater_config JSONB;
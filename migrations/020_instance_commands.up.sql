@@ -0,0 +1,24 @@
+-- MySoc Updates Platform - Instance Commands
+-- Run with: psql -d mysoc_updates -f migrations/020_instance_commands.up.sql
+
+-- Commands operators queue for an instance. They are delivered in its next
+-- heartbeat response, signed, and the updater reports back their result.
+CREATE TABLE IF NOT EXISTS instance_commands (
+    id UUID PRIMARY KEY,
+    instance_id UUID NOT NULL REFERENCES instances(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL,      -- check_update, restart_service, security_scan, rollback, collect_diagnostics
+    product VARCHAR(100),
+    args JSONB NOT NULL DEFAULT '{}',
+    signature TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',  -- pending, delivered, succeeded, failed, rejected, expired, cancelled
+    output TEXT,
+    error TEXT,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    delivered_at TIMESTAMP WITH TIME ZONE,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_instance_commands_instance ON instance_commands(instance_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_instance_commands_open ON instance_commands(status) WHERE status IN ('pending', 'delivered');
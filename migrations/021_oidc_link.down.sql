@@ -0,0 +1,3 @@
+-- Rollback explicit SSO linking
+
+ALTER TABLE oidc_login_states DROP COLUMN IF EXISTS link_user_id;
@@ -0,0 +1,6 @@
+-- MySoc Updates Platform - Explicit SSO Linking
+-- Run with: psql -d mysoc_updates -f migrations/021_oidc_link.up.sql
+
+-- A pending login started by a signed-in user to link their account to an
+-- identity. Accounts are never linked by matching email alone.
+ALTER TABLE oidc_login_states ADD COLUMN IF NOT EXISTS link_user_id UUID REFERENCES users(id) ON DELETE CASCADE;
@@ -0,0 +1,32 @@
+// Package migrations embeds the database schema migrations into update-server.
+// Each version has an NNN_name.up.sql file and an NNN_name.down.sql file that
+// reverts it; see database.Migrator. The sqlite directory holds the
+// migrations for SQLite databases, which start from the current schema.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+
+	"github.com/cyfox-labs/updates-mysoc-ai/internal/server/database"
+)
+
+// FS holds the PostgreSQL migration files
+//
+//go:embed *.sql
+var FS embed.FS
+
+//go:embed sqlite/*.sql
+var sqliteFS embed.FS
+
+// ForDriver returns the migration files for a database driver
+func ForDriver(driver string) fs.FS {
+	if driver == database.DriverSQLite {
+		sub, err := fs.Sub(sqliteFS, "sqlite")
+		if err != nil {
+			panic(err) // the directory is embedded, so this cannot fail
+		}
+		return sub
+	}
+	return FS
+}
@@ -0,0 +1,29 @@
+-- MySoc Updates Platform - Rollback SQLite Schema
+
+DROP TABLE IF EXISTS signing_keys;
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS account_tokens;
+DROP TABLE IF EXISTS webauthn_challenges;
+DROP TABLE IF EXISTS webauthn_credentials;
+DROP TABLE IF EXISTS oidc_login_states;
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS roles;
+DROP TABLE IF EXISTS api_tokens;
+DROP TABLE IF EXISTS auth_audit_log;
+DROP TABLE IF EXISTS used_refresh_tokens;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS upload_sessions;
+DROP TABLE IF EXISTS release_pins;
+DROP TABLE IF EXISTS retention_policies;
+DROP TABLE IF EXISTS security_baselines;
+DROP TABLE IF EXISTS config_templates;
+DROP TABLE IF EXISTS heartbeat_history;
+DROP TABLE IF EXISTS deployments;
+DROP TABLE IF EXISTS release_history;
+DROP TABLE IF EXISTS releases;
+DROP TABLE IF EXISTS instances;
+DROP TABLE IF EXISTS licenses;
+DROP TABLE IF EXISTS organizations;
+DROP TABLE IF EXISTS products;
+DROP TABLE IF EXISTS users;
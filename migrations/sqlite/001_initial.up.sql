@@ -0,0 +1,468 @@
+-- MySoc Updates Platform - SQLite Schema
+-- The PostgreSQL schema as of migration 017, for single-node and test
+-- deployments. IDs and timestamps are set by the server; UUIDs are stored as
+-- text, arrays and JSONB as JSON text, and times as UTC text.
+
+-- Licenses table
+CREATE TABLE licenses (
+    id TEXT PRIMARY KEY,
+    license_key TEXT UNIQUE NOT NULL,
+    organization_id TEXT NOT NULL REFERENCES organizations(id), -- NO ACTION, so deletes fail while licenses remain
+    customer_id TEXT NOT NULL,
+    customer_name TEXT NOT NULL,
+    license_type TEXT NOT NULL,                -- mysoc-cloud, siemcore, siemcore-lite
+    products TEXT NOT NULL DEFAULT '[]',
+    features TEXT DEFAULT '[]',
+    limits TEXT DEFAULT '{}',
+    issued_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    bound_to TEXT,                             -- Optional hardware binding
+    is_active BOOLEAN DEFAULT 1,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Instances table (registered servers)
+CREATE TABLE instances (
+    id TEXT PRIMARY KEY,
+    instance_id TEXT UNIQUE NOT NULL,
+    instance_type TEXT NOT NULL,               -- mysoc, siemcore
+    hostname TEXT,
+    license_id TEXT REFERENCES licenses(id) ON DELETE SET NULL,
+    api_key_hash TEXT NOT NULL,
+    last_heartbeat TIMESTAMP,
+    last_heartbeat_data TEXT,
+    status TEXT DEFAULT 'unknown',             -- online, offline, degraded
+    metadata TEXT DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Releases table
+CREATE TABLE releases (
+    id TEXT PRIMARY KEY,
+    product_name TEXT NOT NULL,
+    version TEXT NOT NULL,
+    channel TEXT DEFAULT 'stable',             -- stable, beta, nightly
+    status TEXT NOT NULL DEFAULT 'draft',      -- draft, published, deprecated, eol
+    status_message TEXT,
+    manifest TEXT NOT NULL DEFAULT '{}',
+    artifact_path TEXT,
+    artifact_size INTEGER DEFAULT 0,
+    checksum TEXT,
+    signature TEXT,
+    release_notes TEXT,
+    min_updater_version TEXT,
+    yanked_at TIMESTAMP,                       -- hidden from "latest" lookups but still downloadable
+    yank_reason TEXT,
+    released_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(product_name, version)
+);
+
+-- History of channel promotions, yanks and lifecycle changes
+CREATE TABLE release_history (
+    id TEXT PRIMARY KEY,
+    release_id TEXT NOT NULL REFERENCES releases(id) ON DELETE CASCADE,
+    action TEXT NOT NULL,                      -- promote, yank, unyank, publish, deprecate, eol
+    from_channel TEXT,
+    to_channel TEXT,
+    reason TEXT,
+    actor TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Deployments tracking
+CREATE TABLE deployments (
+    id TEXT PRIMARY KEY,
+    instance_id TEXT REFERENCES instances(id) ON DELETE CASCADE,
+    release_id TEXT REFERENCES releases(id) ON DELETE CASCADE,
+    status TEXT NOT NULL,                      -- pending, downloading, installing, success, failed, rolled_back
+    started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP,
+    error_message TEXT,
+    previous_version TEXT
+);
+
+-- Heartbeat history (for analytics)
+CREATE TABLE heartbeat_history (
+    id TEXT PRIMARY KEY,
+    instance_id TEXT REFERENCES instances(id) ON DELETE CASCADE,
+    heartbeat_data TEXT NOT NULL,
+    received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Products table (registered products)
+CREATE TABLE products (
+    id TEXT PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL,
+    display_name TEXT NOT NULL,
+    description TEXT,
+    type TEXT NOT NULL,                        -- binary, data, config
+    default_channel TEXT DEFAULT 'stable',
+    install_path TEXT,                         -- relative to the instance base dir
+    health_endpoint TEXT,
+    license_types TEXT NOT NULL DEFAULT '[]',  -- license types that install it by default
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Config templates
+CREATE TABLE config_templates (
+    id TEXT PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL,
+    description TEXT,
+    template TEXT NOT NULL,
+    variables TEXT DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Security baselines
+CREATE TABLE security_baselines (
+    id TEXT PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL,
+    description TEXT,
+    checks TEXT NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Retention policies per product and channel. A release is kept when it is
+-- among the newest keep_last releases or younger than max_age_days.
+CREATE TABLE retention_policies (
+    id TEXT PRIMARY KEY,
+    product_name TEXT NOT NULL REFERENCES products(name) ON DELETE CASCADE,
+    channel TEXT NOT NULL,
+    keep_last INTEGER NOT NULL DEFAULT 0,      -- 0 = no count-based retention
+    max_age_days INTEGER NOT NULL DEFAULT 0,   -- 0 = no age-based retention
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(product_name, channel)
+);
+
+-- Releases pinned by a customer are never garbage collected
+CREATE TABLE release_pins (
+    id TEXT PRIMARY KEY,
+    release_id TEXT NOT NULL REFERENCES releases(id) ON DELETE CASCADE,
+    customer_id TEXT NOT NULL,
+    reason TEXT,
+    created_by TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(release_id, customer_id)
+);
+
+-- Chunked upload sessions
+CREATE TABLE upload_sessions (
+    id TEXT PRIMARY KEY,
+    product_name TEXT NOT NULL,
+    version TEXT NOT NULL,
+    filename TEXT NOT NULL,
+    channel TEXT,
+    release_notes TEXT,
+    min_updater_version TEXT,
+    total_size INTEGER NOT NULL,
+    received_bytes INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'open',       -- open, completed
+    checksum TEXT,
+    created_by TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- Users table
+CREATE TABLE users (
+    id TEXT PRIMARY KEY,
+    email TEXT UNIQUE NOT NULL,
+    password_hash TEXT NOT NULL,
+    name TEXT NOT NULL,
+    role TEXT NOT NULL DEFAULT 'viewer',       -- admin, operator, viewer or a custom role
+    avatar_url TEXT,
+    mfa_enabled BOOLEAN DEFAULT 0,
+    mfa_secret TEXT,
+    mfa_backup_codes TEXT,                     -- JSON array of hashed backup codes
+    mfa_verified_at TIMESTAMP,
+    is_active BOOLEAN DEFAULT 1,
+    is_service_account BOOLEAN NOT NULL DEFAULT 0,
+    email_verified BOOLEAN DEFAULT 0,
+    email_verified_at TIMESTAMP,
+    failed_login_attempts INTEGER DEFAULT 0,
+    locked_until TIMESTAMP,
+    password_changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_login_at TIMESTAMP,
+    last_login_ip TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Sessions: one per sign-in, refreshed by rotating its refresh token in place
+CREATE TABLE sessions (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    refresh_token_hash TEXT UNIQUE NOT NULL,
+    user_agent TEXT,
+    ip_address TEXT,
+    browser TEXT,
+    os TEXT,
+    device_type TEXT,                          -- desktop, mobile, tablet, cli, unknown
+    last_used_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    revoked_reason TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Refresh tokens a session has already rotated past
+CREATE TABLE used_refresh_tokens (
+    token_hash TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Audit log for security events
+CREATE TABLE auth_audit_log (
+    id TEXT PRIMARY KEY,
+    user_id TEXT REFERENCES users(id) ON DELETE SET NULL,
+    event_type TEXT NOT NULL,
+    ip_address TEXT,
+    user_agent TEXT,
+    details TEXT DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- API tokens. Only a SHA-256 hash is stored.
+CREATE TABLE api_tokens (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    token_prefix TEXT NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL,
+    scopes TEXT NOT NULL DEFAULT '[]',
+    products TEXT NOT NULL DEFAULT '[]',       -- empty = all products
+    expires_at TIMESTAMP,                      -- NULL = never expires
+    last_used_at TIMESTAMP,
+    last_used_ip TEXT,
+    revoked_at TIMESTAMP,
+    created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Custom roles. The built-in admin, operator and viewer roles cannot be stored here.
+CREATE TABLE roles (
+    name TEXT PRIMARY KEY,
+    description TEXT,
+    permissions TEXT NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT roles_not_built_in CHECK (name NOT IN ('admin', 'operator', 'viewer'))
+);
+
+-- Customer organizations own licenses, and through them instances
+CREATE TABLE organizations (
+    id TEXT PRIMARY KEY,
+    slug TEXT UNIQUE NOT NULL,                 -- used as the customer_id of its licenses
+    name TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE organization_members (
+    organization_id TEXT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (organization_id, user_id)
+);
+
+-- Links users to identities at an OIDC provider
+CREATE TABLE user_identities (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_login_at TIMESTAMP,
+    UNIQUE (issuer, subject)
+);
+
+-- Pending authorization-code logins
+CREATE TABLE oidc_login_states (
+    state_hash TEXT PRIMARY KEY,
+    code_verifier TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    redirect_to TEXT,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Security keys and passkeys registered as a second factor
+CREATE TABLE webauthn_credentials (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    credential_id TEXT UNIQUE NOT NULL,
+    public_key BLOB NOT NULL,
+    sign_count INTEGER NOT NULL DEFAULT 0,
+    transports TEXT NOT NULL DEFAULT '[]',
+    aaguid TEXT,
+    last_used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
+
+-- Outstanding WebAuthn challenges
+CREATE TABLE webauthn_challenges (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ceremony TEXT NOT NULL,                    -- registration, login
+    challenge TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Single-use password reset and email verification tokens
+CREATE TABLE account_tokens (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose TEXT NOT NULL,                     -- password_reset, email_verification
+    token_hash TEXT UNIQUE NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Hash-chained log of every mutating API call
+CREATE TABLE audit_log (
+    id INTEGER PRIMARY KEY,                    -- consecutive, assigned under the write lock
+    actor_type TEXT NOT NULL,                  -- user, api_token, anonymous
+    actor_id TEXT,
+    actor_email TEXT,
+    token_id TEXT,
+    action TEXT NOT NULL,
+    target_type TEXT,
+    target_id TEXT,
+    method TEXT NOT NULL,
+    path TEXT NOT NULL,
+    status INTEGER NOT NULL,
+    before TEXT,
+    after TEXT,
+    changes TEXT,
+    ip_address TEXT,
+    user_agent TEXT,
+    request_id TEXT,
+    created_at TIMESTAMP NOT NULL,
+    prev_hash TEXT NOT NULL,
+    hash TEXT NOT NULL
+);
+
+-- Asymmetric keys that sign access tokens
+CREATE TABLE signing_keys (
+    id TEXT PRIMARY KEY,                       -- the kid header of tokens it signs
+    algorithm TEXT NOT NULL,                   -- EdDSA, ES256
+    public_key BLOB NOT NULL,                  -- PKIX DER
+    private_key BLOB NOT NULL,                 -- AES-GCM sealed PKCS #8 DER
+    not_before TIMESTAMP NOT NULL,
+    not_after TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Indexes
+CREATE INDEX idx_instances_status ON instances(status);
+CREATE INDEX idx_instances_license_id ON instances(license_id);
+CREATE INDEX idx_instances_last_heartbeat ON instances(last_heartbeat);
+CREATE INDEX idx_releases_product_channel ON releases(product_name, channel);
+CREATE INDEX idx_releases_released_at ON releases(released_at DESC);
+CREATE INDEX idx_releases_yanked_at ON releases(yanked_at);
+CREATE INDEX idx_releases_status ON releases(product_name, channel, status);
+CREATE INDEX idx_release_history_release_id ON release_history(release_id, created_at DESC);
+CREATE INDEX idx_deployments_instance_id ON deployments(instance_id);
+CREATE INDEX idx_deployments_status ON deployments(status);
+CREATE INDEX idx_heartbeat_history_instance ON heartbeat_history(instance_id, received_at DESC);
+CREATE INDEX idx_licenses_customer_id ON licenses(customer_id);
+CREATE INDEX idx_licenses_expires_at ON licenses(expires_at);
+CREATE INDEX idx_licenses_organization_id ON licenses(organization_id);
+CREATE INDEX idx_release_pins_customer_id ON release_pins(customer_id);
+CREATE INDEX idx_upload_sessions_expires_at ON upload_sessions(expires_at);
+CREATE INDEX idx_users_role ON users(role);
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX idx_sessions_expires_at ON sessions(expires_at);
+CREATE INDEX idx_used_refresh_tokens_session_id ON used_refresh_tokens(session_id);
+CREATE INDEX idx_auth_audit_user_id ON auth_audit_log(user_id);
+CREATE INDEX idx_auth_audit_created_at ON auth_audit_log(created_at DESC);
+CREATE INDEX idx_api_tokens_user_id ON api_tokens(user_id);
+CREATE INDEX idx_organization_members_user_id ON organization_members(user_id);
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+CREATE INDEX idx_oidc_login_states_expires_at ON oidc_login_states(expires_at);
+CREATE INDEX idx_webauthn_credentials_user_id ON webauthn_credentials(user_id);
+CREATE INDEX idx_webauthn_challenges_expires_at ON webauthn_challenges(expires_at);
+CREATE INDEX idx_account_tokens_user_id ON account_tokens(user_id, purpose);
+CREATE INDEX idx_account_tokens_expires_at ON account_tokens(expires_at);
+CREATE INDEX idx_audit_log_created_at ON audit_log(created_at DESC);
+CREATE INDEX idx_audit_log_actor ON audit_log(actor_email);
+CREATE INDEX idx_audit_log_target ON audit_log(target_type, target_id);
+CREATE INDEX idx_signing_keys_expires_at ON signing_keys(expires_at);
+
+-- The audit log is append-only
+CREATE TRIGGER audit_log_no_update
+    BEFORE UPDATE ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+CREATE TRIGGER audit_log_no_delete
+    BEFORE DELETE ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+-- Seed data. Each row gets a random version 4 UUID.
+
+-- Default products
+INSERT INTO products (id, name, display_name, description, type, install_path, health_endpoint, license_types)
+SELECT lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' ||
+    substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))),
+    column1, column2, column3, column4, column5, column6, column7
+FROM (VALUES
+    ('siemcore-api', 'SIEMCore API', 'SIEMCore API Server', 'binary', 'bin/siemcore-api', 'http://localhost:8080/health', '["siemcore","siemcore-lite"]'),
+    ('siemcore-collector', 'SIEMCore Collector', 'SIEMCore Log Collector', 'binary', 'bin/siemcore-collector', NULL, '["siemcore","siemcore-lite"]'),
+    ('siemcore-frontend', 'SIEMCore Frontend', 'SIEMCore Web UI', 'binary', 'bin/siemcore-frontend', NULL, '["siemcore","siemcore-lite"]'),
+    ('detection-rules', 'Detection Rules', 'SIEM Detection Rules', 'data', 'rules/detection-rules', NULL, '["siemcore","siemcore-lite"]'),
+    ('mysoc-api', 'MySoc API', 'MySoc Platform API', 'binary', 'bin/mysoc-api', 'http://localhost:8080/health', '["mysoc-cloud"]'),
+    ('mysoc-frontend', 'MySoc Frontend', 'MySoc Web UI', 'binary', 'bin/mysoc-frontend', NULL, '["mysoc-cloud"]'),
+    ('siemcore', 'SIEMCore', 'SIEMCore installer bundle', 'binary', 'bin/siemcore', NULL, '[]'),
+    ('mysoc', 'MySoc', 'MySoc installer bundle', 'binary', 'bin/mysoc', NULL, '[]')
+);
+
+-- Default config templates
+INSERT INTO config_templates (id, name, description, template, variables)
+SELECT lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' ||
+    substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))),
+    column1, column2, column3, column4
+FROM (VALUES
+    ('siemcore-standard', 'Standard SIEMCore Configuration',
+     '{"api": {"port": 8080, "host": "0.0.0.0"}, "collector": {"port": 5514, "protocols": ["syslog", "json"]}, "database": {"type": "postgresql"}}',
+     '{"hostname": "", "domain": ""}'),
+    ('mysoc-cloud', 'MySoc Cloud Configuration',
+     '{"api": {"port": 8080, "host": "0.0.0.0"}, "multi_tenant": true}',
+     '{"hostname": "", "domain": ""}')
+);
+
+-- Default security baseline
+INSERT INTO security_baselines (id, name, description, checks)
+SELECT lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' ||
+    substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))),
+    'cis-level1', 'CIS Level 1 Security Baseline', '[
+    {"id": "fw-enabled", "name": "Firewall Enabled", "type": "firewall"},
+    {"id": "ssh-root-disabled", "name": "SSH Root Login Disabled", "type": "ssh"},
+    {"id": "ssh-password-disabled", "name": "SSH Password Auth Disabled", "type": "ssh"},
+    {"id": "updates-current", "name": "Security Updates Applied", "type": "os"},
+    {"id": "tls-valid", "name": "TLS Certificates Valid", "type": "tls"}
+]';
+
+-- Default admin user (password: admin123 - CHANGE THIS!)
+INSERT INTO users (id, email, password_hash, name, role, is_active, email_verified)
+SELECT lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' ||
+    substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))),
+    'admin@mysoc.ai', '$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy', 'System Admin', 'admin', 1, 1;
@@ -0,0 +1,20 @@
+-- MySoc Updates Platform - Instance Alerts (PostgreSQL migration 018)
+
+-- Alerts raised by updaters. occurred_at is when the updater raised it, which
+-- can be long before it was received if the server was unreachable.
+CREATE TABLE instance_alerts (
+    id TEXT PRIMARY KEY,
+    instance_id TEXT NOT NULL REFERENCES instances(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    severity TEXT NOT NULL,                    -- critical, high, medium, low
+    message TEXT NOT NULL,
+    details TEXT,
+    occurred_at TIMESTAMP NOT NULL,
+    received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_instance_alerts_instance ON instance_alerts(instance_id, occurred_at DESC);
+CREATE INDEX idx_instance_alerts_occurred_at ON instance_alerts(occurred_at);
+
+-- Heartbeat history is pruned by age
+CREATE INDEX idx_heartbeat_history_received_at ON heartbeat_history(received_at);
@@ -0,0 +1,4 @@
+-- Rollback instance control
+
+ALTER TABLE instances DROP COLUMN updater_config;
+ALTER TABLE instances DROP COLUMN desired_versions;
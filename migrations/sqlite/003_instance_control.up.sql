@@ -0,0 +1,7 @@
+-- MySoc Updates Platform - Instance Control (PostgreSQL migration 019)
+
+-- What operators tell an instance through its heartbeat responses: product
+-- versions to run whatever its channels offer, and updater settings that
+-- override its config file
+ALTER TABLE instances ADD COLUMN desired_versions TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE instances ADD COLUMN updater_config TEXT;
@@ -0,0 +1,3 @@
+-- Rollback instance commands
+
+DROP TABLE IF EXISTS instance_commands;
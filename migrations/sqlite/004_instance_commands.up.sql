@@ -0,0 +1,23 @@
+-- MySoc Updates Platform - Instance Commands (PostgreSQL migration 020)
+
+-- Commands operators queue for an instance. They are delivered in its next
+-- heartbeat response, signed, and the updater reports back their result.
+CREATE TABLE instance_commands (
+    id TEXT PRIMARY KEY,
+    instance_id TEXT NOT NULL REFERENCES instances(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,                        -- check_update, restart_service, security_scan, rollback, collect_diagnostics
+    product TEXT,
+    args TEXT NOT NULL DEFAULT '{}',
+    signature TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',    -- pending, delivered, succeeded, failed, rejected, expired, cancelled
+    output TEXT,
+    error TEXT,
+    created_by TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    delivered_at TIMESTAMP,
+    completed_at TIMESTAMP
+);
+
+CREATE INDEX idx_instance_commands_instance ON instance_commands(instance_id, created_at DESC);
+CREATE INDEX idx_instance_commands_status ON instance_commands(status);
@@ -0,0 +1,5 @@
+-- MySoc Updates Platform - Explicit SSO Linking (PostgreSQL migration 021)
+
+-- A pending login started by a signed-in user to link their account to an
+-- identity. Accounts are never linked by matching email alone.
+ALTER TABLE oidc_login_states ADD COLUMN link_user_id TEXT REFERENCES users(id) ON DELETE CASCADE;
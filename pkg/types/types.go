@@ -1,25 +1,29 @@
 package types
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"time"
 )
 
 // License represents a customer license
 type License struct {
-	ID           string         `json:"id"`
-	LicenseKey   string         `json:"license_key"`
-	CustomerID   string         `json:"customer_id"`
-	CustomerName string         `json:"customer_name"`
-	Type         string         `json:"type"` // mysoc-cloud, siemcore, siemcore-lite
-	Products     []string       `json:"products"`
-	Features     []string       `json:"features,omitempty"`
-	Limits       LicenseLimits  `json:"limits"`
-	IssuedAt     time.Time      `json:"issued_at"`
-	ExpiresAt    time.Time      `json:"expires_at"`
-	BoundTo      string         `json:"bound_to,omitempty"`
-	IsActive     bool           `json:"is_active"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
+	ID             string        `json:"id"`
+	LicenseKey     string        `json:"license_key"`
+	OrganizationID string        `json:"organization_id"`
+	CustomerID     string        `json:"customer_id"`
+	CustomerName   string        `json:"customer_name"`
+	Type           string        `json:"type"` // mysoc-cloud, siemcore, siemcore-lite
+	Products       []string      `json:"products"`
+	Features       []string      `json:"features,omitempty"`
+	Limits         LicenseLimits `json:"limits"`
+	IssuedAt       time.Time     `json:"issued_at"`
+	ExpiresAt      time.Time     `json:"expires_at"`
+	BoundTo        string        `json:"bound_to,omitempty"`
+	IsActive       bool          `json:"is_active"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
 }
 
 // LicenseLimits defines the limits for a license
@@ -32,36 +36,147 @@ type LicenseLimits struct {
 
 // Instance represents a registered server instance
 type Instance struct {
-	ID                string          `json:"id"`
-	InstanceID        string          `json:"instance_id"`
-	InstanceType      string          `json:"instance_type"` // mysoc, siemcore
-	Hostname          string          `json:"hostname"`
-	LicenseID         string          `json:"license_id,omitempty"`
-	APIKeyHash        string          `json:"-"`
-	LastHeartbeat     *time.Time      `json:"last_heartbeat,omitempty"`
-	LastHeartbeatData *Heartbeat      `json:"last_heartbeat_data,omitempty"`
-	Status            string          `json:"status"` // online, offline, degraded
-	CreatedAt         time.Time       `json:"created_at"`
-	UpdatedAt         time.Time       `json:"updated_at"`
+	ID                string     `json:"id"`
+	InstanceID        string     `json:"instance_id"`
+	InstanceType      string     `json:"instance_type"` // mysoc, siemcore
+	Hostname          string     `json:"hostname"`
+	LicenseID         string     `json:"license_id,omitempty"`
+	OrganizationID    string     `json:"organization_id,omitempty"` // owner of the license
+	APIKeyHash        string     `json:"-"`
+	LastHeartbeat     *time.Time `json:"last_heartbeat,omitempty"`
+	LastHeartbeatData *Heartbeat `json:"last_heartbeat_data,omitempty"`
+	Status            string     `json:"status"` // online, offline, degraded
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// Product is a registered product that releases can be published for
+type Product struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	DisplayName    string    `json:"display_name"`
+	Description    string    `json:"description,omitempty"`
+	Type           string    `json:"type"` // binary, data, config
+	DefaultChannel string    `json:"default_channel"`
+	InstallPath    string    `json:"install_path,omitempty"` // relative to the instance base dir
+	HealthEndpoint string    `json:"health_endpoint,omitempty"`
+	LicenseTypes   []string  `json:"license_types"` // license types that install it by default
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
 }
 
 // Release represents a product release
 type Release struct {
+	ID                string     `json:"id"`
+	ProductName       string     `json:"product_name"`
+	Version           string     `json:"version"`
+	Channel           string     `json:"channel"` // stable, beta, nightly
+	Status            string     `json:"status"`  // draft, published, deprecated, eol
+	StatusMessage     string     `json:"status_message,omitempty"`
+	Manifest          Manifest   `json:"manifest"`
+	ArtifactPath      string     `json:"artifact_path,omitempty"`
+	ArtifactSize      int64      `json:"artifact_size"`
+	Checksum          string     `json:"checksum"`
+	Signature         string     `json:"signature,omitempty"`
+	ReleaseNotes      string     `json:"release_notes,omitempty"`
+	MinUpdaterVersion string     `json:"min_updater_version,omitempty"`
+	YankedAt          *time.Time `json:"yanked_at,omitempty"` // hidden from latest lookups, still downloadable
+	YankReason        string     `json:"yank_reason,omitempty"`
+	ReleasedAt        time.Time  `json:"released_at"` // publish time; may be in the future when scheduled
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// Release lifecycle states
+const (
+	ReleaseStatusDraft      = "draft"
+	ReleaseStatusPublished  = "published"
+	ReleaseStatusDeprecated = "deprecated"
+	ReleaseStatusEOL        = "eol"
+)
+
+// ReleaseHistoryEntry records a channel promotion, yank or lifecycle change of a release
+type ReleaseHistoryEntry struct {
+	ID          string    `json:"id"`
+	ReleaseID   string    `json:"release_id"`
+	Action      string    `json:"action"` // promote, yank, unyank, publish, deprecate, eol
+	FromChannel string    `json:"from_channel,omitempty"`
+	ToChannel   string    `json:"to_channel,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	Actor       string    `json:"actor,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// RetentionPolicy controls which releases of a product channel are garbage collected.
+// A release is kept if it is among the newest KeepLast releases or younger than MaxAgeDays.
+type RetentionPolicy struct {
+	ID          string    `json:"id"`
+	ProductName string    `json:"product_name"`
+	Channel     string    `json:"channel"`
+	KeepLast    int       `json:"keep_last"`    // 0 = no count-based retention
+	MaxAgeDays  int       `json:"max_age_days"` // 0 = no age-based retention
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ReleasePin protects a release from garbage collection on behalf of a customer
+type ReleasePin struct {
+	ID          string    `json:"id"`
+	ReleaseID   string    `json:"release_id"`
+	ProductName string    `json:"product_name"`
+	Version     string    `json:"version"`
+	CustomerID  string    `json:"customer_id"`
+	Reason      string    `json:"reason,omitempty"`
+	CreatedBy   string    `json:"created_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// RetentionReport is the result of a garbage collection run
+type RetentionReport struct {
+	DryRun         bool                 `json:"dry_run"`
+	Policies       int                  `json:"policies"`
+	Deleted        []RetentionCandidate `json:"deleted"`
+	Protected      []RetentionCandidate `json:"protected"`
+	Errors         []string             `json:"errors,omitempty"`
+	BytesReclaimed int64                `json:"bytes_reclaimed"`
+	StartedAt      time.Time            `json:"started_at"`
+	FinishedAt     time.Time            `json:"finished_at"`
+}
+
+// RetentionCandidate is a release that fell outside its retention policy
+type RetentionCandidate struct {
+	ProductName string    `json:"product_name"`
+	Version     string    `json:"version"`
+	Channel     string    `json:"channel"`
+	ReleasedAt  time.Time `json:"released_at"`
+	Size        int64     `json:"size"`
+	Reason      string    `json:"reason,omitempty"` // why a candidate was protected: installed, pinned, latest
+}
+
+// UploadSession tracks a chunked, resumable artifact upload
+type UploadSession struct {
 	ID                string    `json:"id"`
 	ProductName       string    `json:"product_name"`
 	Version           string    `json:"version"`
-	Channel           string    `json:"channel"` // stable, beta, nightly
-	Manifest          Manifest  `json:"manifest"`
-	ArtifactPath      string    `json:"artifact_path,omitempty"`
-	ArtifactSize      int64     `json:"artifact_size"`
-	Checksum          string    `json:"checksum"`
-	Signature         string    `json:"signature,omitempty"`
+	Filename          string    `json:"filename"`
+	Channel           string    `json:"channel,omitempty"`
 	ReleaseNotes      string    `json:"release_notes,omitempty"`
 	MinUpdaterVersion string    `json:"min_updater_version,omitempty"`
-	ReleasedAt        time.Time `json:"released_at"`
+	TotalSize         int64     `json:"total_size"`
+	ReceivedBytes     int64     `json:"received_bytes"` // offset of the next chunk
+	Status            string    `json:"status"`         // open, completed
+	Checksum          string    `json:"checksum,omitempty"`
+	CreatedBy         string    `json:"created_by,omitempty"`
 	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+	ExpiresAt         time.Time `json:"expires_at"`
 }
 
+// Upload session states
+const (
+	UploadStatusOpen      = "open"
+	UploadStatusCompleted = "completed"
+)
+
 // Manifest contains release metadata
 type Manifest struct {
 	Product      string     `json:"product"`
@@ -106,6 +221,175 @@ type Heartbeat struct {
 	Timestamp      time.Time       `json:"timestamp"`
 }
 
+// HeartbeatResponse is returned by the server for each heartbeat
+type HeartbeatResponse struct {
+	Status   string           `json:"status"`
+	Updates  []ReleaseInfo    `json:"updates"`
+	Warnings []ReleaseWarning `json:"warnings,omitempty"`
+	// NextHeartbeatIn is the number of seconds the updater should wait before
+	// its next heartbeat; 0 leaves it to the updater's own interval
+	NextHeartbeatIn int `json:"next_heartbeat_in,omitempty"`
+	// DesiredVersions are the product versions the instance must run. Updates
+	// for them are applied even when the updater does not update automatically.
+	DesiredVersions map[string]string `json:"desired_versions,omitempty"`
+	// Config is sent when the updater's ConfigHash does not match the
+	// settings the server holds for it; empty settings clear them
+	Config *UpdaterConfig `json:"config,omitempty"`
+	// Commands queued for the instance since its last heartbeat
+	Commands []Command `json:"commands,omitempty"`
+}
+
+// InstanceControl is what operators tell an instance through its heartbeat
+// responses
+type InstanceControl struct {
+	DesiredVersions map[string]string `json:"desired_versions"` // product -> version, whatever its channel offers
+	Config          *UpdaterConfig    `json:"config,omitempty"`
+}
+
+// UpdaterConfig holds updater settings managed from the server, which
+// override the updater's config file. Unset fields leave it unchanged.
+type UpdaterConfig struct {
+	Channel           string             `json:"channel,omitempty"`
+	ProductChannels   map[string]string  `json:"product_channels,omitempty"`
+	AutoUpdate        *bool              `json:"auto_update,omitempty"`
+	MaintenanceWindow *MaintenanceWindow `json:"maintenance_window,omitempty"`
+}
+
+// MaintenanceWindow limits when updates may be applied
+type MaintenanceWindow struct {
+	Start    string `json:"start"`              // HH:MM
+	End      string `json:"end"`                // HH:MM
+	Timezone string `json:"timezone,omitempty"` // e.g. "UTC"; local time when empty
+}
+
+// Hash identifies the settings. An updater reports the hash of the settings
+// it applied as Heartbeat.ConfigHash; no settings hash to "".
+func (c *UpdaterConfig) Hash() string {
+	if c == nil || (c.Channel == "" && len(c.ProductChannels) == 0 && c.AutoUpdate == nil && c.MaintenanceWindow == nil) {
+		return ""
+	}
+	data, _ := json.Marshal(c)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Command types
+const (
+	CommandCheckUpdate        = "check_update"
+	CommandRestartService     = "restart_service"
+	CommandSecurityScan       = "security_scan"
+	CommandRollback           = "rollback"
+	CommandCollectDiagnostics = "collect_diagnostics"
+)
+
+// Command statuses
+const (
+	CommandPending   = "pending"   // queued until the instance's next heartbeat
+	CommandDelivered = "delivered" // sent in a heartbeat response, awaiting its result
+	CommandSucceeded = "succeeded"
+	CommandFailed    = "failed"
+	CommandRejected  = "rejected" // the updater refused it: not allowed or not signed
+	CommandExpired   = "expired"  // not delivered, or no result reported, in time
+	CommandCancelled = "cancelled"
+)
+
+// Command is an action the server asks an updater to carry out. It is signed
+// by the server, and updaters only run commands for themselves that have not
+// expired.
+type Command struct {
+	ID         string            `json:"id"`
+	InstanceID string            `json:"instance_id"`
+	Type       string            `json:"type"`
+	Product    string            `json:"product,omitempty"`
+	Args       map[string]string `json:"args,omitempty"`
+	ExpiresAt  time.Time         `json:"expires_at"`
+	Signature  string            `json:"signature"` // base64 Ed25519 signature of SigningPayload
+}
+
+// SigningPayload returns the bytes a command's signature covers. No args and
+// empty args sign the same, as they may not survive storage and JSON alike.
+func (c *Command) SigningPayload() []byte {
+	args := c.Args
+	if len(args) == 0 {
+		args = nil
+	}
+	data, _ := json.Marshal(struct {
+		ID         string            `json:"id"`
+		InstanceID string            `json:"instance_id"`
+		Type       string            `json:"type"`
+		Product    string            `json:"product"`
+		Args       map[string]string `json:"args"`
+		ExpiresAt  string            `json:"expires_at"`
+	}{c.ID, c.InstanceID, c.Type, c.Product, args, c.ExpiresAt.UTC().Format(time.RFC3339)})
+	return data
+}
+
+// InstanceCommand is a command queued for an instance and what became of it
+type InstanceCommand struct {
+	Command
+	Status      string     `json:"status"`
+	Output      string     `json:"output,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	CreatedBy   string     `json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// CreateCommandRequest queues a command for an instance
+type CreateCommandRequest struct {
+	Type    string            `json:"type"`
+	Product string            `json:"product,omitempty"`
+	Args    map[string]string `json:"args,omitempty"`
+}
+
+// CommandResult is what an updater reports after carrying out a command
+type CommandResult struct {
+	CommandID  string    `json:"command_id"`
+	InstanceID string    `json:"instance_id"`
+	Status     string    `json:"status"` // succeeded, failed, rejected
+	Output     string    `json:"output,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// HeartbeatBatch carries heartbeats and alerts an updater could not deliver
+// when they were raised, and command results, oldest first
+type HeartbeatBatch struct {
+	Heartbeats []Heartbeat     `json:"heartbeats,omitempty"`
+	Alerts     []InstanceAlert `json:"alerts,omitempty"`
+	Results    []CommandResult `json:"results,omitempty"`
+}
+
+// HeartbeatBatchResponse counts what the server recorded from a batch.
+// Entries for unknown instances or commands are dropped.
+type HeartbeatBatchResponse struct {
+	Heartbeats int `json:"heartbeats"`
+	Alerts     int `json:"alerts"`
+	Results    int `json:"results"`
+}
+
+// InstanceAlert is an alert raised by an updater, such as a service that
+// could not be restarted
+type InstanceAlert struct {
+	ID         string     `json:"id,omitempty"`
+	InstanceID string     `json:"instance_id"`
+	Type       string     `json:"type"`
+	Severity   string     `json:"severity"` // critical, high, medium, low
+	Message    string     `json:"message"`
+	Details    string     `json:"details,omitempty"`
+	Time       time.Time  `json:"time"` // when the updater raised it
+	ReceivedAt *time.Time `json:"received_at,omitempty"`
+}
+
+// ReleaseWarning flags an installed version that is deprecated or end-of-life
+type ReleaseWarning struct {
+	Product string `json:"product"`
+	Version string `json:"version"`
+	Status  string `json:"status"` // deprecated, eol
+	Message string `json:"message"`
+}
+
 // LicenseStatus reports license state
 type LicenseStatus struct {
 	Key       string    `json:"key"`
@@ -205,9 +489,12 @@ type InstallManifest struct {
 
 // ProductInstall specifies a product to install
 type ProductInstall struct {
-	Name    string `json:"name"`
-	Version string `json:"version"` // "latest" or specific version
-	Channel string `json:"channel"`
+	Name           string `json:"name"`
+	Version        string `json:"version"` // "latest" or specific version
+	Channel        string `json:"channel"`
+	Type           string `json:"type,omitempty"`         // binary, data, config
+	InstallPath    string `json:"install_path,omitempty"` // relative to the instance base dir
+	HealthEndpoint string `json:"health_endpoint,omitempty"`
 }
 
 // ReleaseInfo is the response for release queries
@@ -233,15 +520,17 @@ type User struct {
 	ID                string     `json:"id"`
 	Email             string     `json:"email"`
 	Name              string     `json:"name"`
-	Role              string     `json:"role"` // admin, operator, viewer
+	Role              string     `json:"role"` // admin, operator, viewer or a custom role
 	AvatarURL         string     `json:"avatar_url,omitempty"`
 	MFAEnabled        bool       `json:"mfa_enabled"`
 	IsActive          bool       `json:"is_active"`
+	IsServiceAccount  bool       `json:"is_service_account"`
 	EmailVerified     bool       `json:"email_verified"`
 	LastLoginAt       *time.Time `json:"last_login_at,omitempty"`
 	PasswordChangedAt time.Time  `json:"password_changed_at"`
 	CreatedAt         time.Time  `json:"created_at"`
 	UpdatedAt         time.Time  `json:"updated_at"`
+	Permissions       []string   `json:"permissions,omitempty"` // granted by the role; set on the profile
 }
 
 // UserWithPassword includes the password hash for internal use
@@ -256,14 +545,21 @@ type UserWithPassword struct {
 
 // Session represents an authenticated session
 type Session struct {
-	ID               string    `json:"id"`
-	UserID           string    `json:"user_id"`
-	RefreshTokenHash string    `json:"-"`
-	UserAgent        string    `json:"user_agent,omitempty"`
-	IPAddress        string    `json:"ip_address,omitempty"`
-	ExpiresAt        time.Time `json:"expires_at"`
+	ID               string     `json:"id"`
+	UserID           string     `json:"user_id"`
+	RefreshTokenHash string     `json:"-"`
+	UserAgent        string     `json:"user_agent,omitempty"`
+	IPAddress        string     `json:"ip_address,omitempty"` // where it was last refreshed from
+	Browser          string     `json:"browser,omitempty"`
+	OS               string     `json:"os,omitempty"`
+	DeviceType       string     `json:"device_type,omitempty"` // desktop, mobile, tablet, cli, unknown
+	Current          bool       `json:"current,omitempty"`     // the session making the request
+	LastUsedAt       time.Time  `json:"last_used_at"`
+	IdleExpiresAt    time.Time  `json:"idle_expires_at"` // when it ends unless refreshed
+	ExpiresAt        time.Time  `json:"expires_at"`      // when it ends regardless of use
 	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
-	CreatedAt        time.Time `json:"created_at"`
+	RevokedReason    string     `json:"revoked_reason,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
 }
 
 // AuthAuditLog represents a security audit event
@@ -287,16 +583,18 @@ type LoginRequest struct {
 type LoginResponse struct {
 	RequiresMFA bool   `json:"requires_mfa"`
 	MFAToken    string `json:"mfa_token,omitempty"` // Temporary token to complete MFA
+	MFAMethods  []string `json:"mfa_methods,omitempty"` // "totp" and/or "webauthn"
 	AccessToken  string `json:"access_token,omitempty"`
 	RefreshToken string `json:"refresh_token,omitempty"`
 	User         *User  `json:"user,omitempty"`
 	ExpiresIn    int    `json:"expires_in,omitempty"` // seconds
 }
 
-// MFAVerifyRequest verifies the TOTP code
+// MFAVerifyRequest completes login with a TOTP or backup code, or a WebAuthn assertion
 type MFAVerifyRequest struct {
-	MFAToken string `json:"mfa_token"` // From LoginResponse
-	TOTPCode string `json:"totp_code"`
+	MFAToken string             `json:"mfa_token"` // From LoginResponse
+	TOTPCode string             `json:"totp_code,omitempty"`
+	WebAuthn *WebAuthnAssertion `json:"webauthn,omitempty"`
 }
 
 // MFASetupResponse contains QR code data for setting up authenticator
@@ -346,6 +644,22 @@ type ChangePasswordRequest struct {
 	NewPassword     string `json:"new_password"`
 }
 
+// ForgotPasswordRequest asks for a password reset email
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest sets a new password with the token from a reset email
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// VerifyEmailRequest confirms an email address with the token from a verification email
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
 // CreateUserRequest creates a new user (admin only)
 type CreateUserRequest struct {
 	Email    string `json:"email"`
@@ -363,8 +677,272 @@ type UpdateUserRequest struct {
 
 // JWTClaims are the claims in the JWT token
 type JWTClaims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
-	Type   string `json:"type"` // access, refresh, mfa
+	UserID    string `json:"user_id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	Type      string `json:"type"`          // access, refresh, mfa
+	SessionID string `json:"sid,omitempty"` // the session an access token was issued to
+}
+
+// SigningKey describes a key that signs access tokens. It signs between
+// NotBefore and NotAfter and verifies tokens until ExpiresAt.
+type SigningKey struct {
+	ID        string    `json:"id"` // kid
+	Algorithm string    `json:"algorithm"`
+	Status    string    `json:"status"` // pending, active, retired
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+}
+
+// JWKS is the set of keys published at /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// RotateSigningKeyRequest starts using a new signing key immediately
+type RotateSigningKeyRequest struct {
+	// RevokePrevious stops accepting tokens signed by earlier keys, e.g. after a leak
+	RevokePrevious bool `json:"revoke_previous"`
+}
+
+// APIToken is a named, scoped API token owned by a user or service account
+type APIToken struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	UserEmail  string     `json:"user_email,omitempty"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	Products   []string   `json:"products"` // empty = all products
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreateAPITokenRequest creates an API token
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	Products      []string `json:"products,omitempty"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty"` // 0 = never expires
+}
+
+// CreateAPITokenResponse returns the plaintext token, which is only shown once
+type CreateAPITokenResponse struct {
+	Token    string    `json:"token"`
+	APIToken *APIToken `json:"api_token"`
+}
+
+// CreateServiceAccountRequest creates a service account for CI and automation
+type CreateServiceAccountRequest struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// Permission is a single action that roles and API tokens can grant
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Role is a named set of permissions. Built-in roles cannot be changed.
+type Role struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Permissions []string  `json:"permissions"`
+	BuiltIn     bool      `json:"built_in"`
+	CreatedAt   time.Time `json:"created_at,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at,omitempty"`
+}
+
+// CreateRoleRequest creates a custom role
+type CreateRoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// UpdateRoleRequest replaces the description and permissions of a custom role
+type UpdateRoleRequest struct {
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// Organization is a customer or partner that owns licenses and their instances
+type Organization struct {
+	ID        string    `json:"id"`
+	Slug      string    `json:"slug"` // customer_id of the organization's licenses
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OrganizationMember is a user with access to an organization
+type OrganizationMember struct {
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserIdentity links a user to an account at an OIDC provider
+type UserIdentity struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	Issuer      string     `json:"issuer"`
+	Subject     string     `json:"subject"`
+	Email       string     `json:"email,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// OIDCStatus tells the dashboard which login methods are available
+type OIDCStatus struct {
+	Enabled               bool `json:"enabled"`
+	DisableLocalPasswords bool `json:"disable_local_passwords"`
+}
+
+// OIDCTokenRequest redeems the one-time code the dashboard receives after single sign-on
+type OIDCTokenRequest struct {
+	Code string `json:"code"`
+}
+
+// OIDCLinkResponse carries the token a signed-in user passes to
+// /api/v1/auth/oidc/login?link= to link their account to an identity
+type OIDCLinkResponse struct {
+	Token string `json:"token"`
+}
+
+// WebAuthnCredential is a security key or passkey registered as a second factor
+type WebAuthnCredential struct {
+	ID           string     `json:"id"`
+	UserID       string     `json:"user_id"`
+	Name         string     `json:"name"`
+	CredentialID string     `json:"credential_id"` // base64url, as used by browsers
+	PublicKey    []byte     `json:"-"`             // COSE_Key
+	SignCount    uint32     `json:"sign_count"`
+	Transports   []string   `json:"transports"`
+	AAGUID       string     `json:"aaguid,omitempty"` // authenticator model
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// WebAuthnOptions starts a registration or assertion ceremony. PublicKey is passed
+// to navigator.credentials.create() or .get() after decoding its base64url fields.
+type WebAuthnOptions struct {
+	ChallengeID string                 `json:"challenge_id"`
+	PublicKey   map[string]interface{} `json:"public_key"`
+}
+
+// WebAuthnCredentialResponse is a PublicKeyCredential from the browser with its
+// binary fields base64url encoded
+type WebAuthnCredentialResponse struct {
+	ID       string                        `json:"id"`
+	RawID    string                        `json:"rawId"`
+	Type     string                        `json:"type"`
+	Response WebAuthnAuthenticatorResponse `json:"response"`
+}
+
+// WebAuthnAuthenticatorResponse holds an attestation (registration) or an
+// assertion (login) response
+type WebAuthnAuthenticatorResponse struct {
+	ClientDataJSON    string   `json:"clientDataJSON"`
+	AttestationObject string   `json:"attestationObject,omitempty"`
+	Transports        []string `json:"transports,omitempty"`
+	AuthenticatorData string   `json:"authenticatorData,omitempty"`
+	Signature         string   `json:"signature,omitempty"`
+	UserHandle        string   `json:"userHandle,omitempty"`
+}
+
+// WebAuthnRegisterRequest completes the registration of a named credential
+type WebAuthnRegisterRequest struct {
+	ChallengeID string                     `json:"challenge_id"`
+	Name        string                     `json:"name"`
+	Credential  WebAuthnCredentialResponse `json:"credential"`
+}
+
+// WebAuthnAssertion answers a login challenge
+type WebAuthnAssertion struct {
+	ChallengeID string                     `json:"challenge_id"`
+	Credential  WebAuthnCredentialResponse `json:"credential"`
+}
+
+// WebAuthnLoginOptionsRequest requests an assertion challenge during login
+type WebAuthnLoginOptionsRequest struct {
+	MFAToken string `json:"mfa_token"`
+}
+
+// RenameWebAuthnCredentialRequest renames a credential
+type RenameWebAuthnCredentialRequest struct {
+	Name string `json:"name"`
+}
+
+// AuditEntry records one mutating API call. Entries are hash-chained: Hash
+// covers the entry and PrevHash, the hash of the entry before it.
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	ActorType  string          `json:"actor_type"` // user, api_token or anonymous
+	ActorID    string          `json:"actor_id,omitempty"`
+	ActorEmail string          `json:"actor_email,omitempty"`
+	TokenID    string          `json:"token_id,omitempty"` // API token used, if any
+	Action     string          `json:"action"`             // method and route, e.g. "PUT /api/v1/admin/licenses/{id}"
+	TargetType string          `json:"target_type,omitempty"`
+	TargetID   string          `json:"target_id,omitempty"`
+	Method     string          `json:"method"`
+	Path       string          `json:"path"`
+	Status     int             `json:"status"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	Changes    json.RawMessage `json:"changes,omitempty"` // {"field": {"before": ..., "after": ...}}
+	IPAddress  string          `json:"ip_address,omitempty"`
+	UserAgent  string          `json:"user_agent,omitempty"`
+	RequestID  string          `json:"request_id,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+}
+
+// AuditFilter narrows audit log searches and exports
+type AuditFilter struct {
+	Actor      string // actor email or ID
+	Action     string // substring of the action
+	TargetType string
+	TargetID   string
+	Query      string // free text across path, target, actor and before/after
+	From       *time.Time
+	To         *time.Time
+}
+
+// AuditPage is one page of audit log entries, newest first
+type AuditPage struct {
+	Entries []AuditEntry `json:"entries"`
+	Total   int64        `json:"total"`
+	Page    int          `json:"page"`
+	PerPage int          `json:"per_page"`
+}
+
+// AuditVerification is the result of checking the audit log hash chain
+type AuditVerification struct {
+	Valid    bool   `json:"valid"`
+	Entries  int64  `json:"entries"`
+	HeadHash string `json:"head_hash,omitempty"` // record it elsewhere to detect truncation later
+	BrokenAt *int64 `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
 }
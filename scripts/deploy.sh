@@ -169,8 +169,8 @@ DB_SSL_MODE=disable
 STORAGE_PATH=/home/bitnami/updates-mysoc-ai/data/releases
 
 # Security
-ADMIN_API_KEY=changeme-generate-secure-key
-JWT_SECRET=changeme-generate-secure-jwt-secret
+# Required, at least 32 characters: openssl rand -base64 48
+JWT_SECRET=
 
 # Logging
 LOG_LEVEL=info
@@ -228,7 +228,7 @@ show_info() {
     echo "Next Steps:"
     echo "  1. Configure PostgreSQL database"
     echo "  2. Edit $REMOTE_DIR/config/.env with your settings"
-    echo "  3. Run migrations: psql -d mysoc_updates -f $REMOTE_DIR/migrations/001_initial.up.sql"
+    echo "  3. Run migrations: $REMOTE_DIR/bin/update-server migrate up (with the settings from config/.env)"
     echo "  4. Restart: sudo systemctl restart update-server"
     echo ""
 }
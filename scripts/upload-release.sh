@@ -22,7 +22,11 @@ NC='\033[0m'
 
 # Configuration
 UPDATE_SERVER="${UPDATE_SERVER:-https://updates.mysoc.ai}"
-ADMIN_API_KEY="${ADMIN_API_KEY:-}"
+API_TOKEN="${API_TOKEN:-}"
+CHANNEL="${CHANNEL:-}"
+CHUNK_SIZE="${CHUNK_SIZE:-8388608}"  # 8 MiB
+MAX_RETRIES="${MAX_RETRIES:-5}"
+UPLOAD_SESSION="${UPLOAD_SESSION:-}"
 
 # Functions
 log_info() { echo -e "${CYAN}→${NC} $1"; }
@@ -40,11 +44,15 @@ print_usage() {
     echo ""
     echo "Environment variables:"
     echo "  UPDATE_SERVER   Update server URL (default: https://updates.mysoc.ai)"
-    echo "  ADMIN_API_KEY   Admin API key for authentication (required)"
+    echo "  API_TOKEN       API token with the releases:upload scope (required)"
+    echo "  CHANNEL         Release channel (default: the product's default channel)"
+    echo "  CHUNK_SIZE      Upload chunk size in bytes (default: 8388608)"
+    echo "  MAX_RETRIES     Retries per chunk before giving up (default: 5)"
+    echo "  UPLOAD_SESSION  Resume an interrupted upload session"
     echo ""
     echo "Examples:"
-    echo "  ADMIN_API_KEY=xxx ./upload-release.sh siemcore v1.5.0 ./bin/siemcore-linux-amd64"
-    echo "  ADMIN_API_KEY=xxx ./upload-release.sh siemcore v1.5.0 ./bin/siemcore-linux-arm64"
+    echo "  API_TOKEN=msu_xxx ./upload-release.sh siemcore v1.5.0 ./bin/siemcore-linux-amd64"
+    echo "  API_TOKEN=msu_xxx ./upload-release.sh siemcore v1.5.0 ./bin/siemcore-linux-arm64"
 }
 
 # Validate arguments
@@ -57,11 +65,12 @@ PRODUCT="$1"
 VERSION="$2"
 BINARY_PATH="$3"
 
-# Validate API key
-if [ -z "$ADMIN_API_KEY" ]; then
-    log_error "ADMIN_API_KEY environment variable is required"
+# Validate API token
+if [ -z "$API_TOKEN" ]; then
+    log_error "API_TOKEN environment variable is required"
     echo ""
-    echo "Set it with: export ADMIN_API_KEY=your-admin-key"
+    echo "Create a token with the releases:upload scope under /api/v1/auth/tokens"
+    echo "or for a service account, then: export API_TOKEN=msu_..."
     exit 1
 fi
 
@@ -82,8 +91,8 @@ if command -v sha256sum &> /dev/null; then
 elif command -v shasum &> /dev/null; then
     CHECKSUM=$(shasum -a 256 "$BINARY_PATH" | awk '{print $1}')
 else
-    log_warn "Neither sha256sum nor shasum found, skipping checksum"
-    CHECKSUM=""
+    log_error "Neither sha256sum nor shasum found, the server needs the checksum to verify the upload"
+    exit 1
 fi
 
 echo ""
@@ -95,55 +104,127 @@ printf "│ %-15s %-43s │\n" "Version:" "$VERSION"
 printf "│ %-15s %-43s │\n" "Filename:" "$FILENAME"
 printf "│ %-15s %-43s │\n" "Size:" "$(numfmt --to=iec-i --suffix=B $FILESIZE 2>/dev/null || echo "$FILESIZE bytes")"
 printf "│ %-15s %-43s │\n" "Checksum:" "${CHECKSUM:0:32}..."
+printf "│ %-15s %-43s │\n" "Chunk size:" "$CHUNK_SIZE bytes"
 printf "│ %-15s %-43s │\n" "Server:" "$UPDATE_SERVER"
 echo "└─────────────────────────────────────────────────────────────┘"
 echo ""
 
-# Upload binary
+# Upload binary in resumable chunks
 log_info "Uploading $FILENAME to $UPDATE_SERVER..."
 
-UPLOAD_URL="${UPDATE_SERVER}/api/v1/releases/${PRODUCT}/${VERSION}/${FILENAME}"
+# json_field <json> <field> extracts a string or number field from a flat JSON response
+json_field() {
+    echo "$1" | grep -o "\"$2\":[^,}]*" | head -1 | cut -d: -f2- | tr -d '"'
+}
+
+# api <curl args...> prints the response body followed by the HTTP code on its own line
+api() {
+    curl -s -w "\n%{http_code}" -H "X-API-Key: $API_TOKEN" "$@"
+}
+
+UPLOADS_URL="${UPDATE_SERVER}/api/v1/uploads"
+
+if [ -n "$UPLOAD_SESSION" ]; then
+    SESSION_ID="$UPLOAD_SESSION"
+    log_info "Resuming upload session $SESSION_ID"
+else
+    HTTP_RESPONSE=$(api -X POST \
+        -H "Content-Type: application/json" \
+        -d "{\"product\":\"$PRODUCT\",\"version\":\"$VERSION\",\"filename\":\"$FILENAME\",\"size\":$FILESIZE,\"channel\":\"$CHANNEL\"}" \
+        "$UPLOADS_URL")
+    HTTP_BODY=$(echo "$HTTP_RESPONSE" | sed '$d')
+    HTTP_CODE=$(echo "$HTTP_RESPONSE" | tail -1)
+
+    if [ "$HTTP_CODE" -ne 201 ]; then
+        log_error "Failed to create upload session (HTTP $HTTP_CODE)"
+        echo "$HTTP_BODY"
+        exit 1
+    fi
+    SESSION_ID=$(json_field "$HTTP_BODY" "id")
+    log_info "Upload session $SESSION_ID (resume with UPLOAD_SESSION=$SESSION_ID)"
+fi
+
+# Ask the server where to continue from
+HTTP_RESPONSE=$(api "$UPLOADS_URL/$SESSION_ID")
+OFFSET=$(json_field "$(echo "$HTTP_RESPONSE" | sed '$d')" "received_bytes")
+if [ -z "$OFFSET" ]; then
+    log_error "Upload session $SESSION_ID not found"
+    exit 1
+fi
+
+RETRIES=0
+while [ "$OFFSET" -lt "$FILESIZE" ]; do
+    HTTP_RESPONSE=$(tail -c +$((OFFSET + 1)) "$BINARY_PATH" | head -c "$CHUNK_SIZE" | api -X PUT \
+        -H "Content-Type: application/octet-stream" \
+        -H "Upload-Offset: $OFFSET" \
+        --data-binary @- \
+        "$UPLOADS_URL/$SESSION_ID" || echo -e "\n000")
+    HTTP_BODY=$(echo "$HTTP_RESPONSE" | sed '$d')
+    HTTP_CODE=$(echo "$HTTP_RESPONSE" | tail -1)
+
+    if [ "$HTTP_CODE" -eq 200 ] || [ "$HTTP_CODE" -eq 409 ]; then
+        NEW_OFFSET=$(json_field "$HTTP_BODY" "received_bytes")
+        if [ -n "$NEW_OFFSET" ]; then
+            OFFSET="$NEW_OFFSET"
+            RETRIES=0
+            printf "\r  %s / %s bytes" "$OFFSET" "$FILESIZE"
+            continue
+        fi
+    fi
 
-HTTP_RESPONSE=$(curl -s -w "\n%{http_code}" \
-    -X PUT \
-    -H "X-API-Key: $ADMIN_API_KEY" \
-    -H "Content-Type: application/octet-stream" \
-    --data-binary "@$BINARY_PATH" \
-    "$UPLOAD_URL")
+    RETRIES=$((RETRIES + 1))
+    if [ "$RETRIES" -gt "$MAX_RETRIES" ]; then
+        echo ""
+        log_error "Chunk upload failed with HTTP $HTTP_CODE after $MAX_RETRIES retries"
+        echo "$HTTP_BODY"
+        echo "Resume later with: UPLOAD_SESSION=$SESSION_ID $0 $*"
+        exit 1
+    fi
+    echo ""
+    log_warn "Chunk at offset $OFFSET failed (HTTP $HTTP_CODE), retrying ($RETRIES/$MAX_RETRIES)..."
+    sleep $((RETRIES * 2))
+
+    # Re-sync the offset in case the server stored the chunk before the connection dropped
+    HTTP_RESPONSE=$(api "$UPLOADS_URL/$SESSION_ID" || true)
+    NEW_OFFSET=$(json_field "$(echo "$HTTP_RESPONSE" | sed '$d')" "received_bytes")
+    [ -n "$NEW_OFFSET" ] && OFFSET="$NEW_OFFSET"
+done
+echo ""
 
+# Finalize: the server verifies the SHA-256 before storing the artifact
+HTTP_RESPONSE=$(api -X POST \
+    -H "Content-Type: application/json" \
+    -d "{\"sha256\":\"$CHECKSUM\"}" \
+    "$UPLOADS_URL/$SESSION_ID/complete")
 HTTP_BODY=$(echo "$HTTP_RESPONSE" | sed '$d')
 HTTP_CODE=$(echo "$HTTP_RESPONSE" | tail -1)
 
 if [ "$HTTP_CODE" -eq 200 ]; then
-    log_success "Binary uploaded successfully!"
+    log_success "Binary uploaded and checksum verified!"
     echo ""
     echo "Download URL:"
     echo -e "  ${CYAN}${UPDATE_SERVER}/${PRODUCT}/${VERSION}/${FILENAME}${NC}"
     echo ""
-    
-    # Upload checksum file if we have one
-    if [ -n "$CHECKSUM" ]; then
-        log_info "Uploading checksum file..."
-        echo "$CHECKSUM  $FILENAME" > "/tmp/${FILENAME}.sha256"
-        
-        CHECKSUM_RESPONSE=$(curl -s -w "\n%{http_code}" \
-            -X PUT \
-            -H "X-API-Key: $ADMIN_API_KEY" \
-            -H "Content-Type: text/plain" \
-            --data-binary "@/tmp/${FILENAME}.sha256" \
-            "${UPDATE_SERVER}/api/v1/releases/${PRODUCT}/${VERSION}/${FILENAME}.sha256")
-        
-        CHECKSUM_CODE=$(echo "$CHECKSUM_RESPONSE" | tail -1)
-        if [ "$CHECKSUM_CODE" -eq 200 ]; then
-            log_success "Checksum file uploaded"
-            echo "  ${UPDATE_SERVER}/${PRODUCT}/${VERSION}/${FILENAME}.sha256"
-        else
-            log_warn "Failed to upload checksum file"
-        fi
-        rm -f "/tmp/${FILENAME}.sha256"
+
+    # Upload checksum file alongside the binary
+    log_info "Uploading checksum file..."
+    echo "$CHECKSUM  $FILENAME" > "/tmp/${FILENAME}.sha256"
+
+    CHECKSUM_RESPONSE=$(api -X PUT \
+        -H "Content-Type: text/plain" \
+        --data-binary "@/tmp/${FILENAME}.sha256" \
+        "${UPDATE_SERVER}/api/v1/releases/${PRODUCT}/${VERSION}/${FILENAME}.sha256")
+
+    CHECKSUM_CODE=$(echo "$CHECKSUM_RESPONSE" | tail -1)
+    if [ "$CHECKSUM_CODE" -eq 200 ]; then
+        log_success "Checksum file uploaded"
+        echo "  ${UPDATE_SERVER}/${PRODUCT}/${VERSION}/${FILENAME}.sha256"
+    else
+        log_warn "Failed to upload checksum file"
     fi
+    rm -f "/tmp/${FILENAME}.sha256"
 else
-    log_error "Upload failed with HTTP $HTTP_CODE"
+    log_error "Finalizing upload failed with HTTP $HTTP_CODE"
     echo "$HTTP_BODY"
     exit 1
 fi